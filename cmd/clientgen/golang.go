@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"sort"
+	"strings"
+)
+
+func generateGo(doc *spec, pkg string) ([]byte, error) {
+	endpoints, err := doc.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by clientgen from the OpenAPI document. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString(`import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Avoid unused imports when the document has no such fields or parameters
+var (
+	_ = time.Time{}
+	_ = url.PathEscape
+)
+
+`)
+	fmt.Fprintf(&b, "// basePath is the path the API version is served under\nconst basePath = %q\n\n", doc.basePath())
+	b.WriteString(goRuntime)
+
+	for _, name := range doc.schemaNames() {
+		s := doc.Components.Schemas[name]
+		fmt.Fprintf(&b, "type %s %s\n\n", exported(name), goType(s, false))
+	}
+
+	for _, e := range endpoints {
+		writeGoMethod(&b, e)
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+func writeGoMethod(b *bytes.Buffer, e endpoint) {
+	args := []string{"ctx context.Context"}
+	for _, p := range e.Params {
+		args = append(args, unexported(p)+" string")
+	}
+	body := "nil"
+	if e.Request != nil {
+		args = append(args, "body "+goType(e.Request, true))
+		body = "body"
+	}
+
+	path := fmt.Sprintf("%q", e.Path)
+	for _, p := range e.Params {
+		path = strings.Replace(path, "{"+p+"}", `"+url.PathEscape(`+unexported(p)+`)+"`, 1)
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, `""+`), `+""`)
+
+	if e.Summary != "" {
+		fmt.Fprintf(b, "// %s %s\n//\n", e.Name, lowerFirst(e.Summary))
+	}
+	fmt.Fprintf(b, "// %s %s\n", e.Method, e.Path)
+	if e.Deprecated {
+		b.WriteString("//\n// Deprecated: the operation is deprecated by the API.\n")
+	}
+
+	if e.Response == nil {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) (json.RawMessage, error) {\n", e.Name, strings.Join(args, ", "))
+		fmt.Fprintf(b, "\tvar out json.RawMessage\n\terr := c.do(ctx, %q, %s, %s, &out)\n\treturn out, err\n}\n\n", e.Method, path, body)
+		return
+	}
+	out := goType(e.Response, true)
+	fmt.Fprintf(b, "func (c *Client) %s(%s) (%s, error) {\n", e.Name, strings.Join(args, ", "), out)
+	if strings.HasPrefix(out, "*") {
+		fmt.Fprintf(b, "\tout := new(%s)\n\tif err := c.do(ctx, %q, %s, %s, out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn out, nil\n}\n\n", out[1:], e.Method, path, body)
+	} else {
+		fmt.Fprintf(b, "\tvar out %s\n\terr := c.do(ctx, %q, %s, %s, &out)\n\treturn out, err\n}\n\n", out, e.Method, path, body)
+	}
+}
+
+// goType maps a schema to a Go type. Top-level references are pointers so methods
+// return and accept *User rather than copies.
+func goType(s *schema, top bool) string {
+	if s == nil {
+		return "json.RawMessage"
+	}
+	var t string
+	switch {
+	case s.Ref != "":
+		t = exported(refName(s.Ref))
+		if top {
+			return "*" + t
+		}
+	case s.Type == "string" && s.Format == "date-time":
+		t = "time.Time"
+	case s.Type == "string" && s.Format == "byte":
+		t = "[]byte"
+	case s.Type == "string":
+		t = "string"
+	case s.Type == "boolean":
+		t = "bool"
+	case s.Type == "integer" && s.Format == "int64":
+		t = "int64"
+	case s.Type == "integer":
+		t = "int"
+	case s.Type == "number":
+		t = "float64"
+	case s.Type == "array":
+		return "[]" + goType(s.Items, false)
+	case s.Type == "object" && len(s.Properties) > 0:
+		t = goStruct(s)
+		if top {
+			return "*" + t
+		}
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map[string]" + goType(s.AdditionalProperties, false)
+	case s.Type == "object":
+		return "map[string]any"
+	default:
+		return "json.RawMessage"
+	}
+	if s.Nullable && !top {
+		return "*" + t
+	}
+	return t
+}
+
+func goStruct(s *schema) string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, name := range names {
+		tag := name
+		if !slices.Contains(s.Required, name) {
+			tag += ",omitempty"
+		}
+		field := exported(name)
+		if field == "" {
+			field = "Field"
+		}
+		fmt.Fprintf(&b, "\t%s %s `json:%q`\n", field, goType(s.Properties[name], false), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// goRuntime is the hand-written part of every generated Go client
+const goRuntime = `// Client calls the API at a base URL like https://api.example.com
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+}
+
+// Option customises a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithHeader adds a header to every request, such as Authorization
+func WithHeader(name, value string) Option {
+	return func(c *Client) { c.header.Add(name, value) }
+}
+
+// New creates a client for the API at baseURL
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: http.DefaultClient, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is an error response from the API
+type Error struct {
+	StatusCode int             ` + "`json:\"-\"`" + `
+	Code       string          ` + "`json:\"code\"`" + `
+	Message    string          ` + "`json:\"message\"`" + `
+	Details    json.RawMessage ` + "`json:\"details,omitempty\"`" + `
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("api: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+basePath+path, reader)
+	if err != nil {
+		return err
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		json.Unmarshal(raw, apiErr)
+		return apiErr
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+`
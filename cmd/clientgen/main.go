@@ -0,0 +1,304 @@
+// Command clientgen generates a typed API client from the OpenAPI document the
+// service serves for a version, as a Go package or a TypeScript module:
+//
+//	clientgen -spec openapi.json -package client -o client.gen.go
+//	clientgen -spec http://localhost:8080/api/v1/openapi.json -lang ts -o api.ts
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// spec is the part of an OpenAPI 3.0 document the generators use
+type spec struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Deprecated  bool        `json:"deprecated"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type parameter struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Nullable             bool               `json:"nullable"`
+}
+
+// endpoint is an operation flattened for the generators
+type endpoint struct {
+	Name       string // Exported method name
+	Summary    string
+	Deprecated bool
+	Method     string
+	Path       string   // OpenAPI template, like /users/{id}
+	Params     []string // Path parameters in order
+	Request    *schema
+	Response   *schema
+}
+
+func main() {
+	specPath := flag.String("spec", "openapi.json", "OpenAPI document, a file or an http(s) URL")
+	lang := flag.String("lang", "go", "Output language: go or ts")
+	pkg := flag.String("package", "client", "Go package name")
+	out := flag.String("o", "", "Output file, standard output if empty")
+	flag.Parse()
+
+	doc, err := load(*specPath)
+	if err != nil {
+		fail(err)
+	}
+
+	var src []byte
+	switch *lang {
+	case "go":
+		src, err = generateGo(doc, *pkg)
+	case "ts":
+		src, err = generateTS(doc)
+	default:
+		err = fmt.Errorf("unknown language %q", *lang)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*out, src, 0o644)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "clientgen:", err)
+	os.Exit(1)
+}
+
+func load(path string) (*spec, error) {
+	var r io.Reader
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		resp, err := http.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch %s: %s", path, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var doc spec
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &doc, nil
+}
+
+// basePath is the path of the document's first server, prefixed to every operation
+func (doc *spec) basePath() string {
+	if len(doc.Servers) == 0 {
+		return ""
+	}
+	url := doc.Servers[0].URL
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+		if j := strings.IndexByte(url, '/'); j >= 0 {
+			url = url[j:]
+		} else {
+			url = ""
+		}
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// endpoints returns the operations sorted by path and method, named after their
+// operationId or, without one, their method and path
+func (doc *spec) endpoints() ([]endpoint, error) {
+	var list []endpoint
+	seen := make(map[string]string)
+	for path, methods := range doc.Paths {
+		for method, op := range methods {
+			e := endpoint{
+				Name:       exported(op.OperationID),
+				Summary:    op.Summary,
+				Deprecated: op.Deprecated,
+				Method:     strings.ToUpper(method),
+				Path:       path,
+			}
+			if e.Name == "" {
+				e.Name = nameFromRoute(method, path)
+			}
+			if other, ok := seen[e.Name]; ok {
+				return nil, fmt.Errorf("%s %s and %s both map to %s, set an operation ID", e.Method, path, other, e.Name)
+			}
+			seen[e.Name] = e.Method + " " + path
+
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					e.Params = append(e.Params, p.Name)
+				}
+			}
+			if op.RequestBody != nil {
+				e.Request = op.RequestBody.Content["application/json"].Schema
+			}
+			for _, code := range []string{"200", "201", "2XX", "default"} {
+				if r, ok := op.Responses[code]; ok {
+					e.Response = r.Content["application/json"].Schema
+					break
+				}
+			}
+			list = append(list, e)
+		}
+	}
+	for i := range list {
+		list[i].Request = doc.name(list[i].Request, list[i].Name+"Request")
+		list[i].Response = doc.name(list[i].Response, list[i].Name+"Response")
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list, nil
+}
+
+// name moves an inline object schema into the components under name, so generated
+// code can refer to it as a type
+func (doc *spec) name(s *schema, name string) *schema {
+	if s == nil || s.Type != "object" || len(s.Properties) == 0 {
+		return s
+	}
+	if doc.Components.Schemas == nil {
+		doc.Components.Schemas = make(map[string]*schema)
+	}
+	doc.Components.Schemas[name] = s
+	return &schema{Ref: "#/components/schemas/" + name, Nullable: s.Nullable}
+}
+
+// schemaNames returns the component schema names in a stable order
+func (doc *spec) schemaNames() []string {
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nameFromRoute names GET /users/{id} GetUsersByID
+func nameFromRoute(method, path string) string {
+	var b strings.Builder
+	b.WriteString(exported(strings.ToLower(method)))
+	for _, segment := range strings.Split(path, "/") {
+		if param, ok := strings.CutPrefix(segment, "{"); ok {
+			b.WriteString("By" + exported(strings.TrimSuffix(param, "}")))
+		} else {
+			b.WriteString(exported(segment))
+		}
+	}
+	return b.String()
+}
+
+// exported turns a name like user_id, user-id or userId into UserID
+func exported(name string) string {
+	var b strings.Builder
+	for _, w := range words(name) {
+		if upper := strings.ToUpper(w); initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+// words splits a name at punctuation and camel case boundaries, keeping runs of
+// capitals like the HTTP in HTTPServer together
+func words(name string) []string {
+	var list []string
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		r := []rune(part)
+		start := 0
+		for i := 1; i < len(r); i++ {
+			lowerToUpper := unicode.IsLower(r[i-1]) && unicode.IsUpper(r[i])
+			endOfCapitals := i+1 < len(r) && unicode.IsUpper(r[i-1]) && unicode.IsUpper(r[i]) && unicode.IsLower(r[i+1])
+			if lowerToUpper || endOfCapitals {
+				list = append(list, string(r[start:i]))
+				start = i
+			}
+		}
+		list = append(list, string(r[start:]))
+	}
+	return list
+}
+
+// unexported turns a name into a Go identifier for a parameter
+func unexported(name string) string {
+	s := exported(name)
+	if s == "" {
+		return "_"
+	}
+	if upper := strings.ToUpper(s); initialisms[upper] {
+		return strings.ToLower(s)
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+var initialisms = map[string]bool{"ID": true, "URL": true, "URI": true, "API": true, "HTTP": true, "JSON": true, "UUID": true, "IP": true}
+
+// refName returns the component name a $ref points to
+func refName(ref string) string {
+	return ref[strings.LastIndexByte(ref, '/')+1:]
+}
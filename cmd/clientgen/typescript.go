@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+func generateTS(doc *spec) ([]byte, error) {
+	endpoints, err := doc.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by clientgen from the OpenAPI document. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "const basePath = %q;\n\n", doc.basePath())
+	b.WriteString(tsRuntime)
+
+	for _, name := range doc.schemaNames() {
+		s := doc.Components.Schemas[name]
+		if s.Type == "object" && len(s.Properties) > 0 {
+			fmt.Fprintf(&b, "export interface %s %s\n\n", exported(name), tsType(s, ""))
+		} else {
+			fmt.Fprintf(&b, "export type %s = %s;\n\n", exported(name), tsType(s, ""))
+		}
+	}
+
+	b.WriteString("export class Client extends BaseClient {\n")
+	for i, e := range endpoints {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeTSMethod(&b, e)
+	}
+	b.WriteString("}\n")
+	return b.Bytes(), nil
+}
+
+func writeTSMethod(b *bytes.Buffer, e endpoint) {
+	var args []string
+	for _, p := range e.Params {
+		args = append(args, unexported(p)+": string")
+	}
+	body := "undefined"
+	if e.Request != nil {
+		args = append(args, "body: "+tsType(e.Request, "  "))
+		body = "body"
+	}
+	args = append(args, "init?: RequestInit")
+
+	path := "`" + e.Path + "`"
+	for _, p := range e.Params {
+		path = strings.Replace(path, "{"+p+"}", "${encodeURIComponent("+unexported(p)+")}", 1)
+	}
+
+	out := "unknown"
+	if e.Response != nil {
+		out = tsType(e.Response, "  ")
+	}
+
+	var doc []string
+	if e.Summary != "" {
+		doc = append(doc, e.Summary)
+	}
+	doc = append(doc, e.Method+" "+e.Path)
+	if e.Deprecated {
+		doc = append(doc, "@deprecated")
+	}
+	fmt.Fprintf(b, "  /** %s */\n", strings.Join(doc, " — "))
+	name := []rune(e.Name)
+	name[0] = []rune(strings.ToLower(string(name[0])))[0]
+	fmt.Fprintf(b, "  %s(%s): Promise<%s> {\n", string(name), strings.Join(args, ", "), out)
+	fmt.Fprintf(b, "    return this.request<%s>(%q, %s, %s, init);\n  }\n", out, e.Method, path, body)
+}
+
+func tsType(s *schema, indent string) string {
+	if s == nil {
+		return "unknown"
+	}
+	var t string
+	switch {
+	case s.Ref != "":
+		t = exported(refName(s.Ref))
+	case s.Type == "string":
+		t = "string"
+	case s.Type == "boolean":
+		t = "boolean"
+	case s.Type == "integer" || s.Type == "number":
+		t = "number"
+	case s.Type == "array":
+		item := tsType(s.Items, indent)
+		if strings.ContainsAny(item, " |") {
+			item = "(" + item + ")"
+		}
+		t = item + "[]"
+	case s.Type == "object" && len(s.Properties) > 0:
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, name := range names {
+			optional := "?"
+			if slices.Contains(s.Required, name) {
+				optional = ""
+			}
+			fmt.Fprintf(&b, "%s  %q%s: %s;\n", indent, name, optional, tsType(s.Properties[name], indent+"  "))
+		}
+		b.WriteString(indent + "}")
+		t = b.String()
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		t = "Record<string, " + tsType(s.AdditionalProperties, indent) + ">"
+	case s.Type == "object":
+		t = "Record<string, unknown>"
+	default:
+		t = "unknown"
+	}
+	if s.Nullable {
+		t += " | null"
+	}
+	return t
+}
+
+// tsRuntime is the hand-written part of every generated TypeScript client
+const tsRuntime = `/** An error response from the API */
+export class ApiError extends Error {
+  constructor(
+    readonly status: number,
+    readonly code: string,
+    message: string,
+    readonly details?: unknown,
+  ) {
+    super(message);
+  }
+}
+
+class BaseClient {
+  constructor(
+    private readonly baseUrl: string,
+    private readonly defaults: RequestInit = {},
+  ) {}
+
+  protected async request<T>(method: string, path: string, body: unknown, init?: RequestInit): Promise<T> {
+    const headers = new Headers(this.defaults.headers);
+    new Headers(init?.headers).forEach((value, name) => headers.set(name, value));
+    headers.set("Accept", "application/json");
+    if (body !== undefined) {
+      headers.set("Content-Type", "application/json");
+    }
+    const res = await fetch(this.baseUrl.replace(/\/+$/, "") + basePath + path, {
+      ...this.defaults,
+      ...init,
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const text = await res.text();
+    const data = text ? JSON.parse(text) : undefined;
+    if (!res.ok) {
+      throw new ApiError(res.status, data?.code ?? "", data?.message ?? res.statusText, data?.details);
+    }
+    return data as T;
+  }
+}
+
+`
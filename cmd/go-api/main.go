@@ -1,25 +1,991 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"go-api/internal/admin"
+	"go-api/internal/alerting"
+	"go-api/internal/apikey"
+	"go-api/internal/apiversion"
+	"go-api/internal/backup"
+	"go-api/internal/config"
+	"go-api/internal/experiment"
+	"go-api/internal/featureflag"
+	"go-api/internal/httpcache"
+	"go-api/internal/jobs"
+	"go-api/internal/ldapauth"
+	"go-api/internal/middleware"
+	"go-api/internal/module"
+	"go-api/internal/oauth"
+	"go-api/internal/operations"
+	"go-api/internal/privacy"
+	"go-api/internal/projections"
+	"go-api/internal/ratelimit"
+	"go-api/internal/realtime"
+	"go-api/internal/saml"
+	"go-api/internal/seed"
+	"go-api/internal/slo"
+	"go-api/internal/static"
+	"go-api/internal/status"
+	"go-api/internal/tenancy"
+	"go-api/internal/users"
+	"go-api/internal/view"
+	"go-api/pkg/analytics"
+	"go-api/pkg/archive"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	"go-api/pkg/cache"
+	"go-api/pkg/canary"
+	"go-api/pkg/cdc"
+	"go-api/pkg/clamav"
+	"go-api/pkg/cost"
+	"go-api/pkg/crypto"
+	"go-api/pkg/database"
+	"go-api/pkg/datetime"
+	"go-api/pkg/discovery"
+	"go-api/pkg/editlock"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/hooks"
+	"go-api/pkg/id"
+	"go-api/pkg/jwks"
+	"go-api/pkg/latency"
+	"go-api/pkg/limits"
+	"go-api/pkg/logger"
+	"go-api/pkg/mail"
+	"go-api/pkg/matview"
+	"go-api/pkg/metrics"
+	"go-api/pkg/mongodb"
+	"go-api/pkg/outbox"
+	"go-api/pkg/presence"
+	"go-api/pkg/profiling"
+	"go-api/pkg/projection"
+	"go-api/pkg/queue"
+	"go-api/pkg/retention"
+	"go-api/pkg/retrysafe"
+	"go-api/pkg/rewrite"
+	"go-api/pkg/routing"
+	"go-api/pkg/saga"
+	"go-api/pkg/server"
+	"go-api/pkg/signedurl"
+	"go-api/pkg/storage"
+	"go-api/pkg/tenant"
+	"go-api/pkg/validate"
+	"go-api/pkg/watchdog"
+	"go-api/web"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
 func main() {
-	r := gin.Default()
+	cfg := config.Load()
 
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Welcome to Go-API!",
+	if err := logger.Init(cfg.Logger); err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+	limits.Apply(cfg.Limits)
+
+	if slices.Contains(os.Args[1:], "--mock") {
+		runMock(cfg)
+		return
+	}
+
+	var db *sql.DB
+	if cfg.Database.DSN != "" {
+		var err error
+		if db, err = database.Open(cfg.Database); err != nil {
+			logger.Fatal("failed to connect to database", zap.Error(err))
+		}
+		defer db.Close()
+	}
+
+	mongoClient, err := mongodb.Connect(cfg.MongoDB)
+	if err != nil {
+		logger.Fatal("failed to connect to mongodb", zap.Error(err))
+	}
+	if mongoClient != nil {
+		defer mongoClient.Close(context.Background())
+	}
+
+	var redisClient *redis.Client
+	if cfg.Redis.Addr != "" {
+		var err error
+		if redisClient, err = cache.NewRedisClient(cfg.Redis); err != nil {
+			logger.Fatal("failed to connect to redis", zap.Error(err))
+		}
+		defer redisClient.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := authz.Init(ctx, cfg.Authz); err != nil {
+		logger.Fatal("failed to load authorization policies", zap.Error(err))
+	}
+
+	if err := id.Init(cfg.IDs); err != nil {
+		logger.Fatal("failed to set up public id codec", zap.Error(err))
+	}
+
+	envelope, err := crypto.New(cfg.Encryption)
+	if err != nil {
+		logger.Fatal("failed to set up field encryption", zap.Error(err))
+	}
+	if envelope == nil {
+		logger.Warn("no encryption keys configured, sensitive columns are stored as plaintext")
+	}
+
+	signingKeys, err := jwks.NewManager(ctx, newSigningKeyStore(db), cfg.JWT)
+	if err != nil {
+		logger.Fatal("failed to load signing keys", zap.Error(err))
+	}
+	go signingKeys.Run(ctx)
+
+	appCache := newCache(ctx, cfg.Cache, redisClient)
+	// The response cache scopes its own keys, to purge surrogate keys across tenants
+	responseCache := newResponseCache(ctx, cfg.Cache, appCache, redisClient)
+	tenantCache := cache.NewTenantCache(appCache)
+
+	rateLimitStore := newRateLimitStore(db)
+	rateLimitResolver := ratelimit.NewResolver(rateLimitStore, cfg.RateLimit.OverrideCacheTTL)
+
+	templates, err := fs.Sub(web.Templates, "templates")
+	if err != nil {
+		logger.Fatal("failed to load embedded templates", zap.Error(err))
+	}
+
+	jobQueue := queue.New(cfg.Queue)
+	jobQueue.SetCarrier(tenant.Carrier{})
+	prometheus.MustRegister(jobQueue)
+	jobHandler := jobs.NewHandler(jobQueue)
+
+	sagaStore := newSagaStore(db)
+	sagas := saga.NewOrchestrator(sagaStore, jobQueue, "default")
+
+	apiKeyStore := newAPIKeyStore(db)
+	middleware.ConfigureRateLimit(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst, rateLimitResolver,
+		func(ctx context.Context, token string) (ratelimit.Identity, error) {
+			k, err := apikey.Lookup(ctx, apiKeyStore, token)
+			return ratelimit.Identity{APIKey: k.ID, Tenant: k.Tenant, Plan: k.Plan}, err
 		})
+	oauthStore := newOAuthStore(db)
+	userStore := newUserStore(db)
+	ldapStore := newLDAPStore(db, envelope)
+
+	// Tenants can only be isolated from a shared database
+	var tenants *tenancy.Router
+	if db != nil {
+		tenants = tenancy.NewRouter(cfg.Tenancy, db, cfg.Database, newTenantStore(db, envelope))
+		defer tenants.Close()
+		jobQueue.SetCarrier(tenants)
+	}
+
+	timezones, err := datetime.NewResolver(cfg.Datetime, func(ctx context.Context, userID string) (string, error) {
+		u, err := userStore.Get(ctx, userID)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return "", nil
+		}
+		return u.Timezone, err
 	})
+	if err != nil {
+		logger.Fatal("invalid time zone configuration", zap.Error(err))
+	}
+
+	exportArchives, err := privacy.NewFileArchives(cfg.Privacy.ExportDir, cfg.Privacy.ExportTTL)
+	if err != nil {
+		logger.Fatal("failed to create export directory", zap.Error(err))
+	}
+	privacyService := privacy.NewService(cfg.Privacy, newPrivacyStore(db), exportArchives, jobQueue, "default")
+	privacyService.Register(users.NewPersonalData(userStore))
+	phoneStore := newPhoneStore(db)
+	privacyService.Register(users.NewPhonePersonalData(phoneStore))
+	phoneVerifier := users.NewPhoneVerifier(cfg.Users.Phone, phoneStore, users.NewTwilioSender(cfg.Users.Phone))
+
+	operationStore := newOperationStore(db)
+	operationsManager := operations.NewManager(operationStore, jobQueue, "default")
+
+	purger := retention.NewPurger(cfg.Retention)
+	purger.RegisterFrom(apiKeyStore, oauthStore, sagaStore, exportArchives, operationStore)
+
+	eventStore, projectionSource := newEventSources(cfg.Events, db)
+	eventSchemas, err := eventschema.NewRegistry(cfg.Events.Schemas)
+	if err != nil {
+		logger.Fatal("invalid event schemas", zap.Error(err))
+	}
+	eventStore = eventSchemas.Store(eventStore)
+	projectionRunner := projection.NewRunner(cfg.Projection, projectionSource, newCheckpointStore(db))
+
+	files, err := storage.New(cfg.Storage)
+	if err != nil {
+		logger.Fatal("failed to create storage", zap.Error(err))
+	}
+	signedURLs, err := signedurl.New(cfg.SignedURLs)
+	if err != nil {
+		logger.Fatal("invalid signed URL keys", zap.Error(err))
+	}
+	deps := module.Deps{DB: db, Cache: tenantCache, Queue: jobQueue, Events: eventStore, Storage: files, Antivirus: clamav.New(cfg.ClamAV),
+		Mailer: mail.New(cfg.Mail), Links: signedURLs, Mongo: mongoClient}
+	modules, err := module.Load(ctx, deps, projectionRunner, features(cfg)...)
+	if err != nil {
+		logger.Fatal("failed to load modules", zap.Error(err))
+	}
+	purger.RegisterFrom(modules)
+	privacyService.Register(modules.PersonalDataProviders()...)
+	if err := eventSchemas.RegisterFrom(modules); err != nil {
+		logger.Fatal("invalid event schemas", zap.Error(err))
+	}
+	var realtimeHub *realtime.Hub
+	if cfg.Realtime.Enabled {
+		realtimeHub = realtime.NewHub(cfg.Realtime, eventStore, signingKeys)
+		realtimeHub.RegisterFrom(modules)
+		if cfg.Presence.Enabled {
+			tracker := presence.NewTracker(cfg.Presence, newPresenceStore(redisClient, cfg.Presence.TTL), eventStore)
+			if err := eventSchemas.RegisterFrom(tracker); err != nil {
+				logger.Fatal("invalid event schemas", zap.Error(err))
+			}
+			tracker.Start(ctx)
+			realtimeHub.TrackPresence(tracker)
+		}
+		if cfg.EditLocks.Enabled {
+			locks := editlock.NewManager(cfg.EditLocks, newEditLockStore(redisClient), eventStore)
+			if err := eventSchemas.RegisterFrom(locks); err != nil {
+				logger.Fatal("invalid event schemas", zap.Error(err))
+			}
+			locks.Start(ctx)
+			realtimeHub.TrackLocks(locks)
+		}
+		if err := realtimeHub.Start(ctx); err != nil {
+			logger.Fatal("failed to start realtime hub", zap.Error(err))
+		}
+	}
+	if db != nil {
+		if cfg.Schema.Migrate {
+			if err := modules.Migrate(ctx, db); err != nil {
+				logger.Fatal("failed to migrate database", zap.Error(err))
+			}
+		}
+		checkSchema(ctx, cfg.Schema, modules, db)
+	}
+
+	// Materialized views are Postgres only
+	var views *matview.Refresher
+	if db != nil && database.Dialect(db) == database.Postgres {
+		views = matview.NewRefresher(cfg.MatViews, db)
+		if err := views.EnsureSchema(ctx); err != nil {
+			logger.Fatal("failed to create materialized view schema", zap.Error(err))
+		}
+		if err := views.RegisterFrom(modules); err != nil {
+			logger.Fatal("invalid materialized views", zap.Error(err))
+		}
+		projectionRunner.Register(views.Projection())
+	} else if len(modules.MaterializedViews()) > 0 {
+		logger.Warn("materialized views need a Postgres database, they won't be refreshed")
+	}
+
+	var changes *cdc.Consumer
+	if cfg.CDC.Enabled {
+		if db == nil || database.Dialect(db) != database.Postgres {
+			logger.Fatal("change data capture needs a Postgres database")
+		}
+		if changes, err = cdc.NewConsumer(cfg.CDC, db); err != nil {
+			logger.Fatal("invalid change data capture configuration", zap.Error(err))
+		}
+		changes.RegisterFrom(modules)
+		for _, table := range cfg.CDC.Tables {
+			changes.Register(responseCache.PurgeOnChange(table))
+		}
+	}
+
+	// "go-api seed [set] [--wipe]" loads fixture data and exits
+	if args := os.Args[1:]; len(args) > 0 && args[0] == "seed" {
+		runSeed(ctx, db, seed.NewSeeder(userStore, apiKeyStore), args[1:])
+		return
+	}
+
+	// "go-api projections rebuild <name>" replays a projection and exits
+	if args := os.Args[1:]; len(args) == 3 && args[0] == "projections" && args[1] == "rebuild" {
+		if err := projectionRunner.Rebuild(ctx, args[2]); err != nil {
+			logger.Fatal("projection rebuild failed", zap.String("projection", args[2]), zap.Error(err))
+		}
+		logger.Info("projection rebuilt", zap.String("projection", args[2]))
+		return
+	}
 
-	r.GET("/health", func(c *gin.Context) {
+	// "go-api encryption reencrypt" moves encrypted columns to the primary key, binding
+	// values of v1 to their rows, and exits
+	if args := os.Args[1:]; len(args) == 2 && args[0] == "encryption" && args[1] == "reencrypt" {
+		if store, ok := ldapStore.(*ldapauth.SQLStore); ok {
+			n, err := store.Reencrypt(ctx)
+			if err != nil {
+				logger.Fatal("re-encryption failed", zap.String("table", "ldap_directories"), zap.Error(err))
+			}
+			logger.Info("re-encrypted records", zap.String("table", "ldap_directories"), zap.Int("count", n))
+		}
+		return
+	}
+	go projectionRunner.Run(ctx)
+	projectionHandler := projections.NewHandler(projectionRunner, eventStore, operationsManager)
+
+	var tenantHandler *tenancy.Handler
+	if tenants != nil {
+		provisioner := tenancy.NewProvisioner(tenants, modules, operationsManager)
+		if cfg.Tenancy.MigrateOnStart {
+			if _, err := provisioner.MigrateAll(ctx, nil); err != nil {
+				logger.Fatal("failed to migrate tenants", zap.Error(err))
+			}
+		}
+		tenantHandler = tenancy.NewHandler(provisioner)
+	}
+	var backupHandler *backup.Handler
+	var archiver *archive.Archiver
+	if db != nil {
+		backupHandler = backup.NewHandler(backup.NewService(cfg.Backup, db, cfg.Database.DSN, files, operationsManager))
+		if archiver, err = archive.NewArchiver(cfg.Archive, db, files); err != nil {
+			logger.Fatal("invalid archive policies", zap.Error(err))
+		}
+		if err := archiver.EnsureSchema(ctx); err != nil {
+			logger.Fatal("failed to create archive schema", zap.Error(err))
+		}
+		if err := archiver.RegisterFrom(modules); err != nil {
+			logger.Fatal("invalid archive policies", zap.Error(err))
+		}
+	}
+
+	jobQueue.Start(ctx)
+	purger.Start(ctx)
+	if archiver != nil {
+		archiver.Start(ctx)
+	}
+	if views != nil {
+		views.Start(ctx)
+	}
+	if changes != nil {
+		changes.Start(ctx)
+	}
+	modules.Start(ctx)
+	sagas.RegisterFrom(modules)
+	if err := sagas.Resume(ctx); err != nil {
+		logger.Fatal("failed to resume sagas", zap.Error(err))
+	}
+
+	recorder := admin.NewRecorder(cfg.Admin.RecentRequests)
+	maintenance := &admin.Maintenance{}
+
+	userTokens := users.NewTokenIssuer(signingKeys, cfg.Users)
+
+	samlService, err := saml.NewService(cfg.SAML, newSAMLStore(db), userStore, userTokens)
+	if err != nil {
+		logger.Fatal("failed to set up SAML", zap.Error(err))
+	}
+
+	var globalDirectory *ldapauth.Directory
+	if cfg.LDAP.URL != "" {
+		globalDirectory = &cfg.LDAP
+	}
+	ldapAuth := ldapauth.NewAuthenticator(globalDirectory, ldapStore, userStore)
+	defer ldapAuth.Close()
+	ldapHandler := ldapauth.NewHandler(ldapAuth, userTokens)
+
+	flagDefaults := make(map[string]bool)
+	for _, name := range cfg.Admin.FeatureFlags {
+		flagDefaults[name] = true
+	}
+	flags := featureflag.NewStore(flagDefaults)
+	experiments, err := experiment.NewRegistry(cfg.Experiment)
+	if err != nil {
+		logger.Fatal("invalid experiments", zap.Error(err))
+	}
+
+	alerter := alerting.New(cfg.Alerting)
+	sloTracker, err := slo.New(cfg.SLO)
+	if err != nil {
+		logger.Fatal("invalid service level objectives", zap.Error(err))
+	}
+	prometheus.MustRegister(sloTracker)
+	var statusMonitor *status.Monitor
+	if cfg.Status.Enabled {
+		checks := modules.HealthChecks()
+		if db != nil {
+			checks = append([]module.HealthCheck{{Name: "database", Check: db.PingContext}}, checks...)
+		}
+		statusMonitor, err = status.NewMonitor(cfg.Status, newStatusStore(db), checks)
+		if err != nil {
+			logger.Fatal("invalid status page configuration", zap.Error(err))
+		}
+		statusMonitor.Start(ctx)
+	}
+	runtimeWatchdog := watchdog.New(cfg.Watchdog)
+	go runtimeWatchdog.Run(ctx)
+	loadShedder := middleware.NewLoadShedder(cfg.LoadShed)
+	profiler := profiling.New(cfg.Profiling, loadShedder.InFlight)
+	if profiler != nil {
+		go profiler.Run(ctx)
+	}
+	metricsPusher, err := metrics.New(cfg.Metrics, prometheus.DefaultGatherer)
+	if err != nil {
+		logger.Fatal("failed to set up metrics export", zap.Error(err))
+	}
+	if metricsPusher != nil {
+		go metricsPusher.Run(ctx)
+	}
+	analyticsPipeline, err := analytics.New(cfg.Analytics)
+	if err != nil {
+		logger.Fatal("failed to set up the analytics sink", zap.Error(err))
+	}
+	var analyticsRecorders []analytics.Recorder
+	var analyticsRing *analytics.Ring
+	var analyticsSink analytics.Querier
+	if cfg.Analytics.RingSize > 0 {
+		analyticsRing = analytics.NewRing(cfg.Analytics.RingSize)
+		analyticsRecorders = append(analyticsRecorders, analyticsRing)
+	}
+	if analyticsPipeline != nil {
+		go analyticsPipeline.Run(ctx)
+		analyticsRecorders = append(analyticsRecorders, analyticsPipeline)
+		analyticsSink = analyticsPipeline.Querier()
+	}
+
+	// Outbound clients use the default transport, so installing the resolver there lets
+	// any of them address services by name
+	registry, err := discovery.New(cfg.Discovery)
+	if err != nil {
+		logger.Fatal("invalid service discovery configuration", zap.Error(err))
+	}
+	if registry != nil {
+		http.DefaultTransport = discovery.Transport(registry, cfg.Discovery.Suffix, cfg.Discovery.CacheTTL, http.DefaultTransport)
+	}
+
+	captcha, err := middleware.NewCaptcha(cfg.Captcha)
+	if err != nil {
+		logger.Fatal("invalid CAPTCHA configuration", zap.Error(err))
+	}
+
+	policies, err := middleware.NewPolicies(cfg.Policies, cfg.AdminToken, responseCache)
+	if err != nil {
+		logger.Fatal("invalid route policies", zap.Error(err))
+	}
+
+	r := gin.New()
+	routing.Configure(r, cfg.Routing)
+	bind.Configure(cfg.Bind)
+	if err := validate.Init(cfg.Validation); err != nil {
+		logger.Fatal("failed to register validation rules", zap.Error(err))
+	}
+	latency.Configure(cfg.Latency)
+	retrysafe.Configure(cfg.Retries)
+	cost.Configure(cfg.Cost)
+	canary.Configure(cfg.Canary)
+	r.HTMLRender = view.New(cfg.View, templates)
+	r.Use(gin.Recovery())
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(middleware.GinZap())
+	r.Use(recorder.Middleware())
+	r.Use(alerter.Middleware())
+	r.Use(sloTracker.Middleware())
+	if len(analyticsRecorders) > 0 {
+		// Reads the subject after the request, once the auth middleware below has set it
+		r.Use(analytics.Middleware(cfg.Analytics.ExcludePaths, analyticsRecorders...))
+	}
+	if profiler != nil || cfg.Profiling.PprofRoutes {
+		r.Use(profiling.Labels())
+	}
+	r.Use(middleware.LoadShedMiddleware(loadShedder))
+	r.Use(middleware.ErrorHandler())
+	r.Use(retrysafe.Middleware())
+	r.Use(cost.Middleware(newCostCounter(redisClient), func(ctx context.Context, token string) (cost.Subject, error) {
+		k, err := apikey.Lookup(ctx, apiKeyStore, token)
+		return cost.Subject{ID: k.ID, Plan: k.Plan}, err
+	}))
+	if captcha != nil {
+		r.Use(captcha.Middleware())
+	}
+	r.Use(middleware.JWTAuth(signingKeys))
+	r.Use(authz.SubjectFromJWT())
+	r.Use(middleware.RequestDeadline(cfg.Deadline))
+	r.Use(signedURLs.Middleware())
+	r.Use(tenant.Middleware())
+	if tenants != nil {
+		r.Use(tenants.Middleware())
+	}
+	r.Use(middleware.NewBotDetector(cfg.Bots, captcha).Middleware())
+	r.Use(timezones.Middleware())
+	r.Use(experiments.Middleware())
+	r.Use(policies.Middleware())
+	r.Use(hooks.Middleware())
+	r.Use(middleware.NewDeduplicator(cfg.Dedup, tenantCache).Middleware())
+	r.Use(maintenance.Middleware("/admin", "/health", "/status"))
+
+	r.GET("/", responseCache.Middleware(cfg.Cache.TTL), func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
+			"message": "Welcome to Go-API!",
 		})
 	})
 
-	r.Run(":8080") // Listen on port 8080
+	r.GET("/health", latency.Budget(50*time.Millisecond), modules.HealthHandler())
+	if statusMonitor != nil {
+		status.NewHandler(statusMonitor).RegisterRoutes(r)
+	}
+
+	// Pushing backends export the same registry, so it's only scraped otherwise
+	if metricsPusher == nil {
+		r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+
+	keyHandler := jwks.NewHandler(signingKeys)
+	keyHandler.RegisterRoutes(r)
+	oauth.NewServer(oauthStore, signingKeys, cfg.OAuth).RegisterRoutes(r.Group("/oauth"))
+	samlService.RegisterRoutes(r.Group("/saml"))
+	ldapHandler.RegisterRoutes(r.Group("/auth"))
+	privacy.NewHandler(privacyService, signedURLs).RegisterRoutes(&r.RouterGroup)
+	eventSchemaHandler := eventschema.NewHandler(eventSchemas)
+	eventSchemaHandler.RegisterRoutes(&r.RouterGroup)
+	users.NewProfileHandler(userStore, phoneVerifier).RegisterRoutes(&r.RouterGroup)
+	operationHandler := operations.NewHandler(operationsManager)
+	operationHandler.RegisterRoutes(&r.RouterGroup)
+
+	// Versioned resource handlers register on the group returned for their version
+	apiVersions := apiversion.New(r, cfg.API)
+	apiUsage := newAPIUsageStore(db)
+	apiTracker := apiversion.NewTracker(cfg.API, apiUsage, func(ctx context.Context, token string) (string, error) {
+		k, err := apikey.Lookup(ctx, apiKeyStore, token)
+		return k.ID, err
+	})
+	apiVersions.Track(apiTracker)
+	apiTracker.Start(ctx)
+	v1 := apiVersions.Version(apiversion.Version{Name: "v1"})
+	modules.Routes(v1)
+	if realtimeHub != nil {
+		realtimeHub.Routes(v1)
+	}
+	apiVersions.Publish(apiversion.EventChannels(eventSchemas), modules)
+
+	// "go-api openapi <version> <file>" writes the OpenAPI document clients are
+	// generated from and exits
+	if args := os.Args[1:]; len(args) == 3 && args[0] == "openapi" {
+		doc, err := apiVersions.Document(args[1])
+		if err == nil {
+			err = os.WriteFile(args[2], append(doc, '\n'), 0o644)
+		}
+		if err != nil {
+			logger.Fatal("failed to write OpenAPI document", zap.Error(err))
+		}
+		return
+	}
+
+	// "go-api asyncapi <version> <file>" writes the AsyncAPI document of the streams,
+	// events and webhooks consumers are generated from and exits
+	if args := os.Args[1:]; len(args) == 3 && args[0] == "asyncapi" {
+		doc, err := apiVersions.AsyncDocument(args[1])
+		if err == nil {
+			err = os.WriteFile(args[2], append(doc, '\n'), 0o644)
+		}
+		if err != nil {
+			logger.Fatal("failed to write AsyncAPI document", zap.Error(err))
+		}
+		return
+	}
+
+	runtimeWatchdog.RegisterRoutes(r.Group("", middleware.AdminAuth(cfg.AdminToken)))
+
+	adminGroup := r.Group("/admin", middleware.AdminAuth(cfg.AdminToken))
+	ratelimit.NewHandler(rateLimitStore, rateLimitResolver).RegisterRoutes(adminGroup)
+	httpcache.NewHandler(responseCache).RegisterRoutes(adminGroup)
+	view.NewPreviewHandler().RegisterRoutes(adminGroup)
+	featureflag.NewHandler(flags).RegisterRoutes(adminGroup)
+	experiment.NewHandler(experiments).RegisterRoutes(adminGroup)
+	alerting.NewHandler(alerter).RegisterRoutes(adminGroup)
+	slo.NewHandler(sloTracker).RegisterRoutes(adminGroup)
+	if analyticsRing != nil || analyticsSink != nil {
+		analytics.NewHandler(analyticsRing, analyticsSink).RegisterRoutes(adminGroup)
+	}
+	if cfg.Profiling.PprofRoutes {
+		profiling.RegisterRoutes(adminGroup)
+	}
+	apikey.NewHandler(apiKeyStore).RegisterRoutes(adminGroup)
+	apiversion.NewHandler(apiVersions, apiUsage).RegisterRoutes(adminGroup)
+	oauth.NewHandler(oauthStore).RegisterRoutes(adminGroup)
+	keyHandler.RegisterAdminRoutes(adminGroup)
+	samlService.RegisterAdminRoutes(adminGroup)
+	ldapHandler.RegisterAdminRoutes(adminGroup)
+	if tenantHandler != nil {
+		tenantHandler.RegisterRoutes(adminGroup)
+	}
+	if backupHandler != nil {
+		backupHandler.RegisterRoutes(adminGroup)
+	}
+	users.NewHandler(userStore).RegisterRoutes(adminGroup)
+	retention.NewHandler(purger).RegisterRoutes(adminGroup)
+	if archiver != nil {
+		archive.NewHandler(archiver).RegisterRoutes(adminGroup)
+	}
+	if views != nil {
+		matview.NewHandler(views).RegisterRoutes(adminGroup)
+	}
+	privacy.NewHandler(privacyService, nil, users.Expander(userStore, "/admin/users/{id}")).RegisterAdminRoutes(adminGroup)
+	jobHandler.RegisterRoutes(adminGroup)
+	operationHandler.RegisterAdminRoutes(adminGroup)
+	projectionHandler.RegisterRoutes(adminGroup)
+	eventSchemaHandler.RegisterAdminRoutes(adminGroup)
+	admin.NewHandler(recorder, maintenance, flags, apiKeyStore, jobHandler).RegisterRoutes(adminGroup)
+	modules.AdminRoutes(adminGroup)
+
+	if cfg.Static.Enabled {
+		dist, err := fs.Sub(web.Dist, "dist")
+		if err != nil {
+			logger.Fatal("failed to load embedded frontend", zap.Error(err))
+		}
+		r.NoRoute(static.New(cfg.Static, dist).Handler())
+	}
+
+	// Rate limiting wraps the whole router so it also covers unmatched routes and
+	// requests proxied to canary upstreams, and rewrite rules wrap that so limits see
+	// the rewritten request
+	canaries, err := canary.Handler(cfg.Canary, routing.Canonicalize(cfg.Routing, apiVersions.Negotiate(r)))
+	if err != nil {
+		logger.Fatal("invalid canary rollouts", zap.Error(err))
+	}
+	handler, err := rewrite.Handler(cfg.Rewrite, middleware.RateLimitMiddleware(canaries))
+	if err != nil {
+		logger.Fatal("invalid rewrite rules", zap.Error(err))
+	}
+	retrysafe.Audit(r.Routes())
+	srv, err := server.New(cfg.Server, handler)
+	if err != nil {
+		logger.Fatal("invalid server configuration", zap.Error(err))
+	}
+	serveCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := hooks.Startup(ctx); err != nil {
+		logger.Fatal("failed to start", zap.Error(err))
+	}
+	// Deregistering as soon as shutdown starts takes the instance out of rotation
+	// before its listeners close, rather than after it has drained
+	deregistered := make(chan struct{})
+	if registry != nil {
+		if err := registry.Register(ctx, cfg.Discovery.Service); err != nil {
+			logger.Error("failed to register with service discovery", zap.Error(err))
+		}
+		go func() {
+			defer close(deregistered)
+			<-serveCtx.Done()
+			deregisterCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := registry.Deregister(deregisterCtx, cfg.Discovery.Service); err != nil {
+				logger.Error("failed to deregister from service discovery", zap.Error(err))
+			}
+		}()
+	} else {
+		close(deregistered)
+	}
+	err = srv.Run(serveCtx)
+	stop()
+	<-deregistered
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	hooks.Shutdown(shutdownCtx)
+	cancel()
+	if err != nil {
+		logger.Fatal("server stopped", zap.Error(err))
+	}
+}
+
+// newRateLimitStore uses the database for overrides when one is configured
+func newRateLimitStore(db *sql.DB) ratelimit.Store {
+	if db == nil {
+		return ratelimit.NewMemoryStore()
+	}
+
+	store := ratelimit.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create rate limit schema", zap.Error(err))
+	}
+	return store
+}
+
+// newCache returns the shared cache: Redis fronted by a local LRU tier when Redis is
+// configured, otherwise a process-local cache
+func newCache(ctx context.Context, cfg config.CacheConfig, client *redis.Client) cache.Cache {
+	if client == nil {
+		return cache.NewMemoryCache()
+	}
+
+	remote := cache.NewRedisCache(client, cfg.KeyPrefix)
+	if cfg.LocalSize <= 0 {
+		return remote
+	}
+	return cache.NewTieredCache(ctx, cache.NewLRUCache(cfg.LocalSize), remote,
+		cache.NewRedisInvalidator(client, cfg.LocalInvalidationChannel), cfg.LocalTTL)
+}
+
+// newAPIKeyStore uses the database for API keys when one is configured
+func newAPIKeyStore(db *sql.DB) apikey.Store {
+	if db == nil {
+		return apikey.NewMemoryStore()
+	}
+
+	store := apikey.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create api key schema", zap.Error(err))
+	}
+	return store
+}
+
+// newAPIUsageStore keeps the usage of API clients in the database when one is configured
+func newAPIUsageStore(db *sql.DB) apiversion.UsageStore {
+	if db == nil {
+		return apiversion.NewMemoryUsageStore()
+	}
+
+	store := apiversion.NewSQLUsageStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create api usage schema", zap.Error(err))
+	}
+	return store
+}
+
+// newStatusStore keeps the status page history in the database when one is configured
+func newStatusStore(db *sql.DB) status.Store {
+	if db == nil {
+		return status.NewMemoryStore()
+	}
+
+	store := status.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create status schema", zap.Error(err))
+	}
+	return store
+}
+
+// newOAuthStore persists OAuth clients and tokens in the database when one is configured
+func newOAuthStore(db *sql.DB) oauth.Store {
+	if db == nil {
+		return oauth.NewMemoryStore()
+	}
+
+	store := oauth.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create oauth schema", zap.Error(err))
+	}
+	return store
+}
+
+// newSigningKeyStore shares JWT signing keys through the database when one is configured
+func newSigningKeyStore(db *sql.DB) jwks.Store {
+	if db == nil {
+		return jwks.NewMemoryStore()
+	}
+
+	store := jwks.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create signing key schema", zap.Error(err))
+	}
+	return store
+}
+
+// newUserStore keeps users in the database when one is configured
+func newUserStore(db *sql.DB) users.Store {
+	if db == nil {
+		return users.NewMemoryStore()
+	}
+
+	store := users.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create user schema", zap.Error(err))
+	}
+	return store
+}
+
+// newPhoneStore keeps verified phone numbers in the database when one is configured
+func newPhoneStore(db *sql.DB) users.PhoneStore {
+	if db == nil {
+		return users.NewMemoryPhoneStore()
+	}
+
+	store := users.NewSQLPhoneStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create phone number schema", zap.Error(err))
+	}
+	return store
+}
+
+// newSAMLStore keeps tenant IdP configuration in the database when one is configured
+func newSAMLStore(db *sql.DB) saml.Store {
+	if db == nil {
+		return saml.NewMemoryStore()
+	}
+
+	store := saml.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create saml schema", zap.Error(err))
+	}
+	return store
+}
+
+// newLDAPStore keeps per-tenant directories in the database when one is configured
+func newLDAPStore(db *sql.DB, envelope *crypto.Envelope) ldapauth.Store {
+	if db == nil {
+		return ldapauth.NewMemoryStore()
+	}
+
+	store := ldapauth.NewSQLStore(db, envelope)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create ldap schema", zap.Error(err))
+	}
+	return store
+}
+
+// checkSchema compares the database with the modules' migrations, so a migration
+// that wasn't run is caught before requests hit queries it breaks
+func checkSchema(ctx context.Context, cfg config.SchemaConfig, modules *module.Set, db *sql.DB) {
+	switch cfg.Drift {
+	case module.DriftOff:
+		return
+	case module.DriftWarn, module.DriftFail:
+	default:
+		logger.Fatal("invalid SCHEMA_DRIFT, want off, warn or fail", zap.String("drift", cfg.Drift))
+	}
+	drift, err := modules.CheckSchema(ctx, db)
+	if err != nil && cfg.Drift == module.DriftFail {
+		logger.Fatal("failed to check database schema", zap.Error(err))
+	} else if err != nil {
+		logger.Warn("failed to check database schema", zap.Error(err))
+		return
+	}
+	if drift.Empty() {
+		return
+	}
+	if cfg.Drift == module.DriftFail {
+		logger.Fatal("database schema drifted from migrations, refusing to start", zap.Any("drift", drift))
+	}
+	logger.Warn("database schema drifted from migrations", zap.Any("drift", drift))
+}
+
+// newTenantStore keeps tenants in the shared database
+func newTenantStore(db *sql.DB, envelope *crypto.Envelope) tenancy.Store {
+	store := tenancy.NewSQLStore(db, envelope)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create tenants schema", zap.Error(err))
+	}
+	return store
+}
+
+// newPrivacyStore keeps the export and erasure audit trail in the database when one is configured
+func newPrivacyStore(db *sql.DB) privacy.Store {
+	if db == nil {
+		return privacy.NewMemoryStore()
+	}
+
+	store := privacy.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create privacy schema", zap.Error(err))
+	}
+	return store
+}
+
+// newOperationStore keeps long-running operations in the database when one is configured
+func newOperationStore(db *sql.DB) operations.Store {
+	if db == nil {
+		return operations.NewMemoryStore()
+	}
+
+	store := operations.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create operations schema", zap.Error(err))
+	}
+	return store
+}
+
+// newSagaStore persists saga progress in the database when one is configured
+func newSagaStore(db *sql.DB) saga.Store {
+	if db == nil {
+		return saga.NewMemoryStore()
+	}
+
+	store := saga.NewSQLStore(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create saga schema", zap.Error(err))
+	}
+	return store
+}
+
+// newEventSources returns the event store and the log projections read from.
+// The SQL event store is only used when enabled, since most modules don't need it.
+func newEventSources(cfg config.EventsConfig, db *sql.DB) (eventstore.Store, projection.Source) {
+	var store eventstore.Store = eventstore.NewMemoryStore()
+	if db != nil && cfg.StoreEnabled {
+		sqlStore := eventstore.NewSQLStore(db)
+		if err := sqlStore.EnsureSchema(context.Background()); err != nil {
+			logger.Fatal("failed to create event store schema", zap.Error(err))
+		}
+		store = sqlStore
+	}
+
+	if db == nil || cfg.ProjectionSource != "outbox" {
+		return store, store
+	}
+
+	box := outbox.New(db)
+	if err := box.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create outbox schema", zap.Error(err))
+	}
+	return store, box
+}
+
+// newCostCounter shares request cost budgets through Redis when it is configured
+func newCostCounter(client *redis.Client) cost.Counter {
+	if client == nil {
+		return cost.NewMemoryCounter()
+	}
+	return cost.NewRedisCounter(client)
+}
+
+// newPresenceStore shares presence through Redis when it's configured
+func newPresenceStore(client *redis.Client, ttl time.Duration) presence.Store {
+	if client == nil {
+		return presence.NewMemoryStore()
+	}
+	return presence.NewRedisStore(client, ttl)
+}
+
+// newEditLockStore shares editing locks through Redis when it's configured
+func newEditLockStore(client *redis.Client) editlock.Store {
+	if client == nil {
+		return editlock.NewMemoryStore()
+	}
+	return editlock.NewRedisStore(client, time.Hour)
+}
+
+// newCheckpointStore persists projection checkpoints in the database when one is configured
+func newCheckpointStore(db *sql.DB) projection.CheckpointStore {
+	if db == nil {
+		return projection.NewMemoryCheckpoints()
+	}
+
+	store := projection.NewSQLCheckpoints(db)
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("failed to create projection checkpoint schema", zap.Error(err))
+	}
+	return store
+}
+
+// newResponseCache shares cached responses and purges through Redis when it is configured
+func newResponseCache(ctx context.Context, cfg config.CacheConfig, c cache.Cache, client *redis.Client) *httpcache.ResponseCache {
+	if client == nil {
+		return httpcache.New(ctx, c, cache.NoopInvalidator{})
+	}
+	return httpcache.New(ctx, c, cache.NewRedisInvalidator(client, cfg.PurgeChannel))
 }
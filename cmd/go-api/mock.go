@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go-api/internal/config"
+	"go-api/pkg/logger"
+	"go-api/pkg/mock"
+	"go-api/pkg/server"
+
+	"go.uber.org/zap"
+)
+
+// runMock serves example responses from the OpenAPI document instead of the API,
+// so frontends can be built before the handlers exist. It needs no database.
+func runMock(cfg config.Config) {
+	handler, err := mock.New(cfg.Mock)
+	if err != nil {
+		logger.Fatal("failed to load mock OpenAPI document", zap.Error(err))
+	}
+	srv, err := server.New(cfg.Server, handler)
+	if err != nil {
+		logger.Fatal("invalid server configuration", zap.Error(err))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger.Info("serving mock responses", zap.String("spec", cfg.Mock.Spec))
+	if err := srv.Run(ctx); err != nil {
+		logger.Fatal("server stopped", zap.Error(err))
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"go-api/internal/activity"
+	"go-api/internal/addresses"
+	"go-api/internal/announcements"
+	"go-api/internal/attachments"
+	"go-api/internal/comments"
+	"go-api/internal/config"
+	"go-api/internal/consent"
+	"go-api/internal/documents"
+	"go-api/internal/images"
+	"go-api/internal/locations"
+	"go-api/internal/module"
+	"go-api/internal/preferences"
+	"go-api/internal/rates"
+	"go-api/internal/reports"
+	"go-api/internal/tags"
+	"go-api/internal/typeahead"
+	"go-api/internal/uploads"
+)
+
+// features are the feature modules the service is built with. A feature is added by
+// writing a package whose exported module.Factory is listed here.
+func features(cfg config.Config) []module.Factory {
+	return []module.Factory{
+		activity.New(cfg.Activity),
+		addresses.New(cfg.Addresses),
+		announcements.New(cfg.Announcements),
+		attachments.New(cfg.Attachments),
+		comments.New(cfg.Comments),
+		consent.New(cfg.Consent),
+		documents.New(cfg.Documents),
+		images.New(cfg.Images),
+		locations.New(cfg.Locations),
+		preferences.New(cfg.Preferences),
+		rates.New(cfg.Rates),
+		reports.New(cfg.Reports),
+		tags.New(cfg.Tags),
+		typeahead.New(cfg.Typeahead),
+		uploads.New(cfg.Uploads),
+	}
+}
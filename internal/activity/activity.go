@@ -0,0 +1,209 @@
+// Package activity is the feature module keeping the history of resources and the
+// feeds of users, built on the domain events. A projection reads the events of the
+// topics modules declare and records those about a resource opted in as a
+// subresource parent, which is listed under routes like /documents/:id/activity.
+//
+// Users follow the resources they may read, and owners follow theirs anyway; the
+// feed of a user is the activity of what they follow, but for their own. Feeds
+// are either delivered when the activity is recorded, one entry per follower
+// (fan-out on write), or gathered from the follows when they are read (fan-out on
+// read). Writing keeps reads cheap for resources with few followers; reading
+// keeps recording cheap for resources with many, and applies follows to the past.
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/realtime"
+	"go-api/internal/subresource"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+	"go-api/pkg/projection"
+
+	"go.uber.org/zap"
+)
+
+// Fan-out strategies of the feeds
+const (
+	FanoutWrite = "write"
+	FanoutRead  = "read"
+)
+
+// Config holds activity configuration
+type Config struct {
+	Resources []string `yaml:"resources"` // Types of the parents keeping a history; every declared parent when empty
+	Fanout    string   `yaml:"fanout"`    // write or read, write by default
+	Store     string   `yaml:"store"`     // memory or sql; the database by default
+}
+
+// Activity is an event about a resource
+type Activity struct {
+	ID            string          `json:"id"` // Of the event
+	Event         string          `json:"event"`
+	ResourceType  string          `json:"resourceType"`
+	ResourceID    string          `json:"resourceId"`
+	ResourceOwner string          `json:"resourceOwner,omitempty"`
+	Tenant        string          `json:"tenant,omitempty"`
+	ActorID       string          `json:"actorId,omitempty"` // Empty for the work of the service itself, like scans
+	Data          json.RawMessage `json:"data"`
+	OccurredAt    time.Time       `json:"occurredAt"`
+	Position      int64           `json:"-"` // In the event store, ordering the activity
+}
+
+// Follow is a resource a user follows
+type Follow struct {
+	Tenant       string    `json:"tenant,omitempty"`
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	CreatedAt    time.Time `json:"createdAt,omitzero"`
+}
+
+// ActivityPage is a page of activity, newest first
+type ActivityPage struct {
+	Data []Activity `json:"data"`
+	Next string     `json:"next,omitempty"` // Cursor of the next page, passed as ?cursor=
+}
+
+type activityModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	parents map[string]subresource.Parent // By type
+	ordered []subresource.Parent
+	topics  map[string]realtime.Topic // By event type
+}
+
+// New returns the factory of the activity module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		switch cfg.Fanout {
+		case "":
+			cfg.Fanout = FanoutWrite
+		case FanoutWrite, FanoutRead:
+		default:
+			return nil, fmt.Errorf("activity: unknown fanout %q, want %s or %s", cfg.Fanout, FanoutWrite, FanoutRead)
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("activity: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("activity: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &activityModule{cfg: cfg, backend: backend, store: store}, nil
+	}
+}
+
+func (m *activityModule) Name() string { return "activity" }
+
+func (m *activityModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// Attach keeps the parents configured to keep a history
+func (m *activityModule) Attach(parents []subresource.Parent) {
+	m.ordered = subresource.Select(parents, m.cfg.Resources)
+	m.parents = make(map[string]subresource.Parent, len(m.ordered))
+	for _, p := range m.ordered {
+		m.parents[p.Type] = p
+	}
+}
+
+// Subscribe keeps the topics telling what the events are about
+func (m *activityModule) Subscribe(topics []realtime.Topic) {
+	m.topics = make(map[string]realtime.Topic)
+	for _, t := range topics {
+		for _, event := range t.Events {
+			if _, ok := m.topics[event]; !ok {
+				m.topics[event] = t
+			}
+		}
+	}
+}
+
+// EventHandlers records the activity from the event stream. A rebuild clears the
+// history and the delivered feeds, but not the follows.
+func (m *activityModule) EventHandlers() []projection.Projection {
+	return []projection.Projection{projection.Funcs{
+		ProjectionName: "activity",
+		HandleFunc:     m.handle,
+		ResetFunc:      func(ctx context.Context) error { return m.store.Reset(ctx) },
+	}}
+}
+
+// handle records an event about a resource keeping a history, delivering it to
+// the feeds of the followers when fanning out on write
+func (m *activityModule) handle(ctx context.Context, e eventstore.Event) error {
+	topic, ok := m.topics[e.Type]
+	if !ok {
+		return nil
+	}
+	var data map[string]any
+	if err := e.Decode(&data); err != nil {
+		// Retrying wouldn't decode it either, and would hold up every later event
+		logger.Warn("skipping undecodable event", zap.String("event", e.Type), zap.Int64("position", e.Position), zap.Error(err))
+		return nil
+	}
+	r := topic.About(data)
+	if _, ok := m.parents[r.Type]; !ok || r.ID == "" {
+		return nil
+	}
+	a := Activity{ID: e.ID, Event: e.Type, ResourceType: r.Type, ResourceID: r.ID, ResourceOwner: r.Owner, Tenant: r.Tenant,
+		ActorID: topic.Actor(data), Data: e.Data, OccurredAt: e.RecordedAt, Position: e.Position}
+	if err := m.store.Record(ctx, a); err != nil {
+		return err
+	}
+	if m.cfg.Fanout != FanoutWrite {
+		return nil
+	}
+	followers, err := m.store.Followers(ctx, a.Tenant, a.ResourceType, a.ResourceID)
+	if err != nil {
+		return err
+	}
+	recipients := make([]string, 0, len(followers)+1)
+	for _, user := range append(followers, a.ResourceOwner) {
+		if user != "" && user != a.ActorID && !slices.Contains(recipients, user) {
+			recipients = append(recipients, user)
+		}
+	}
+	return m.store.Deliver(ctx, a, recipients)
+}
+
+// personalData is the activity of a user and what they follow, as exported
+type personalData struct {
+	Activity []Activity `json:"activity"`
+	Follows  []Follow   `json:"follows"`
+}
+
+// ExportPersonalData returns the activity of the user and what they follow
+func (m *activityModule) ExportPersonalData(ctx context.Context, userID string) (any, error) {
+	acted, err := m.store.Acted(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	follows, err := m.store.Followed(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return personalData{Activity: acted, Follows: follows}, nil
+}
+
+// ErasePersonalData drops the follows and the feed of the user, and the user as
+// the actor of their activity, which stays in the history of the resources. A
+// rebuild records the actors of the events again.
+func (m *activityModule) ErasePersonalData(ctx context.Context, userID string) error {
+	return m.store.Forget(ctx, userID)
+}
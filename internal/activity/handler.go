@@ -0,0 +1,204 @@
+package activity
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/subresource"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes mounts the feed of the caller, and the history and follow endpoints under
+// each parent keeping a history
+func (m *activityModule) Routes(api *apiversion.Group) {
+	description := "Lists the activity of the resources the caller follows or owns, but for their own, newest first. "
+	if m.cfg.Fanout == FanoutWrite {
+		description += "Activity is delivered to the feed as it is recorded: following a resource brings in its activity from then on."
+	} else {
+		description += "The feed is gathered from the follows as it is read: following a resource brings in its past activity as well."
+	}
+	api.GET("/feed", apiversion.Operation{
+		ID:          "listFeed",
+		Summary:     "List the activity feed of the caller",
+		Description: description,
+		Tags:        []string{"activity"},
+		Response:    ActivityPage{},
+	}, m.feed)
+	for _, p := range m.ordered {
+		m.parentRoutes(api, p)
+	}
+}
+
+func (m *activityModule) parentRoutes(api *apiversion.Group, p subresource.Parent) {
+	tags := []string{"activity"}
+	path := strings.TrimSuffix(p.Path, "/") + "/:id"
+	api.GET(path+"/activity", apiversion.Operation{
+		ID:          "list" + p.Title() + "Activity",
+		Summary:     "List the activity of a " + p.Type,
+		Description: "Lists what happened to it newest first, a page at a time. Activity is recorded from the events shortly after they are.",
+		Tags:        tags,
+		Response:    ActivityPage{},
+	}, m.history(p))
+	api.PUT(path+"/follow", apiversion.Operation{
+		ID:          "follow" + p.Title(),
+		Summary:     "Follow a " + p.Type,
+		Description: "Brings its activity into the feed of the caller. Following it again changes nothing.",
+		Tags:        tags,
+		Idempotency: retrysafe.Idempotent,
+	}, m.follow(p))
+	api.DELETE(path+"/follow", apiversion.Operation{
+		ID:      "unfollow" + p.Title(),
+		Summary: "Stop following a " + p.Type,
+		Tags:    tags,
+	}, m.unfollow(p))
+}
+
+// parsePage reads the page of activity from ?limit= and ?cursor=, the next cursor
+// of the previous page
+func parsePage(c *gin.Context) (Page, error) {
+	query := struct {
+		Limit  int    `form:"limit" binding:"min=1,max=200"`
+		Cursor string `form:"cursor"`
+	}{Limit: subresource.DefaultLimit}
+	if err := bind.Query(c, &query); err != nil {
+		return Page{}, apperrors.NewValidationErrorFrom("Invalid query", err)
+	}
+	page := Page{Limit: query.Limit}
+	if query.Cursor != "" {
+		before, err := strconv.ParseInt(query.Cursor, 10, 64)
+		if err != nil || before <= 0 {
+			return Page{}, apperrors.NewValidationError("Invalid query", apperrors.FieldError{
+				Field: "cursor", Rule: "cursor", Message: "cursor must be the next cursor of a previous page",
+			})
+		}
+		page.Before = before
+	}
+	return page, nil
+}
+
+// next trims the activity fetched for one more than the page holds to its limit,
+// returning the cursor of the next page, or an empty one when there is none
+func next(page Page, list []Activity) ([]Activity, string) {
+	if len(list) <= page.Limit {
+		return list, ""
+	}
+	list = list[:page.Limit]
+	return list, strconv.FormatInt(list[len(list)-1].Position, 10)
+}
+
+// feed lists the feed of the caller, dropping the activity of resources they may
+// no longer read
+func (m *activityModule) feed(c *gin.Context) {
+	ctx := c.Request.Context()
+	sub, ok := authz.SubjectFromContext(ctx)
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return
+	}
+	page, err := parsePage(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	fetch := Page{Before: page.Before, Limit: page.Limit + 1}
+	var list []Activity
+	if m.cfg.Fanout == FanoutWrite {
+		list, err = m.store.Delivered(ctx, sub.Tenant, sub.ID, fetch)
+	} else {
+		list, err = m.store.Gather(ctx, sub.Tenant, sub.ID, fetch)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	list, cursor := next(page, list)
+	readable := list[:0]
+	for _, a := range list {
+		allowed, err := authz.Can(ctx, "read", authz.Resource{Type: a.ResourceType, ID: a.ResourceID, Owner: a.ResourceOwner, Tenant: a.Tenant})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if allowed {
+			readable = append(readable, a)
+		}
+	}
+	c.JSON(http.StatusOK, ActivityPage{Data: readable, Next: cursor})
+}
+
+func (m *activityModule) history(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		page, err := parsePage(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		list, err := m.store.History(ctx, r.Tenant, r.Type, r.ID, Page{Before: page.Before, Limit: page.Limit + 1})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		list, cursor := next(page, list)
+		c.JSON(http.StatusOK, ActivityPage{Data: list, Next: cursor})
+	}
+}
+
+func (m *activityModule) follow(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		sub, ok := authz.SubjectFromContext(ctx)
+		if !ok || sub.ID == "" {
+			c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+			return
+		}
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if err := m.store.Follow(ctx, r.Tenant, sub.ID, r.Type, r.ID); err != nil {
+			c.Error(err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (m *activityModule) unfollow(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		sub, ok := authz.SubjectFromContext(ctx)
+		if !ok || sub.ID == "" {
+			c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+			return
+		}
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		followed, err := m.store.Unfollow(ctx, r.Tenant, sub.ID, r.Type, r.ID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if !followed {
+			c.Error(apperrors.NewNotFoundError("Not following this " + p.Type))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,432 @@
+package activity
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+)
+
+// Page selects the activity before a position, newest first
+type Page struct {
+	Before int64 // Zero for the newest
+	Limit  int
+}
+
+// before is the position the page ends at, exclusive
+func (p Page) before() int64 {
+	if p.Before <= 0 {
+		return math.MaxInt64
+	}
+	return p.Before
+}
+
+// Store persists the activity, the follows and the delivered feeds
+type Store interface {
+	// Record adds an activity, doing nothing when it has been recorded already
+	Record(ctx context.Context, a Activity) error
+	// Deliver adds an activity to the feeds of users, skipping those having it
+	Deliver(ctx context.Context, a Activity, users []string) error
+	// History returns the activity of a resource of a tenant in the page
+	History(ctx context.Context, tenant, resourceType, resourceID string, page Page) ([]Activity, error)
+	// Delivered returns the page of the activity delivered to the feed of a user
+	Delivered(ctx context.Context, tenant, user string, page Page) ([]Activity, error)
+	// Gather returns the page of the activity of the resources a user follows or
+	// owns, but for their own
+	Gather(ctx context.Context, tenant, user string, page Page) ([]Activity, error)
+	// Follow makes a user follow a resource, doing nothing when they do already
+	Follow(ctx context.Context, tenant, user, resourceType, resourceID string) error
+	// Unfollow reports whether the user followed the resource
+	Unfollow(ctx context.Context, tenant, user, resourceType, resourceID string) (bool, error)
+	// Followers returns the users following a resource
+	Followers(ctx context.Context, tenant, resourceType, resourceID string) ([]string, error)
+	// Reset clears the activity and the feeds, before they are rebuilt
+	Reset(ctx context.Context) error
+	// Acted returns the activity of a user in every tenant, newest first
+	Acted(ctx context.Context, user string) ([]Activity, error)
+	// Followed returns the resources a user follows in every tenant
+	Followed(ctx context.Context, user string) ([]Follow, error)
+	// Forget drops the follows and the feeds of a user in every tenant, and the
+	// user as the actor of their activity
+	Forget(ctx context.Context, user string) error
+}
+
+type resourceKey struct{ tenant, resourceType, resourceID string }
+
+type feedKey struct{ tenant, user string }
+
+// MemoryStore keeps the activity in memory, used when no database is configured
+type MemoryStore struct {
+	mu         sync.RWMutex
+	activities map[int64]Activity // By position
+	feeds      map[feedKey]map[int64]bool
+	follows    map[resourceKey]map[string]bool
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{activities: make(map[int64]Activity), feeds: make(map[feedKey]map[int64]bool),
+		follows: make(map[resourceKey]map[string]bool)}
+}
+
+func (s *MemoryStore) Record(ctx context.Context, a Activity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.activities[a.Position]; !ok {
+		s.activities[a.Position] = a
+	}
+	return nil
+}
+
+func (s *MemoryStore) Deliver(ctx context.Context, a Activity, users []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range users {
+		key := feedKey{a.Tenant, user}
+		if s.feeds[key] == nil {
+			s.feeds[key] = make(map[int64]bool)
+		}
+		s.feeds[key][a.Position] = true
+	}
+	return nil
+}
+
+// page returns the activity matching keep in the page, newest first
+func (s *MemoryStore) page(page Page, keep func(a Activity) bool) []Activity {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Activity{}
+	for _, a := range s.activities {
+		if a.Position < page.before() && keep(a) {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Position > list[j].Position })
+	if len(list) > page.Limit {
+		list = list[:page.Limit]
+	}
+	return list
+}
+
+func (s *MemoryStore) History(ctx context.Context, tenant, resourceType, resourceID string, page Page) ([]Activity, error) {
+	return s.page(page, func(a Activity) bool {
+		return a.Tenant == tenant && a.ResourceType == resourceType && a.ResourceID == resourceID
+	}), nil
+}
+
+func (s *MemoryStore) Delivered(ctx context.Context, tenant, user string, page Page) ([]Activity, error) {
+	key := feedKey{tenant, user}
+	return s.page(page, func(a Activity) bool { return s.feeds[key][a.Position] }), nil
+}
+
+func (s *MemoryStore) Gather(ctx context.Context, tenant, user string, page Page) ([]Activity, error) {
+	return s.page(page, func(a Activity) bool {
+		return a.Tenant == tenant && a.ActorID != user &&
+			(a.ResourceOwner == user || s.follows[resourceKey{tenant, a.ResourceType, a.ResourceID}][user])
+	}), nil
+}
+
+func (s *MemoryStore) Follow(ctx context.Context, tenant, user, resourceType, resourceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := resourceKey{tenant, resourceType, resourceID}
+	if s.follows[key] == nil {
+		s.follows[key] = make(map[string]bool)
+	}
+	s.follows[key][user] = true
+	return nil
+}
+
+func (s *MemoryStore) Unfollow(ctx context.Context, tenant, user, resourceType, resourceID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := resourceKey{tenant, resourceType, resourceID}
+	if !s.follows[key][user] {
+		return false, nil
+	}
+	delete(s.follows[key], user)
+	return true, nil
+}
+
+func (s *MemoryStore) Followers(ctx context.Context, tenant, resourceType, resourceID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := []string{}
+	for user := range s.follows[resourceKey{tenant, resourceType, resourceID}] {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activities = make(map[int64]Activity)
+	s.feeds = make(map[feedKey]map[int64]bool)
+	return nil
+}
+
+func (s *MemoryStore) Acted(ctx context.Context, user string) ([]Activity, error) {
+	return s.page(Page{Limit: math.MaxInt}, func(a Activity) bool { return a.ActorID == user }), nil
+}
+
+func (s *MemoryStore) Followed(ctx context.Context, user string) ([]Follow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Follow{}
+	for key, users := range s.follows {
+		if users[user] {
+			list = append(list, Follow{Tenant: key.tenant, ResourceType: key.resourceType, ResourceID: key.resourceID})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Tenant+"/"+list[i].ResourceType+"/"+list[i].ResourceID < list[j].Tenant+"/"+list[j].ResourceType+"/"+list[j].ResourceID
+	})
+	return list, nil
+}
+
+func (s *MemoryStore) Forget(ctx context.Context, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, users := range s.follows {
+		delete(users, user)
+	}
+	for key := range s.feeds {
+		if key.user == user {
+			delete(s.feeds, key)
+		}
+	}
+	for position, a := range s.activities {
+		if a.ActorID == user {
+			a.ActorID = ""
+			s.activities[position] = a
+		}
+	}
+	return nil
+}
+
+// migrations create the activity, follow and feed tables. Activity is keyed by its
+// position in the event store, which orders it.
+var migrations = []module.Migration{{
+	Name: "create_activity",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS activities (
+			position       BIGINT PRIMARY KEY,
+			id             TEXT NOT NULL,
+			event          TEXT NOT NULL,
+			resource_type  TEXT NOT NULL,
+			resource_id    TEXT NOT NULL,
+			resource_owner TEXT NOT NULL,
+			tenant         TEXT NOT NULL,
+			actor_id       TEXT NOT NULL,
+			data           TEXT NOT NULL,
+			occurred_at    TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS activities_resource_idx ON activities (tenant, resource_type, resource_id, position);
+		CREATE INDEX IF NOT EXISTS activities_owner_idx ON activities (tenant, resource_owner, position);
+		CREATE TABLE IF NOT EXISTS activity_follows (
+			tenant        TEXT NOT NULL,
+			user_id       TEXT NOT NULL,
+			resource_type TEXT NOT NULL,
+			resource_id   TEXT NOT NULL,
+			created_at    TIMESTAMP NOT NULL,
+			PRIMARY KEY (tenant, user_id, resource_type, resource_id)
+		);
+		CREATE INDEX IF NOT EXISTS activity_follows_resource_idx ON activity_follows (tenant, resource_type, resource_id);
+		CREATE TABLE IF NOT EXISTS activity_feeds (
+			tenant   TEXT NOT NULL,
+			user_id  TEXT NOT NULL,
+			position BIGINT NOT NULL,
+			PRIMARY KEY (tenant, user_id, position)
+		)`,
+}}
+
+// SQLStore persists the activity in the activities, activity_follows and
+// activity_feeds tables. Unlike the stores of requests, it always uses the shared
+// database: the projection recording the activity runs outside of any request, on
+// the shared event store.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Record(ctx context.Context, a Activity) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO activities (position, id, event, resource_type, resource_id, resource_owner, tenant, actor_id, data, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (position) DO NOTHING`,
+		a.Position, a.ID, a.Event, a.ResourceType, a.ResourceID, a.ResourceOwner, a.Tenant, a.ActorID, string(a.Data), a.OccurredAt)
+	return err
+}
+
+func (s *SQLStore) Deliver(ctx context.Context, a Activity, users []string) error {
+	if len(users) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, user := range users {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO activity_feeds (tenant, user_id, position) VALUES ($1, $2, $3)
+			ON CONFLICT (tenant, user_id, position) DO NOTHING`, a.Tenant, user, a.Position); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const selectActivities = `SELECT a.position, a.id, a.event, a.resource_type, a.resource_id, a.resource_owner, a.tenant, a.actor_id, a.data, a.occurred_at FROM activities a`
+
+func (s *SQLStore) list(ctx context.Context, query string, args ...any) ([]Activity, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Activity{}
+	for rows.Next() {
+		var a Activity
+		var data string
+		if err := rows.Scan(&a.Position, &a.ID, &a.Event, &a.ResourceType, &a.ResourceID, &a.ResourceOwner, &a.Tenant, &a.ActorID,
+			&data, &a.OccurredAt); err != nil {
+			return nil, err
+		}
+		a.Data = json.RawMessage(data)
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) History(ctx context.Context, tenant, resourceType, resourceID string, page Page) ([]Activity, error) {
+	return s.list(ctx, selectActivities+`
+		WHERE a.tenant = $1 AND a.resource_type = $2 AND a.resource_id = $3 AND a.position < $4
+		ORDER BY a.position DESC
+		LIMIT $5`, tenant, resourceType, resourceID, page.before(), page.Limit)
+}
+
+func (s *SQLStore) Delivered(ctx context.Context, tenant, user string, page Page) ([]Activity, error) {
+	return s.list(ctx, selectActivities+`
+		JOIN activity_feeds f ON f.position = a.position
+		WHERE f.tenant = $1 AND f.user_id = $2 AND f.position < $3
+		ORDER BY f.position DESC
+		LIMIT $4`, tenant, user, page.before(), page.Limit)
+}
+
+func (s *SQLStore) Gather(ctx context.Context, tenant, user string, page Page) ([]Activity, error) {
+	return s.list(ctx, selectActivities+`
+		WHERE a.tenant = $1 AND a.actor_id <> $2 AND a.position < $3
+			AND (a.resource_owner = $2 OR EXISTS (
+				SELECT 1 FROM activity_follows f
+				WHERE f.tenant = a.tenant AND f.user_id = $2 AND f.resource_type = a.resource_type AND f.resource_id = a.resource_id))
+		ORDER BY a.position DESC
+		LIMIT $4`, tenant, user, page.before(), page.Limit)
+}
+
+func (s *SQLStore) Follow(ctx context.Context, tenant, user, resourceType, resourceID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO activity_follows (tenant, user_id, resource_type, resource_id, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant, user_id, resource_type, resource_id) DO NOTHING`,
+		tenant, user, resourceType, resourceID, time.Now().UTC())
+	return err
+}
+
+func (s *SQLStore) Unfollow(ctx context.Context, tenant, user, resourceType, resourceID string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM activity_follows WHERE tenant = $1 AND user_id = $2 AND resource_type = $3 AND resource_id = $4`,
+		tenant, user, resourceType, resourceID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *SQLStore) Followers(ctx context.Context, tenant, resourceType, resourceID string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT user_id FROM activity_follows WHERE tenant = $1 AND resource_type = $2 AND resource_id = $3 ORDER BY user_id`,
+		tenant, resourceType, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []string{}
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLStore) Reset(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"activity_feeds", "activities"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Acted(ctx context.Context, user string) ([]Activity, error) {
+	return s.list(ctx, selectActivities+` WHERE a.actor_id = $1 ORDER BY a.position DESC`, user)
+}
+
+func (s *SQLStore) Followed(ctx context.Context, user string) ([]Follow, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tenant, resource_type, resource_id, created_at FROM activity_follows
+		WHERE user_id = $1 ORDER BY tenant, resource_type, resource_id`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Follow{}
+	for rows.Next() {
+		var f Follow
+		if err := rows.Scan(&f.Tenant, &f.ResourceType, &f.ResourceID, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Forget(ctx context.Context, user string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM activity_follows WHERE user_id = $1`,
+		`DELETE FROM activity_feeds WHERE user_id = $1`,
+		`UPDATE activities SET actor_id = '' WHERE actor_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, user); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
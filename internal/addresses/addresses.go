@@ -0,0 +1,42 @@
+// Package addresses is the feature module validating postal addresses before
+// clients store them, as typed in forms. An address is normalized and checked
+// for the format of its country; with a geocoder configured it is looked up too,
+// which tells whether it exists and how the provider writes it, for offering
+// the correction to whoever typed it.
+package addresses
+
+import (
+	"fmt"
+	"strings"
+
+	"go-api/internal/module"
+	"go-api/pkg/geo"
+)
+
+// Config holds address validation configuration
+type Config struct {
+	Countries []string           `yaml:"countries"` // ISO codes of the countries addresses may be in; any when empty
+	Geocoder  geo.GeocoderConfig `yaml:"geocoder"`  // Addresses are only checked for their format without a provider
+}
+
+type addressesModule struct {
+	module.Base
+	cfg      Config
+	geocoder geo.Geocoder // Nil without a provider
+}
+
+// New returns the factory of the addresses module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		for i, country := range cfg.Countries {
+			cfg.Countries[i] = strings.ToUpper(country)
+		}
+		geocoder, err := geo.NewGeocoder(cfg.Geocoder, deps.Cache)
+		if err != nil {
+			return nil, fmt.Errorf("addresses: %w", err)
+		}
+		return &addressesModule{cfg: cfg, geocoder: geocoder}, nil
+	}
+}
+
+func (m *addressesModule) Name() string { return "addresses" }
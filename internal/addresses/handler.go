@@ -0,0 +1,124 @@
+package addresses
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/geo"
+	"go-api/pkg/logger"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Validation is what was found of an address
+type Validation struct {
+	// Valid is whether the address is well formed and, with a geocoder, was found
+	// precisely enough to deliver to
+	Valid    bool                   `json:"valid"`
+	Address  geo.Address            `json:"address"` // Normalized, to store as is once valid
+	Problems []apperrors.FieldError `json:"problems,omitempty"`
+	Verified bool                   `json:"verified"`        // Whether the geocoder found the building or street
+	Match    *geo.Match             `json:"match,omitempty"` // The best match of the geocoder
+	// Differences are the fields the match writes otherwise, like a postal code
+	// typed wrong, which clients offer to correct
+	Differences []string `json:"differences,omitempty"`
+}
+
+// Routes mounts the validation endpoint
+func (m *addressesModule) Routes(api *apiversion.Group) {
+	description := "Normalizes an address and checks it has a street, city and country, and a postal code of the country's format. " +
+		"Problems are reported as those of validation errors, with a 200 response."
+	if m.geocoder != nil {
+		description += " Well-formed addresses are looked up with " + m.cfg.Geocoder.Provider + " too: they are only valid when found " +
+			"to the building or street, and the fields the match writes otherwise are listed as differences."
+	}
+	api.POST("/addresses/validate", apiversion.Operation{
+		ID:          "validateAddress",
+		Summary:     "Validate a postal address",
+		Description: description,
+		Tags:        []string{"addresses"},
+		Idempotency: retrysafe.Safe,
+		Request:     geo.Address{},
+		Response:    Validation{},
+	}, m.validate)
+}
+
+func (m *addressesModule) validate(c *gin.Context) {
+	ctx := c.Request.Context()
+	if sub, ok := authz.SubjectFromContext(ctx); !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return
+	}
+	var req geo.Address
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid address", err))
+		return
+	}
+	result := Validation{Address: geo.NormalizeAddress(req)}
+	if err := result.Address.Validate(); err != nil {
+		result.Problems = apperrors.FieldErrors(err)
+	}
+	if len(m.cfg.Countries) > 0 && result.Address.Country != "" && !slices.Contains(m.cfg.Countries, result.Address.Country) {
+		result.Problems = append(result.Problems, apperrors.FieldError{
+			Pointer: "/country", Field: "country", Rule: "oneof", Param: strings.Join(m.cfg.Countries, " "),
+			Message: "country must be one of " + strings.Join(m.cfg.Countries, ", "),
+		})
+	}
+	if len(result.Problems) > 0 || m.geocoder == nil {
+		result.Valid = len(result.Problems) == 0
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	matches, err := m.geocoder.Geocode(ctx, result.Address.String())
+	if errors.Is(err, geo.ErrRateLimited) {
+		c.Header("Retry-After", "1")
+		c.Error(apperrors.NewTooManyRequestsError("Too many addresses looked up, retry shortly"))
+		return
+	}
+	if err != nil {
+		logger.Error("address lookup failed", zap.String("provider", m.cfg.Geocoder.Provider), zap.Error(err))
+		appErr := apperrors.Wrap(err, apperrors.CodeInternal)
+		appErr.Message = "Address lookup is unavailable, please retry later"
+		c.Error(appErr)
+		return
+	}
+	// Candidates in other countries are none of the one typed
+	i := slices.IndexFunc(matches, func(match geo.Match) bool { return match.Address.Country == result.Address.Country })
+	if i >= 0 {
+		match := matches[i]
+		result.Match = &match
+		result.Verified = match.Precision == geo.PrecisionExact || match.Precision == geo.PrecisionStreet
+		result.Differences = differences(result.Address, match.Address)
+	}
+	result.Valid = result.Verified
+	c.JSON(http.StatusOK, result)
+}
+
+// differences returns the fields of an address the match writes otherwise, but
+// for those the match lacks. Regions aren't compared, as providers abbreviate
+// them differently.
+func differences(a, match geo.Address) []string {
+	var fields []string
+	for _, f := range []struct{ name, typed, found string }{
+		{"street", a.Street, match.Street}, {"unit", a.Unit, match.Unit}, {"city", a.City, match.City},
+		{"postalCode", a.PostalCode, match.PostalCode},
+	} {
+		// Postal codes are written with and without a space, like 1012 JS
+		if f.name == "postalCode" {
+			f.typed, f.found = strings.ReplaceAll(f.typed, " ", ""), strings.ReplaceAll(f.found, " ", "")
+		}
+		if f.found != "" && !strings.EqualFold(f.typed, f.found) {
+			fields = append(fields, f.name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"go-api/internal/apikey"
+	"go-api/internal/featureflag"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueueStats summarises one job queue for the dashboard
+type QueueStats struct {
+	Name    string `json:"name"`
+	Pending int    `json:"pending"`
+	Active  int    `json:"active"`
+	Failed  int    `json:"failed"`
+	Paused  bool   `json:"paused"`
+}
+
+// QueueInspector reports job queue status, implemented by the job queue
+type QueueInspector interface {
+	QueueStats(ctx context.Context) ([]QueueStats, error)
+}
+
+// Handler serves the admin dashboard and its supporting APIs
+type Handler struct {
+	recorder    *Recorder
+	maintenance *Maintenance
+	flags       *featureflag.Store
+	keys        apikey.Store
+	queues      QueueInspector
+}
+
+// NewHandler creates the admin handler, queues may be nil when no job queue is running
+func NewHandler(recorder *Recorder, maintenance *Maintenance, flags *featureflag.Store, keys apikey.Store, queues QueueInspector) *Handler {
+	return &Handler{
+		recorder:    recorder,
+		maintenance: maintenance,
+		flags:       flags,
+		keys:        keys,
+		queues:      queues,
+	}
+}
+
+// RegisterRoutes mounts the dashboard and admin APIs on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("", h.dashboard)
+	rg.GET("/requests", h.requests)
+	rg.GET("/errors", h.errors)
+	rg.GET("/maintenance", h.getMaintenance)
+	rg.PUT("/maintenance", h.setMaintenance)
+	rg.GET("/log-level", h.getLogLevel)
+	rg.PUT("/log-level", h.setLogLevel)
+}
+
+func (h *Handler) dashboard(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	keys, err := h.keys.List(ctx)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var queues []QueueStats
+	if h.queues != nil {
+		if queues, err = h.queues.QueueStats(ctx); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.HTML(http.StatusOK, "pages/admin/dashboard", gin.H{
+		"Requests":     h.recorder.Requests(),
+		"Errors":       h.recorder.Errors(),
+		"Maintenance":  h.maintenance.State(),
+		"Flags":        h.flags.List(),
+		"Keys":         keys,
+		"Queues":       queues,
+		"QueueEnabled": h.queues != nil,
+		"LogLevel":     logger.Level().String(),
+	})
+}
+
+func (h *Handler) requests(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.recorder.Requests()})
+}
+
+func (h *Handler) errors(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.recorder.Errors()})
+}
+
+func (h *Handler) getMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, h.maintenance.State())
+}
+
+func (h *Handler) setMaintenance(c *gin.Context) {
+	var state MaintenanceState
+	if err := bind.JSON(c, &state); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid maintenance state", err))
+		return
+	}
+	h.maintenance.Set(state)
+	logger.Warnw("maintenance mode changed", "enabled", state.Enabled, "request-id", c.GetString("requestId"))
+	c.JSON(http.StatusOK, h.maintenance.State())
+}
+
+type logLevelRequest struct {
+	Level string `json:"level" binding:"required,oneof=debug info warn error"`
+}
+
+func (h *Handler) getLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": logger.Level().String()})
+}
+
+func (h *Handler) setLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid log level", err))
+		return
+	}
+	if err := logger.SetLevel(req.Level); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid log level", err))
+		return
+	}
+	logger.Infow("log level changed", "level", req.Level)
+	c.JSON(http.StatusOK, gin.H{"level": logger.Level().String()})
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maintenance is a runtime switch that rejects traffic while an operator works on the system
+type Maintenance struct {
+	mu      sync.RWMutex
+	enabled bool
+	message string
+}
+
+// MaintenanceState is the current maintenance mode setting
+type MaintenanceState struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// State returns the current setting
+func (m *Maintenance) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return MaintenanceState{Enabled: m.enabled, Message: m.message}
+}
+
+// Set turns maintenance mode on or off
+func (m *Maintenance) Set(state MaintenanceState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled, m.message = state.Enabled, state.Message
+}
+
+// Middleware answers 503 while maintenance mode is on, except for exempt path prefixes
+// such as the admin API and health checks
+func (m *Maintenance) Middleware(exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := m.State()
+		if !state.Enabled {
+			c.Next()
+			return
+		}
+
+		for _, prefix := range exempt {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
+		message := state.Message
+		if message == "" {
+			message = "Service is under maintenance"
+		}
+		c.Header("Retry-After", "120")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"code":    "MAINTENANCE",
+			"message": message,
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestRecord summarises a served request for the admin dashboard
+type RequestRecord struct {
+	Time        time.Time     `json:"time"`
+	Method      string        `json:"method"`
+	Path        string        `json:"path"`
+	Status      int           `json:"status"`
+	Latency     time.Duration `json:"latency"`
+	RequestID   string        `json:"requestId,omitempty"`
+	ClientIP    string        `json:"clientIp"`
+	Error       string        `json:"error,omitempty"`
+	Fingerprint string        `json:"fingerprint,omitempty"` // Groups identical errors
+}
+
+// ring is a fixed-size buffer keeping the most recent records
+type ring struct {
+	records []RequestRecord
+	next    int
+	full    bool
+}
+
+func (r *ring) add(rec RequestRecord) {
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns records newest first
+func (r *ring) list() []RequestRecord {
+	n := r.next
+	if r.full {
+		n = len(r.records)
+	}
+	out := make([]RequestRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.records[(r.next-i+len(r.records))%len(r.records)])
+	}
+	return out
+}
+
+// Recorder keeps the most recent requests and errors in memory
+type Recorder struct {
+	mu       sync.Mutex
+	requests ring
+	errors   ring
+}
+
+// NewRecorder creates a recorder keeping size requests and size errors
+func NewRecorder(size int) *Recorder {
+	if size < 1 {
+		size = 1
+	}
+	return &Recorder{
+		requests: ring{records: make([]RequestRecord, size)},
+		errors:   ring{records: make([]RequestRecord, size)},
+	}
+}
+
+// Middleware records every request once it has been served
+func (rec *Recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		record := RequestRecord{
+			Time:        start.UTC(),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			Status:      c.Writer.Status(),
+			Latency:     time.Since(start),
+			RequestID:   c.GetString("requestId"),
+			ClientIP:    c.ClientIP(),
+			Error:       c.Errors.String(),
+			Fingerprint: c.GetString("errorFingerprint"),
+		}
+
+		// Requests the client abandoned are kept out of the error list
+		disconnected := apperrors.ClientDisconnected(c.Request.Context())
+		if disconnected {
+			record.Status = apperrors.StatusClientClosedRequest
+			record.Error = "client_disconnected"
+		}
+
+		rec.mu.Lock()
+		rec.requests.add(record)
+		if !disconnected && (record.Status >= 500 || len(c.Errors) > 0) {
+			rec.errors.add(record)
+		}
+		rec.mu.Unlock()
+	}
+}
+
+// Requests returns recent requests, newest first
+func (rec *Recorder) Requests() []RequestRecord {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.requests.list()
+}
+
+// Errors returns recent failed requests, newest first
+func (rec *Recorder) Errors() []RequestRecord {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.errors.list()
+}
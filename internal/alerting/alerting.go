@@ -0,0 +1,373 @@
+// Package alerting watches served requests for error spikes and notifies Slack or
+// PagerDuty. Rules match server errors or specific error codes, fire when a count and
+// optionally a ratio of matching requests is reached within a window, and can be
+// edited and silenced at runtime through the admin API.
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// sampleRequests is how many request IDs an alert carries
+const sampleRequests = 5
+
+// Config holds alerting configuration
+type Config struct {
+	SlackWebhookURL     string `yaml:"slackWebhookURL"`
+	PagerDutyRoutingKey string `yaml:"pagerDutyRoutingKey"` // Events API v2 integration key
+	Rules               []Rule `yaml:"rules"`
+}
+
+// Duration is a time.Duration written as a string like "5m" in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rule fires when Threshold matching requests are seen within Window. With a Ratio it
+// also needs that fraction of all requests in the window to match, so quiet periods
+// don't alert on a handful of errors.
+type Rule struct {
+	Name      string   `json:"name"`
+	Code      string   `json:"code,omitempty"` // Error code to match, every server error when empty
+	Threshold int      `json:"threshold"`
+	Ratio     float64  `json:"ratio,omitempty"`
+	Window    Duration `json:"window"`
+	Cooldown  Duration `json:"cooldown,omitempty"` // Minimum time between alerts for the rule
+	Channels  []string `json:"channels,omitempty"` // Notifier names, every notifier when empty
+}
+
+func (r Rule) validate() error {
+	switch {
+	case r.Name == "":
+		return errors.New("name is required")
+	case r.Threshold < 1:
+		return errors.New("threshold must be at least 1")
+	case r.Ratio < 0 || r.Ratio > 1:
+		return errors.New("ratio must be between 0 and 1")
+	case time.Duration(r.Window) < time.Second:
+		return errors.New("window must be at least 1s")
+	}
+	return nil
+}
+
+// Alert is sent to notifiers when a rule fires
+type Alert struct {
+	Rule        string    `json:"rule"`
+	Code        string    `json:"code,omitempty"`
+	Count       int       `json:"count"`
+	Total       int       `json:"total"`
+	Window      Duration  `json:"window"`
+	RequestIDs  []string  `json:"requestIds,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Stack       string    `json:"stack,omitempty"` // Stack of a sample panic, if any
+	FiredAt     time.Time `json:"firedAt"`
+}
+
+// Summary describes the alert in one line
+func (a Alert) Summary() string {
+	what := "server errors"
+	if a.Code != "" {
+		what = a.Code + " errors"
+	}
+	return fmt.Sprintf("%s: %d %s out of %d requests in the last %s", a.Rule, a.Count, what, a.Total, time.Duration(a.Window))
+}
+
+// Notifier delivers alerts to an external service
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Silence suppresses a rule, or every rule when Rule is empty, until it ends
+type Silence struct {
+	Rule   string    `json:"rule,omitempty"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// window counts requests in one-second buckets
+type window struct {
+	buckets []bucket
+}
+
+type bucket struct {
+	second        int64
+	total, errors int
+}
+
+func (w *window) add(now time.Time, matched bool) {
+	sec := now.Unix()
+	b := &w.buckets[sec%int64(len(w.buckets))]
+	if b.second != sec {
+		*b = bucket{second: sec}
+	}
+	b.total++
+	if matched {
+		b.errors++
+	}
+}
+
+func (w *window) counts(now time.Time) (errs, total int) {
+	oldest := now.Unix() - int64(len(w.buckets)) + 1
+	for _, b := range w.buckets {
+		if b.second >= oldest {
+			errs += b.errors
+			total += b.total
+		}
+	}
+	return errs, total
+}
+
+type ruleState struct {
+	rule       Rule
+	window     window
+	requestIDs []string // Most recent matching requests
+	lastFired  time.Time
+}
+
+func newRuleState(r Rule) *ruleState {
+	return &ruleState{rule: r, window: window{buckets: make([]bucket, int(time.Duration(r.Window)/time.Second))}}
+}
+
+// Alerter evaluates rules against served requests
+type Alerter struct {
+	notifiers []Notifier
+
+	mu       sync.Mutex
+	rules    map[string]*ruleState
+	silences []Silence
+	recent   []Alert // Newest last
+}
+
+// New creates an alerter posting to the notifiers configured in cfg. Invalid rules
+// are logged and skipped.
+func New(cfg Config) *Alerter {
+	var notifiers []Notifier
+	if cfg.SlackWebhookURL != "" {
+		notifiers = append(notifiers, NewSlack(cfg.SlackWebhookURL))
+	}
+	if cfg.PagerDutyRoutingKey != "" {
+		notifiers = append(notifiers, NewPagerDuty(cfg.PagerDutyRoutingKey))
+	}
+	a := NewAlerter(notifiers...)
+	for _, r := range cfg.Rules {
+		if err := a.SetRule(r); err != nil {
+			logger.Warn("skipping invalid alert rule", zap.String("rule", r.Name), zap.Error(err))
+		}
+	}
+	return a
+}
+
+// NewAlerter creates an alerter without rules posting to notifiers
+func NewAlerter(notifiers ...Notifier) *Alerter {
+	return &Alerter{notifiers: notifiers, rules: make(map[string]*ruleState)}
+}
+
+// Rules returns the configured rules sorted by name
+func (a *Alerter) Rules() []Rule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	list := make([]Rule, 0, len(a.rules))
+	for _, s := range a.rules {
+		list = append(list, s.rule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// SetRule adds or replaces a rule, resetting its counters
+func (a *Alerter) SetRule(r Rule) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules[r.Name] = newRuleState(r)
+	return nil
+}
+
+// DeleteRule removes a rule, returning false if it did not exist
+func (a *Alerter) DeleteRule(name string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.rules[name]
+	delete(a.rules, name)
+	return ok
+}
+
+// Silences returns the silences that haven't ended
+func (a *Alerter) Silences() []Silence {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pruneSilences(time.Now())
+	return append([]Silence(nil), a.silences...)
+}
+
+// Silence suppresses alerts for a rule, or every rule when s.Rule is empty
+func (a *Alerter) Silence(s Silence) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pruneSilences(time.Now())
+	a.silences = append(a.silences, s)
+}
+
+// Unsilence ends the silences for a rule, returning false if there were none
+func (a *Alerter) Unsilence(rule string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	kept := a.silences[:0]
+	for _, s := range a.silences {
+		if s.Rule != rule {
+			kept = append(kept, s)
+		}
+	}
+	found := len(kept) < len(a.silences)
+	a.silences = kept
+	return found
+}
+
+// Recent returns the alerts fired most recently, newest first
+func (a *Alerter) Recent() []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]Alert, len(a.recent))
+	for i, alert := range a.recent {
+		out[len(a.recent)-1-i] = alert
+	}
+	return out
+}
+
+func (a *Alerter) pruneSilences(now time.Time) {
+	kept := a.silences[:0]
+	for _, s := range a.silences {
+		if s.Until.After(now) {
+			kept = append(kept, s)
+		}
+	}
+	a.silences = kept
+}
+
+func (a *Alerter) silenced(rule string, now time.Time) bool {
+	for _, s := range a.silences {
+		if (s.Rule == "" || s.Rule == rule) && s.Until.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware observes every response once the error handler has rendered it, so it
+// must be registered before middleware.ErrorHandler
+func (a *Alerter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if apperrors.ClientDisconnected(c.Request.Context()) {
+			return
+		}
+		code, failed := errorCode(c)
+		requestID := c.GetString("requestId")
+		now := time.Now()
+
+		var fired []Alert
+		a.mu.Lock()
+		for _, s := range a.rules {
+			matched := failed && (s.rule.Code == "" && c.Writer.Status() >= http.StatusInternalServerError || s.rule.Code == code)
+			s.window.add(now, matched)
+			if !matched {
+				continue
+			}
+			if requestID != "" {
+				s.requestIDs = append(s.requestIDs, requestID)
+				if len(s.requestIDs) > sampleRequests {
+					s.requestIDs = s.requestIDs[1:]
+				}
+			}
+
+			errs, total := s.window.counts(now)
+			if errs < s.rule.Threshold || float64(errs) < s.rule.Ratio*float64(total) {
+				continue
+			}
+			if now.Sub(s.lastFired) < time.Duration(s.rule.Cooldown) || a.silenced(s.rule.Name, now) {
+				continue
+			}
+			s.lastFired = now
+			alert := Alert{
+				Rule:        s.rule.Name,
+				Code:        s.rule.Code,
+				Count:       errs,
+				Total:       total,
+				Window:      s.rule.Window,
+				RequestIDs:  append([]string(nil), s.requestIDs...),
+				Fingerprint: c.GetString("errorFingerprint"),
+				Stack:       c.GetString("errorStack"),
+				FiredAt:     now.UTC(),
+			}
+			fired = append(fired, alert)
+			a.recent = append(a.recent, alert)
+			if len(a.recent) > 50 {
+				a.recent = a.recent[1:]
+			}
+			go a.dispatch(s.rule.Channels, alert)
+		}
+		a.mu.Unlock()
+
+		for _, alert := range fired {
+			logger.Warn("alert fired", zap.String("rule", alert.Rule), zap.String("summary", alert.Summary()))
+		}
+	}
+}
+
+// errorCode returns the code of the request's error, reporting false when it
+// didn't fail
+func errorCode(c *gin.Context) (string, bool) {
+	if len(c.Errors) > 0 {
+		return apperrors.From(c.Errors.Last().Err).Code, true
+	}
+	if c.Writer.Status() >= http.StatusInternalServerError {
+		return "", true
+	}
+	return "", false
+}
+
+func (a *Alerter) dispatch(channels []string, alert Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, n := range a.notifiers {
+		if len(channels) > 0 && !slices.Contains(channels, n.Name()) {
+			continue
+		}
+		if err := n.Notify(ctx, alert); err != nil {
+			logger.Warn("failed to send alert", zap.String("notifier", n.Name()), zap.String("rule", alert.Rule), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package alerting
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for editing alert rules and silences
+type Handler struct {
+	alerter *Alerter
+}
+
+// NewHandler creates an alerting handler
+func NewHandler(alerter *Alerter) *Handler {
+	return &Handler{alerter: alerter}
+}
+
+// RegisterRoutes mounts the alerting endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/alerts", h.recent)
+	rg.GET("/alerts/rules", h.listRules)
+	rg.PUT("/alerts/rules/:name", h.setRule)
+	rg.DELETE("/alerts/rules/:name", h.deleteRule)
+	rg.GET("/alerts/silences", h.listSilences)
+	rg.POST("/alerts/silences", h.silence)
+	rg.DELETE("/alerts/silences", h.unsilence)
+}
+
+func (h *Handler) recent(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.alerter.Recent()})
+}
+
+func (h *Handler) listRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.alerter.Rules()})
+}
+
+func (h *Handler) setRule(c *gin.Context) {
+	var rule Rule
+	if err := bind.JSON(c, &rule); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid alert rule", err))
+		return
+	}
+	rule.Name = c.Param("name")
+	if err := h.alerter.SetRule(rule); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid alert rule", err))
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) deleteRule(c *gin.Context) {
+	if !h.alerter.DeleteRule(c.Param("name")) {
+		c.Error(apperrors.NewNotFoundError("Alert rule not found"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) listSilences(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.alerter.Silences()})
+}
+
+type silenceRequest struct {
+	Rule     string   `json:"rule"` // Every rule when empty
+	Duration Duration `json:"duration" binding:"required"`
+	Reason   string   `json:"reason"`
+}
+
+func (h *Handler) silence(c *gin.Context) {
+	var req silenceRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid silence", err))
+		return
+	}
+	s := Silence{Rule: req.Rule, Until: time.Now().UTC().Add(time.Duration(req.Duration)), Reason: req.Reason}
+	h.alerter.Silence(s)
+	c.JSON(http.StatusCreated, s)
+}
+
+// unsilence ends the silences for ?rule=, or the ones covering every rule
+func (h *Handler) unsilence(c *gin.Context) {
+	if !h.alerter.Unsilence(c.Query("rule")) {
+		c.Error(apperrors.NewNotFoundError("Silence not found"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// maxStackLength keeps sample stacks within the services' message limits
+const maxStackLength = 2000
+
+// Slack posts alerts to an incoming webhook
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlack creates a notifier posting to the Slack incoming webhook at url
+func NewSlack(url string) *Slack {
+	return &Slack{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *Slack) Name() string { return "slack" }
+
+func (s *Slack) Notify(ctx context.Context, a Alert) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, ":rotating_light: *%s*", a.Summary())
+	if len(a.RequestIDs) > 0 {
+		fmt.Fprintf(&text, "\nRequest IDs: `%s`", strings.Join(a.RequestIDs, "`, `"))
+	}
+	if a.Fingerprint != "" {
+		fmt.Fprintf(&text, "\nFingerprint: `%s`", a.Fingerprint)
+	}
+	if a.Stack != "" {
+		fmt.Fprintf(&text, "\n```%s```", truncate(a.Stack, maxStackLength))
+	}
+	return post(ctx, s.client, s.url, map[string]string{"text": text.String()})
+}
+
+// PagerDuty triggers incidents through the Events API v2. Alerts for the same rule
+// share a dedup key, so repeats update the open incident instead of paging again.
+type PagerDuty struct {
+	routingKey string
+	url        string
+	client     *http.Client
+}
+
+// NewPagerDuty creates a notifier for the integration with routingKey
+func NewPagerDuty(routingKey string) *PagerDuty {
+	return &PagerDuty{routingKey: routingKey, url: pagerDutyEventsURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *PagerDuty) Name() string { return "pagerduty" }
+
+func (p *PagerDuty) Notify(ctx context.Context, a Alert) error {
+	details := map[string]any{
+		"count":      a.Count,
+		"total":      a.Total,
+		"window":     a.Window,
+		"requestIds": a.RequestIDs,
+	}
+	if a.Fingerprint != "" {
+		details["fingerprint"] = a.Fingerprint
+	}
+	if a.Stack != "" {
+		details["stack"] = truncate(a.Stack, maxStackLength)
+	}
+	return post(ctx, p.client, p.url, map[string]any{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    "go-api:" + a.Rule,
+		"payload": map[string]any{
+			"summary":        a.Summary(),
+			"source":         "go-api",
+			"severity":       "error",
+			"timestamp":      a.FiredAt.Format(time.RFC3339),
+			"custom_details": details,
+		},
+	})
+}
+
+func post(ctx context.Context, client *http.Client, url string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
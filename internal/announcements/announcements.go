@@ -0,0 +1,186 @@
+// Package announcements is the feature module publishing system announcements,
+// like maintenance windows and incidents, for clients to show as banners. Admins
+// schedule them with a severity and optionally target tenants; clients fetch
+// the active ones or follow them through a server-sent events stream.
+package announcements
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config holds announcements configuration
+type Config struct {
+	Store         string        `yaml:"store"`         // memory or sql; the database by default
+	PollInterval  time.Duration `yaml:"pollInterval"`  // How often streams pick up changes made on other instances and schedules
+	Heartbeat     time.Duration `yaml:"heartbeat"`     // Of streams, so proxies keep them open
+	StreamTimeout time.Duration `yaml:"streamTimeout"` // After which streams end and clients reconnect
+}
+
+// Kinds of announcements
+const (
+	KindMaintenance = "maintenance"
+	KindIncident    = "incident"
+	KindNotice      = "notice"
+)
+
+// Severities of announcements, from the least to the most severe
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Announcement is a message shown to the clients of the targeted tenants from
+// StartsAt until EndsAt
+type Announcement struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`     // maintenance, incident or notice
+	Severity    string     `json:"severity"` // info, warning or critical
+	Title       string     `json:"title"`
+	Message     string     `json:"message"`
+	Link        string     `json:"link,omitempty"`    // A status page or details
+	Tenants     []string   `json:"tenants,omitempty"` // Shown to every tenant when empty
+	StartsAt    time.Time  `json:"startsAt"`
+	EndsAt      *time.Time `json:"endsAt,omitempty"`      // Shown until deleted when nil
+	WindowStart *time.Time `json:"windowStart,omitempty"` // Of the maintenance or incident, announced ahead of it
+	WindowEnd   *time.Time `json:"windowEnd,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// Active reports whether a is shown at now to tenantID, empty for requests of
+// no tenant, which only see announcements to everyone
+func (a Announcement) Active(tenantID string, now time.Time) bool {
+	if now.Before(a.StartsAt) || (a.EndsAt != nil && !now.Before(*a.EndsAt)) {
+		return false
+	}
+	return len(a.Tenants) == 0 || (tenantID != "" && slices.Contains(a.Tenants, tenantID))
+}
+
+var severityRank = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityCritical: 2}
+
+// active returns the announcements of list shown at now to tenantID, the most
+// severe first, then the latest
+func active(list []Announcement, tenantID string, now time.Time) []Announcement {
+	shown := []Announcement{}
+	for _, a := range list {
+		if a.Active(tenantID, now) {
+			shown = append(shown, a)
+		}
+	}
+	sort.SliceStable(shown, func(i, j int) bool {
+		if ri, rj := severityRank[shown[i].Severity], severityRank[shown[j].Severity]; ri != rj {
+			return ri > rj
+		}
+		return shown[i].StartsAt.After(shown[j].StartsAt)
+	})
+	return shown
+}
+
+type announcementsModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+
+	mu      sync.Mutex
+	all     []Announcement // As last read from the store
+	changed chan struct{}  // Closed and replaced on each read, waking the streams
+	stopped chan struct{}  // Closed on shutdown, ending the streams
+}
+
+// New returns the factory of the announcements module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if cfg.PollInterval <= 0 {
+			cfg.PollInterval = 5 * time.Second
+		}
+		if cfg.Heartbeat <= 0 {
+			cfg.Heartbeat = 15 * time.Second
+		}
+		if cfg.StreamTimeout <= 0 {
+			cfg.StreamTimeout = 10 * time.Minute
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("announcements: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("announcements: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &announcementsModule{cfg: cfg, backend: backend, store: store,
+			changed: make(chan struct{}), stopped: make(chan struct{})}, nil
+	}
+}
+
+func (m *announcementsModule) Name() string { return "announcements" }
+
+func (m *announcementsModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// Run reads the announcements each poll interval, waking the streams so they
+// send what started, ended or was changed on another instance, until ctx is
+// cancelled
+func (m *announcementsModule) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	defer close(m.stopped)
+	for {
+		if err := m.refresh(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("failed to read announcements", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh reads every announcement and wakes the streams
+func (m *announcementsModule) refresh(ctx context.Context) error {
+	list, err := m.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.all = list
+	close(m.changed)
+	m.changed = make(chan struct{})
+	return nil
+}
+
+// snapshot returns the announcements last read and a channel closed on the next read
+func (m *announcementsModule) snapshot() ([]Announcement, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.all, m.changed
+}
+
+// changedLocally reads the announcements again after an admin change, so the
+// streams of this instance send it right away. Streams on other instances get it
+// on their next poll.
+func (m *announcementsModule) changedLocally(ctx context.Context) {
+	if err := m.refresh(ctx); err != nil {
+		logger.Error("failed to read announcements", zap.Error(err))
+	}
+}
@@ -0,0 +1,172 @@
+package announcements
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Routes mounts the endpoints clients read the announcements for their tenant from
+func (m *announcementsModule) Routes(api *apiversion.Group) {
+	tags := []string{"announcements"}
+	api.GET("/announcements", apiversion.Operation{
+		ID:          "listAnnouncements",
+		Summary:     "List the active announcements",
+		Description: "Lists the announcements shown to the tenant of the request right now, the most severe first.",
+		Tags:        tags,
+		Response:    []Announcement{},
+	}, m.listActive)
+	api.GET("/announcements/stream", apiversion.Operation{
+		ID:          "streamAnnouncements",
+		Summary:     "Follow the active announcements",
+		Description: "A server-sent events stream sending the active announcements as announcement events, then each one that starts or changes, and an expired event with the ID of each one no longer shown. The stream ends after a while; clients reconnect.",
+		Tags:        tags,
+		Response:    Announcement{},
+		Events: []apiversion.Event{
+			{Name: "announcement", Summary: "An announcement shown now, new to the stream or changed", Data: Announcement{}},
+			{Name: "expired", Summary: "An announcement no longer shown", Data: struct {
+				ID string `json:"id"`
+			}{}},
+		},
+	}, m.stream)
+}
+
+// AdminRoutes mounts the publishing of announcements on the admin group
+func (m *announcementsModule) AdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/announcements", m.list)
+	rg.POST("/announcements", m.create)
+	rg.GET("/announcements/:id", m.get)
+	rg.PUT("/announcements/:id", m.update)
+	rg.DELETE("/announcements/:id", m.delete)
+}
+
+func (m *announcementsModule) listActive(c *gin.Context) {
+	list, err := m.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	tenantID, _ := tenant.FromContext(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"data": active(list, tenantID, time.Now())})
+}
+
+func (m *announcementsModule) list(c *gin.Context) {
+	list, err := m.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (m *announcementsModule) get(c *gin.Context) {
+	a, err := m.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+type announcementRequest struct {
+	Kind        string     `json:"kind" binding:"required,oneof=maintenance incident notice"`
+	Severity    string     `json:"severity" binding:"required,oneof=info warning critical"`
+	Title       string     `json:"title" binding:"required,max=200"`
+	Message     string     `json:"message" binding:"required,max=2000"`
+	Link        string     `json:"link" binding:"omitempty,url"`
+	Tenants     []string   `json:"tenants" binding:"omitempty,max=1000,dive,required"`
+	StartsAt    *time.Time `json:"startsAt"` // Right away, or kept on updates, when omitted
+	EndsAt      *time.Time `json:"endsAt"`
+	WindowStart *time.Time `json:"windowStart"`
+	WindowEnd   *time.Time `json:"windowEnd"`
+}
+
+// bindAnnouncement binds the request onto a, checking the times are in order
+func bindAnnouncement(c *gin.Context, a *Announcement) bool {
+	var req announcementRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid announcement", err))
+		return false
+	}
+	now := time.Now().UTC()
+	a.Kind, a.Severity, a.Title, a.Message, a.Link, a.Tenants = req.Kind, req.Severity, req.Title, req.Message, req.Link, req.Tenants
+	a.EndsAt, a.WindowStart, a.WindowEnd = utc(req.EndsAt), utc(req.WindowStart), utc(req.WindowEnd)
+	if req.StartsAt != nil {
+		a.StartsAt = req.StartsAt.UTC()
+	} else if a.StartsAt.IsZero() {
+		a.StartsAt = now
+	}
+	a.UpdatedAt = now
+	if a.EndsAt != nil && !a.EndsAt.After(a.StartsAt) {
+		c.Error(apperrors.NewValidationError("Invalid announcement", apperrors.FieldError{
+			Field: "endsAt", Rule: "gtfield", Param: "startsAt", Message: "endsAt must be after startsAt",
+		}))
+		return false
+	}
+	if a.WindowEnd != nil && (a.WindowStart == nil || !a.WindowEnd.After(*a.WindowStart)) {
+		c.Error(apperrors.NewValidationError("Invalid announcement", apperrors.FieldError{
+			Field: "windowEnd", Rule: "gtfield", Param: "windowStart", Message: "windowEnd must be after windowStart",
+		}))
+		return false
+	}
+	return true
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// create publishes an announcement, sent to the streams of this instance right away
+func (m *announcementsModule) create(c *gin.Context) {
+	a := Announcement{ID: uuid.New().String()}
+	if !bindAnnouncement(c, &a) {
+		return
+	}
+	a.CreatedAt = a.UpdatedAt
+	if err := m.store.Save(c.Request.Context(), a); err != nil {
+		c.Error(err)
+		return
+	}
+	m.changedLocally(c.Request.Context())
+	c.JSON(http.StatusCreated, a)
+}
+
+// update replaces an announcement, ending it early with an endsAt of now
+func (m *announcementsModule) update(c *gin.Context) {
+	ctx := c.Request.Context()
+	a, err := m.store.Get(ctx, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !bindAnnouncement(c, &a) {
+		return
+	}
+	if err := m.store.Save(ctx, a); err != nil {
+		c.Error(err)
+		return
+	}
+	m.changedLocally(ctx)
+	c.JSON(http.StatusOK, a)
+}
+
+func (m *announcementsModule) delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	if err := m.store.Delete(ctx, c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	m.changedLocally(ctx)
+	c.Status(http.StatusNoContent)
+}
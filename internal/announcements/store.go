@@ -0,0 +1,154 @@
+package announcements
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"go-api/internal/module"
+	apperrors "go-api/pkg/errors"
+)
+
+// Store persists announcements
+type Store interface {
+	// List lists every announcement, the latest starting first
+	List(ctx context.Context) ([]Announcement, error)
+	Get(ctx context.Context, id string) (Announcement, error)
+	Save(ctx context.Context, a Announcement) error
+	Delete(ctx context.Context, id string) error
+}
+
+var errAnnouncementNotFound = apperrors.NewNotFoundError("Announcement not found")
+
+// MemoryStore keeps announcements in memory, used when no database is configured
+type MemoryStore struct {
+	mu            sync.Mutex
+	announcements map[string]Announcement
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{announcements: make(map[string]Announcement)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Announcement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Announcement, 0, len(s.announcements))
+	for _, a := range s.announcements {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartsAt.After(list[j].StartsAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Announcement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.announcements[id]
+	if !ok {
+		return Announcement{}, errAnnouncementNotFound
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, a Announcement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.announcements[a.ID] = a
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.announcements[id]; !ok {
+		return errAnnouncementNotFound
+	}
+	delete(s.announcements, id)
+	return nil
+}
+
+// migrations create the announcements table, with the announcements as JSON in data
+var migrations = []module.Migration{{
+	Name: "create_announcements",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS announcements (
+			id         TEXT PRIMARY KEY,
+			starts_at  TIMESTAMP NOT NULL,
+			data       TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`,
+}}
+
+// SQLStore persists announcements in the announcements table of the shared
+// database, as they target tenants rather than belong to one
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Announcement, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM announcements ORDER BY starts_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Announcement{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var a Announcement
+		if err := json.Unmarshal([]byte(data), &a); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Announcement, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM announcements WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Announcement{}, errAnnouncementNotFound
+	}
+	if err != nil {
+		return Announcement{}, err
+	}
+	var a Announcement
+	return a, json.Unmarshal([]byte(data), &a)
+}
+
+func (s *SQLStore) Save(ctx context.Context, a Announcement) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO announcements (id, starts_at, data, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET starts_at = EXCLUDED.starts_at, data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+		a.ID, a.StartsAt, string(data), a.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM announcements WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errAnnouncementNotFound
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package announcements
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go-api/pkg/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stream sends the active announcements of the request's tenant as server-sent
+// events, then what changes each time the announcements are read again. The stream
+// ends with the request, on shutdown or after StreamTimeout, so instances drain.
+func (m *announcementsModule) stream(c *gin.Context) {
+	ctx := c.Request.Context()
+	tenantID, _ := tenant.FromContext(ctx)
+	// Waiting on the channel from before the first read, so no change is missed
+	_, changed := m.snapshot()
+	list, err := m.store.List(ctx)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // Or nginx buffers the events
+	c.Status(http.StatusOK)
+
+	s := &streamer{w: c.Writer, tenantID: tenantID, sent: map[string]time.Time{}}
+	if s.send(list, time.Now()) != nil {
+		return
+	}
+	heartbeat := time.NewTicker(m.cfg.Heartbeat)
+	defer heartbeat.Stop()
+	timeout := time.NewTimer(m.cfg.StreamTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopped:
+			return
+		case <-timeout.C:
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-changed:
+			list, changed = m.snapshot()
+			if s.send(list, time.Now()) != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamer tracks what a stream has sent
+type streamer struct {
+	w        gin.ResponseWriter
+	tenantID string
+	sent     map[string]time.Time // Update times of the announcements shown, by ID
+}
+
+// send sends the announcements of list active at now that are new to the stream
+// or changed, and expires those no longer active
+func (s *streamer) send(list []Announcement, now time.Time) error {
+	shown := active(list, s.tenantID, now)
+	ids := make(map[string]bool, len(shown))
+	// Least severe first, so clients showing the last one received show the most severe
+	for i := len(shown) - 1; i >= 0; i-- {
+		a := shown[i]
+		ids[a.ID] = true
+		if updated, ok := s.sent[a.ID]; ok && updated.Equal(a.UpdatedAt) {
+			continue
+		}
+		if err := s.event("announcement", a.ID, a); err != nil {
+			return err
+		}
+		s.sent[a.ID] = a.UpdatedAt
+	}
+	for id := range s.sent {
+		if ids[id] {
+			continue
+		}
+		if err := s.event("expired", id, gin.H{"id": id}); err != nil {
+			return err
+		}
+		delete(s.sent, id)
+	}
+	s.w.Flush()
+	return nil
+}
+
+func (s *streamer) event(name, id string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "event: %s\nid: %s\ndata: %s\n\n", name, id, raw)
+	return err
+}
@@ -0,0 +1,247 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retention"
+
+	"github.com/google/uuid"
+)
+
+// tokenPrefix makes keys recognisable in logs and secret scanners
+const tokenPrefix = "gak_"
+
+// Key is an issued API key. Only the SHA-256 hash of the token is stored.
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // First characters of the token, for identification
+	Tenant     string     `json:"tenant,omitempty"`
+	Plan       string     `json:"plan,omitempty"`
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// Active reports whether the key has not been revoked
+func (k Key) Active() bool {
+	return k.RevokedAt == nil
+}
+
+// Store persists API keys
+type Store interface {
+	Create(ctx context.Context, k Key) error
+	List(ctx context.Context) ([]Key, error)
+	FindByHash(ctx context.Context, hash string) (Key, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+// Generate creates a new key and returns it together with the plaintext token,
+// which is never stored and can't be recovered later
+func Generate(name, tenant, plan string) (Key, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, "", err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return Key{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    token[:len(tokenPrefix)+6],
+		Tenant:    tenant,
+		Plan:      plan,
+		Hash:      HashToken(token),
+		CreatedAt: time.Now().UTC(),
+	}, token, nil
+}
+
+// HashToken returns the stored representation of a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the active key for a plaintext token
+func Lookup(ctx context.Context, store Store, token string) (Key, error) {
+	k, err := store.FindByHash(ctx, HashToken(token))
+	if err != nil {
+		return Key{}, err
+	}
+	if !k.Active() {
+		return Key{}, apperrors.NewUnauthorizedError("API key has been revoked")
+	}
+	return k, nil
+}
+
+var errKeyNotFound = apperrors.NewNotFoundError("API key not found")
+
+// MemoryStore keeps API keys in memory, used when no database is configured
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]Key)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, k Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) FindByHash(ctx context.Context, hash string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, k := range s.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return Key{}, errKeyNotFound
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return errKeyNotFound
+	}
+	now := time.Now().UTC()
+	k.RevokedAt = &now
+	s.keys[id] = k
+	return nil
+}
+
+// SQLStore persists API keys in the api_keys table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the api_keys table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id           TEXT PRIMARY KEY,
+			name         TEXT NOT NULL,
+			prefix       TEXT NOT NULL,
+			tenant       TEXT NOT NULL DEFAULT '',
+			plan         TEXT NOT NULL DEFAULT '',
+			hash         TEXT NOT NULL UNIQUE,
+			created_at   TIMESTAMP NOT NULL,
+			revoked_at   TIMESTAMP NULL,
+			last_used_at TIMESTAMP NULL
+		)`)
+	return err
+}
+
+const selectKeys = `SELECT id, name, prefix, tenant, plan, hash, created_at, revoked_at, last_used_at FROM api_keys`
+
+func (s *SQLStore) Create(ctx context.Context, k Key) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, name, prefix, tenant, plan, hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		k.ID, k.Name, k.Prefix, k.Tenant, k.Plan, k.Hash, k.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, selectKeys+` ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Key
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) FindByHash(ctx context.Context, hash string) (Key, error) {
+	k, err := scanKey(s.db.QueryRowContext(ctx, selectKeys+` WHERE hash = $1`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, errKeyNotFound
+	}
+	return k, err
+}
+
+func (s *SQLStore) Revoke(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errKeyNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanKey(row scanner) (Key, error) {
+	var k Key
+	var revokedAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Tenant, &k.Plan, &k.Hash, &k.CreatedAt, &revokedAt, &lastUsedAt); err != nil {
+		return Key{}, err
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	return k, nil
+}
+
+// RetentionPolicies drops revoked keys after they've been kept for auditing
+func (s *SQLStore) RetentionPolicies() []retention.Policy {
+	return []retention.Policy{{
+		Name:        "api_keys_revoked",
+		Description: "Revoked API keys",
+		MaxAge:      90 * 24 * time.Hour,
+		Target:      retention.SQLTable{DB: s.db, Table: "api_keys", TimeColumn: "revoked_at", Where: "revoked_at IS NOT NULL"},
+	}}
+}
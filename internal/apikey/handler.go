@@ -0,0 +1,71 @@
+package apikey
+
+import (
+	"net/http"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for managing API keys
+type Handler struct {
+	store Store
+}
+
+// NewHandler creates an API key handler
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// RegisterRoutes mounts the API key endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/api-keys", h.list)
+	rg.POST("/api-keys", h.create)
+	rg.DELETE("/api-keys/:id", h.revoke)
+}
+
+type createRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Tenant string `json:"tenant"`
+	Plan   string `json:"plan"`
+}
+
+func (h *Handler) list(c *gin.Context) {
+	keys, err := h.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var req createRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid API key request", err))
+		return
+	}
+
+	key, token, err := Generate(req.Name, req.Tenant, req.Plan)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.store.Create(c.Request.Context(), key); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The token is only ever returned here
+	c.JSON(http.StatusCreated, gin.H{"key": key, "token": token})
+}
+
+func (h *Handler) revoke(c *gin.Context) {
+	if err := h.store.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
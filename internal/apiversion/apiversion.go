@@ -0,0 +1,333 @@
+// Package apiversion routes public API requests to a version, either from the path
+// (/api/v1/...) or, for unversioned paths, from the API-Version header or a vendor
+// media type in Accept. Versions and single operations can be deprecated, which adds
+// Deprecation and Sunset headers, and each version serves its own OpenAPI document,
+// and an AsyncAPI document of its streams and of the channels events are published on.
+// A Tracker records which clients of which API keys call what, so deprecated
+// operations can be sunset once nobody depends on them anymore.
+package apiversion
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/cost"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds API versioning configuration
+type Config struct {
+	Prefix    string `yaml:"prefix"`    // Path the versions are mounted under
+	Default   string `yaml:"default"`   // Version for unversioned requests that don't ask for one
+	Header    string `yaml:"header"`    // Request header naming the version
+	MediaType string `yaml:"mediaType"` // Vendor type in Accept, e.g. application/vnd.go-api.v2+json
+	// Deprecations of operations by ID, or by method and path as in "GET /users/:id",
+	// replacing those in code, so endpoints can be deprecated and sunset per deployment
+	Deprecations        map[string]Deprecation `yaml:"deprecations"`
+	ClientVersionHeader string                 `yaml:"clientVersionHeader"` // Request header with the client's version, tracked with its User-Agent
+	UsageFlushInterval  time.Duration          `yaml:"usageFlushInterval"`  // How often tracked usage is written to the store
+}
+
+// Version is a major API version
+type Version struct {
+	Name        string       // Path segment, e.g. "v1"
+	Title       string       // Shown in the OpenAPI document
+	Deprecation *Deprecation // Set once every operation of the version is deprecated
+}
+
+type route struct {
+	method string
+	path   string
+	op     Operation
+}
+
+// Group registers the routes of one version
+type Group struct {
+	version Version
+	rg      *gin.RouterGroup
+	reg     *Registry
+
+	mu      sync.Mutex
+	routes  []route
+	byRoute map[string]int // Index of routes by method and full path, as gin matched it
+}
+
+// Registry holds the versions served under the prefix
+type Registry struct {
+	cfg Config
+
+	mu       sync.RWMutex
+	versions map[string]*Group
+	order    []string
+	root     *gin.RouterGroup
+	tracker  *Tracker
+	channels []ChannelDeclarer
+
+	mediaType *regexp.Regexp // Captures the version from the Accept header
+}
+
+// New creates a registry mounting versions under cfg.Prefix on r, and serves the list
+// of versions at the prefix itself
+func New(r *gin.Engine, cfg Config) *Registry {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "/api"
+	}
+	if cfg.Header == "" {
+		cfg.Header = "API-Version"
+	}
+	reg := &Registry{cfg: cfg, versions: make(map[string]*Group), root: r.Group(cfg.Prefix)}
+	if cfg.MediaType != "" {
+		reg.mediaType = regexp.MustCompile(regexp.QuoteMeta(cfg.MediaType) + `\.([A-Za-z0-9]+)`)
+	}
+	reg.root.GET("", reg.list)
+	return reg
+}
+
+// Version mounts a version and returns the group its handlers register on
+func (reg *Registry) Version(v Version) *Group {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	g := &Group{version: v, reg: reg, byRoute: make(map[string]int)}
+	g.rg = reg.root.Group("/"+v.Name, g.headers)
+	g.rg.GET("/openapi.json", g.openAPI(reg.cfg.Prefix))
+	g.rg.GET("/asyncapi.json", g.asyncAPI)
+
+	reg.versions[v.Name] = g
+	reg.order = append(reg.order, v.Name)
+	return g
+}
+
+// Track records the usage of every version's operations with t, which has to be
+// set before the versions are served
+func (reg *Registry) Track(t *Tracker) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.tracker = t
+}
+
+func (g *Group) headers(c *gin.Context) {
+	c.Header("API-Version", g.version.Name)
+	if t := g.reg.tracker; t != nil {
+		name, deprecated := g.operation(c.Request.Method, c.FullPath())
+		t.Record(c.Request, g.version.Name, name, deprecated || g.version.Deprecation != nil)
+	}
+	if g.version.Deprecation != nil && !g.version.Deprecation.apply(c) {
+		return
+	}
+	c.Next()
+}
+
+// Operation describes a route for the OpenAPI document
+type Operation struct {
+	ID          string // operationId, used as the method name in generated clients
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecation *Deprecation // Marks just this operation deprecated
+	// Idempotency is how safe retrying it is; the one implied by the method when empty
+	Idempotency retrysafe.Class
+	// Cost is what calling it spends of the client's budget; the default when 0
+	Cost int64
+	// Request and Response are zero values of the JSON body types, described from
+	// their fields and json tags. Either may be nil for operations without a body.
+	Request  any
+	Response any
+	// Events are the messages of a streaming operation, documented as a channel of
+	// the AsyncAPI document
+	Events []Event
+}
+
+// Handle registers a route on the version. A deprecated operation, in code or in
+// the configuration, gets the deprecation headers in front of its handlers.
+func (g *Group) Handle(method, path string, op Operation, handlers ...gin.HandlerFunc) {
+	if d, ok := g.reg.cfg.Deprecations[op.ID]; ok && op.ID != "" {
+		op.Deprecation = &d
+	} else if d, ok := g.reg.cfg.Deprecations[method+" "+path]; ok {
+		op.Deprecation = &d
+	}
+	if op.Deprecation != nil {
+		handlers = append([]gin.HandlerFunc{Deprecated(*op.Deprecation)}, handlers...)
+	}
+	g.rg.Handle(method, path, handlers...)
+	if op.Idempotency != "" {
+		retrysafe.Declare(method, joinPath(g.rg.BasePath(), path), op.Idempotency)
+	}
+	if op.Cost > 0 {
+		cost.Declare(method, joinPath(g.rg.BasePath(), path), op.Cost)
+	}
+
+	g.mu.Lock()
+	g.routes = append(g.routes, route{method: method, path: path, op: op})
+	g.byRoute[method+" "+joinPath(g.rg.BasePath(), path)] = len(g.routes) - 1
+	g.mu.Unlock()
+}
+
+// operation names the route gin matched, by its operation ID or method and path,
+// and reports whether it is deprecated
+func (g *Group) operation(method, fullPath string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	i, ok := g.byRoute[method+" "+fullPath]
+	if !ok {
+		return method + " " + strings.TrimPrefix(fullPath, g.rg.BasePath()), false
+	}
+	rt := g.routes[i]
+	return rt.name(), rt.op.Deprecation != nil
+}
+
+func (rt route) name() string {
+	if rt.op.ID != "" {
+		return rt.op.ID
+	}
+	return rt.method + " " + rt.path
+}
+
+// joinPath joins a group's base path and a relative path like gin does
+func joinPath(base, rel string) string {
+	if rel == "" {
+		return base
+	}
+	joined := path.Join(base, rel)
+	if strings.HasSuffix(rel, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// Use adds middleware in front of the handlers of the routes registered after it
+func (g *Group) Use(handlers ...gin.HandlerFunc) {
+	g.rg.Use(handlers...)
+}
+
+// BasePath is the path the version's routes are mounted under, like /api/v1
+func (g *Group) BasePath() string {
+	return g.rg.BasePath()
+}
+
+func (g *Group) GET(path string, op Operation, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodGet, path, op, handlers...)
+}
+
+func (g *Group) POST(path string, op Operation, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPost, path, op, handlers...)
+}
+
+func (g *Group) PUT(path string, op Operation, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPut, path, op, handlers...)
+}
+
+func (g *Group) PATCH(path string, op Operation, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPatch, path, op, handlers...)
+}
+
+func (g *Group) DELETE(path string, op Operation, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodDelete, path, op, handlers...)
+}
+
+type versionInfo struct {
+	Name       string     `json:"name"`
+	Default    bool       `json:"default"`
+	Deprecated bool       `json:"deprecated"`
+	Sunset     *time.Time `json:"sunset,omitempty"`
+	OpenAPI    string     `json:"openapi"`
+	AsyncAPI   string     `json:"asyncapi"`
+}
+
+func (reg *Registry) list(c *gin.Context) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	list := make([]versionInfo, 0, len(reg.order))
+	for _, name := range reg.order {
+		info := versionInfo{
+			Name:     name,
+			Default:  name == reg.cfg.Default,
+			OpenAPI:  reg.cfg.Prefix + "/" + name + "/openapi.json",
+			AsyncAPI: reg.cfg.Prefix + "/" + name + "/asyncapi.json",
+		}
+		if d := reg.versions[name].version.Deprecation; d != nil {
+			info.Deprecated = true
+			if !d.Sunset.IsZero() {
+				info.Sunset = &d.Sunset
+			}
+		}
+		list = append(list, info)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// requested returns the version asked for by the request headers, if any
+func (reg *Registry) requested(req *http.Request) string {
+	if v := strings.TrimSpace(req.Header.Get(reg.cfg.Header)); v != "" {
+		return v
+	}
+	if reg.mediaType == nil {
+		return ""
+	}
+	if m := reg.mediaType.FindStringSubmatch(req.Header.Get("Accept")); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Negotiate wraps the router so unversioned paths under the prefix are served by the
+// version the client asks for, or the default version. It rewrites the path before
+// routing, so it has to wrap the whole router like the rate limiter does.
+func (reg *Registry) Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rest, ok := strings.CutPrefix(req.URL.Path, reg.cfg.Prefix+"/")
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		reg.mu.RLock()
+		segment, _, _ := strings.Cut(rest, "/")
+		_, versioned := reg.versions[segment]
+		requested := reg.requested(req)
+		_, known := reg.versions[requested]
+		reg.mu.RUnlock()
+
+		if versioned {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		version := reg.cfg.Default
+		if requested != "" {
+			if !known {
+				writeError(w, apperrors.NewValidationError("unsupported API version", apperrors.FieldError{
+					Field:   "version",
+					Rule:    "supported",
+					Message: "API version " + requested + " is not supported",
+					Param:   requested,
+				}))
+				return
+			}
+			version = requested
+		}
+		w.Header().Add("Vary", reg.cfg.Header)
+		w.Header().Add("Vary", "Accept")
+
+		req.URL.Path = reg.cfg.Prefix + "/" + version + "/" + rest
+		req.URL.RawPath = ""
+		next.ServeHTTP(w, req)
+	})
+}
+
+// writeError renders an AppError the way the error middleware does, for responses
+// written before gin is reached
+func writeError(w http.ResponseWriter, err *apperrors.AppError) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err.StatusCode)
+	json.NewEncoder(w).Encode(err)
+}
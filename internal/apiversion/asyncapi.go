@@ -0,0 +1,224 @@
+package apiversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go-api/pkg/eventschema"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Event is a message a streaming operation sends, like a server-sent event
+type Event struct {
+	Name    string // Event name on the stream
+	Summary string
+	// Data is a zero value of the JSON type of the event data, described from its
+	// fields and json tags
+	Data any
+}
+
+// Channel is where the API publishes messages outside of its routes, like domain
+// events or webhooks, documented in the AsyncAPI document of every version
+type Channel struct {
+	ID          string
+	Address     string // Empty when subscribers choose it, like a webhook URL
+	Title       string
+	Description string
+	Messages    []Message
+}
+
+// Message is a kind of message published on a channel
+type Message struct {
+	Name        string
+	Summary     string
+	ContentType string            // application/json when empty
+	Headers     map[string]string // Descriptions by header name
+	Payload     json.RawMessage   // JSON Schema of the body
+}
+
+// ChannelDeclarer is implemented by what publishes on channels
+type ChannelDeclarer interface {
+	Channels() []Channel
+}
+
+// ChannelFunc declares the channels it returns
+type ChannelFunc func() []Channel
+
+func (f ChannelFunc) Channels() []Channel { return f() }
+
+// Publish adds channels to the AsyncAPI documents. Declarers are asked for their
+// channels each time a document is generated.
+func (reg *Registry) Publish(declarers ...ChannelDeclarer) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.channels = append(reg.channels, declarers...)
+}
+
+// EventChannels declares a channel per domain event with a schema, named after
+// the event type, carrying the latest version of its schema
+func EventChannels(schemas *eventschema.Registry) ChannelDeclarer {
+	return ChannelFunc(func() []Channel {
+		var channels []Channel
+		for _, s := range schemas.List() {
+			latest, err := schemas.Get(s.Event, s.Latest)
+			if err != nil {
+				continue
+			}
+			channels = append(channels, Channel{
+				ID:      s.Event,
+				Address: s.Event,
+				Title:   s.Event,
+				Description: fmt.Sprintf("Domain event appended to the event store; its data matches version %d of "+
+					"its schema, which events carry in their %s metadata.", s.Latest, eventschema.VersionMetadata),
+				Messages: []Message{{Name: s.Event, Summary: s.Description, Payload: latest.Schema}},
+			})
+		}
+		return channels
+	})
+}
+
+// asyncDocument is the subset of AsyncAPI 3.0 generated from the streaming
+// operations of a version and the published channels. Channels have no servers:
+// streams are addressed by their path, and webhooks by the subscriber's URL.
+type asyncDocument struct {
+	AsyncAPI           string                    `json:"asyncapi"`
+	Info               info                      `json:"info"`
+	DefaultContentType string                    `json:"defaultContentType"`
+	Channels           map[string]asyncChannel   `json:"channels"`
+	Operations         map[string]asyncOperation `json:"operations"`
+}
+
+type asyncChannel struct {
+	Address     *string                 `json:"address"` // null when chosen by subscribers
+	Title       string                  `json:"title,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	Parameters  map[string]struct{}     `json:"parameters,omitempty"` // Of the address
+	Messages    map[string]asyncMessage `json:"messages"`
+}
+
+type asyncMessage struct {
+	Name        string          `json:"name"`
+	Summary     string          `json:"summary,omitempty"`
+	ContentType string          `json:"contentType,omitempty"`
+	Headers     json.RawMessage `json:"headers,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+type asyncOperation struct {
+	Action      string         `json:"action"`
+	Channel     ref            `json:"channel"`
+	Summary     string         `json:"summary,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Messages    []ref          `json:"messages"`
+	Bindings    map[string]any `json:"bindings,omitempty"`
+}
+
+type ref struct {
+	Ref string `json:"$ref"`
+}
+
+func (g *Group) asyncDocument() asyncDocument {
+	title := g.version.Title
+	if title == "" {
+		title = "go-api"
+	}
+	doc := asyncDocument{
+		AsyncAPI:           "3.0.0",
+		Info:               info{Title: title, Version: g.version.Name},
+		DefaultContentType: "application/json",
+		Channels:           make(map[string]asyncChannel),
+		Operations:         make(map[string]asyncOperation),
+	}
+
+	g.mu.Lock()
+	routes := append([]route(nil), g.routes...)
+	g.mu.Unlock()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].path < routes[j].path })
+
+	for _, rt := range routes {
+		if len(rt.op.Events) == 0 {
+			continue
+		}
+		id := rt.op.ID
+		if id == "" {
+			id = strings.ToLower(rt.method) + strings.NewReplacer("/", "_", ":", "", "*", "").Replace(rt.path)
+		}
+		address, params := openAPIPath(joinPath(g.rg.BasePath(), rt.path))
+		ch := Channel{ID: id, Address: address, Title: rt.op.Summary, Description: rt.op.Description}
+		for _, e := range rt.op.Events {
+			m := Message{Name: e.Name, Summary: e.Summary}
+			if e.Data != nil {
+				m.Payload = eventschema.From(e.Data)
+			}
+			ch.Messages = append(ch.Messages, m)
+		}
+		addChannel(&doc, ch, rt.op.Summary, map[string]any{"http": map[string]string{"method": rt.method}})
+		for _, name := range params {
+			c := doc.Channels[id]
+			if c.Parameters == nil {
+				c.Parameters = make(map[string]struct{})
+			}
+			c.Parameters[name] = struct{}{}
+			doc.Channels[id] = c
+		}
+	}
+
+	g.reg.mu.RLock()
+	declarers := append([]ChannelDeclarer(nil), g.reg.channels...)
+	g.reg.mu.RUnlock()
+	for _, d := range declarers {
+		for _, ch := range d.Channels() {
+			addChannel(&doc, ch, ch.Title, nil)
+		}
+	}
+	return doc
+}
+
+// addChannel adds a channel and the operation of the API sending its messages
+func addChannel(doc *asyncDocument, ch Channel, summary string, bindings map[string]any) {
+	c := asyncChannel{Title: ch.Title, Description: ch.Description, Messages: make(map[string]asyncMessage)}
+	if ch.Address != "" {
+		c.Address = &ch.Address
+	}
+	op := asyncOperation{Action: "send", Channel: ref{Ref: "#/channels/" + ch.ID}, Summary: summary, Bindings: bindings}
+	for _, m := range ch.Messages {
+		msg := asyncMessage{Name: m.Name, Summary: m.Summary, ContentType: m.ContentType, Payload: m.Payload}
+		if len(m.Headers) > 0 {
+			msg.Headers = headersSchema(m.Headers)
+		}
+		c.Messages[m.Name] = msg
+		op.Messages = append(op.Messages, ref{Ref: "#/channels/" + ch.ID + "/messages/" + m.Name})
+	}
+	doc.Channels[ch.ID] = c
+	doc.Operations[ch.ID] = op
+}
+
+// headersSchema describes headers as an object of strings
+func headersSchema(headers map[string]string) json.RawMessage {
+	properties := make(map[string]any, len(headers))
+	for name, description := range headers {
+		properties[name] = map[string]string{"type": "string", "description": description}
+	}
+	raw, _ := json.Marshal(map[string]any{"type": "object", "properties": properties})
+	return raw
+}
+
+func (g *Group) asyncAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, g.asyncDocument())
+}
+
+// AsyncDocument returns the AsyncAPI document of a version, as served at its
+// asyncapi.json, for generating consumers without a running server
+func (reg *Registry) AsyncDocument(version string) ([]byte, error) {
+	reg.mu.RLock()
+	g, ok := reg.versions[version]
+	reg.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown API version %q", version)
+	}
+	return json.MarshalIndent(g.asyncDocument(), "", "  ")
+}
@@ -0,0 +1,46 @@
+package apiversion
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecation announces that an operation or version is going away
+type Deprecation struct {
+	At     time.Time `json:"at" yaml:"at"`                             // When it was deprecated, sent in the Deprecation header (RFC 9745)
+	Sunset time.Time `json:"sunset,omitempty" yaml:"sunset,omitempty"` // When it stops working, sent in the Sunset header (RFC 8594); zero if not planned
+	Link   string    `json:"link,omitempty" yaml:"link,omitempty"`     // Migration guide, sent as a Link with rel="deprecation"
+}
+
+// apply writes the deprecation headers, or answers 410 Gone once the sunset has
+// passed. It reports whether the request may continue.
+func (d Deprecation) apply(c *gin.Context) bool {
+	if !d.Sunset.IsZero() && time.Now().After(d.Sunset) {
+		c.Error(apperrors.NewGoneError("this API is no longer available"))
+		c.Abort()
+		return false
+	}
+
+	c.Header("Deprecation", "@"+strconv.FormatInt(d.At.Unix(), 10))
+	if !d.Sunset.IsZero() {
+		c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		c.Writer.Header().Add("Link", "<"+d.Link+`>; rel="deprecation"; type="text/html"`)
+	}
+	return true
+}
+
+// Deprecated marks the handlers that follow it as deprecated
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d.apply(c) {
+			c.Next()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package apiversion
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeprecatedOperation is an operation deprecated on its own or with its version,
+// and the clients still calling it
+type DeprecatedOperation struct {
+	Version      string     `json:"version"`
+	Operation    string     `json:"operation"`
+	Method       string     `json:"method"`
+	Path         string     `json:"path"`
+	DeprecatedAt time.Time  `json:"deprecatedAt"`
+	Sunset       *time.Time `json:"sunset,omitempty"`
+	Gone         bool       `json:"gone"` // Answered with 410 since its sunset
+	Link         string     `json:"link,omitempty"`
+	Clients      []Usage    `json:"clients"`
+}
+
+// Deprecated lists the deprecated operations of every version, in the order they
+// were registered
+func (reg *Registry) Deprecated() []DeprecatedOperation {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	list := []DeprecatedOperation{}
+	for _, name := range reg.order {
+		g := reg.versions[name]
+		g.mu.Lock()
+		for _, rt := range g.routes {
+			d := rt.op.Deprecation
+			if d == nil {
+				d = g.version.Deprecation
+			}
+			if d == nil {
+				continue
+			}
+			op := DeprecatedOperation{Version: name, Operation: rt.name(), Method: rt.method, Path: rt.path,
+				DeprecatedAt: d.At, Link: d.Link, Clients: []Usage{}}
+			if !d.Sunset.IsZero() {
+				sunset := d.Sunset
+				op.Sunset = &sunset
+				op.Gone = time.Now().After(sunset)
+			}
+			list = append(list, op)
+		}
+		g.mu.Unlock()
+	}
+	return list
+}
+
+// Handler exposes admin reports of the clients calling the API
+type Handler struct {
+	registry *Registry
+	store    UsageStore
+}
+
+// NewHandler creates a handler reporting the usage in store
+func NewHandler(registry *Registry, store UsageStore) *Handler {
+	return &Handler{registry: registry, store: store}
+}
+
+// RegisterRoutes mounts the reports on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/api-clients", routing.Query("apiKey"), h.clients)
+	rg.GET("/api-deprecations", routing.Query("apiKey"), h.deprecations)
+}
+
+// clients lists the clients seen per API key with their versions, filtered with ?apiKey=
+func (h *Handler) clients(c *gin.Context) {
+	list, err := h.store.List(c.Request.Context(), UsageFilter{APIKey: c.Query("apiKey")})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// deprecations lists the deprecated operations with the clients still calling
+// them, filtered with ?apiKey=
+func (h *Handler) deprecations(c *gin.Context) {
+	usage, err := h.store.List(c.Request.Context(), UsageFilter{APIKey: c.Query("apiKey"), Deprecated: true})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ops := h.registry.Deprecated()
+	index := make(map[string]int, len(ops))
+	for i, op := range ops {
+		index[op.Version+" "+op.Operation] = i
+	}
+	for _, u := range usage {
+		if i, ok := index[u.Version+" "+u.Operation]; ok {
+			ops[i].Clients = append(ops[i].Clients, u)
+		}
+	}
+	if c.Query("apiKey") != "" {
+		// Only the operations the key still calls
+		filtered := ops[:0]
+		for _, op := range ops {
+			if len(op.Clients) > 0 {
+				filtered = append(filtered, op)
+			}
+		}
+		ops = filtered
+	}
+	c.JSON(http.StatusOK, gin.H{"data": ops})
+}
@@ -0,0 +1,11 @@
+package apiversion
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var deprecatedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_deprecated_requests_total",
+	Help: "Requests to deprecated operations, including those answered 410 after their sunset.",
+}, []string{"version", "operation"})
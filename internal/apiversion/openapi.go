@@ -0,0 +1,266 @@
+package apiversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go-api/pkg/cost"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// document is the subset of OpenAPI 3.0 generated from the registered routes
+type document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       info                            `json:"info"`
+	Servers    []server                        `json:"servers"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components *components                     `json:"components,omitempty"`
+}
+
+type info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type server struct {
+	URL string `json:"url"`
+}
+
+type components struct {
+	Schemas map[string]*schema `json:"schemas"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId,omitempty"`
+	Summary     string              `json:"summary,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	Parameters  []parameter         `json:"parameters,omitempty"`
+	RequestBody *requestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+	Idempotency retrysafe.Class     `json:"x-idempotency,omitempty"`
+	Cost        int64               `json:"x-cost"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+// openAPIPath converts gin parameters (:id, *path) to OpenAPI templates ({id}) and
+// returns the parameter names
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, s := range segments {
+		if len(s) > 1 && (s[0] == ':' || s[0] == '*') {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func (g *Group) document(prefix string) document {
+	title := g.version.Title
+	if title == "" {
+		title = "go-api"
+	}
+	doc := document{
+		OpenAPI: "3.0.3",
+		Info:    info{Title: title, Version: g.version.Name},
+		Servers: []server{{URL: prefix + "/" + g.version.Name}},
+		Paths:   make(map[string]map[string]operation),
+	}
+
+	g.mu.Lock()
+	routes := append([]route(nil), g.routes...)
+	g.mu.Unlock()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].path < routes[j].path })
+
+	schemas := make(map[string]*schema)
+	for _, rt := range routes {
+		path, names := openAPIPath(rt.path)
+		op := operation{
+			OperationID: rt.op.ID,
+			Summary:     rt.op.Summary,
+			Description: rt.op.Description,
+			Tags:        rt.op.Tags,
+			Deprecated:  rt.op.Deprecation != nil || g.version.Deprecation != nil,
+			Responses:   map[string]response{"default": {Description: "Response"}},
+			Idempotency: retrysafe.Of(rt.method, joinPath(g.rg.BasePath(), rt.path)),
+			Cost:        cost.Of(rt.method, joinPath(g.rg.BasePath(), rt.path)),
+		}
+		for _, name := range names {
+			op.Parameters = append(op.Parameters, parameter{Name: name, In: "path", Required: true, Schema: &schema{Type: "string"}})
+		}
+		if rt.op.Request != nil {
+			op.RequestBody = &requestBody{
+				Required: true,
+				Content:  map[string]mediaType{"application/json": {Schema: schemaOf(reflect.TypeOf(rt.op.Request), schemas)}},
+			}
+		}
+		if rt.op.Response != nil {
+			op.Responses = map[string]response{"200": {
+				Description: "Success",
+				Content:     map[string]mediaType{"application/json": {Schema: schemaOf(reflect.TypeOf(rt.op.Response), schemas)}},
+			}}
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]operation)
+		}
+		doc.Paths[path][strings.ToLower(rt.method)] = op
+	}
+	if len(schemas) > 0 {
+		doc.Components = &components{Schemas: schemas}
+	}
+	return doc
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+// schemaOf describes how t encodes to JSON. Named structs are added to schemas once
+// and referenced, which also stops recursive types from recursing.
+func schemaOf(t reflect.Type, schemas map[string]*schema) *schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	var s *schema
+	switch {
+	case t == timeType:
+		s = &schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType || t.Kind() == reflect.Interface:
+		s = &schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// Custom encodings can't be inferred from the Go type
+		s = &schema{}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			s = &schema{Type: "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			s = &schema{Type: "integer", Format: "int32"}
+		case reflect.Int64, reflect.Uint64:
+			s = &schema{Type: "integer", Format: "int64"}
+		case reflect.Float32, reflect.Float64:
+			s = &schema{Type: "number"}
+		case reflect.String:
+			s = &schema{Type: "string"}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				s = &schema{Type: "string", Format: "byte"}
+			} else {
+				s = &schema{Type: "array", Items: schemaOf(t.Elem(), schemas)}
+			}
+		case reflect.Map:
+			s = &schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), schemas)}
+		case reflect.Struct:
+			if t.Name() == "" {
+				s = structSchema(t, schemas)
+				break
+			}
+			if _, ok := schemas[t.Name()]; !ok {
+				schemas[t.Name()] = nil // Reserved while the fields are described
+				schemas[t.Name()] = structSchema(t, schemas)
+			}
+			s = &schema{Ref: "#/components/schemas/" + t.Name()}
+		default:
+			s = &schema{}
+		}
+	}
+	// References can't carry siblings in OpenAPI 3.0, so they're never nullable
+	if nullable && s.Ref == "" {
+		s.Nullable = true
+	}
+	return s
+}
+
+func structSchema(t reflect.Type, schemas map[string]*schema) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := structSchema(f.Type, schemas)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = schemaOf(f.Type, schemas)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+func (g *Group) openAPI(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, g.document(prefix))
+	}
+}
+
+// Document returns the OpenAPI document of a version, as served at its
+// openapi.json, for generating clients without a running server
+func (reg *Registry) Document(version string) ([]byte, error) {
+	reg.mu.RLock()
+	g, ok := reg.versions[version]
+	reg.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown API version %q", version)
+	}
+	return json.MarshalIndent(g.document(reg.cfg.Prefix), "", "  ")
+}
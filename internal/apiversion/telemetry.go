@@ -0,0 +1,322 @@
+package apiversion
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Usage is how often one client of an API key called the API. Operation is empty
+// on the totals of a client across every operation; usage of single operations is
+// only kept for deprecated ones.
+type Usage struct {
+	APIKey        string    `json:"apiKey,omitempty"` // ID of the key, "unknown" for invalid ones, empty without one
+	UserAgent     string    `json:"userAgent"`
+	ClientVersion string    `json:"clientVersion,omitempty"`
+	Version       string    `json:"version"`
+	Operation     string    `json:"operation,omitempty"` // ID, or method and path
+	Requests      int64     `json:"requests"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+}
+
+// UsageFilter selects tracked usage
+type UsageFilter struct {
+	APIKey     string // Any when empty
+	Deprecated bool   // Usage of deprecated operations instead of the totals of clients
+}
+
+// UsageStore persists tracked usage
+type UsageStore interface {
+	// Add adds the requests of each usage to the one of the same client and
+	// operation, keeping the earliest first and latest last seen times
+	Add(ctx context.Context, usage []Usage) error
+	List(ctx context.Context, f UsageFilter) ([]Usage, error)
+}
+
+// maxUserAgent bounds the stored User-Agent, which clients choose freely
+const maxUserAgent = 256
+
+// maxPending bounds the usage buffered between flushes; requests of new clients
+// beyond it are not tracked until the next flush
+const maxPending = 10000
+
+type usageKey struct {
+	token, userAgent, clientVersion, version, operation string
+}
+
+// Tracker buffers usage in memory and writes it to a store periodically, so
+// tracking never slows requests down. API keys are identified at flush time,
+// once per key in the buffer.
+type Tracker struct {
+	cfg      Config
+	store    UsageStore
+	identify func(ctx context.Context, token string) (string, error)
+
+	mu      sync.Mutex
+	pending map[usageKey]*Usage
+}
+
+// NewTracker creates a tracker writing to store. identify returns the ID of the
+// API key a token belongs to.
+func NewTracker(cfg Config, store UsageStore, identify func(ctx context.Context, token string) (string, error)) *Tracker {
+	if cfg.ClientVersionHeader == "" {
+		cfg.ClientVersionHeader = "X-Client-Version"
+	}
+	if cfg.UsageFlushInterval <= 0 {
+		cfg.UsageFlushInterval = time.Minute
+	}
+	return &Tracker{cfg: cfg, store: store, identify: identify, pending: make(map[usageKey]*Usage)}
+}
+
+// Record counts a request for the totals of its client, and for the operation
+// when deprecated
+func (t *Tracker) Record(req *http.Request, version, operation string, deprecated bool) {
+	key := usageKey{
+		token:         req.Header.Get("X-API-Key"),
+		userAgent:     truncate(req.UserAgent(), maxUserAgent),
+		clientVersion: truncate(req.Header.Get(t.cfg.ClientVersionHeader), maxUserAgent),
+		version:       version,
+	}
+	now := time.Now().UTC()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(key, now)
+	if deprecated {
+		key.operation = operation
+		t.add(key, now)
+		deprecatedRequests.WithLabelValues(version, operation).Inc()
+	}
+}
+
+func (t *Tracker) add(key usageKey, now time.Time) {
+	u, ok := t.pending[key]
+	if !ok {
+		if len(t.pending) >= maxPending {
+			return
+		}
+		u = &Usage{UserAgent: key.userAgent, ClientVersion: key.clientVersion, Version: key.version,
+			Operation: key.operation, FirstSeen: now}
+		t.pending[key] = u
+	}
+	u.Requests++
+	u.LastSeen = now
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Start flushes the buffered usage each interval until ctx is cancelled, then a
+// last time
+func (t *Tracker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(t.cfg.UsageFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				t.Flush(context.WithoutCancel(ctx))
+				return
+			case <-ticker.C:
+				t.Flush(ctx)
+			}
+		}
+	}()
+}
+
+// Flush writes the buffered usage to the store. Usage that fails to be written is
+// dropped, as counts are only approximate anyway.
+func (t *Tracker) Flush(ctx context.Context) {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[usageKey]*Usage)
+	t.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	keys := map[string]string{}
+	usage := make([]Usage, 0, len(pending))
+	for key, u := range pending {
+		if key.token != "" {
+			id, ok := keys[key.token]
+			if !ok {
+				var err error
+				if id, err = t.identify(ctx, key.token); err != nil || id == "" {
+					id = "unknown"
+				}
+				keys[key.token] = id
+			}
+			u.APIKey = id
+		}
+		usage = append(usage, *u)
+	}
+	// Tokens of one key can't collide, but invalid ones all become "unknown"
+	usage = merge(usage)
+	if err := t.store.Add(ctx, usage); err != nil {
+		logger.Error("failed to write API usage", zap.Int("clients", len(usage)), zap.Error(err))
+	}
+}
+
+// merge adds up usage of the same client and operation
+func merge(usage []Usage) []Usage {
+	type id struct{ apiKey, userAgent, clientVersion, version, operation string }
+	merged := make(map[id]*Usage, len(usage))
+	list := usage[:0]
+	for _, u := range usage {
+		k := id{u.APIKey, u.UserAgent, u.ClientVersion, u.Version, u.Operation}
+		if m, ok := merged[k]; ok {
+			m.Requests += u.Requests
+			m.FirstSeen = minTime(m.FirstSeen, u.FirstSeen)
+			m.LastSeen = maxTime(m.LastSeen, u.LastSeen)
+			continue
+		}
+		list = append(list, u)
+		merged[k] = &list[len(list)-1]
+	}
+	return list
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// MemoryUsageStore keeps usage in memory, used when no database is configured
+type MemoryUsageStore struct {
+	mu    sync.Mutex
+	usage map[[5]string]Usage
+}
+
+// NewMemoryUsageStore creates an empty store
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{usage: make(map[[5]string]Usage)}
+}
+
+func (s *MemoryUsageStore) Add(ctx context.Context, usage []Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range usage {
+		k := [5]string{u.APIKey, u.UserAgent, u.ClientVersion, u.Version, u.Operation}
+		if old, ok := s.usage[k]; ok {
+			u.Requests += old.Requests
+			u.FirstSeen = minTime(old.FirstSeen, u.FirstSeen)
+			u.LastSeen = maxTime(old.LastSeen, u.LastSeen)
+		}
+		s.usage[k] = u
+	}
+	return nil
+}
+
+func (s *MemoryUsageStore) List(ctx context.Context, f UsageFilter) ([]Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Usage{}
+	for _, u := range s.usage {
+		if (f.APIKey == "" || u.APIKey == f.APIKey) && (u.Operation != "") == f.Deprecated {
+			list = append(list, u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+	return list, nil
+}
+
+// SQLUsageStore persists usage in the api_client_usage table
+type SQLUsageStore struct {
+	db *sql.DB
+}
+
+// NewSQLUsageStore creates a store backed by db
+func NewSQLUsageStore(db *sql.DB) *SQLUsageStore {
+	return &SQLUsageStore{db: db}
+}
+
+// EnsureSchema creates the api_client_usage table if it does not exist
+func (s *SQLUsageStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS api_client_usage (
+			api_key        TEXT NOT NULL,
+			user_agent     TEXT NOT NULL,
+			client_version TEXT NOT NULL,
+			api_version    TEXT NOT NULL,
+			operation      TEXT NOT NULL,
+			requests       BIGINT NOT NULL,
+			first_seen     TIMESTAMP NOT NULL,
+			last_seen      TIMESTAMP NOT NULL,
+			PRIMARY KEY (api_key, user_agent, client_version, api_version, operation)
+		)`)
+	return err
+}
+
+func (s *SQLUsageStore) Add(ctx context.Context, usage []Usage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, u := range usage {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO api_client_usage (api_key, user_agent, client_version, api_version, operation, requests, first_seen, last_seen)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (api_key, user_agent, client_version, api_version, operation) DO UPDATE SET
+				requests = api_client_usage.requests + excluded.requests,
+				last_seen = excluded.last_seen`,
+			u.APIKey, u.UserAgent, u.ClientVersion, u.Version, u.Operation, u.Requests, u.FirstSeen, u.LastSeen); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLUsageStore) List(ctx context.Context, f UsageFilter) ([]Usage, error) {
+	query := `
+		SELECT api_key, user_agent, client_version, api_version, operation, requests, first_seen, last_seen
+		FROM api_client_usage WHERE operation <> ''`
+	if !f.Deprecated {
+		query = `
+		SELECT api_key, user_agent, client_version, api_version, operation, requests, first_seen, last_seen
+		FROM api_client_usage WHERE operation = ''`
+	}
+	args := []any{}
+	if f.APIKey != "" {
+		query += ` AND api_key = $1`
+		args = append(args, f.APIKey)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY last_seen DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Usage{}
+	for rows.Next() {
+		var u Usage
+		if err := rows.Scan(&u.APIKey, &u.UserAgent, &u.ClientVersion, &u.Version, &u.Operation, &u.Requests, &u.FirstSeen, &u.LastSeen); err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
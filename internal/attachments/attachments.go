@@ -0,0 +1,172 @@
+// Package attachments is the feature module letting users attach files to the
+// resources of other modules. Modules opt their resources in by declaring them as
+// subresource parents; each then gets its attachment routes, like
+// /documents/:id/attachments. Listing and downloading attachments needs read
+// access to the resource and attaching the attach action on it, which the default
+// policy leaves to its owner. Files are kept in the shared storage, scanned by
+// ClamAV when configured, and their adding and removal recorded as events.
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/realtime"
+	"go-api/internal/subresource"
+	"go-api/pkg/clamav"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+	"go-api/pkg/storage"
+
+	"go.uber.org/zap"
+)
+
+// Config holds attachments configuration
+type Config struct {
+	Resources []string `yaml:"resources"` // Types of the parents taking attachments; every declared parent when empty
+	MaxBytes  int64    `yaml:"maxBytes"`  // Largest file attached
+	Store     string   `yaml:"store"`     // memory or sql; the database by default
+}
+
+// Attachment is a file attached to a resource
+type Attachment struct {
+	ID           string    `json:"id"`
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Tenant       string    `json:"tenant,omitempty"`
+	UploaderID   string    `json:"uploaderId"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Key is where an attachment's file is stored
+func (a Attachment) Key() string {
+	return "attachments/" + a.ID
+}
+
+// cursor is the position of the attachment in the listing of its resource
+func (a Attachment) cursor() subresource.Cursor {
+	return subresource.Cursor{CreatedAt: a.CreatedAt, ID: a.ID}
+}
+
+// AttachmentPage is a page of the attachments of a resource, oldest first
+type AttachmentPage struct {
+	Data []Attachment `json:"data"`
+	Next string       `json:"next,omitempty"` // Cursor of the next page, passed as ?cursor=
+}
+
+// Events recorded on the stream of a resource's attachments,
+// attachments-{type}/{id}
+const (
+	EventAdded   = "attachment.added"
+	EventRemoved = "attachment.removed"
+)
+
+// Change is the data of the attachment events
+type Change struct {
+	AttachmentID  string `json:"attachmentId"`
+	ResourceType  string `json:"resourceType"`
+	ResourceID    string `json:"resourceId"`
+	ResourceOwner string `json:"resourceOwner,omitempty"`
+	Tenant        string `json:"tenant,omitempty"`
+	UploaderID    string `json:"uploaderId"`
+	Filename      string `json:"filename"`
+	Size          int64  `json:"size"`
+	RemovedBy     string `json:"removedBy,omitempty"`
+}
+
+type attachmentsModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	storage storage.Storage
+	scanner *clamav.Client
+	events  eventstore.Store
+	parents []subresource.Parent
+}
+
+// New returns the factory of the attachments module, which needs the shared
+// storage
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if deps.Storage == nil {
+			return nil, errors.New("attachments: no storage configured")
+		}
+		if cfg.MaxBytes <= 0 {
+			cfg.MaxBytes = 25 << 20
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("attachments: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("attachments: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &attachmentsModule{cfg: cfg, backend: backend, store: store, storage: deps.Storage,
+			scanner: deps.Antivirus, events: deps.Events}, nil
+	}
+}
+
+func (m *attachmentsModule) Name() string { return "attachments" }
+
+func (m *attachmentsModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+func (m *attachmentsModule) HealthChecks() []module.HealthCheck {
+	if m.scanner == nil {
+		return nil
+	}
+	return []module.HealthCheck{{Name: "antivirus", Check: m.scanner.Ping}}
+}
+
+// Attach keeps the parents configured to take attachments
+func (m *attachmentsModule) Attach(parents []subresource.Parent) {
+	m.parents = subresource.Select(parents, m.cfg.Resources)
+}
+
+// EventSchemas declares the schemas of the attachment events
+func (m *attachmentsModule) EventSchemas() []eventschema.Schema {
+	schema := eventschema.From(Change{})
+	return []eventschema.Schema{
+		{Event: EventAdded, Version: 1, Description: "A file was attached to a resource.", Schema: schema},
+		{Event: EventRemoved, Version: 1, Description: "An attachment was removed, by its uploader or a moderator.", Schema: schema},
+	}
+}
+
+// Topics lets clients follow the attachments of the resources they may read
+func (m *attachmentsModule) Topics() []realtime.Topic {
+	return []realtime.Topic{{Name: "attachments", Events: []string{EventAdded, EventRemoved},
+		Resource: "attachment", TypeField: "resourceType", IDField: "resourceId", Owner: "resourceOwner", Tenant: "tenant",
+		Actors: []string{"removedBy", "uploaderId"}}}
+}
+
+// record records an event of an attachment. The change is stored already, so a
+// failure is only logged.
+func (m *attachmentsModule) record(ctx context.Context, event string, a Attachment, resourceOwner, removedBy string) {
+	stream := "attachments-" + url.PathEscape(a.ResourceType) + "/" + url.PathEscape(a.ResourceID)
+	_, err := m.events.Append(ctx, stream, eventstore.AnyVersion, eventstore.NewEvent{
+		Type: event,
+		Data: Change{AttachmentID: a.ID, ResourceType: a.ResourceType, ResourceID: a.ResourceID, ResourceOwner: resourceOwner,
+			Tenant: a.Tenant, UploaderID: a.UploaderID, Filename: a.Filename, Size: a.Size, RemovedBy: removedBy},
+	})
+	if err != nil {
+		logger.Error("failed to record attachment event", zap.String("event", event), zap.String("attachment", a.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,276 @@
+package attachments
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/subresource"
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Routes mounts the attachment endpoints under each parent taking attachments
+func (m *attachmentsModule) Routes(api *apiversion.Group) {
+	for _, p := range m.parents {
+		m.parentRoutes(api, p)
+	}
+}
+
+func (m *attachmentsModule) parentRoutes(api *apiversion.Group, p subresource.Parent) {
+	tags := []string{"attachments"}
+	path := strings.TrimSuffix(p.Path, "/") + "/:id/attachments"
+	api.GET(path, apiversion.Operation{
+		ID:          "list" + p.Title() + "Attachments",
+		Summary:     "List the files attached to a " + p.Type,
+		Description: "Lists the attachments oldest first, a page at a time: pass the next cursor of a page as ?cursor= for the one after it.",
+		Tags:        tags,
+		Response:    AttachmentPage{},
+	}, m.list(p))
+	api.POST(path, apiversion.Operation{
+		ID:          "add" + p.Title() + "Attachment",
+		Summary:     "Attach a file to a " + p.Type,
+		Description: "Takes the file field of a multipart form. Infected files are refused when antivirus scanning is configured.",
+		Tags:        tags,
+		Cost:        10,
+		Response:    Attachment{},
+	}, m.add(p))
+	api.GET(path+"/:attachmentId", apiversion.Operation{
+		ID:       "get" + p.Title() + "Attachment",
+		Summary:  "Get an attachment of a " + p.Type,
+		Tags:     tags,
+		Response: Attachment{},
+	}, m.get(p))
+	api.GET(path+"/:attachmentId/file", apiversion.Operation{
+		ID:      "download" + p.Title() + "Attachment",
+		Summary: "Download an attached file",
+		Tags:    tags,
+	}, m.download(p))
+	api.DELETE(path+"/:attachmentId", apiversion.Operation{
+		ID:          "remove" + p.Title() + "Attachment",
+		Summary:     "Remove an attachment of a " + p.Type,
+		Description: "Removed by its uploader, or by those allowed to moderate the " + p.Type + ", like its owner.",
+		Tags:        tags,
+	}, m.remove(p))
+}
+
+// attachment returns the attachment of the :attachmentId parameter on the parent
+// resource r
+func (m *attachmentsModule) attachment(c *gin.Context, r authz.Resource) (Attachment, error) {
+	a, err := m.store.Get(c.Request.Context(), c.Param("attachmentId"))
+	if err != nil {
+		return Attachment{}, err
+	}
+	if a.ResourceType != r.Type || a.ResourceID != r.ID || a.Tenant != r.Tenant {
+		return Attachment{}, errAttachmentNotFound
+	}
+	return a, nil
+}
+
+func (m *attachmentsModule) list(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		page, err := subresource.ParsePage(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		list, err := m.store.List(ctx, r.Tenant, r.Type, r.ID, page.Fetch())
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		list, next := subresource.Next(page, list, Attachment.cursor)
+		c.JSON(http.StatusOK, AttachmentPage{Data: list, Next: next})
+	}
+}
+
+func (m *attachmentsModule) add(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		sub, ok := authz.SubjectFromContext(ctx)
+		if !ok || sub.ID == "" {
+			c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+			return
+		}
+		r, err := p.Authorize(ctx, c.Param("id"), "attach")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, m.cfg.MaxBytes)
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.Error(uploadError(err))
+			return
+		}
+		defer file.Close()
+
+		a := Attachment{
+			ID:           uuid.New().String(),
+			ResourceType: r.Type,
+			ResourceID:   r.ID,
+			Tenant:       r.Tenant,
+			UploaderID:   sub.ID,
+			Filename:     filename(header.Filename),
+			ContentType:  header.Header.Get("Content-Type"),
+			CreatedAt:    time.Now().UTC().Truncate(time.Microsecond), // As precise as database timestamps, for cursors
+		}
+		if a.ContentType == "" {
+			a.ContentType = "application/octet-stream"
+		}
+		obj, err := m.storage.Put(ctx, a.Key(), file, a.ContentType)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		a.Size, a.ETag = obj.Size, obj.ETag
+		if err := m.scan(c, a); err != nil {
+			m.discard(c, a)
+			c.Error(err)
+			return
+		}
+		if err := m.store.Save(ctx, a); err != nil {
+			m.discard(c, a)
+			c.Error(err)
+			return
+		}
+		m.record(ctx, EventAdded, a, r.Owner, "")
+		c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+a.ID)
+		c.JSON(http.StatusCreated, a)
+	}
+}
+
+// scan refuses an attachment whose stored file is infected, when antivirus
+// scanning is configured
+func (m *attachmentsModule) scan(c *gin.Context, a Attachment) error {
+	if m.scanner == nil {
+		return nil
+	}
+	content, _, err := m.storage.Open(c.Request.Context(), a.Key())
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	result, err := m.scanner.Scan(c.Request.Context(), content)
+	if err != nil {
+		return err
+	}
+	if result.Infected {
+		logger.Warn("refused infected attachment", zap.String("resource", a.ResourceType+"/"+a.ResourceID),
+			zap.String("uploader", a.UploaderID), zap.String("signature", result.Signature))
+		return apperrors.NewValidationError("File is infected with " + result.Signature)
+	}
+	return nil
+}
+
+// discard deletes the stored file of an attachment that wasn't added
+func (m *attachmentsModule) discard(c *gin.Context, a Attachment) {
+	if err := m.storage.Delete(c.Request.Context(), a.Key()); err != nil {
+		logger.Error("failed to delete attachment file", zap.String("key", a.Key()), zap.Error(err))
+	}
+}
+
+// filename returns the base name of an uploaded file, or file when it has none
+func filename(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	if name = strings.TrimSpace(name); name == "" {
+		return "file"
+	}
+	return name
+}
+
+func uploadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apperrors.NewValidationError(fmt.Sprintf("File is larger than %d bytes", tooLarge.Limit))
+	}
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return apperrors.NewValidationError("Missing file field of a multipart form")
+	}
+	return apperrors.NewValidationError("Invalid upload: " + err.Error())
+}
+
+func (m *attachmentsModule) get(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := p.Authorize(c.Request.Context(), c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		a, err := m.attachment(c, r)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, a)
+	}
+}
+
+func (m *attachmentsModule) download(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := p.Authorize(c.Request.Context(), c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		a, err := m.attachment(c, r)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+		c.Header("Cache-Control", "private, no-cache")
+		c.Header("X-Content-Type-Options", "nosniff")
+		if err := storage.Serve(c.Writer, c.Request, m.storage, a.Key()); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+func (m *attachmentsModule) remove(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		a, err := m.attachment(c, r)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		sub, _ := authz.SubjectFromContext(ctx)
+		removedBy := ""
+		if sub.ID != a.UploaderID {
+			if err := authz.Authorize(ctx, "moderate", r); err != nil {
+				c.Error(err)
+				return
+			}
+			removedBy = sub.ID
+		}
+		if err := m.store.Delete(ctx, a.ID); err != nil {
+			c.Error(err)
+			return
+		}
+		m.discard(c, a)
+		m.record(ctx, EventRemoved, a, r.Owner, removedBy)
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,175 @@
+package attachments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/internal/subresource"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+)
+
+// Store persists the records of attachments
+type Store interface {
+	Save(ctx context.Context, a Attachment) error
+	Get(ctx context.Context, id string) (Attachment, error)
+	Delete(ctx context.Context, id string) error
+	// List returns the attachments of a resource of a tenant in the page, oldest first
+	List(ctx context.Context, tenant, resourceType, resourceID string, page subresource.Page) ([]Attachment, error)
+}
+
+var errAttachmentNotFound = apperrors.NewNotFoundError("Attachment not found")
+
+// MemoryStore keeps attachment records in memory, used when no database is configured
+type MemoryStore struct {
+	mu          sync.RWMutex
+	attachments map[string]Attachment
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attachments: make(map[string]Attachment)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, a Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attachments[a.ID] = a
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.attachments[id]
+	if !ok {
+		return Attachment{}, errAttachmentNotFound
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.attachments[id]; !ok {
+		return errAttachmentNotFound
+	}
+	delete(s.attachments, id)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, tenant, resourceType, resourceID string, page subresource.Page) ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Attachment{}
+	for _, a := range s.attachments {
+		if a.Tenant == tenant && a.ResourceType == resourceType && a.ResourceID == resourceID && page.After.After(a.CreatedAt, a.ID) {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].cursor().After(list[j].CreatedAt, list[j].ID) })
+	if len(list) > page.Limit {
+		list = list[:page.Limit]
+	}
+	return list, nil
+}
+
+// migrations create the attachments table, indexed for listing the attachments of
+// a resource in order
+var migrations = []module.Migration{{
+	Name: "create_attachments",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS attachments (
+			id            TEXT PRIMARY KEY,
+			resource_type TEXT NOT NULL,
+			resource_id   TEXT NOT NULL,
+			tenant        TEXT NOT NULL,
+			uploader_id   TEXT NOT NULL,
+			filename      TEXT NOT NULL,
+			content_type  TEXT NOT NULL,
+			size          BIGINT NOT NULL,
+			etag          TEXT NOT NULL,
+			created_at    TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS attachments_resource_idx ON attachments (resource_type, resource_id, tenant, created_at, id)`,
+}}
+
+// SQLStore persists attachment records in the attachments table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Save(ctx context.Context, a Attachment) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO attachments (id, resource_type, resource_id, tenant, uploader_id, filename, content_type, size, etag, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		a.ID, a.ResourceType, a.ResourceID, a.Tenant, a.UploaderID, a.Filename, a.ContentType, a.Size, a.ETag, a.CreatedAt)
+	return err
+}
+
+const selectAttachments = `SELECT id, resource_type, resource_id, tenant, uploader_id, filename, content_type, size, etag, created_at FROM attachments`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAttachment(row scanner) (Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.ResourceType, &a.ResourceID, &a.Tenant, &a.UploaderID, &a.Filename, &a.ContentType, &a.Size, &a.ETag, &a.CreatedAt)
+	return a, err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Attachment, error) {
+	a, err := scanAttachment(s.conn(ctx).QueryRowContext(ctx, selectAttachments+` WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, errAttachmentNotFound
+	}
+	return a, err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM attachments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errAttachmentNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) List(ctx context.Context, tenant, resourceType, resourceID string, page subresource.Page) ([]Attachment, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, selectAttachments+`
+		WHERE resource_type = $1 AND resource_id = $2 AND tenant = $3
+			AND (created_at > $4 OR (created_at = $4 AND id > $5))
+		ORDER BY created_at, id
+		LIMIT $6`, resourceType, resourceID, tenant, page.After.CreatedAt, page.After.ID, page.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
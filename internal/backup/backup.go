@@ -0,0 +1,238 @@
+// Package backup takes logical backups of the shared database into storage and
+// restores them, for deployments without managed database snapshots. Postgres is
+// dumped with pg_dump and restored with pg_restore in a single transaction;
+// SQLite is copied with VACUUM INTO and its rows restored into the current schema.
+// Both run as operations reporting their progress. Operations are never restored,
+// so a restore keeps the record of the one doing it. The databases of tenants
+// isolated in a database of their own are not backed up.
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-api/internal/operations"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+// Operation types
+const (
+	CreateOperation  = "backup.create"
+	RestoreOperation = "backup.restore"
+)
+
+// Config holds backup configuration
+type Config struct {
+	PgDump    string        `yaml:"pgDump"`    // Path of the pg_dump binary
+	PgRestore string        `yaml:"pgRestore"` // Path of the pg_restore binary
+	Prefix    string        `yaml:"prefix"`    // Of the storage keys of backups
+	Timeout   time.Duration `yaml:"timeout"`   // Of one backup or restore
+}
+
+// Backup is a stored backup
+type Backup struct {
+	ID        string    `json:"id"`
+	Dialect   string    `json:"dialect"`
+	Size      int64     `json:"size"`
+	ETag      string    `json:"etag"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// excludedTable is never restored: it holds the operation restoring the backup
+const excludedTable = "operations"
+
+// extensions maps dialects to the extension of their backups
+var extensions = map[string]string{database.Postgres: ".pgdump", database.SQLite: ".sqlite"}
+
+// validID is what backup IDs look like, as they become storage keys
+var validID = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z-[0-9a-f]{8}$`)
+
+var (
+	errBackupNotFound = apperrors.NewNotFoundError("Backup not found")
+	errBusy           = apperrors.NewConflictError("A backup or restore is already running")
+)
+
+// Service takes and restores backups
+type Service struct {
+	cfg        Config
+	db         *sql.DB
+	dsn        string
+	files      storage.Storage
+	operations *operations.Manager
+
+	running atomic.Bool // While a backup or restore is in progress
+}
+
+// NewService creates a backup service of db, opened with dsn, and registers its
+// operations, so it must be created before the job queue starts
+func NewService(cfg Config, db *sql.DB, dsn string, files storage.Storage, ops *operations.Manager) *Service {
+	if cfg.PgDump == "" {
+		cfg.PgDump = "pg_dump"
+	}
+	if cfg.PgRestore == "" {
+		cfg.PgRestore = "pg_restore"
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "backups/"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Hour
+	}
+	s := &Service{cfg: cfg, db: db, dsn: dsn, files: files, operations: ops}
+	ops.Register(CreateOperation, s.runCreate)
+	ops.Register(RestoreOperation, s.runRestore)
+	return s
+}
+
+// Busy reports whether a backup or restore is in progress on this instance
+func (s *Service) Busy() bool {
+	return s.running.Load()
+}
+
+// List returns the stored backups, newest first
+func (s *Service) List(ctx context.Context) ([]Backup, error) {
+	objects, err := s.files.List(ctx, s.cfg.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	list := []Backup{}
+	for _, o := range objects {
+		if b, ok := s.fromObject(o); ok {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+// Get returns a stored backup
+func (s *Service) Get(ctx context.Context, id string) (Backup, error) {
+	if !validID.MatchString(id) {
+		return Backup{}, errBackupNotFound
+	}
+	for _, ext := range extensions {
+		o, err := s.files.Stat(ctx, s.cfg.Prefix+id+ext)
+		if err == nil {
+			b, _ := s.fromObject(o)
+			return b, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return Backup{}, err
+		}
+	}
+	return Backup{}, errBackupNotFound
+}
+
+// Delete removes a stored backup
+func (s *Service) Delete(ctx context.Context, id string) error {
+	b, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.files.Delete(ctx, s.key(b))
+}
+
+func (s *Service) key(b Backup) string {
+	return s.cfg.Prefix + b.ID + extensions[b.Dialect]
+}
+
+// fromObject parses the storage key of a backup
+func (s *Service) fromObject(o storage.Object) (Backup, bool) {
+	name := strings.TrimPrefix(o.Key, s.cfg.Prefix)
+	for dialect, ext := range extensions {
+		id, ok := strings.CutSuffix(name, ext)
+		if !ok || !validID.MatchString(id) {
+			continue
+		}
+		created, _ := time.Parse("20060102T150405Z", id[:16])
+		return Backup{ID: id, Dialect: dialect, Size: o.Size, ETag: o.ETag, CreatedAt: created}, true
+	}
+	return Backup{}, false
+}
+
+// Create takes a backup of the database. progress, which may be nil, is called
+// with the percentage done.
+func (s *Service) Create(ctx context.Context, progress func(percent int)) (Backup, error) {
+	if !s.running.CompareAndSwap(false, true) {
+		return Backup{}, errBusy
+	}
+	defer s.running.Store(false)
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	if progress == nil {
+		progress = func(int) {}
+	}
+
+	now := time.Now().UTC()
+	b := Backup{ID: now.Format("20060102T150405Z") + "-" + uuid.New().String()[:8], Dialect: database.Dialect(s.db), CreatedAt: now}
+	var o storage.Object
+	var err error
+	if b.Dialect == database.SQLite {
+		o, err = s.dumpSQLite(ctx, s.key(b), progress)
+	} else {
+		o, err = s.dumpPostgres(ctx, s.key(b), progress)
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("backup %s: %w", b.ID, err)
+	}
+	b.Size, b.ETag = o.Size, o.ETag
+	return b, nil
+}
+
+// Restore replaces the data of the database with that of a backup, except for
+// operations
+func (s *Service) Restore(ctx context.Context, id string, progress func(percent int)) (Backup, error) {
+	if !s.running.CompareAndSwap(false, true) {
+		return Backup{}, errBusy
+	}
+	defer s.running.Store(false)
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	if progress == nil {
+		progress = func(int) {}
+	}
+
+	b, err := s.Get(ctx, id)
+	if err != nil {
+		return Backup{}, err
+	}
+	if dialect := database.Dialect(s.db); b.Dialect != dialect {
+		return Backup{}, apperrors.NewValidationError(fmt.Sprintf("Backup is of a %s database, this one is %s", b.Dialect, dialect))
+	}
+	if b.Dialect == database.SQLite {
+		err = s.restoreSQLite(ctx, s.key(b), progress)
+	} else {
+		err = s.restorePostgres(ctx, s.key(b), progress)
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("restore %s: %w", b.ID, err)
+	}
+	return b, nil
+}
+
+type restorePayload struct {
+	Backup string `json:"backup"`
+}
+
+func (s *Service) runCreate(ctx context.Context, task *operations.Task) (any, error) {
+	return s.Create(ctx, func(percent int) { task.Progress(ctx, percent) })
+}
+
+func (s *Service) runRestore(ctx context.Context, task *operations.Task) (any, error) {
+	var payload restorePayload
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+	return s.Restore(ctx, payload.Backup, func(percent int) { task.Progress(ctx, percent) })
+}
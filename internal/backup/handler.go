@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"net/http"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes the admin endpoints to take, list and restore backups
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a backup handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes mounts the backup endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/backups", h.list)
+	rg.POST("/backups", h.create)
+	rg.GET("/backups/:id", h.get)
+	rg.DELETE("/backups/:id", h.delete)
+	rg.POST("/backups/:id/restore", routing.Query("confirm"), h.restore)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	list, err := h.service.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Handler) get(c *gin.Context) {
+	b, err := h.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// create takes a backup as an operation, whose result is the backup
+func (h *Handler) create(c *gin.Context) {
+	if h.service.Busy() {
+		c.Error(errBusy)
+		return
+	}
+	op, err := h.service.operations.Start(c.Request.Context(), CreateOperation, nil)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.service.operations.Accepted(c, op)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if err := h.service.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// restore replaces the data of the database with that of a backup as an
+// operation. As everything written since the backup is lost, it needs ?confirm=true.
+func (h *Handler) restore(c *gin.Context) {
+	if c.Query("confirm") != "true" {
+		c.Error(apperrors.NewValidationError("Restoring replaces the data of the database, confirm with ?confirm=true",
+			apperrors.FieldError{Field: "confirm", Rule: "eq", Param: "true", Message: "confirm must be true"}))
+		return
+	}
+	ctx := c.Request.Context()
+	b, err := h.service.Get(ctx, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if h.service.Busy() {
+		c.Error(errBusy)
+		return
+	}
+	op, err := h.service.operations.Start(ctx, RestoreOperation, restorePayload{Backup: b.ID})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.service.operations.Accepted(c, op)
+}
@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go-api/pkg/storage"
+)
+
+// dumpPostgres streams pg_dump into storage, counting the tables dumped for progress
+func (s *Service) dumpPostgres(ctx context.Context, key string, progress func(int)) (storage.Object, error) {
+	tables, err := s.countTables(ctx)
+	if err != nil {
+		return storage.Object{}, err
+	}
+	progress(1)
+
+	cmd := s.command(ctx, s.cfg.PgDump, "--format=custom", "--no-owner", "--no-privileges", "--verbose",
+		"--exclude-table="+excludedTable)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	log := &stderr{}
+	done := 0
+	log.onLine = func(line string) {
+		if strings.Contains(line, "dumping contents of table") {
+			done++
+			progress(percentOf(done, tables))
+		}
+	}
+	cmd.Stderr = log
+	if err := cmd.Start(); err != nil {
+		return storage.Object{}, err
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			pw.CloseWithError(fmt.Errorf("pg_dump: %w: %s", err, log.tail()))
+			return
+		}
+		pw.Close()
+	}()
+
+	o, err := s.files.Put(ctx, key, pr, "application/octet-stream")
+	// Unblocks pg_dump when storage gave up before the end of the dump
+	pr.CloseWithError(io.ErrClosedPipe)
+	return o, err
+}
+
+// restorePostgres streams a backup into pg_restore, which replaces the dumped
+// tables in a single transaction, so a failed restore leaves the database as it was
+func (s *Service) restorePostgres(ctx context.Context, key string, progress func(int)) error {
+	tables, err := s.countTables(ctx)
+	if err != nil {
+		return err
+	}
+	r, _, err := s.files.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	progress(1)
+
+	cmd := s.command(ctx, s.cfg.PgRestore, "--clean", "--if-exists", "--single-transaction", "--exit-on-error",
+		"--no-owner", "--no-privileges", "--verbose")
+	cmd.Stdin = r
+	log := &stderr{}
+	done := 0
+	log.onLine = func(line string) {
+		if strings.Contains(line, "processing data for table") {
+			done++
+			progress(percentOf(done, tables))
+		}
+	}
+	cmd.Stderr = log
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore: %w: %s", err, log.tail())
+	}
+	return nil
+}
+
+// countTables counts the tables of the database, excluding the system catalogs
+func (s *Service) countTables(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM pg_tables
+		WHERE schemaname NOT IN ('pg_catalog', 'information_schema')`).Scan(&n)
+	return n, err
+}
+
+// command runs a Postgres client tool against the database. The password goes in
+// the environment rather than the arguments, where any local user could read it.
+func (s *Service) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	dsn, password := splitPassword(s.dsn)
+	cmd := exec.CommandContext(ctx, name, append(args, "--dbname="+dsn)...)
+	cmd.Env = os.Environ()
+	if password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+	}
+	return cmd
+}
+
+var keywordPassword = regexp.MustCompile(`(?:^|\s)password\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// splitPassword removes the password from a URL or keyword/value DSN
+func splitPassword(dsn string) (string, string) {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		password, ok := u.User.Password()
+		if !ok {
+			return dsn, ""
+		}
+		u.User = url.User(u.User.Username())
+		return u.String(), password
+	}
+	m := keywordPassword.FindStringSubmatchIndex(dsn)
+	if m == nil {
+		return dsn, ""
+	}
+	password := dsn[m[2]:m[3]]
+	if strings.HasPrefix(password, "'") {
+		password = strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(password[1 : len(password)-1])
+	}
+	return strings.TrimSpace(dsn[:m[0]] + " " + dsn[m[1]:]), password
+}
+
+// percentOf is the progress of done out of total tables, short of 100 until the
+// operation has finished
+func percentOf(done, total int) int {
+	if total <= 0 {
+		return 1
+	}
+	return min(1+done*98/total, 99)
+}
+
+// stderr calls onLine with each line a tool logs and keeps the last ones for errors
+type stderr struct {
+	mu      sync.Mutex
+	onLine  func(string)
+	partial bytes.Buffer
+	lines   []string
+}
+
+func (w *stderr) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial.Write(p)
+	for {
+		line, err := w.partial.ReadString('\n')
+		if err != nil {
+			// Not a whole line yet
+			w.partial.Reset()
+			w.partial.WriteString(line)
+			return len(p), nil
+		}
+		line = strings.TrimSpace(line)
+		if w.lines = append(w.lines, line); len(w.lines) > 10 {
+			w.lines = w.lines[1:]
+		}
+		w.onLine(line)
+	}
+}
+
+func (w *stderr) tail() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lines := w.lines
+	if partial := strings.TrimSpace(w.partial.String()); partial != "" {
+		lines = append(lines[:len(lines):len(lines)], partial)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go-api/pkg/storage"
+)
+
+// dumpSQLite copies the database with VACUUM INTO, which gives a consistent
+// snapshot without blocking writers, then uploads the copy
+func (s *Service) dumpSQLite(ctx context.Context, key string, progress func(int)) (storage.Object, error) {
+	dir, err := os.MkdirTemp("", "backup-")
+	if err != nil {
+		return storage.Object{}, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.sqlite")
+	progress(1)
+
+	if _, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return storage.Object{}, err
+	}
+	progress(50)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return storage.Object{}, err
+	}
+	defer f.Close()
+	return s.files.Put(ctx, key, f, "application/vnd.sqlite3")
+}
+
+// restoreSQLite downloads a backup, attaches it and replaces the rows of each
+// table with its own in a single transaction. The schema stays that of the
+// current migrations; columns the backup lacks are left to their defaults.
+func (s *Service) restoreSQLite(ctx context.Context, key string, progress func(int)) error {
+	dir, err := os.MkdirTemp("", "restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.sqlite")
+	if err := s.download(ctx, key, path); err != nil {
+		return err
+	}
+	progress(1)
+
+	// ATTACH only applies to one connection, which the transaction has to use
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS backup`, path); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `DETACH DATABASE backup`)
+
+	tables, err := columns(ctx, conn, "main")
+	if err != nil {
+		return err
+	}
+	saved, err := columns(ctx, conn, "backup")
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Tables are emptied and filled in any order; foreign keys are checked at commit
+	if _, err := tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return err
+	}
+	done := 0
+	for table, cols := range tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM main.`+quote(table)); err != nil {
+			return err
+		}
+		var common []string
+		for _, col := range cols {
+			if slices.Contains(saved[table], col) {
+				common = append(common, quote(col))
+			}
+		}
+		if len(common) > 0 {
+			list := strings.Join(common, ", ")
+			if _, err := tx.ExecContext(ctx, `INSERT INTO main.`+quote(table)+` (`+list+`) SELECT `+list+
+				` FROM backup.`+quote(table)); err != nil {
+				return err
+			}
+		}
+		done++
+		progress(percentOf(done, len(tables)))
+	}
+	return tx.Commit()
+}
+
+// download copies an object into a local file
+func (s *Service) download(ctx context.Context, key, path string) error {
+	r, _, err := s.files.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// columns lists the columns of the tables of an attached schema, except for
+// operations, the record of migrations and SQLite's own tables
+func columns(ctx context.Context, conn *sql.Conn, schema string) (map[string][]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT t.name, c.name
+		FROM `+schema+`.sqlite_master t, pragma_table_info(t.name, '`+schema+`') c
+		WHERE t.type = 'table' AND t.name NOT LIKE 'sqlite_%' AND t.name NOT IN (?, 'schema_migrations')
+		ORDER BY t.name, c.cid`, excludedTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := map[string][]string{}
+	for rows.Next() {
+		var table, col string
+		if err := rows.Scan(&table, &col); err != nil {
+			return nil, err
+		}
+		tables[table] = append(tables[table], col)
+	}
+	return tables, rows.Err()
+}
+
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,159 @@
+// Package comments is the feature module letting users comment on the resources
+// of other modules. Modules opt their resources in by declaring them as
+// subresource parents; each then gets its comment routes, like
+// /documents/:id/comments. Reading comments needs read access to the resource and
+// commenting the comment action on it, which the default policy allows within
+// the tenant. Comments are edited by their author, and deleted by them or those
+// allowed to moderate the resource. Every change is recorded as an event, for
+// clients to follow on the realtime topic.
+package comments
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/realtime"
+	"go-api/internal/subresource"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config holds comments configuration
+type Config struct {
+	Resources []string `yaml:"resources"` // Types of the parents taking comments; every declared parent when empty
+	MaxLength int      `yaml:"maxLength"` // Of a comment's body, in characters
+	Store     string   `yaml:"store"`     // memory or sql; the database by default
+}
+
+// Comment is a comment on a resource
+type Comment struct {
+	ID           string     `json:"id"`
+	ResourceType string     `json:"resourceType"`
+	ResourceID   string     `json:"resourceId"`
+	Tenant       string     `json:"tenant,omitempty"`
+	AuthorID     string     `json:"authorId"`
+	Body         string     `json:"body"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	EditedAt     *time.Time `json:"editedAt,omitempty"`
+}
+
+// cursor is the position of the comment in the listing of its resource
+func (c Comment) cursor() subresource.Cursor {
+	return subresource.Cursor{CreatedAt: c.CreatedAt, ID: c.ID}
+}
+
+// CommentPage is a page of the comments of a resource, oldest first
+type CommentPage struct {
+	Data []Comment `json:"data"`
+	Next string    `json:"next,omitempty"` // Cursor of the next page, passed as ?cursor=
+}
+
+// Events recorded on the stream of a resource's comments, comments-{type}/{id}
+const (
+	EventCreated = "comment.created"
+	EventEdited  = "comment.edited"
+	EventDeleted = "comment.deleted"
+)
+
+// Change is the data of the comment events
+type Change struct {
+	CommentID     string `json:"commentId"`
+	ResourceType  string `json:"resourceType"`
+	ResourceID    string `json:"resourceId"`
+	ResourceOwner string `json:"resourceOwner,omitempty"`
+	Tenant        string `json:"tenant,omitempty"`
+	AuthorID      string `json:"authorId"`
+	Body          string `json:"body,omitempty"` // Of created and edited comments
+	DeletedBy     string `json:"deletedBy,omitempty"`
+}
+
+type commentsModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	events  eventstore.Store
+	parents []subresource.Parent
+}
+
+// New returns the factory of the comments module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if cfg.MaxLength <= 0 {
+			cfg.MaxLength = 10000
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("comments: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("comments: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &commentsModule{cfg: cfg, backend: backend, store: store, events: deps.Events}, nil
+	}
+}
+
+func (m *commentsModule) Name() string { return "comments" }
+
+func (m *commentsModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// Attach keeps the parents configured to take comments
+func (m *commentsModule) Attach(parents []subresource.Parent) {
+	m.parents = subresource.Select(parents, m.cfg.Resources)
+}
+
+// EventSchemas declares the schemas of the comment events
+func (m *commentsModule) EventSchemas() []eventschema.Schema {
+	schema := eventschema.From(Change{})
+	return []eventschema.Schema{
+		{Event: EventCreated, Version: 1, Description: "A user commented on a resource.", Schema: schema},
+		{Event: EventEdited, Version: 1, Description: "The author of a comment edited it.", Schema: schema},
+		{Event: EventDeleted, Version: 1, Description: "A comment was deleted, by its author or a moderator.", Schema: schema},
+	}
+}
+
+// Topics lets clients follow the comments of the resources they may read
+func (m *commentsModule) Topics() []realtime.Topic {
+	return []realtime.Topic{{Name: "comments", Events: []string{EventCreated, EventEdited, EventDeleted},
+		Resource: "comment", TypeField: "resourceType", IDField: "resourceId", Owner: "resourceOwner", Tenant: "tenant",
+		Actors: []string{"deletedBy", "authorId"}}}
+}
+
+// record records an event of a comment. The change is stored already, so a
+// failure is only logged.
+func (m *commentsModule) record(ctx context.Context, event string, c Comment, resourceOwner, deletedBy string) {
+	stream := "comments-" + url.PathEscape(c.ResourceType) + "/" + url.PathEscape(c.ResourceID)
+	change := Change{CommentID: c.ID, ResourceType: c.ResourceType, ResourceID: c.ResourceID, ResourceOwner: resourceOwner,
+		Tenant: c.Tenant, AuthorID: c.AuthorID, DeletedBy: deletedBy}
+	if event != EventDeleted {
+		change.Body = c.Body
+	}
+	if _, err := m.events.Append(ctx, stream, eventstore.AnyVersion, eventstore.NewEvent{Type: event, Data: change}); err != nil {
+		logger.Error("failed to record comment event", zap.String("event", event), zap.String("comment", c.ID), zap.Error(err))
+	}
+}
+
+// ExportPersonalData returns the comments of the user
+func (m *commentsModule) ExportPersonalData(ctx context.Context, userID string) (any, error) {
+	return m.store.ByAuthor(ctx, userID)
+}
+
+// ErasePersonalData deletes the comments of the user, whose bodies are theirs
+func (m *commentsModule) ErasePersonalData(ctx context.Context, userID string) error {
+	return m.store.DeleteByAuthor(ctx, userID)
+}
@@ -0,0 +1,214 @@
+package comments
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/subresource"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Routes mounts the comment endpoints under each parent taking comments
+func (m *commentsModule) Routes(api *apiversion.Group) {
+	for _, p := range m.parents {
+		m.parentRoutes(api, p)
+	}
+}
+
+func (m *commentsModule) parentRoutes(api *apiversion.Group, p subresource.Parent) {
+	tags := []string{"comments"}
+	path := strings.TrimSuffix(p.Path, "/") + "/:id/comments"
+	api.GET(path, apiversion.Operation{
+		ID:          "list" + p.Title() + "Comments",
+		Summary:     "List the comments on a " + p.Type,
+		Description: "Lists the comments oldest first, a page at a time: pass the next cursor of a page as ?cursor= for the one after it.",
+		Tags:        tags,
+		Response:    CommentPage{},
+	}, m.list(p))
+	api.POST(path, apiversion.Operation{
+		ID:       "create" + p.Title() + "Comment",
+		Summary:  "Comment on a " + p.Type,
+		Tags:     tags,
+		Request:  commentRequest{},
+		Response: Comment{},
+	}, m.create(p))
+	api.PATCH(path+"/:commentId", apiversion.Operation{
+		ID:          "edit" + p.Title() + "Comment",
+		Summary:     "Edit a comment on a " + p.Type,
+		Description: "Only the author of a comment edits it.",
+		Tags:        tags,
+		Request:     commentRequest{},
+		Response:    Comment{},
+	}, m.edit(p))
+	api.DELETE(path+"/:commentId", apiversion.Operation{
+		ID:          "delete" + p.Title() + "Comment",
+		Summary:     "Delete a comment on a " + p.Type,
+		Description: "Deleted by its author, or by those allowed to moderate the " + p.Type + ", like its owner.",
+		Tags:        tags,
+	}, m.delete(p))
+}
+
+type commentRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// body reads and checks the body of a comment from the request
+func (m *commentsModule) body(c *gin.Context) (string, error) {
+	var req commentRequest
+	if err := bind.JSON(c, &req); err != nil {
+		return "", apperrors.NewValidationErrorFrom("Invalid comment", err)
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" || utf8.RuneCountInString(body) > m.cfg.MaxLength {
+		maxLength := strconv.Itoa(m.cfg.MaxLength)
+		return "", apperrors.NewValidationError("Invalid comment", apperrors.FieldError{
+			Pointer: "/body", Field: "body", Rule: "max", Param: maxLength, Message: "must be between 1 and " + maxLength + " characters long",
+		})
+	}
+	return body, nil
+}
+
+// comment returns the comment of the :commentId parameter on the parent resource r
+func (m *commentsModule) comment(c *gin.Context, r authz.Resource) (Comment, error) {
+	comment, err := m.store.Get(c.Request.Context(), c.Param("commentId"))
+	if err != nil {
+		return Comment{}, err
+	}
+	if comment.ResourceType != r.Type || comment.ResourceID != r.ID || comment.Tenant != r.Tenant {
+		return Comment{}, errCommentNotFound
+	}
+	return comment, nil
+}
+
+func (m *commentsModule) list(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		page, err := subresource.ParsePage(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		list, err := m.store.List(ctx, r.Tenant, r.Type, r.ID, page.Fetch())
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		list, next := subresource.Next(page, list, Comment.cursor)
+		c.JSON(http.StatusOK, CommentPage{Data: list, Next: next})
+	}
+}
+
+func (m *commentsModule) create(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		sub, ok := authz.SubjectFromContext(ctx)
+		if !ok || sub.ID == "" {
+			c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+			return
+		}
+		r, err := p.Authorize(ctx, c.Param("id"), "comment")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		body, err := m.body(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		comment := Comment{
+			ID:           uuid.New().String(),
+			ResourceType: r.Type,
+			ResourceID:   r.ID,
+			Tenant:       r.Tenant,
+			AuthorID:     sub.ID,
+			Body:         body,
+			CreatedAt:    time.Now().UTC().Truncate(time.Microsecond), // As precise as database timestamps, for cursors
+		}
+		if err := m.store.Save(ctx, comment); err != nil {
+			c.Error(err)
+			return
+		}
+		m.record(ctx, EventCreated, comment, r.Owner, "")
+		c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+comment.ID)
+		c.JSON(http.StatusCreated, comment)
+	}
+}
+
+func (m *commentsModule) edit(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		comment, err := m.comment(c, r)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if sub, _ := authz.SubjectFromContext(ctx); sub.ID != comment.AuthorID {
+			c.Error(apperrors.NewForbiddenError("Only the author of a comment can edit it"))
+			return
+		}
+		body, err := m.body(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		now := time.Now().UTC()
+		comment.Body, comment.EditedAt = body, &now
+		if err := m.store.Save(ctx, comment); err != nil {
+			c.Error(err)
+			return
+		}
+		m.record(ctx, EventEdited, comment, r.Owner, "")
+		c.JSON(http.StatusOK, comment)
+	}
+}
+
+func (m *commentsModule) delete(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		comment, err := m.comment(c, r)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		sub, _ := authz.SubjectFromContext(ctx)
+		deletedBy := ""
+		if sub.ID != comment.AuthorID {
+			if err := authz.Authorize(ctx, "moderate", r); err != nil {
+				c.Error(err)
+				return
+			}
+			deletedBy = sub.ID
+		}
+		if err := m.store.Delete(ctx, comment.ID); err != nil {
+			c.Error(err)
+			return
+		}
+		m.record(ctx, EventDeleted, comment, r.Owner, deletedBy)
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,232 @@
+package comments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/internal/subresource"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+)
+
+// Store persists comments
+type Store interface {
+	// Save adds a comment or replaces the one with its ID
+	Save(ctx context.Context, c Comment) error
+	Get(ctx context.Context, id string) (Comment, error)
+	Delete(ctx context.Context, id string) error
+	// List returns the comments on a resource of a tenant in the page, oldest first
+	List(ctx context.Context, tenant, resourceType, resourceID string, page subresource.Page) ([]Comment, error)
+	// ByAuthor returns the comments of a user in every tenant, oldest first
+	ByAuthor(ctx context.Context, authorID string) ([]Comment, error)
+	// DeleteByAuthor removes the comments of a user in every tenant
+	DeleteByAuthor(ctx context.Context, authorID string) error
+}
+
+var errCommentNotFound = apperrors.NewNotFoundError("Comment not found")
+
+// MemoryStore keeps comments in memory, used when no database is configured
+type MemoryStore struct {
+	mu       sync.RWMutex
+	comments map[string]Comment
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{comments: make(map[string]Comment)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, c Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.comments[c.ID] = c
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.comments[id]
+	if !ok {
+		return Comment{}, errCommentNotFound
+	}
+	return c, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.comments[id]; !ok {
+		return errCommentNotFound
+	}
+	delete(s.comments, id)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, tenant, resourceType, resourceID string, page subresource.Page) ([]Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Comment{}
+	for _, c := range s.comments {
+		if c.Tenant == tenant && c.ResourceType == resourceType && c.ResourceID == resourceID && page.After.After(c.CreatedAt, c.ID) {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].cursor().After(list[j].CreatedAt, list[j].ID) })
+	if len(list) > page.Limit {
+		list = list[:page.Limit]
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) ByAuthor(ctx context.Context, authorID string) ([]Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Comment{}
+	for _, c := range s.comments {
+		if c.AuthorID == authorID {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].cursor().After(list[j].CreatedAt, list[j].ID) })
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteByAuthor(ctx context.Context, authorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, c := range s.comments {
+		if c.AuthorID == authorID {
+			delete(s.comments, id)
+		}
+	}
+	return nil
+}
+
+// migrations create the comments table, indexed for listing the comments of a
+// resource in order
+var migrations = []module.Migration{{
+	Name: "create_comments",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS comments (
+			id            TEXT PRIMARY KEY,
+			resource_type TEXT NOT NULL,
+			resource_id   TEXT NOT NULL,
+			tenant        TEXT NOT NULL,
+			author_id     TEXT NOT NULL,
+			body          TEXT NOT NULL,
+			created_at    TIMESTAMP NOT NULL,
+			edited_at     TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS comments_resource_idx ON comments (resource_type, resource_id, tenant, created_at, id)`,
+}}
+
+// SQLStore persists comments in the comments table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Save(ctx context.Context, c Comment) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO comments (id, resource_type, resource_id, tenant, author_id, body, created_at, edited_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET body = EXCLUDED.body, edited_at = EXCLUDED.edited_at`,
+		c.ID, c.ResourceType, c.ResourceID, c.Tenant, c.AuthorID, c.Body, c.CreatedAt, c.EditedAt)
+	return err
+}
+
+const selectComments = `SELECT id, resource_type, resource_id, tenant, author_id, body, created_at, edited_at FROM comments`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row scanner) (Comment, error) {
+	var c Comment
+	var editedAt sql.NullTime
+	if err := row.Scan(&c.ID, &c.ResourceType, &c.ResourceID, &c.Tenant, &c.AuthorID, &c.Body, &c.CreatedAt, &editedAt); err != nil {
+		return Comment{}, err
+	}
+	if editedAt.Valid {
+		c.EditedAt = &editedAt.Time
+	}
+	return c, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Comment, error) {
+	c, err := scanComment(s.conn(ctx).QueryRowContext(ctx, selectComments+` WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Comment{}, errCommentNotFound
+	}
+	return c, err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errCommentNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) List(ctx context.Context, tenant, resourceType, resourceID string, page subresource.Page) ([]Comment, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, selectComments+`
+		WHERE resource_type = $1 AND resource_id = $2 AND tenant = $3
+			AND (created_at > $4 OR (created_at = $4 AND id > $5))
+		ORDER BY created_at, id
+		LIMIT $6`, resourceType, resourceID, tenant, page.After.CreatedAt, page.After.ID, page.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) ByAuthor(ctx context.Context, authorID string) ([]Comment, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, selectComments+` WHERE author_id = $1 ORDER BY created_at, id`, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) DeleteByAuthor(ctx context.Context, authorID string) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM comments WHERE author_id = $1`, authorID)
+	return err
+}
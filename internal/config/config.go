@@ -0,0 +1,1030 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/activity"
+	"go-api/internal/addresses"
+	"go-api/internal/alerting"
+	"go-api/internal/announcements"
+	"go-api/internal/apiversion"
+	"go-api/internal/attachments"
+	"go-api/internal/backup"
+	"go-api/internal/comments"
+	"go-api/internal/consent"
+	"go-api/internal/documents"
+	"go-api/internal/experiment"
+	"go-api/internal/images"
+	"go-api/internal/ldapauth"
+	"go-api/internal/locations"
+	"go-api/internal/module"
+	"go-api/internal/oauth"
+	"go-api/internal/preferences"
+	"go-api/internal/privacy"
+	"go-api/internal/rates"
+	"go-api/internal/realtime"
+	"go-api/internal/reports"
+	"go-api/internal/saml"
+	"go-api/internal/settings"
+	"go-api/internal/slo"
+	"go-api/internal/static"
+	"go-api/internal/status"
+	"go-api/internal/tags"
+	"go-api/internal/tenancy"
+	"go-api/internal/typeahead"
+	"go-api/internal/uploads"
+	"go-api/internal/users"
+	"go-api/internal/view"
+	"go-api/pkg/analytics"
+	"go-api/pkg/archive"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	"go-api/pkg/cache"
+	"go-api/pkg/canary"
+	"go-api/pkg/cdc"
+	"go-api/pkg/clamav"
+	"go-api/pkg/cost"
+	"go-api/pkg/crypto"
+	"go-api/pkg/database"
+	"go-api/pkg/datetime"
+	"go-api/pkg/discovery"
+	"go-api/pkg/editlock"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/geo"
+	"go-api/pkg/id"
+	"go-api/pkg/jwks"
+	"go-api/pkg/latency"
+	"go-api/pkg/limits"
+	"go-api/pkg/logger"
+	"go-api/pkg/mail"
+	"go-api/pkg/matview"
+	"go-api/pkg/metrics"
+	"go-api/pkg/mock"
+	"go-api/pkg/mongodb"
+	"go-api/pkg/pdf"
+	"go-api/pkg/presence"
+	"go-api/pkg/profiling"
+	"go-api/pkg/projection"
+	"go-api/pkg/queue"
+	"go-api/pkg/retention"
+	"go-api/pkg/retrysafe"
+	"go-api/pkg/rewrite"
+	"go-api/pkg/routing"
+	"go-api/pkg/server"
+	"go-api/pkg/signedurl"
+	"go-api/pkg/storage"
+	"go-api/pkg/validate"
+	"go-api/pkg/watchdog"
+)
+
+// Config holds the application configuration loaded from the environment
+type Config struct {
+	Port          string
+	Activity      activity.Config
+	Addresses     addresses.Config
+	AdminToken    string
+	Admin         AdminConfig
+	Alerting      alerting.Config
+	Analytics     analytics.Config
+	Announcements announcements.Config
+	API           apiversion.Config
+	Archive       archive.Config
+	Attachments   attachments.Config
+	Authz         authz.Config
+	Backup        backup.Config
+	Bind          bind.Config
+	Bots          BotConfig
+	Cache         CacheConfig
+	Canary        canary.Config
+	Captcha       CaptchaConfig
+	CDC           cdc.Config
+	ClamAV        clamav.Config
+	Comments      comments.Config
+	Consent       consent.Config
+	Cost          cost.Config
+	Database      database.Config
+	Datetime      datetime.Config
+	Deadline      DeadlineConfig
+	Dedup         DedupConfig
+	Discovery     discovery.Config
+	Documents     documents.Config
+	EditLocks     editlock.Config
+	Encryption    crypto.Config
+	Events        EventsConfig
+	Experiment    experiment.Config
+	IDs           id.Config
+	Images        images.Config
+	JWT           jwks.Config
+	Latency       latency.Config
+	LDAP          ldapauth.Directory
+	Limits        limits.Config
+	Locations     locations.Config
+	Logger        logger.Config
+	Mail          mail.Config
+	MatViews      matview.Config
+	Metrics       metrics.Config
+	Mock          mock.Config
+	MongoDB       mongodb.Config
+	OAuth         oauth.Config
+	Policies      PolicyConfig
+	Preferences   preferences.Config
+	Presence      presence.Config
+	Privacy       privacy.Config
+	Profiling     profiling.Config
+	Projection    projection.Config
+	Queue         queue.Config
+	LoadShed      LoadShedConfig
+	RateLimit     RateLimitConfig
+	Rates         rates.Config
+	Realtime      realtime.Config
+	Redis         cache.RedisConfig
+	Reports       reports.Config
+	Retention     retention.Config
+	Retries       retrysafe.Config
+	Rewrite       rewrite.Config
+	Routing       routing.Config
+	SAML          saml.Config
+	Schema        SchemaConfig
+	Server        server.Config
+	SignedURLs    signedurl.Config
+	SLO           slo.Config
+	Static        static.Config
+	Status        status.Config
+	Storage       storage.Config
+	Tags          tags.Config
+	Tenancy       tenancy.Config
+	Typeahead     typeahead.Config
+	Uploads       uploads.Config
+	Users         users.Config
+	Validation    validate.Config
+	View          view.Config
+	Watchdog      watchdog.Config
+}
+
+// AdminConfig holds admin dashboard configuration
+type AdminConfig struct {
+	RecentRequests int      `yaml:"recentRequests"` // Requests and errors kept for the dashboard
+	FeatureFlags   []string `yaml:"featureFlags"`   // Flags enabled at startup
+}
+
+// BotConfig holds bot detection configuration. Requests are scored from 0 to 100 on
+// their user agent, headers and rate, and scores from a threshold up are acted on.
+type BotConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	TarpitScore    int           `yaml:"tarpitScore"`    // Delay requests scoring this or more by TarpitDelay
+	ChallengeScore int           `yaml:"challengeScore"` // Require a CAPTCHA, or tarpit without a provider
+	BlockScore     int           `yaml:"blockScore"`     // Reject requests with 403
+	LogScore       int           `yaml:"logScore"`       // Log the signals of requests scoring this or more
+	TarpitDelay    time.Duration `yaml:"tarpitDelay"`
+	RateWindow     time.Duration `yaml:"rateWindow"`    // Window requests per client are counted in
+	RateLimit      int           `yaml:"rateLimit"`     // Requests per RateWindow a client can make before it scores
+	AllowedAgents  []string      `yaml:"allowedAgents"` // User agent substrings never scored, like uptime monitors
+	ExcludePaths   []string      `yaml:"excludePaths"`  // Path prefixes never scored
+}
+
+// CacheConfig holds response cache configuration
+type CacheConfig struct {
+	TTL          time.Duration `yaml:"ttl"`
+	KeyPrefix    string        `yaml:"keyPrefix"`    // Prefix for keys stored in Redis
+	PurgeChannel string        `yaml:"purgeChannel"` // Redis pub/sub channel used to broadcast purges
+
+	LocalSize                int           `yaml:"localSize"` // Max entries in the in-process tier, 0 disables it
+	LocalTTL                 time.Duration `yaml:"localTTL"`
+	LocalInvalidationChannel string        `yaml:"localInvalidationChannel"`
+}
+
+// CaptchaConfig holds CAPTCHA verification configuration for public endpoints
+// abused by bots, like sign-in, registration and password resets
+type CaptchaConfig struct {
+	Provider  string        `yaml:"provider"` // recaptcha, hcaptcha or turnstile; verification is off without one
+	Secret    string        `yaml:"secret"`
+	MinScore  float64       `yaml:"minScore"`  // reCAPTCHA v3 scores below this fail
+	Paths     []string      `yaml:"paths"`     // Path prefixes whose POST requests need a solved CAPTCHA
+	BypassKey string        `yaml:"bypassKey"` // Sent as X-Captcha-Bypass by automated tests to skip verification
+	Timeout   time.Duration `yaml:"timeout"`   // For calls to the provider
+}
+
+// DeadlineConfig holds which clients can shorten the deadline of their requests
+// with a timeout header
+type DeadlineConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Header  string        `yaml:"header"` // X-Request-Timeout by default
+	Roles   []string      `yaml:"roles"`  // Of the subjects trusted with it; every authenticated one when empty
+	Min     time.Duration `yaml:"min"`    // Shorter timeouts are raised to it
+}
+
+// DedupConfig holds duplicate request suppression configuration
+type DedupConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Window           time.Duration `yaml:"window"`           // How long a request's response is replayed to identical retries
+	Methods          []string      `yaml:"methods"`          // Methods that are deduplicated
+	MaxBodyBytes     int64         `yaml:"maxBodyBytes"`     // Larger bodies are not hashed and never deduplicated
+	MaxResponseBytes int64         `yaml:"maxResponseBytes"` // Larger responses are not stored nor replayed
+	ExcludePaths     []string      `yaml:"excludePaths"`     // Path prefixes that are never deduplicated
+}
+
+// EventsConfig selects where domain events are stored and read from
+type EventsConfig struct {
+	StoreEnabled     bool               `yaml:"storeEnabled"`     // Create the SQL event store tables
+	ProjectionSource string             `yaml:"projectionSource"` // "eventstore" or "outbox"
+	Schemas          eventschema.Config `yaml:"schemas"`
+}
+
+// LoadShedConfig holds load shedder configuration
+type LoadShedConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	MaxInFlight   int      `yaml:"maxInFlight"`   // Max concurrent requests before interactive traffic is shed
+	BatchRatio    float64  `yaml:"batchRatio"`    // Fraction of MaxInFlight at which batch traffic is shed
+	CriticalPaths []string `yaml:"criticalPaths"` // Path prefixes that are never shed
+	BatchPaths    []string `yaml:"batchPaths"`    // Path prefixes classified as batch traffic
+}
+
+// PolicyConfig declares middleware per route group, so environments can differ in
+// authentication, limits, caching and timeouts without a rebuild
+type PolicyConfig struct {
+	Policies []RoutePolicy            `yaml:"policies"`
+	Tiers    map[string]RateLimitTier `yaml:"tiers"` // Rate limit tiers policies refer to by name
+}
+
+// RoutePolicy applies to requests whose path matches one of Paths, path.Match
+// patterns or prefixes ending in "/*", and whose method is in Methods if given. Only
+// the first matching policy applies.
+type RoutePolicy struct {
+	Name      string   `json:"name"`
+	Paths     []string `json:"paths"`
+	Methods   []string `json:"methods,omitempty"`
+	Auth      string   `json:"auth,omitempty"`      // none (default), user or admin
+	Roles     []string `json:"roles,omitempty"`     // With user auth, the subject needs one of these roles
+	RateLimit string   `json:"rateLimit,omitempty"` // Tier name
+	CacheTTL  Duration `json:"cacheTtl,omitempty"`  // Cache GET responses for this long; only without auth
+	Timeout   Duration `json:"timeout,omitempty"`   // Deadline for the request context
+}
+
+// RateLimitTier is a per-client limit, applied on top of the global rate limit
+type RateLimitTier struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"`
+}
+
+// Duration is a time.Duration written as a string like "5s" in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// RateLimitConfig holds the default rate limit and override cache settings
+type RateLimitConfig struct {
+	RequestsPerSecond float64       `yaml:"requestsPerSecond"`
+	Burst             int           `yaml:"burst"`
+	OverrideCacheTTL  time.Duration `yaml:"overrideCacheTTL"` // How long database overrides are cached
+}
+
+// SchemaConfig holds how the database schema is kept in line with the modules'
+// migrations at startup
+type SchemaConfig struct {
+	Migrate bool   `yaml:"migrate"` // Apply pending migrations; off when a deployment step runs them
+	Drift   string `yaml:"drift"`   // module.DriftOff, DriftWarn or DriftFail
+}
+
+// Load reads the configuration from environment variables, falling back to defaults
+func Load() Config {
+	return Config{
+		Port: getEnv("PORT", "8080"),
+		Activity: activity.Config{
+			Resources: getEnvList("ACTIVITY_RESOURCES", nil),
+			Fanout:    getEnv("ACTIVITY_FANOUT", activity.FanoutWrite),
+			Store:     os.Getenv("ACTIVITY_STORE"),
+		},
+		Addresses: addresses.Config{
+			Countries: getEnvList("ADDRESS_COUNTRIES", nil),
+			Geocoder: geo.GeocoderConfig{
+				Provider:          os.Getenv("GEOCODER_PROVIDER"),
+				APIKey:            os.Getenv("GEOCODER_API_KEY"),
+				URL:               os.Getenv("GEOCODER_URL"),
+				UserAgent:         getEnv("GEOCODER_USER_AGENT", "go-api"),
+				Timeout:           getEnvDuration("GEOCODER_TIMEOUT", 5*time.Second),
+				RequestsPerSecond: getEnvFloat("GEOCODER_REQUESTS_PER_SECOND", 0),
+				Burst:             getEnvInt("GEOCODER_BURST", 1),
+				CacheTTL:          getEnvDuration("GEOCODER_CACHE_TTL", 24*time.Hour),
+			},
+		},
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+		Admin: AdminConfig{
+			RecentRequests: getEnvInt("ADMIN_RECENT_REQUESTS", 200),
+			FeatureFlags:   getEnvList("FEATURE_FLAGS", nil),
+		},
+		Alerting: alerting.Config{
+			SlackWebhookURL:     os.Getenv("ALERT_SLACK_WEBHOOK_URL"),
+			PagerDutyRoutingKey: os.Getenv("ALERT_PAGERDUTY_ROUTING_KEY"),
+			Rules: getEnvJSON("ALERT_RULES", []alerting.Rule{{
+				Name:      "server_errors",
+				Threshold: 10,
+				Ratio:     0.05,
+				Window:    alerting.Duration(5 * time.Minute),
+				Cooldown:  alerting.Duration(30 * time.Minute),
+			}}),
+		},
+		Analytics: analytics.Config{
+			Sink: os.Getenv("ANALYTICS_SINK"),
+			ClickHouse: analytics.ClickHouseConfig{
+				URL:       getEnv("CLICKHOUSE_URL", "http://localhost:8123"),
+				Database:  getEnv("CLICKHOUSE_DATABASE", "default"),
+				Table:     getEnv("CLICKHOUSE_TABLE", "request_events"),
+				Username:  os.Getenv("CLICKHOUSE_USERNAME"),
+				Password:  os.Getenv("CLICKHOUSE_PASSWORD"),
+				Retention: getEnvDuration("CLICKHOUSE_RETENTION", 0),
+				Timeout:   getEnvDuration("CLICKHOUSE_TIMEOUT", 10*time.Second),
+			},
+			SampleRatio:   getEnvFloat("ANALYTICS_SAMPLE_RATIO", 1),
+			BufferSize:    getEnvInt("ANALYTICS_BUFFER_SIZE", 10000),
+			BatchSize:     getEnvInt("ANALYTICS_BATCH_SIZE", 1000),
+			FlushInterval: getEnvDuration("ANALYTICS_FLUSH_INTERVAL", 5*time.Second),
+			MaxRetries:    getEnvInt("ANALYTICS_MAX_RETRIES", 3),
+			ExcludePaths:  getEnvList("ANALYTICS_EXCLUDE_PATHS", []string{"/health", "/metrics", "/debug"}),
+			RingSize:      getEnvInt("ANALYTICS_RING_SIZE", 10000),
+		},
+		Announcements: announcements.Config{
+			Store:         os.Getenv("ANNOUNCEMENTS_STORE"),
+			PollInterval:  getEnvDuration("ANNOUNCEMENTS_POLL_INTERVAL", 5*time.Second),
+			Heartbeat:     getEnvDuration("ANNOUNCEMENTS_HEARTBEAT", 15*time.Second),
+			StreamTimeout: getEnvDuration("ANNOUNCEMENTS_STREAM_TIMEOUT", 10*time.Minute),
+		},
+		API: apiversion.Config{
+			Prefix:              getEnv("API_PREFIX", "/api"),
+			Default:             getEnv("API_DEFAULT_VERSION", "v1"),
+			Header:              getEnv("API_VERSION_HEADER", "API-Version"),
+			MediaType:           getEnv("API_MEDIA_TYPE", "application/vnd.go-api"),
+			Deprecations:        getEnvJSON("API_DEPRECATIONS", map[string]apiversion.Deprecation(nil)),
+			ClientVersionHeader: getEnv("API_CLIENT_VERSION_HEADER", "X-Client-Version"),
+			UsageFlushInterval:  getEnvDuration("API_USAGE_FLUSH_INTERVAL", time.Minute),
+		},
+		Archive: archive.Config{
+			Enabled:   getEnvBool("ARCHIVE_ENABLED", true),
+			Interval:  getEnvDuration("ARCHIVE_INTERVAL", 24*time.Hour),
+			BatchSize: getEnvInt("ARCHIVE_BATCH_SIZE", 10000),
+			Prefix:    getEnv("ARCHIVE_PREFIX", "archive/"),
+			Policies:  getEnvJSON("ARCHIVE_POLICIES", []archive.Policy(nil)),
+			MaxAges:   getEnvDurationMap("ARCHIVE_MAX_AGES"),
+		},
+		Attachments: attachments.Config{
+			Resources: getEnvList("ATTACHMENTS_RESOURCES", nil),
+			MaxBytes:  int64(getEnvInt("ATTACHMENT_MAX_BYTES", 25<<20)),
+			Store:     os.Getenv("ATTACHMENTS_STORE"),
+		},
+		Authz: authz.Config{
+			ModelPath:      os.Getenv("AUTHZ_MODEL_PATH"),
+			PolicyPath:     os.Getenv("AUTHZ_POLICY_PATH"),
+			ReloadInterval: getEnvDuration("AUTHZ_RELOAD_INTERVAL", 10*time.Second),
+		},
+		Backup: backup.Config{
+			PgDump:    getEnv("BACKUP_PG_DUMP", "pg_dump"),
+			PgRestore: getEnv("BACKUP_PG_RESTORE", "pg_restore"),
+			Prefix:    getEnv("BACKUP_PREFIX", "backups/"),
+			Timeout:   getEnvDuration("BACKUP_TIMEOUT", time.Hour),
+		},
+		Bind: bind.Config{
+			Strict:      getEnvBool("BIND_STRICT", false),
+			TimeLayouts: getEnvList("BIND_TIME_LAYOUTS", nil),
+		},
+		Bots: BotConfig{
+			Enabled:        getEnvBool("BOTS_ENABLED", false),
+			TarpitScore:    getEnvInt("BOTS_TARPIT_SCORE", 50),
+			ChallengeScore: getEnvInt("BOTS_CHALLENGE_SCORE", 70),
+			BlockScore:     getEnvInt("BOTS_BLOCK_SCORE", 90),
+			LogScore:       getEnvInt("BOTS_LOG_SCORE", 30),
+			TarpitDelay:    getEnvDuration("BOTS_TARPIT_DELAY", 3*time.Second),
+			RateWindow:     getEnvDuration("BOTS_RATE_WINDOW", 10*time.Second),
+			RateLimit:      getEnvInt("BOTS_RATE_LIMIT", 50),
+			AllowedAgents:  getEnvList("BOTS_ALLOWED_AGENTS", nil),
+			ExcludePaths:   getEnvList("BOTS_EXCLUDE_PATHS", []string{"/health", "/metrics", "/.well-known"}),
+		},
+		Cache: CacheConfig{
+			TTL:          getEnvDuration("CACHE_TTL", time.Minute),
+			KeyPrefix:    getEnv("CACHE_KEY_PREFIX", "go-api:"),
+			PurgeChannel: getEnv("CACHE_PURGE_CHANNEL", "go-api:cache-purge"),
+
+			LocalSize:                getEnvInt("CACHE_LOCAL_SIZE", 10000),
+			LocalTTL:                 getEnvDuration("CACHE_LOCAL_TTL", 10*time.Second),
+			LocalInvalidationChannel: getEnv("CACHE_LOCAL_INVALIDATION_CHANNEL", "go-api:cache-local"),
+		},
+		Canary: canary.Config{
+			Rollouts: getEnvJSON("CANARY_ROLLOUTS", []canary.Rollout(nil)),
+		},
+		Captcha: CaptchaConfig{
+			Provider:  os.Getenv("CAPTCHA_PROVIDER"),
+			Secret:    os.Getenv("CAPTCHA_SECRET"),
+			MinScore:  getEnvFloat("CAPTCHA_MIN_SCORE", 0.5),
+			Paths:     getEnvList("CAPTCHA_PATHS", []string{"/auth/ldap/login"}),
+			BypassKey: os.Getenv("CAPTCHA_BYPASS_KEY"),
+			Timeout:   getEnvDuration("CAPTCHA_TIMEOUT", 5*time.Second),
+		},
+		CDC: cdc.Config{
+			Enabled:      getEnvBool("CDC_ENABLED", false),
+			Slot:         getEnv("CDC_SLOT", "go_api_cdc"),
+			Publication:  getEnv("CDC_PUBLICATION", "go_api_cdc"),
+			PollInterval: getEnvDuration("CDC_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvInt("CDC_BATCH_SIZE", 1000),
+			Tables:       getEnvList("CDC_TABLES", nil),
+		},
+		ClamAV: clamav.Config{
+			Address: os.Getenv("CLAMAV_ADDRESS"),
+			Timeout: getEnvDuration("CLAMAV_TIMEOUT", time.Minute),
+		},
+		Comments: comments.Config{
+			Resources: getEnvList("COMMENTS_RESOURCES", nil),
+			MaxLength: getEnvInt("COMMENT_MAX_LENGTH", 10000),
+			Store:     os.Getenv("COMMENTS_STORE"),
+		},
+		Consent: consent.Config{
+			Kinds:    getEnvList("CONSENT_KINDS", []string{"terms", "privacy"}),
+			Status:   getEnvInt("CONSENT_STATUS", 403),
+			CacheTTL: getEnvDuration("CONSENT_CACHE_TTL", time.Minute),
+			Store:    os.Getenv("CONSENT_STORE"),
+		},
+		Cost: cost.Config{
+			Enabled:      getEnvBool("COST_ENABLED", false),
+			Window:       getEnvDuration("COST_WINDOW", time.Minute),
+			Budget:       int64(getEnvInt("COST_BUDGET", 600)),
+			Plans:        getEnvJSON("COST_PLAN_BUDGETS", map[string]int64(nil)),
+			Default:      int64(getEnvInt("COST_DEFAULT", 1)),
+			Routes:       getEnvJSON("COST_ROUTES", map[string]int64(nil)),
+			ExcludePaths: getEnvList("COST_EXCLUDE_PATHS", []string{"/admin", "/health", "/metrics", "/status"}),
+		},
+		Database: database.Config{
+			Driver:          getEnv("DB_DRIVER", "pgx"),
+			DSN:             os.Getenv("DATABASE_URL"),
+			MaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			BusyTimeout:     getEnvDuration("DB_BUSY_TIMEOUT", 5*time.Second),
+		},
+		Datetime: datetime.Config{
+			Header:   getEnv("TIMEZONE_HEADER", "Time-Zone"),
+			Default:  getEnv("TIMEZONE_DEFAULT", "UTC"),
+			Tenants:  getEnvJSON("TIMEZONE_TENANTS", map[string]string(nil)),
+			CacheTTL: getEnvDuration("TIMEZONE_CACHE_TTL", time.Minute),
+		},
+		Deadline: DeadlineConfig{
+			Enabled: getEnvBool("DEADLINE_ENABLED", true),
+			Header:  getEnv("DEADLINE_HEADER", "X-Request-Timeout"),
+			Roles:   getEnvList("DEADLINE_ROLES", nil),
+			Min:     getEnvDuration("DEADLINE_MIN", 100*time.Millisecond),
+		},
+		Dedup: DedupConfig{
+			Enabled:          getEnvBool("DEDUP_ENABLED", false),
+			Window:           getEnvDuration("DEDUP_WINDOW", 10*time.Second),
+			Methods:          getEnvList("DEDUP_METHODS", []string{"POST"}),
+			MaxBodyBytes:     int64(getEnvInt("DEDUP_MAX_BODY_BYTES", 1<<20)),
+			MaxResponseBytes: int64(getEnvInt("DEDUP_MAX_RESPONSE_BYTES", 1<<20)),
+			ExcludePaths:     getEnvList("DEDUP_EXCLUDE_PATHS", []string{"/oauth", "/auth", "/saml", "/api/v1/uploads"}),
+		},
+		Discovery: discoveryConfig(),
+		Documents: documents.Config{
+			PDF: pdf.Config{
+				FontFile:     os.Getenv("PDF_FONT_FILE"),
+				BoldFontFile: os.Getenv("PDF_BOLD_FONT_FILE"),
+				PageSize:     getEnv("PDF_PAGE_SIZE", "A4"),
+			},
+			LinkTTL: getEnvDuration("DOCUMENT_LINK_TTL", time.Hour),
+			Store:   os.Getenv("DOCUMENTS_STORE"),
+		},
+		EditLocks: editlock.Config{
+			Enabled:       getEnvBool("EDIT_LOCKS_ENABLED", false),
+			DefaultTTL:    getEnvDuration("EDIT_LOCK_DEFAULT_TTL", 2*time.Minute),
+			MaxTTL:        getEnvDuration("EDIT_LOCK_MAX_TTL", 10*time.Minute),
+			SweepInterval: getEnvDuration("EDIT_LOCK_SWEEP_INTERVAL", 15*time.Second),
+			Resources:     getEnvList("EDIT_LOCK_RESOURCES", []string{"document"}),
+		},
+		Encryption: crypto.Config{
+			Keys:            getEnvStringMap("ENCRYPTION_KEYS"),
+			PrimaryKey:      os.Getenv("ENCRYPTION_PRIMARY_KEY"),
+			VaultAddr:       os.Getenv("VAULT_ADDR"),
+			VaultToken:      os.Getenv("VAULT_TOKEN"),
+			VaultTransitKey: getEnv("VAULT_TRANSIT_KEY", "go-api"),
+		},
+		Events: EventsConfig{
+			StoreEnabled:     getEnvBool("EVENT_STORE_ENABLED", false),
+			ProjectionSource: getEnv("PROJECTION_SOURCE", "eventstore"),
+			Schemas: eventschema.Config{
+				Validation:     getEnv("EVENT_SCHEMA_VALIDATION", eventschema.Reject),
+				Compatibility:  getEnv("EVENT_SCHEMA_COMPATIBILITY", eventschema.Backward),
+				RequireSchemas: getEnvBool("EVENT_SCHEMA_REQUIRED", false),
+				Schemas:        getEnvJSON("EVENT_SCHEMAS", []eventschema.Schema(nil)),
+			},
+		},
+		Experiment: experiment.Config{
+			Experiments: getEnvJSON("EXPERIMENTS", []experiment.Experiment(nil)),
+		},
+		IDs: id.Config{
+			Alphabet:  os.Getenv("ID_ALPHABET"),
+			MinLength: getEnvInt("ID_MIN_LENGTH", 8),
+			Secret:    os.Getenv("ID_SECRET"),
+		},
+		Images: images.Config{
+			MaxBytes:  int64(getEnvInt("IMAGE_MAX_BYTES", 20<<20)),
+			MaxPixels: getEnvInt("IMAGE_MAX_PIXELS", 50_000_000),
+			Sizes: getEnvJSON("IMAGE_SIZES", map[string]images.Size{
+				"thumbnail": {Width: 200, Height: 200, Fit: images.FitCover},
+				"medium":    {Width: 800, Height: 800, Fit: images.FitContain},
+			}),
+			Quality:      getEnvInt("IMAGE_QUALITY", 85),
+			MaxDimension: getEnvInt("IMAGE_MAX_DIMENSION", 2048),
+			ResizeStep:   getEnvInt("IMAGE_RESIZE_STEP", 50),
+			CacheMaxAge:  getEnvDuration("IMAGE_CACHE_MAX_AGE", 30*24*time.Hour),
+			Store:        os.Getenv("IMAGES_STORE"),
+			Cache: cache.RepositoryConfig{
+				TTL:         getEnvDuration("IMAGES_CACHE_TTL", 0),
+				NegativeTTL: getEnvDuration("IMAGES_NEGATIVE_CACHE_TTL", 0),
+			},
+		},
+		JWT: jwks.Config{
+			Algorithm:        getEnv("JWT_SIGNING_ALG", "RS256"),
+			Issuer:           getEnv("JWT_ISSUER", "go-api"),
+			RotationInterval: getEnvDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+			RetentionPeriod:  getEnvDuration("JWT_KEY_RETENTION", 24*time.Hour),
+			RefreshInterval:  getEnvDuration("JWT_KEY_REFRESH_INTERVAL", time.Minute),
+		},
+		Latency: latency.Config{
+			Default: getEnvDuration("LATENCY_BUDGET_DEFAULT", 0),
+			Routes:  getEnvDurationMap("LATENCY_BUDGETS"),
+		},
+		LDAP: ldapauth.Directory{
+			URL:                os.Getenv("LDAP_URL"),
+			StartTLS:           getEnvBool("LDAP_START_TLS", false),
+			InsecureSkipVerify: getEnvBool("LDAP_INSECURE_SKIP_VERIFY", false),
+			BindDN:             os.Getenv("LDAP_BIND_DN"),
+			BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:             os.Getenv("LDAP_BASE_DN"),
+			UserFilter:         os.Getenv("LDAP_USER_FILTER"),
+			GroupRoles:         getEnvJSON("LDAP_GROUP_ROLES", map[string][]string(nil)),
+			DefaultRoles:       getEnvList("LDAP_DEFAULT_ROLES", []string{"user"}),
+			TenantAttribute:    os.Getenv("LDAP_TENANT_ATTRIBUTE"),
+			GroupTenants:       getEnvJSON("LDAP_GROUP_TENANTS", map[string]string(nil)),
+			PoolSize:           getEnvInt("LDAP_POOL_SIZE", 4),
+			Timeout:            getEnvDuration("LDAP_TIMEOUT", 5*time.Second),
+		},
+		Limits: limits.Config{
+			MaxProcs:         getEnvBool("RUNTIME_MAXPROCS", true),
+			MemoryLimitRatio: getEnvFloat("RUNTIME_MEMORY_LIMIT_RATIO", 0.9),
+		},
+		Locations: locations.Config{
+			Resources: getEnvList("LOCATIONS_RESOURCES", nil),
+			Radius:    getEnvFloat("LOCATIONS_RADIUS", 1000),
+			MaxRadius: getEnvFloat("LOCATIONS_MAX_RADIUS", 50_000),
+			PostGIS:   getEnvBool("LOCATIONS_POSTGIS", false),
+			Store:     os.Getenv("LOCATIONS_STORE"),
+		},
+		Logger: logger.Config{
+			Development: getEnvBool("LOG_DEVELOPMENT", true),
+			Level:       getEnv("LOG_LEVEL", "info"),
+			OutputPaths: getEnvList("LOG_OUTPUT_PATHS", nil),
+			MaxSizeMB:   getEnvInt("LOG_MAX_SIZE_MB", 100),
+			MaxBackups:  getEnvInt("LOG_MAX_BACKUPS", 3),
+			MaxAgeDays:  getEnvInt("LOG_MAX_AGE_DAYS", 28),
+		},
+		Mail: mail.Config{
+			Host:     os.Getenv("MAIL_HOST"),
+			Port:     getEnvInt("MAIL_PORT", 0),
+			Username: os.Getenv("MAIL_USERNAME"),
+			Password: os.Getenv("MAIL_PASSWORD"),
+			From:     getEnv("MAIL_FROM", "go-api@localhost"),
+			TLS:      getEnv("MAIL_TLS", "starttls"),
+			Timeout:  getEnvDuration("MAIL_TIMEOUT", 30*time.Second),
+		},
+		MatViews: matview.Config{
+			Enabled:      getEnvBool("MATVIEW_ENABLED", true),
+			PollInterval: getEnvDuration("MATVIEW_POLL_INTERVAL", 30*time.Second),
+			Timeout:      getEnvDuration("MATVIEW_TIMEOUT", 10*time.Minute),
+			Schedules:    getEnvJSON("MATVIEW_SCHEDULES", map[string]string(nil)),
+		},
+		Metrics: metrics.Config{
+			Backend:      getEnv("METRICS_BACKEND", metrics.BackendPrometheus),
+			Interval:     getEnvDuration("METRICS_INTERVAL", 10*time.Second),
+			Prefix:       getEnv("METRICS_PREFIX", "go_api."),
+			Tags:         getEnvStringMap("METRICS_TAGS"),
+			StatsDAddr:   getEnv("STATSD_ADDR", "127.0.0.1:8125"),
+			OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "http://localhost:4318/v1/metrics"),
+			ServiceName:  getEnv("OTEL_SERVICE_NAME", "go-api"),
+		},
+		Mock: mock.Config{
+			Spec:        getEnv("MOCK_SPEC", "pkg/client/openapi.json"),
+			Latency:     getEnvDuration("MOCK_LATENCY", 0),
+			Jitter:      getEnvDuration("MOCK_JITTER", 0),
+			ErrorRate:   getEnvFloat("MOCK_ERROR_RATE", 0),
+			ErrorStatus: getEnvInt("MOCK_ERROR_STATUS", 500),
+		},
+		MongoDB: mongodb.Config{
+			URI:            os.Getenv("MONGODB_URI"),
+			Database:       getEnv("MONGODB_DATABASE", "go-api"),
+			ConnectTimeout: getEnvDuration("MONGODB_CONNECT_TIMEOUT", 10*time.Second),
+			MaxPoolSize:    uint64(getEnvInt("MONGODB_MAX_POOL_SIZE", 100)),
+		},
+		OAuth: oauth.Config{
+			AccessTokenTTL: getEnvDuration("OAUTH_ACCESS_TOKEN_TTL", time.Hour),
+			CodeTTL:        getEnvDuration("OAUTH_CODE_TTL", 10*time.Minute),
+		},
+		Policies: PolicyConfig{
+			Policies: getEnvJSON("ROUTE_POLICIES", []RoutePolicy(nil)),
+			Tiers:    getEnvJSON("ROUTE_RATE_LIMIT_TIERS", map[string]RateLimitTier(nil)),
+		},
+		Preferences: preferences.Config{
+			Definitions: getEnvJSON("SETTINGS_DEFINITIONS", []settings.Definition(nil)),
+			CacheTTL:    getEnvDuration("SETTINGS_CACHE_TTL", 5*time.Minute),
+			Store:       os.Getenv("SETTINGS_STORE"),
+		},
+		Presence: presence.Config{
+			Enabled:       getEnvBool("PRESENCE_ENABLED", false),
+			TTL:           getEnvDuration("PRESENCE_TTL", time.Minute),
+			SweepInterval: getEnvDuration("PRESENCE_SWEEP_INTERVAL", 15*time.Second),
+		},
+		Privacy: privacy.Config{
+			ExportDir: getEnv("PRIVACY_EXPORT_DIR", filepath.Join(os.TempDir(), "go-api-exports")),
+			ExportTTL: getEnvDuration("PRIVACY_EXPORT_TTL", 7*24*time.Hour),
+		},
+		Profiling: profiling.Config{
+			ServerAddress: os.Getenv("PROFILING_SERVER_ADDRESS"),
+			AppName:       getEnv("PROFILING_APP_NAME", "go-api"),
+			Tags:          getEnvStringMap("PROFILING_TAGS"),
+			Interval:      getEnvDuration("PROFILING_INTERVAL", time.Minute),
+			CPUDuration:   getEnvDuration("PROFILING_CPU_DURATION", 10*time.Second),
+			SampleRatio:   getEnvFloat("PROFILING_SAMPLE_RATIO", 1),
+			Heap:          getEnvBool("PROFILING_HEAP", true),
+			MaxLoad:       int64(getEnvInt("PROFILING_MAX_LOAD", 200)),
+			PprofRoutes:   getEnvBool("PROFILING_PPROF_ROUTES", false),
+		},
+		Projection: projection.Config{
+			PollInterval: getEnvDuration("PROJECTION_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvInt("PROJECTION_BATCH_SIZE", 500),
+		},
+		Queue: queue.Config{
+			Queues:             getEnvIntMap("QUEUES", map[string]int{"default": 4}),
+			MaxAttempts:        getEnvInt("QUEUE_MAX_ATTEMPTS", 5),
+			RetryBackoff:       getEnvDuration("QUEUE_RETRY_BACKOFF", 5*time.Second),
+			CompletedRetention: getEnvDuration("QUEUE_COMPLETED_RETENTION", time.Hour),
+			PollInterval:       getEnvDuration("QUEUE_POLL_INTERVAL", time.Second),
+		},
+		LoadShed: LoadShedConfig{
+			Enabled:       getEnvBool("LOAD_SHED_ENABLED", true),
+			MaxInFlight:   getEnvInt("LOAD_SHED_MAX_IN_FLIGHT", 256),
+			BatchRatio:    getEnvFloat("LOAD_SHED_BATCH_RATIO", 0.5),
+			CriticalPaths: getEnvList("LOAD_SHED_CRITICAL_PATHS", []string{"/health"}),
+			BatchPaths:    getEnvList("LOAD_SHED_BATCH_PATHS", []string{"/export", "/bulk"}),
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond: getEnvFloat("RATE_LIMIT_RPS", 1),
+			Burst:             getEnvInt("RATE_LIMIT_BURST", 20),
+			OverrideCacheTTL:  getEnvDuration("RATE_LIMIT_OVERRIDE_TTL", 30*time.Second),
+		},
+		Rates: rates.Config{
+			Provider: getEnv("RATES_PROVIDER", "ecb"),
+			URL:      os.Getenv("RATES_URL"),
+			AppID:    os.Getenv("RATES_APP_ID"),
+			Base:     os.Getenv("RATES_BASE"),
+			Static:   getEnvStringMap("RATES_STATIC"),
+			Schedule: getEnv("RATES_SCHEDULE", "0 * * * *"),
+			MaxAge:   getEnvDuration("RATES_MAX_AGE", 96*time.Hour),
+			CacheTTL: getEnvDuration("RATES_CACHE_TTL", time.Hour),
+			Timeout:  getEnvDuration("RATES_TIMEOUT", 10*time.Second),
+			Store:    os.Getenv("RATES_STORE"),
+		},
+		Realtime: realtime.Config{
+			Enabled:          getEnvBool("REALTIME_ENABLED", false),
+			PollInterval:     getEnvDuration("REALTIME_POLL_INTERVAL", time.Second),
+			Origins:          getEnvList("REALTIME_ORIGINS", nil),
+			MaxSubscriptions: getEnvInt("REALTIME_MAX_SUBSCRIPTIONS", 20),
+			ReplayLimit:      getEnvInt("REALTIME_REPLAY_LIMIT", 1000),
+			PingInterval:     getEnvDuration("REALTIME_PING_INTERVAL", 30*time.Second),
+			Buffer:           getEnvInt("REALTIME_BUFFER", 256),
+		},
+		Redis: cache.RedisConfig{
+			Addr:     os.Getenv("REDIS_ADDR"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       getEnvInt("REDIS_DB", 0),
+		},
+		Reports: reports.Config{
+			MaxRows:        getEnvInt("REPORT_MAX_ROWS", 100_000),
+			QueryTimeout:   getEnvDuration("REPORT_QUERY_TIMEOUT", 2*time.Minute),
+			PollInterval:   getEnvDuration("REPORT_POLL_INTERVAL", 30*time.Second),
+			RunRetention:   getEnvDuration("REPORT_RUN_RETENTION", 30*24*time.Hour),
+			WebhookSecret:  os.Getenv("REPORT_WEBHOOK_SECRET"),
+			WebhookTimeout: getEnvDuration("REPORT_WEBHOOK_TIMEOUT", 30*time.Second),
+		},
+		Retention: retention.Config{
+			Enabled:   getEnvBool("RETENTION_ENABLED", true),
+			Interval:  getEnvDuration("RETENTION_INTERVAL", time.Hour),
+			BatchSize: getEnvInt("RETENTION_BATCH_SIZE", 1000),
+			DryRun:    getEnvBool("RETENTION_DRY_RUN", false),
+			MaxAges:   getEnvDurationMap("RETENTION_MAX_AGES"),
+		},
+		Retries: retrysafe.Config{
+			Routes:     getEnvJSON("RETRY_CLASSES", map[string]retrysafe.Class(nil)),
+			Audit:      getEnvList("RETRY_AUDIT", []string{"/api/"}),
+			RetryAfter: getEnvDuration("RETRY_AFTER", time.Second),
+		},
+		Rewrite: rewrite.Config{
+			Rules: getEnvJSON("REWRITE_RULES", []rewrite.Rule(nil)),
+		},
+		Routing: routing.Config{
+			TrailingSlash:   getEnv("ROUTING_TRAILING_SLASH", routing.TrailingSlashRedirect),
+			CollapseSlashes: getEnvBool("ROUTING_COLLAPSE_SLASHES", true),
+			CaseInsensitive: getEnvBool("ROUTING_CASE_INSENSITIVE", false),
+			UnknownQuery:    getEnv("ROUTING_UNKNOWN_QUERY", routing.UnknownQueryWarn),
+		},
+		SAML: saml.Config{
+			BaseURL:  getEnv("SAML_BASE_URL", "http://localhost:8080"),
+			CertPath: os.Getenv("SAML_CERT_PATH"),
+			KeyPath:  os.Getenv("SAML_KEY_PATH"),
+		},
+		Schema: SchemaConfig{
+			Migrate: getEnvBool("SCHEMA_MIGRATE", true),
+			Drift:   getEnv("SCHEMA_DRIFT", module.DriftWarn),
+		},
+		Server: server.Config{
+			Listeners:         getEnvJSON("SERVER_LISTENERS", defaultListeners()),
+			ReadHeaderTimeout: getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+			ShutdownTimeout:   getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", 15*time.Second),
+			ReadinessPath:     getEnv("SERVER_READINESS_PATH", "/ready"),
+			DrainDelay:        getEnvDuration("SERVER_DRAIN_DELAY", 0),
+		},
+		SignedURLs: signedurl.Config{
+			Keys:       getEnvStringMap("SIGNED_URL_KEYS"),
+			PrimaryKey: os.Getenv("SIGNED_URL_PRIMARY_KEY"),
+			TTL:        getEnvDuration("SIGNED_URL_TTL", 24*time.Hour),
+		},
+		SLO: slo.Config{
+			Objectives: getEnvJSON("SLO_OBJECTIVES", []slo.Objective{{
+				Name:          "api",
+				Prefix:        "/",
+				Availability:  0.999,
+				Latency:       500 * time.Millisecond,
+				LatencyTarget: 0.99,
+				Window:        24 * time.Hour,
+			}}),
+		},
+		Static: static.Config{
+			Enabled:     getEnvBool("STATIC_ENABLED", false),
+			Dir:         os.Getenv("STATIC_DIR"),
+			Index:       getEnv("STATIC_INDEX", "index.html"),
+			APIPrefixes: getEnvList("STATIC_API_PREFIXES", []string{"/api", "/admin", "/health", "/oauth", "/.well-known", "/saml", "/auth", "/me", "/operations", "/debug"}),
+		},
+		Status: status.Config{
+			Enabled:    getEnvBool("STATUS_ENABLED", false),
+			Interval:   getEnvDuration("STATUS_INTERVAL", time.Minute),
+			Timeout:    getEnvDuration("STATUS_TIMEOUT", 5*time.Second),
+			Days:       getEnvInt("STATUS_DAYS", 90),
+			Components: getEnvJSON("STATUS_COMPONENTS", []status.Component(nil)),
+		},
+		Storage: storage.Config{
+			Backend: getEnv("STORAGE_BACKEND", "local"),
+			Dir:     getEnv("STORAGE_DIR", filepath.Join(os.TempDir(), "go-api-storage")),
+		},
+		Tags: tags.Config{
+			Resources:      getEnvList("TAGS_RESOURCES", nil),
+			MaxPerResource: getEnvInt("TAGS_MAX_PER_RESOURCE", 50),
+			Store:          os.Getenv("TAGS_STORE"),
+		},
+		Tenancy: tenancy.Config{
+			CacheTTL:       getEnvDuration("TENANT_CACHE_TTL", 30*time.Second),
+			MaxOpenConns:   getEnvInt("TENANT_MAX_OPEN_CONNS", 5),
+			MaxIdleConns:   getEnvInt("TENANT_MAX_IDLE_CONNS", 2),
+			MigrateOnStart: getEnvBool("TENANT_MIGRATE_ON_START", true),
+			SchemaPrefix:   getEnv("TENANT_SCHEMA_PREFIX", "tenant_"),
+		},
+		Typeahead: typeahead.Config{
+			Sources:           getEnvList("TYPEAHEAD_SOURCES", nil),
+			MinLength:         getEnvInt("TYPEAHEAD_MIN_LENGTH", 2),
+			Limit:             getEnvInt("TYPEAHEAD_LIMIT", 10),
+			IndexTTL:          getEnvDuration("TYPEAHEAD_INDEX_TTL", time.Minute),
+			CacheTTL:          getEnvDuration("TYPEAHEAD_CACHE_TTL", 30*time.Second),
+			RequestsPerSecond: getEnvFloat("TYPEAHEAD_REQUESTS_PER_SECOND", 5),
+			Burst:             getEnvInt("TYPEAHEAD_BURST", 10),
+		},
+		Uploads: uploads.Config{
+			MaxSize: int64(getEnvInt("UPLOAD_MAX_SIZE", 5<<30)),
+			Expiry:  getEnvDuration("UPLOAD_EXPIRY", 24*time.Hour),
+			Store:   os.Getenv("UPLOADS_STORE"),
+		},
+		Users: users.Config{
+			TokenTTL: getEnvDuration("USER_TOKEN_TTL", time.Hour),
+			Phone: users.PhoneConfig{
+				CodeLength:       getEnvInt("PHONE_CODE_LENGTH", 6),
+				CodeTTL:          getEnvDuration("PHONE_CODE_TTL", 10*time.Minute),
+				MaxAttempts:      getEnvInt("PHONE_MAX_ATTEMPTS", 5),
+				ResendAfter:      getEnvDuration("PHONE_RESEND_AFTER", 30*time.Second),
+				MaxSends:         getEnvInt("PHONE_MAX_SENDS", 5),
+				SendWindow:       getEnvDuration("PHONE_SEND_WINDOW", time.Hour),
+				TwilioAccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+				TwilioAuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+				TwilioFrom:       os.Getenv("TWILIO_FROM"),
+			},
+		},
+		Validation: validate.Config{
+			EnumCacheTTL: getEnvDuration("VALIDATION_ENUM_CACHE_TTL", time.Minute),
+			EnumTimeout:  getEnvDuration("VALIDATION_ENUM_TIMEOUT", 2*time.Second),
+		},
+		View: view.Config{
+			Dir:           os.Getenv("VIEW_DIR"),
+			Reload:        getEnvBool("VIEW_RELOAD", false),
+			DefaultLayout: getEnv("VIEW_DEFAULT_LAYOUT", "base"),
+		},
+		Watchdog: watchdog.Config{
+			Interval:      getEnvDuration("WATCHDOG_INTERVAL", 10*time.Second),
+			History:       getEnvInt("WATCHDOG_HISTORY", 60),
+			MaxGoroutines: getEnvInt("WATCHDOG_MAX_GOROUTINES", 10000),
+			MaxHeapBytes:  uint64(getEnvInt("WATCHDOG_MAX_HEAP_BYTES", 1<<30)),
+			MaxGCPause:    getEnvDuration("WATCHDOG_MAX_GC_PAUSE", 100*time.Millisecond),
+			GrowthSamples: getEnvInt("WATCHDOG_GROWTH_SAMPLES", 30),
+			DumpCooldown:  getEnvDuration("WATCHDOG_DUMP_COOLDOWN", 10*time.Minute),
+		},
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+// defaultListeners serves everything on PORT, or on the socket systemd passed when
+// socket activated, unless SERVER_ADMIN_ADDRESS moves the admin, debug and metrics
+// endpoints to their own TCP address, "unix:" socket or "systemd:" named socket
+func defaultListeners() []server.Listener {
+	public := server.Listener{
+		Name:        "public",
+		Address:     ":" + getEnv("PORT", "8080"),
+		H2C:         getEnvBool("SERVER_H2C", false),
+		TLSCertFile: os.Getenv("SERVER_TLS_CERT_FILE"),
+		TLSKeyFile:  os.Getenv("SERVER_TLS_KEY_FILE"),
+		HTTP3:       getEnvBool("SERVER_HTTP3", false),
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		public.Network, public.Address = server.NetworkSystemd, os.Getenv("SERVER_SYSTEMD_SOCKET")
+	}
+	address := os.Getenv("SERVER_ADMIN_ADDRESS")
+	if address == "" {
+		return []server.Listener{public}
+	}
+
+	paths := getEnvList("SERVER_ADMIN_PATHS", []string{"/admin", "/debug", "/metrics"})
+	public.Exclude = paths
+	admin := server.Listener{Name: "admin", Network: server.NetworkTCP, Address: address, Include: paths}
+	if socket, ok := strings.CutPrefix(address, "unix:"); ok {
+		admin.Network, admin.Address = server.NetworkUnix, socket
+		admin.SocketMode = getEnv("SERVER_ADMIN_SOCKET_MODE", "0660")
+	} else if name, ok := strings.CutPrefix(address, "systemd:"); ok {
+		admin.Network, admin.Address = server.NetworkSystemd, name
+	}
+	return []server.Listener{public, admin}
+}
+
+// discoveryConfig registers this instance under its hostname and public port unless
+// told otherwise; the ID has to stay unique when several instances share a host
+func discoveryConfig() discovery.Config {
+	backend := os.Getenv("DISCOVERY_BACKEND")
+	address := "http://127.0.0.1:8500"
+	if backend == "etcd" {
+		address = "http://127.0.0.1:2379"
+	}
+	hostname, _ := os.Hostname()
+	name := getEnv("DISCOVERY_SERVICE_NAME", "go-api")
+	host := getEnv("DISCOVERY_SERVICE_ADDRESS", hostname)
+	port := getEnvInt("DISCOVERY_SERVICE_PORT", getEnvInt("PORT", 8080))
+
+	return discovery.Config{
+		Backend: backend,
+		Address: getEnv("DISCOVERY_ADDRESS", address),
+		Token:   os.Getenv("DISCOVERY_TOKEN"),
+		Service: discovery.Instance{
+			ID:      getEnv("DISCOVERY_SERVICE_ID", name+"-"+host+"-"+strconv.Itoa(port)),
+			Name:    name,
+			Address: host,
+			Port:    port,
+			Tags:    getEnvList("DISCOVERY_TAGS", nil),
+		},
+		HealthURL: os.Getenv("DISCOVERY_HEALTH_URL"),
+		Interval:  getEnvDuration("DISCOVERY_INTERVAL", 10*time.Second),
+		TTL:       getEnvDuration("DISCOVERY_TTL", 30*time.Second),
+		Prefix:    getEnv("DISCOVERY_PREFIX", "/services/"),
+		Suffix:    getEnv("DISCOVERY_SUFFIX", ".service"),
+		CacheTTL:  getEnvDuration("DISCOVERY_CACHE_TTL", 10*time.Second),
+	}
+}
+
+// getEnvJSON decodes a JSON value, for settings too structured for a list
+func getEnvJSON[T any](key string, fallback T) T {
+	var v T
+	if err := json.Unmarshal([]byte(os.Getenv(key)), &v); err != nil {
+		return fallback
+	}
+	return v
+}
+
+// getEnvList reads a comma-separated list, trimming whitespace around each item
+func getEnvList(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvIntMap reads comma-separated name:value pairs, e.g. "default:4,exports:1"
+func getEnvIntMap(key string, fallback map[string]int) map[string]int {
+	items := getEnvList(key, nil)
+	if len(items) == 0 {
+		return fallback
+	}
+
+	m := make(map[string]int, len(items))
+	for _, item := range items {
+		name, value, _ := strings.Cut(item, ":")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			n = 1
+		}
+		m[strings.TrimSpace(name)] = n
+	}
+	return m
+}
+
+// getEnvStringMap reads "name:value,..." pairs
+func getEnvStringMap(key string) map[string]string {
+	m := make(map[string]string)
+	for _, item := range getEnvList(key, nil) {
+		name, value, _ := strings.Cut(item, ":")
+		m[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return m
+}
+
+// getEnvDurationMap reads "name:duration,..." pairs, skipping invalid durations
+func getEnvDurationMap(key string) map[string]time.Duration {
+	m := make(map[string]time.Duration)
+	for _, item := range getEnvList(key, nil) {
+		// Names may contain colons themselves, durations never do
+		i := strings.LastIndex(item, ":")
+		if i < 0 {
+			continue
+		}
+		name, value := item[:i], item[i+1:]
+		if d, err := time.ParseDuration(strings.TrimSpace(value)); err == nil {
+			m[strings.TrimSpace(name)] = d
+		}
+	}
+	return m
+}
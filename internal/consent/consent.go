@@ -0,0 +1,254 @@
+// Package consent is the feature module recording which versions of the terms of
+// service, privacy policy and other documents users accepted, when and from where.
+// Once a new version takes effect, signed-in users are refused every API operation
+// but the consent ones with a CONSENT_REQUIRED error until they accept it.
+// Versions are published through the admin API, optionally taking effect later,
+// so users can accept them ahead of time.
+package consent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/authz"
+	"go-api/pkg/cache"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CodeConsentRequired is the error code of requests refused until the user accepts
+// the versions in the details
+const CodeConsentRequired = "CONSENT_REQUIRED"
+
+// Config holds consent configuration
+type Config struct {
+	Kinds    []string      `yaml:"kinds"`    // Documents users accept, like terms and privacy
+	Status   int           `yaml:"status"`   // Of refused requests, 403 or 426
+	CacheTTL time.Duration `yaml:"cacheTTL"` // Of published versions and acceptances read by the middleware
+	Store    string        `yaml:"store"`    // memory or sql; the database by default
+}
+
+// Version is a published version of a document
+type Version struct {
+	Kind        string    `json:"kind"`
+	Version     string    `json:"version"`
+	Title       string    `json:"title,omitempty"`
+	URL         string    `json:"url"`               // Where the document can be read
+	Summary     string    `json:"summary,omitempty"` // Of the changes since the previous version
+	EffectiveAt time.Time `json:"effectiveAt"`       // From when it has to be accepted
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+// Acceptance is a user's acceptance of a version, kept as evidence
+type Acceptance struct {
+	UserID     string    `json:"userId"`
+	Kind       string    `json:"kind"`
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+type consentModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	cache   cache.Cache
+	exempt  map[string]bool // Full paths of the consent routes, which stay reachable
+}
+
+// New returns the factory of the consent module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if len(cfg.Kinds) == 0 {
+			cfg.Kinds = []string{"terms", "privacy"}
+		}
+		if cfg.Status != http.StatusForbidden && cfg.Status != http.StatusUpgradeRequired {
+			cfg.Status = http.StatusForbidden
+		}
+		if cfg.CacheTTL <= 0 {
+			cfg.CacheTTL = time.Minute
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("consent: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("consent: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &consentModule{cfg: cfg, backend: backend, store: store, cache: deps.Cache, exempt: make(map[string]bool)}, nil
+	}
+}
+
+func (m *consentModule) Name() string { return "consent" }
+
+func (m *consentModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// versionsKey caches every published version, as the middleware reads them on
+// each request
+const versionsKey = "consent:versions"
+
+// versions returns the published versions of every kind, newest effective first
+func (m *consentModule) versions(ctx context.Context) ([]Version, error) {
+	if raw, ok, err := m.cache.Get(ctx, versionsKey); err == nil && ok {
+		var list []Version
+		if json.Unmarshal(raw, &list) == nil {
+			return list, nil
+		}
+	}
+	list, err := m.store.Versions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	if raw, err := json.Marshal(list); err == nil {
+		m.cache.Set(ctx, versionsKey, raw, m.cfg.CacheTTL)
+	}
+	return list, nil
+}
+
+// current returns the version of each kind in effect at now, and the newest
+// versions published to take effect later
+func current(versions []Version, now time.Time) (inEffect, upcoming map[string]Version) {
+	inEffect, upcoming = map[string]Version{}, map[string]Version{}
+	for _, v := range versions {
+		if v.EffectiveAt.After(now) {
+			if u, ok := upcoming[v.Kind]; !ok || v.EffectiveAt.After(u.EffectiveAt) {
+				upcoming[v.Kind] = v
+			}
+			continue
+		}
+		if c, ok := inEffect[v.Kind]; !ok || v.EffectiveAt.After(c.EffectiveAt) {
+			inEffect[v.Kind] = v
+		}
+	}
+	return inEffect, upcoming
+}
+
+func acceptedKey(userID string, v Version) string {
+	return "consent:accepted:" + userID + ":" + v.Kind + ":" + v.Version
+}
+
+// accepted reports whether the user accepted v. Only acceptances are cached, so
+// accepting takes effect right away.
+func (m *consentModule) accepted(ctx context.Context, userID string, v Version) (bool, error) {
+	key := acceptedKey(userID, v)
+	if _, ok, err := m.cache.Get(ctx, key); err == nil && ok {
+		return true, nil
+	}
+	ok, err := m.store.Accepted(ctx, userID, v.Kind, v.Version)
+	if err != nil || !ok {
+		return false, err
+	}
+	m.cache.Set(ctx, key, []byte{1}, m.cfg.CacheTTL)
+	return true, nil
+}
+
+// pending returns the versions in effect the user hasn't accepted, in kind order
+func (m *consentModule) pending(ctx context.Context, userID string) ([]Version, error) {
+	versions, err := m.versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inEffect, _ := current(versions, time.Now())
+	var pending []Version
+	for _, kind := range m.cfg.Kinds {
+		v, ok := inEffect[kind]
+		if !ok {
+			continue
+		}
+		accepted, err := m.accepted(ctx, userID, v)
+		if err != nil {
+			return nil, err
+		}
+		if !accepted {
+			pending = append(pending, v)
+		}
+	}
+	return pending, nil
+}
+
+// Middleware refuses the requests of signed-in users to every operation but the
+// consent ones while a version in effect is not accepted. The details list what to
+// accept. Anonymous requests are left to the authentication of the operations.
+func (m *consentModule) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, ok := authz.SubjectFromContext(c.Request.Context())
+		if !ok || sub.ID == "" || m.exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+		pending, err := m.pending(c.Request.Context(), sub.ID)
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		if len(pending) > 0 {
+			c.Error(&apperrors.AppError{
+				Code:       CodeConsentRequired,
+				Message:    "The latest terms have to be accepted first",
+				StatusCode: m.cfg.Status,
+				Details:    pending,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// publish adds a version and drops the cached versions
+func (m *consentModule) publish(ctx context.Context, v Version) error {
+	if !slices.Contains(m.cfg.Kinds, v.Kind) {
+		return apperrors.NewValidationError("Unknown document kind", apperrors.FieldError{
+			Field: "kind", Rule: "oneof", Param: strings.Join(m.cfg.Kinds, " "), Message: "kind must be one of " + strings.Join(m.cfg.Kinds, ", "),
+		})
+	}
+	if err := m.store.Publish(ctx, v); err != nil {
+		return err
+	}
+	return m.cache.Delete(ctx, versionsKey)
+}
+
+// accept records the user's acceptance of a version in effect or upcoming; older
+// versions can't be accepted anymore. Versions are read afresh, so a version just
+// published can be accepted right away.
+func (m *consentModule) accept(ctx context.Context, a Acceptance) error {
+	versions, err := m.store.Versions(ctx, a.Kind)
+	if err != nil {
+		return err
+	}
+	inEffect, upcoming := current(versions, a.AcceptedAt)
+	if a.Version != inEffect[a.Kind].Version && a.Version != upcoming[a.Kind].Version {
+		return apperrors.NewConflictError("Only the version in effect or the next one can be accepted")
+	}
+	return m.store.Accept(ctx, a)
+}
+
+// ExportPersonalData returns the acceptances of the user
+func (m *consentModule) ExportPersonalData(ctx context.Context, userID string) (any, error) {
+	return m.store.Acceptances(ctx, userID)
+}
+
+// ErasePersonalData keeps the acceptances of the user, as evidence of what the
+// anonymized account agreed to, but drops where they were made from
+func (m *consentModule) ErasePersonalData(ctx context.Context, userID string) error {
+	return m.store.Anonymize(ctx, userID)
+}
@@ -0,0 +1,181 @@
+package consent
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retrysafe"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes mounts the consent endpoints, which need the signed-in user and stay
+// reachable while consent is required
+func (m *consentModule) Routes(api *apiversion.Group) {
+	tags := []string{"consent"}
+	api.GET("/consents", apiversion.Operation{
+		ID:          "getConsents",
+		Summary:     "Get the documents to accept and whether they are",
+		Description: "Lists each document's version in effect and the next one, if published, with the user's acceptance. Other operations answer CONSENT_REQUIRED while a version in effect isn't accepted.",
+		Tags:        tags,
+		Response:    []Status{},
+	}, m.status)
+	api.POST("/consents", apiversion.Operation{
+		ID:          "acceptConsent",
+		Summary:     "Accept a version of a document",
+		Description: "Only the version in effect or the next one can be accepted; the time, IP address and User-Agent are recorded.",
+		Tags:        tags,
+		Request:     acceptRequest{},
+		Response:    Acceptance{},
+		Idempotency: retrysafe.Idempotent, // Accepting again keeps the first acceptance
+	}, m.acceptVersion)
+	m.exempt[api.BasePath()+"/consents"] = true
+}
+
+// AdminRoutes mounts version publishing and the acceptances of users on the admin group
+func (m *consentModule) AdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/consents/versions", routing.Query("kind"), m.listVersions)
+	rg.POST("/consents/versions", m.publishVersion)
+	rg.GET("/consents/users/:id", m.userAcceptances)
+}
+
+// Status is a document a user has to accept
+type Status struct {
+	Kind       string     `json:"kind"`
+	Current    *Version   `json:"current,omitempty"` // Version in effect
+	Accepted   bool       `json:"accepted"`          // Whether the version in effect is
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+	Upcoming   *Version   `json:"upcoming,omitempty"` // Next version, which can be accepted ahead of time
+}
+
+// signedIn returns the ID of the signed-in user
+func signedIn(c *gin.Context) (string, bool) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return "", false
+	}
+	return sub.ID, true
+}
+
+func (m *consentModule) status(c *gin.Context) {
+	userID, ok := signedIn(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	versions, err := m.store.Versions(ctx, "")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	acceptances, err := m.store.Acceptances(ctx, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	inEffect, upcoming := current(versions, time.Now())
+
+	list := make([]Status, 0, len(m.cfg.Kinds))
+	for _, kind := range m.cfg.Kinds {
+		s := Status{Kind: kind}
+		if v, ok := inEffect[kind]; ok {
+			s.Current = &v
+			for _, a := range acceptances {
+				if a.Kind == kind && a.Version == v.Version {
+					s.Accepted, s.AcceptedAt = true, &a.AcceptedAt
+					break
+				}
+			}
+		} else {
+			s.Accepted = true // Nothing to accept yet
+		}
+		if v, ok := upcoming[kind]; ok {
+			s.Upcoming = &v
+		}
+		list = append(list, s)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+type acceptRequest struct {
+	Kind    string `json:"kind" binding:"required"`
+	Version string `json:"version" binding:"required"`
+}
+
+func (m *consentModule) acceptVersion(c *gin.Context) {
+	userID, ok := signedIn(c)
+	if !ok {
+		return
+	}
+	var req acceptRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid acceptance", err))
+		return
+	}
+	a := Acceptance{
+		UserID:     userID,
+		Kind:       req.Kind,
+		Version:    req.Version,
+		AcceptedAt: time.Now().UTC(),
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if err := m.accept(c.Request.Context(), a); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, a)
+}
+
+func (m *consentModule) listVersions(c *gin.Context) {
+	list, err := m.store.Versions(c.Request.Context(), c.Query("kind"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+type publishRequest struct {
+	Kind        string     `json:"kind" binding:"required"`
+	Version     string     `json:"version" binding:"required,max=100"`
+	Title       string     `json:"title" binding:"omitempty,max=200"`
+	URL         string     `json:"url" binding:"required,url"`
+	Summary     string     `json:"summary" binding:"omitempty,max=2000"`
+	EffectiveAt *time.Time `json:"effectiveAt"` // Right away when omitted
+}
+
+// publishVersion publishes a version, which users have to accept once it takes effect
+func (m *consentModule) publishVersion(c *gin.Context) {
+	var req publishRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid version", err))
+		return
+	}
+	now := time.Now().UTC()
+	v := Version{Kind: req.Kind, Version: req.Version, Title: req.Title, URL: req.URL, Summary: req.Summary,
+		EffectiveAt: now, PublishedAt: now}
+	if req.EffectiveAt != nil {
+		v.EffectiveAt = req.EffectiveAt.UTC()
+	}
+	if err := m.publish(c.Request.Context(), v); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, v)
+}
+
+func (m *consentModule) userAcceptances(c *gin.Context) {
+	list, err := m.store.Acceptances(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
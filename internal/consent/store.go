@@ -0,0 +1,226 @@
+package consent
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+)
+
+// Store persists published versions and acceptances
+type Store interface {
+	// Publish adds a version, failing with a conflict when it exists
+	Publish(ctx context.Context, v Version) error
+	// Versions lists the versions of kind, or of every kind when empty, newest
+	// effective first
+	Versions(ctx context.Context, kind string) ([]Version, error)
+	// Accept records an acceptance; accepting a version again keeps the first one
+	Accept(ctx context.Context, a Acceptance) error
+	Accepted(ctx context.Context, userID, kind, version string) (bool, error)
+	// Acceptances lists the acceptances of a user, latest first
+	Acceptances(ctx context.Context, userID string) ([]Acceptance, error)
+	// Anonymize blanks where the acceptances of a user were made from
+	Anonymize(ctx context.Context, userID string) error
+}
+
+var errVersionExists = apperrors.NewConflictError("Version already published")
+
+// MemoryStore keeps consent records in memory, used when no database is configured
+type MemoryStore struct {
+	mu          sync.Mutex
+	versions    []Version
+	acceptances map[string][]Acceptance // By user
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{acceptances: make(map[string][]Acceptance)}
+}
+
+func (s *MemoryStore) Publish(ctx context.Context, v Version) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.versions {
+		if existing.Kind == v.Kind && existing.Version == v.Version {
+			return errVersionExists
+		}
+	}
+	s.versions = append(s.versions, v)
+	return nil
+}
+
+func (s *MemoryStore) Versions(ctx context.Context, kind string) ([]Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Version{}
+	for _, v := range s.versions {
+		if kind == "" || v.Kind == kind {
+			list = append(list, v)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].EffectiveAt.After(list[j].EffectiveAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) Accept(ctx context.Context, a Acceptance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.acceptances[a.UserID] {
+		if existing.Kind == a.Kind && existing.Version == a.Version {
+			return nil
+		}
+	}
+	s.acceptances[a.UserID] = append(s.acceptances[a.UserID], a)
+	return nil
+}
+
+func (s *MemoryStore) Accepted(ctx context.Context, userID, kind, version string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.acceptances[userID] {
+		if a.Kind == kind && a.Version == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) Acceptances(ctx context.Context, userID string) ([]Acceptance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := append([]Acceptance{}, s.acceptances[userID]...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].AcceptedAt.After(list[j].AcceptedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) Anonymize(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.acceptances[userID] {
+		s.acceptances[userID][i].IP, s.acceptances[userID][i].UserAgent = "", ""
+	}
+	return nil
+}
+
+// migrations create the consent_versions and consent_acceptances tables
+var migrations = []module.Migration{{
+	Name: "create_consent",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS consent_versions (
+			kind         TEXT NOT NULL,
+			version      TEXT NOT NULL,
+			title        TEXT NOT NULL,
+			url          TEXT NOT NULL,
+			summary      TEXT NOT NULL,
+			effective_at TIMESTAMP NOT NULL,
+			published_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (kind, version)
+		);
+		CREATE TABLE IF NOT EXISTS consent_acceptances (
+			user_id     TEXT NOT NULL,
+			kind        TEXT NOT NULL,
+			version     TEXT NOT NULL,
+			accepted_at TIMESTAMP NOT NULL,
+			ip          TEXT NOT NULL,
+			user_agent  TEXT NOT NULL,
+			PRIMARY KEY (user_id, kind, version)
+		)`,
+}}
+
+// SQLStore persists consent records in the consent tables
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Publish(ctx context.Context, v Version) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO consent_versions (kind, version, title, url, summary, effective_at, published_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (kind, version) DO NOTHING`,
+		v.Kind, v.Version, v.Title, v.URL, v.Summary, v.EffectiveAt, v.PublishedAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errVersionExists
+	}
+	return nil
+}
+
+func (s *SQLStore) Versions(ctx context.Context, kind string) ([]Version, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT kind, version, title, url, summary, effective_at, published_at FROM consent_versions
+		WHERE $1 = '' OR kind = $1
+		ORDER BY effective_at DESC`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Version{}
+	for rows.Next() {
+		var v Version
+		if err := rows.Scan(&v.Kind, &v.Version, &v.Title, &v.URL, &v.Summary, &v.EffectiveAt, &v.PublishedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Accept(ctx context.Context, a Acceptance) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO consent_acceptances (user_id, kind, version, accepted_at, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, kind, version) DO NOTHING`,
+		a.UserID, a.Kind, a.Version, a.AcceptedAt, a.IP, a.UserAgent)
+	return err
+}
+
+func (s *SQLStore) Accepted(ctx context.Context, userID, kind, version string) (bool, error) {
+	var n int
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM consent_acceptances WHERE user_id = $1 AND kind = $2 AND version = $3`,
+		userID, kind, version).Scan(&n)
+	return n > 0, err
+}
+
+func (s *SQLStore) Acceptances(ctx context.Context, userID string) ([]Acceptance, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT user_id, kind, version, accepted_at, ip, user_agent FROM consent_acceptances
+		WHERE user_id = $1 ORDER BY accepted_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Acceptance{}
+	for rows.Next() {
+		var a Acceptance
+		if err := rows.Scan(&a.UserID, &a.Kind, &a.Version, &a.AcceptedAt, &a.IP, &a.UserAgent); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Anonymize(ctx context.Context, userID string) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE consent_acceptances SET ip = '', user_agent = '' WHERE user_id = $1`, userID)
+	return err
+}
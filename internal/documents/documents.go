@@ -0,0 +1,167 @@
+// Package documents is the feature module generating PDFs, like invoices and
+// reports, from HTML templates. Documents are rendered by a job; once ready they
+// are downloaded through a signed link or delivered by email as an attachment.
+// Built-in templates can be overridden, and new ones added, through the admin API.
+package documents
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/subresource"
+	"go-api/pkg/authz"
+	"go-api/pkg/mail"
+	"go-api/pkg/mongodb"
+	"go-api/pkg/pdf"
+	"go-api/pkg/queue"
+	"go-api/pkg/signedurl"
+	"go-api/pkg/storage"
+)
+
+// Config holds document generation configuration
+type Config struct {
+	PDF     pdf.Config    `yaml:"pdf"`
+	LinkTTL time.Duration `yaml:"linkTTL"` // Lifetime of download links
+	Store   string        `yaml:"store"`   // memory, sql or mongodb; the database by default
+}
+
+// Document statuses
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed" // The template could not be rendered with the data
+)
+
+// Document is a PDF generated from a template
+type Document struct {
+	ID          string         `json:"id" index:",unique"`
+	OwnerID     string         `json:"ownerId" index:""`
+	Tenant      string         `json:"tenant,omitempty"`
+	Template    string         `json:"template"`
+	Filename    string         `json:"filename"`
+	Data        map[string]any `json:"data,omitempty"`
+	Email       *Delivery      `json:"email,omitempty"`
+	Status      string         `json:"status"`
+	Error       string         `json:"error,omitempty"`
+	Size        int64          `json:"size,omitempty"`
+	DownloadURL string         `json:"downloadUrl,omitempty"` // Signed link, set on ready documents when read
+	CreatedAt   time.Time      `json:"createdAt"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+}
+
+// Delivery is the email a document is sent with once rendered
+type Delivery struct {
+	To      []string   `json:"to"`
+	Subject string     `json:"subject,omitempty"`
+	Body    string     `json:"body,omitempty"`
+	SentAt  *time.Time `json:"sentAt,omitempty"`
+	Error   string     `json:"error,omitempty"` // Of the last failed attempt
+}
+
+// Key is where a document's PDF is stored
+func (d Document) Key() string {
+	return "documents/" + d.ID + ".pdf"
+}
+
+// jobGenerate renders a document and delivers it
+const jobGenerate = "documents.generate"
+
+type generateJob struct {
+	DocumentID string `json:"documentId"`
+}
+
+type documentsModule struct {
+	module.Base
+	cfg       Config
+	backend   string
+	mongo     *mongodb.Client // Set when the records are kept in MongoDB
+	store     Store
+	templates *Templates
+	renderer  *pdf.Renderer
+	storage   storage.Storage
+	queue     *queue.Manager
+	mailer    mail.Mailer
+	links     *signedurl.Signer
+}
+
+// New returns the factory of the documents module, which needs the shared storage.
+// Email delivery is only offered when a mailer is configured.
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if deps.Storage == nil {
+			return nil, fmt.Errorf("documents: no storage configured")
+		}
+		if cfg.LinkTTL <= 0 {
+			cfg.LinkTTL = time.Hour
+		}
+		renderer, err := pdf.NewRenderer(cfg.PDF)
+		if err != nil {
+			return nil, err
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("documents: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		var overrides TemplateStore = NewMemoryTemplateStore()
+		var mongo *mongodb.Client
+		switch backend {
+		case module.BackendSQL:
+			store, overrides = NewSQLStore(deps.DB), NewSQLTemplateStore(deps.DB)
+		case module.BackendMongo:
+			mongo = deps.Mongo
+			if store, overrides, err = NewMongoStores(context.Background(), deps.Mongo); err != nil {
+				return nil, fmt.Errorf("documents: %w", err)
+			}
+		}
+		return &documentsModule{
+			cfg:       cfg,
+			backend:   backend,
+			mongo:     mongo,
+			store:     store,
+			templates: NewTemplates(overrides),
+			renderer:  renderer,
+			storage:   deps.Storage,
+			queue:     deps.Queue,
+			mailer:    deps.Mailer,
+			links:     deps.Links,
+		}, nil
+	}
+}
+
+func (m *documentsModule) Name() string { return "documents" }
+
+func (m *documentsModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+func (m *documentsModule) HealthChecks() []module.HealthCheck {
+	if m.mongo == nil {
+		return nil
+	}
+	return []module.HealthCheck{{Name: "mongodb", Check: m.mongo.Ping}}
+}
+
+func (m *documentsModule) Jobs() map[string]queue.HandlerFunc {
+	return map[string]queue.HandlerFunc{jobGenerate: m.generate}
+}
+
+// Parents lets documents take comments and attachments. A document stays hidden
+// from all but its owner, like on the document routes.
+func (m *documentsModule) Parents() []subresource.Parent {
+	return []subresource.Parent{{Type: "document", Path: "/documents", Resolve: func(ctx context.Context, id string) (authz.Resource, error) {
+		d, err := m.store.Get(ctx, id)
+		if err != nil {
+			return authz.Resource{}, err
+		}
+		if sub, _ := authz.SubjectFromContext(ctx); sub.ID == "" || sub.ID != d.OwnerID {
+			return authz.Resource{}, errDocumentNotFound
+		}
+		return authz.Resource{Type: "document", ID: d.ID, Owner: d.OwnerID, Tenant: d.Tenant}, nil
+	}}}
+}
@@ -0,0 +1,111 @@
+package documents
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/mail"
+	"go-api/pkg/queue"
+
+	"go.uber.org/zap"
+)
+
+// generate renders a pending document and emails it when asked to. A document is
+// only rendered once, so a retry after a failed delivery just sends it again.
+func (m *documentsModule) generate(ctx context.Context, job *queue.Job) error {
+	var payload generateJob
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	d, err := m.store.Get(ctx, payload.DocumentID)
+	if errors.Is(err, errDocumentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.Status == StatusPending {
+		// Retrying won't make a missing or broken template work with this data, but
+		// store errors are worth another attempt
+		tmpl, err := m.templates.Parsed(ctx, d.Template)
+		var content bytes.Buffer
+		var appErr *apperrors.AppError
+		if err == nil {
+			err = m.renderer.Execute(&content, tmpl, d.Data)
+		} else if !errors.As(err, &appErr) {
+			return err
+		}
+		now := time.Now().UTC()
+		if err != nil {
+			logger.Warn("document rendering failed", zap.String("document", d.ID), zap.String("template", d.Template), zap.Error(err))
+			d.Status, d.Error, d.CompletedAt = StatusFailed, err.Error(), &now
+			return m.store.Save(ctx, d)
+		}
+		obj, err := m.storage.Put(ctx, d.Key(), &content, "application/pdf")
+		if err != nil {
+			return err
+		}
+		d.Status, d.Size, d.CompletedAt = StatusReady, obj.Size, &now
+		if err := m.store.Save(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	if d.Status == StatusReady && d.Email != nil && d.Email.SentAt == nil {
+		return m.deliver(ctx, d)
+	}
+	return nil
+}
+
+// deliver emails a ready document as an attachment, recording the outcome
+func (m *documentsModule) deliver(ctx context.Context, d Document) error {
+	if m.mailer == nil {
+		d.Email.Error = "email delivery is not configured"
+		return m.store.Save(ctx, d)
+	}
+	content, err := m.read(ctx, d)
+	if err != nil {
+		return err
+	}
+	subject := d.Email.Subject
+	if subject == "" {
+		subject = d.Filename
+	}
+	body := d.Email.Body
+	if body == "" {
+		body = fmt.Sprintf("Please find %s attached.", d.Filename)
+	}
+	err = m.mailer.Send(ctx, mail.Message{
+		To:          d.Email.To,
+		Subject:     subject,
+		Text:        body,
+		Attachments: []mail.Attachment{{Filename: d.Filename, ContentType: "application/pdf", Data: content}},
+	})
+	if err != nil {
+		logger.Error("document delivery failed", zap.String("document", d.ID), zap.Error(err))
+		d.Email.Error = err.Error()
+		if saveErr := m.store.Save(ctx, d); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+	now := time.Now().UTC()
+	d.Email.SentAt, d.Email.Error = &now, ""
+	return m.store.Save(ctx, d)
+}
+
+func (m *documentsModule) read(ctx context.Context, d Document) ([]byte, error) {
+	r, _, err := m.storage.Open(ctx, d.Key())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
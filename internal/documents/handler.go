@@ -0,0 +1,262 @@
+package documents
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Routes mounts the document endpoints, which all need the signed-in owner. The
+// download is also reachable through the signed link of a ready document.
+func (m *documentsModule) Routes(api *apiversion.Group) {
+	tags := []string{"documents"}
+	api.POST("/documents", apiversion.Operation{
+		ID:          "createDocument",
+		Summary:     "Generate a PDF from a template",
+		Description: "Renders in the background; the document is ready once its status is, and then has a downloadUrl. With email, the PDF is also sent as an attachment.",
+		Tags:        tags,
+		Cost:        20,
+		Request:     createRequest{},
+		Response:    Document{},
+	}, m.create)
+	api.GET("/documents/:id", apiversion.Operation{
+		ID:       "getDocument",
+		Summary:  "Get a document's status and download link",
+		Tags:     tags,
+		Response: Document{},
+	}, m.get)
+	api.GET("/documents/:id/file", apiversion.Operation{
+		ID:          "downloadDocument",
+		Summary:     "Download a generated PDF",
+		Description: "Answers 409 while the document is being generated or when it failed.",
+		Tags:        tags,
+	}, m.download)
+}
+
+// AdminRoutes mounts template management on the admin group
+func (m *documentsModule) AdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/documents/templates", m.listTemplates)
+	rg.GET("/documents/templates/:name", m.getTemplate)
+	rg.PUT("/documents/templates/:name", m.saveTemplate)
+	rg.DELETE("/documents/templates/:name", m.deleteTemplate)
+	rg.POST("/documents/templates/:name/preview", m.preview)
+}
+
+type createRequest struct {
+	Template string         `json:"template" binding:"required"`
+	Data     map[string]any `json:"data"`
+	Filename string         `json:"filename" binding:"omitempty,max=200"`
+	Email    *emailRequest  `json:"email"`
+}
+
+type emailRequest struct {
+	To      []string `json:"to" binding:"required,min=1,max=20,dive,email"`
+	Subject string   `json:"subject" binding:"omitempty,max=200"`
+	Body    string   `json:"body" binding:"omitempty,max=10000"`
+}
+
+func (m *documentsModule) create(c *gin.Context) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return
+	}
+	var req createRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid document", err))
+		return
+	}
+	if req.Email != nil && m.mailer == nil {
+		c.Error(apperrors.NewValidationError("Email delivery is not configured"))
+		return
+	}
+	ctx := c.Request.Context()
+	if _, err := m.templates.Get(ctx, req.Template); err != nil {
+		c.Error(err)
+		return
+	}
+
+	d := Document{
+		ID:        uuid.New().String(),
+		OwnerID:   sub.ID,
+		Tenant:    sub.Tenant,
+		Template:  req.Template,
+		Filename:  filename(req.Filename, req.Template),
+		Data:      req.Data,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if req.Email != nil {
+		d.Email = &Delivery{To: req.Email.To, Subject: req.Email.Subject, Body: req.Email.Body}
+	}
+	if err := m.store.Save(ctx, d); err != nil {
+		c.Error(err)
+		return
+	}
+	if _, err := m.queue.Enqueue(ctx, "default", jobGenerate, generateJob{DocumentID: d.ID}); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+d.ID)
+	c.JSON(http.StatusAccepted, d)
+}
+
+// filename returns the requested name with a .pdf extension, or the template's
+func filename(requested, template string) string {
+	name := strings.TrimSpace(strings.NewReplacer("/", "_", "\\", "_").Replace(requested))
+	if name == "" {
+		name = template
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+		name += ".pdf"
+	}
+	return name
+}
+
+func (m *documentsModule) get(c *gin.Context) {
+	d, ok := m.owned(c)
+	if !ok {
+		return
+	}
+	if d.Status == StatusReady && m.links != nil {
+		sub, _ := authz.SubjectFromContext(c.Request.Context())
+		link, err := m.links.Sign(c.Request.URL.Path+"/file", authz.Subject{ID: sub.ID, Tenant: sub.Tenant}, m.cfg.LinkTTL)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		d.DownloadURL = link
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+func (m *documentsModule) download(c *gin.Context) {
+	d, ok := m.owned(c)
+	if !ok {
+		return
+	}
+	switch d.Status {
+	case StatusPending:
+		c.Error(apperrors.NewConflictError("Document is not generated yet"))
+		return
+	case StatusFailed:
+		c.Error(apperrors.NewConflictError("Document could not be generated: " + d.Error))
+		return
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": d.Filename}))
+	c.Header("Cache-Control", "private, no-cache")
+	if err := storage.Serve(c.Writer, c.Request, m.storage, d.Key()); err != nil {
+		c.Error(err)
+	}
+}
+
+// owned returns the document of the :id parameter if the signed-in user owns it
+func (m *documentsModule) owned(c *gin.Context) (Document, bool) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return Document{}, false
+	}
+	d, err := m.store.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && d.OwnerID != sub.ID {
+		err = errDocumentNotFound
+	}
+	if err != nil {
+		c.Error(err)
+		return Document{}, false
+	}
+	return d, true
+}
+
+func (m *documentsModule) listTemplates(c *gin.Context) {
+	list, err := m.templates.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (m *documentsModule) getTemplate(c *gin.Context) {
+	tmpl, err := m.templates.Get(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tmpl)
+}
+
+type templateRequest struct {
+	Description string `json:"description" binding:"omitempty,max=500"`
+	Body        string `json:"body" binding:"required"`
+}
+
+func (m *documentsModule) saveTemplate(c *gin.Context) {
+	var req templateRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid template", err))
+		return
+	}
+	tmpl, err := m.templates.Save(c.Request.Context(), Template{Name: c.Param("name"), Description: req.Description, Body: req.Body})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tmpl)
+}
+
+func (m *documentsModule) deleteTemplate(c *gin.Context) {
+	if err := m.templates.Delete(c.Request.Context(), c.Param("name")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type previewRequest struct {
+	Body string         `json:"body"` // Unsaved source to render instead of the template's
+	Data map[string]any `json:"data"`
+}
+
+// preview renders a template, or an edited source of it, with sample data and
+// returns the PDF right away
+func (m *documentsModule) preview(c *gin.Context) {
+	var req previewRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid preview", err))
+		return
+	}
+	name := c.Param("name")
+	body := req.Body
+	if body == "" {
+		tmpl, err := m.templates.Get(c.Request.Context(), name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		body = tmpl.Body
+	}
+	tmpl, err := parse(name, body)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := m.renderer.Execute(&buf, tmpl, req.Data); err != nil {
+		c.Error(apperrors.NewValidationError("Template failed to render: " + err.Error()))
+		return
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name + ".pdf"}))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
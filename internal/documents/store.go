@@ -0,0 +1,288 @@
+package documents
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Store persists document records; the PDFs are in storage
+type Store interface {
+	Save(ctx context.Context, d Document) error
+	Get(ctx context.Context, id string) (Document, error)
+}
+
+// TemplateStore persists the templates added or overridden through the admin API
+type TemplateStore interface {
+	List(ctx context.Context) ([]Template, error)
+	Get(ctx context.Context, name string) (Template, error)
+	Save(ctx context.Context, t Template) error
+	Delete(ctx context.Context, name string) error
+}
+
+var (
+	errDocumentNotFound = apperrors.NewNotFoundError("Document not found")
+	errTemplateNotFound = apperrors.NewNotFoundError("Template not found")
+)
+
+// MemoryStore keeps documents in memory, used when no database is configured
+type MemoryStore struct {
+	mu        sync.Mutex
+	documents map[string]Document
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{documents: make(map[string]Document)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, d Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents[d.ID] = d
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.documents[id]
+	if !ok {
+		return Document{}, errDocumentNotFound
+	}
+	return d, nil
+}
+
+// MemoryTemplateStore keeps templates in memory, used when no database is configured
+type MemoryTemplateStore struct {
+	mu        sync.Mutex
+	templates map[string]Template
+}
+
+// NewMemoryTemplateStore creates an empty in-memory store
+func NewMemoryTemplateStore() *MemoryTemplateStore {
+	return &MemoryTemplateStore{templates: make(map[string]Template)}
+}
+
+func (s *MemoryTemplateStore) List(ctx context.Context) ([]Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *MemoryTemplateStore) Get(ctx context.Context, name string) (Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.templates[name]
+	if !ok {
+		return Template{}, errTemplateNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryTemplateStore) Save(ctx context.Context, t Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates[t.Name] = t
+	return nil
+}
+
+func (s *MemoryTemplateStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[name]; !ok {
+		return errTemplateNotFound
+	}
+	delete(s.templates, name)
+	return nil
+}
+
+// migrations create the documents and document_templates tables, with the records
+// as JSON in data
+var migrations = []module.Migration{{
+	Name: "create_documents",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS documents (
+			id         TEXT PRIMARY KEY,
+			owner_id   TEXT NOT NULL,
+			status     TEXT NOT NULL,
+			data       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS document_templates (
+			name       TEXT PRIMARY KEY,
+			data       TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`,
+}}
+
+// SQLStore persists documents in the documents table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Save(ctx context.Context, d Document) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO documents (id, owner_id, status, data, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, data = EXCLUDED.data`,
+		d.ID, d.OwnerID, d.Status, string(data), d.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Document, error) {
+	var data string
+	err := s.conn(ctx).QueryRowContext(ctx, `SELECT data FROM documents WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Document{}, errDocumentNotFound
+	}
+	if err != nil {
+		return Document{}, err
+	}
+	var d Document
+	return d, json.Unmarshal([]byte(data), &d)
+}
+
+// SQLTemplateStore persists templates in the document_templates table
+type SQLTemplateStore struct {
+	db *sql.DB
+}
+
+// NewSQLTemplateStore creates a store backed by db
+func NewSQLTemplateStore(db *sql.DB) *SQLTemplateStore {
+	return &SQLTemplateStore{db: db}
+}
+
+func (s *SQLTemplateStore) List(ctx context.Context) ([]Template, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM document_templates ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Template
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var t Template
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLTemplateStore) Get(ctx context.Context, name string) (Template, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM document_templates WHERE name = $1`, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Template{}, errTemplateNotFound
+	}
+	if err != nil {
+		return Template{}, err
+	}
+	var t Template
+	return t, json.Unmarshal([]byte(data), &t)
+}
+
+func (s *SQLTemplateStore) Save(ctx context.Context, t Template) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO document_templates (name, data, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+		t.Name, string(data), t.UpdatedAt)
+	return err
+}
+
+func (s *SQLTemplateStore) Delete(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM document_templates WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTemplateNotFound
+	}
+	return nil
+}
+
+// MongoStore persists documents in the documents collection
+type MongoStore struct {
+	documents mongodb.Collection[Document]
+}
+
+// MongoTemplateStore persists templates in the document_templates collection
+type MongoTemplateStore struct {
+	templates mongodb.Collection[Template]
+}
+
+// NewMongoStores creates the stores backed by c, creating their indexes
+func NewMongoStores(ctx context.Context, c *mongodb.Client) (*MongoStore, *MongoTemplateStore, error) {
+	documents := mongodb.NewCollection[Document](c, "documents", "id", errDocumentNotFound)
+	templates := mongodb.NewCollection[Template](c, "document_templates", "name", errTemplateNotFound)
+	if err := documents.EnsureIndexes(ctx); err != nil {
+		return nil, nil, err
+	}
+	if err := templates.EnsureIndexes(ctx); err != nil {
+		return nil, nil, err
+	}
+	return &MongoStore{documents: documents}, &MongoTemplateStore{templates: templates}, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, d Document) error {
+	return s.documents.Save(ctx, d.ID, d)
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (Document, error) {
+	return s.documents.Get(ctx, id)
+}
+
+func (s *MongoTemplateStore) List(ctx context.Context) ([]Template, error) {
+	return s.templates.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+}
+
+func (s *MongoTemplateStore) Get(ctx context.Context, name string) (Template, error) {
+	return s.templates.Get(ctx, name)
+}
+
+func (s *MongoTemplateStore) Save(ctx context.Context, t Template) error {
+	return s.templates.Save(ctx, t.Name, t)
+}
+
+func (s *MongoTemplateStore) Delete(ctx context.Context, name string) error {
+	return s.templates.Delete(ctx, name)
+}
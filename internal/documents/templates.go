@@ -0,0 +1,152 @@
+package documents
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/pdf"
+)
+
+//go:embed templates/*.html
+var builtinFiles embed.FS
+
+// builtinDescriptions describe the templates shipped with the service
+var builtinDescriptions = map[string]string{
+	"invoice": "An invoice with seller, customer, line items and totals",
+	"report":  "A titled table of rows, with an optional summary",
+}
+
+// templateName is what template names may look like, as they appear in URLs
+var templateName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Template is an html/template source rendered to PDF, see package pdf for the
+// HTML understood
+type Template struct {
+	Name        string     `json:"name" index:",unique"`
+	Description string     `json:"description,omitempty"`
+	Body        string     `json:"body"`
+	BuiltIn     bool       `json:"builtIn"`             // Shipped with the service
+	Overridden  bool       `json:"overridden"`          // A built-in template replaced through the admin API
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"` // Of the stored version
+}
+
+// Templates resolves template names to the stored version, falling back to the
+// built-in one
+type Templates struct {
+	store    TemplateStore
+	builtins map[string]Template
+}
+
+// NewTemplates creates a template registry over the stored templates
+func NewTemplates(store TemplateStore) *Templates {
+	t := &Templates{store: store, builtins: make(map[string]Template)}
+	files, _ := fs.Glob(builtinFiles, "templates/*.html")
+	for _, file := range files {
+		body, _ := fs.ReadFile(builtinFiles, file)
+		name := strings.TrimSuffix(strings.TrimPrefix(file, "templates/"), ".html")
+		t.builtins[name] = Template{Name: name, Description: builtinDescriptions[name], Body: string(body), BuiltIn: true}
+	}
+	return t
+}
+
+// Get returns the template used for name
+func (t *Templates) Get(ctx context.Context, name string) (Template, error) {
+	stored, err := t.store.Get(ctx, name)
+	builtin, isBuiltin := t.builtins[name]
+	switch {
+	case errors.Is(err, errTemplateNotFound) && isBuiltin:
+		return builtin, nil
+	case err != nil:
+		return Template{}, err
+	}
+	stored.BuiltIn, stored.Overridden = isBuiltin, isBuiltin
+	if stored.Description == "" {
+		stored.Description = builtin.Description
+	}
+	return stored, nil
+}
+
+// List returns every template, sorted by name
+func (t *Templates) List(ctx context.Context) ([]Template, error) {
+	stored, err := t.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Template, len(t.builtins)+len(stored))
+	for name, builtin := range t.builtins {
+		byName[name] = builtin
+	}
+	for _, s := range stored {
+		if builtin, ok := byName[s.Name]; ok {
+			s.BuiltIn, s.Overridden = true, true
+			if s.Description == "" {
+				s.Description = builtin.Description
+			}
+		}
+		byName[s.Name] = s
+	}
+	list := make([]Template, 0, len(byName))
+	for _, tmpl := range byName {
+		list = append(list, tmpl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Save stores a template, overriding the built-in one of the same name, once its
+// source parses
+func (t *Templates) Save(ctx context.Context, tmpl Template) (Template, error) {
+	if !templateName.MatchString(tmpl.Name) {
+		return Template{}, apperrors.NewValidationError("Template names are lowercase letters, digits, - and _")
+	}
+	if _, err := parse(tmpl.Name, tmpl.Body); err != nil {
+		return Template{}, err
+	}
+	now := time.Now().UTC()
+	tmpl.BuiltIn, tmpl.Overridden, tmpl.UpdatedAt = false, false, &now
+	if err := t.store.Save(ctx, tmpl); err != nil {
+		return Template{}, err
+	}
+	return t.Get(ctx, tmpl.Name)
+}
+
+// Delete removes a stored template; for an overridden built-in one, the built-in
+// version applies again
+func (t *Templates) Delete(ctx context.Context, name string) error {
+	err := t.store.Delete(ctx, name)
+	if _, ok := t.builtins[name]; ok && errors.Is(err, errTemplateNotFound) {
+		return apperrors.NewConflictError("Built-in templates can be overridden but not deleted")
+	}
+	return err
+}
+
+// Parsed returns the compiled template used for name
+func (t *Templates) Parsed(ctx context.Context, name string) (*template.Template, error) {
+	tmpl, err := t.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return parse(tmpl.Name, tmpl.Body)
+}
+
+// parse compiles a template source, reporting syntax errors as validation errors
+func parse(name, body string) (*template.Template, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, apperrors.NewValidationError("Template body is required")
+	}
+	tmpl, err := pdf.Parse(name, body)
+	if err != nil {
+		appErr := apperrors.Wrap(err, apperrors.CodeValidation)
+		appErr.Message = "Invalid template: " + err.Error()
+		return nil, appErr
+	}
+	return tmpl, nil
+}
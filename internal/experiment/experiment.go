@@ -0,0 +1,270 @@
+// Package experiment runs A/B tests. Running experiments assign each user or tenant
+// to a weighted variant by hashing its ID, so assignment is stable without storing
+// it. Assignments are listed in a response header, and an exposure is logged the
+// first time a handler reads one, so only requests the variant affected are counted.
+package experiment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/authz"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Units an experiment can assign
+const (
+	UnitUser   = "user"
+	UnitTenant = "tenant"
+)
+
+// Header lists the request's assignments as name=variant pairs
+const Header = "X-Experiments"
+
+// Config holds the experiments defined at startup
+type Config struct {
+	Experiments []Experiment `yaml:"experiments"`
+}
+
+// Experiment splits users or tenants between variants while it runs
+type Experiment struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit"` // user or tenant, defaults to user
+	Variants    []Variant  `json:"variants"`
+	Running     bool       `json:"running"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	StoppedAt   *time.Time `json:"stoppedAt,omitempty"`
+}
+
+// Variant is one arm of an experiment, getting Weight shares of its units
+type Variant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+func (e *Experiment) validate() error {
+	if e.Unit == "" {
+		e.Unit = UnitUser
+	}
+	if e.Unit != UnitUser && e.Unit != UnitTenant {
+		return fmt.Errorf("unit must be %s or %s", UnitUser, UnitTenant)
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("at least two variants are required")
+	}
+	seen := make(map[string]bool, len(e.Variants))
+	for _, v := range e.Variants {
+		if v.Name == "" || v.Weight <= 0 {
+			return fmt.Errorf("variants need a name and a positive weight")
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate variant %s", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
+
+// Assign returns the variant for a unit ID. The experiment name is mixed into the
+// hash so the same units don't land in the first variant of every experiment.
+func (e Experiment) Assign(id string) string {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + id))
+	n := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v.Name
+		}
+		n -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1].Name
+}
+
+var (
+	errExperimentNotFound = fmt.Errorf("experiment not found")
+
+	exposuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "experiment_exposures_total",
+		Help: "Requests whose handler read an experiment assignment, by variant.",
+	}, []string{"experiment", "variant"})
+)
+
+// Registry holds experiments in memory
+type Registry struct {
+	mu          sync.RWMutex
+	experiments map[string]Experiment
+}
+
+// NewRegistry creates a registry seeded with the configured experiments
+func NewRegistry(cfg Config) (*Registry, error) {
+	r := &Registry{experiments: make(map[string]Experiment)}
+	for _, e := range cfg.Experiments {
+		if e.Running && e.StartedAt == nil {
+			now := time.Now().UTC()
+			e.StartedAt = &now
+		}
+		if _, err := r.Set(e); err != nil {
+			return nil, fmt.Errorf("experiment %s: %w", e.Name, err)
+		}
+	}
+	return r, nil
+}
+
+// Set creates or replaces an experiment, keeping its running state and timestamps
+// when it already exists
+func (r *Registry) Set(e Experiment) (Experiment, error) {
+	if err := e.validate(); err != nil {
+		return Experiment{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.experiments[e.Name]; ok {
+		e.Running, e.StartedAt, e.StoppedAt = existing.Running, existing.StartedAt, existing.StoppedAt
+	}
+	r.experiments[e.Name] = e
+	return e, nil
+}
+
+// Start begins assigning units to an experiment
+func (r *Registry) Start(name string) (Experiment, error) {
+	return r.update(name, func(e *Experiment, now time.Time) {
+		if !e.Running {
+			e.Running = true
+			e.StartedAt = &now
+			e.StoppedAt = nil
+		}
+	})
+}
+
+// Stop ends an experiment, after which its units get no variant
+func (r *Registry) Stop(name string) (Experiment, error) {
+	return r.update(name, func(e *Experiment, now time.Time) {
+		if e.Running {
+			e.Running = false
+			e.StoppedAt = &now
+		}
+	})
+}
+
+func (r *Registry) update(name string, fn func(*Experiment, time.Time)) (Experiment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.experiments[name]
+	if !ok {
+		return Experiment{}, errExperimentNotFound
+	}
+	fn(&e, time.Now().UTC())
+	r.experiments[name] = e
+	return e, nil
+}
+
+// Delete removes an experiment, returning false if it did not exist
+func (r *Registry) Delete(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.experiments[name]
+	delete(r.experiments, name)
+	return ok
+}
+
+// List returns all experiments sorted by name
+func (r *Registry) List() []Experiment {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Experiment, 0, len(r.experiments))
+	for _, e := range r.experiments {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Middleware assigns the authenticated subject to every running experiment. It has
+// to run after the subject is set; anonymous requests aren't assigned.
+func (r *Registry) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, ok := authz.SubjectFromContext(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		a := &assignments{unit: map[string]string{UnitUser: sub.ID, UnitTenant: sub.Tenant}}
+		var pairs []string
+		for _, e := range r.List() {
+			id := a.unit[e.Unit]
+			if !e.Running || id == "" {
+				continue
+			}
+			variant := e.Assign(id)
+			a.list = append(a.list, assignment{experiment: e.Name, unit: e.Unit, variant: variant})
+			pairs = append(pairs, e.Name+"="+variant)
+		}
+		if len(a.list) > 0 {
+			c.Header(Header, strings.Join(pairs, ", "))
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), assignmentsKey{}, a))
+		}
+		c.Next()
+	}
+}
+
+type assignmentsKey struct{}
+
+type assignments struct {
+	mu   sync.Mutex
+	unit map[string]string
+	list []assignment
+}
+
+type assignment struct {
+	experiment string
+	unit       string
+	variant    string
+	exposed    bool
+}
+
+// VariantFromContext returns the variant the request was assigned in an experiment,
+// logging the exposure on first read. It returns false when the experiment isn't
+// running or the request has no subject, in which case callers keep the default
+// behaviour.
+func VariantFromContext(ctx context.Context, experiment string) (string, bool) {
+	a, _ := ctx.Value(assignmentsKey{}).(*assignments)
+	if a == nil {
+		return "", false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := range a.list {
+		as := &a.list[i]
+		if as.experiment != experiment {
+			continue
+		}
+		if !as.exposed {
+			as.exposed = true
+			exposuresTotal.WithLabelValues(as.experiment, as.variant).Inc()
+			logger.Info("experiment exposure",
+				zap.String("experiment", as.experiment),
+				zap.String("variant", as.variant),
+				zap.String("unit", as.unit),
+				zap.String("unit_id", a.unit[as.unit]),
+			)
+		}
+		return as.variant, true
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package experiment
+
+import (
+	"errors"
+	"net/http"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for defining, starting and stopping experiments
+type Handler struct {
+	registry *Registry
+}
+
+// NewHandler creates an experiment handler
+func NewHandler(registry *Registry) *Handler {
+	return &Handler{registry: registry}
+}
+
+// RegisterRoutes mounts the experiment endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/experiments", h.list)
+	rg.PUT("/experiments/:name", h.set)
+	rg.DELETE("/experiments/:name", h.delete)
+	rg.POST("/experiments/:name/start", h.start)
+	rg.POST("/experiments/:name/stop", h.stop)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.registry.List()})
+}
+
+func (h *Handler) set(c *gin.Context) {
+	var e Experiment
+	if err := bind.JSON(c, &e); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid experiment", err))
+		return
+	}
+	e.Name = c.Param("name")
+	e, err := h.registry.Set(e)
+	if err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid experiment", err))
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if !h.registry.Delete(c.Param("name")) {
+		c.Error(apperrors.NewNotFoundError("Experiment not found"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) start(c *gin.Context) {
+	h.transition(c, h.registry.Start)
+}
+
+func (h *Handler) stop(c *gin.Context) {
+	h.transition(c, h.registry.Stop)
+}
+
+func (h *Handler) transition(c *gin.Context, fn func(name string) (Experiment, error)) {
+	e, err := fn(c.Param("name"))
+	if errors.Is(err, errExperimentNotFound) {
+		c.Error(apperrors.NewNotFoundError("Experiment not found"))
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
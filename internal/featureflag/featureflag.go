@@ -0,0 +1,76 @@
+package featureflag
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Flag is a named on/off switch that can be toggled at runtime
+type Flag struct {
+	Name        string    `json:"name"`
+	Enabled     bool      `json:"enabled"`
+	Description string    `json:"description,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Store holds feature flags in memory
+type Store struct {
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewStore creates a store seeded with the given flags, keyed by name
+func NewStore(defaults map[string]bool) *Store {
+	s := &Store{flags: make(map[string]Flag)}
+	for name, enabled := range defaults {
+		s.flags[name] = Flag{Name: name, Enabled: enabled, UpdatedAt: time.Now().UTC()}
+	}
+	return s
+}
+
+// Enabled reports whether a flag is on, unknown flags are off
+func (s *Store) Enabled(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.flags[name].Enabled
+}
+
+// Set creates or updates a flag
+func (s *Store) Set(name string, enabled bool, description string) Flag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flag := s.flags[name]
+	flag.Name = name
+	flag.Enabled = enabled
+	if description != "" {
+		flag.Description = description
+	}
+	flag.UpdatedAt = time.Now().UTC()
+	s.flags[name] = flag
+	return flag
+}
+
+// Delete removes a flag, returning false if it did not exist
+func (s *Store) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.flags[name]
+	delete(s.flags, name)
+	return ok
+}
+
+// List returns all flags sorted by name
+func (s *Store) List() []Flag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		list = append(list, flag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,53 @@
+package featureflag
+
+import (
+	"net/http"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for toggling feature flags
+type Handler struct {
+	store *Store
+}
+
+// NewHandler creates a feature flag handler
+func NewHandler(store *Store) *Handler {
+	return &Handler{store: store}
+}
+
+// RegisterRoutes mounts the flag endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/flags", h.list)
+	rg.PUT("/flags/:name", h.set)
+	rg.DELETE("/flags/:name", h.delete)
+}
+
+type setRequest struct {
+	Enabled     *bool  `json:"enabled" binding:"required"`
+	Description string `json:"description"`
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.store.List()})
+}
+
+func (h *Handler) set(c *gin.Context) {
+	var req setRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid feature flag", err))
+		return
+	}
+	c.JSON(http.StatusOK, h.store.Set(c.Param("name"), *req.Enabled, req.Description))
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if !h.store.Delete(c.Param("name")) {
+		c.Error(apperrors.NewNotFoundError("Feature flag not found"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,243 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/cache"
+	"go-api/pkg/cdc"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/tenant"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SurrogateKeyHeader lists the space-separated tags of a response, as used by Fastly and Varnish
+const SurrogateKeyHeader = "Surrogate-Key"
+
+const surrogateKeysContextKey = "surrogateKeys"
+
+// credentialHeaders carry who a request is from. Entries aren't keyed by user, so
+// requests with any of them are never cached, nor answered from the cache.
+var credentialHeaders = []string{"Authorization", "Cookie", "X-API-Key", "X-Admin-Token"}
+
+// sweepEvery controls how often storing an entry sweeps the index of expired ones
+const sweepEvery = 1000
+
+type entry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	Tags   []string    `json:"tags,omitempty"`
+}
+
+// ResponseCache caches GET responses of anonymous requests and invalidates them by
+// cache key or surrogate key. Each instance indexes the tags of the entries it
+// stored itself until they expire, and purges are broadcast so every instance
+// drops the entries it knows about.
+type ResponseCache struct {
+	cache       cache.Cache
+	invalidator cache.Invalidator
+
+	mu    sync.Mutex
+	index map[string]map[string]time.Time // tag -> cache keys -> when they expire
+	sets  int
+}
+
+// New creates a response cache and starts listening for purges from other instances
+func New(ctx context.Context, c cache.Cache, invalidator cache.Invalidator) *ResponseCache {
+	rc := &ResponseCache{
+		cache:       c,
+		invalidator: invalidator,
+		index:       make(map[string]map[string]time.Time),
+	}
+	invalidator.Subscribe(ctx, func(inv cache.Invalidation) {
+		if err := rc.purgeLocal(context.Background(), inv); err != nil {
+			logger.Warn("failed to apply cache purge", zap.Error(err))
+		}
+	})
+	return rc
+}
+
+// Tag attaches surrogate keys to the current response so it can later be purged by entity
+func Tag(c *gin.Context, tags ...string) {
+	existing, _ := c.Get(surrogateKeysContextKey)
+	list, _ := existing.([]string)
+	c.Set(surrogateKeysContextKey, append(list, tags...))
+}
+
+// Middleware serves cached GET responses and stores successful ones for ttl
+func (rc *ResponseCache) Middleware(ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || c.GetHeader("Cache-Control") == "no-cache" || credentialed(c.Request) {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key, err := tenant.Key(ctx, cacheKey(c.Request))
+		if err != nil {
+			c.Error(apperrors.NewInternalServerError("Response cache has no tenant scope"))
+			c.Abort()
+			return
+		}
+
+		if raw, ok, err := rc.cache.Get(ctx, key); err == nil && ok {
+			var e entry
+			if json.Unmarshal(raw, &e) == nil {
+				for name, values := range e.Header {
+					c.Writer.Header()[name] = values
+				}
+				c.Header("X-Cache", "HIT")
+				c.Data(e.Status, e.Header.Get("Content-Type"), e.Body)
+				c.Abort()
+				return
+			}
+		}
+
+		writer := &bodyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Header("X-Cache", "MISS")
+
+		c.Next()
+
+		// Errors left in c.Errors are only rendered by ErrorHandler once this returns,
+		// so their status still reads 200 with nothing written
+		if len(c.Errors) > 0 || !writer.Written() || writer.Status() != http.StatusOK || writer.Header().Get("Set-Cookie") != "" {
+			return
+		}
+
+		tags := responseTags(c)
+		header := writer.Header().Clone()
+		header.Del("X-Cache")
+
+		raw, err := json.Marshal(entry{Status: writer.Status(), Header: header, Body: writer.body.Bytes(), Tags: tags})
+		if err != nil {
+			return
+		}
+		if err := rc.cache.Set(ctx, key, raw, ttl); err != nil {
+			logger.Warn("failed to store cached response", zap.String("key", key), zap.Error(err))
+			return
+		}
+		rc.indexTags(key, tags, ttl)
+	}
+}
+
+// Purge invalidates the given cache keys, already scoped by tenant.Key, and surrogate
+// keys on every instance. Surrogate keys purge the entries of every tenant.
+func (rc *ResponseCache) Purge(ctx context.Context, inv cache.Invalidation) error {
+	if err := rc.purgeLocal(ctx, inv); err != nil {
+		return err
+	}
+	return rc.invalidator.Publish(ctx, inv)
+}
+
+// PurgeOnChange purges the responses tagged with a table's name, or with the
+// table and the key of a changed row, as in "users:42", when its rows change
+func (rc *ResponseCache) PurgeOnChange(table string) cdc.Subscription {
+	return cdc.Subscription{Table: table, Handle: func(ctx context.Context, c cdc.Change) error {
+		tags := []string{c.Table}
+		if c.Op != cdc.OpTruncate {
+			tags = append(tags, c.Table+":"+c.Key())
+		}
+		return rc.Purge(ctx, cache.Invalidation{Tags: tags})
+	}}
+}
+
+func (rc *ResponseCache) purgeLocal(ctx context.Context, inv cache.Invalidation) error {
+	keys := append([]string(nil), inv.Keys...)
+
+	rc.mu.Lock()
+	for _, tag := range inv.Tags {
+		for key := range rc.index[tag] {
+			keys = append(keys, key)
+		}
+		delete(rc.index, tag)
+	}
+	rc.mu.Unlock()
+
+	return rc.cache.Delete(ctx, keys...)
+}
+
+func (rc *ResponseCache) indexTags(key string, tags []string, ttl time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	now := time.Now()
+	for _, tag := range tags {
+		if rc.index[tag] == nil {
+			rc.index[tag] = make(map[string]time.Time)
+		}
+		rc.index[tag][key] = now.Add(ttl)
+	}
+	if rc.sets++; rc.sets%sweepEvery == 0 {
+		rc.sweep(now)
+	}
+}
+
+// sweep drops the keys of expired entries from the index, and the tags left
+// without keys. The caller holds rc.mu.
+func (rc *ResponseCache) sweep(now time.Time) {
+	for tag, keys := range rc.index {
+		for key, expiresAt := range keys {
+			if now.After(expiresAt) {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(rc.index, tag)
+		}
+	}
+}
+
+// credentialed reports whether a request carries credentials or cookies
+func credentialed(r *http.Request) bool {
+	for _, name := range credentialHeaders {
+		if r.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// responseTags merges tags set with Tag and the Surrogate-Key response header
+func responseTags(c *gin.Context) []string {
+	tags := strings.Fields(c.Writer.Header().Get(SurrogateKeyHeader))
+	if v, ok := c.Get(surrogateKeysContextKey); ok {
+		tags = append(tags, v.([]string)...)
+	}
+	return tags
+}
+
+// CacheKey returns the cache key used for a request, exposed for purging single
+// URLs. Entries are stored under it as scoped by tenant.Key.
+func CacheKey(method, requestURI string) string {
+	return "httpcache:" + method + ":" + requestURI
+}
+
+func cacheKey(r *http.Request) string {
+	return CacheKey(r.Method, r.URL.RequestURI())
+}
+
+// bodyWriter tees the response body so it can be stored after the handler runs
+type bodyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,83 @@
+package httpcache
+
+import (
+	"net/http"
+	"strings"
+
+	"go-api/pkg/bind"
+	"go-api/pkg/cache"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for purging cached responses
+type Handler struct {
+	cache *ResponseCache
+}
+
+// NewHandler creates a purge handler for rc
+func NewHandler(rc *ResponseCache) *Handler {
+	return &Handler{cache: rc}
+}
+
+// RegisterRoutes mounts the purge endpoints on an admin router group.
+// PURGE takes tags from the Surrogate-Key header, POST takes a JSON body.
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.Handle("PURGE", "/cache", h.purgeByHeader)
+	rg.POST("/cache/purge", h.purgeByBody)
+}
+
+// purgeRequest selects entries by cache key, request path or surrogate key
+type purgeRequest struct {
+	Keys   []string `json:"keys"`
+	Paths  []string `json:"paths"` // Request URIs of GET responses, e.g. /users/42?expand=roles
+	Tags   []string `json:"tags"`
+	Tenant string   `json:"tenant"` // Whose keys and paths are purged, the shared entries when empty
+}
+
+func (h *Handler) purgeByHeader(c *gin.Context) {
+	tags := strings.Fields(c.GetHeader(SurrogateKeyHeader))
+	if len(tags) == 0 {
+		c.Error(apperrors.NewValidationError("Surrogate-Key header is required"))
+		return
+	}
+	h.purge(c, cache.Invalidation{Tags: tags})
+}
+
+func (h *Handler) purgeByBody(c *gin.Context) {
+	var req purgeRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid purge request", err))
+		return
+	}
+
+	keys := req.Keys
+	for _, path := range req.Paths {
+		keys = append(keys, CacheKey(http.MethodGet, path))
+	}
+	if len(keys) == 0 && len(req.Tags) == 0 {
+		c.Error(apperrors.NewValidationError("At least one key, path or tag is required"))
+		return
+	}
+	inv := cache.Invalidation{Tags: req.Tags}
+	scope := tenant.With(c.Request.Context(), req.Tenant)
+	for _, key := range keys {
+		scoped, err := tenant.Key(scope, key)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		inv.Keys = append(inv.Keys, scoped)
+	}
+	h.purge(c, inv)
+}
+
+func (h *Handler) purge(c *gin.Context, inv cache.Invalidation) {
+	if err := h.cache.Purge(c.Request.Context(), inv); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"purged": inv})
+}
@@ -0,0 +1,311 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	"go-api/pkg/cost"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Routes mounts the image endpoints. Uploading and deleting need a signed-in user;
+// images are served to anyone with their ID, so they work in <img> tags.
+func (m *imagesModule) Routes(api *apiversion.Group) {
+	tags := []string{"images"}
+	api.POST("/images", apiversion.Operation{
+		ID:          "uploadImage",
+		Summary:     "Upload an image",
+		Description: "Takes a JPEG, PNG or GIF as the multipart field file or as the raw body. Metadata like EXIF is stripped and thumbnails are rendered in the background; the image is ready once its status is.",
+		Tags:        tags,
+		Cost:        10,
+		Response:    Image{},
+	}, m.upload)
+	api.GET("/images/:id", apiversion.Operation{
+		ID:       "getImage",
+		Summary:  "Get an image's details and variants",
+		Tags:     tags,
+		Response: Image{},
+	}, m.get)
+	api.GET("/images/:id/variants/:variant", apiversion.Operation{
+		ID:          "getImageVariant",
+		Summary:     "Download an image variant",
+		Description: "Variant is original or one of the configured sizes. Sizes not rendered yet are rendered on the spot. Images are refused with 409 while being scanned for malware and 403 once quarantined.",
+		Tags:        tags,
+	}, m.variant)
+	api.GET("/images/:id/resize", apiversion.Operation{
+		ID:          "resizeImage",
+		Summary:     "Download an image resized",
+		Description: "Takes width and height, either optional, and fit, cover or contain. Sizes are rounded up to a step and cached, so few distinct ones are rendered. Costs one more per megapixel of the original.",
+		Tags:        tags,
+		Cost:        2,
+	}, m.resize)
+	api.DELETE("/images/:id", apiversion.Operation{
+		ID:      "deleteImage",
+		Summary: "Delete an image and its variants",
+		Tags:    tags,
+	}, m.delete)
+}
+
+func (m *imagesModule) upload(c *gin.Context) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return
+	}
+	data, err := m.readUpload(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	src, format, err := decode(data, m.cfg.MaxPixels)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The original is re-encoded too, which drops its metadata
+	var buf bytes.Buffer
+	if err := encode(&buf, src, format, m.cfg.Quality); err != nil {
+		c.Error(err)
+		return
+	}
+	now := time.Now().UTC()
+	b := src.Bounds()
+	img := Image{
+		ID:        uuid.New().String(),
+		OwnerID:   sub.ID,
+		Tenant:    sub.Tenant,
+		Format:    format,
+		Width:     b.Dx(),
+		Height:    b.Dy(),
+		Status:    StatusProcessing,
+		Variants:  make(map[string]Variant),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ctx := c.Request.Context()
+	key := m.variantKey(img, VariantOriginal)
+	obj, err := m.storage.Put(ctx, key, &buf, contentTypes[format])
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	img.Size = obj.Size
+	img.Variants[VariantOriginal] = Variant{Width: img.Width, Height: img.Height, Size: obj.Size}
+	jobType := jobVariants
+	switch {
+	case m.scanner != nil:
+		img.Scan, jobType = ScanPending, jobScan
+	case len(m.cfg.Sizes) == 0:
+		img.Status = StatusReady
+	}
+	if err := m.store.Save(ctx, img); err != nil {
+		c.Error(err)
+		return
+	}
+	if img.Status == StatusProcessing {
+		// Variants are rendered on request when missing, so the upload stands anyway;
+		// a scan has to run though, or the image is never served
+		if _, err := m.queue.Enqueue(ctx, "default", jobType, imageJob{ImageID: img.ID}); err != nil {
+			logger.Error("failed to enqueue image processing", zap.String("image", img.ID), zap.String("job", jobType), zap.Error(err))
+		}
+	}
+	c.JSON(http.StatusAccepted, img)
+}
+
+// readUpload reads the file field of a multipart form, or else the raw body, up to
+// the configured size
+func (m *imagesModule) readUpload(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, m.cfg.MaxBytes)
+	var r io.Reader = c.Request.Body
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			return nil, uploadError(err)
+		}
+		defer file.Close()
+		r = file
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+	if len(data) == 0 {
+		return nil, apperrors.NewValidationError("No image uploaded")
+	}
+	return data, nil
+}
+
+func uploadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apperrors.NewValidationError(fmt.Sprintf("Image is larger than %d bytes", tooLarge.Limit))
+	}
+	if errors.Is(err, http.ErrMissingFile) {
+		return apperrors.NewValidationError("Missing file field")
+	}
+	return apperrors.NewValidationError("Invalid upload: " + err.Error())
+}
+
+func (m *imagesModule) get(c *gin.Context) {
+	img, err := m.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, img)
+}
+
+func (m *imagesModule) variant(c *gin.Context) {
+	ctx := c.Request.Context()
+	img, err := m.store.Get(ctx, c.Param("id"))
+	if err == nil {
+		err = servable(img)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	name := c.Param("variant")
+	key := m.variantKey(img, name)
+	if _, ok := img.Variants[name]; ok {
+		m.serve(c, key)
+		return
+	}
+	size, ok := m.cfg.Sizes[name]
+	if !ok {
+		c.Error(apperrors.NewNotFoundError("Unknown image variant " + name))
+		return
+	}
+	// Still processing, or rendering failed: render it for this request instead
+	if _, err := m.render(ctx, img, key, size); err != nil {
+		c.Error(err)
+		return
+	}
+	m.serve(c, key)
+}
+
+func (m *imagesModule) resize(c *gin.Context) {
+	ctx := c.Request.Context()
+	img, err := m.store.Get(ctx, c.Param("id"))
+	if err == nil {
+		err = servable(img)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	size, err := m.parseSize(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	// Decoding the original is the work, whatever the size asked for
+	if err := cost.Charge(c, int64(img.Width*img.Height/1_000_000)); err != nil {
+		c.Error(err)
+		return
+	}
+	key := m.cacheKey(img, size)
+	if _, err := m.render(ctx, img, key, size); err != nil {
+		c.Error(err)
+		return
+	}
+	m.serve(c, key)
+}
+
+// parseSize reads the requested size, capped at the largest allowed and rounded up
+// to the resize step so arbitrary sizes can't fill the cache
+func (m *imagesModule) parseSize(c *gin.Context) (Size, error) {
+	var size Size
+	var fields []apperrors.FieldError
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"width", &size.Width}, {"height", &size.Height}} {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			fields = append(fields, apperrors.FieldError{Field: p.name, Rule: "min", Param: "1", Message: p.name + " must be a positive number"})
+			continue
+		}
+		n = min(n, m.cfg.MaxDimension)
+		if step := m.cfg.ResizeStep; step > 1 {
+			n = min((n+step-1)/step*step, m.cfg.MaxDimension)
+		}
+		*p.dst = n
+	}
+	size.Fit = strings.ToLower(c.DefaultQuery("fit", FitContain))
+	if size.Fit != FitCover && size.Fit != FitContain {
+		fields = append(fields, apperrors.FieldError{Field: "fit", Rule: "oneof", Param: "cover contain", Message: "fit must be cover or contain"})
+	}
+	if len(fields) == 0 && size.Width == 0 && size.Height == 0 {
+		fields = append(fields, apperrors.FieldError{Field: "width", Rule: "required", Message: "width or height is required"})
+	}
+	if len(fields) > 0 {
+		return Size{}, apperrors.NewValidationError("Invalid image size", fields...)
+	}
+	return size, nil
+}
+
+// serve writes a stored object. Objects under a key never change, so they can be
+// cached for long.
+func (m *imagesModule) serve(c *gin.Context, key string) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(m.cfg.CacheMaxAge.Seconds())))
+	if err := storage.Serve(c.Writer, c.Request, m.storage, key); err != nil {
+		c.Writer.Header().Del("Cache-Control")
+		c.Error(err)
+	}
+}
+
+func (m *imagesModule) delete(c *gin.Context) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return
+	}
+	ctx := c.Request.Context()
+	img, err := m.store.Get(ctx, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if img.OwnerID != sub.ID {
+		c.Error(apperrors.NewForbiddenError("Only the owner can delete an image"))
+		return
+	}
+
+	if err := m.store.Delete(ctx, img.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	// The record is gone, so leftovers are unreachable; they are only logged
+	objects, err := m.storage.List(ctx, "images/"+img.ID+"/")
+	if err != nil {
+		logger.Error("failed to list image objects", zap.String("image", img.ID), zap.Error(err))
+	}
+	for _, obj := range objects {
+		if err := m.storage.Delete(ctx, obj.Key); err != nil {
+			logger.Error("failed to delete image object", zap.String("key", obj.Key), zap.Error(err))
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,301 @@
+// Package images is the feature module for uploaded pictures. Uploads are checked,
+// have their EXIF metadata stripped and are stored through pkg/storage; a job then
+// renders the configured thumbnail sizes, and any other size is resized on request
+// and cached. With ClamAV configured, uploads are scanned first and nothing is served
+// until they are found clean.
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/subresource"
+	"go-api/pkg/authz"
+	"go-api/pkg/cache"
+	"go-api/pkg/cdc"
+	"go-api/pkg/clamav"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/mongodb"
+	"go-api/pkg/queue"
+	"go-api/pkg/storage"
+	"go-api/pkg/tenant"
+)
+
+// Config holds image processing configuration
+type Config struct {
+	MaxBytes     int64           `yaml:"maxBytes"`     // Largest upload accepted
+	MaxPixels    int             `yaml:"maxPixels"`    // Largest width × height accepted, bounding decode memory
+	Sizes        map[string]Size `yaml:"sizes"`        // Variants rendered for every upload, by name
+	Quality      int             `yaml:"quality"`      // JPEG quality from 1 to 100
+	MaxDimension int             `yaml:"maxDimension"` // Largest width or height of on-request resizes
+	ResizeStep   int             `yaml:"resizeStep"`   // On-request sizes are rounded up to multiples of this
+	CacheMaxAge  time.Duration   `yaml:"cacheMaxAge"`  // Cache-Control max-age of served images
+	Store        string          `yaml:"store"`        // memory, sql or mongodb; the database by default
+	// Of image records, off by default: without Redis each instance caches its own,
+	// missing the status changes of jobs run elsewhere for up to the TTL
+	Cache cache.RepositoryConfig `yaml:"cache"`
+}
+
+// Size is the bounding box of a variant. Either dimension may be 0 to follow the
+// aspect ratio.
+type Size struct {
+	Width  int    `json:"width" yaml:"width"`
+	Height int    `json:"height" yaml:"height"`
+	Fit    string `json:"fit" yaml:"fit"` // cover or contain (default)
+}
+
+// Image statuses
+const (
+	StatusProcessing  = "processing" // Being scanned or having variants rendered
+	StatusReady       = "ready"
+	StatusFailed      = "failed"
+	StatusQuarantined = "quarantined" // Malware was found; the file is kept for review only
+)
+
+// Antivirus scan states of an image. It is empty when scanning is off.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+// VariantOriginal names the uploaded image itself, minus its metadata
+const VariantOriginal = "original"
+
+// Image is an uploaded picture
+type Image struct {
+	ID        string             `json:"id" index:",unique"`
+	OwnerID   string             `json:"ownerId" index:""`
+	Tenant    string             `json:"tenant,omitempty"`
+	Format    string             `json:"format"` // jpeg, png or gif
+	Width     int                `json:"width"`
+	Height    int                `json:"height"`
+	Size      int64              `json:"size"` // Bytes of the stored original
+	Status    string             `json:"status"`
+	Scan      string             `json:"scan,omitempty"`
+	Variants  map[string]Variant `json:"variants"`
+	Error     string             `json:"error,omitempty"` // Why rendering failed
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+// Variant is a stored rendering of an image, kept under variantKey
+type Variant struct {
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	Size   int64 `json:"size"`
+}
+
+// Background jobs of an upload: the scan, when on, then rendering the configured sizes
+const (
+	jobScan     = "images.scan"
+	jobVariants = "images.variants"
+)
+
+// imageJob is the payload of both jobs
+type imageJob struct {
+	ImageID string `json:"imageId"`
+}
+
+type imagesModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	mongo   *mongodb.Client // Set when the records are kept in MongoDB
+	storage storage.Storage
+	queue   *queue.Manager
+	scanner *clamav.Client
+	events  eventstore.Store
+}
+
+// New returns the factory of the images module, which needs the shared storage
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if deps.Storage == nil {
+			return nil, errors.New("images: no storage configured")
+		}
+		for name, size := range cfg.Sizes {
+			if size.Width <= 0 && size.Height <= 0 {
+				return nil, fmt.Errorf("images: size %s needs a width or height", name)
+			}
+			if size.Fit != "" && size.Fit != FitCover && size.Fit != FitContain {
+				return nil, fmt.Errorf("images: size %s has unknown fit %q", name, size.Fit)
+			}
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("images: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		var mongo *mongodb.Client
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			mongo = deps.Mongo
+			if store, err = NewMongoStore(context.Background(), deps.Mongo); err != nil {
+				return nil, fmt.Errorf("images: %w", err)
+			}
+		}
+		if cfg.Cache.TTL > 0 {
+			store = cache.NewCachedRepository[Image](store, deps.Cache, "images", func(img Image) string { return img.ID }, errImageNotFound, cfg.Cache)
+		}
+		return &imagesModule{cfg: cfg, backend: backend, store: store, mongo: mongo, storage: deps.Storage, queue: deps.Queue, scanner: deps.Antivirus, events: deps.Events}, nil
+	}
+}
+
+func (m *imagesModule) Name() string { return "images" }
+
+func (m *imagesModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// Parents lets images take comments and attachments
+func (m *imagesModule) Parents() []subresource.Parent {
+	return []subresource.Parent{{Type: "image", Path: "/images", Resolve: func(ctx context.Context, id string) (authz.Resource, error) {
+		img, err := m.store.Get(ctx, id)
+		if err != nil {
+			return authz.Resource{}, err
+		}
+		return authz.Resource{Type: "image", ID: img.ID, Owner: img.OwnerID, Tenant: img.Tenant}, nil
+	}}}
+}
+
+func (m *imagesModule) Jobs() map[string]queue.HandlerFunc {
+	return map[string]queue.HandlerFunc{jobScan: m.scan, jobVariants: m.renderVariants}
+}
+
+// ChangeSubscriptions drop cached image records when their rows change around
+// the API. Cache entries are scoped by the tenant in the record, which deleted
+// rows only carry with REPLICA IDENTITY FULL; other deletes wait out the TTL.
+func (m *imagesModule) ChangeSubscriptions() []cdc.Subscription {
+	cached, ok := m.store.(*cache.CachedRepository[Image])
+	if !ok || m.backend != module.BackendSQL {
+		return nil
+	}
+	return []cdc.Subscription{{Table: "images", Handle: func(ctx context.Context, c cdc.Change) error {
+		data, ok := c.Row["data"]
+		if len(c.Old) > 0 && c.Old["data"] != "" {
+			data, ok = c.Old["data"], true
+		}
+		if c.Op == cdc.OpTruncate || !ok {
+			return nil
+		}
+		var img Image
+		if err := json.Unmarshal([]byte(data), &img); err != nil {
+			return nil
+		}
+		return cached.Invalidate(tenant.With(ctx, img.Tenant), c.Key())
+	}}}
+}
+
+func (m *imagesModule) HealthChecks() []module.HealthCheck {
+	checks := []module.HealthCheck{{Name: "storage", Check: func(ctx context.Context) error {
+		_, err := m.storage.List(ctx, "images/health/")
+		return err
+	}}}
+	if m.scanner != nil {
+		checks = append(checks, module.HealthCheck{Name: "antivirus", Check: m.scanner.Ping})
+	}
+	if m.mongo != nil {
+		checks = append(checks, module.HealthCheck{Name: "mongodb", Check: m.mongo.Ping})
+	}
+	return checks
+}
+
+// renderVariants renders every configured size of an image. A failure marks the
+// image failed; the queue's retries may still mark it ready later.
+func (m *imagesModule) renderVariants(ctx context.Context, job *queue.Job) error {
+	var payload imageJob
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	img, err := m.store.Get(ctx, payload.ImageID)
+	if errors.Is(err, errImageNotFound) {
+		// Deleted before its variants were rendered
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if img.Scan == ScanPending || img.Scan == ScanInfected {
+		return nil
+	}
+
+	for name, size := range m.cfg.Sizes {
+		if _, done := img.Variants[name]; done {
+			continue
+		}
+		v, err := m.render(ctx, img, m.variantKey(img, name), size)
+		if err != nil {
+			img.Status, img.Error, img.UpdatedAt = StatusFailed, err.Error(), time.Now().UTC()
+			if saveErr := m.store.Save(ctx, img); saveErr != nil {
+				return saveErr
+			}
+			return fmt.Errorf("images: rendering %s of %s: %w", name, img.ID, err)
+		}
+		img.Variants[name] = v
+	}
+	img.Status, img.Error, img.UpdatedAt = StatusReady, "", time.Now().UTC()
+	return m.store.Save(ctx, img)
+}
+
+// render stores the original resized to size under key, unless it already is there
+func (m *imagesModule) render(ctx context.Context, img Image, key string, size Size) (Variant, error) {
+	if cached, obj, err := m.storage.Open(ctx, key); err == nil {
+		defer cached.Close()
+		cfg, _, err := image.DecodeConfig(cached)
+		if err != nil {
+			return Variant{}, err
+		}
+		return Variant{Width: cfg.Width, Height: cfg.Height, Size: obj.Size}, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return Variant{}, err
+	}
+
+	original, _, err := m.storage.Open(ctx, m.variantKey(img, VariantOriginal))
+	if err != nil {
+		return Variant{}, err
+	}
+	defer original.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(original); err != nil {
+		return Variant{}, err
+	}
+	src, format, err := decode(buf.Bytes(), max(m.cfg.MaxPixels, img.Width*img.Height))
+	if err != nil {
+		return Variant{}, err
+	}
+
+	resized := resize(src, size.Width, size.Height, size.Fit)
+	buf.Reset()
+	if err := encode(&buf, resized, format, m.cfg.Quality); err != nil {
+		return Variant{}, err
+	}
+	b := resized.Bounds()
+	obj, err := m.storage.Put(ctx, key, &buf, contentTypes[format])
+	if err != nil {
+		return Variant{}, err
+	}
+	return Variant{Width: b.Dx(), Height: b.Dy(), Size: obj.Size}, nil
+}
+
+// variantKey is where a variant of img is stored, like images/{id}/thumb.jpg
+func (m *imagesModule) variantKey(img Image, name string) string {
+	return "images/" + img.ID + "/" + name + "." + extensions[img.Format]
+}
+
+// cacheKey is where an on-request resize of img is kept
+func (m *imagesModule) cacheKey(img Image, size Size) string {
+	return fmt.Sprintf("images/%s/cache/%dx%d-%s.%s", img.ID, size.Width, size.Height, size.Fit, extensions[img.Format])
+}
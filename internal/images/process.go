@@ -0,0 +1,183 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// Formats accepted for upload, with the content type images are served as
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// extensions are the file extensions of stored objects by format
+var extensions = map[string]string{"jpeg": "jpg", "png": "png", "gif": "gif"}
+
+const (
+	FitCover   = "cover"   // Fill the size, cropping what sticks out
+	FitContain = "contain" // Fit inside the size, keeping the whole image
+)
+
+// decode checks an upload against the limits before decoding it, so oversized or
+// malformed files are rejected without allocating their pixels
+func decode(data []byte, maxPixels int) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", apperrors.NewValidationError("Unsupported image, upload a JPEG, PNG or GIF")
+	}
+	if _, ok := contentTypes[format]; !ok {
+		return nil, "", apperrors.NewValidationError("Unsupported image format " + format + ", upload a JPEG, PNG or GIF")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, "", apperrors.NewValidationError(fmt.Sprintf("Image is %d×%d pixels, more than the %d allowed", cfg.Width, cfg.Height, maxPixels))
+	}
+
+	// Animated GIFs keep only their first frame
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", apperrors.NewValidationError("Image is corrupt: " + err.Error())
+	}
+	if format == "jpeg" {
+		img = orient(img, orientation(data))
+	}
+	return img, format, nil
+}
+
+// encode writes img in format. Go's encoders write no metadata, so EXIF, including
+// any GPS position, is gone from everything stored.
+func encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "png":
+		return png.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	}
+	return errors.New("images: can't encode " + format)
+}
+
+// orient rotates and flips img as its EXIF orientation says
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// resize scales img to a width and height, either of which may be 0 to keep the
+// aspect ratio. Images are never enlarged.
+func resize(img image.Image, width, height int, fit string) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if width <= 0 && height <= 0 {
+		return img
+	}
+	if width <= 0 {
+		width = max(sw*height/sh, 1)
+	}
+	if height <= 0 {
+		height = max(sh*width/sw, 1)
+	}
+
+	src := b
+	if fit == FitCover {
+		// Crop the middle of the source to the target's aspect ratio
+		if sw*height > sh*width {
+			cw := sh * width / height
+			src = image.Rect(b.Min.X+(sw-cw)/2, b.Min.Y, b.Min.X+(sw-cw)/2+cw, b.Max.Y)
+		} else {
+			ch := sw * height / width
+			src = image.Rect(b.Min.X, b.Min.Y+(sh-ch)/2, b.Max.X, b.Min.Y+(sh-ch)/2+ch)
+		}
+	} else {
+		// Shrink the target to the source's aspect ratio
+		if sw*height > sh*width {
+			height = max(sh*width/sw, 1)
+		} else {
+			width = max(sw*height/sh, 1)
+		}
+	}
+	if width >= src.Dx() || height >= src.Dy() {
+		width, height = src.Dx(), src.Dy()
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, src.Dx(), src.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, src.Min, draw.Src)
+	if width == src.Dx() && height == src.Dy() {
+		return rgba
+	}
+	return boxScale(rgba, width, height)
+}
+
+// boxScale shrinks src by averaging the source pixels each target pixel covers,
+// which keeps detail without the aliasing of sampling single pixels. Averaging
+// premultiplied colors keeps transparent edges from darkening.
+func boxScale(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,143 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-api/internal/realtime"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+	"go-api/pkg/queue"
+
+	"go.uber.org/zap"
+)
+
+// EventQuarantined is recorded on the image's stream, images-{id}, when malware is
+// found in it
+const EventQuarantined = "image.quarantined"
+
+// Quarantined is the data of an EventQuarantined event
+type Quarantined struct {
+	ImageID   string `json:"imageId"`
+	OwnerID   string `json:"ownerId"`
+	Tenant    string `json:"tenant,omitempty"`
+	Signature string `json:"signature"`
+	Key       string `json:"key"` // Where the file was moved for review
+}
+
+// EventSchemas declares the schemas of the events recorded on image streams
+func (m *imagesModule) EventSchemas() []eventschema.Schema {
+	return []eventschema.Schema{{Event: EventQuarantined, Version: 1,
+		Description: "Malware was found in an uploaded image, which was moved for review.",
+		Schema:      eventschema.From(Quarantined{})}}
+}
+
+// Topics lets clients follow the events of the images they may read
+func (m *imagesModule) Topics() []realtime.Topic {
+	return []realtime.Topic{{Name: "images", Events: []string{EventQuarantined},
+		Resource: "image", IDField: "imageId", Owner: "ownerId", Tenant: "tenant"}}
+}
+
+// scan runs the stored original through ClamAV. Clean images go on to have their
+// variants rendered; infected ones are quarantined. Errors, like clamd being down,
+// are retried by the queue and keep the image unservable meanwhile.
+func (m *imagesModule) scan(ctx context.Context, job *queue.Job) error {
+	var payload imageJob
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	img, err := m.store.Get(ctx, payload.ImageID)
+	if errors.Is(err, errImageNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if img.Scan != ScanPending {
+		return nil
+	}
+
+	original, _, err := m.storage.Open(ctx, m.variantKey(img, VariantOriginal))
+	if err != nil {
+		return err
+	}
+	result, err := m.scanner.Scan(ctx, original)
+	original.Close()
+	if err != nil {
+		return err
+	}
+	if result.Infected {
+		return m.quarantine(ctx, img, result.Signature)
+	}
+
+	img.Scan, img.UpdatedAt = ScanClean, time.Now().UTC()
+	if len(m.cfg.Sizes) == 0 {
+		img.Status = StatusReady
+	}
+	if err := m.store.Save(ctx, img); err != nil {
+		return err
+	}
+	if img.Status == StatusProcessing {
+		_, err = m.queue.Enqueue(ctx, "default", jobVariants, imageJob{ImageID: img.ID})
+	}
+	return err
+}
+
+// quarantine moves an infected original out of the image's keys, so nothing can
+// serve it, deletes its renderings and records an audit event
+func (m *imagesModule) quarantine(ctx context.Context, img Image, signature string) error {
+	src := m.variantKey(img, VariantOriginal)
+	dst := "quarantine/" + src
+	content, obj, err := m.storage.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	_, err = m.storage.Put(ctx, dst, content, obj.ContentType)
+	content.Close()
+	if err != nil {
+		return err
+	}
+
+	img.Status, img.Scan, img.UpdatedAt = StatusQuarantined, ScanInfected, time.Now().UTC()
+	img.Error = "Malware found: " + signature
+	img.Variants = map[string]Variant{}
+	if err := m.store.Save(ctx, img); err != nil {
+		return err
+	}
+	objects, err := m.storage.List(ctx, "images/"+img.ID+"/")
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if err := m.storage.Delete(ctx, o.Key); err != nil {
+			return err
+		}
+	}
+
+	logger.Warn("malware found in image upload",
+		zap.String("image", img.ID),
+		zap.String("owner", img.OwnerID),
+		zap.String("signature", signature),
+		zap.String("quarantine", dst),
+	)
+	_, err = m.events.Append(ctx, "images-"+img.ID, eventstore.AnyVersion, eventstore.NewEvent{
+		Type:     EventQuarantined,
+		Data:     Quarantined{ImageID: img.ID, OwnerID: img.OwnerID, Tenant: img.Tenant, Signature: signature, Key: dst},
+		Metadata: map[string]string{"source": "clamav"},
+	})
+	return err
+}
+
+// servable refuses downloads of images not found clean yet when scanning is on
+func servable(img Image) error {
+	switch img.Scan {
+	case ScanPending:
+		return apperrors.NewConflictError("Image is still being scanned for malware")
+	case ScanInfected:
+		return apperrors.NewForbiddenError("Image was quarantined because malware was found in it")
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package images
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Store persists image records; the pixels themselves are in storage
+type Store interface {
+	Save(ctx context.Context, img Image) error
+	Get(ctx context.Context, id string) (Image, error)
+	Delete(ctx context.Context, id string) error
+}
+
+var errImageNotFound = apperrors.NewNotFoundError("Image not found")
+
+// MemoryStore keeps images in memory, used when no database is configured
+type MemoryStore struct {
+	mu     sync.RWMutex
+	images map[string]Image
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{images: make(map[string]Image)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, img Image) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images[img.ID] = img
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Image, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	img, ok := s.images[id]
+	if !ok {
+		return Image{}, errImageNotFound
+	}
+	return img, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.images, id)
+	return nil
+}
+
+// migrations create the images table, with the record as JSON in data
+var migrations = []module.Migration{{
+	Name: "create_images",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS images (
+			id         TEXT PRIMARY KEY,
+			owner_id   TEXT NOT NULL,
+			status     TEXT NOT NULL,
+			data       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)`,
+}}
+
+// SQLStore persists images in the images table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Save(ctx context.Context, img Image) error {
+	data, err := json.Marshal(img)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO images (id, owner_id, status, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			data = EXCLUDED.data`,
+		img.ID, img.OwnerID, img.Status, string(data), img.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Image, error) {
+	var data string
+	err := s.conn(ctx).QueryRowContext(ctx, `SELECT data FROM images WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Image{}, errImageNotFound
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	var img Image
+	return img, json.Unmarshal([]byte(data), &img)
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM images WHERE id = $1`, id)
+	return err
+}
+
+// MongoStore persists images in the images collection
+type MongoStore struct {
+	images mongodb.Collection[Image]
+}
+
+// NewMongoStore creates a store backed by c, creating its indexes
+func NewMongoStore(ctx context.Context, c *mongodb.Client) (*MongoStore, error) {
+	images := mongodb.NewCollection[Image](c, "images", "id", errImageNotFound)
+	if err := images.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return &MongoStore{images: images}, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, img Image) error {
+	return s.images.Save(ctx, img.ID, img)
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (Image, error) {
+	return s.images.Get(ctx, id)
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	// Deleting a missing image is not an error, as with the other stores
+	_, err := s.images.DeleteMany(ctx, bson.D{{Key: "id", Value: id}})
+	return err
+}
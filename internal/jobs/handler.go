@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"go-api/internal/admin"
+	"go-api/pkg/queue"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints to inspect and control job queues
+type Handler struct {
+	queues *queue.Manager
+}
+
+// NewHandler creates a job queue handler
+func NewHandler(queues *queue.Manager) *Handler {
+	return &Handler{queues: queues}
+}
+
+// RegisterRoutes mounts the queue endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/queues", h.stats)
+	rg.GET("/queues/:queue/jobs", routing.Query("limit", "status"), h.list)
+	rg.POST("/queues/:queue/retry", h.retryDead)
+	rg.POST("/queues/:queue/pause", h.pause)
+	rg.POST("/queues/:queue/resume", h.resume)
+	rg.GET("/jobs/:id", h.get)
+	rg.POST("/jobs/:id/retry", h.retry)
+}
+
+// QueueStats implements admin.QueueInspector for the dashboard
+func (h *Handler) QueueStats(ctx context.Context) ([]admin.QueueStats, error) {
+	var stats []admin.QueueStats
+	for _, s := range h.queues.Stats() {
+		stats = append(stats, admin.QueueStats{
+			Name:    s.Name,
+			Pending: s.Pending,
+			Active:  s.Active,
+			Failed:  s.Dead,
+			Paused:  s.Paused,
+		})
+	}
+	return stats, nil
+}
+
+func (h *Handler) stats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.queues.Stats()})
+}
+
+// list returns jobs of a queue, filtered with ?status= and capped with ?limit= (default 100)
+func (h *Handler) list(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		limit = 100
+	}
+
+	jobs, err := h.queues.Jobs(c.Param("queue"), queue.Status(c.Query("status")), limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+func (h *Handler) get(c *gin.Context) {
+	job, err := h.queues.Job(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *Handler) retry(c *gin.Context) {
+	if err := h.queues.Retry(c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func (h *Handler) retryDead(c *gin.Context) {
+	n, err := h.queues.RetryDead(c.Param("queue"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"retried": n})
+}
+
+func (h *Handler) pause(c *gin.Context) {
+	if err := h.queues.Pause(c.Param("queue")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) resume(c *gin.Context) {
+	if err := h.queues.Resume(c.Param("queue")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
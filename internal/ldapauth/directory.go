@@ -0,0 +1,280 @@
+package ldapauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/pkg/crypto"
+	apperrors "go-api/pkg/errors"
+)
+
+// Directory is an LDAP or Active Directory server users authenticate against. The
+// global directory has an empty Tenant and is used by tenants without their own,
+// for the users it maps to them.
+type Directory struct {
+	Tenant             string              `json:"tenant" yaml:"tenant"`
+	URL                string              `json:"url" yaml:"url"` // ldap://host:389 or ldaps://host:636
+	StartTLS           bool                `json:"startTLS" yaml:"startTLS"`
+	InsecureSkipVerify bool                `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+	BindDN             string              `json:"bindDN" yaml:"bindDN"` // Service account used to look up users
+	BindPassword       string              `json:"bindPassword,omitempty" yaml:"bindPassword" encrypt:"true"`
+	BaseDN             string              `json:"baseDN" yaml:"baseDN"`
+	UserFilter         string              `json:"userFilter" yaml:"userFilter"` // %s is replaced by the escaped username
+	EmailAttribute     string              `json:"emailAttribute" yaml:"emailAttribute"`
+	NameAttribute      string              `json:"nameAttribute" yaml:"nameAttribute"`
+	GroupAttribute     string              `json:"groupAttribute" yaml:"groupAttribute"`
+	GroupRoles         map[string][]string `json:"groupRoles" yaml:"groupRoles"` // Group DN -> roles
+	DefaultRoles       []string            `json:"defaultRoles" yaml:"defaultRoles"`
+	// TenantAttribute and GroupTenants decide which tenants users of the global
+	// directory may sign in to: those named by the attribute of their entry, and
+	// those their groups map to; other tenants are refused. A tenant's own
+	// directory only signs users in to its tenant.
+	TenantAttribute string            `json:"tenantAttribute,omitempty" yaml:"tenantAttribute"`
+	GroupTenants    map[string]string `json:"groupTenants,omitempty" yaml:"groupTenants"` // Group DN -> tenant
+	PoolSize        int               `json:"poolSize" yaml:"poolSize"`
+	Timeout         time.Duration     `json:"timeout" yaml:"timeout"`
+	UpdatedAt       time.Time         `json:"updatedAt" yaml:"-"`
+}
+
+// withDefaults fills in values that suit OpenLDAP and Active Directory alike
+func (d Directory) withDefaults() Directory {
+	if d.UserFilter == "" {
+		d.UserFilter = "(|(uid=%s)(sAMAccountName=%s)(userPrincipalName=%s))"
+	}
+	if d.EmailAttribute == "" {
+		d.EmailAttribute = "mail"
+	}
+	if d.NameAttribute == "" {
+		d.NameAttribute = "displayName"
+	}
+	if d.GroupAttribute == "" {
+		d.GroupAttribute = "memberOf"
+	}
+	if d.PoolSize <= 0 {
+		d.PoolSize = 4
+	}
+	if d.Timeout <= 0 {
+		d.Timeout = 5 * time.Second
+	}
+	return d
+}
+
+// Store persists per-tenant directories
+type Store interface {
+	Get(ctx context.Context, tenant string) (Directory, error)
+	List(ctx context.Context) ([]Directory, error)
+	Put(ctx context.Context, d Directory) error
+	Delete(ctx context.Context, tenant string) error
+}
+
+var errDirectoryNotFound = apperrors.NewNotFoundError("LDAP is not configured for this tenant")
+
+// MemoryStore keeps directories in memory, used when no database is configured
+type MemoryStore struct {
+	mu          sync.RWMutex
+	directories map[string]Directory
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{directories: make(map[string]Directory)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, tenant string) (Directory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.directories[tenant]
+	if !ok {
+		return Directory{}, errDirectoryNotFound
+	}
+	return d, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Directory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Directory, 0, len(s.directories))
+	for _, d := range s.directories {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tenant < list[j].Tenant })
+	return list, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, d Directory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.directories[d.Tenant] = d
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, tenant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.directories[tenant]; !ok {
+		return errDirectoryNotFound
+	}
+	delete(s.directories, tenant)
+	return nil
+}
+
+// SQLStore persists directories as JSON in the ldap_directories table. With an
+// envelope, bind passwords are encrypted before the config is written.
+type SQLStore struct {
+	db       *sql.DB
+	envelope *crypto.Envelope
+}
+
+// NewSQLStore creates a store backed by db, envelope may be nil
+func NewSQLStore(db *sql.DB, envelope *crypto.Envelope) *SQLStore {
+	return &SQLStore{db: db, envelope: envelope}
+}
+
+// EnsureSchema creates the ldap_directories table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS ldap_directories (
+			tenant     TEXT PRIMARY KEY,
+			config     TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, tenant string) (Directory, error) {
+	var config string
+	err := s.db.QueryRowContext(ctx, `SELECT config FROM ldap_directories WHERE tenant = $1`, tenant).Scan(&config)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Directory{}, errDirectoryNotFound
+	}
+	if err != nil {
+		return Directory{}, err
+	}
+	return s.decode(ctx, tenant, config)
+}
+
+// record is where the fields of the directory of a tenant are stored
+func record(tenant string) crypto.Record {
+	return crypto.Record{Table: "ldap_directories", ID: tenant}
+}
+
+func (s *SQLStore) decode(ctx context.Context, tenant, config string) (Directory, error) {
+	var d Directory
+	if err := json.Unmarshal([]byte(config), &d); err != nil {
+		return Directory{}, err
+	}
+	if s.envelope != nil {
+		if err := s.envelope.DecryptFields(ctx, &d, record(tenant)); err != nil {
+			return Directory{}, err
+		}
+	}
+	return d, nil
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Directory, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tenant, config FROM ldap_directories ORDER BY tenant`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Directory
+	for rows.Next() {
+		var tenant, config string
+		if err := rows.Scan(&tenant, &config); err != nil {
+			return nil, err
+		}
+		d, err := s.decode(ctx, tenant, config)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Put(ctx context.Context, d Directory) error {
+	if s.envelope != nil {
+		if err := s.envelope.EncryptFields(ctx, &d, record(d.Tenant)); err != nil {
+			return err
+		}
+	}
+	return s.put(ctx, d)
+}
+
+func (s *SQLStore) put(ctx context.Context, d Directory) error {
+	config, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO ldap_directories (tenant, config, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant) DO UPDATE SET config = EXCLUDED.config, updated_at = EXCLUDED.updated_at`,
+		d.Tenant, string(config), d.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, tenant string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM ldap_directories WHERE tenant = $1`, tenant)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errDirectoryNotFound
+	}
+	return nil
+}
+
+// Reencrypt rewrites directories whose bind password is still plaintext or wrapped
+// by a retired master key, returning how many were updated
+func (s *SQLStore) Reencrypt(ctx context.Context) (int, error) {
+	if s.envelope == nil {
+		return 0, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT tenant, config FROM ldap_directories ORDER BY tenant`)
+	if err != nil {
+		return 0, err
+	}
+	var stored []Directory
+	for rows.Next() {
+		var tenant, config string
+		if err := rows.Scan(&tenant, &config); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var d Directory
+		if err := json.Unmarshal([]byte(config), &d); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		d.Tenant = tenant
+		stored = append(stored, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, d := range stored {
+		changed, err := s.envelope.ReencryptFields(ctx, &d, record(d.Tenant))
+		if err != nil {
+			return updated, err
+		}
+		if !changed {
+			continue
+		}
+		if err := s.put(ctx, d); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
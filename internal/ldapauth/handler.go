@@ -0,0 +1,116 @@
+package ldapauth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-api/internal/users"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes the LDAP login endpoint and admin directory configuration
+type Handler struct {
+	auth   *Authenticator
+	tokens *users.TokenIssuer
+}
+
+// NewHandler creates an LDAP handler
+func NewHandler(auth *Authenticator, tokens *users.TokenIssuer) *Handler {
+	return &Handler{auth: auth, tokens: tokens}
+}
+
+// RegisterRoutes mounts the login endpoint on a public router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.POST("/ldap/login", h.login)
+}
+
+// RegisterAdminRoutes mounts per-tenant directory configuration on an admin router group
+func (h *Handler) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/ldap/directories", h.list)
+	rg.PUT("/ldap/directories/:tenant", h.put)
+	rg.DELETE("/ldap/directories/:tenant", h.delete)
+}
+
+type loginRequest struct {
+	Tenant   string `json:"tenant"` // Signed in to only when its directory, or the global one, maps the user to it
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (h *Handler) login(c *gin.Context) {
+	var req loginRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid login request", err))
+		return
+	}
+
+	u, err := h.auth.Authenticate(c.Request.Context(), req.Tenant, req.Username, req.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	token, err := h.tokens.Issue(u)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"accessToken": token, "tokenType": "Bearer", "expiresIn": h.tokens.TTL().Seconds(), "user": u})
+}
+
+func (h *Handler) list(c *gin.Context) {
+	list, err := h.auth.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	// The service account password is write-only
+	for i := range list {
+		list[i].BindPassword = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Handler) put(c *gin.Context) {
+	var d Directory
+	if err := bind.JSON(c, &d); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid LDAP directory", err))
+		return
+	}
+	if d.URL == "" || d.BaseDN == "" {
+		c.Error(apperrors.NewValidationError("url and baseDN are required"))
+		return
+	}
+	d.Tenant = c.Param("tenant")
+	d.UpdatedAt = time.Now().UTC()
+
+	ctx := c.Request.Context()
+	// The password is blanked when listed, so saving a listed directory back keeps it
+	if d.BindPassword == "" {
+		existing, err := h.auth.store.Get(ctx, d.Tenant)
+		if err != nil && !errors.Is(err, errDirectoryNotFound) {
+			c.Error(err)
+			return
+		}
+		d.BindPassword = existing.BindPassword
+	}
+	if err := h.auth.store.Put(ctx, d); err != nil {
+		c.Error(err)
+		return
+	}
+	d.BindPassword = ""
+	c.JSON(http.StatusOK, d)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if err := h.auth.store.Delete(c.Request.Context(), c.Param("tenant")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
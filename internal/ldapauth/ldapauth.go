@@ -0,0 +1,231 @@
+package ldapauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"go-api/internal/users"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+var (
+	errInvalidCredentials = apperrors.NewUnauthorizedError("Invalid username or password")
+	errTenantNotMapped    = apperrors.NewForbiddenError("This directory does not sign users in to the tenant")
+)
+
+// Authenticator verifies credentials against the tenant's directory, or the global one
+// when the tenant has none, and provisions the user locally. The global directory
+// never takes the tenant from the request: users only get the tenants it maps
+// them to.
+type Authenticator struct {
+	global *Directory
+	store  Store
+	users  users.Store
+
+	mu    sync.Mutex
+	pools map[string]*pool
+}
+
+// NewAuthenticator creates an authenticator. global may be nil when only per-tenant
+// directories are used.
+func NewAuthenticator(global *Directory, store Store, userStore users.Store) *Authenticator {
+	if global != nil {
+		d := global.withDefaults()
+		global = &d
+	}
+	return &Authenticator{global: global, store: store, users: userStore, pools: make(map[string]*pool)}
+}
+
+// directory resolves the directory for a tenant and the key of its connection pool,
+// which is shared by every tenant using the global directory. The global directory
+// keeps its empty Tenant, and is only returned for tenants it maps users to.
+func (a *Authenticator) directory(ctx context.Context, tenant string) (Directory, string, error) {
+	if tenant != "" {
+		d, err := a.store.Get(ctx, tenant)
+		if err == nil {
+			return d.withDefaults(), "tenant:" + tenant, nil
+		}
+		if !errors.Is(err, errDirectoryNotFound) {
+			return Directory{}, "", err
+		}
+	}
+	if a.global == nil {
+		return Directory{}, "", errDirectoryNotFound
+	}
+	if tenant != "" && !a.global.mapsTenant(tenant) {
+		return Directory{}, "", errTenantNotMapped
+	}
+	return *a.global, "global", nil
+}
+
+// mapsTenant reports whether the directory may sign users in to tenant at all:
+// when a group maps to it, or entries name their tenants
+func (d Directory) mapsTenant(tenant string) bool {
+	if d.TenantAttribute != "" {
+		return true
+	}
+	for _, t := range d.GroupTenants {
+		if t == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantOf returns the tenant a user of the directory signs in to. Tenants' own
+// directories sign users in to theirs; the global one to the requested tenant
+// when the entry names it or one of its groups maps to it, and to none when no
+// tenant is requested.
+func (d Directory) tenantOf(entry *ldap.Entry, requested string) (string, error) {
+	if d.Tenant != "" || requested == "" {
+		return d.Tenant, nil
+	}
+	if d.TenantAttribute != "" && slices.Contains(entry.GetAttributeValues(d.TenantAttribute), requested) {
+		return requested, nil
+	}
+	for _, group := range entry.GetAttributeValues(d.GroupAttribute) {
+		for dn, t := range d.GroupTenants {
+			if t == requested && strings.EqualFold(dn, group) {
+				return requested, nil
+			}
+		}
+	}
+	return "", errTenantNotMapped
+}
+
+// pool returns the connection pool for a directory, replacing it when the directory
+// configuration changed
+func (a *Authenticator) pool(key string, d Directory) *pool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, ok := a.pools[key]
+	if ok && p.dir.UpdatedAt.Equal(d.UpdatedAt) {
+		return p
+	}
+	if ok {
+		p.close()
+	}
+	p = newPool(d)
+	a.pools[key] = p
+	return p
+}
+
+// Authenticate checks username and password and returns the provisioned local user
+func (a *Authenticator) Authenticate(ctx context.Context, tenant, username, password string) (users.User, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return users.User{}, errInvalidCredentials
+	}
+
+	d, key, err := a.directory(ctx, tenant)
+	if err != nil {
+		return users.User{}, err
+	}
+	p := a.pool(key, d)
+
+	conn, err := p.get()
+	if err != nil {
+		logger.Error("failed to connect to LDAP", zap.String("url", d.URL), zap.Error(err))
+		return users.User{}, apperrors.NewInternalServerError("Directory is unavailable")
+	}
+
+	entry, err := a.lookup(conn, d, username)
+	if err != nil {
+		p.put(conn, !isNetworkError(err))
+		return users.User{}, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		p.put(conn, !isNetworkError(err))
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return users.User{}, errInvalidCredentials
+		}
+		return users.User{}, err
+	}
+	p.put(conn, true)
+
+	userTenant, err := d.tenantOf(entry, tenant)
+	if err != nil {
+		return users.User{}, err
+	}
+	u := users.User{
+		Tenant:     userTenant,
+		Email:      entry.GetAttributeValue(d.EmailAttribute),
+		Name:       entry.GetAttributeValue(d.NameAttribute),
+		Roles:      mapRoles(d, entry.GetAttributeValues(d.GroupAttribute)),
+		Provider:   "ldap",
+		ExternalID: entry.DN,
+	}
+	if u.Tenant != "" {
+		u.Provider = "ldap:" + u.Tenant
+	}
+	if u.Email == "" {
+		u.Email = username
+	}
+	return users.Provision(ctx, a.users, u)
+}
+
+func (a *Authenticator) lookup(conn *ldap.Conn, d Directory, username string) (*ldap.Entry, error) {
+	escaped := ldap.EscapeFilter(username)
+	filter := strings.ReplaceAll(d.UserFilter, "%s", escaped)
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(d.Timeout.Seconds()), false,
+		filter, attributes(d), nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		// Unknown or ambiguous users get the same answer as a wrong password
+		return nil, errInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// attributes returns the attributes of entries the directory reads
+func attributes(d Directory) []string {
+	list := []string{d.EmailAttribute, d.NameAttribute, d.GroupAttribute}
+	if d.TenantAttribute != "" {
+		list = append(list, d.TenantAttribute)
+	}
+	return list
+}
+
+// mapRoles turns group memberships into roles, falling back to the default roles
+func mapRoles(d Directory, groups []string) []string {
+	var roles []string
+	for _, group := range groups {
+		for dn, mapped := range d.GroupRoles {
+			if strings.EqualFold(dn, group) {
+				roles = append(roles, mapped...)
+			}
+		}
+	}
+	if len(roles) == 0 {
+		return d.DefaultRoles
+	}
+	return roles
+}
+
+func isNetworkError(err error) bool {
+	return ldap.IsErrorWithCode(err, ldap.ErrorNetwork)
+}
+
+// Close releases pooled connections
+func (a *Authenticator) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, p := range a.pools {
+		p.close()
+	}
+}
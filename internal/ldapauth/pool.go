@@ -0,0 +1,94 @@
+package ldapauth
+
+import (
+	"crypto/tls"
+	"net/url"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// pool keeps up to size connections to one directory open between logins. Every
+// connection handed out is bound as the service account, because verifying a user's
+// password rebinds it as that user.
+type pool struct {
+	dir   Directory
+	conns chan *ldap.Conn
+}
+
+func newPool(dir Directory) *pool {
+	return &pool{dir: dir, conns: make(chan *ldap.Conn, dir.PoolSize)}
+}
+
+func (p *pool) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(p.dir.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: p.dir.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(p.dir.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.dir.Timeout)
+
+	if p.dir.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// get returns a pooled or new connection bound as the service account
+func (p *pool) get() (*ldap.Conn, error) {
+	var conn *ldap.Conn
+	select {
+	case conn = <-p.conns:
+		if conn.IsClosing() {
+			conn.Close()
+			conn = nil
+		}
+	default:
+	}
+
+	if conn == nil {
+		var err error
+		if conn, err = p.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.dir.BindDN != "" {
+		if err := conn.Bind(p.dir.BindDN, p.dir.BindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// put returns a connection to the pool, closing it if the pool is full or broken
+func (p *pool) put(conn *ldap.Conn, healthy bool) {
+	if !healthy || conn.IsClosing() {
+		conn.Close()
+		return
+	}
+	select {
+	case p.conns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (p *pool) close() {
+	for {
+		select {
+		case conn := <-p.conns:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
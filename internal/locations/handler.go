@@ -0,0 +1,199 @@
+package locations
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/subresource"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/geo"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NearbyList is the resources found near a point, nearest first
+type NearbyList struct {
+	Data []Nearby `json:"data"`
+}
+
+// Routes mounts the search of resources by distance, and the location endpoints
+// under each parent taking locations
+func (m *locationsModule) Routes(api *apiversion.Group) {
+	api.GET("/nearby/:type", apiversion.Operation{
+		ID:      "findNearby",
+		Summary: "Find resources near a point",
+		Description: "Lists the resources of a type whose location is within ?radius= meters of ?near=lat,lng, nearest first, " +
+			"with their distance in meters. ?radius= is " + meters(m.cfg.Radius) + " by default and at most " + meters(m.cfg.MaxRadius) +
+			". Only the nearest ?limit= are listed, and of those only the resources the caller may read, so the list may hold fewer.",
+		Tags:     []string{"locations"},
+		Response: NearbyList{},
+	}, m.nearby)
+	for _, p := range m.ordered {
+		m.parentRoutes(api, p)
+	}
+}
+
+func (m *locationsModule) parentRoutes(api *apiversion.Group, p subresource.Parent) {
+	tags := []string{"locations"}
+	path := strings.TrimSuffix(p.Path, "/") + "/:id/location"
+	api.GET(path, apiversion.Operation{
+		ID:       "get" + p.Title() + "Location",
+		Summary:  "Get the location of a " + p.Type,
+		Tags:     tags,
+		Response: Location{},
+	}, m.get(p))
+	api.PUT(path, apiversion.Operation{
+		ID:          "set" + p.Title() + "Location",
+		Summary:     "Place a " + p.Type + " on the map",
+		Description: "Sets its location to a GeoJSON Point, and the area it covers to a GeoJSON Polygon if given, replacing both.",
+		Tags:        tags,
+		Idempotency: retrysafe.Idempotent,
+		Request:     setRequest{},
+		Response:    Location{},
+	}, m.set(p))
+	api.DELETE(path, apiversion.Operation{
+		ID:      "delete" + p.Title() + "Location",
+		Summary: "Remove the location of a " + p.Type,
+		Tags:    tags,
+	}, m.delete(p))
+}
+
+// meters writes a distance for the descriptions, like 1000m
+func meters(d float64) string {
+	return strconv.FormatFloat(d, 'f', -1, 64) + "m"
+}
+
+type setRequest struct {
+	Point *geo.Point  `json:"point" binding:"required"`
+	Area  geo.Polygon `json:"area"`
+}
+
+type nearbyQuery struct {
+	Near   string  `form:"near" binding:"required"`
+	Radius float64 `form:"radius" binding:"gt=0"`
+	Limit  int     `form:"limit" binding:"min=1,max=200"`
+}
+
+// nearby lists the resources of the type nearest a point, dropping those the
+// caller may not read
+func (m *locationsModule) nearby(c *gin.Context) {
+	ctx := c.Request.Context()
+	sub, ok := authz.SubjectFromContext(ctx)
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return
+	}
+	p, ok := m.parents[c.Param("type")]
+	if !ok {
+		c.Error(apperrors.NewNotFoundError("Resources of this type have no location"))
+		return
+	}
+	query := nearbyQuery{Radius: m.cfg.Radius, Limit: subresource.DefaultLimit}
+	if err := bind.Query(c, &query); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid query", err))
+		return
+	}
+	center, err := geo.ParsePoint(query.Near)
+	if err != nil {
+		c.Error(apperrors.NewValidationError("Invalid query", apperrors.FieldError{
+			Field: "near", Rule: "latlng", Message: "near must be a latitude and longitude, like 52.37,4.89",
+		}))
+		return
+	}
+	if query.Radius > m.cfg.MaxRadius {
+		c.Error(apperrors.NewValidationError("Invalid query", apperrors.FieldError{
+			Field: "radius", Rule: "max", Param: strconv.FormatFloat(m.cfg.MaxRadius, 'f', -1, 64),
+			Message: "radius must be at most " + meters(m.cfg.MaxRadius),
+		}))
+		return
+	}
+	list, err := m.store.Near(ctx, sub.Tenant, p.Type, center, query.Radius, query.Limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	readable := list[:0]
+	for _, n := range list {
+		if _, err := p.Authorize(ctx, n.ResourceID, "read"); err != nil {
+			if status := apperrors.From(err).StatusCode; status != http.StatusNotFound && status != http.StatusForbidden {
+				c.Error(err)
+				return
+			}
+			continue
+		}
+		readable = append(readable, n)
+	}
+	c.JSON(http.StatusOK, NearbyList{Data: readable})
+}
+
+func (m *locationsModule) get(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		l, err := m.store.Get(ctx, r.Tenant, r.Type, r.ID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, l)
+	}
+}
+
+func (m *locationsModule) set(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		sub, ok := authz.SubjectFromContext(ctx)
+		if !ok || sub.ID == "" {
+			c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+			return
+		}
+		r, err := p.Authorize(ctx, c.Param("id"), "update")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		var req setRequest
+		if err := bind.JSON(c, &req); err != nil {
+			c.Error(apperrors.NewValidationErrorFrom("Invalid location", err))
+			return
+		}
+		l := Location{ResourceType: r.Type, ResourceID: r.ID, Tenant: r.Tenant, Point: *req.Point, Area: req.Area,
+			UpdatedBy: sub.ID, UpdatedAt: time.Now().UTC()}
+		if err := m.store.Set(ctx, l); err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, l)
+	}
+}
+
+func (m *locationsModule) delete(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "update")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		removed, err := m.store.Delete(ctx, r.Tenant, r.Type, r.ID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if !removed {
+			c.Error(apperrors.NewNotFoundError("This " + p.Type + " has no location"))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,105 @@
+// Package locations is the feature module placing the resources of other modules
+// on the map. Any resource opted in as a subresource parent gets a location, a
+// point and optionally the area it covers, through routes like
+// /documents/:id/location, and resources are found by how near they are with
+// ?near=lat,lng&radius=, nearest first. With the sql store on Postgres, PostGIS
+// can do the search with a GiST index on a geography column; otherwise the
+// search narrows the locations down to a box of latitudes and longitudes and
+// measures the rest.
+package locations
+
+import (
+	"fmt"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/subresource"
+	"go-api/pkg/database"
+	"go-api/pkg/geo"
+)
+
+// Config holds location configuration
+type Config struct {
+	Resources []string `yaml:"resources"` // Types of the parents taking locations; every declared parent when empty
+	Radius    float64  `yaml:"radius"`    // Meters searched without ?radius=
+	MaxRadius float64  `yaml:"maxRadius"` // Meters ?radius= is at most
+	// PostGIS searches with the postgis extension, which the migrations create,
+	// and needs the sql store on Postgres
+	PostGIS bool   `yaml:"postgis"`
+	Store   string `yaml:"store"` // memory or sql; the database by default
+}
+
+// Location is where a resource is
+type Location struct {
+	ResourceType string      `json:"resourceType"`
+	ResourceID   string      `json:"resourceId"`
+	Tenant       string      `json:"tenant,omitempty"`
+	Point        geo.Point   `json:"point"`          // GeoJSON Point
+	Area         geo.Polygon `json:"area,omitempty"` // GeoJSON Polygon the resource covers, like a delivery zone
+	UpdatedBy    string      `json:"updatedBy"`
+	UpdatedAt    time.Time   `json:"updatedAt"`
+}
+
+// Nearby is a location found by a search, with its distance from where it was
+// searched
+type Nearby struct {
+	Location
+	Distance float64 `json:"distance"` // Meters
+}
+
+type locationsModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	parents map[string]subresource.Parent // By type
+	ordered []subresource.Parent
+}
+
+// New returns the factory of the locations module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if cfg.MaxRadius <= 0 {
+			cfg.MaxRadius = 50_000
+		}
+		if cfg.Radius <= 0 || cfg.Radius > cfg.MaxRadius {
+			cfg.Radius = min(1000, cfg.MaxRadius)
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("locations: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			if cfg.PostGIS && database.Dialect(deps.DB) != database.Postgres {
+				return nil, fmt.Errorf("locations: PostGIS needs a %s database", database.Postgres)
+			}
+			store = NewSQLStore(deps.DB, cfg.PostGIS)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("locations: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &locationsModule{cfg: cfg, backend: backend, store: store}, nil
+	}
+}
+
+func (m *locationsModule) Name() string { return "locations" }
+
+func (m *locationsModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	if m.cfg.PostGIS {
+		return append(migrations[:len(migrations):len(migrations)], postgisMigration)
+	}
+	return migrations
+}
+
+// Attach keeps the parents configured to take locations
+func (m *locationsModule) Attach(parents []subresource.Parent) {
+	m.ordered = subresource.Select(parents, m.cfg.Resources)
+	m.parents = make(map[string]subresource.Parent, len(m.ordered))
+	for _, p := range m.ordered {
+		m.parents[p.Type] = p
+	}
+}
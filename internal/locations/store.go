@@ -0,0 +1,253 @@
+package locations
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/geo"
+)
+
+// Store persists the locations of resources
+type Store interface {
+	// Set places a resource, replacing its location
+	Set(ctx context.Context, l Location) error
+	Get(ctx context.Context, tenant, resourceType, id string) (Location, error)
+	// Delete removes the location of a resource, reporting whether it had one
+	Delete(ctx context.Context, tenant, resourceType, id string) (bool, error)
+	// Near returns at most limit locations of the resources of a type within
+	// radius meters of center, nearest first, then by ID
+	Near(ctx context.Context, tenant, resourceType string, center geo.Point, radius float64, limit int) ([]Nearby, error)
+}
+
+var errLocationNotFound = apperrors.NewNotFoundError("Location not found")
+
+// key is a located resource of a tenant
+type key struct {
+	tenant, resourceType, id string
+}
+
+// MemoryStore keeps locations in memory, used when no database is configured
+type MemoryStore struct {
+	mu        sync.RWMutex
+	locations map[key]Location
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{locations: make(map[key]Location)}
+}
+
+func (s *MemoryStore) Set(ctx context.Context, l Location) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locations[key{l.Tenant, l.ResourceType, l.ResourceID}] = l
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, tenant, resourceType, id string) (Location, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.locations[key{tenant, resourceType, id}]
+	if !ok {
+		return Location{}, errLocationNotFound
+	}
+	return l, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, tenant, resourceType, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key{tenant, resourceType, id}
+	_, ok := s.locations[k]
+	delete(s.locations, k)
+	return ok, nil
+}
+
+func (s *MemoryStore) Near(ctx context.Context, tenant, resourceType string, center geo.Point, radius float64, limit int) ([]Nearby, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Nearby
+	for k, l := range s.locations {
+		if k.tenant != tenant || k.resourceType != resourceType {
+			continue
+		}
+		if d := geo.Distance(center, l.Point); d <= radius {
+			list = append(list, Nearby{Location: l, Distance: d})
+		}
+	}
+	return nearest(list, limit), nil
+}
+
+// nearest sorts locations by distance, then ID, and keeps the first limit
+func nearest(list []Nearby, limit int) []Nearby {
+	slices.SortFunc(list, func(a, b Nearby) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.ResourceID, b.ResourceID))
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	if list == nil {
+		list = []Nearby{}
+	}
+	return list
+}
+
+// migrations create the locations table, its points as latitude and longitude
+// columns that an index on both narrows searches down with
+var migrations = []module.Migration{{
+	Name: "create_locations",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS locations (
+			tenant        TEXT NOT NULL,
+			resource_type TEXT NOT NULL,
+			resource_id   TEXT NOT NULL,
+			lat           DOUBLE PRECISION NOT NULL,
+			lng           DOUBLE PRECISION NOT NULL,
+			area          TEXT,
+			updated_by    TEXT NOT NULL,
+			updated_at    TIMESTAMP NOT NULL,
+			PRIMARY KEY (tenant, resource_type, resource_id)
+		);
+		CREATE INDEX IF NOT EXISTS locations_lat_lng_idx ON locations (tenant, resource_type, lat, lng)`,
+}}
+
+// postgisMigration adds the points as a geography column, indexed with GiST for
+// ST_DWithin, to locations placed before it too
+var postgisMigration = module.Migration{
+	Name: "add_locations_geography",
+	SQL: `
+		CREATE EXTENSION IF NOT EXISTS postgis;
+		ALTER TABLE locations ADD COLUMN IF NOT EXISTS point geography(Point, 4326);
+		UPDATE locations SET point = ST_SetSRID(ST_MakePoint(lng, lat), 4326)::geography WHERE point IS NULL;
+		CREATE INDEX IF NOT EXISTS locations_point_idx ON locations USING GIST (point)`,
+}
+
+// SQLStore persists locations in the locations table
+type SQLStore struct {
+	db      *sql.DB
+	postgis bool // Whether the table has the geography column of postgisMigration
+}
+
+// NewSQLStore creates a store backed by db, searching with PostGIS when postgis
+// is set
+func NewSQLStore(db *sql.DB, postgis bool) *SQLStore {
+	return &SQLStore{db: db, postgis: postgis}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Set(ctx context.Context, l Location) error {
+	args := []any{l.Tenant, l.ResourceType, l.ResourceID, l.Point.Lat, l.Point.Lng, l.Area, l.UpdatedBy, l.UpdatedAt}
+	if !s.postgis {
+		_, err := s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO locations (tenant, resource_type, resource_id, lat, lng, area, updated_by, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (tenant, resource_type, resource_id) DO UPDATE SET
+				lat = excluded.lat, lng = excluded.lng, area = excluded.area,
+				updated_by = excluded.updated_by, updated_at = excluded.updated_at`, args...)
+		return err
+	}
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO locations (tenant, resource_type, resource_id, lat, lng, area, updated_by, updated_at, point)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::geography)
+		ON CONFLICT (tenant, resource_type, resource_id) DO UPDATE SET
+			lat = excluded.lat, lng = excluded.lng, area = excluded.area,
+			updated_by = excluded.updated_by, updated_at = excluded.updated_at, point = excluded.point`,
+		append(args, l.Point)...)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, tenant, resourceType, id string) (Location, error) {
+	l := Location{Tenant: tenant, ResourceType: resourceType, ResourceID: id}
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT lat, lng, area, updated_by, updated_at FROM locations
+		WHERE tenant = $1 AND resource_type = $2 AND resource_id = $3`,
+		tenant, resourceType, id).Scan(&l.Point.Lat, &l.Point.Lng, &l.Area, &l.UpdatedBy, &l.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Location{}, errLocationNotFound
+	}
+	return l, err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, tenant, resourceType, id string) (bool, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		DELETE FROM locations WHERE tenant = $1 AND resource_type = $2 AND resource_id = $3`,
+		tenant, resourceType, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Near searches with ST_DWithin and orders by ST_Distance with PostGIS, which
+// measure on the spheroid rather than a sphere. Without it, the box around the
+// circle is selected with the index on latitude and longitude, and the
+// locations in its corners are dropped once measured.
+func (s *SQLStore) Near(ctx context.Context, tenant, resourceType string, center geo.Point, radius float64, limit int) ([]Nearby, error) {
+	if s.postgis {
+		rows, err := s.conn(ctx).QueryContext(ctx, `
+			SELECT resource_id, lat, lng, area, updated_by, updated_at, ST_Distance(point, $3::geography) AS distance
+			FROM locations
+			WHERE tenant = $1 AND resource_type = $2 AND ST_DWithin(point, $3::geography, $4)
+			ORDER BY distance, resource_id
+			LIMIT $5`, tenant, resourceType, center, radius, limit)
+		if err != nil {
+			return nil, err
+		}
+		list, err := scanNearby(rows, tenant, resourceType, true)
+		if err != nil {
+			return nil, err
+		}
+		return nearest(list, limit), nil
+	}
+
+	box := geo.Around(center, radius)
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT resource_id, lat, lng, area, updated_by, updated_at FROM locations
+		WHERE tenant = $1 AND resource_type = $2 AND lat BETWEEN $3 AND $4 AND lng BETWEEN $5 AND $6`,
+		tenant, resourceType, box.MinLat, box.MaxLat, box.MinLng, box.MaxLng)
+	if err != nil {
+		return nil, err
+	}
+	list, err := scanNearby(rows, tenant, resourceType, false)
+	if err != nil {
+		return nil, err
+	}
+	within := list[:0]
+	for _, n := range list {
+		if n.Distance = geo.Distance(center, n.Point); n.Distance <= radius {
+			within = append(within, n)
+		}
+	}
+	return nearest(within, limit), nil
+}
+
+// scanNearby reads the locations of a search, followed by their distance when
+// withDistance is set
+func scanNearby(rows *sql.Rows, tenant, resourceType string, withDistance bool) ([]Nearby, error) {
+	defer rows.Close()
+	var list []Nearby
+	for rows.Next() {
+		n := Nearby{Location: Location{Tenant: tenant, ResourceType: resourceType}}
+		dest := []any{&n.ResourceID, &n.Point.Lat, &n.Point.Lng, &n.Area, &n.UpdatedBy, &n.UpdatedAt}
+		if withDistance {
+			dest = append(dest, &n.Distance)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/internal/config"
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// botHistory is how many recent request times are kept per client
+const botHistory = 32
+
+// agentSignals score user agents by substrings of their lowercased form. The first
+// matching group applies.
+var agentSignals = []struct {
+	name   string
+	score  int
+	tokens []string
+}{
+	{"scanner", 90, []string{"sqlmap", "nikto", "nmap", "masscan", "zgrab", "nuclei", "dirbuster", "gobuster", "wpscan"}},
+	{"headless-browser", 50, []string{"headlesschrome", "phantomjs", "selenium", "puppeteer", "playwright", "slimerjs"}},
+	{"http-library", 25, []string{"curl/", "wget/", "python-requests", "python-urllib", "aiohttp", "httpx", "go-http-client",
+		"java/", "libwww-perl", "scrapy", "apache-httpclient", "node-fetch", "axios/", "guzzlehttp"}},
+	{"crawler", 20, []string{"bot", "crawler", "spider", "scraper"}},
+}
+
+// BotDetector scores anonymous requests for signs of automation and slows down,
+// challenges or blocks the likely bots. Signed-in users are never scored.
+type BotDetector struct {
+	cfg     config.BotConfig
+	captcha *Captcha
+
+	mu      sync.Mutex
+	clients map[string]*botClient
+	swept   time.Time
+}
+
+type botClient struct {
+	times [botHistory]time.Time // Ring of the latest request times
+	next  int
+	last  time.Time
+}
+
+// NewBotDetector creates a bot detector. Challenges ask for a CAPTCHA solved with
+// captcha's provider; without one, challenged requests are tarpitted instead.
+func NewBotDetector(cfg config.BotConfig, captcha *Captcha) *BotDetector {
+	return &BotDetector{cfg: cfg, captcha: captcha, clients: make(map[string]*botClient)}
+}
+
+// Middleware scores requests and acts on the configured thresholds
+func (d *BotDetector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !d.cfg.Enabled || hasAnyPrefix(c.Request.URL.Path, d.cfg.ExcludePaths) || d.allowed(c.Request.UserAgent()) {
+			c.Next()
+			return
+		}
+		if sub, ok := authz.SubjectFromContext(c.Request.Context()); ok && sub.ID != "" {
+			c.Next()
+			return
+		}
+
+		score, signals := d.score(c.Request, c.ClientIP())
+		action := d.action(score)
+		if score >= d.cfg.LogScore && score > 0 {
+			logger.Info("bot score",
+				zap.Int("score", score),
+				zap.Strings("signals", signals),
+				zap.String("action", action),
+				zap.String("ip", c.ClientIP()),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("userAgent", c.Request.UserAgent()),
+			)
+		}
+
+		switch action {
+		case "block":
+			AbortWithError(c, apperrors.NewForbiddenError("Request blocked"))
+			return
+		case "challenge":
+			if d.captcha != nil {
+				if err := d.captcha.check(c); err != nil {
+					AbortWithError(c, err)
+					return
+				}
+				break
+			}
+			d.tarpit(c)
+		case "tarpit":
+			d.tarpit(c)
+		}
+		c.Next()
+	}
+}
+
+func (d *BotDetector) allowed(agent string) bool {
+	for _, s := range d.cfg.AllowedAgents {
+		if s != "" && strings.Contains(agent, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// action returns the strongest action the score reaches, ignoring thresholds of 0
+func (d *BotDetector) action(score int) string {
+	switch {
+	case d.cfg.BlockScore > 0 && score >= d.cfg.BlockScore:
+		return "block"
+	case d.cfg.ChallengeScore > 0 && score >= d.cfg.ChallengeScore:
+		return "challenge"
+	case d.cfg.TarpitScore > 0 && score >= d.cfg.TarpitScore:
+		return "tarpit"
+	}
+	return "allow"
+}
+
+// tarpit holds the request, making scraping slow without telling the client why
+func (d *BotDetector) tarpit(c *gin.Context) {
+	timer := time.NewTimer(d.cfg.TarpitDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+}
+
+// score adds up the signals of a request, capped at 100
+func (d *BotDetector) score(r *http.Request, ip string) (int, []string) {
+	var score int
+	var signals []string
+	add := func(name string, points int) {
+		score += points
+		signals = append(signals, name)
+	}
+
+	agent := strings.ToLower(r.UserAgent())
+	switch {
+	case agent == "":
+		add("no-user-agent", 40)
+	case len(agent) < 20:
+		add("short-user-agent", 10)
+	}
+	for _, group := range agentSignals {
+		if containsAny(agent, group.tokens) {
+			add(group.name, group.score)
+			break
+		}
+	}
+
+	// Browsers always send these; clients pretending to be one often don't
+	if strings.HasPrefix(agent, "mozilla/") {
+		if r.Header.Get("Accept-Language") == "" {
+			add("browser-without-accept-language", 20)
+		}
+		if r.Header.Get("Accept-Encoding") == "" {
+			add("browser-without-accept-encoding", 15)
+		}
+		if r.Header.Get("Accept") == "" {
+			add("browser-without-accept", 10)
+		}
+		if r.ProtoMajor == 1 && r.ProtoMinor == 0 {
+			add("browser-on-http-1.0", 15)
+		}
+	}
+
+	count, regular := d.record(ip, time.Now())
+	switch {
+	case d.cfg.RateLimit > 0 && count > 2*d.cfg.RateLimit:
+		add("very-high-rate", 50)
+	case d.cfg.RateLimit > 0 && count > d.cfg.RateLimit:
+		add("high-rate", 30)
+	}
+	if regular {
+		add("regular-interval", 20)
+	}
+	return min(score, 100), signals
+}
+
+// record notes a request of a client, returning how many it made in the rate window
+// and whether its latest requests came at machine-like regular intervals
+func (d *BotDetector) record(ip string, now time.Time) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(now)
+	client, ok := d.clients[ip]
+	if !ok {
+		client = &botClient{}
+		d.clients[ip] = client
+	}
+	client.times[client.next] = now
+	client.next = (client.next + 1) % botHistory
+	client.last = now
+
+	// The ring only holds botHistory requests; beyond that the rate is at least that
+	count := 0
+	for _, t := range client.times {
+		if !t.IsZero() && now.Sub(t) <= d.cfg.RateWindow {
+			count++
+		}
+	}
+	return count, client.regular()
+}
+
+// regular reports whether the last ten intervals between requests hardly vary, as
+// with scripts looping on a fixed sleep
+func (b *botClient) regular() bool {
+	const n = 10
+	var intervals []float64
+	prev := b.times[(b.next-n-1+2*botHistory)%botHistory]
+	for i := n; i > 0; i-- {
+		t := b.times[(b.next-i+botHistory)%botHistory]
+		if prev.IsZero() || t.IsZero() {
+			return false
+		}
+		intervals = append(intervals, float64(t.Sub(prev)))
+		prev = t
+	}
+
+	var mean float64
+	for _, v := range intervals {
+		mean += v / n
+	}
+	if mean < float64(100*time.Millisecond) {
+		// Bursts are the rate signal's business; regular ones are usually parallel fetches
+		return false
+	}
+	var variance float64
+	for _, v := range intervals {
+		variance += (v - mean) * (v - mean) / n
+	}
+	return math.Sqrt(variance)/mean < 0.05
+}
+
+// sweep drops clients idle for longer than the window, at most once per window
+func (d *BotDetector) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.cfg.RateWindow {
+		return
+	}
+	for ip, client := range d.clients {
+		if now.Sub(client.last) > d.cfg.RateWindow {
+			delete(d.clients, ip)
+		}
+	}
+	d.swept = now
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
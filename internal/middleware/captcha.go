@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-api/internal/config"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CaptchaTokenHeader carries the token a CAPTCHA widget produced
+const CaptchaTokenHeader = "X-Captcha-Token"
+
+// CaptchaBypassHeader carries the configured bypass key of automated tests
+const CaptchaBypassHeader = "X-Captcha-Bypass"
+
+// captchaProvider is a CAPTCHA service's verification endpoint and the form field
+// its widget submits the token in
+type captchaProvider struct {
+	verifyURL string
+	formField string
+}
+
+var captchaProviders = map[string]captchaProvider{
+	"recaptcha": {"https://www.google.com/recaptcha/api/siteverify", "g-recaptcha-response"},
+	"hcaptcha":  {"https://api.hcaptcha.com/siteverify", "h-captcha-response"},
+	"turnstile": {"https://challenges.cloudflare.com/turnstile/v0/siteverify", "cf-turnstile-response"},
+}
+
+// captchaResult is the response of the providers' siteverify endpoints, which share
+// reCAPTCHA's format
+type captchaResult struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"` // reCAPTCHA v3 only
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Captcha requires a solved CAPTCHA on POST requests to the configured paths
+type Captcha struct {
+	cfg      config.CaptchaConfig
+	provider captchaProvider
+	client   *http.Client
+}
+
+// NewCaptcha creates CAPTCHA verification for cfg's provider. It returns nil when no
+// provider is configured, which leaves requests unverified.
+func NewCaptcha(cfg config.CaptchaConfig) (*Captcha, error) {
+	if cfg.Provider == "" {
+		return nil, nil
+	}
+	provider, ok := captchaProviders[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown CAPTCHA provider %q, want recaptcha, hcaptcha or turnstile", cfg.Provider)
+	}
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf("CAPTCHA provider %s needs a secret", cfg.Provider)
+	}
+	return &Captcha{cfg: cfg, provider: provider, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// Middleware rejects requests without a valid token with 403. The token is read from
+// the X-Captcha-Token header, or from the provider's form field for HTML forms.
+func (v *Captcha) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || !hasAnyPrefix(c.Request.URL.Path, v.cfg.Paths) {
+			c.Next()
+			return
+		}
+		if err := v.check(c); err != nil {
+			AbortWithError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// check returns nil for requests with the bypass key or a valid token
+func (v *Captcha) check(c *gin.Context) error {
+	if key := c.GetHeader(CaptchaBypassHeader); v.cfg.BypassKey != "" && key != "" &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(v.cfg.BypassKey)) == 1 {
+		return nil
+	}
+
+	token := c.GetHeader(CaptchaTokenHeader)
+	if token == "" && strings.HasPrefix(c.ContentType(), "application/x-www-form-urlencoded") {
+		token = c.PostForm(v.provider.formField)
+	}
+	if token == "" {
+		return apperrors.NewForbiddenError("CAPTCHA required")
+	}
+
+	result, err := v.verify(c.Request.Context(), token, c.ClientIP())
+	if err != nil {
+		logger.Error("CAPTCHA verification failed", zap.String("provider", v.cfg.Provider), zap.Error(err))
+		appErr := apperrors.Wrap(err, apperrors.CodeInternal)
+		appErr.Message = "CAPTCHA verification is unavailable, please retry later"
+		return appErr
+	}
+	if !result.Success || (v.cfg.Provider == "recaptcha" && result.Score != nil && *result.Score < v.cfg.MinScore) {
+		logger.Info("CAPTCHA rejected", zap.String("provider", v.cfg.Provider), zap.Strings("errors", result.ErrorCodes),
+			zap.Float64p("score", result.Score), zap.String("path", c.Request.URL.Path))
+		return apperrors.NewForbiddenError("CAPTCHA verification failed")
+	}
+	return nil
+}
+
+func (v *Captcha) verify(ctx context.Context, token, remoteIP string) (captchaResult, error) {
+	form := url.Values{"secret": {v.cfg.Secret}, "response": {token}, "remoteip": {remoteIP}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.provider.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return captchaResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return captchaResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return captchaResult{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var result captchaResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return captchaResult{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/config"
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeadlineHeader is the default header clients state how long they wait for a
+// response in
+const DeadlineHeader = "X-Request-Timeout"
+
+// RequestDeadline lets trusted clients shorten the deadline of their request
+// context to the timeout they state, like 2s, 1500ms or a number of seconds, so
+// work stops once they have given up. The timeout only ever tightens the deadline:
+// an earlier one, like a route policy timeout, still applies. Clients are trusted
+// once authenticated, with one of the configured roles if any; the header of other
+// requests is ignored. It has to run after the authentication middleware.
+func RequestDeadline(cfg config.DeadlineConfig) gin.HandlerFunc {
+	if cfg.Header == "" {
+		cfg.Header = DeadlineHeader
+	}
+	return func(c *gin.Context) {
+		value := c.GetHeader(cfg.Header)
+		if !cfg.Enabled || value == "" || !deadlineTrusted(c, cfg.Roles) {
+			c.Next()
+			return
+		}
+		d, ok := parseTimeout(value)
+		if !ok {
+			AbortWithError(c, apperrors.NewValidationError("Invalid request timeout", apperrors.FieldError{
+				Field: cfg.Header, Rule: "duration", Message: cfg.Header + " must be a positive duration like 2s or a number of seconds",
+			}))
+			return
+		}
+		withTimeout(c, max(d, cfg.Min), func(c *gin.Context) { c.Next() })
+	}
+}
+
+func deadlineTrusted(c *gin.Context, roles []string) bool {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		return false
+	}
+	return len(roles) == 0 || slices.ContainsFunc(sub.Roles, func(role string) bool { return slices.Contains(roles, role) })
+}
+
+// parseTimeout reads a duration, or a number of seconds without a unit
+func parseTimeout(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil || seconds > math.MaxInt64/float64(time.Second) {
+			return 0, false
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	return d, d > 0
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+
+	"go-api/internal/config"
+	"go-api/pkg/authz"
+	"go-api/pkg/cache"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DeduplicatedHeader marks responses replayed for a duplicate request
+const DeduplicatedHeader = "X-Deduplicated"
+
+type dedupEntry struct {
+	Pending bool        `json:"pending,omitempty"`
+	Status  int         `json:"status,omitempty"`
+	Header  http.Header `json:"header,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// Deduplicator short-circuits identical requests from the same client within a
+// window, answering retries with the first response. Unlike idempotency keys it needs
+// no client cooperation: requests are matched on a hash of client, method, path and
+// body. Requests carrying an Idempotency-Key are left alone. It is off unless
+// enabled, as clients may mean to send the same request twice.
+type Deduplicator struct {
+	cfg   config.DedupConfig
+	cache cache.Cache
+}
+
+// NewDeduplicator creates a deduplicator storing responses in c
+func NewDeduplicator(cfg config.DedupConfig, c cache.Cache) *Deduplicator {
+	return &Deduplicator{cfg: cfg, cache: c}
+}
+
+// Middleware deduplicates requests with the configured methods
+func (d *Deduplicator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !d.cfg.Enabled || !slices.Contains(d.cfg.Methods, c.Request.Method) ||
+			c.GetHeader("Idempotency-Key") != "" || hasAnyPrefix(c.Request.URL.Path, d.cfg.ExcludePaths) {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, d.cfg.MaxBodyBytes+1))
+		if err != nil {
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		if int64(len(body)) > d.cfg.MaxBodyBytes {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key := d.key(c, body)
+
+		existing, claimed := d.claim(c, key)
+		if !claimed {
+			if existing.Pending {
+				c.Header(DeduplicatedHeader, "true")
+				AbortWithError(c, apperrors.NewConflictError("An identical request is already being processed"))
+				return
+			}
+			// Headers set earlier in the chain, like the request ID, belong to this request
+			for name, values := range existing.Header {
+				if _, ok := c.Writer.Header()[name]; !ok {
+					c.Writer.Header()[name] = values
+				}
+			}
+			c.Header(DeduplicatedHeader, "true")
+			c.Data(existing.Status, existing.Header.Get("Content-Type"), existing.Body)
+			c.Abort()
+			return
+		}
+
+		// The client may be gone, but the outcome should still be stored or released
+		stored := false
+		defer func() {
+			// Also on panics, which the recovery middleware answers with a server error
+			if !stored {
+				if err := d.cache.Delete(context.WithoutCancel(ctx), key); err != nil {
+					logger.Warn("failed to release deduplication key", zap.Error(err))
+				}
+			}
+		}()
+
+		writer := &dedupWriter{ResponseWriter: c.Writer, max: d.cfg.MaxResponseBytes}
+		c.Writer = writer
+		c.Next()
+
+		// Server errors and abandoned requests are worth retrying, so only other
+		// responses are replayed, unless too large to keep. Errors left in c.Errors
+		// are only rendered by ErrorHandler once this returns, so nothing has been
+		// written for them yet, and they are released too.
+		if len(c.Errors) > 0 || !writer.Written() || writer.Status() >= http.StatusInternalServerError ||
+			apperrors.ClientDisconnected(c.Request.Context()) || writer.overflow {
+			return
+		}
+		raw, err := json.Marshal(dedupEntry{Status: writer.Status(), Header: writer.Header().Clone(), Body: writer.body.Bytes()})
+		if err == nil {
+			err = d.cache.Set(context.WithoutCancel(ctx), key, raw, d.cfg.Window)
+		}
+		if err != nil {
+			logger.Warn("failed to store deduplicated response", zap.Error(err))
+			return
+		}
+		stored = true
+	}
+}
+
+// claim marks key as in progress unless a request already holds it, in which case
+// that request's entry is returned. The claim is atomic between instances when the
+// cache is a cache.Adder.
+func (d *Deduplicator) claim(c *gin.Context, key string) (dedupEntry, bool) {
+	ctx := c.Request.Context()
+	pending, _ := json.Marshal(dedupEntry{Pending: true})
+	// The entry may expire between a failed claim and reading it, then it's claimed again
+	for range 2 {
+		added, err := cache.Add(ctx, d.cache, key, pending, d.cfg.Window)
+		if err != nil {
+			logger.Warn("failed to claim deduplication key", zap.Error(err))
+			return dedupEntry{}, true
+		}
+		if added {
+			return dedupEntry{}, true
+		}
+		if raw, ok, err := d.cache.Get(ctx, key); err == nil && ok {
+			var e dedupEntry
+			if json.Unmarshal(raw, &e) == nil {
+				return e, false
+			}
+		}
+	}
+	return dedupEntry{Pending: true}, false
+}
+
+// key identifies the client by subject, credentials or IP, so identical bodies
+// from different clients are never confused
+func (d *Deduplicator) key(c *gin.Context, body []byte) string {
+	client := "ip:" + c.ClientIP()
+	if sub, ok := authz.SubjectFromContext(c.Request.Context()); ok {
+		client = "sub:" + sub.ID
+	} else if auth := c.GetHeader("Authorization"); auth != "" {
+		client = "auth:" + auth
+	} else if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		client = "key:" + apiKey
+	}
+
+	h := sha256.New()
+	for _, part := range []string{client, c.Request.Method, c.Request.URL.RequestURI()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return "dedup:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupWriter keeps a copy of the body written, up to max bytes
+type dedupWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	max      int64
+	overflow bool // The body is larger than max, and not kept
+}
+
+func (w *dedupWriter) keep(n int) bool {
+	if !w.overflow && w.max > 0 && int64(w.body.Len()+n) > w.max {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+	}
+	return !w.overflow
+}
+
+func (w *dedupWriter) Write(b []byte) (int, error) {
+	if w.keep(len(b)) {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *dedupWriter) WriteString(s string) (int, error) {
+	if w.keep(len(s)) {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
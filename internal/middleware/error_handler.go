@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ErrorHandler renders the last error attached to the context with c.Error.
+// AppErrors are rendered with their own status code, errors registered with
+// apperrors.Register with their mapped code, and anything else becomes a 500.
+// Panics in later handlers are recovered and rendered as a 500 too. Every rendered
+// error is fingerprinted under FingerprintKey so identical faults group together in
+// logs and on the admin dashboard; server errors are logged with the fingerprint.
+// Validation messages are translated to the request's Accept-Language where the
+// failed rules have registered translations.
+// Nothing is rendered for a client that disconnected, whose request is recorded with
+// StatusClientClosedRequest instead.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+			appErr := apperrors.NewInternalServerError("Internal server error")
+			fp := fingerprint(appErr.Code, r, panicFrames())
+			stack := string(debug.Stack())
+			c.Set(FingerprintKey, fp)
+			c.Set(StackKey, stack)
+			c.Error(fmt.Errorf("panic: %v", r))
+			logger.Error("panic recovered",
+				zap.String("fingerprint", fp),
+				zap.Any("panic", r),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("request-id", c.GetString("requestId")),
+				zap.String("stack", stack),
+			)
+			if !c.Writer.Written() {
+				c.AbortWithStatusJSON(appErr.StatusCode, appErr)
+			}
+		}()
+
+		c.Next()
+
+		if c.Writer.Written() {
+			return
+		}
+		if apperrors.ClientDisconnected(c.Request.Context()) {
+			c.Status(apperrors.StatusClientClosedRequest)
+			logger.Info("client_disconnected",
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("request-id", c.GetString("requestId")),
+			)
+			return
+		}
+		if len(c.Errors) == 0 {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		appErr := apperrors.From(err)
+
+		// Returned errors carry no stack, so the handler stands in for the frames
+		fp := fingerprint(appErr.Code, err, []string{c.HandlerName()})
+		c.Set(FingerprintKey, fp)
+		if appErr.StatusCode >= http.StatusInternalServerError {
+			logger.Error("request failed",
+				zap.String("fingerprint", fp),
+				zap.Error(err),
+				zap.String("code", appErr.Code),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("request-id", c.GetString("requestId")),
+			)
+		}
+
+		c.JSON(appErr.StatusCode, appErr.Localize(c.GetHeader("Accept-Language")))
+	}
+}
+
+// AbortWithError attaches err to the context and stops the handler chain
+func AbortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// FingerprintKey is the context key holding the fingerprint of a request's error
+const FingerprintKey = "errorFingerprint"
+
+// StackKey is the context key holding the stack of a recovered panic
+const StackKey = "errorStack"
+
+// fingerprintFrames is how many stack frames identify an error
+const fingerprintFrames = 5
+
+// fingerprint identifies an error by its code, type and the functions it passed
+// through. Messages and line numbers are left out so the same fault groups together
+// across requests and deploys.
+func fingerprint(code string, err any, frames []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%T", code, err)
+	for _, f := range frames {
+		h.Write([]byte{0})
+		h.Write([]byte(f))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// panicFrames returns the innermost application functions on the stack of a
+// recovered panic, skipping the runtime's own frames
+func panicFrames() []string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var out []string
+	for len(out) < fingerprintFrames {
+		f, more := frames.Next()
+		switch {
+		case strings.HasPrefix(f.Function, "github.com/gin-gonic/gin."):
+			return out
+		case f.Function != "" && !strings.HasPrefix(f.Function, "runtime."):
+			out = append(out, f.Function)
+		}
+		if !more {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/jwks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWTAuth verifies Bearer JWTs against the signing keys, selected by kid, and stores
+// the token in the request context under "user" like JWTMiddleware. Requests without
+// a JWT pass through so routes can require other credentials such as the admin token.
+// So do OAuth access tokens, which are no session of their user: only the routes of
+// oauth.RequireScopes accept them, checking their scopes and revocation, and the
+// others find no subject and answer 401.
+func JWTAuth(keys *jwks.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || strings.Count(tokenStr, ".") != 2 {
+			c.Next()
+			return
+		}
+
+		token, err := keys.Parse(tokenStr)
+		if err != nil || !token.Valid {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			AbortWithError(c, apperrors.NewUnauthorizedError("Invalid token"))
+			return
+		}
+		if jwks.IsAccessToken(token) {
+			c.Next()
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), "user", token)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
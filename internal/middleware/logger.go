@@ -3,6 +3,8 @@ package middleware
 import (
 	"time"
 
+	apperrors "go-api/pkg/errors"
+	latencybudget "go-api/pkg/latency"
 	"go-api/pkg/logger"
 
 	"github.com/gin-gonic/gin"
@@ -10,7 +12,9 @@ import (
 	"go.uber.org/zap"
 )
 
-// GinZap returns a gin.HandlerFunc that logs requests using uber-go/zap
+// GinZap returns a gin.HandlerFunc that logs requests using uber-go/zap. Requests
+// slower than their route's latency budget are logged as warnings with
+// budget_exceeded set.
 func GinZap() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -20,26 +24,37 @@ func GinZap() gin.HandlerFunc {
 		// Process request
 		c.Next()
 
-		end := time.Now()
-		latency := end.Sub(start)
+		latency := time.Since(start)
+		fields := []zap.Field{
+			zap.Int("status", c.Writer.Status()),
+			zap.String("method", c.Request.Method),
+			zap.String("proto", c.Request.Proto),
+			zap.String("path", path),
+			zap.String("query", query),
+			zap.String("ip", c.ClientIP()),
+			zap.String("user-agent", c.Request.UserAgent()),
+			zap.Duration("latency", latency),
+			zap.String("request-id", c.GetString("requestId")),
+		}
+
+		if apperrors.ClientDisconnected(c.Request.Context()) {
+			// Errors caused by the cancelled context aren't server failures
+			fields[0] = zap.String("status", "client_disconnected")
+			logger.Info(path, fields...)
+			return
+		}
 
+		log := logger.Info
+		if budget, exceeded := latencybudget.Check(c, latency); exceeded {
+			fields = append(fields, zap.Bool("budget_exceeded", true), zap.Duration("budget", budget))
+			log = logger.Warn
+		}
 		if len(c.Errors) > 0 {
 			// Append error field if this is an erroneous request
-			for _, e := range c.Errors.Errors() {
-				logger.Error(e)
-			}
-		} else {
-			logger.Info(path,
-				zap.Int("status", c.Writer.Status()),
-				zap.String("method", c.Request.Method),
-				zap.String("path", path),
-				zap.String("query", query),
-				zap.String("ip", c.ClientIP()),
-				zap.String("user-agent", c.Request.UserAgent()),
-				zap.Duration("latency", latency),
-				zap.String("request-id", c.GetString("requestId")),
-			)
+			fields = append(fields, zap.Strings("errors", c.Errors.Errors()))
+			log = logger.Warn
 		}
+		log(path, fields...)
 	}
 }
 
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"go-api/internal/config"
+	"go-api/internal/httpcache"
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/tenant"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// Auth requirements a route policy can declare
+const (
+	PolicyAuthNone  = "none"
+	PolicyAuthUser  = "user"
+	PolicyAuthAdmin = "admin"
+)
+
+// Policies applies the middleware declared for route groups in configuration
+type Policies struct {
+	policies   []policy
+	adminToken string
+}
+
+type policy struct {
+	config.RoutePolicy
+	tier  *config.RateLimitTier
+	cache gin.HandlerFunc
+}
+
+// NewPolicies checks the declared policies. The admin token and response cache back
+// the admin auth and cache TTL settings.
+func NewPolicies(cfg config.PolicyConfig, adminToken string, rc *httpcache.ResponseCache) (*Policies, error) {
+	p := &Policies{adminToken: adminToken}
+	for _, rp := range cfg.Policies {
+		pol := policy{RoutePolicy: rp}
+		switch rp.Auth {
+		case "", PolicyAuthNone, PolicyAuthUser, PolicyAuthAdmin:
+		default:
+			return nil, fmt.Errorf("policy %s: unknown auth %q", rp.Name, rp.Auth)
+		}
+		if len(rp.Roles) > 0 && rp.Auth != PolicyAuthUser {
+			return nil, fmt.Errorf("policy %s: roles need user auth", rp.Name)
+		}
+		if rp.RateLimit != "" {
+			tier, ok := cfg.Tiers[rp.RateLimit]
+			if !ok {
+				return nil, fmt.Errorf("policy %s: unknown rate limit tier %q", rp.Name, rp.RateLimit)
+			}
+			pol.tier = &tier
+		}
+		// Cached responses are keyed by tenant and URI, so one user's would be served
+		// to the others of the tenant; credentialed requests aren't cached at all
+		if rp.CacheTTL > 0 && rp.Auth != "" && rp.Auth != PolicyAuthNone {
+			return nil, fmt.Errorf("policy %s: cacheTtl can't be used with %s auth", rp.Name, rp.Auth)
+		}
+		if rp.CacheTTL > 0 {
+			pol.cache = rc.Middleware(time.Duration(rp.CacheTTL))
+		}
+		for _, pattern := range rp.Paths {
+			if _, err := path.Match(pattern, "/"); err != nil {
+				return nil, fmt.Errorf("policy %s: invalid path %q", rp.Name, pattern)
+			}
+		}
+		p.policies = append(p.policies, pol)
+	}
+	return p, nil
+}
+
+// Middleware enforces the first policy matching the request. It has to run after
+// ErrorHandler and the authentication middleware, which policies rely on.
+func (p *Policies) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pol := p.match(c.Request)
+		if pol == nil {
+			c.Next()
+			return
+		}
+
+		switch pol.Auth {
+		case PolicyAuthAdmin:
+			if err := checkAdminToken(c, p.adminToken); err != nil {
+				AbortWithError(c, err)
+				return
+			}
+		case PolicyAuthUser:
+			sub, ok := authz.SubjectFromContext(c.Request.Context())
+			if !ok {
+				c.Header("WWW-Authenticate", "Bearer")
+				AbortWithError(c, apperrors.NewUnauthorizedError("Authentication required"))
+				return
+			}
+			if len(pol.Roles) > 0 && !slices.ContainsFunc(sub.Roles, func(role string) bool { return slices.Contains(pol.Roles, role) }) {
+				AbortWithError(c, apperrors.NewForbiddenError("Insufficient role"))
+				return
+			}
+		}
+
+		if pol.tier != nil {
+			key, err := tenant.Key(c.Request.Context(), "policy:"+pol.Name+":"+policyClient(c))
+			if err != nil {
+				AbortWithError(c, apperrors.NewInternalServerError("Rate limit has no tenant scope"))
+				return
+			}
+			if !getClient(key, rate.Limit(pol.tier.RequestsPerSecond), pol.tier.Burst).Allow() {
+				AbortWithError(c, apperrors.NewTooManyRequestsError("Too many requests"))
+				return
+			}
+		}
+		next := func(c *gin.Context) { c.Next() }
+		if pol.cache != nil {
+			next = pol.cache
+		}
+		if pol.Timeout > 0 {
+			withTimeout(c, time.Duration(pol.Timeout), next)
+			return
+		}
+		next(c)
+	}
+}
+
+// withTimeout runs next with a deadline for the request context, reporting a
+// timeout error when it expired
+func withTimeout(c *gin.Context, d time.Duration, next gin.HandlerFunc) {
+	// The original request is put back afterwards: once cancelled, the deadline
+	// context would look like a client disconnect to the middleware before this
+	req := c.Request
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	defer func() {
+		cancel()
+		c.Request = req
+	}()
+	c.Request = req.WithContext(ctx)
+
+	next(c)
+
+	// Handlers give up with whatever error the expired context caused; report the
+	// timeout itself unless they still managed to respond, or a nested deadline that
+	// expired with this one already did
+	if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+		if last := c.Errors.Last(); last == nil || apperrors.From(last.Err).Code != apperrors.CodeTimeout {
+			c.Error(apperrors.NewTimeoutError("Request timed out"))
+		}
+	}
+}
+
+func (p *Policies) match(req *http.Request) *policy {
+	reqPath := path.Clean("/" + req.URL.Path)
+	for i := range p.policies {
+		pol := &p.policies[i]
+		if len(pol.Methods) > 0 && !slices.Contains(pol.Methods, req.Method) {
+			continue
+		}
+		for _, pattern := range pol.Paths {
+			if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+				if reqPath == prefix || strings.HasPrefix(reqPath, prefix+"/") {
+					return pol
+				}
+			} else if ok, _ := path.Match(pattern, reqPath); ok {
+				return pol
+			}
+		}
+	}
+	return nil
+}
+
+// policyClient identifies who a tier limit is counted for: the authenticated
+// subject, the API key, or the client IP
+func policyClient(c *gin.Context) string {
+	if sub, ok := authz.SubjectFromContext(c.Request.Context()); ok && sub.ID != "" {
+		return "sub:" + sub.ID
+	}
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		return "key:" + apiKey
+	}
+	return "ip:" + c.ClientIP()
+}
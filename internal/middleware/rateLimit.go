@@ -1,10 +1,15 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"go-api/internal/ratelimit"
+
 	"golang.org/x/time/rate"
 )
 
@@ -18,34 +23,108 @@ var (
 	mu      sync.Mutex
 	r       = rate.Every(100 * time.Second) // 1 request per second
 	burst   = 20
+
+	// overrides resolves per tenant/API key/plan limits, nil means static limits only
+	overrides *ratelimit.Resolver
+	// identify resolves the API key of a request to whom it was issued
+	identify APIKeyIdentifier
+
+	lastEviction time.Time
 )
 
-func getClient(ip string) *rate.Limiter {
+// clientIdleTTL is how long limiters of clients not seen are kept
+const clientIdleTTL = 3 * time.Minute
+
+// APIKeyIdentifier returns the identity an API key token was issued for,
+// failing for unknown or revoked keys
+type APIKeyIdentifier func(ctx context.Context, token string) (ratelimit.Identity, error)
+
+// ConfigureRateLimit sets the default limit and an optional override resolver,
+// which is handed the identity of the API key of requests as resolved by id
+func ConfigureRateLimit(requestsPerSecond float64, defaultBurst int, resolver *ratelimit.Resolver, id APIKeyIdentifier) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	c, exists := clients[ip]
+	r = rate.Limit(requestsPerSecond)
+	burst = defaultBurst
+	overrides = resolver
+	identify = id
+}
+
+func getClient(key string, limit rate.Limit, b int) *rate.Limiter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if now := time.Now(); now.Sub(lastEviction) > clientIdleTTL {
+		for k, c := range clients {
+			if now.Sub(c.lastSeen) > clientIdleTTL {
+				delete(clients, k)
+			}
+		}
+		lastEviction = now
+	}
+
+	c, exists := clients[key]
 	if !exists {
-		limiter := rate.NewLimiter(r, burst)
-		clients[ip] = &client{limiter, time.Now()}
+		limiter := rate.NewLimiter(limit, b)
+		clients[key] = &client{limiter, time.Now()}
 		return limiter
 	}
 
+	// Apply override changes to existing limiters without resetting them
+	if c.limiter.Limit() != limit {
+		c.limiter.SetLimit(limit)
+	}
+	if c.limiter.Burst() != b {
+		c.limiter.SetBurst(b)
+	}
+
 	c.lastSeen = time.Now()
 	return c.limiter
 }
 
-// RateLimitMiddleware applies rate limiting based on IP
+// RateLimitMiddleware applies rate limiting based on IP, or on the tenant/API key/plan
+// when an override matches the request
 func RateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		limiter := getClient(ip)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			ip = req.RemoteAddr
+		}
+
+		mu.Lock()
+		key, limit, b, resolver, id := ip, r, burst, overrides, identify
+		mu.Unlock()
+
+		if resolver != nil {
+			if o, ok := resolver.Resolve(req.Context(), identityFromRequest(req, id), req.URL.Path); ok {
+				key = fmt.Sprintf("%s:%s:%s", o.Scope, o.Subject, o.RoutePrefix)
+				limit, b = rate.Limit(o.RequestsPerSecond), o.Burst
+			}
+		}
+
+		limiter := getClient(key, limit, b)
 
 		if !limiter.Allow() {
 			http.Error(w, "Too many requests", http.StatusTooManyRequests)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, req)
 	})
 }
+
+// identityFromRequest returns who the request is made for. It runs ahead of
+// authentication, so headers the client may set freely, like X-Tenant-ID, are
+// not trusted: the identity is that of a valid API key, else none.
+func identityFromRequest(req *http.Request, id APIKeyIdentifier) ratelimit.Identity {
+	token := req.Header.Get("X-API-Key")
+	if token == "" || id == nil {
+		return ratelimit.Identity{}
+	}
+	identity, err := id(req.Context(), token)
+	if err != nil {
+		return ratelimit.Identity{}
+	}
+	return identity
+}
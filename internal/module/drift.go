@@ -0,0 +1,264 @@
+package module
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"go-api/pkg/database"
+)
+
+// Handling of schema drift found at startup
+const (
+	DriftOff  = "off"
+	DriftWarn = "warn" // Log the drift and start
+	DriftFail = "fail" // Log the drift and refuse to start
+)
+
+// Drift is how a database differs from what the modules' migrations expect
+type Drift struct {
+	Pending           []string       `json:"pending,omitempty"`           // Migrations not applied yet, as module/name
+	Unknown           []string       `json:"unknown,omitempty"`           // Applied migrations of loaded modules this build doesn't know, as from a newer release
+	MissingTables     []string       `json:"missingTables,omitempty"`     // Tables the migrations create that don't exist
+	MissingColumns    []string       `json:"missingColumns,omitempty"`    // As table.column
+	UnexpectedColumns []string       `json:"unexpectedColumns,omitempty"` // Columns of the tables of migrations that no migration adds
+	ChangedColumns    []ColumnChange `json:"changedColumns,omitempty"`
+	MissingIndexes    []string       `json:"missingIndexes,omitempty"`
+}
+
+// ColumnChange is a column whose type or nullability isn't what the migrations define
+type ColumnChange struct {
+	Column   string `json:"column"` // As table.column
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// Empty reports whether the database matches the migrations
+func (d Drift) Empty() bool {
+	return len(d.Pending) == 0 && len(d.Unknown) == 0 && len(d.MissingTables) == 0 && len(d.MissingColumns) == 0 &&
+		len(d.UnexpectedColumns) == 0 && len(d.ChangedColumns) == 0 && len(d.MissingIndexes) == 0
+}
+
+// table is the introspected shape of a table
+type table struct {
+	columns map[string]string // Type and nullability by name
+	indexes map[string]bool
+}
+
+type schema map[string]*table
+
+// querier is a database, connection or transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// CheckSchema compares db with the modules' migrations: the migrations it has
+// recorded, then its tables against those the migrations create when applied to
+// an empty scratch schema. Tables no migration creates, like those of the
+// built-in stores, are not compared.
+func (s *Set) CheckSchema(ctx context.Context, db *sql.DB) (Drift, error) {
+	var drift Drift
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return drift, err
+	}
+	for _, m := range s.modules {
+		known := map[string]bool{}
+		for _, mig := range m.Migrations() {
+			known[mig.Name] = true
+			if !applied[m.Name()][mig.Name] {
+				drift.Pending = append(drift.Pending, m.Name()+"/"+mig.Name)
+			}
+		}
+		for name := range applied[m.Name()] {
+			if !known[name] {
+				drift.Unknown = append(drift.Unknown, m.Name()+"/"+name)
+			}
+		}
+	}
+
+	expected, err := s.expectedSchema(ctx, db)
+	if err != nil {
+		return drift, fmt.Errorf("applying migrations to a scratch schema: %w", err)
+	}
+	actual, err := introspect(ctx, db, database.Dialect(db), "")
+	if err != nil {
+		return drift, err
+	}
+	for name, want := range expected {
+		got, ok := actual[name]
+		if !ok {
+			drift.MissingTables = append(drift.MissingTables, name)
+			continue
+		}
+		for col, def := range want.columns {
+			if gotDef, ok := got.columns[col]; !ok {
+				drift.MissingColumns = append(drift.MissingColumns, name+"."+col)
+			} else if gotDef != def {
+				drift.ChangedColumns = append(drift.ChangedColumns, ColumnChange{Column: name + "." + col, Expected: def, Actual: gotDef})
+			}
+		}
+		for col := range got.columns {
+			if _, ok := want.columns[col]; !ok {
+				drift.UnexpectedColumns = append(drift.UnexpectedColumns, name+"."+col)
+			}
+		}
+		for index := range want.indexes {
+			if !got.indexes[index] {
+				drift.MissingIndexes = append(drift.MissingIndexes, index)
+			}
+		}
+	}
+
+	for _, list := range [][]string{drift.Unknown, drift.MissingTables, drift.MissingColumns, drift.UnexpectedColumns, drift.MissingIndexes} {
+		sort.Strings(list)
+	}
+	sort.Slice(drift.ChangedColumns, func(i, j int) bool { return drift.ChangedColumns[i].Column < drift.ChangedColumns[j].Column })
+	return drift, nil
+}
+
+// appliedMigrations reads schema_migrations by module, which is empty before the
+// first migration
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[string]map[string]bool, error) {
+	applied := map[string]map[string]bool{}
+	exists := `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`
+	if database.Dialect(db) == database.SQLite {
+		exists = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, exists).Scan(&n); err != nil || n == 0 {
+		return applied, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT module, name FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var module, name string
+		if err := rows.Scan(&module, &name); err != nil {
+			return nil, err
+		}
+		if applied[module] == nil {
+			applied[module] = map[string]bool{}
+		}
+		applied[module][name] = true
+	}
+	return applied, rows.Err()
+}
+
+// expectedSchema applies every migration to an empty schema and introspects it.
+// Postgres gets a schema of its own in a transaction that is rolled back; SQLite
+// a database in memory.
+func (s *Set) expectedSchema(ctx context.Context, db *sql.DB) (schema, error) {
+	if database.Dialect(db) == database.SQLite {
+		scratch, err := database.Open(database.Config{Driver: database.SQLite, DSN: ":memory:", MaxIdleConns: 1})
+		if err != nil {
+			return nil, err
+		}
+		defer scratch.Close()
+		for _, m := range s.modules {
+			for _, mig := range m.Migrations() {
+				if _, err := scratch.ExecContext(ctx, mig.SQL); err != nil {
+					return nil, fmt.Errorf("module %s: migration %s: %w", m.Name(), mig.Name, err)
+				}
+			}
+		}
+		return introspect(ctx, scratch, database.SQLite, "")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var current string
+	if err := tx.QueryRowContext(ctx, `SELECT current_schema()`).Scan(&current); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("schema_check_%d", time.Now().UnixNano())
+	// Unqualified names in migrations are created in the scratch schema, while
+	// references to tables outside the modules still resolve
+	if _, err := tx.ExecContext(ctx, `CREATE SCHEMA `+name); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `SET LOCAL search_path TO `+name+`, "`+current+`"`); err != nil {
+		return nil, err
+	}
+	for _, m := range s.modules {
+		for _, mig := range m.Migrations() {
+			if _, err := tx.ExecContext(ctx, mig.SQL); err != nil {
+				return nil, fmt.Errorf("module %s: migration %s: %w", m.Name(), mig.Name, err)
+			}
+		}
+	}
+	return introspect(ctx, tx, database.Postgres, name)
+}
+
+// introspect reads the tables of a Postgres schema, the current one when name
+// is empty, or of an SQLite database
+func introspect(ctx context.Context, q querier, dialect, name string) (schema, error) {
+	columns := `
+		SELECT table_name, column_name, data_type, is_nullable = 'NO'
+		FROM information_schema.columns
+		WHERE table_schema = COALESCE(NULLIF($1::text, ''), current_schema())`
+	indexes := `
+		SELECT tablename, indexname FROM pg_indexes
+		WHERE schemaname = COALESCE(NULLIF($1::text, ''), current_schema())`
+	args := []any{name}
+	if dialect == database.SQLite {
+		columns = `
+			SELECT m.name, c.name, c.type, c."notnull"
+			FROM sqlite_master m, pragma_table_info(m.name) c
+			WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'`
+		indexes = `
+			SELECT tbl_name, name FROM sqlite_master
+			WHERE type = 'index' AND name NOT LIKE 'sqlite_autoindex_%'`
+		args = nil
+	}
+
+	tables := schema{}
+	get := func(name string) *table {
+		if tables[name] == nil {
+			tables[name] = &table{columns: map[string]string{}, indexes: map[string]bool{}}
+		}
+		return tables[name]
+	}
+	rows, err := q.QueryContext(ctx, columns, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName, column, typ string
+		var notNull bool
+		if err := rows.Scan(&tableName, &column, &typ, &notNull); err != nil {
+			return nil, err
+		}
+		def := typ
+		if notNull {
+			def += " NOT NULL"
+		}
+		get(tableName).columns[column] = def
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if rows, err = q.QueryContext(ctx, indexes, args...); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName, index string
+		if err := rows.Scan(&tableName, &index); err != nil {
+			return nil, err
+		}
+		get(tableName).indexes[index] = true
+	}
+	return tables, rows.Err()
+}
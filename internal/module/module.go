@@ -0,0 +1,477 @@
+// Package module lets a feature live in one self-contained package. The package
+// exports a Factory building its Module, which declares everything the feature adds:
+// schema migrations, routes on the public and admin APIs, job handlers, event
+// handlers and health checks. Listing the factory in cmd/go-api wires all of it in.
+package module
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/privacy"
+	"go-api/internal/realtime"
+	"go-api/internal/settings"
+	"go-api/internal/subresource"
+	"go-api/internal/suggest"
+	"go-api/pkg/archive"
+	"go-api/pkg/cache"
+	"go-api/pkg/cdc"
+	"go-api/pkg/clamav"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/fx"
+	"go-api/pkg/mail"
+	"go-api/pkg/matview"
+	"go-api/pkg/mongodb"
+	"go-api/pkg/projection"
+	"go-api/pkg/queue"
+	"go-api/pkg/retention"
+	"go-api/pkg/saga"
+	"go-api/pkg/signedurl"
+	"go-api/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Module is a feature package. Embed Base to implement only what the feature needs.
+type Module interface {
+	Name() string
+	// Migrations are applied in order, each once, when a database is configured
+	Migrations() []Migration
+	// Routes registers the module's handlers on the current API version
+	Routes(api *apiversion.Group)
+	// AdminRoutes registers the module's handlers under /admin, behind the admin token
+	AdminRoutes(rg *gin.RouterGroup)
+	// Jobs maps job types to their handlers
+	Jobs() map[string]queue.HandlerFunc
+	// EventHandlers are run as projections over the event stream
+	EventHandlers() []projection.Projection
+	// HealthChecks contribute to /health
+	HealthChecks() []HealthCheck
+}
+
+// Migration is a named schema change. Names must stay stable once released, as
+// they record which migrations a database has had.
+type Migration struct {
+	Name string
+	SQL  string
+}
+
+// HealthCheck reports whether something the module depends on is working
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Deps are the shared services handed to module factories. DB is nil without a
+// database, in which case modules fall back to memory like the built-in stores.
+type Deps struct {
+	DB        *sql.DB
+	Cache     cache.Cache
+	Queue     *queue.Manager
+	Events    eventstore.Store
+	Storage   storage.Storage // Files, like uploads
+	Antivirus *clamav.Client  // Nil unless ClamAV is configured
+	Mailer    mail.Mailer     // Nil unless SMTP is configured
+	Links     *signedurl.Signer
+	Mongo     *mongodb.Client // Nil unless MongoDB is configured
+}
+
+// Store backends a module can keep its records in
+const (
+	BackendMemory = "memory"
+	BackendSQL    = "sql"
+	BackendMongo  = "mongodb"
+)
+
+// Backend resolves the store backend configured for a module. An empty name picks
+// the database when there is one and memory otherwise; naming a backend that
+// isn't configured is an error.
+func (d Deps) Backend(name string) (string, error) {
+	switch name {
+	case "":
+		if d.DB != nil {
+			return BackendSQL, nil
+		}
+		return BackendMemory, nil
+	case BackendMemory:
+		return name, nil
+	case BackendSQL:
+		if d.DB == nil {
+			return "", fmt.Errorf("store %s: no database configured", name)
+		}
+		return name, nil
+	case BackendMongo:
+		if d.Mongo == nil {
+			return "", fmt.Errorf("store %s: no MongoDB configured", name)
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown store %q, want %s, %s or %s", name, BackendMemory, BackendSQL, BackendMongo)
+}
+
+// Runner is implemented by modules with background work, like schedules. Run is
+// started once everything is wired up and returns when ctx is cancelled.
+type Runner interface {
+	Run(ctx context.Context)
+}
+
+// Interceptor is implemented by modules guarding every operation of the API, like
+// requiring consent. The middleware runs after authentication, in front of the
+// handlers of every module.
+type Interceptor interface {
+	Middleware() gin.HandlerFunc
+}
+
+// Subscriber is implemented by modules built on the events of the other modules,
+// like activity feeds. Load hands them the topics of the set, which tell what each
+// event is about.
+type Subscriber interface {
+	Subscribe(topics []realtime.Topic)
+}
+
+// Factory builds a module from the shared services
+type Factory func(deps Deps) (Module, error)
+
+// Base implements every Module method but Name with nothing to contribute
+type Base struct{}
+
+func (Base) Migrations() []Migration                { return nil }
+func (Base) Routes(api *apiversion.Group)           {}
+func (Base) AdminRoutes(rg *gin.RouterGroup)        {}
+func (Base) Jobs() map[string]queue.HandlerFunc     { return nil }
+func (Base) EventHandlers() []projection.Projection { return nil }
+func (Base) HealthChecks() []HealthCheck            { return nil }
+
+// Set is the loaded modules of the application
+type Set struct {
+	modules []Module
+}
+
+// Load builds the modules, registers their jobs and event handlers, and hands the
+// modules serving sub-resources their parents, subscribers the topics, those
+// serving suggestions their sources, those handling several currencies the
+// exchange rates and the one keeping settings their definitions. It has to run before the queue and
+// projections are started; migrations are applied with Migrate and routes added
+// later with Routes, once the API version exists.
+func Load(ctx context.Context, deps Deps, runner *projection.Runner, factories ...Factory) (*Set, error) {
+	set := &Set{}
+	seen := make(map[string]bool)
+	for _, factory := range factories {
+		m, err := factory(deps)
+		if err != nil {
+			return nil, err
+		}
+		if seen[m.Name()] {
+			return nil, fmt.Errorf("module %s registered twice", m.Name())
+		}
+		seen[m.Name()] = true
+		for jobType, h := range m.Jobs() {
+			deps.Queue.Register(jobType, h)
+		}
+		for _, p := range m.EventHandlers() {
+			runner.Register(p)
+		}
+		set.modules = append(set.modules, m)
+	}
+	parents, topics, sources, rates := set.Parents(), set.Topics(), set.Suggestions(), set.Rates()
+	defs := set.Settings()
+	for _, m := range set.modules {
+		if h, ok := m.(subresource.Host); ok {
+			h.Attach(parents)
+		}
+		if sub, ok := m.(Subscriber); ok {
+			sub.Subscribe(topics)
+		}
+		if h, ok := m.(suggest.Host); ok {
+			h.Index(sources)
+		}
+		if c, ok := m.(fx.Consumer); ok && rates != nil {
+			c.UseRates(rates)
+		}
+		if h, ok := m.(settings.Host); ok {
+			h.Declare(defs)
+		}
+	}
+	return set, nil
+}
+
+// Migrate applies every module's pending migrations to db: the shared database on
+// start, or a tenant's own
+func (s *Set) Migrate(ctx context.Context, db *sql.DB) error {
+	for _, m := range s.modules {
+		if err := migrate(ctx, db, m); err != nil {
+			return fmt.Errorf("module %s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Routes registers every module's routes on api, behind the middleware of the
+// modules implementing Interceptor
+func (s *Set) Routes(api *apiversion.Group) {
+	for _, m := range s.modules {
+		if i, ok := m.(Interceptor); ok {
+			api.Use(i.Middleware())
+		}
+	}
+	for _, m := range s.modules {
+		m.Routes(api)
+	}
+}
+
+// Start runs the background work of modules implementing Runner until ctx is
+// cancelled
+func (s *Set) Start(ctx context.Context) {
+	for _, m := range s.modules {
+		if r, ok := m.(Runner); ok {
+			go r.Run(ctx)
+		}
+	}
+}
+
+// AdminRoutes registers every module's admin routes on rg
+func (s *Set) AdminRoutes(rg *gin.RouterGroup) {
+	for _, m := range s.modules {
+		m.AdminRoutes(rg)
+	}
+}
+
+// RetentionPolicies collects the policies of modules implementing
+// retention.Declarer, so the set can be registered with the purger
+func (s *Set) RetentionPolicies() []retention.Policy {
+	var policies []retention.Policy
+	for _, m := range s.modules {
+		if d, ok := m.(retention.Declarer); ok {
+			policies = append(policies, d.RetentionPolicies()...)
+		}
+	}
+	return policies
+}
+
+// PersonalDataProviders returns the modules implementing
+// privacy.PersonalDataProvider, so the set can be registered with the privacy service
+func (s *Set) PersonalDataProviders() []privacy.PersonalDataProvider {
+	var providers []privacy.PersonalDataProvider
+	for _, m := range s.modules {
+		if p, ok := m.(privacy.PersonalDataProvider); ok {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Sagas collects the definitions of modules implementing saga.Declarer, so the
+// set can be registered with the orchestrator
+func (s *Set) Sagas() []saga.Definition {
+	var defs []saga.Definition
+	for _, m := range s.modules {
+		if d, ok := m.(saga.Declarer); ok {
+			defs = append(defs, d.Sagas()...)
+		}
+	}
+	return defs
+}
+
+// ArchivePolicies collects the policies of modules implementing archive.Declarer,
+// so the set can be registered with the archiver
+func (s *Set) ArchivePolicies() []archive.Policy {
+	var policies []archive.Policy
+	for _, m := range s.modules {
+		if d, ok := m.(archive.Declarer); ok {
+			policies = append(policies, d.ArchivePolicies()...)
+		}
+	}
+	return policies
+}
+
+// MaterializedViews collects the views of modules implementing matview.Declarer,
+// so the set can be registered with the refresher
+func (s *Set) MaterializedViews() []matview.View {
+	var views []matview.View
+	for _, m := range s.modules {
+		if d, ok := m.(matview.Declarer); ok {
+			views = append(views, d.MaterializedViews()...)
+		}
+	}
+	return views
+}
+
+// ChangeSubscriptions collects the subscriptions of modules implementing
+// cdc.Declarer, so the set can be registered with the change consumer
+func (s *Set) ChangeSubscriptions() []cdc.Subscription {
+	var subs []cdc.Subscription
+	for _, m := range s.modules {
+		if d, ok := m.(cdc.Declarer); ok {
+			subs = append(subs, d.ChangeSubscriptions()...)
+		}
+	}
+	return subs
+}
+
+// EventSchemas collects the schemas of modules implementing eventschema.Declarer,
+// so the set can be registered with the schema registry
+func (s *Set) EventSchemas() []eventschema.Schema {
+	var schemas []eventschema.Schema
+	for _, m := range s.modules {
+		if d, ok := m.(eventschema.Declarer); ok {
+			schemas = append(schemas, d.EventSchemas()...)
+		}
+	}
+	return schemas
+}
+
+// Channels collects the channels of modules implementing
+// apiversion.ChannelDeclarer, so the set can be published in the AsyncAPI documents
+func (s *Set) Channels() []apiversion.Channel {
+	var channels []apiversion.Channel
+	for _, m := range s.modules {
+		if d, ok := m.(apiversion.ChannelDeclarer); ok {
+			channels = append(channels, d.Channels()...)
+		}
+	}
+	return channels
+}
+
+// Topics collects the topics of modules implementing realtime.Declarer, so the
+// set can be registered with the realtime hub
+func (s *Set) Topics() []realtime.Topic {
+	var topics []realtime.Topic
+	for _, m := range s.modules {
+		if d, ok := m.(realtime.Declarer); ok {
+			topics = append(topics, d.Topics()...)
+		}
+	}
+	return topics
+}
+
+// Parents collects the parents of modules implementing subresource.Declarer, so
+// the set can hand them to the modules serving sub-resources
+func (s *Set) Parents() []subresource.Parent {
+	var parents []subresource.Parent
+	for _, m := range s.modules {
+		if d, ok := m.(subresource.Declarer); ok {
+			parents = append(parents, d.Parents()...)
+		}
+	}
+	return parents
+}
+
+// Suggestions collects the sources of modules implementing suggest.Declarer, so
+// the set can hand them to the modules serving suggestions
+func (s *Set) Suggestions() []suggest.Source {
+	var sources []suggest.Source
+	for _, m := range s.modules {
+		if d, ok := m.(suggest.Declarer); ok {
+			sources = append(sources, d.Suggestions()...)
+		}
+	}
+	return sources
+}
+
+// Settings collects the settings of modules implementing settings.Declarer, so
+// the set can hand them to the module keeping their overrides
+func (s *Set) Settings() []settings.Definition {
+	var defs []settings.Definition
+	for _, m := range s.modules {
+		if d, ok := m.(settings.Declarer); ok {
+			defs = append(defs, d.Settings()...)
+		}
+	}
+	return defs
+}
+
+// Rates returns the module converting between currencies, as the rates module
+// does, or nil without one
+func (s *Set) Rates() fx.Converter {
+	for _, m := range s.modules {
+		if c, ok := m.(fx.Converter); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// HealthChecks collects the health checks of every module, named after the module
+// and the check, like images.storage
+func (s *Set) HealthChecks() []HealthCheck {
+	var checks []HealthCheck
+	for _, m := range s.modules {
+		for _, hc := range m.HealthChecks() {
+			checks = append(checks, HealthCheck{Name: m.Name() + "." + hc.Name, Check: hc.Check})
+		}
+	}
+	return checks
+}
+
+// Health runs every health check, returning the failures by module and check name
+func (s *Set) Health(ctx context.Context) map[string]string {
+	failures := make(map[string]string)
+	for _, hc := range s.HealthChecks() {
+		if err := hc.Check(ctx); err != nil {
+			failures[hc.Name] = err.Error()
+		}
+	}
+	return failures
+}
+
+// HealthHandler answers 200 when every check passes and 503 listing the failures
+// otherwise
+func (s *Set) HealthHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if failures := s.Health(c.Request.Context()); len(failures) > 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unhealthy", "checks": failures})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	}
+}
+
+// migrate applies the module's migrations that the database hasn't had yet, each in
+// its own transaction together with its record in schema_migrations
+func migrate(ctx context.Context, db *sql.DB, m Module) error {
+	migrations := m.Migrations()
+	if len(migrations) == 0 {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			module     TEXT NOT NULL,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (module, name)
+		)`); err != nil {
+		return err
+	}
+
+	for _, mig := range migrations {
+		var applied int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE module = $1 AND name = $2`, m.Name(), mig.Name).Scan(&applied); err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, mig.SQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", mig.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (module, name, applied_at) VALUES ($1, $2, $3)`, m.Name(), mig.Name, time.Now().UTC()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
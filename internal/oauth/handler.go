@@ -0,0 +1,102 @@
+package oauth
+
+import (
+	"net/http"
+	"slices"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for registering OAuth clients
+type Handler struct {
+	store Store
+}
+
+// NewHandler creates an OAuth client handler
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// RegisterRoutes mounts the client registration endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/oauth/clients", h.list)
+	rg.POST("/oauth/clients", h.create)
+	rg.GET("/oauth/clients/:id", h.get)
+	rg.DELETE("/oauth/clients/:id", h.delete)
+}
+
+type createClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grantTypes" binding:"required,min=1"`
+}
+
+func (h *Handler) list(c *gin.Context) {
+	clients, err := h.store.ListClients(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": clients})
+}
+
+func (h *Handler) get(c *gin.Context) {
+	cl, err := h.store.GetClient(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, cl)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var req createClientRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid OAuth client request", err))
+		return
+	}
+	for _, grant := range req.GrantTypes {
+		if grant != GrantClientCredentials && grant != GrantAuthorizationCode {
+			c.Error(apperrors.NewValidationError("Unsupported grant type " + grant))
+			return
+		}
+	}
+	if req.Public && slices.Contains(req.GrantTypes, GrantClientCredentials) {
+		c.Error(apperrors.NewValidationError("Public clients can't use the client credentials grant"))
+		return
+	}
+	if slices.Contains(req.GrantTypes, GrantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		c.Error(apperrors.NewValidationError("The authorization code grant requires at least one redirect URI"))
+		return
+	}
+
+	cl, secret, err := NewClient(req.Name, req.Public, req.RedirectURIs, req.Scopes, req.GrantTypes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.store.CreateClient(c.Request.Context(), cl); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The secret is only ever returned here
+	resp := gin.H{"client": cl}
+	if secret != "" {
+		resp["clientSecret"] = secret
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if err := h.store.DeleteClient(c.Request.Context(), c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
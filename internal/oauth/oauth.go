@@ -0,0 +1,176 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// Grant types supported by the token endpoint
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantAuthorizationCode = "authorization_code"
+)
+
+// secretPrefix makes client secrets recognisable in logs and secret scanners
+const secretPrefix = "gcs_"
+
+// Config holds OAuth2 provider configuration
+type Config struct {
+	AccessTokenTTL time.Duration `yaml:"accessTokenTTL"`
+	CodeTTL        time.Duration `yaml:"codeTTL"`
+}
+
+// Client is a registered third-party integration. Public clients have no secret and
+// must use the authorization code grant with PKCE.
+type Client struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"-"`
+	Public       bool      `json:"public"`
+	RedirectURIs []string  `json:"redirectUris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grantTypes"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// AllowsGrant reports whether the client may use a grant type
+func (cl Client) AllowsGrant(grant string) bool {
+	if grant == GrantClientCredentials && cl.Public {
+		return false
+	}
+	return slices.Contains(cl.GrantTypes, grant)
+}
+
+// AllowsRedirect reports whether uri exactly matches a registered redirect URI
+func (cl Client) AllowsRedirect(uri string) bool {
+	return slices.Contains(cl.RedirectURIs, uri)
+}
+
+// Code is an authorization code waiting to be exchanged. Only its hash is stored.
+type Code struct {
+	Hash          string
+	ClientID      string
+	Subject       string
+	Tenant        string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// Token is an issued access token, kept by hash so it can be introspected and revoked.
+// Subject is empty for client credentials tokens.
+type Token struct {
+	Hash      string
+	ClientID  string
+	Subject   string
+	Tenant    string
+	Scopes    []string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	Revoked   bool
+}
+
+// Active reports whether the token can still be used
+func (t Token) Active() bool {
+	return !t.Revoked && time.Now().Before(t.ExpiresAt)
+}
+
+// HasScopes reports whether the token was granted every scope
+func (t Token) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(t.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store persists clients, authorization codes and tokens
+type Store interface {
+	CreateClient(ctx context.Context, cl Client) error
+	GetClient(ctx context.Context, id string) (Client, error)
+	ListClients(ctx context.Context) ([]Client, error)
+	DeleteClient(ctx context.Context, id string) error
+	SaveCode(ctx context.Context, code Code) error
+	// TakeCode returns and deletes a code so it can only be exchanged once
+	TakeCode(ctx context.Context, hash string) (Code, error)
+	SaveToken(ctx context.Context, t Token) error
+	FindToken(ctx context.Context, hash string) (Token, error)
+	RevokeToken(ctx context.Context, hash string) error
+}
+
+var (
+	errClientNotFound = apperrors.NewNotFoundError("OAuth client not found")
+	errCodeNotFound   = apperrors.NewNotFoundError("Authorization code not found")
+	errTokenNotFound  = apperrors.NewNotFoundError("Token not found")
+)
+
+// NewClient creates a client and returns it with its plaintext secret, which is empty
+// for public clients and can't be recovered later
+func NewClient(name string, public bool, redirectURIs, scopes, grantTypes []string) (Client, string, error) {
+	cl := Client{
+		ID:           uuid.New().String(),
+		Name:         name,
+		Public:       public,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		GrantTypes:   grantTypes,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if public {
+		return cl, "", nil
+	}
+
+	secret, err := randomToken(secretPrefix)
+	if err != nil {
+		return Client{}, "", err
+	}
+	cl.SecretHash = Hash(secret)
+	return cl, secret, nil
+}
+
+// Hash returns the stored representation of a secret, code or token
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// verifyPKCE checks an S256 code verifier against the challenge sent to /authorize
+func verifyPKCE(challenge, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
+
+// grantScopes returns the requested space-separated scopes if the client may have
+// all of them, or every allowed scope when none were requested
+func grantScopes(cl Client, requested string) ([]string, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return cl.Scopes, true
+	}
+	scopes := strings.Fields(requested)
+	for _, s := range scopes {
+		if !slices.Contains(cl.Scopes, s) {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
@@ -0,0 +1,338 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/jwks"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Server is an embedded OAuth2 authorization server supporting the client
+// credentials grant and the authorization code grant with PKCE (S256). Access tokens
+// are JWTs signed by the key manager, so resource servers can verify them against the
+// JWKS without calling back, while introspection and revocation use the store.
+type Server struct {
+	store Store
+	keys  *jwks.Manager
+	cfg   Config
+}
+
+// NewServer creates an authorization server
+func NewServer(store Store, keys *jwks.Manager, cfg Config) *Server {
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = time.Hour
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = 10 * time.Minute
+	}
+	return &Server{store: store, keys: keys, cfg: cfg}
+}
+
+// RegisterRoutes mounts the OAuth2 endpoints on a public router group
+func (s *Server) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/authorize", s.authorize)
+	rg.POST("/token", s.token)
+	rg.POST("/introspect", s.introspect)
+	rg.POST("/revoke", s.revoke)
+}
+
+// oauthError writes an error response in the RFC 6749 format, which OAuth clients
+// expect instead of the API's usual error body
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// authorize issues an authorization code to the signed-in user. The user must already
+// be authenticated; consent is implied for users of this API.
+func (s *Server) authorize(c *gin.Context) {
+	cl, err := s.store.GetClient(c.Request.Context(), c.Query("client_id"))
+	if err != nil {
+		c.Error(apperrors.NewValidationError("Unknown OAuth client"))
+		return
+	}
+	redirectURI := c.Query("redirect_uri")
+	if !cl.AllowsRedirect(redirectURI) {
+		// Never redirect to an unregistered URI
+		c.Error(apperrors.NewValidationError("redirect_uri is not registered for this client"))
+		return
+	}
+
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok {
+		c.Error(apperrors.NewUnauthorizedError("Sign in to authorize this application"))
+		return
+	}
+
+	state := c.Query("state")
+	fail := func(code, description string) {
+		redirectWith(c, redirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {state}})
+	}
+
+	if c.Query("response_type") != "code" {
+		fail("unsupported_response_type", "Only the code response type is supported")
+		return
+	}
+	if !cl.AllowsGrant(GrantAuthorizationCode) {
+		fail("unauthorized_client", "Client may not use the authorization code grant")
+		return
+	}
+	challenge := c.Query("code_challenge")
+	if challenge == "" || c.Query("code_challenge_method") != "S256" {
+		fail("invalid_request", "PKCE with code_challenge_method S256 is required")
+		return
+	}
+	scopes, ok := grantScopes(cl, c.Query("scope"))
+	if !ok {
+		fail("invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	code, err := randomToken("")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := s.store.SaveCode(c.Request.Context(), Code{
+		Hash:          Hash(code),
+		ClientID:      cl.ID,
+		Subject:       sub.ID,
+		Tenant:        sub.Tenant,
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: challenge,
+		ExpiresAt:     time.Now().Add(s.cfg.CodeTTL),
+	}); err != nil {
+		c.Error(err)
+		return
+	}
+
+	redirectWith(c, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+func redirectWith(c *gin.Context, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		c.Error(apperrors.NewValidationError("Invalid redirect_uri"))
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		if v[0] != "" {
+			q[k] = v
+		}
+	}
+	u.RawQuery = q.Encode()
+	c.Redirect(http.StatusFound, u.String())
+}
+
+// authenticateClient checks client credentials sent with HTTP Basic auth or in the
+// form body. Public clients only identify themselves.
+func (s *Server) authenticateClient(c *gin.Context) (Client, bool) {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	cl, err := s.store.GetClient(c.Request.Context(), id)
+	if err != nil {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Unknown client")
+		return Client{}, false
+	}
+	if !cl.Public && subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(cl.SecretHash)) != 1 {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+		return Client{}, false
+	}
+	return cl, true
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+func (s *Server) token(c *gin.Context) {
+	cl, ok := s.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	grant := c.PostForm("grant_type")
+	if grant != GrantClientCredentials && grant != GrantAuthorizationCode {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+		return
+	}
+	if !cl.AllowsGrant(grant) {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", "Client may not use this grant type")
+		return
+	}
+
+	t := Token{ClientID: cl.ID}
+	switch grant {
+	case GrantClientCredentials:
+		scopes, ok := grantScopes(cl, c.PostForm("scope"))
+		if !ok {
+			oauthError(c, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+			return
+		}
+		t.Scopes = scopes
+
+	case GrantAuthorizationCode:
+		code, err := s.store.TakeCode(c.Request.Context(), Hash(c.PostForm("code")))
+		if err != nil || code.ClientID != cl.ID || time.Now().After(code.ExpiresAt) {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid or expired")
+			return
+		}
+		if code.RedirectURI != c.PostForm("redirect_uri") {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+			return
+		}
+		if !verifyPKCE(code.CodeChallenge, c.PostForm("code_verifier")) {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid code_verifier")
+			return
+		}
+		t.Subject, t.Tenant, t.Scopes = code.Subject, code.Tenant, code.Scopes
+	}
+
+	t.CreatedAt = time.Now().UTC()
+	t.ExpiresAt = t.CreatedAt.Add(s.cfg.AccessTokenTTL)
+	claims := jwt.MapClaims{
+		"jti":       uuid.New().String(),
+		"sub":       t.Subject,
+		"client_id": t.ClientID,
+		"scope":     strings.Join(t.Scopes, " "),
+		"iat":       t.CreatedAt.Unix(),
+		"exp":       t.ExpiresAt.Unix(),
+	}
+	if t.Subject == "" {
+		claims["sub"] = "client:" + t.ClientID
+	}
+	if t.Tenant != "" {
+		claims["tenant"] = t.Tenant
+	}
+	access, err := s.keys.SignAccessToken(claims)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	t.Hash = Hash(access)
+	if err := s.store.SaveToken(c.Request.Context(), t); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.cfg.AccessTokenTTL.Seconds()),
+		Scope:       strings.Join(t.Scopes, " "),
+	})
+}
+
+// introspect implements RFC 7662 for authenticated clients
+func (s *Server) introspect(c *gin.Context) {
+	if _, ok := s.authenticateClient(c); !ok {
+		return
+	}
+
+	t, err := s.lookup(c.Request.Context(), c.PostForm("token"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	resp := gin.H{
+		"active":     true,
+		"client_id":  t.ClientID,
+		"scope":      strings.Join(t.Scopes, " "),
+		"token_type": "Bearer",
+		"exp":        t.ExpiresAt.Unix(),
+		"iat":        t.CreatedAt.Unix(),
+	}
+	if t.Subject != "" {
+		resp["sub"] = t.Subject
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// revoke implements RFC 7009. Clients may only revoke their own tokens, and unknown
+// tokens are not an error.
+func (s *Server) revoke(c *gin.Context) {
+	cl, ok := s.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	hash := Hash(c.PostForm("token"))
+	t, err := s.store.FindToken(c.Request.Context(), hash)
+	if err == nil && t.ClientID == cl.ID {
+		if err := s.store.RevokeToken(c.Request.Context(), hash); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
+var errInactiveToken = errors.New("token is not active")
+
+func (s *Server) lookup(ctx context.Context, access string) (Token, error) {
+	t, err := s.store.FindToken(ctx, Hash(access))
+	if err != nil {
+		return Token{}, err
+	}
+	if !t.Active() {
+		return Token{}, errInactiveToken
+	}
+	return t, nil
+}
+
+// RequireScopes protects routes with access tokens issued by this server. The token's
+// user, or the client for client credentials tokens, becomes the authz subject.
+func (s *Server) RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		access, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer`)
+			c.Error(apperrors.NewUnauthorizedError("Missing access token"))
+			c.Abort()
+			return
+		}
+
+		t, err := s.lookup(c.Request.Context(), access)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.Error(apperrors.NewUnauthorizedError("Invalid or expired access token"))
+			c.Abort()
+			return
+		}
+		if !t.HasScopes(scopes...) {
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+			c.Error(apperrors.NewForbiddenError("Access token is missing a required scope"))
+			c.Abort()
+			return
+		}
+
+		sub := authz.Subject{ID: t.Subject, Tenant: t.Tenant}
+		if sub.ID == "" {
+			sub.ID = "client:" + t.ClientID
+		}
+		c.Set("oauthClientID", t.ClientID)
+		c.Set("oauthScopes", t.Scopes)
+		c.Request = c.Request.WithContext(authz.WithSubject(c.Request.Context(), sub))
+		c.Next()
+	}
+}
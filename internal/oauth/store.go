@@ -0,0 +1,335 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/retention"
+)
+
+// MemoryStore keeps OAuth state in memory, used when no database is configured
+type MemoryStore struct {
+	mu      sync.RWMutex
+	clients map[string]Client
+	codes   map[string]Code
+	tokens  map[string]Token
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients: make(map[string]Client),
+		codes:   make(map[string]Code),
+		tokens:  make(map[string]Token),
+	}
+}
+
+func (s *MemoryStore) CreateClient(ctx context.Context, cl Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[cl.ID] = cl
+	return nil
+}
+
+func (s *MemoryStore) GetClient(ctx context.Context, id string) (Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cl, ok := s.clients[id]
+	if !ok {
+		return Client{}, errClientNotFound
+	}
+	return cl, nil
+}
+
+func (s *MemoryStore) ListClients(ctx context.Context) ([]Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Client, 0, len(s.clients))
+	for _, cl := range s.clients {
+		list = append(list, cl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteClient(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[id]; !ok {
+		return errClientNotFound
+	}
+	delete(s.clients, id)
+	for hash, t := range s.tokens {
+		if t.ClientID == id {
+			t.Revoked = true
+			s.tokens[hash] = t
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) SaveCode(ctx context.Context, code Code) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code.Hash] = code
+	return nil
+}
+
+func (s *MemoryStore) TakeCode(ctx context.Context, hash string) (Code, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[hash]
+	if !ok {
+		return Code{}, errCodeNotFound
+	}
+	delete(s.codes, hash)
+	return code, nil
+}
+
+func (s *MemoryStore) SaveToken(ctx context.Context, t Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired tokens so the map doesn't grow without bound
+	now := time.Now()
+	for hash, old := range s.tokens {
+		if now.After(old.ExpiresAt) {
+			delete(s.tokens, hash)
+		}
+	}
+	s.tokens[t.Hash] = t
+	return nil
+}
+
+func (s *MemoryStore) FindToken(ctx context.Context, hash string) (Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return Token{}, errTokenNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) RevokeToken(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return errTokenNotFound
+	}
+	t.Revoked = true
+	s.tokens[hash] = t
+	return nil
+}
+
+// SQLStore persists OAuth state in the oauth_clients, oauth_codes and oauth_tokens tables.
+// List fields are stored space-separated.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the OAuth tables if they do not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS oauth_clients (
+			id            TEXT PRIMARY KEY,
+			name          TEXT NOT NULL,
+			secret_hash   TEXT NOT NULL DEFAULT '',
+			public        BOOLEAN NOT NULL DEFAULT FALSE,
+			redirect_uris TEXT NOT NULL DEFAULT '',
+			scopes        TEXT NOT NULL DEFAULT '',
+			grant_types   TEXT NOT NULL DEFAULT '',
+			created_at    TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS oauth_codes (
+			hash           TEXT PRIMARY KEY,
+			client_id      TEXT NOT NULL,
+			subject        TEXT NOT NULL,
+			tenant         TEXT NOT NULL DEFAULT '',
+			redirect_uri   TEXT NOT NULL,
+			scopes         TEXT NOT NULL DEFAULT '',
+			code_challenge TEXT NOT NULL,
+			expires_at     TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS oauth_tokens (
+			hash       TEXT PRIMARY KEY,
+			client_id  TEXT NOT NULL,
+			subject    TEXT NOT NULL DEFAULT '',
+			tenant     TEXT NOT NULL DEFAULT '',
+			scopes     TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			revoked    BOOLEAN NOT NULL DEFAULT FALSE
+		)`)
+	return err
+}
+
+func (s *SQLStore) CreateClient(ctx context.Context, cl Client) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_clients (id, name, secret_hash, public, redirect_uris, scopes, grant_types, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		cl.ID, cl.Name, cl.SecretHash, cl.Public,
+		strings.Join(cl.RedirectURIs, " "), strings.Join(cl.Scopes, " "), strings.Join(cl.GrantTypes, " "),
+		cl.CreatedAt)
+	return err
+}
+
+const selectClients = `SELECT id, name, secret_hash, public, redirect_uris, scopes, grant_types, created_at FROM oauth_clients`
+
+func (s *SQLStore) GetClient(ctx context.Context, id string) (Client, error) {
+	cl, err := scanClient(s.db.QueryRowContext(ctx, selectClients+` WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Client{}, errClientNotFound
+	}
+	return cl, err
+}
+
+func (s *SQLStore) ListClients(ctx context.Context) ([]Client, error) {
+	rows, err := s.db.QueryContext(ctx, selectClients+` ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Client
+	for rows.Next() {
+		cl, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, cl)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) DeleteClient(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM oauth_clients WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errClientNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE oauth_tokens SET revoked = TRUE WHERE client_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_codes WHERE client_id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) SaveCode(ctx context.Context, code Code) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_codes (hash, client_id, subject, tenant, redirect_uri, scopes, code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		code.Hash, code.ClientID, code.Subject, code.Tenant, code.RedirectURI,
+		strings.Join(code.Scopes, " "), code.CodeChallenge, code.ExpiresAt)
+	return err
+}
+
+func (s *SQLStore) TakeCode(ctx context.Context, hash string) (Code, error) {
+	code := Code{Hash: hash}
+	var scopes string
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM oauth_codes WHERE hash = $1
+		RETURNING client_id, subject, tenant, redirect_uri, scopes, code_challenge, expires_at`, hash,
+	).Scan(&code.ClientID, &code.Subject, &code.Tenant, &code.RedirectURI, &scopes, &code.CodeChallenge, &code.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Code{}, errCodeNotFound
+	}
+	if err != nil {
+		return Code{}, err
+	}
+	code.Scopes = strings.Fields(scopes)
+	return code, nil
+}
+
+func (s *SQLStore) SaveToken(ctx context.Context, t Token) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_tokens (hash, client_id, subject, tenant, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		t.Hash, t.ClientID, t.Subject, t.Tenant, strings.Join(t.Scopes, " "), t.ExpiresAt, t.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) FindToken(ctx context.Context, hash string) (Token, error) {
+	t := Token{Hash: hash}
+	var scopes string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT client_id, subject, tenant, scopes, expires_at, created_at, revoked
+		FROM oauth_tokens WHERE hash = $1`, hash,
+	).Scan(&t.ClientID, &t.Subject, &t.Tenant, &scopes, &t.ExpiresAt, &t.CreatedAt, &t.Revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, errTokenNotFound
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	return t, nil
+}
+
+func (s *SQLStore) RevokeToken(ctx context.Context, hash string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE oauth_tokens SET revoked = TRUE WHERE hash = $1`, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTokenNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanClient(row scanner) (Client, error) {
+	var cl Client
+	var redirectURIs, scopes, grantTypes string
+	if err := row.Scan(&cl.ID, &cl.Name, &cl.SecretHash, &cl.Public, &redirectURIs, &scopes, &grantTypes, &cl.CreatedAt); err != nil {
+		return Client{}, err
+	}
+	cl.RedirectURIs = strings.Fields(redirectURIs)
+	cl.Scopes = strings.Fields(scopes)
+	cl.GrantTypes = strings.Fields(grantTypes)
+	return cl, nil
+}
+
+// RetentionPolicies drops authorization codes and tokens once they are long expired
+func (s *SQLStore) RetentionPolicies() []retention.Policy {
+	return []retention.Policy{
+		{
+			Name:        "oauth_codes",
+			Description: "Expired OAuth authorization codes",
+			MaxAge:      24 * time.Hour,
+			Target:      retention.SQLTable{DB: s.db, Table: "oauth_codes", KeyColumn: "hash", TimeColumn: "expires_at"},
+		},
+		{
+			Name:        "oauth_tokens",
+			Description: "Expired or revoked OAuth access tokens",
+			MaxAge:      30 * 24 * time.Hour,
+			Target:      retention.SQLTable{DB: s.db, Table: "oauth_tokens", KeyColumn: "hash", TimeColumn: "expires_at"},
+		},
+	}
+}
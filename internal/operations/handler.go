@@ -0,0 +1,87 @@
+package operations
+
+import (
+	"net/http"
+
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes operations to the clients that started them and to admins
+type Handler struct {
+	manager *Manager
+}
+
+// NewHandler creates an operations handler
+func NewHandler(manager *Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// RegisterRoutes mounts GET /operations/:id on a router group of signed-in users
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	h.manager.publicPath = rg.BasePath() + "/operations"
+	rg.GET("/operations/:id", h.get)
+}
+
+// RegisterAdminRoutes mounts every operation on an admin router group
+func (h *Handler) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	h.manager.adminPath = rg.BasePath() + "/operations"
+	rg.GET("/operations", routing.Query("limit"), h.list)
+	rg.GET("/operations/:id", h.adminGet)
+}
+
+// get returns an operation of the caller. Other subjects' operations are reported
+// as missing so their IDs can't be probed.
+func (h *Handler) get(c *gin.Context) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok {
+		c.Error(apperrors.NewUnauthorizedError("Sign in to view operations"))
+		return
+	}
+	op, err := h.manager.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && (op.Owner == "" || op.Owner != sub.ID) {
+		err = errOperationNotFound
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.write(c, op)
+}
+
+func (h *Handler) adminGet(c *gin.Context) {
+	op, err := h.manager.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.write(c, op)
+}
+
+// write renders an operation, asking clients to poll again while it runs
+func (h *Handler) write(c *gin.Context, op Operation) {
+	if !op.Status.Done() {
+		c.Header("Retry-After", "1")
+	}
+	c.JSON(http.StatusOK, op)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	query := struct {
+		Limit int `form:"limit" binding:"min=1"`
+	}{Limit: 100}
+	if err := bind.Query(c, &query); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid query", err))
+		return
+	}
+	list, err := h.manager.store.List(c.Request.Context(), query.Limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
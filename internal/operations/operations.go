@@ -0,0 +1,200 @@
+// Package operations implements long-running operations: a handler starts the work
+// on the job queue and answers 202 Accepted with an operation resource, which
+// clients poll until it has succeeded or failed.
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/queue"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Status is the lifecycle state of an operation
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Done reports whether the operation has finished
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+// Error is the failure of an operation, in the shape of an API error
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Operation is the resource clients poll
+type Operation struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Owner       string          `json:"owner,omitempty"` // Subject that started it, empty for admin operations
+	Tenant      string          `json:"tenant,omitempty"`
+	Status      Status          `json:"status"`
+	Progress    int             `json:"progress"` // Percent, when the operation reports it
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       *Error          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+}
+
+// Task is the running operation handed to its Func
+type Task struct {
+	Operation Operation
+	payload   json.RawMessage
+	manager   *Manager
+}
+
+// Decode unmarshals the payload the operation was started with
+func (t *Task) Decode(v any) error {
+	return json.Unmarshal(t.payload, v)
+}
+
+// Progress records how far the operation has got, in percent
+func (t *Task) Progress(ctx context.Context, percent int) error {
+	t.Operation.Progress = min(max(percent, 0), 100)
+	t.Operation.UpdatedAt = time.Now().UTC()
+	return t.manager.store.Save(ctx, t.Operation)
+}
+
+// Func does the work of an operation type; its return value becomes the result.
+// AppErrors are final, other errors are retried by the job queue.
+type Func func(ctx context.Context, task *Task) (any, error)
+
+const jobTypePrefix = "operation:"
+
+type job struct {
+	OperationID string          `json:"operationId"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// Manager starts operations and runs them on the job queue
+type Manager struct {
+	store     Store
+	jobs      *queue.Manager
+	queueName string
+
+	publicPath string // Where owners poll their operations
+	adminPath  string // Where admins poll operations without an owner
+}
+
+// NewManager creates a manager running operations on queueName
+func NewManager(store Store, jobs *queue.Manager, queueName string) *Manager {
+	return &Manager{store: store, jobs: jobs, queueName: queueName, publicPath: "/operations", adminPath: "/admin/operations"}
+}
+
+// Register sets the Func of an operation type, must be called before the queue starts
+func (m *Manager) Register(opType string, fn Func) {
+	m.jobs.Register(jobTypePrefix+opType, func(ctx context.Context, j *queue.Job) error {
+		return m.run(ctx, j, fn)
+	})
+}
+
+// Start creates an operation owned by the caller and queues it
+func (m *Manager) Start(ctx context.Context, opType string, payload any) (Operation, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	now := time.Now().UTC()
+	op := Operation{ID: uuid.New().String(), Type: opType, Status: StatusPending, CreatedAt: now, UpdatedAt: now}
+	if sub, ok := authz.SubjectFromContext(ctx); ok {
+		op.Owner, op.Tenant = sub.ID, sub.Tenant
+	}
+	if err := m.store.Save(ctx, op); err != nil {
+		return Operation{}, err
+	}
+	if _, err := m.jobs.Enqueue(ctx, m.queueName, jobTypePrefix+opType, job{OperationID: op.ID, Payload: raw}); err != nil {
+		return Operation{}, err
+	}
+	logger.Info("operation started", zap.String("id", op.ID), zap.String("type", opType))
+	return op, nil
+}
+
+// Accepted answers 202 with the operation and where to poll it
+func (m *Manager) Accepted(c *gin.Context, op Operation) {
+	location := m.publicPath + "/" + op.ID
+	if op.Owner == "" {
+		location = m.adminPath + "/" + op.ID
+	}
+	c.Header("Location", location)
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusAccepted, op)
+}
+
+// Get returns an operation
+func (m *Manager) Get(ctx context.Context, id string) (Operation, error) {
+	return m.store.Get(ctx, id)
+}
+
+func (m *Manager) run(ctx context.Context, j *queue.Job, fn Func) error {
+	var payload job
+	if err := j.Decode(&payload); err != nil {
+		return err
+	}
+	op, err := m.store.Get(ctx, payload.OperationID)
+	if err != nil {
+		return err
+	}
+	if op.Status.Done() {
+		return nil
+	}
+
+	op.Status = StatusRunning
+	op.UpdatedAt = time.Now().UTC()
+	if err := m.store.Save(ctx, op); err != nil {
+		return err
+	}
+
+	task := &Task{Operation: op, payload: payload.Payload, manager: m}
+	result, err := fn(ctx, task)
+	op = task.Operation
+
+	now := time.Now().UTC()
+	op.UpdatedAt = now
+	var appErr *apperrors.AppError
+	switch {
+	case err == nil:
+		if op.Result, err = json.Marshal(result); err != nil {
+			return err
+		}
+		op.Status, op.Progress, op.CompletedAt = StatusSucceeded, 100, &now
+	case errors.As(err, &appErr):
+		op.Status, op.CompletedAt = StatusFailed, &now
+		op.Error = &Error{Code: appErr.Code, Message: appErr.Message}
+	case j.Attempts >= j.MaxAttempts:
+		op.Status, op.CompletedAt = StatusFailed, &now
+		op.Error = &Error{Code: "INTERNAL_SERVER_ERROR", Message: "Operation failed"}
+	default:
+		// Keep it running while the queue retries
+		logger.Warn("operation attempt failed", zap.String("id", op.ID), zap.Error(err))
+		if saveErr := m.store.Save(ctx, op); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+
+	if op.Status == StatusFailed {
+		logger.Error("operation failed", zap.String("id", op.ID), zap.String("type", op.Type), zap.Error(err))
+	}
+	return m.store.Save(ctx, op)
+}
@@ -0,0 +1,152 @@
+package operations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retention"
+)
+
+// Store persists operations
+type Store interface {
+	Save(ctx context.Context, op Operation) error
+	Get(ctx context.Context, id string) (Operation, error)
+	// List returns the most recent operations, newest first
+	List(ctx context.Context, limit int) ([]Operation, error)
+}
+
+var errOperationNotFound = apperrors.NewNotFoundError("Operation not found")
+
+// MemoryStore keeps operations in memory, used when no database is configured
+type MemoryStore struct {
+	mu         sync.RWMutex
+	operations map[string]Operation
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{operations: make(map[string]Operation)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, op Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[op.ID] = op
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	op, ok := s.operations[id]
+	if !ok {
+		return Operation{}, errOperationNotFound
+	}
+	return op, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, limit int) ([]Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Operation, 0, len(s.operations))
+	for _, op := range s.operations {
+		list = append(list, op)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// SQLStore persists operations as JSON in the operations table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the operations table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS operations (
+			id           TEXT PRIMARY KEY,
+			type         TEXT NOT NULL,
+			status       TEXT NOT NULL,
+			data         TEXT NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			completed_at TIMESTAMP NULL
+		)`)
+	return err
+}
+
+func (s *SQLStore) Save(ctx context.Context, op Operation) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO operations (id, type, status, data, created_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			data = EXCLUDED.data,
+			completed_at = EXCLUDED.completed_at`,
+		op.ID, op.Type, string(op.Status), string(data), op.CreatedAt, op.CompletedAt)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Operation, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM operations WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Operation{}, errOperationNotFound
+	}
+	if err != nil {
+		return Operation{}, err
+	}
+	var op Operation
+	return op, json.Unmarshal([]byte(data), &op)
+}
+
+func (s *SQLStore) List(ctx context.Context, limit int) ([]Operation, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM operations ORDER BY created_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Operation
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var op Operation
+		if err := json.Unmarshal([]byte(data), &op); err != nil {
+			return nil, err
+		}
+		list = append(list, op)
+	}
+	return list, rows.Err()
+}
+
+// RetentionPolicies drops finished operations once clients have had time to collect the result
+func (s *SQLStore) RetentionPolicies() []retention.Policy {
+	return []retention.Policy{{
+		Name:        "operations_finished",
+		Description: "Finished long-running operations",
+		MaxAge:      7 * 24 * time.Hour,
+		Target:      retention.SQLTable{DB: s.db, Table: "operations", TimeColumn: "completed_at", Where: "completed_at IS NOT NULL"},
+	}}
+}
@@ -0,0 +1,226 @@
+package preferences
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/settings"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValueList is the settings in effect for the caller, by key
+type ValueList struct {
+	Data []Value `json:"data"`
+}
+
+// Routes mounts the settings of the caller and the management of the overrides
+func (m *preferencesModule) Routes(api *apiversion.Group) {
+	tags := []string{"settings"}
+	scopes := "?scope=tenant changes the tenant's value, for all its users, and ?scope=user the caller's own, over the tenant's; " +
+		"settings of the user scope are the caller's by default, others the tenant's. Changing the tenant's takes the update " +
+		"action on the setting, which the default policy leaves to admins."
+	api.GET("/settings", apiversion.Operation{
+		ID:      "listSettings",
+		Summary: "List the settings in effect for the caller",
+		Description: "Lists every declared setting with its value and where it comes from: the caller's override, the " +
+			"tenant's or the default. Settings declared through templates, like notifications.*.email, are listed " +
+			"for the keys overridden.",
+		Tags:     tags,
+		Response: ValueList{},
+	}, m.list)
+	api.GET("/settings/:key", apiversion.Operation{
+		ID:       "getSetting",
+		Summary:  "Get a setting in effect for the caller",
+		Tags:     tags,
+		Response: Value{},
+	}, m.get)
+	api.PUT("/settings/:key", apiversion.Operation{
+		ID:          "setSetting",
+		Summary:     "Override a setting",
+		Description: "Sets the value, which has to be of the setting's type and rules; durations are written like 1h30m. " + scopes,
+		Tags:        tags,
+		Idempotency: retrysafe.Idempotent,
+		Request:     setRequest{},
+		Response:    Value{},
+	}, m.set)
+	api.DELETE("/settings/:key", apiversion.Operation{
+		ID:          "resetSetting",
+		Summary:     "Remove the override of a setting",
+		Description: "The setting goes back to the tenant's value or the default. " + scopes,
+		Tags:        tags,
+	}, m.reset)
+}
+
+type setRequest struct {
+	Value json.RawMessage `json:"value" binding:"required"`
+}
+
+// subject returns the signed-in subject, whose tenant the settings are of
+func subject(c *gin.Context) (authz.Subject, error) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		return sub, apperrors.NewUnauthorizedError("Authentication required")
+	}
+	return sub, nil
+}
+
+// render returns a value the way it is written in JSON
+func render(v Value) Value {
+	v.Value, v.Default = encode(v.Value), encode(v.Default)
+	return v
+}
+
+func (m *preferencesModule) list(c *gin.Context) {
+	sub, err := subject(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ctx := c.Request.Context()
+	keys := make(map[string]bool)
+	for _, d := range m.defs {
+		if !d.Template() {
+			keys[d.Key] = true
+		}
+	}
+	for _, user := range []string{"", sub.ID} {
+		overrides, err := m.overrides(ctx, sub.Tenant, user)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		for key := range overrides {
+			keys[key] = true
+		}
+	}
+	list := make([]Value, 0, len(keys))
+	for key := range keys {
+		d, err := m.definition(key)
+		if err != nil {
+			continue // Overrides of settings no longer declared
+		}
+		v, err := m.value(ctx, sub, d, key)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		list = append(list, render(v))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	c.JSON(http.StatusOK, ValueList{Data: list})
+}
+
+func (m *preferencesModule) get(c *gin.Context) {
+	sub, err := subject(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	d, err := m.definition(c.Param("key"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	v, err := m.value(c.Request.Context(), sub, d, c.Param("key"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, render(v))
+}
+
+// override returns the definition of the :key parameter and whose overrides of
+// it ?scope= selects, once the caller may change them
+func (m *preferencesModule) override(c *gin.Context) (settings.Definition, string, error) {
+	sub, err := subject(c)
+	if err != nil {
+		return settings.Definition{}, "", err
+	}
+	d, err := m.definition(c.Param("key"))
+	if err != nil {
+		return settings.Definition{}, "", err
+	}
+	scope := c.DefaultQuery("scope", d.Scope)
+	switch {
+	case scope == settings.ScopeTenant:
+	case scope == settings.ScopeUser && d.Scope == settings.ScopeUser:
+	default:
+		param, message := "tenant user", "scope must be tenant or user"
+		if d.Scope == settings.ScopeTenant {
+			param, message = "tenant", "scope must be tenant, as only the tenant may override "+c.Param("key")
+		}
+		return settings.Definition{}, "", apperrors.NewValidationError("Invalid query", apperrors.FieldError{
+			Field: "scope", Rule: "oneof", Param: param, Message: message,
+		})
+	}
+	resource := authz.Resource{Type: "setting", ID: c.Param("key"), Tenant: sub.Tenant}
+	if scope == settings.ScopeUser {
+		resource.Owner = sub.ID
+	}
+	if err := authz.Authorize(c.Request.Context(), "update", resource); err != nil {
+		return settings.Definition{}, "", err
+	}
+	return d, owner(sub, scope), nil
+}
+
+func (m *preferencesModule) set(c *gin.Context) {
+	d, user, err := m.override(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var req setRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid setting", err))
+		return
+	}
+	value, err := d.Convert(req.Value)
+	if err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid setting", err))
+		return
+	}
+	raw, err := json.Marshal(encode(value))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ctx := c.Request.Context()
+	sub, _ := authz.SubjectFromContext(ctx)
+	key := c.Param("key")
+	o := Override{Tenant: sub.Tenant, User: user, Key: key, Value: raw, UpdatedBy: sub.ID, UpdatedAt: time.Now().UTC()}
+	if err := m.store.Set(ctx, o); err != nil {
+		c.Error(err)
+		return
+	}
+	m.invalidate(ctx, sub.Tenant, user)
+	v, err := m.value(ctx, sub, d, key)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, render(v))
+}
+
+func (m *preferencesModule) reset(c *gin.Context) {
+	_, user, err := m.override(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ctx := c.Request.Context()
+	sub, _ := authz.SubjectFromContext(ctx)
+	if err := m.store.Delete(ctx, sub.Tenant, user, c.Param("key")); err != nil {
+		c.Error(err)
+		return
+	}
+	m.invalidate(ctx, sub.Tenant, user)
+	c.Status(http.StatusNoContent)
+}
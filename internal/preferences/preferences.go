@@ -0,0 +1,259 @@
+// Package preferences is the feature module keeping the overrides tenants and
+// their users make of the settings modules declare. The value in effect is the
+// user's override for settings of the user scope, else the tenant's, else the
+// default; the overrides of each tenant and user are cached, and dropped from
+// the cache when changed. It serves settings.Get for the handlers of every
+// module.
+package preferences
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/settings"
+	"go-api/pkg/authz"
+	"go-api/pkg/cache"
+	"go-api/pkg/logger"
+	"go-api/pkg/tenant"
+
+	"go.uber.org/zap"
+)
+
+// Config holds settings configuration
+type Config struct {
+	// Definitions declare settings of the deployment, like those of clients' own
+	// features, besides those the modules declare
+	Definitions []settings.Definition `yaml:"definitions"`
+	CacheTTL    time.Duration         `yaml:"cacheTTL"` // Of the overrides of a tenant or user
+	Store       string                `yaml:"store"`    // memory or sql; the database by default
+}
+
+// Sources of the value of a setting
+const (
+	SourceDefault = "default"
+	SourceTenant  = settings.ScopeTenant
+	SourceUser    = settings.ScopeUser
+)
+
+// Value is a setting in effect for a caller
+type Value struct {
+	Key         string        `json:"key"`
+	Type        settings.Type `json:"type"`
+	Value       any           `json:"value"`
+	Source      string        `json:"source"` // Where the value comes from: default, tenant or user
+	Default     any           `json:"default"`
+	Scope       string        `json:"scope"` // Who may override it: tenant, or user too
+	Description string        `json:"description,omitempty"`
+}
+
+type preferencesModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	cache   cache.Cache
+	defs    []settings.Definition // Those of the config first, then as declared
+}
+
+// New returns the factory of the preferences module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if cfg.CacheTTL <= 0 {
+			cfg.CacheTTL = 5 * time.Minute
+		}
+		m := &preferencesModule{cfg: cfg}
+		for _, d := range cfg.Definitions {
+			if err := m.add(d); err != nil {
+				return nil, fmt.Errorf("preferences: %w", err)
+			}
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("preferences: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("preferences: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		m.backend, m.store, m.cache = backend, store, deps.Cache
+		settings.Use(m)
+		return m, nil
+	}
+}
+
+func (m *preferencesModule) Name() string { return "preferences" }
+
+func (m *preferencesModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// Declare adds the settings the modules declare. Load calls it before serving,
+// so the definitions aren't changed afterwards; broken ones are logged and left
+// out.
+func (m *preferencesModule) Declare(defs []settings.Definition) {
+	for _, d := range defs {
+		if err := m.add(d); err != nil {
+			logger.Error("failed to declare setting", zap.String("key", d.Key), zap.Error(err))
+		}
+	}
+}
+
+func (m *preferencesModule) add(d settings.Definition) error {
+	d, err := d.Check()
+	if err != nil {
+		return err
+	}
+	for _, existing := range m.defs {
+		if existing.Key == d.Key {
+			return fmt.Errorf("setting %s declared twice", d.Key)
+		}
+	}
+	m.defs = append(m.defs, d)
+	return nil
+}
+
+// definition returns the definition of a key, preferring the one declaring it
+// alone over templates
+func (m *preferencesModule) definition(key string) (settings.Definition, error) {
+	var template *settings.Definition
+	for i, d := range m.defs {
+		if d.Key == key && !d.Template() {
+			return d, nil
+		}
+		if template == nil && d.Matches(key) {
+			template = &m.defs[i]
+		}
+	}
+	if template == nil {
+		return settings.Definition{}, fmt.Errorf("%w %s", settings.ErrUnknown, key)
+	}
+	return *template, nil
+}
+
+// Resolve returns the value of a setting in effect for the subject in ctx, the
+// default without one
+func (m *preferencesModule) Resolve(ctx context.Context, key string) (any, error) {
+	d, err := m.definition(key)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := authz.SubjectFromContext(ctx)
+	v, err := m.value(ctx, sub, d, key)
+	if err != nil {
+		return nil, err
+	}
+	return v.Value, nil
+}
+
+// value resolves a setting for a subject, through the overrides of the user
+// when the setting takes them, then those of the tenant. Overrides no longer of
+// the definition, as when its rules changed, are skipped.
+func (m *preferencesModule) value(ctx context.Context, sub authz.Subject, d settings.Definition, key string) (Value, error) {
+	v := Value{Key: key, Type: d.Type, Value: d.Default, Source: SourceDefault, Default: d.Default,
+		Scope: d.Scope, Description: d.Description}
+	scopes := []string{SourceTenant}
+	if d.Scope == settings.ScopeUser && sub.ID != "" {
+		scopes = []string{SourceUser, SourceTenant}
+	}
+	for _, scope := range scopes {
+		overrides, err := m.overrides(ctx, sub.Tenant, owner(sub, scope))
+		if err != nil {
+			return Value{}, err
+		}
+		raw, ok := overrides[key]
+		if !ok {
+			continue
+		}
+		value, err := d.Convert(raw)
+		if err != nil {
+			logger.Warn("skipped setting override", zap.String("key", key), zap.String("scope", scope),
+				zap.String("tenant", sub.Tenant), zap.Error(err))
+			continue
+		}
+		v.Value, v.Source = value, scope
+		break
+	}
+	return v, nil
+}
+
+// owner returns whose overrides of a scope are the subject's: the user's own,
+// or the tenant's, stored for no user
+func owner(sub authz.Subject, scope string) string {
+	if scope == SourceUser {
+		return sub.ID
+	}
+	return ""
+}
+
+func cacheKey(tenant, user string) string {
+	return "settings:" + tenant + ":" + user
+}
+
+// overrides returns the values a tenant, or a user of it, set, by key
+func (m *preferencesModule) overrides(ctx context.Context, tenant, user string) (map[string]json.RawMessage, error) {
+	key := cacheKey(tenant, user)
+	if raw, ok, err := m.cache.Get(ctx, key); err == nil && ok {
+		var cached map[string]json.RawMessage
+		if json.Unmarshal(raw, &cached) == nil {
+			return cached, nil
+		}
+	}
+	list, err := m.store.List(ctx, tenant, user)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]json.RawMessage, len(list))
+	for _, o := range list {
+		overrides[o.Key] = o.Value
+	}
+	if raw, err := json.Marshal(overrides); err == nil {
+		m.cache.Set(ctx, key, raw, m.cfg.CacheTTL)
+	}
+	return overrides, nil
+}
+
+// invalidate drops the cached overrides of a tenant or user once changed. The
+// change is stored already, so a failure is only logged; the cache expires.
+func (m *preferencesModule) invalidate(ctx context.Context, tenant, user string) {
+	if err := m.cache.Delete(ctx, cacheKey(tenant, user)); err != nil {
+		logger.Error("failed to invalidate cached settings", zap.String("tenant", tenant), zap.String("user", user), zap.Error(err))
+	}
+}
+
+// ExportPersonalData returns the overrides the user made for themselves
+func (m *preferencesModule) ExportPersonalData(ctx context.Context, userID string) (any, error) {
+	return m.store.OfUser(ctx, userID)
+}
+
+// ErasePersonalData deletes the overrides the user made for themselves, in every
+// tenant, and drops them from the cache
+func (m *preferencesModule) ErasePersonalData(ctx context.Context, userID string) error {
+	overrides, err := m.store.OfUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := m.store.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	for _, o := range overrides {
+		m.invalidate(tenant.With(ctx, o.Tenant), o.Tenant, userID)
+	}
+	return nil
+}
+
+// encode returns a value the way it is written in JSON, durations like 1h30m
+func encode(v any) any {
+	if d, ok := v.(time.Duration); ok {
+		return d.String()
+	}
+	return v
+}
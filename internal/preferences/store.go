@@ -0,0 +1,208 @@
+package preferences
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+)
+
+// Override is the value a tenant, or one of its users, set for a setting
+type Override struct {
+	Tenant    string          `json:"tenant"`
+	User      string          `json:"user,omitempty"` // Empty for the tenant's own
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedBy string          `json:"updatedBy"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// Store persists the overrides of settings
+type Store interface {
+	// List returns the overrides of a tenant, or of a user of it, by key
+	List(ctx context.Context, tenant, user string) ([]Override, error)
+	// Set adds or replaces an override
+	Set(ctx context.Context, o Override) error
+	// Delete removes an override, failing with a not found error without one
+	Delete(ctx context.Context, tenant, user, key string) error
+	// OfUser returns the overrides a user made for themselves, in every tenant
+	OfUser(ctx context.Context, user string) ([]Override, error)
+	// DeleteUser removes the overrides of a user in every tenant
+	DeleteUser(ctx context.Context, user string) error
+}
+
+var errOverrideNotFound = apperrors.NewNotFoundError("Setting not overridden")
+
+type scope struct {
+	tenant string
+	user   string
+}
+
+// MemoryStore keeps overrides in memory, used when no database is configured
+type MemoryStore struct {
+	mu        sync.RWMutex
+	overrides map[scope]map[string]Override // By key
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{overrides: make(map[scope]map[string]Override)}
+}
+
+func (s *MemoryStore) List(ctx context.Context, tenant, user string) ([]Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Override, 0, len(s.overrides[scope{tenant, user}]))
+	for _, o := range s.overrides[scope{tenant, user}] {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, o Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc := scope{o.Tenant, o.User}
+	if s.overrides[sc] == nil {
+		s.overrides[sc] = make(map[string]Override)
+	}
+	s.overrides[sc][o.Key] = o
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, tenant, user, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.overrides[scope{tenant, user}][key]; !ok {
+		return errOverrideNotFound
+	}
+	delete(s.overrides[scope{tenant, user}], key)
+	return nil
+}
+
+func (s *MemoryStore) OfUser(ctx context.Context, user string) ([]Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Override{}
+	for sc, overrides := range s.overrides {
+		if sc.user != user {
+			continue
+		}
+		for _, o := range overrides {
+			list = append(list, o)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Tenant != list[j].Tenant {
+			return list[i].Tenant < list[j].Tenant
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteUser(ctx context.Context, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sc := range s.overrides {
+		if sc.user == user {
+			delete(s.overrides, sc)
+		}
+	}
+	return nil
+}
+
+// migrations create the setting_overrides table, the tenant's own overrides
+// having an empty user_id
+var migrations = []module.Migration{{
+	Name: "create_setting_overrides",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS setting_overrides (
+			tenant     TEXT NOT NULL,
+			user_id    TEXT NOT NULL,
+			name       TEXT NOT NULL,
+			value      TEXT NOT NULL,
+			updated_by TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (tenant, user_id, name)
+		)`,
+}}
+
+// SQLStore persists overrides in the setting_overrides table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) List(ctx context.Context, tenant, user string) ([]Override, error) {
+	return s.query(ctx, `
+		SELECT tenant, user_id, name, value, updated_by, updated_at FROM setting_overrides
+		WHERE tenant = $1 AND user_id = $2 ORDER BY name`, tenant, user)
+}
+
+func (s *SQLStore) OfUser(ctx context.Context, user string) ([]Override, error) {
+	return s.query(ctx, `
+		SELECT tenant, user_id, name, value, updated_by, updated_at FROM setting_overrides
+		WHERE user_id = $1 ORDER BY tenant, name`, user)
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) ([]Override, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Override{}
+	for rows.Next() {
+		var o Override
+		var value string
+		if err := rows.Scan(&o.Tenant, &o.User, &o.Key, &value, &o.UpdatedBy, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		o.Value = json.RawMessage(value)
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Set(ctx context.Context, o Override) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO setting_overrides (tenant, user_id, name, value, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, user_id, name) DO UPDATE SET
+			value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at`,
+		o.Tenant, o.User, o.Key, string(o.Value), o.UpdatedBy, o.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, tenant, user, key string) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		DELETE FROM setting_overrides WHERE tenant = $1 AND user_id = $2 AND name = $3`, tenant, user, key)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errOverrideNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteUser(ctx context.Context, user string) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM setting_overrides WHERE user_id = $1`, user)
+	return err
+}
@@ -0,0 +1,115 @@
+package privacy
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-api/pkg/retention"
+)
+
+// FileArchives stores export archives as zip files in a directory
+type FileArchives struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewFileArchives creates the archive directory if needed. Archives older than ttl
+// are removed by the retention purger.
+func NewFileArchives(dir string, ttl time.Duration) (*FileArchives, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileArchives{dir: dir, ttl: ttl}, nil
+}
+
+func (a *FileArchives) path(id string) string {
+	return filepath.Join(a.dir, filepath.Base(id)+".zip")
+}
+
+// partialFile only becomes visible under its final name once it's fully written
+type partialFile struct {
+	*os.File
+	final string
+}
+
+func (f *partialFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), f.final)
+}
+
+// Create returns a writer for an archive
+func (a *FileArchives) Create(id string) (io.WriteCloser, error) {
+	final := a.path(id)
+	f, err := os.OpenFile(final+".partial", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &partialFile{File: f, final: final}, nil
+}
+
+// Open returns a finished archive
+func (a *FileArchives) Open(id string) (*os.File, error) {
+	return os.Open(a.path(id))
+}
+
+// Delete removes an archive and any partial write of it
+func (a *FileArchives) Delete(id string) {
+	os.Remove(a.path(id))
+	os.Remove(a.path(id) + ".partial")
+}
+
+// RetentionPolicies removes archives once they can no longer be downloaded
+func (a *FileArchives) RetentionPolicies() []retention.Policy {
+	return []retention.Policy{{
+		Name:        "privacy_exports",
+		Description: "Expired personal data export archives",
+		MaxAge:      a.ttl,
+		Target:      a,
+	}}
+}
+
+func (a *FileArchives) expired(cutoff time.Time) ([]string, error) {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.Contains(e.Name(), ".zip") {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+			paths = append(paths, filepath.Join(a.dir, e.Name()))
+		}
+	}
+	return paths, nil
+}
+
+func (a *FileArchives) Count(ctx context.Context, cutoff time.Time) (int64, error) {
+	paths, err := a.expired(cutoff)
+	return int64(len(paths)), err
+}
+
+func (a *FileArchives) Purge(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	paths, err := a.expired(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, p := range paths {
+		if int(n) >= limit {
+			break
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
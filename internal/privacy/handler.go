@@ -0,0 +1,161 @@
+package privacy
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/render"
+	"go-api/pkg/routing"
+	"go-api/pkg/signedurl"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes self-service export and erasure endpoints and the admin audit trail
+type Handler struct {
+	service   *Service
+	links     *signedurl.Signer
+	expanders []render.Expander
+}
+
+// NewHandler creates a privacy handler. Completed exports get a download link signed
+// with links, if given, that works without the user's token, as sent by email. The
+// expanders let admins embed related resources, such as the requesting user, in the
+// audit trail.
+func NewHandler(service *Service, links *signedurl.Signer, expanders ...render.Expander) *Handler {
+	return &Handler{service: service, links: links, expanders: expanders}
+}
+
+// RegisterRoutes mounts the /me endpoints on a router group of signed-in users
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.POST("/me/data-export", h.requestExport)
+	rg.GET("/me/data-export/:id", h.get)
+	rg.GET("/me/data-export/:id/download", h.download)
+	rg.POST("/me/erasure", h.requestErasure)
+	rg.GET("/me/erasure/:id", h.get)
+}
+
+// RegisterAdminRoutes mounts the audit trail on an admin router group
+func (h *Handler) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/privacy/requests", routing.Query("userId", "expand", "fields"), render.Expand(h.expanders...),
+		render.Describe(render.Resource{Type: "privacy-requests"}), h.list)
+}
+
+func currentUser(c *gin.Context) (string, bool) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return "", false
+	}
+	return sub.ID, true
+}
+
+func (h *Handler) requestExport(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	req, err := h.service.Request(c.Request.Context(), userID, KindExport)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Location", "/me/data-export/"+req.ID)
+	c.JSON(http.StatusAccepted, req)
+}
+
+type erasureRequest struct {
+	Confirm bool `json:"confirm"`
+}
+
+func (h *Handler) requestErasure(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var body erasureRequest
+	if err := bind.JSON(c, &body); err != nil || !body.Confirm {
+		c.Error(apperrors.NewValidationError(`Erasure is irreversible, send {"confirm": true} to proceed`))
+		return
+	}
+
+	req, err := h.service.Request(c.Request.Context(), userID, KindErasure)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Location", "/me/erasure/"+req.ID)
+	c.JSON(http.StatusAccepted, req)
+}
+
+func (h *Handler) get(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	req, err := h.service.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if h.links != nil && req.Kind == KindExport && req.Status == StatusCompleted && req.ExpiresAt != nil {
+		if ttl := time.Until(*req.ExpiresAt); ttl > 0 {
+			link, err := h.links.Sign("/me/data-export/"+req.ID+"/download", authz.Subject{ID: userID}, ttl)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			req.DownloadURL = link
+		}
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+func (h *Handler) download(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	req, err := h.service.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if req.Kind != KindExport {
+		c.Error(errRequestNotFound)
+		return
+	}
+	if req.Status != StatusCompleted {
+		c.Error(errExportNotReady)
+		return
+	}
+	if req.ExpiresAt != nil && time.Now().After(*req.ExpiresAt) {
+		c.Error(apperrors.NewNotFoundError("Export has expired"))
+		return
+	}
+
+	f, err := h.service.archives.Open(req.ID)
+	if err != nil {
+		c.Error(apperrors.NewNotFoundError("Export has expired"))
+		return
+	}
+	defer f.Close()
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="data-export-`+req.ID+`.zip"`)
+	c.Header("Cache-Control", "private, no-store")
+	http.ServeContent(c.Writer, c.Request, "", *req.CompletedAt, f)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	list, err := h.service.store.List(c.Request.Context(), c.Query("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	render.JSON(c, http.StatusOK, gin.H{"data": list})
+}
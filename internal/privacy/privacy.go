@@ -0,0 +1,329 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/queue"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Job types run on the job queue
+const (
+	ExportJobType  = "privacy.export"
+	ErasureJobType = "privacy.erasure"
+)
+
+// PersonalDataProvider is implemented by every module that stores data about users.
+// Erasure must be idempotent, since a failed erasure is retried from the start of the
+// failed module.
+type PersonalDataProvider interface {
+	// Name identifies the module in archives and the audit trail
+	Name() string
+	// ExportPersonalData returns the user's data, written as JSON to the archive
+	ExportPersonalData(ctx context.Context, userID string) (any, error)
+	// ErasePersonalData deletes or anonymizes the user's data
+	ErasePersonalData(ctx context.Context, userID string) error
+}
+
+// Config holds data export and erasure configuration
+type Config struct {
+	ExportDir string        `yaml:"exportDir"` // Where export archives are written
+	ExportTTL time.Duration `yaml:"exportTTL"` // How long archives can be downloaded
+}
+
+// Kind of privacy request
+type Kind string
+
+const (
+	KindExport  Kind = "export"
+	KindErasure Kind = "erasure"
+)
+
+// Status of a privacy request
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// ModuleResult records what happened in one module, forming the audit trail
+type ModuleResult struct {
+	Module string    `json:"module"`
+	Status Status    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Request is a data export or erasure requested by a user
+type Request struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"userId"`
+	Kind        Kind           `json:"kind"`
+	Status      Status         `json:"status"`
+	Modules     []ModuleResult `json:"modules"`
+	Error       string         `json:"error,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time     `json:"expiresAt,omitempty"`   // When an export archive is deleted
+	DownloadURL string         `json:"downloadUrl,omitempty"` // Signed link to a completed export
+}
+
+// result returns the recorded result of a module
+func (r *Request) result(module string) (ModuleResult, bool) {
+	for _, m := range r.Modules {
+		if m.Module == module {
+			return m, true
+		}
+	}
+	return ModuleResult{}, false
+}
+
+// record adds or replaces the result of a module
+func (r *Request) record(res ModuleResult) {
+	for i, m := range r.Modules {
+		if m.Module == res.Module {
+			r.Modules[i] = res
+			return
+		}
+	}
+	r.Modules = append(r.Modules, res)
+}
+
+type requestJob struct {
+	RequestID string `json:"requestId"`
+}
+
+// Service runs exports and erasures across every registered provider
+type Service struct {
+	cfg       Config
+	store     Store
+	archives  *FileArchives
+	jobs      *queue.Manager
+	queueName string
+	providers map[string]PersonalDataProvider
+}
+
+// NewService creates the privacy service and registers its job handlers
+func NewService(cfg Config, store Store, archives *FileArchives, jobs *queue.Manager, queueName string) *Service {
+	if cfg.ExportTTL <= 0 {
+		cfg.ExportTTL = 7 * 24 * time.Hour
+	}
+	s := &Service{
+		cfg:       cfg,
+		store:     store,
+		archives:  archives,
+		jobs:      jobs,
+		queueName: queueName,
+		providers: make(map[string]PersonalDataProvider),
+	}
+	jobs.Register(ExportJobType, s.handleExport)
+	jobs.Register(ErasureJobType, s.handleErasure)
+	return s
+}
+
+// Register adds providers
+func (s *Service) Register(providers ...PersonalDataProvider) {
+	for _, p := range providers {
+		s.providers[p.Name()] = p
+	}
+}
+
+// RegisterFrom registers every value that implements PersonalDataProvider, so module
+// stores can be passed without knowing which of them hold personal data
+func (s *Service) RegisterFrom(values ...any) {
+	for _, v := range values {
+		if p, ok := v.(PersonalDataProvider); ok {
+			s.Register(p)
+		}
+	}
+}
+
+// sortedProviders returns providers in name order so archives and audit trails are stable
+func (s *Service) sortedProviders() []PersonalDataProvider {
+	list := make([]PersonalDataProvider, 0, len(s.providers))
+	for _, p := range s.providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// Request creates an export or erasure request and queues it
+func (s *Service) Request(ctx context.Context, userID string, kind Kind) (Request, error) {
+	now := time.Now().UTC()
+	req := Request{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Kind:      kind,
+		Status:    StatusPending,
+		Modules:   []ModuleResult{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.store.Save(ctx, req); err != nil {
+		return Request{}, err
+	}
+
+	jobType := ExportJobType
+	if kind == KindErasure {
+		jobType = ErasureJobType
+	}
+	if _, err := s.jobs.Enqueue(ctx, s.queueName, jobType, requestJob{RequestID: req.ID}); err != nil {
+		return Request{}, err
+	}
+	logger.Info("privacy request created", zap.String("id", req.ID), zap.String("kind", string(kind)), zap.String("userId", userID))
+	return req, nil
+}
+
+// Get returns a request of a user
+func (s *Service) Get(ctx context.Context, userID, id string) (Request, error) {
+	req, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Request{}, err
+	}
+	if req.UserID != userID {
+		return Request{}, errRequestNotFound
+	}
+	return req, nil
+}
+
+func (s *Service) load(ctx context.Context, job *queue.Job) (Request, error) {
+	var payload requestJob
+	if err := job.Decode(&payload); err != nil {
+		return Request{}, err
+	}
+	req, err := s.store.Get(ctx, payload.RequestID)
+	if err != nil {
+		return Request{}, err
+	}
+	req.Status = StatusRunning
+	req.UpdatedAt = time.Now().UTC()
+	return req, s.store.Save(ctx, req)
+}
+
+// finish records the outcome. A failure is returned so the queue retries the job.
+func (s *Service) finish(ctx context.Context, req Request, err error) error {
+	now := time.Now().UTC()
+	req.UpdatedAt = now
+	if err != nil {
+		req.Status = StatusFailed
+		req.Error = err.Error()
+	} else {
+		req.Status = StatusCompleted
+		req.Error = ""
+		req.CompletedAt = &now
+	}
+	if saveErr := s.store.Save(ctx, req); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+func (s *Service) handleExport(ctx context.Context, job *queue.Job) error {
+	req, err := s.load(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	w, err := s.archives.Create(req.ID)
+	if err != nil {
+		return s.finish(ctx, req, err)
+	}
+	archive := zip.NewWriter(w)
+
+	for _, p := range s.sortedProviders() {
+		res := ModuleResult{Module: p.Name(), Status: StatusCompleted}
+		if err := exportModule(ctx, archive, p, req.UserID); err != nil {
+			res.Status, res.Error = StatusFailed, err.Error()
+		}
+		res.At = time.Now().UTC()
+		req.record(res)
+		if res.Status == StatusFailed {
+			archive.Close()
+			w.Close()
+			s.archives.Delete(req.ID)
+			return s.finish(ctx, req, fmt.Errorf("export %s: %s", p.Name(), res.Error))
+		}
+	}
+
+	if err := writeJSON(archive, "manifest.json", req); err != nil {
+		w.Close()
+		return s.finish(ctx, req, err)
+	}
+	if err := archive.Close(); err != nil {
+		w.Close()
+		return s.finish(ctx, req, err)
+	}
+	if err := w.Close(); err != nil {
+		return s.finish(ctx, req, err)
+	}
+
+	expiresAt := time.Now().UTC().Add(s.cfg.ExportTTL)
+	req.ExpiresAt = &expiresAt
+	return s.finish(ctx, req, nil)
+}
+
+func exportModule(ctx context.Context, archive *zip.Writer, p PersonalDataProvider, userID string) error {
+	data, err := p.ExportPersonalData(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(archive, p.Name()+".json", data)
+}
+
+func writeJSON(archive *zip.Writer, name string, v any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (s *Service) handleErasure(ctx context.Context, job *queue.Job) error {
+	req, err := s.load(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range s.sortedProviders() {
+		// Modules erased by an earlier attempt are not erased again
+		if res, ok := req.result(p.Name()); ok && res.Status == StatusCompleted {
+			continue
+		}
+
+		res := ModuleResult{Module: p.Name(), Status: StatusCompleted}
+		if err := p.ErasePersonalData(ctx, req.UserID); err != nil {
+			res.Status, res.Error = StatusFailed, err.Error()
+		}
+		res.At = time.Now().UTC()
+		req.record(res)
+		logger.Info("erased personal data",
+			zap.String("request", req.ID), zap.String("module", p.Name()), zap.String("status", string(res.Status)))
+
+		if res.Status == StatusFailed {
+			return s.finish(ctx, req, fmt.Errorf("erase %s: %s", p.Name(), res.Error))
+		}
+		// Save progress after each module so the audit trail survives a crash
+		if err := s.store.Save(ctx, req); err != nil {
+			return err
+		}
+	}
+	return s.finish(ctx, req, nil)
+}
+
+var errExportNotReady = apperrors.NewConflictError("Export is not ready yet")
@@ -0,0 +1,146 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// Store persists privacy requests, which double as the audit trail of exports and erasures
+type Store interface {
+	Save(ctx context.Context, req Request) error
+	Get(ctx context.Context, id string) (Request, error)
+	// List returns the requests of a user, or every request when userID is empty
+	List(ctx context.Context, userID string) ([]Request, error)
+}
+
+var errRequestNotFound = apperrors.NewNotFoundError("Privacy request not found")
+
+// MemoryStore keeps privacy requests in memory, used when no database is configured
+type MemoryStore struct {
+	mu       sync.RWMutex
+	requests map[string]Request
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{requests: make(map[string]Request)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, req Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req.Modules = append([]ModuleResult(nil), req.Modules...)
+	s.requests[req.ID] = req
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Request, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	req, ok := s.requests[id]
+	if !ok {
+		return Request{}, errRequestNotFound
+	}
+	return req, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, userID string) ([]Request, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Request, 0, len(s.requests))
+	for _, req := range s.requests {
+		if userID == "" || req.UserID == userID {
+			list = append(list, req)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// SQLStore persists privacy requests in the privacy_requests table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the privacy_requests table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS privacy_requests (
+			id         TEXT PRIMARY KEY,
+			user_id    TEXT NOT NULL,
+			kind       TEXT NOT NULL,
+			status     TEXT NOT NULL,
+			data       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS privacy_requests_user ON privacy_requests (user_id, created_at)`)
+	return err
+}
+
+func (s *SQLStore) Save(ctx context.Context, req Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO privacy_requests (id, user_id, kind, status, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at`,
+		req.ID, req.UserID, string(req.Kind), string(req.Status), string(data), req.CreatedAt, req.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Request, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM privacy_requests WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Request{}, errRequestNotFound
+	}
+	if err != nil {
+		return Request{}, err
+	}
+	var req Request
+	return req, json.Unmarshal([]byte(data), &req)
+}
+
+func (s *SQLStore) List(ctx context.Context, userID string) ([]Request, error) {
+	query, args := `SELECT data FROM privacy_requests ORDER BY created_at DESC`, []any{}
+	if userID != "" {
+		query, args = `SELECT data FROM privacy_requests WHERE user_id = $1 ORDER BY created_at DESC`, []any{userID}
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Request
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var req Request
+		if err := json.Unmarshal([]byte(data), &req); err != nil {
+			return nil, err
+		}
+		list = append(list, req)
+	}
+	return list, rows.Err()
+}
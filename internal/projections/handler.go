@@ -0,0 +1,96 @@
+package projections
+
+import (
+	"context"
+	"net/http"
+
+	"go-api/internal/operations"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/projection"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RebuildOperation is the operation type of projection rebuilds
+const RebuildOperation = "projection.rebuild"
+
+// Handler exposes admin endpoints to monitor and rebuild projections and to
+// inspect the history of event-sourced streams
+type Handler struct {
+	runner     *projection.Runner
+	events     eventstore.Store
+	operations *operations.Manager
+}
+
+// NewHandler creates a projection handler and registers the rebuild operation, so
+// it must be created before the job queue starts
+func NewHandler(runner *projection.Runner, events eventstore.Store, ops *operations.Manager) *Handler {
+	h := &Handler{runner: runner, events: events, operations: ops}
+	ops.Register(RebuildOperation, h.runRebuild)
+	return h
+}
+
+type rebuildPayload struct {
+	Projection string `json:"projection"`
+}
+
+// RegisterRoutes mounts the projection endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/projections", h.list)
+	rg.POST("/projections/:name/rebuild", h.rebuild)
+	rg.GET("/streams/:id", h.stream)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.runner.Statuses()})
+}
+
+// rebuild runs as an operation since replaying a large log outlives the request
+func (h *Handler) rebuild(c *gin.Context) {
+	name := c.Param("name")
+	found := false
+	for _, s := range h.runner.Statuses() {
+		found = found || s.Name == name
+	}
+	if !found {
+		c.Error(apperrors.NewNotFoundError("Projection not found"))
+		return
+	}
+
+	op, err := h.operations.Start(c.Request.Context(), RebuildOperation, rebuildPayload{Projection: name})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.operations.Accepted(c, op)
+}
+
+func (h *Handler) runRebuild(ctx context.Context, task *operations.Task) (any, error) {
+	var payload rebuildPayload
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if err := h.runner.Rebuild(ctx, payload.Projection); err != nil {
+		return nil, err
+	}
+	for _, s := range h.runner.Statuses() {
+		if s.Name == payload.Projection {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+func (h *Handler) stream(c *gin.Context) {
+	events, err := h.events.Load(c.Request.Context(), c.Param("id"), 0)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if len(events) == 0 {
+		c.Error(apperrors.NewNotFoundError("Stream not found"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": events})
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"net/http"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for managing rate limit overrides
+type Handler struct {
+	store    Store
+	resolver *Resolver
+}
+
+// NewHandler creates a handler that invalidates resolver after every write
+func NewHandler(store Store, resolver *Resolver) *Handler {
+	return &Handler{store: store, resolver: resolver}
+}
+
+// RegisterRoutes mounts the override endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/rate-limits", h.list)
+	rg.PUT("/rate-limits", h.upsert)
+	rg.DELETE("/rate-limits/:id", h.delete)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	overrides, err := h.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": overrides})
+}
+
+func (h *Handler) upsert(c *gin.Context) {
+	var o Override
+	if err := bind.JSON(c, &o); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid rate limit override", err))
+		return
+	}
+
+	saved, err := h.store.Upsert(c.Request.Context(), o)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.resolver.Invalidate()
+
+	c.JSON(http.StatusOK, saved)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if err := h.store.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	h.resolver.Invalidate()
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope identifies what a limit override applies to
+type Scope string
+
+const (
+	ScopeAPIKey Scope = "api_key"
+	ScopeTenant Scope = "tenant"
+	ScopePlan   Scope = "plan"
+)
+
+// scopeOrder is the resolution order, most specific first
+var scopeOrder = []Scope{ScopeAPIKey, ScopeTenant, ScopePlan}
+
+// Override is a rate limit defined for a tenant, API key or plan, optionally
+// restricted to routes under RoutePrefix
+type Override struct {
+	ID                string    `json:"id"`
+	Scope             Scope     `json:"scope" binding:"required,oneof=api_key tenant plan"`
+	Subject           string    `json:"subject" binding:"required"` // ID of the API key, tenant or plan
+	RoutePrefix       string    `json:"routePrefix"`
+	RequestsPerSecond float64   `json:"requestsPerSecond" binding:"required,gt=0"`
+	Burst             int       `json:"burst" binding:"required,gt=0"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// Identity is who a request is being made on behalf of
+type Identity struct {
+	APIKey string // ID of the key, not its token
+	Tenant string
+	Plan   string
+}
+
+func (id Identity) subject(scope Scope) string {
+	switch scope {
+	case ScopeAPIKey:
+		return id.APIKey
+	case ScopeTenant:
+		return id.Tenant
+	default:
+		return id.Plan
+	}
+}
+
+// Store persists rate limit overrides
+type Store interface {
+	List(ctx context.Context) ([]Override, error)
+	Upsert(ctx context.Context, o Override) (Override, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Resolver answers override lookups from an in-memory snapshot of the store,
+// refreshed every TTL or immediately after Invalidate
+type Resolver struct {
+	store Store
+	ttl   time.Duration
+
+	mu        sync.RWMutex
+	byScope   map[Scope]map[string][]Override
+	loadedAt  time.Time
+	invalidAt time.Time
+}
+
+// NewResolver creates a resolver caching the store contents for ttl
+func NewResolver(store Store, ttl time.Duration) *Resolver {
+	return &Resolver{store: store, ttl: ttl}
+}
+
+// Invalidate marks the cached snapshot stale so the next lookup reloads from the store
+func (r *Resolver) Invalidate() {
+	r.mu.Lock()
+	r.invalidAt = time.Now()
+	r.loadedAt = time.Time{}
+	r.mu.Unlock()
+}
+
+// Resolve returns the most specific override for the identity and path.
+// API key overrides beat tenant overrides which beat plan overrides; within a
+// scope the longest matching route prefix wins.
+func (r *Resolver) Resolve(ctx context.Context, id Identity, path string) (Override, bool) {
+	byScope, _ := r.snapshot(ctx)
+
+	for _, scope := range scopeOrder {
+		subject := id.subject(scope)
+		if subject == "" {
+			continue
+		}
+		for _, o := range byScope[scope][subject] {
+			if strings.HasPrefix(path, o.RoutePrefix) {
+				return o, true
+			}
+		}
+	}
+	return Override{}, false
+}
+
+func (r *Resolver) snapshot(ctx context.Context) (map[Scope]map[string][]Override, error) {
+	r.mu.RLock()
+	byScope, loadedAt := r.byScope, r.loadedAt
+	r.mu.RUnlock()
+
+	if byScope != nil && time.Since(loadedAt) < r.ttl {
+		return byScope, nil
+	}
+
+	started := time.Now()
+	overrides, err := r.store.List(ctx)
+	if err != nil {
+		// Keep serving the stale snapshot rather than dropping every override
+		return byScope, err
+	}
+
+	byScope = make(map[Scope]map[string][]Override)
+	for _, o := range overrides {
+		if byScope[o.Scope] == nil {
+			byScope[o.Scope] = make(map[string][]Override)
+		}
+		byScope[o.Scope][o.Subject] = append(byScope[o.Scope][o.Subject], o)
+	}
+	for _, subjects := range byScope {
+		for _, list := range subjects {
+			sort.Slice(list, func(i, j int) bool {
+				return len(list[i].RoutePrefix) > len(list[j].RoutePrefix)
+			})
+		}
+	}
+
+	r.mu.Lock()
+	// Don't overwrite a newer invalidation with data loaded before it
+	if r.invalidAt.Before(started) {
+		r.byScope = byScope
+		r.loadedAt = started
+	}
+	r.mu.Unlock()
+
+	return byScope, nil
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps overrides in memory, used when no database is configured
+type MemoryStore struct {
+	mu        sync.RWMutex
+	overrides map[string]Override
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{overrides: make(map[string]Override)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Override, 0, len(s.overrides))
+	for _, o := range s.overrides {
+		list = append(list, o)
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) Upsert(ctx context.Context, o Override) (Override, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+	o.UpdatedAt = time.Now().UTC()
+	s.overrides[o.ID] = o
+	return o, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.overrides[id]; !ok {
+		return apperrors.NewNotFoundError("Rate limit override not found")
+	}
+	delete(s.overrides, id)
+	return nil
+}
+
+// SQLStore persists overrides in the rate_limit_overrides table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the overrides table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS rate_limit_overrides (
+			id                  TEXT PRIMARY KEY,
+			scope               TEXT NOT NULL,
+			subject             TEXT NOT NULL,
+			route_prefix        TEXT NOT NULL DEFAULT '',
+			requests_per_second DOUBLE PRECISION NOT NULL,
+			burst               INTEGER NOT NULL,
+			updated_at          TIMESTAMP NOT NULL,
+			UNIQUE (scope, subject, route_prefix)
+		)`)
+	return err
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Override, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, scope, subject, route_prefix, requests_per_second, burst, updated_at
+		FROM rate_limit_overrides`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Override
+	for rows.Next() {
+		var o Override
+		if err := rows.Scan(&o.ID, &o.Scope, &o.Subject, &o.RoutePrefix, &o.RequestsPerSecond, &o.Burst, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Upsert(ctx context.Context, o Override) (Override, error) {
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+	o.UpdatedAt = time.Now().UTC()
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_overrides (id, scope, subject, route_prefix, requests_per_second, burst, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (scope, subject, route_prefix) DO UPDATE SET
+			requests_per_second = EXCLUDED.requests_per_second,
+			burst = EXCLUDED.burst,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id`,
+		o.ID, o.Scope, o.Subject, o.RoutePrefix, o.RequestsPerSecond, o.Burst, o.UpdatedAt,
+	).Scan(&o.ID)
+	return o, err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_overrides WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return apperrors.NewNotFoundError("Rate limit override not found")
+	}
+	return nil
+}
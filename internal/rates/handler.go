@@ -0,0 +1,137 @@
+package rates
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/fx"
+	"go-api/pkg/money"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes mounts the latest rates, conversion and past snapshots
+func (m *ratesModule) Routes(api *apiversion.Group) {
+	tags := []string{"rates"}
+	api.GET("/rates", apiversion.Operation{
+		ID:      "getRates",
+		Summary: "Get the latest exchange rates",
+		Description: "Returns the latest snapshot of rates fetched from " + m.provider() + ", against ?base= if given. " +
+			"The units of each currency one unit of the base buys are decimals, to keep their precision.",
+		Tags:     tags,
+		Response: fx.Snapshot{},
+	}, m.latestRates)
+	api.GET("/rates/convert", apiversion.Operation{
+		ID:      "convertMoney",
+		Summary: "Convert an amount between currencies",
+		Description: "Converts ?amount= of ?from= to ?to= at the latest rates, rounding half to even to the minor units of ?to=. " +
+			"The conversion is stamped with the rate and the ID of the snapshot used, for storing along the amount.",
+		Tags:        tags,
+		Idempotency: retrysafe.Safe,
+		Response:    fx.Conversion{},
+	}, m.convert)
+	api.GET("/rates/snapshots/:id", apiversion.Operation{
+		ID:          "getRateSnapshot",
+		Summary:     "Get a snapshot of exchange rates",
+		Description: "Returns the rates of a past snapshot, as stamped on a conversion, for checking or redoing it.",
+		Tags:        tags,
+		Response:    fx.Snapshot{},
+	}, m.snapshot)
+}
+
+func (m *ratesModule) provider() string {
+	if m.cfg.Provider == "" {
+		return "ecb"
+	}
+	return m.cfg.Provider
+}
+
+type ratesQuery struct {
+	Base string `form:"base"`
+}
+
+type convertQuery struct {
+	Amount string `form:"amount" binding:"required"`
+	From   string `form:"from" binding:"required"`
+	To     string `form:"to" binding:"required"`
+}
+
+func (m *ratesModule) latestRates(c *gin.Context) {
+	if !authenticated(c) {
+		return
+	}
+	var query ratesQuery
+	if err := bind.Query(c, &query); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid query", err))
+		return
+	}
+	s, err := m.Latest(c.Request.Context())
+	if err != nil {
+		c.Error(unavailable(err))
+		return
+	}
+	if s, err = s.Rebase(query.Base); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (m *ratesModule) convert(c *gin.Context) {
+	if !authenticated(c) {
+		return
+	}
+	var query convertQuery
+	if err := bind.Query(c, &query); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid query", err))
+		return
+	}
+	amount, err := money.Parse(query.Amount, strings.ToUpper(query.From))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	conversion, err := m.Convert(c.Request.Context(), amount, query.To)
+	if err != nil {
+		c.Error(unavailable(err))
+		return
+	}
+	c.JSON(http.StatusOK, conversion)
+}
+
+func (m *ratesModule) snapshot(c *gin.Context) {
+	if !authenticated(c) {
+		return
+	}
+	s, err := m.Snapshot(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func authenticated(c *gin.Context) bool {
+	if sub, ok := authz.SubjectFromContext(c.Request.Context()); !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return false
+	}
+	return true
+}
+
+// unavailable reports rates not fetched yet, as when the provider is down since
+// the first start, as an internal error with a message clients can show
+func unavailable(err error) error {
+	if errors.Is(err, fx.ErrNoRates) {
+		appErr := apperrors.Wrap(err, apperrors.CodeInternal)
+		appErr.Message = "Exchange rates are not available yet"
+		return appErr
+	}
+	return err
+}
@@ -0,0 +1,256 @@
+// Package rates is the feature module keeping exchange rates for the modules
+// handling money. It fetches the rates of the configured provider on a cron
+// schedule and keeps every distinct snapshot, so conversions stamped with one
+// can be checked later; the latest is held in memory for converting, and past
+// ones are cached once read. Modules implementing fx.Consumer are handed the
+// module as their fx.Converter.
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/cache"
+	"go-api/pkg/cron"
+	"go-api/pkg/fx"
+	"go-api/pkg/logger"
+	"go-api/pkg/money"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Config holds exchange rate configuration
+type Config struct {
+	Provider string            `yaml:"provider"` // ecb, openexchangerates or static
+	URL      string            `yaml:"url"`      // Of the provider's endpoint, for mirrors and tests
+	AppID    string            `yaml:"appId"`    // Of openexchangerates
+	Base     string            `yaml:"base"`     // Of openexchangerates, which only paid plans change from USD; of static
+	Static   map[string]string `yaml:"static"`   // Rates of static, against Base
+	Schedule string            `yaml:"schedule"` // Cron expression of the refreshes, in UTC
+	// MaxAge is how old the latest rates may be before the health check fails
+	MaxAge   time.Duration `yaml:"maxAge"`
+	CacheTTL time.Duration `yaml:"cacheTTL"` // Of the past snapshots read
+	Timeout  time.Duration `yaml:"timeout"`  // Of a fetch
+	Store    string        `yaml:"store"`    // memory or sql; the database by default
+}
+
+var (
+	refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fx_rate_refreshes_total",
+		Help: "Fetches of exchange rates, by result: new, unchanged or error.",
+	}, []string{"result"})
+	ratesAsOf = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fx_rates_as_of_timestamp_seconds",
+		Help: "When the latest exchange rates were published, as a Unix time.",
+	})
+)
+
+type ratesModule struct {
+	module.Base
+	cfg      Config
+	backend  string
+	source   fx.Source
+	schedule *cron.Schedule
+	store    Store
+	cache    cache.Cache
+
+	mu     sync.RWMutex
+	latest *fx.Snapshot // Nil until loaded or fetched
+}
+
+// New returns the factory of the rates module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if cfg.Schedule == "" {
+			cfg.Schedule = "0 * * * *"
+		}
+		if cfg.MaxAge <= 0 {
+			cfg.MaxAge = 96 * time.Hour
+		}
+		if cfg.CacheTTL <= 0 {
+			cfg.CacheTTL = time.Hour
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = 10 * time.Second
+		}
+		schedule, err := cron.Parse(cfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("rates: %w", err)
+		}
+		client := &http.Client{Timeout: cfg.Timeout}
+		var source fx.Source
+		switch cfg.Provider {
+		case "", "ecb":
+			source = &fx.ECB{URL: cfg.URL, Client: client}
+		case "openexchangerates":
+			if cfg.AppID == "" {
+				return nil, fmt.Errorf("rates: openexchangerates needs an app ID")
+			}
+			source = &fx.OpenExchangeRates{AppID: cfg.AppID, Base: cfg.Base, URL: cfg.URL, Client: client}
+		case "static":
+			if cfg.Base == "" || len(cfg.Static) == 0 {
+				return nil, fmt.Errorf("rates: static rates need a base and rates")
+			}
+			source = fx.NewStatic(cfg.Base, cfg.Static)
+		default:
+			return nil, fmt.Errorf("rates: unknown provider %q, want ecb, openexchangerates or static", cfg.Provider)
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("rates: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("rates: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &ratesModule{cfg: cfg, backend: backend, source: source, schedule: schedule, store: store, cache: deps.Cache}, nil
+	}
+}
+
+func (m *ratesModule) Name() string { return "rates" }
+
+func (m *ratesModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// HealthChecks fail once the latest rates are older than MaxAge, as when the
+// provider can't be reached for long
+func (m *ratesModule) HealthChecks() []module.HealthCheck {
+	return []module.HealthCheck{{Name: "rates", Check: func(ctx context.Context) error {
+		s, err := m.Latest(ctx)
+		if err != nil {
+			return err
+		}
+		if age := time.Since(s.AsOf); age > m.cfg.MaxAge {
+			return fmt.Errorf("rates: latest are of %s, %s old", s.AsOf.Format(time.RFC3339), age.Round(time.Minute))
+		}
+		return nil
+	}}}
+}
+
+// Run refreshes the rates on the schedule until ctx is cancelled. The latest
+// stored are loaded first, and fetched again at once when a refresh was due
+// since. A failed refresh is retried a minute later, or at the next one.
+func (m *ratesModule) Run(ctx context.Context) {
+	next := time.Now()
+	if s, err := m.store.Latest(ctx); err == nil {
+		m.setLatest(s)
+		next = m.schedule.Next(s.FetchedAt)
+	} else if !errors.Is(err, fx.ErrNoRates) {
+		logger.Error("failed to load exchange rates", zap.Error(err))
+	}
+	for {
+		if wait := time.Until(next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		now := time.Now()
+		next = m.schedule.Next(now)
+		if err := m.refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("failed to refresh exchange rates", zap.String("provider", m.cfg.Provider), zap.Error(err))
+			next = minTime(next, now.Add(time.Minute))
+		}
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// refresh fetches the rates and keeps them when they are new
+func (m *ratesModule) refresh(ctx context.Context) error {
+	s, err := m.source.Fetch(ctx)
+	if err != nil {
+		refreshes.WithLabelValues("error").Inc()
+		return err
+	}
+	if latest, err := m.Latest(ctx); err == nil && latest.ID == s.ID {
+		refreshes.WithLabelValues("unchanged").Inc()
+		return nil
+	}
+	if err := m.store.Save(ctx, s); err != nil {
+		refreshes.WithLabelValues("error").Inc()
+		return err
+	}
+	refreshes.WithLabelValues("new").Inc()
+	// Another instance may have stored them first, or newer ones
+	if stored, err := m.store.Latest(ctx); err == nil {
+		s = stored
+	}
+	m.setLatest(s)
+	return nil
+}
+
+func (m *ratesModule) setLatest(s fx.Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latest = &s
+	ratesAsOf.Set(float64(s.AsOf.Unix()))
+}
+
+// Latest returns the latest rates, from memory
+func (m *ratesModule) Latest(ctx context.Context) (fx.Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.latest == nil {
+		return fx.Snapshot{}, fx.ErrNoRates
+	}
+	return *m.latest, nil
+}
+
+// Snapshot returns the rates of a snapshot, cached once read
+func (m *ratesModule) Snapshot(ctx context.Context, id string) (fx.Snapshot, error) {
+	if latest, err := m.Latest(ctx); err == nil && latest.ID == id {
+		return latest, nil
+	}
+	key := "rates:snapshot:" + id
+	if raw, ok, err := m.cache.Get(ctx, key); err == nil && ok {
+		var cached fx.Snapshot
+		if json.Unmarshal(raw, &cached) == nil {
+			return cached, nil
+		}
+	}
+	s, err := m.store.Get(ctx, id)
+	if err != nil {
+		return fx.Snapshot{}, err
+	}
+	if raw, err := json.Marshal(s); err == nil {
+		m.cache.Set(ctx, key, raw, m.cfg.CacheTTL)
+	}
+	return s, nil
+}
+
+// Convert converts an amount at the latest rates
+func (m *ratesModule) Convert(ctx context.Context, amount money.Money, to string) (fx.Conversion, error) {
+	s, err := m.Latest(ctx)
+	if err != nil {
+		return fx.Conversion{}, err
+	}
+	return s.Convert(amount, strings.ToUpper(to))
+}
@@ -0,0 +1,134 @@
+package rates
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/pkg/fx"
+)
+
+// Store persists the snapshots of rates
+type Store interface {
+	// Save adds a snapshot, keeping the one already stored with its ID
+	Save(ctx context.Context, s fx.Snapshot) error
+	// Get returns a snapshot, failing with fx.ErrSnapshotNotFound
+	Get(ctx context.Context, id string) (fx.Snapshot, error)
+	// Latest returns the snapshot published last, failing with fx.ErrNoRates
+	Latest(ctx context.Context) (fx.Snapshot, error)
+}
+
+// MemoryStore keeps snapshots in memory, used when no database is configured
+type MemoryStore struct {
+	mu        sync.RWMutex
+	snapshots map[string]fx.Snapshot
+	latest    string
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{snapshots: make(map[string]fx.Snapshot)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, snap fx.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.snapshots[snap.ID]; ok {
+		return nil
+	}
+	s.snapshots[snap.ID] = snap
+	if latest, ok := s.snapshots[s.latest]; !ok || !snap.AsOf.Before(latest.AsOf) {
+		s.latest = snap.ID
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (fx.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap, ok := s.snapshots[id]
+	if !ok {
+		return fx.Snapshot{}, fx.ErrSnapshotNotFound
+	}
+	return snap, nil
+}
+
+func (s *MemoryStore) Latest(ctx context.Context) (fx.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap, ok := s.snapshots[s.latest]
+	if !ok {
+		return fx.Snapshot{}, fx.ErrNoRates
+	}
+	return snap, nil
+}
+
+// migrations create the rate_snapshots table, the rates of each as JSON
+var migrations = []module.Migration{{
+	Name: "create_rate_snapshots",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS rate_snapshots (
+			id         TEXT PRIMARY KEY,
+			source     TEXT NOT NULL,
+			base       TEXT NOT NULL,
+			rates      TEXT NOT NULL,
+			as_of      TIMESTAMP NOT NULL,
+			fetched_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS rate_snapshots_as_of_idx ON rate_snapshots (as_of, fetched_at)`,
+}}
+
+// SQLStore persists snapshots in the rate_snapshots table. Rates are the same
+// for every tenant, so it always uses the shared database.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Save(ctx context.Context, snap fx.Snapshot) error {
+	rates, err := json.Marshal(snap.Rates)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO rate_snapshots (id, source, base, rates, as_of, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING`,
+		snap.ID, snap.Source, snap.Base, string(rates), snap.AsOf, snap.FetchedAt)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (fx.Snapshot, error) {
+	snap, err := s.scan(s.db.QueryRowContext(ctx, `
+		SELECT id, source, base, rates, as_of, fetched_at FROM rate_snapshots WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fx.Snapshot{}, fx.ErrSnapshotNotFound
+	}
+	return snap, err
+}
+
+func (s *SQLStore) Latest(ctx context.Context) (fx.Snapshot, error) {
+	snap, err := s.scan(s.db.QueryRowContext(ctx, `
+		SELECT id, source, base, rates, as_of, fetched_at FROM rate_snapshots
+		ORDER BY as_of DESC, fetched_at DESC LIMIT 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fx.Snapshot{}, fx.ErrNoRates
+	}
+	return snap, err
+}
+
+func (s *SQLStore) scan(row *sql.Row) (fx.Snapshot, error) {
+	var snap fx.Snapshot
+	var rates string
+	if err := row.Scan(&snap.ID, &snap.Source, &snap.Base, &rates, &snap.AsOf, &snap.FetchedAt); err != nil {
+		return fx.Snapshot{}, err
+	}
+	return snap, json.Unmarshal([]byte(rates), &snap.Rates)
+}
@@ -0,0 +1,430 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/jwks"
+	"go-api/pkg/logger"
+	"go-api/pkg/presence"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	maxMessage = 64 << 10 // Largest client message, in bytes
+)
+
+// subscription is a topic a connection follows
+type subscription struct {
+	id       string
+	topic    Topic
+	filter   map[string]any
+	position int64 // Of the last event considered, so none is sent twice
+}
+
+// conn is a client connection. Its loop owns the subscriptions and is the only
+// writer; the hub only queues the events of the types it wants.
+type conn struct {
+	id   string
+	hub  *Hub
+	ws   *websocket.Conn
+	base context.Context // Of the upgraded request, without its cancellation
+	ctx  context.Context // base with the subject, once authenticated
+
+	subs     map[string]*subscription
+	rooms    map[string]presence.Room // Joined, by name
+	messages chan ClientMessage
+	live     chan eventstore.Event
+	expiry   *time.Timer // Of the token the connection is authenticated with
+	expired  <-chan time.Time
+
+	mu    sync.RWMutex
+	types map[string]int // Subscriptions by event type
+
+	once        sync.Once
+	done        chan struct{}
+	closeCode   int // Sent to the client on shutdown, unless 0
+	closeReason string
+}
+
+func newConn(h *Hub, ws *websocket.Conn, ctx context.Context) *conn {
+	c := &conn{
+		id:       uuid.NewString(),
+		hub:      h,
+		ws:       ws,
+		base:     context.WithoutCancel(ctx),
+		subs:     make(map[string]*subscription),
+		rooms:    make(map[string]presence.Room),
+		messages: make(chan ClientMessage),
+		live:     make(chan eventstore.Event, h.cfg.Buffer),
+		types:    make(map[string]int),
+		done:     make(chan struct{}),
+	}
+	c.ctx = c.base
+	// Authenticated by a bearer token on the upgrade request
+	if token, ok := ctx.Value("user").(*jwt.Token); ok {
+		if sub, ok := authz.SubjectFromContext(ctx); ok {
+			c.authenticated(sub, token)
+		}
+	}
+	return c
+}
+
+// wants reports whether the connection subscribes to events of type t
+func (c *conn) wants(t string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.types[t] > 0
+}
+
+// push queues an event without waiting, closing the connection when its queue is
+// full so one slow client can't hold up the others
+func (c *conn) push(e eventstore.Event) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	select {
+	case c.live <- e:
+	default:
+		slowDropped.Inc()
+		c.close(websocket.CloseTryAgainLater, "Not reading events fast enough")
+	}
+}
+
+// shutdown closes the connection as the server goes away
+func (c *conn) shutdown() {
+	c.close(websocket.CloseGoingAway, "Server shutting down")
+}
+
+// close ends the loop, which sends the client code and reason unless code is 0
+func (c *conn) close(code int, reason string) {
+	c.once.Do(func() {
+		c.closeCode, c.closeReason = code, reason
+		close(c.done)
+	})
+}
+
+// run serves the connection until it's closed
+func (c *conn) run() {
+	defer c.ws.Close()
+	defer func() {
+		if c.expiry != nil {
+			c.expiry.Stop()
+		}
+	}()
+	defer c.leaveAll()
+	go c.read()
+
+	ping := time.NewTicker(c.hub.cfg.PingInterval)
+	defer ping.Stop()
+	heartbeats, stop := c.heartbeats()
+	defer stop()
+	for {
+		var err error
+		select {
+		case <-c.done:
+			if c.closeCode != 0 {
+				_ = c.ws.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(c.closeCode, c.closeReason), time.Now().Add(writeWait))
+			}
+			return
+		case m := <-c.messages:
+			err = c.handle(m)
+		case e := <-c.live:
+			for _, sub := range c.subs {
+				if err = c.deliver(sub, e); err != nil {
+					break
+				}
+			}
+		case <-ping.C:
+			err = c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		case <-heartbeats:
+			c.heartbeat()
+		case <-c.expired:
+			c.close(websocket.ClosePolicyViolation, "Token expired")
+		}
+		if err != nil {
+			c.close(0, "")
+		}
+	}
+}
+
+// read hands the client's messages to the loop. Messages that aren't JSON are
+// handed as ones without a type, which are refused.
+func (c *conn) read() {
+	defer c.close(0, "")
+	c.ws.SetReadLimit(maxMessage)
+	alive := func() {
+		_ = c.ws.SetReadDeadline(time.Now().Add(2*c.hub.cfg.PingInterval + writeWait))
+	}
+	alive()
+	c.ws.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		alive()
+		var m ClientMessage
+		if json.Unmarshal(data, &m) != nil {
+			m = ClientMessage{}
+		}
+		select {
+		case c.messages <- m:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *conn) handle(m ClientMessage) error {
+	var reply ServerMessage
+	var err error
+	switch m.Type {
+	case TypeAuth:
+		reply, err = c.authenticate(m)
+	case TypeSubscribe:
+		return c.subscribe(m)
+	case TypeUnsubscribe:
+		reply, err = c.unsubscribe(m)
+	case TypeJoin:
+		reply, err = c.join(m)
+	case TypeLeave:
+		reply, err = c.leave(m)
+	case TypePing:
+		reply = ServerMessage{Type: TypePong, ID: m.ID}
+	default:
+		err = apperrors.NewValidationError("Invalid message", apperrors.FieldError{
+			Pointer: "/type", Field: "type", Rule: "oneof", Param: "auth subscribe unsubscribe join leave ping",
+			Message: "must be a JSON object whose type is auth, subscribe, unsubscribe, join, leave or ping",
+		})
+	}
+	if err != nil {
+		return c.refuse(m.ID, err)
+	}
+	return c.write(reply)
+}
+
+// authenticate authenticates the connection with a token, or renews it before the
+// token it's authenticated with expires
+func (c *conn) authenticate(m ClientMessage) (ServerMessage, error) {
+	token, err := c.hub.keys.Parse(m.Token)
+	if err != nil || !token.Valid || jwks.IsAccessToken(token) {
+		return ServerMessage{}, apperrors.NewUnauthorizedError("Invalid token")
+	}
+	sub, ok := authz.SubjectOfToken(token)
+	if !ok || sub.ID == "" {
+		return ServerMessage{}, apperrors.NewUnauthorizedError("Invalid token")
+	}
+	if current, ok := authz.SubjectFromContext(c.ctx); ok && current.ID != sub.ID {
+		return ServerMessage{}, apperrors.NewForbiddenError("Connection is authenticated as another subject")
+	}
+	c.authenticated(sub, token)
+	return ServerMessage{Type: TypeAuthenticated, ID: m.ID}, nil
+}
+
+// authenticated sets the subject of the connection, closing it when its token expires
+func (c *conn) authenticated(sub authz.Subject, token *jwt.Token) {
+	c.ctx = authz.WithSubject(c.base, sub)
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return
+	}
+	if c.expiry != nil {
+		c.expiry.Stop()
+	}
+	c.expiry = time.NewTimer(time.Until(exp.Time))
+	c.expired = c.expiry.C
+}
+
+func (c *conn) subscribe(m ClientMessage) error {
+	sub, err := c.newSubscription(m)
+	if err != nil {
+		return c.refuse(m.ID, err)
+	}
+	// Under the hub's lock, so each event is either queued or before cursor
+	c.hub.mu.RLock()
+	c.watch(sub.topic.Events, 1)
+	cursor := c.hub.position.Load()
+	c.hub.mu.RUnlock()
+
+	sub.position = cursor
+	if m.After != nil {
+		sub.position = *m.After
+	}
+	c.subs[sub.id] = sub
+	if err := c.write(ServerMessage{Type: TypeSubscribed, ID: sub.id, Topic: sub.topic.Name}); err != nil {
+		return err
+	}
+	if m.After == nil {
+		return nil
+	}
+	return c.replay(sub, cursor)
+}
+
+// newSubscription checks a subscribe message
+func (c *conn) newSubscription(m ClientMessage) (*subscription, error) {
+	subject, ok := authz.SubjectFromContext(c.ctx)
+	if !ok {
+		return nil, apperrors.NewUnauthorizedError("Authentication required, connect with a bearer token or send an auth message")
+	}
+	if m.ID == "" {
+		return nil, apperrors.NewValidationError("Invalid subscription", apperrors.FieldError{
+			Pointer: "/id", Field: "id", Rule: "required", Message: "is required",
+		})
+	}
+	if _, ok := c.subs[m.ID]; ok {
+		return nil, apperrors.NewConflictError("Subscription " + m.ID + " already exists")
+	}
+	topic, ok := c.hub.topics[m.Topic]
+	if !ok {
+		return nil, apperrors.NewNotFoundError("Topic not found")
+	}
+	if len(c.subs) >= c.hub.cfg.MaxSubscriptions {
+		return nil, apperrors.NewTooManyRequestsError(
+			"Connections subscribe to at most " + strconv.Itoa(c.hub.cfg.MaxSubscriptions) + " topics")
+	}
+	if m.After != nil {
+		if *m.After < 0 {
+			return nil, apperrors.NewValidationError("Invalid subscription", apperrors.FieldError{
+				Pointer: "/after", Field: "after", Rule: "min", Param: "0", Message: "must be 0 or more",
+			})
+		}
+		if c.hub.position.Load()-*m.After > int64(c.hub.cfg.ReplayLimit) {
+			return nil, apperrors.NewGoneError("Too many events since after to resume, subscribe without it")
+		}
+	}
+	// Events are authorized one by one; this checks the subject may read any
+	if err := authz.Authorize(c.ctx, "read", authz.Resource{Type: topic.Resource, Tenant: subject.Tenant}); err != nil {
+		return nil, err
+	}
+	return &subscription{id: m.ID, topic: topic, filter: m.Filter}, nil
+}
+
+// replay sends the events of a resumed subscription up to cursor, after which
+// live ones take over
+func (c *conn) replay(sub *subscription, cursor int64) error {
+	defer func() { sub.position = max(sub.position, cursor) }()
+	for sub.position < cursor {
+		events, err := c.hub.events.ReadAll(c.base, sub.position, readBatch)
+		if err != nil {
+			return c.refuse(sub.id, err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		for _, e := range events {
+			if e.Position > cursor {
+				return nil
+			}
+			if err := c.deliver(sub, e); err != nil {
+				return err
+			}
+			sub.position = e.Position
+		}
+	}
+	return nil
+}
+
+func (c *conn) unsubscribe(m ClientMessage) (ServerMessage, error) {
+	sub, ok := c.subs[m.ID]
+	if !ok {
+		return ServerMessage{}, apperrors.NewNotFoundError("Subscription not found")
+	}
+	delete(c.subs, m.ID)
+	c.watch(sub.topic.Events, -1)
+	return ServerMessage{Type: TypeUnsubscribed, ID: m.ID}, nil
+}
+
+// watch counts delta more subscriptions to the event types
+func (c *conn) watch(types []string, delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range types {
+		if c.types[t] += delta; c.types[t] <= 0 {
+			delete(c.types, t)
+		}
+	}
+}
+
+// deliver sends an event to a subscription it's new to, when it matches the
+// filter and the subject may read the resource it's about
+func (c *conn) deliver(sub *subscription, e eventstore.Event) error {
+	if e.Position <= sub.position || !slices.Contains(sub.topic.Events, e.Type) {
+		return nil
+	}
+	sub.position = e.Position
+	var data map[string]any
+	if e.Decode(&data) != nil {
+		return nil // Not an object, so nothing to authorize it with
+	}
+	for field, want := range sub.filter {
+		if !reflect.DeepEqual(data[field], want) {
+			return nil
+		}
+	}
+	allowed, err := authz.Can(c.ctx, "read", sub.topic.About(data))
+	if err != nil {
+		logger.Error("failed to authorize realtime event", zap.String("topic", sub.topic.Name), zap.Error(err))
+		return nil
+	}
+	if !allowed {
+		return nil
+	}
+	eventsSent.WithLabelValues(sub.topic.Name).Inc()
+	return c.write(ServerMessage{Type: TypeEvent, ID: sub.id, Topic: sub.topic.Name, Event: &e})
+}
+
+// refuse reports an error to the client, logging internal ones
+func (c *conn) refuse(id string, err error) error {
+	msg := errorMessage(id, err)
+	if msg.Error.Code == apperrors.CodeInternal {
+		logger.Error("realtime message failed", zap.String("id", id), zap.Error(err))
+	}
+	return c.write(msg)
+}
+
+func (c *conn) write(m ServerMessage) error {
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.ws.WriteJSON(m)
+}
+
+// checkOrigin allows the configured origins, and requests without one as they
+// don't come from browsers. Without origins, the upgrader allows the API's own.
+func checkOrigin(origins []string) func(r *http.Request) bool {
+	if len(origins) == 0 {
+		return nil
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, o := range origins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
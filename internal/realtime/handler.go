@@ -0,0 +1,43 @@
+package realtime
+
+import (
+	"go-api/internal/apiversion"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes mounts the WebSocket endpoint clients follow events on
+func (h *Hub) Routes(api *apiversion.Group) {
+	api.GET("/realtime", apiversion.Operation{
+		ID:      "followEvents",
+		Summary: "Follow domain events",
+		Description: "A WebSocket exchanging JSON text messages. Clients authenticate with a bearer token on the " +
+			"upgrade request or an auth message, then subscribe to topics with an ID of their choosing, optionally " +
+			"filtered on top-level fields of the event data and resuming after the position of the last event " +
+			"they saw. Each event is only sent to subscribers allowed to read the resource it's about. The " +
+			"connection closes when its token expires, unless renewed with another auth message. When presence is " +
+			"tracked, clients join rooms to be listed among their members until they leave them or disconnect.",
+		Tags: []string{"realtime"},
+		Events: []apiversion.Event{
+			{Name: "clientMessage", Summary: "Sent by clients to authenticate, subscribe, unsubscribe or ping", Data: ClientMessage{}},
+			{Name: "serverMessage", Summary: "An event of a subscription, or the reply to a client message", Data: ServerMessage{}},
+		},
+	}, h.serve)
+	if h.presence != nil {
+		h.presenceRoutes(api)
+	}
+	if h.locks != nil {
+		h.lockRoutes(api)
+	}
+}
+
+func (h *Hub) serve(c *gin.Context) {
+	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // The upgrader replied with the error
+	}
+	conn := newConn(h, ws, c.Request.Context())
+	h.add(conn)
+	defer h.remove(conn)
+	conn.run()
+}
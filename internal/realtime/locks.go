@@ -0,0 +1,198 @@
+package realtime
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	"go-api/pkg/editlock"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocksTopic carries the acquiring, releasing and expiry of editing locks
+const LocksTopic = "locks"
+
+// LockTokenHeader carries the token a lock was acquired with, proving its holder
+const LockTokenHeader = "Lock-Token"
+
+// TrackLocks serves the editing locks of manager, and the locks topic clients
+// subscribe to for knowing what others are editing
+func (h *Hub) TrackLocks(manager *editlock.Manager) {
+	h.locks = manager
+	// Subscribing needs access to locks, and each event access to the locked resource
+	h.Register(Topic{Name: LocksTopic, Events: []string{editlock.EventAcquired, editlock.EventReleased, editlock.EventExpired},
+		Resource: "lock", TypeField: "resourceType", IDField: "resourceId", Tenant: "tenant"})
+}
+
+// lockRoutes mounts the editing lock endpoints
+func (h *Hub) lockRoutes(api *apiversion.Group) {
+	tags := []string{"realtime"}
+	api.GET("/locks/:type/:id", apiversion.Operation{
+		ID:          "getLock",
+		Summary:     "Tell who is editing a resource",
+		Description: "Returns the editing lock on a resource, or 404 when it isn't locked. Its token is only shown to its holder.",
+		Tags:        tags,
+		Response:    editlock.Lock{},
+	}, h.getLock)
+	api.PUT("/locks/:type/:id", apiversion.Operation{
+		ID:      "acquireLock",
+		Summary: "Lock a resource for editing",
+		Description: "Locks a resource for the caller for ttl seconds, 201 when it wasn't locked. Locking it again " +
+			"renews the caller's lock; a lock held by another user is 409 with its holder. Locks are advisory: " +
+			"they tell client UIs who is editing, and don't stop anyone from writing.",
+		Tags:        tags,
+		Idempotency: retrysafe.Idempotent, // Locking again renews the same lock
+		Request:     lockRequest{},
+		Response:    editlock.Lock{},
+	}, h.acquireLock)
+	api.POST("/locks/:type/:id/renew", apiversion.Operation{
+		ID:          "renewLock",
+		Summary:     "Renew an editing lock",
+		Description: "Extends the lock held with the token in the Lock-Token header by ttl seconds. Holders renew well before it expires while editing.",
+		Tags:        tags,
+		Idempotency: retrysafe.Idempotent,
+		Request:     lockRequest{},
+		Response:    editlock.Lock{},
+	}, h.renewLock)
+	api.DELETE("/locks/:type/:id", apiversion.Operation{
+		ID:      "releaseLock",
+		Summary: "Release an editing lock",
+		Description: "Releases the lock held with the token in the Lock-Token header. With force=true, releases it " +
+			"whoever holds it, for those allowed to unlock the resource.",
+		Tags: tags,
+	}, h.releaseLock)
+}
+
+type lockRequest struct {
+	TTL int `json:"ttl" binding:"omitempty,min=1"` // Seconds; the default when omitted
+}
+
+// lockResource returns the resource of the request in the caller's tenant, once
+// they may read it
+func (h *Hub) lockResource(c *gin.Context) (editlock.Resource, authz.Subject, error) {
+	ctx := c.Request.Context()
+	subject, ok := authz.SubjectFromContext(ctx)
+	if !ok {
+		return editlock.Resource{}, subject, apperrors.NewUnauthorizedError("Authentication required")
+	}
+	r := editlock.Resource{Type: c.Param("type"), ID: c.Param("id"), Tenant: subject.Tenant}
+	if !h.locks.Lockable(r.Type) {
+		return r, subject, apperrors.NewNotFoundError("Resources of this type can't be locked")
+	}
+	err := authz.Authorize(ctx, "read", authz.Resource{Type: r.Type, ID: r.ID, Tenant: r.Tenant})
+	return r, subject, err
+}
+
+// lockTTL reads the optional ttl of the request body
+func (h *Hub) lockTTL(c *gin.Context) (time.Duration, error) {
+	if c.Request.ContentLength == 0 {
+		return 0, nil
+	}
+	var req lockRequest
+	if err := bind.JSON(c, &req); err != nil {
+		return 0, apperrors.NewValidationErrorFrom("Invalid lock request", err)
+	}
+	ttl := time.Duration(req.TTL) * time.Second
+	if maxTTL := h.locks.MaxTTL(); ttl > maxTTL {
+		seconds := strconv.Itoa(int(maxTTL.Seconds()))
+		return 0, apperrors.NewValidationError("Invalid lock request", apperrors.FieldError{
+			Pointer: "/ttl", Field: "ttl", Rule: "max", Param: seconds, Message: "must be at most " + seconds + " seconds",
+		})
+	}
+	return ttl, nil
+}
+
+func (h *Hub) getLock(c *gin.Context) {
+	r, subject, err := h.lockResource(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	l, err := h.locks.Get(c.Request.Context(), r)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if l.Holder != subject.ID {
+		l.Token = ""
+	}
+	c.JSON(http.StatusOK, l)
+}
+
+func (h *Hub) acquireLock(c *gin.Context) {
+	r, subject, err := h.lockResource(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ttl, err := h.lockTTL(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	l, created, err := h.locks.Acquire(c.Request.Context(), r, subject.ID, ttl)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, l)
+}
+
+func (h *Hub) renewLock(c *gin.Context) {
+	r, _, err := h.lockResource(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	token := c.GetHeader(LockTokenHeader)
+	if token == "" {
+		c.Error(apperrors.NewValidationError(LockTokenHeader + " header is required"))
+		return
+	}
+	ttl, err := h.lockTTL(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	l, err := h.locks.Renew(c.Request.Context(), r, token, ttl)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, l)
+}
+
+func (h *Hub) releaseLock(c *gin.Context) {
+	r, subject, err := h.lockResource(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	token := c.GetHeader(LockTokenHeader)
+	if c.Query("force") == "true" {
+		err := authz.Authorize(c.Request.Context(), "unlock", authz.Resource{Type: r.Type, ID: r.ID, Tenant: r.Tenant})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		token = ""
+	} else if token == "" {
+		c.Error(apperrors.NewValidationError(LockTokenHeader + " header is required, or force=true"))
+		return
+	}
+	if err := h.locks.Release(c.Request.Context(), r, token, subject.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
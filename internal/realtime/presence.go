@@ -0,0 +1,183 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/presence"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PresenceTopic carries the joins and leaves of rooms, filtered on their room
+const PresenceTopic = "presence"
+
+// roomResource is the resource type of rooms, which joining and listing the members
+// of needs read access to
+const roomResource = "room"
+
+const maxRoomName = 200
+
+// TrackPresence lets clients join rooms, tracked by tracker, and subscribe to
+// the presence topic to follow who joins and leaves them
+func (h *Hub) TrackPresence(tracker *presence.Tracker) {
+	h.presence = tracker
+	h.Register(Topic{Name: PresenceTopic, Events: []string{presence.EventJoined, presence.EventLeft},
+		Resource: roomResource, IDField: "room", Tenant: "tenant"})
+}
+
+// join adds the connection's user to a room, refreshed by heartbeats until the
+// client leaves it or disconnects
+func (c *conn) join(m ClientMessage) (ServerMessage, error) {
+	if c.hub.presence == nil {
+		return ServerMessage{}, apperrors.NewNotFoundError("Presence is not enabled")
+	}
+	subject, err := c.roomAccess(m.Room)
+	if err != nil {
+		return ServerMessage{}, err
+	}
+	if _, ok := c.rooms[m.Room]; !ok && len(c.rooms) >= c.hub.cfg.MaxSubscriptions {
+		return ServerMessage{}, apperrors.NewTooManyRequestsError(
+			"Connections join at most " + strconv.Itoa(c.hub.cfg.MaxSubscriptions) + " rooms")
+	}
+	room := presence.Room{Tenant: subject.Tenant, Name: m.Room}
+	if err := c.hub.presence.Join(c.base, room, subject.ID, c.id); err != nil {
+		return ServerMessage{}, err
+	}
+	c.rooms[m.Room] = room
+	return ServerMessage{Type: TypeJoined, ID: m.ID, Room: m.Room}, nil
+}
+
+func (c *conn) leave(m ClientMessage) (ServerMessage, error) {
+	room, ok := c.rooms[m.Room]
+	if !ok {
+		return ServerMessage{}, apperrors.NewNotFoundError("Room not joined")
+	}
+	subject, _ := authz.SubjectFromContext(c.ctx)
+	delete(c.rooms, m.Room)
+	if err := c.hub.presence.Leave(c.base, room, subject.ID, c.id); err != nil {
+		return ServerMessage{}, err
+	}
+	return ServerMessage{Type: TypeLeft, ID: m.ID, Room: m.Room}, nil
+}
+
+// roomAccess checks the subject of the connection may read a room
+func (c *conn) roomAccess(name string) (authz.Subject, error) {
+	subject, ok := authz.SubjectFromContext(c.ctx)
+	if !ok {
+		return subject, apperrors.NewUnauthorizedError("Authentication required, connect with a bearer token or send an auth message")
+	}
+	if name == "" || len(name) > maxRoomName {
+		return subject, apperrors.NewValidationError("Invalid room", apperrors.FieldError{
+			Pointer: "/room", Field: "room", Rule: "max", Param: strconv.Itoa(maxRoomName),
+			Message: "is required and at most " + strconv.Itoa(maxRoomName) + " characters long",
+		})
+	}
+	return subject, authz.Authorize(c.ctx, "read", authz.Resource{Type: roomResource, ID: name, Tenant: subject.Tenant})
+}
+
+// heartbeat refreshes the presence of the connection in the rooms it joined
+func (c *conn) heartbeat() {
+	subject, _ := authz.SubjectFromContext(c.ctx)
+	for _, room := range c.rooms {
+		if err := c.hub.presence.Join(c.base, room, subject.ID, c.id); err != nil {
+			logger.Warn("failed to refresh presence", zap.String("room", room.Name), zap.Error(err))
+		}
+	}
+}
+
+// leaveAll leaves the rooms of a closed connection; those it fails to leave expire
+func (c *conn) leaveAll() {
+	if len(c.rooms) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.base, writeWait)
+	defer cancel()
+	subject, _ := authz.SubjectFromContext(c.ctx)
+	for _, room := range c.rooms {
+		if err := c.hub.presence.Leave(ctx, room, subject.ID, c.id); err != nil {
+			logger.Warn("failed to leave room", zap.String("room", room.Name), zap.Error(err))
+		}
+	}
+}
+
+// heartbeats ticks when the connection refreshes its presence; never without presence
+func (c *conn) heartbeats() (<-chan time.Time, func()) {
+	if c.hub.presence == nil {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(c.hub.presence.HeartbeatInterval())
+	return ticker.C, ticker.Stop
+}
+
+// presenceRoutes mounts the presence queries
+func (h *Hub) presenceRoutes(api *apiversion.Group) {
+	tags := []string{"realtime"}
+	api.GET("/presence/:room", apiversion.Operation{
+		ID:          "listRoomMembers",
+		Summary:     "List who is in a room",
+		Description: "Lists the users of the tenant of the caller present in a room, the most recently seen first. Clients follow changes by subscribing to the presence topic on the realtime WebSocket, filtered on the room.",
+		Tags:        tags,
+		Response:    []presence.Member{},
+	}, h.members)
+	api.GET("/presence/:room/:userId", apiversion.Operation{
+		ID:          "getRoomMember",
+		Summary:     "Tell whether a user is in a room",
+		Description: "Returns the presence of a user in a room, or 404 when they aren't present.",
+		Tags:        tags,
+		Response:    presence.Member{},
+	}, h.member)
+}
+
+// room returns the room of the request in the caller's tenant, once they may read it
+func (h *Hub) room(c *gin.Context) (presence.Room, error) {
+	ctx := c.Request.Context()
+	subject, ok := authz.SubjectFromContext(ctx)
+	if !ok {
+		return presence.Room{}, apperrors.NewUnauthorizedError("Authentication required")
+	}
+	name := c.Param("room")
+	if err := authz.Authorize(ctx, "read", authz.Resource{Type: roomResource, ID: name, Tenant: subject.Tenant}); err != nil {
+		return presence.Room{}, err
+	}
+	return presence.Room{Tenant: subject.Tenant, Name: name}, nil
+}
+
+func (h *Hub) members(c *gin.Context) {
+	room, err := h.room(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	list, err := h.presence.Members(c.Request.Context(), room)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Hub) member(c *gin.Context) {
+	room, err := h.room(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	m, ok, err := h.presence.Present(c.Request.Context(), room, c.Param("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !ok {
+		c.Error(apperrors.NewNotFoundError("User is not present in the room"))
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
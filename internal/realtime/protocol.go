@@ -0,0 +1,57 @@
+package realtime
+
+import (
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventstore"
+)
+
+// Types of the messages clients send
+const (
+	TypeAuth        = "auth"        // Authenticates with a token, for browsers that can't set headers
+	TypeSubscribe   = "subscribe"   // Starts a subscription to a topic
+	TypeUnsubscribe = "unsubscribe" // Ends a subscription
+	TypeJoin        = "join"        // Makes the user present in a room
+	TypeLeave       = "leave"       // Ends the user's presence in a room through this connection
+	TypePing        = "ping"
+)
+
+// Types of the messages the server sends
+const (
+	TypeAuthenticated = "authenticated"
+	TypeSubscribed    = "subscribed"
+	TypeUnsubscribed  = "unsubscribed"
+	TypeJoined        = "joined"
+	TypeLeft          = "left"
+	TypeEvent         = "event" // An event of a subscription
+	TypeError         = "error" // A message was refused; the connection stays open
+	TypePong          = "pong"
+)
+
+// ClientMessage is a message clients send, as a JSON text frame
+type ClientMessage struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`    // Of the subscription, chosen by the client
+	Token string `json:"token,omitempty"` // Of auth messages
+	Topic string `json:"topic,omitempty"`
+	Room  string `json:"room,omitempty"` // Of join and leave messages
+	// Filter keeps the events whose data has these values at these top-level fields
+	Filter map[string]any `json:"filter,omitempty"`
+	// After is the position of the last event the client saw, to resume after it
+	After *int64 `json:"after,omitempty"`
+}
+
+// ServerMessage is a message the server sends, as a JSON text frame
+type ServerMessage struct {
+	Type  string              `json:"type"`
+	ID    string              `json:"id,omitempty"` // Of the subscription, or of the message refused
+	Topic string              `json:"topic,omitempty"`
+	Room  string              `json:"room,omitempty"`
+	Event *eventstore.Event   `json:"event,omitempty"`
+	Error *apperrors.AppError `json:"error,omitempty"`
+}
+
+// errorMessage reports err in reply to the message with id. Internal errors are
+// logged by the caller; clients only see their code.
+func errorMessage(id string, err error) ServerMessage {
+	return ServerMessage{Type: TypeError, ID: id, Error: apperrors.From(err)}
+}
@@ -0,0 +1,241 @@
+// Package realtime bridges the domain events to WebSocket clients, so they follow
+// what happens to their resources instead of polling. Modules declare topics, the
+// events a topic carries and the resource they are about; clients subscribe to
+// topics, optionally filtered on event data and resuming after the last event
+// they saw. Subscribing needs read access to the topic's resource type, and each
+// event is only sent to subscribers allowed to read the resource it is about.
+package realtime
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-api/pkg/authz"
+	"go-api/pkg/editlock"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/jwks"
+	"go-api/pkg/logger"
+	"go-api/pkg/presence"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Config holds WebSocket bridge configuration
+type Config struct {
+	Enabled          bool          `yaml:"enabled"`
+	PollInterval     time.Duration `yaml:"pollInterval"`     // How often the event store is read for new events
+	Origins          []string      `yaml:"origins"`          // Allowed browser origins, * for any; the API's own when empty
+	MaxSubscriptions int           `yaml:"maxSubscriptions"` // Per connection
+	ReplayLimit      int           `yaml:"replayLimit"`      // Most events a subscription resumes with
+	PingInterval     time.Duration `yaml:"pingInterval"`     // Connections not answering twice in a row are closed
+	Buffer           int           `yaml:"buffer"`           // Events queued per connection before it's dropped as too slow
+}
+
+// Topic is a stream of events clients subscribe to. Its events are about a
+// resource, whose ID, owner and tenant are read from fields of the event data for
+// authorization.
+type Topic struct {
+	Name      string
+	Events    []string // Event types it carries
+	Resource  string   // Resource type subscribers need read access to
+	TypeField string   // Field of the type of the resource of each event, when it's not Resource
+	IDField   string
+	Owner     string   // Field of the owner, like ownerId
+	Tenant    string   // Field of the tenant, like tenant
+	Actors    []string // Fields of who caused the event, the first one set counting, like deletedBy then authorId
+}
+
+// About returns the resource an event of the topic is about, read from its data
+func (t Topic) About(data map[string]any) authz.Resource {
+	r := authz.Resource{Type: t.Resource, ID: field(data, t.IDField), Owner: field(data, t.Owner), Tenant: field(data, t.Tenant)}
+	if t.TypeField != "" {
+		r.Type = field(data, t.TypeField)
+	}
+	return r
+}
+
+// Actor returns who caused an event of the topic, read from its data, or an empty
+// string when it's unknown, like for background jobs
+func (t Topic) Actor(data map[string]any) string {
+	for _, name := range t.Actors {
+		if actor := field(data, name); actor != "" {
+			return actor
+		}
+	}
+	return ""
+}
+
+func field(data map[string]any, name string) string {
+	s, _ := data[name].(string)
+	return s
+}
+
+// Declarer is implemented by modules publishing topics
+type Declarer interface {
+	Topics() []Topic
+}
+
+const readBatch = 500
+
+var (
+	connections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "realtime_connections",
+		Help: "Open WebSocket connections of clients following events.",
+	})
+	eventsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "realtime_events_sent_total",
+		Help: "Events sent to WebSocket subscribers, by topic.",
+	}, []string{"topic"})
+	slowDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "realtime_slow_connections_dropped_total",
+		Help: "WebSocket connections closed for not reading their events fast enough.",
+	})
+)
+
+// Hub reads new events from the store and hands them to the connections
+// subscribed to their type
+type Hub struct {
+	cfg      Config
+	events   eventstore.Store
+	keys     *jwks.Manager
+	presence *presence.Tracker // Nil unless presence is tracked
+	locks    *editlock.Manager // Nil unless editing locks are enabled
+
+	upgrader websocket.Upgrader
+	topics   map[string]Topic
+	position atomic.Int64 // Of the last event handed out
+
+	mu    sync.RWMutex
+	conns map[*conn]struct{}
+}
+
+// NewHub creates a hub following events, authenticating clients with keys
+func NewHub(cfg Config, events eventstore.Store, keys *jwks.Manager) *Hub {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.MaxSubscriptions <= 0 {
+		cfg.MaxSubscriptions = 20
+	}
+	if cfg.ReplayLimit <= 0 {
+		cfg.ReplayLimit = 1000
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = 30 * time.Second
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 256
+	}
+	return &Hub{
+		cfg:      cfg,
+		events:   events,
+		keys:     keys,
+		upgrader: websocket.Upgrader{CheckOrigin: checkOrigin(cfg.Origins)},
+		topics:   make(map[string]Topic),
+		conns:    make(map[*conn]struct{}),
+	}
+}
+
+// Register adds topics, which has to happen before the hub runs
+func (h *Hub) Register(topics ...Topic) {
+	for _, t := range topics {
+		if _, ok := h.topics[t.Name]; ok {
+			logger.Warn("realtime topic declared twice, keeping the first", zap.String("topic", t.Name))
+			continue
+		}
+		h.topics[t.Name] = t
+	}
+}
+
+// RegisterFrom registers the topics of every value that implements Declarer
+func (h *Hub) RegisterFrom(values ...any) {
+	for _, v := range values {
+		if d, ok := v.(Declarer); ok {
+			h.Register(d.Topics()...)
+		}
+	}
+}
+
+// Start follows the events appended from now on until ctx is cancelled, then
+// closes the connections
+func (h *Hub) Start(ctx context.Context) error {
+	last, err := h.events.LastPosition(ctx)
+	if err != nil {
+		return err
+	}
+	h.position.Store(last)
+	go func() {
+		ticker := time.NewTicker(h.cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				h.closeAll()
+				return
+			case <-ticker.C:
+				h.poll(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// poll hands out the events appended since the last poll
+func (h *Hub) poll(ctx context.Context) {
+	for {
+		events, err := h.events.ReadAll(ctx, h.position.Load(), readBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("failed to read events for realtime subscribers", zap.Error(err))
+			}
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+		// Exclusively, so subscriptions starting meanwhile either get the events or
+		// start after them
+		h.mu.Lock()
+		for c := range h.conns {
+			for _, e := range events {
+				if c.wants(e.Type) {
+					c.push(e)
+				}
+			}
+		}
+		h.position.Store(events[len(events)-1].Position)
+		h.mu.Unlock()
+		if len(events) < readBatch {
+			return
+		}
+	}
+}
+
+func (h *Hub) add(c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[c] = struct{}{}
+	connections.Inc()
+}
+
+func (h *Hub) remove(c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c]; ok {
+		delete(h.conns, c)
+		connections.Dec()
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.conns {
+		c.shutdown()
+	}
+}
@@ -0,0 +1,220 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/logger"
+	"go-api/pkg/mail"
+	"go-api/pkg/queue"
+	"go-api/pkg/spreadsheet"
+
+	"go.uber.org/zap"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of webhook deliveries' bodies, keyed
+// with the webhook secret, as sha256=<hex>
+const SignatureHeader = "X-Signature-256"
+
+// execute runs a queued report and delivers the file. A run is only executed once;
+// a retry after a failed delivery resends to the destinations still missing it.
+func (m *reportsModule) execute(ctx context.Context, job *queue.Job) error {
+	var payload runJob
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	run, err := m.store.GetRun(ctx, payload.RunID)
+	if errors.Is(err, errRunNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r, err := m.store.GetReport(ctx, run.ReportID)
+	if errors.Is(err, errReportNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if run.Status == RunQueued {
+		if run, err = m.render(ctx, r, run); err != nil {
+			return err
+		}
+	}
+	if run.Status != RunSucceeded {
+		return nil
+	}
+
+	var failed []error
+	if run.Email != nil && run.Email.SentAt == nil {
+		failed = append(failed, m.attempt(ctx, &run, run.Email, func() error { return m.email(ctx, r, run) }))
+	}
+	if run.Webhook != nil && run.Webhook.SentAt == nil {
+		failed = append(failed, m.attempt(ctx, &run, run.Webhook, func() error { return m.webhook(ctx, r, run) }))
+	}
+	return errors.Join(failed...)
+}
+
+// render queries the report and stores the spreadsheet. Query errors fail the run
+// for good, as they come from the report or its parameters.
+func (m *reportsModule) render(ctx context.Context, r Report, run Run) (Run, error) {
+	now := time.Now().UTC()
+	if m.db == nil {
+		run.Status, run.Error, run.CompletedAt = RunFailed, "no database is configured", &now
+		return run, m.store.SaveRun(ctx, run)
+	}
+	sheet, err := m.query(ctx, r, run.Params)
+	if err != nil {
+		if ctx.Err() != nil {
+			return run, err
+		}
+		logger.Warn("report run failed", zap.String("report", r.ID), zap.String("run", run.ID), zap.Error(err))
+		run.Status, run.Error, run.CompletedAt = RunFailed, err.Error(), &now
+		return run, m.store.SaveRun(ctx, run)
+	}
+
+	var buf bytes.Buffer
+	if err := spreadsheet.Write(&buf, run.Format, sheet); err != nil {
+		run.Status, run.Error, run.CompletedAt = RunFailed, err.Error(), &now
+		return run, m.store.SaveRun(ctx, run)
+	}
+	obj, err := m.storage.Put(ctx, run.Key(), &buf, spreadsheet.ContentTypes[run.Format])
+	if err != nil {
+		return run, err
+	}
+	now = time.Now().UTC()
+	run.Status, run.Rows, run.Size, run.CompletedAt = RunSucceeded, len(sheet.Rows), obj.Size, &now
+	return run, m.store.SaveRun(ctx, run)
+}
+
+// attempt delivers to one destination and records the outcome on the run
+func (m *reportsModule) attempt(ctx context.Context, run *Run, a *Attempt, send func() error) error {
+	err := send()
+	if err != nil {
+		logger.Error("report delivery failed", zap.String("report", run.ReportID), zap.String("run", run.ID), zap.Error(err))
+		a.Error = err.Error()
+	} else {
+		now := time.Now().UTC()
+		a.SentAt, a.Error = &now, ""
+	}
+	if saveErr := m.store.SaveRun(ctx, *run); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+func (m *reportsModule) email(ctx context.Context, r Report, run Run) error {
+	if m.mailer == nil {
+		return errors.New("email delivery is not configured")
+	}
+	content, err := m.read(ctx, run)
+	if err != nil {
+		return err
+	}
+	subject := r.Delivery.Subject
+	if subject == "" {
+		subject = r.Name
+	}
+	return m.mailer.Send(ctx, mail.Message{
+		To:      r.Delivery.Email,
+		Subject: subject,
+		Text:    fmt.Sprintf("The %s report of %s is attached, with %d rows.", r.Name, run.CreatedAt.Format(time.DateOnly), run.Rows),
+		Attachments: []mail.Attachment{{
+			Filename:    filename(r, run),
+			ContentType: spreadsheet.ContentTypes[run.Format],
+			Data:        content,
+		}},
+	})
+}
+
+// Channels declares the webhook deliveries of report files, a message per format
+func (m *reportsModule) Channels() []apiversion.Channel {
+	headers := map[string]string{
+		"Content-Disposition": "attachment, with the file name",
+		"X-Report-Id":         "ID of the report",
+		"X-Report-Run-Id":     "ID of the run that produced the file",
+		"X-Report-Rows":       "Number of rows in the file",
+		SignatureHeader:       "sha256=<hex HMAC-SHA256 of the body>, keyed with the webhook secret, when one is configured",
+	}
+	payload := json.RawMessage(`{"type":"string","format":"binary"}`)
+	return []apiversion.Channel{{
+		ID:          "reportWebhook",
+		Title:       "Report deliveries",
+		Description: "Each run of a report delivering to a webhook POSTs the file to the webhook URL of the report. Failed deliveries are retried; 2xx answers acknowledge them.",
+		Messages: []apiversion.Message{
+			{Name: "report.csv", Summary: "A report file in CSV", ContentType: spreadsheet.ContentTypes[spreadsheet.FormatCSV], Headers: headers, Payload: payload},
+			{Name: "report.xlsx", Summary: "A report file in XLSX", ContentType: spreadsheet.ContentTypes[spreadsheet.FormatXLSX], Headers: headers, Payload: payload},
+		},
+	}}
+}
+
+// webhook posts the file to the report's webhook, signed when a secret is configured
+func (m *reportsModule) webhook(ctx context.Context, r Report, run Run) error {
+	content, err := m.read(ctx, run)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Delivery.Webhook, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", spreadsheet.ContentTypes[run.Format])
+	req.Header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename(r, run)}))
+	req.Header.Set("X-Report-Id", r.ID)
+	req.Header.Set("X-Report-Run-Id", run.ID)
+	req.Header.Set("X-Report-Rows", strconv.Itoa(run.Rows))
+	if m.cfg.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(m.cfg.WebhookSecret))
+		mac.Write(content)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (m *reportsModule) read(ctx context.Context, run Run) ([]byte, error) {
+	r, _, err := m.storage.Open(ctx, run.Key())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// filename names a run's file after the report and the day it ran
+func filename(r Report, run Run) string {
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_':
+			return c
+		case c >= 'A' && c <= 'Z':
+			return c + 'a' - 'A'
+		}
+		return '-'
+	}, strings.TrimSpace(r.Name))
+	return name + "-" + run.CreatedAt.Format("2006-01-02") + "." + run.Format
+}
@@ -0,0 +1,263 @@
+package reports
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/spreadsheet"
+	"go-api/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminRoutes mounts report management on the admin group. Reports run arbitrary
+// read-only SQL, so they're only defined and run by admins.
+func (m *reportsModule) AdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/reports", m.list)
+	rg.POST("/reports", m.create)
+	rg.GET("/reports/:id", m.get)
+	rg.PUT("/reports/:id", m.update)
+	rg.DELETE("/reports/:id", m.delete)
+	rg.POST("/reports/:id/runs", m.runReport)
+	rg.GET("/reports/:id/runs", m.listRuns)
+	rg.GET("/reports/:id/runs/:run", m.getRun)
+	rg.GET("/reports/:id/runs/:run/file", m.download)
+}
+
+type reportRequest struct {
+	Name        string          `json:"name" binding:"required,max=200"`
+	Description string          `json:"description" binding:"omitempty,max=1000"`
+	Query       string          `json:"query" binding:"required,max=100000"`
+	Params      []Param         `json:"params" binding:"max=50"`
+	Columns     []Column        `json:"columns" binding:"max=500"`
+	Format      string          `json:"format"`
+	Schedule    string          `json:"schedule"`
+	Timezone    string          `json:"timezone"`
+	Delivery    deliveryRequest `json:"delivery"`
+}
+
+type deliveryRequest struct {
+	Email   []string `json:"email" binding:"max=20,dive,email"`
+	Subject string   `json:"subject" binding:"omitempty,max=200"`
+	Webhook string   `json:"webhook" binding:"omitempty,max=2000"`
+}
+
+func (m *reportsModule) list(c *gin.Context) {
+	list, err := m.store.ListReports(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (m *reportsModule) get(c *gin.Context) {
+	r, err := m.store.GetReport(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (m *reportsModule) create(c *gin.Context) {
+	now := time.Now().UTC()
+	r, ok := m.bindReport(c, Report{ID: uuid.New().String(), CreatedAt: now})
+	if !ok {
+		return
+	}
+	if err := m.store.SaveReport(c.Request.Context(), r); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+r.ID)
+	c.JSON(http.StatusCreated, r)
+}
+
+func (m *reportsModule) update(c *gin.Context) {
+	existing, err := m.store.GetReport(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	r, ok := m.bindReport(c, existing)
+	if !ok {
+		return
+	}
+	if err := m.store.SaveReport(c.Request.Context(), r); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// bindReport applies the request body to r and validates the result. The next
+// scheduled run is recomputed, so changing the schedule takes effect right away.
+func (m *reportsModule) bindReport(c *gin.Context, r Report) (Report, bool) {
+	var req reportRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid report", err))
+		return Report{}, false
+	}
+	r.Name = req.Name
+	r.Description = req.Description
+	r.Query = req.Query
+	r.Params = req.Params
+	r.Columns = req.Columns
+	r.Format = req.Format
+	if r.Format == "" {
+		r.Format = spreadsheet.FormatXLSX
+	}
+	r.Schedule = strings.TrimSpace(req.Schedule)
+	r.Timezone = req.Timezone
+	r.Delivery = Delivery{Email: req.Delivery.Email, Subject: req.Delivery.Subject, Webhook: req.Delivery.Webhook}
+	if err := m.validate(r); err != nil {
+		c.Error(err)
+		return Report{}, false
+	}
+	r.UpdatedAt = time.Now().UTC()
+	r.NextRunAt = nextRun(r, r.UpdatedAt)
+	return r, true
+}
+
+// delete removes a report with its runs and their files
+func (m *reportsModule) delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if _, err := m.store.GetReport(ctx, id); err != nil {
+		c.Error(err)
+		return
+	}
+	for {
+		runs, err := m.store.ListRuns(ctx, id, 100)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		for _, run := range runs {
+			if err := m.removeRun(ctx, run); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+		if len(runs) < 100 {
+			break
+		}
+	}
+	if err := m.store.DeleteReport(ctx, id); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type runRequest struct {
+	Params  map[string]string `json:"params"`
+	Format  string            `json:"format"`  // The report's when empty
+	Deliver bool              `json:"deliver"` // Also send the file to the report's destinations
+}
+
+// runReport queues a run of a report. Parameters are checked up front, so mistakes
+// are answered with 400 rather than a failed run.
+func (m *reportsModule) runReport(c *gin.Context) {
+	if m.db == nil {
+		c.Error(apperrors.NewConflictError("Reports need a database to query"))
+		return
+	}
+	ctx := c.Request.Context()
+	r, err := m.store.GetReport(ctx, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var req runRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid run", err))
+		return
+	}
+	if _, ok := spreadsheet.ContentTypes[req.Format]; req.Format != "" && !ok {
+		c.Error(apperrors.NewValidationError("Invalid run", apperrors.FieldError{Field: "format", Rule: "oneof", Message: "format must be xlsx or csv"}))
+		return
+	}
+	_, names, err := bindParams(r.Query)
+	if err == nil {
+		_, err = args(r, req.Params, names, time.Now(), time.UTC)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	run, err := m.start(ctx, r, Run{Trigger: TriggerManual, Params: req.Params, Format: req.Format, Deliver: req.Deliver})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+run.ID)
+	c.JSON(http.StatusAccepted, run)
+}
+
+func (m *reportsModule) listRuns(c *gin.Context) {
+	ctx := c.Request.Context()
+	if _, err := m.store.GetReport(ctx, c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	runs, err := m.store.ListRuns(ctx, c.Param("id"), 50)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func (m *reportsModule) getRun(c *gin.Context) {
+	run, ok := m.run(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+func (m *reportsModule) download(c *gin.Context) {
+	run, ok := m.run(c)
+	if !ok {
+		return
+	}
+	switch run.Status {
+	case RunQueued:
+		c.Error(apperrors.NewConflictError("Report run has not finished yet"))
+		return
+	case RunFailed:
+		c.Error(apperrors.NewConflictError("Report run failed: " + run.Error))
+		return
+	}
+	r, err := m.store.GetReport(c.Request.Context(), run.ReportID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename(r, run)}))
+	c.Header("Cache-Control", "private, no-cache")
+	if err := storage.Serve(c.Writer, c.Request, m.storage, run.Key()); err != nil {
+		c.Error(err)
+	}
+}
+
+// run returns the run of the :run parameter if it belongs to the :id report
+func (m *reportsModule) run(c *gin.Context) (Run, bool) {
+	run, err := m.store.GetRun(c.Request.Context(), c.Param("run"))
+	if err == nil && run.ReportID != c.Param("id") {
+		err = errRunNotFound
+	}
+	if err != nil {
+		c.Error(err)
+		return Run{}, false
+	}
+	return run, true
+}
@@ -0,0 +1,376 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go-api/pkg/cron"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/spreadsheet"
+)
+
+// bindParams rewrites the :name parameters of a query as the positional $1, $2, ...,
+// returning the names in position order. Quoted strings and identifiers, comments
+// and :: casts are left alone. Only one statement is allowed.
+func bindParams(query string) (string, []string, error) {
+	var out strings.Builder
+	positions := make(map[string]int)
+	var names []string
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			out.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			i += end - 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i:], "*/")
+			if end < 0 {
+				return "", nil, fmt.Errorf("unterminated comment")
+			}
+			out.WriteByte(' ')
+			i += end + 1
+		case c == ':' && strings.HasPrefix(query[i:], "::"):
+			out.WriteString("::")
+			i++
+		case c == ':' && i+1 < len(query) && isIdentStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isIdent(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			pos, ok := positions[name]
+			if !ok {
+				names = append(names, name)
+				pos = len(names)
+				positions[name] = pos
+			}
+			out.WriteString("$" + strconv.Itoa(pos))
+			i = j - 1
+		case c == ';':
+			if strings.TrimSpace(query[i+1:]) != "" {
+				return "", nil, fmt.Errorf("only one statement is allowed")
+			}
+			i = len(query)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), names, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c))
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || unicode.IsDigit(rune(c))
+}
+
+var paramTypes = map[string]bool{TypeString: true, TypeInteger: true, TypeNumber: true, TypeBoolean: true, TypeDate: true, TypeTimestamp: true}
+
+// readOnly is how queries have to start; they also run in a read-only transaction
+var readOnly = regexp.MustCompile(`(?i)^\s*(select|with)\b`)
+
+// validate checks a report before it's saved
+func (m *reportsModule) validate(r Report) error {
+	var details []apperrors.FieldError
+	add := func(field, message string) {
+		details = append(details, apperrors.FieldError{Field: field, Rule: "invalid", Message: message})
+	}
+
+	if !readOnly.MatchString(r.Query) {
+		add("query", "query must be a SELECT")
+	}
+	_, names, err := bindParams(r.Query)
+	if err != nil {
+		add("query", err.Error())
+	}
+	declared := make(map[string]bool, len(r.Params))
+	for i, p := range r.Params {
+		if declared[p.Name] {
+			add(fmt.Sprintf("params[%d].name", i), "parameter "+p.Name+" is declared twice")
+		}
+		declared[p.Name] = true
+		if !paramTypes[p.Type] {
+			add(fmt.Sprintf("params[%d].type", i), "type must be string, integer, number, boolean, date or timestamp")
+		} else if p.Default != "" {
+			if _, err := paramValue(p, p.Default, time.Now(), time.UTC); err != nil {
+				add(fmt.Sprintf("params[%d].default", i), err.Error())
+			}
+		}
+	}
+	for _, name := range names {
+		if !declared[name] {
+			add("params", "parameter "+name+" is used in the query but not declared")
+		}
+	}
+	if _, ok := spreadsheet.ContentTypes[r.Format]; !ok {
+		add("format", "format must be xlsx or csv")
+	}
+	for i, col := range r.Columns {
+		if col.Type != "" && col.Type != "number" && col.Type != "text" {
+			add(fmt.Sprintf("columns[%d].type", i), "type must be number or text")
+		}
+	}
+	if r.Timezone != "" {
+		if _, err := time.LoadLocation(r.Timezone); err != nil {
+			add("timezone", "unknown time zone "+r.Timezone)
+		}
+	}
+	if r.Schedule != "" {
+		if _, err := cron.Parse(r.Schedule); err != nil {
+			add("schedule", err.Error())
+		}
+	}
+	if len(r.Delivery.Email) > 0 && m.mailer == nil {
+		add("delivery.email", "email delivery is not configured")
+	}
+	if r.Delivery.Webhook != "" {
+		if u, err := url.Parse(r.Delivery.Webhook); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			add("delivery.webhook", "webhook must be an http or https URL")
+		}
+	}
+	if len(details) > 0 {
+		return apperrors.NewValidationError("Invalid report", details...)
+	}
+	return nil
+}
+
+// args converts the parameter values of a run to query arguments in position order
+func args(r Report, values map[string]string, names []string, now time.Time, loc *time.Location) ([]any, error) {
+	params := make(map[string]Param, len(r.Params))
+	for _, p := range r.Params {
+		params[p.Name] = p
+	}
+	for name := range values {
+		if _, ok := params[name]; !ok {
+			return nil, apperrors.NewValidationError("Unknown parameter " + name)
+		}
+	}
+
+	list := make([]any, len(names))
+	for i, name := range names {
+		p := params[name]
+		text, ok := values[name]
+		if !ok {
+			text = p.Default
+		}
+		if text == "" {
+			if p.Required {
+				return nil, apperrors.NewValidationError("Parameter " + name + " is required")
+			}
+			continue
+		}
+		v, err := paramValue(p, text, now, loc)
+		if err != nil {
+			return nil, apperrors.NewValidationError("Parameter " + name + ": " + err.Error())
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+func paramValue(p Param, text string, now time.Time, loc *time.Location) (any, error) {
+	switch p.Type {
+	case TypeString:
+		return text, nil
+	case TypeInteger:
+		return strconv.ParseInt(text, 10, 64)
+	case TypeNumber:
+		return strconv.ParseFloat(text, 64)
+	case TypeBoolean:
+		return strconv.ParseBool(text)
+	case TypeDate:
+		if t, err := time.ParseInLocation(time.DateOnly, text, loc); err == nil {
+			return t, nil
+		}
+		t, err := relativeTime(text, now, loc)
+		if err != nil {
+			return nil, err
+		}
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+	case TypeTimestamp:
+		if t, err := time.Parse(time.RFC3339, text); err == nil {
+			return t, nil
+		}
+		return relativeTime(text, now, loc)
+	}
+	return nil, fmt.Errorf("unknown type %q", p.Type)
+}
+
+var relative = regexp.MustCompile(`^(now|today|week_start|month_start|year_start)(?:([+-]\d+)([hdwmy]))?$`)
+
+// relativeTime evaluates expressions like today-7d: a base of now, today,
+// week_start (Monday), month_start or year_start, optionally offset by a number of
+// hours, days, weeks, months or years
+func relativeTime(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	m := relative.FindStringSubmatch(strings.ToLower(strings.TrimSpace(expr)))
+	if m == nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor like today-7d", expr)
+	}
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	t := now
+	switch m[1] {
+	case "today":
+		t = today
+	case "week_start":
+		t = today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	case "month_start":
+		t = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	case "year_start":
+		t = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, loc)
+	}
+	if m[2] == "" {
+		return t, nil
+	}
+	n, _ := strconv.Atoi(m[2])
+	switch m[3] {
+	case "h":
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case "d":
+		return t.AddDate(0, 0, n), nil
+	case "w":
+		return t.AddDate(0, 0, 7*n), nil
+	case "m":
+		return t.AddDate(0, n, 0), nil
+	}
+	return t.AddDate(n, 0, 0), nil
+}
+
+// query runs a report in a read-only transaction, returning its results as a sheet
+func (m *reportsModule) query(ctx context.Context, r Report, values map[string]string) (spreadsheet.Sheet, error) {
+	loc := time.UTC
+	if r.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(r.Timezone); err != nil {
+			return spreadsheet.Sheet{}, err
+		}
+	}
+	query, names, err := bindParams(r.Query)
+	if err != nil {
+		return spreadsheet.Sheet{}, err
+	}
+	list, err := args(r, values, names, time.Now(), loc)
+	if err != nil {
+		return spreadsheet.Sheet{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.QueryTimeout)
+	defer cancel()
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return spreadsheet.Sheet{}, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, query, list...)
+	if err != nil {
+		return spreadsheet.Sheet{}, err
+	}
+	defer rows.Close()
+
+	fields, err := rows.Columns()
+	if err != nil {
+		return spreadsheet.Sheet{}, err
+	}
+	columns, indexes, err := layout(r.Columns, fields)
+	if err != nil {
+		return spreadsheet.Sheet{}, err
+	}
+	sheet := spreadsheet.Sheet{Name: r.Name, Columns: make([]spreadsheet.Column, len(columns))}
+	for i, col := range columns {
+		sheet.Columns[i] = spreadsheet.Column{Header: col.Header, Format: col.Format, Width: col.Width}
+	}
+
+	scanned := make([]any, len(fields))
+	pointers := make([]any, len(fields))
+	for i := range scanned {
+		pointers[i] = &scanned[i]
+	}
+	for rows.Next() {
+		if len(sheet.Rows) == m.cfg.MaxRows {
+			return spreadsheet.Sheet{}, fmt.Errorf("the report returns more than %d rows", m.cfg.MaxRows)
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return spreadsheet.Sheet{}, err
+		}
+		row := make([]any, len(columns))
+		for i, col := range columns {
+			row[i] = cell(scanned[indexes[i]], col.Type, loc)
+		}
+		sheet.Rows = append(sheet.Rows, row)
+	}
+	return sheet, rows.Err()
+}
+
+// layout resolves the report's columns against the result's, defaulting to all of
+// them, and returns where each column's values are in a result row
+func layout(columns []Column, fields []string) ([]Column, []int, error) {
+	byName := make(map[string]int, len(fields))
+	for i, f := range fields {
+		byName[f] = i
+	}
+	if len(columns) == 0 {
+		columns = make([]Column, len(fields))
+		for i, f := range fields {
+			columns[i] = Column{Field: f}
+		}
+	}
+	indexes := make([]int, len(columns))
+	resolved := make([]Column, len(columns))
+	for i, col := range columns {
+		index, ok := byName[col.Field]
+		if !ok {
+			return nil, nil, fmt.Errorf("column %s is not in the query's results", col.Field)
+		}
+		if col.Header == "" {
+			col.Header = col.Field
+		}
+		indexes[i], resolved[i] = index, col
+	}
+	return resolved, indexes, nil
+}
+
+// cell converts a scanned value for the spreadsheet, showing times in the report's
+// time zone
+func cell(v any, typ string, loc *time.Location) any {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	switch typ {
+	case "number":
+		if s, ok := v.(string); ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f
+			}
+		}
+	case "text":
+		if v != nil {
+			if t, ok := v.(time.Time); ok {
+				return t.In(loc).Format(time.RFC3339)
+			}
+			return fmt.Sprint(v)
+		}
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.In(loc)
+	}
+	return v
+}
@@ -0,0 +1,230 @@
+// Package reports is the feature module for spreadsheet reports. A report is a
+// parameterized SQL query with column specs, defined through the admin API. Runs
+// are queued on demand or by the report's cron schedule, rendered to XLSX or CSV
+// and delivered by email and to a webhook.
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/mail"
+	"go-api/pkg/queue"
+	"go-api/pkg/retention"
+	"go-api/pkg/storage"
+)
+
+// Config holds reporting configuration
+type Config struct {
+	MaxRows        int           `yaml:"maxRows"` // Runs of reports returning more fail
+	QueryTimeout   time.Duration `yaml:"queryTimeout"`
+	PollInterval   time.Duration `yaml:"pollInterval"`  // How often schedules are checked for due reports
+	RunRetention   time.Duration `yaml:"runRetention"`  // Runs and their files are removed after this long
+	WebhookSecret  string        `yaml:"webhookSecret"` // Signs webhook deliveries when set
+	WebhookTimeout time.Duration `yaml:"webhookTimeout"`
+}
+
+// Report is a query whose results are rendered as a spreadsheet
+type Report struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Query is a SELECT referring to parameters as :name
+	Query    string   `json:"query"`
+	Params   []Param  `json:"params,omitempty"`
+	Columns  []Column `json:"columns,omitempty"` // All result columns in order when empty
+	Format   string   `json:"format"`            // xlsx or csv
+	Schedule string   `json:"schedule,omitempty"`
+	Timezone string   `json:"timezone,omitempty"` // Of the schedule and relative dates; UTC when empty
+	Delivery Delivery `json:"delivery"`
+
+	NextRunAt *time.Time `json:"nextRunAt,omitempty"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"` // Of the schedule
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Parameter types
+const (
+	TypeString    = "string"
+	TypeInteger   = "integer"
+	TypeNumber    = "number"
+	TypeBoolean   = "boolean"
+	TypeDate      = "date"
+	TypeTimestamp = "timestamp"
+)
+
+// Param is a query parameter. Dates and timestamps also take expressions relative
+// to the run, like today-7d or month_start-1m, see relativeTime.
+type Param struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	Default  string `json:"default,omitempty"` // Used when a run doesn't set the parameter
+}
+
+// Column is a column of the spreadsheet
+type Column struct {
+	Field  string  `json:"field"`            // Result column
+	Header string  `json:"header,omitempty"` // Field when empty
+	Type   string  `json:"type,omitempty"`   // number or text to convert the values; as returned when empty
+	Format string  `json:"format,omitempty"` // Spreadsheet number format, like #,##0.00 or yyyy-mm-dd
+	Width  float64 `json:"width,omitempty"`
+}
+
+// Delivery is where finished runs are sent
+type Delivery struct {
+	Email   []string `json:"email,omitempty"`
+	Subject string   `json:"subject,omitempty"`
+	Webhook string   `json:"webhook,omitempty"` // Receives the file in a POST
+}
+
+// Run statuses
+const (
+	RunQueued    = "queued"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// Run triggers
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+)
+
+// Run is one execution of a report
+type Run struct {
+	ID          string            `json:"id"`
+	ReportID    string            `json:"reportId"`
+	Trigger     string            `json:"trigger"`
+	Params      map[string]string `json:"params,omitempty"`
+	Format      string            `json:"format"`
+	Deliver     bool              `json:"deliver"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Rows        int               `json:"rows"`
+	Size        int64             `json:"size,omitempty"`
+	Email       *Attempt          `json:"email,omitempty"`
+	Webhook     *Attempt          `json:"webhook,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	CompletedAt *time.Time        `json:"completedAt,omitempty"`
+}
+
+// Attempt is the outcome of delivering a run to one destination
+type Attempt struct {
+	SentAt *time.Time `json:"sentAt,omitempty"`
+	Error  string     `json:"error,omitempty"` // Of the last failed attempt
+}
+
+// Key is where the file of a run is stored
+func (r Run) Key() string {
+	return "reports/" + r.ReportID + "/" + r.ID + "." + r.Format
+}
+
+// jobRun executes a report run and delivers it
+const jobRun = "reports.run"
+
+type runJob struct {
+	RunID string `json:"runId"`
+}
+
+type reportsModule struct {
+	module.Base
+	cfg     Config
+	db      *sql.DB
+	store   Store
+	storage storage.Storage
+	queue   *queue.Manager
+	mailer  mail.Mailer
+	client  *http.Client
+}
+
+// New returns the factory of the reports module, which needs the shared storage for
+// the files of runs. Reports query the application database, so they only run when
+// one is configured.
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if deps.Storage == nil {
+			return nil, fmt.Errorf("reports: no storage configured")
+		}
+		if cfg.MaxRows <= 0 {
+			cfg.MaxRows = 100_000
+		}
+		if cfg.QueryTimeout <= 0 {
+			cfg.QueryTimeout = 2 * time.Minute
+		}
+		if cfg.PollInterval <= 0 {
+			cfg.PollInterval = 30 * time.Second
+		}
+		if cfg.RunRetention <= 0 {
+			cfg.RunRetention = 30 * 24 * time.Hour
+		}
+		var store Store = NewMemoryStore()
+		if deps.DB != nil {
+			store = NewSQLStore(deps.DB)
+		}
+		return &reportsModule{
+			cfg:     cfg,
+			db:      deps.DB,
+			store:   store,
+			storage: deps.Storage,
+			queue:   deps.Queue,
+			mailer:  deps.Mailer,
+			client:  &http.Client{Timeout: cfg.WebhookTimeout},
+		}, nil
+	}
+}
+
+func (m *reportsModule) Name() string { return "reports" }
+
+func (m *reportsModule) Migrations() []module.Migration { return migrations }
+
+func (m *reportsModule) Jobs() map[string]queue.HandlerFunc {
+	return map[string]queue.HandlerFunc{jobRun: m.execute}
+}
+
+// RetentionPolicies removes old runs together with their files
+func (m *reportsModule) RetentionPolicies() []retention.Policy {
+	return []retention.Policy{{
+		Name:        "report_runs",
+		Description: "Report runs and their spreadsheets",
+		MaxAge:      m.cfg.RunRetention,
+		Target:      oldRuns{m},
+	}}
+}
+
+// oldRuns is the retention target of report runs
+type oldRuns struct {
+	m *reportsModule
+}
+
+func (t oldRuns) Count(ctx context.Context, cutoff time.Time) (int64, error) {
+	return t.m.store.CountRunsBefore(ctx, cutoff)
+}
+
+func (t oldRuns) Purge(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	runs, err := t.m.store.RunsBefore(ctx, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	for _, run := range runs {
+		if err := t.m.removeRun(ctx, run); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// removeRun deletes a run's record and file
+func (m *reportsModule) removeRun(ctx context.Context, run Run) error {
+	if err := m.storage.Delete(ctx, run.Key()); err != nil {
+		return err
+	}
+	return m.store.DeleteRun(ctx, run.ID)
+}
@@ -0,0 +1,105 @@
+package reports
+
+import (
+	"context"
+	"time"
+
+	"go-api/pkg/cron"
+	"go-api/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// nextRun returns when a report's schedule next fires after t, or nil when it has
+// none
+func nextRun(r Report, t time.Time) *time.Time {
+	if r.Schedule == "" {
+		return nil
+	}
+	schedule, err := cron.Parse(r.Schedule)
+	if err != nil {
+		return nil
+	}
+	loc := time.UTC
+	if r.Timezone != "" {
+		if l, err := time.LoadLocation(r.Timezone); err == nil {
+			loc = l
+		}
+	}
+	next := schedule.Next(t.In(loc))
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// Run queues the runs of scheduled reports as they fall due. Every instance polls,
+// but claiming a due run moves the report's next run time with a compare-and-set,
+// so each scheduled run is queued once. Runs missed while no instance was up are
+// caught up with a single run.
+func (m *reportsModule) Run(ctx context.Context) {
+	if m.db == nil {
+		return
+	}
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		m.runDue(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *reportsModule) runDue(ctx context.Context, now time.Time) {
+	due, err := m.store.DueReports(ctx, now)
+	if err != nil {
+		logger.Error("failed to list due reports", zap.Error(err))
+		return
+	}
+	for _, r := range due {
+		scheduled := *r.NextRunAt
+		r.LastRunAt, r.NextRunAt = &scheduled, nextRun(r, now)
+		claimed, err := m.store.ClaimSchedule(ctx, r, scheduled)
+		if err != nil {
+			logger.Error("failed to claim scheduled report", zap.String("report", r.ID), zap.Error(err))
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if _, err := m.start(ctx, r, Run{Trigger: TriggerSchedule, Deliver: true}); err != nil {
+			logger.Error("failed to queue scheduled report", zap.String("report", r.ID), zap.Error(err))
+		}
+	}
+}
+
+// start records a run of r and queues it
+func (m *reportsModule) start(ctx context.Context, r Report, run Run) (Run, error) {
+	run.ID = uuid.New().String()
+	run.ReportID = r.ID
+	run.Status = RunQueued
+	run.CreatedAt = time.Now().UTC()
+	if run.Format == "" {
+		run.Format = r.Format
+	}
+	if run.Deliver {
+		if len(r.Delivery.Email) > 0 {
+			run.Email = &Attempt{}
+		}
+		if r.Delivery.Webhook != "" {
+			run.Webhook = &Attempt{}
+		}
+	}
+	if err := m.store.SaveRun(ctx, run); err != nil {
+		return Run{}, err
+	}
+	if _, err := m.queue.Enqueue(ctx, "default", jobRun, runJob{RunID: run.ID}); err != nil {
+		return Run{}, err
+	}
+	return run, nil
+}
@@ -0,0 +1,346 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	apperrors "go-api/pkg/errors"
+)
+
+// Store persists reports and their runs; the files of runs are in storage
+type Store interface {
+	SaveReport(ctx context.Context, r Report) error
+	GetReport(ctx context.Context, id string) (Report, error)
+	ListReports(ctx context.Context) ([]Report, error)
+	// DeleteReport removes a report and the records of its runs
+	DeleteReport(ctx context.Context, id string) error
+	// DueReports returns the scheduled reports whose next run is at or before now
+	DueReports(ctx context.Context, now time.Time) ([]Report, error)
+	// ClaimSchedule saves r only if its stored next run is still due, reporting
+	// whether it did, so that of instances polling together one queues the run
+	ClaimSchedule(ctx context.Context, r Report, due time.Time) (bool, error)
+
+	SaveRun(ctx context.Context, run Run) error
+	GetRun(ctx context.Context, id string) (Run, error)
+	// ListRuns returns a report's latest runs, newest first
+	ListRuns(ctx context.Context, reportID string, limit int) ([]Run, error)
+	DeleteRun(ctx context.Context, id string) error
+	// RunsBefore returns up to limit runs created before cutoff
+	RunsBefore(ctx context.Context, cutoff time.Time, limit int) ([]Run, error)
+	CountRunsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+var (
+	errReportNotFound = apperrors.NewNotFoundError("Report not found")
+	errRunNotFound    = apperrors.NewNotFoundError("Report run not found")
+)
+
+// MemoryStore keeps reports in memory, used when no database is configured
+type MemoryStore struct {
+	mu      sync.Mutex
+	reports map[string]Report
+	runs    map[string]Run
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{reports: make(map[string]Report), runs: make(map[string]Run)}
+}
+
+func (s *MemoryStore) SaveReport(ctx context.Context, r Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports[r.ID] = r
+	return nil
+}
+
+func (s *MemoryStore) GetReport(ctx context.Context, id string) (Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reports[id]
+	if !ok {
+		return Report{}, errReportNotFound
+	}
+	return r, nil
+}
+
+func (s *MemoryStore) ListReports(ctx context.Context) ([]Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Report, 0, len(s.reports))
+	for _, r := range s.reports {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteReport(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reports[id]; !ok {
+		return errReportNotFound
+	}
+	delete(s.reports, id)
+	for runID, run := range s.runs {
+		if run.ReportID == id {
+			delete(s.runs, runID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DueReports(ctx context.Context, now time.Time) ([]Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Report
+	for _, r := range s.reports {
+		if r.NextRunAt != nil && !r.NextRunAt.After(now) {
+			list = append(list, r)
+		}
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) ClaimSchedule(ctx context.Context, r Report, due time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.reports[r.ID]
+	if !ok || current.NextRunAt == nil || !current.NextRunAt.Equal(due) {
+		return false, nil
+	}
+	s.reports[r.ID] = r
+	return true, nil
+}
+
+func (s *MemoryStore) SaveRun(ctx context.Context, run Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[run.ID] = run
+	return nil
+}
+
+func (s *MemoryStore) GetRun(ctx context.Context, id string) (Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return Run{}, errRunNotFound
+	}
+	return run, nil
+}
+
+func (s *MemoryStore) ListRuns(ctx context.Context, reportID string, limit int) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Run{}
+	for _, run := range s.runs {
+		if run.ReportID == reportID {
+			list = append(list, run)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteRun(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.runs, id)
+	return nil
+}
+
+func (s *MemoryStore) RunsBefore(ctx context.Context, cutoff time.Time, limit int) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Run
+	for _, run := range s.runs {
+		if len(list) < limit && run.CreatedAt.Before(cutoff) {
+			list = append(list, run)
+		}
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) CountRunsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, run := range s.runs {
+		if run.CreatedAt.Before(cutoff) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// migrations create the reports and report_runs tables, with the records as JSON in
+// data. The next run time has a column of its own for polling and ClaimSchedule's
+// compare-and-set.
+var migrations = []module.Migration{{
+	Name: "create_reports",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS reports (
+			id          TEXT PRIMARY KEY,
+			name        TEXT NOT NULL,
+			next_run_at TIMESTAMP,
+			data        TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS reports_next_run_at ON reports (next_run_at);
+		CREATE TABLE IF NOT EXISTS report_runs (
+			id         TEXT PRIMARY KEY,
+			report_id  TEXT NOT NULL,
+			data       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS report_runs_report_id_created_at ON report_runs (report_id, created_at);
+		CREATE INDEX IF NOT EXISTS report_runs_created_at ON report_runs (created_at)`,
+}}
+
+// SQLStore persists reports in the reports and report_runs tables
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) SaveReport(ctx context.Context, r Report) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO reports (id, name, next_run_at, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, next_run_at = EXCLUDED.next_run_at, data = EXCLUDED.data`,
+		r.ID, r.Name, r.NextRunAt, string(data))
+	return err
+}
+
+func (s *SQLStore) GetReport(ctx context.Context, id string) (Report, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM reports WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, errReportNotFound
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	var r Report
+	return r, json.Unmarshal([]byte(data), &r)
+}
+
+func (s *SQLStore) ListReports(ctx context.Context) ([]Report, error) {
+	return queryJSON[Report](ctx, s.db, `SELECT data FROM reports ORDER BY name`)
+}
+
+func (s *SQLStore) DeleteReport(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM reports WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errReportNotFound
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM report_runs WHERE report_id = $1`, id)
+	return err
+}
+
+func (s *SQLStore) DueReports(ctx context.Context, now time.Time) ([]Report, error) {
+	return queryJSON[Report](ctx, s.db, `SELECT data FROM reports WHERE next_run_at <= $1 ORDER BY next_run_at`, now)
+}
+
+func (s *SQLStore) ClaimSchedule(ctx context.Context, r Report, due time.Time) (bool, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE reports SET next_run_at = $3, data = $4 WHERE id = $1 AND next_run_at = $2`,
+		r.ID, due, r.NextRunAt, string(data))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func (s *SQLStore) SaveRun(ctx context.Context, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO report_runs (id, report_id, data, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data`,
+		run.ID, run.ReportID, string(data), run.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) GetRun(ctx context.Context, id string) (Run, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM report_runs WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Run{}, errRunNotFound
+	}
+	if err != nil {
+		return Run{}, err
+	}
+	var run Run
+	return run, json.Unmarshal([]byte(data), &run)
+}
+
+func (s *SQLStore) ListRuns(ctx context.Context, reportID string, limit int) ([]Run, error) {
+	return queryJSON[Run](ctx, s.db, `
+		SELECT data FROM report_runs WHERE report_id = $1 ORDER BY created_at DESC LIMIT $2`, reportID, limit)
+}
+
+func (s *SQLStore) DeleteRun(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM report_runs WHERE id = $1`, id)
+	return err
+}
+
+func (s *SQLStore) RunsBefore(ctx context.Context, cutoff time.Time, limit int) ([]Run, error) {
+	return queryJSON[Run](ctx, s.db, `
+		SELECT data FROM report_runs WHERE created_at < $1 ORDER BY created_at LIMIT $2`, cutoff, limit)
+}
+
+func (s *SQLStore) CountRunsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM report_runs WHERE created_at < $1`, cutoff).Scan(&n)
+	return n, err
+}
+
+// queryJSON decodes the data column of every row a query returns
+func queryJSON[T any](ctx context.Context, db *sql.DB, query string, args ...any) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []T{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var v T
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
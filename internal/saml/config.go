@@ -0,0 +1,239 @@
+package saml
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+)
+
+// Config holds service provider configuration
+type Config struct {
+	BaseURL  string `yaml:"baseURL"`  // Public URL of this API, used for the entity ID and ACS URL
+	CertPath string `yaml:"certPath"` // SP signing certificate (PEM), generated at startup when empty
+	KeyPath  string `yaml:"keyPath"`  // SP private key (PEM)
+}
+
+// AttributeMapping names the assertion attributes copied onto the local user. Each is
+// matched against the attribute Name or FriendlyName.
+type AttributeMapping struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Roles string `json:"roles"`
+}
+
+// TenantConfig is the identity provider of one enterprise tenant. Either the metadata
+// XML or a URL to fetch it from must be set.
+type TenantConfig struct {
+	Tenant         string           `json:"tenant"`
+	IdPMetadataURL string           `json:"idpMetadataUrl,omitempty"`
+	IdPMetadataXML string           `json:"idpMetadataXml,omitempty"`
+	Attributes     AttributeMapping `json:"attributes"`
+	// RoleMapping turns the values of the roles attribute into local roles. Values
+	// it doesn't map are dropped, so an IdP can't grant roles like admin itself.
+	RoleMapping       map[string][]string `json:"roleMapping,omitempty"`
+	DefaultRoles      []string            `json:"defaultRoles"` // When no value of the roles attribute maps to one
+	AllowIDPInitiated bool                `json:"allowIdpInitiated"`
+	UpdatedAt         time.Time           `json:"updatedAt"`
+}
+
+// withDefaults fills in the attribute names most identity providers use
+func (tc TenantConfig) withDefaults() TenantConfig {
+	if tc.Attributes.Email == "" {
+		tc.Attributes.Email = "email"
+	}
+	if tc.Attributes.Name == "" {
+		tc.Attributes.Name = "displayName"
+	}
+	if tc.Attributes.Roles == "" {
+		tc.Attributes.Roles = "roles"
+	}
+	return tc
+}
+
+// Store persists per-tenant identity provider configuration
+type Store interface {
+	Get(ctx context.Context, tenant string) (TenantConfig, error)
+	List(ctx context.Context) ([]TenantConfig, error)
+	Put(ctx context.Context, tc TenantConfig) error
+	Delete(ctx context.Context, tenant string) error
+}
+
+var errTenantNotFound = apperrors.NewNotFoundError("SAML is not configured for this tenant")
+
+// MemoryStore keeps tenant configuration in memory, used when no database is configured
+type MemoryStore struct {
+	mu      sync.RWMutex
+	tenants map[string]TenantConfig
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tenants: make(map[string]TenantConfig)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, tenant string) (TenantConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tc, ok := s.tenants[tenant]
+	if !ok {
+		return TenantConfig{}, errTenantNotFound
+	}
+	return tc, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]TenantConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]TenantConfig, 0, len(s.tenants))
+	for _, tc := range s.tenants {
+		list = append(list, tc)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tenant < list[j].Tenant })
+	return list, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, tc TenantConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants[tc.Tenant] = tc
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, tenant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenant]; !ok {
+		return errTenantNotFound
+	}
+	delete(s.tenants, tenant)
+	return nil
+}
+
+// SQLStore persists tenant configuration in the saml_tenants table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the saml_tenants table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS saml_tenants (
+			tenant              TEXT PRIMARY KEY,
+			idp_metadata_url    TEXT NOT NULL DEFAULT '',
+			idp_metadata_xml    TEXT NOT NULL DEFAULT '',
+			attributes          TEXT NOT NULL DEFAULT '{}',
+			default_roles       TEXT NOT NULL DEFAULT '[]',
+			allow_idp_initiated BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at          TIMESTAMP NOT NULL,
+			role_mapping        TEXT NOT NULL DEFAULT '{}'
+		)`)
+	if err != nil || database.Dialect(s.db) == database.SQLite {
+		return err
+	}
+	// Tables created before roles were mapped lack the column. SQLite has no
+	// ADD COLUMN IF NOT EXISTS, but its tables never predate it.
+	_, err = s.db.ExecContext(ctx, `ALTER TABLE saml_tenants ADD COLUMN IF NOT EXISTS role_mapping TEXT NOT NULL DEFAULT '{}'`)
+	return err
+}
+
+const selectTenants = `SELECT tenant, idp_metadata_url, idp_metadata_xml, attributes, role_mapping, default_roles, allow_idp_initiated, updated_at FROM saml_tenants`
+
+func (s *SQLStore) Get(ctx context.Context, tenant string) (TenantConfig, error) {
+	tc, err := scanTenant(s.db.QueryRowContext(ctx, selectTenants+` WHERE tenant = $1`, tenant))
+	if errors.Is(err, sql.ErrNoRows) {
+		return TenantConfig{}, errTenantNotFound
+	}
+	return tc, err
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]TenantConfig, error) {
+	rows, err := s.db.QueryContext(ctx, selectTenants+` ORDER BY tenant`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []TenantConfig
+	for rows.Next() {
+		tc, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tc)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Put(ctx context.Context, tc TenantConfig) error {
+	attributes, err := json.Marshal(tc.Attributes)
+	if err != nil {
+		return err
+	}
+	mapping, err := json.Marshal(tc.RoleMapping)
+	if err != nil {
+		return err
+	}
+	roles, err := json.Marshal(tc.DefaultRoles)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO saml_tenants (tenant, idp_metadata_url, idp_metadata_xml, attributes, role_mapping, default_roles, allow_idp_initiated, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (tenant) DO UPDATE SET
+			idp_metadata_url = EXCLUDED.idp_metadata_url,
+			idp_metadata_xml = EXCLUDED.idp_metadata_xml,
+			attributes = EXCLUDED.attributes,
+			role_mapping = EXCLUDED.role_mapping,
+			default_roles = EXCLUDED.default_roles,
+			allow_idp_initiated = EXCLUDED.allow_idp_initiated,
+			updated_at = EXCLUDED.updated_at`,
+		tc.Tenant, tc.IdPMetadataURL, tc.IdPMetadataXML, string(attributes), string(mapping), string(roles), tc.AllowIDPInitiated, tc.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, tenant string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM saml_tenants WHERE tenant = $1`, tenant)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTenantNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTenant(row scanner) (TenantConfig, error) {
+	var tc TenantConfig
+	var attributes, mapping, roles string
+	if err := row.Scan(&tc.Tenant, &tc.IdPMetadataURL, &tc.IdPMetadataXML, &attributes, &mapping, &roles, &tc.AllowIDPInitiated, &tc.UpdatedAt); err != nil {
+		return TenantConfig{}, err
+	}
+	if err := json.Unmarshal([]byte(attributes), &tc.Attributes); err != nil {
+		return TenantConfig{}, err
+	}
+	if err := json.Unmarshal([]byte(mapping), &tc.RoleMapping); err != nil {
+		return TenantConfig{}, err
+	}
+	if err := json.Unmarshal([]byte(roles), &tc.DefaultRoles); err != nil {
+		return TenantConfig{}, err
+	}
+	return tc, nil
+}
@@ -0,0 +1,218 @@
+package saml
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/routing"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// requestCookie remembers the AuthnRequest ID so the response can be checked against it
+const requestCookie = "saml_request"
+
+// RegisterRoutes mounts the SP metadata, login and assertion consumer endpoints on a
+// public router group
+func (s *Service) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/:tenant/metadata", s.spMetadata)
+	rg.GET("/:tenant/login", routing.Query("redirect"), s.login)
+	rg.POST("/:tenant/acs", s.acs)
+}
+
+// RegisterAdminRoutes mounts tenant IdP configuration on an admin router group
+func (s *Service) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/saml/tenants", s.listTenants)
+	rg.GET("/saml/tenants/:tenant", s.getTenant)
+	rg.PUT("/saml/tenants/:tenant", s.putTenant)
+	rg.DELETE("/saml/tenants/:tenant", s.deleteTenant)
+}
+
+func (s *Service) spMetadata(c *gin.Context) {
+	tc, err := s.store.Get(c.Request.Context(), c.Param("tenant"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	sp, err := s.serviceProvider(c.Request.Context(), tc, false)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	body, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", body)
+}
+
+// safeRedirect only allows same-origin paths as the post-login destination
+func safeRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return ""
+	}
+	return target
+}
+
+func (s *Service) login(c *gin.Context) {
+	tc, err := s.store.Get(c.Request.Context(), c.Param("tenant"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	sp, err := s.serviceProvider(c.Request.Context(), tc, true)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding), gosaml.HTTPRedirectBinding, gosaml.HTTPPostBinding)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	redirect, err := req.Redirect(safeRedirect(c.Query("redirect")), sp)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The IdP posts back cross-site, so the cookie must be SameSite=None, which browsers
+	// only accept on secure cookies
+	secure := sp.AcsURL.Scheme == "https"
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     requestCookie,
+		Value:    req.ID,
+		Path:     sp.AcsURL.Path,
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+	c.Redirect(http.StatusFound, redirect.String())
+}
+
+func (s *Service) acs(c *gin.Context) {
+	ctx := c.Request.Context()
+	tc, err := s.store.Get(ctx, c.Param("tenant"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	sp, err := s.serviceProvider(ctx, tc, true)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var requestIDs []string
+	if cookie, err := c.Cookie(requestCookie); err == nil {
+		requestIDs = append(requestIDs, cookie)
+	}
+
+	assertion, err := sp.ParseResponse(c.Request, requestIDs)
+	if err != nil {
+		// The reason is hidden from the client but needed to debug IdP setups
+		reason := err
+		var invalid *gosaml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			reason = invalid.PrivateErr
+		}
+		logger.Warn("rejected SAML response", zap.String("tenant", tc.Tenant), zap.Error(reason))
+		c.Error(apperrors.NewUnauthorizedError("Invalid SAML response"))
+		return
+	}
+
+	u, err := s.provision(ctx, tc, assertion)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	token, err := s.tokens.Issue(u)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{Name: requestCookie, Path: sp.AcsURL.Path, MaxAge: -1})
+
+	expiresIn := strconv.Itoa(int(s.tokens.TTL().Seconds()))
+	if target := safeRedirect(c.PostForm("RelayState")); target != "" {
+		// Hand the token to the browser app in the fragment so it never reaches server logs
+		fragment := url.Values{"access_token": {token}, "token_type": {"Bearer"}, "expires_in": {expiresIn}}
+		c.Redirect(http.StatusFound, target+"#"+fragment.Encode())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accessToken": token, "tokenType": "Bearer", "expiresIn": s.tokens.TTL().Seconds(), "user": u})
+}
+
+func (s *Service) listTenants(c *gin.Context) {
+	list, err := s.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (s *Service) getTenant(c *gin.Context) {
+	tc, err := s.store.Get(c.Request.Context(), c.Param("tenant"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tc)
+}
+
+func (s *Service) putTenant(c *gin.Context) {
+	var tc TenantConfig
+	if err := bind.JSON(c, &tc); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid SAML configuration", err))
+		return
+	}
+	if tc.IdPMetadataXML == "" && tc.IdPMetadataURL == "" {
+		c.Error(apperrors.NewValidationError("idpMetadataXml or idpMetadataUrl is required"))
+		return
+	}
+	tc.Tenant = c.Param("tenant")
+	tc.UpdatedAt = time.Now().UTC()
+
+	// Reject metadata that can't be used before it breaks sign-in for the tenant
+	if _, err := s.loadMetadata(c.Request.Context(), tc); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid IdP metadata", err))
+		return
+	}
+
+	if err := s.store.Put(c.Request.Context(), tc); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tc)
+}
+
+func (s *Service) deleteTenant(c *gin.Context) {
+	if err := s.store.Delete(c.Request.Context(), c.Param("tenant")); err != nil {
+		c.Error(err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.metadata, c.Param("tenant"))
+	s.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
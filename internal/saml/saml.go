@@ -0,0 +1,241 @@
+package saml
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/internal/users"
+	"go-api/pkg/logger"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"go.uber.org/zap"
+)
+
+// metadataRefresh is how long metadata fetched from an IdP URL is cached
+const metadataRefresh = 24 * time.Hour
+
+type cachedMetadata struct {
+	descriptor *gosaml.EntityDescriptor
+	updatedAt  time.Time // TenantConfig.UpdatedAt the descriptor was loaded for
+	fetchedAt  time.Time
+}
+
+// Service is a SAML 2.0 service provider with one identity provider per tenant.
+// Users signing in through it are provisioned locally and receive an access token.
+type Service struct {
+	baseURL *url.URL
+	key     crypto.Signer
+	cert    *x509.Certificate
+	store   Store
+	users   users.Store
+	tokens  *users.TokenIssuer
+	client  *http.Client
+
+	mu       sync.Mutex
+	metadata map[string]cachedMetadata
+}
+
+// NewService creates a service provider. Without a configured certificate a
+// self-signed one is generated, which changes the SP metadata on every restart.
+func NewService(cfg Config, store Store, userStore users.Store, tokens *users.TokenIssuer) (*Service, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML base URL: %w", err)
+	}
+	if baseURL.Path == "" {
+		baseURL.Path = "/"
+	}
+
+	key, cert, err := loadCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{
+		baseURL:  baseURL,
+		key:      key,
+		cert:     cert,
+		store:    store,
+		users:    userStore,
+		tokens:   tokens,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		metadata: make(map[string]cachedMetadata),
+	}, nil
+}
+
+func loadCredentials(cfg Config) (crypto.Signer, *x509.Certificate, error) {
+	if cfg.CertPath != "" {
+		pair, err := tls.LoadX509KeyPair(cfg.CertPath, cfg.KeyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load SAML certificate: %w", err)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := pair.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported SAML private key type %T", pair.PrivateKey)
+		}
+		return key, cert, nil
+	}
+
+	logger.Warn("no SAML certificate configured, generating a temporary self-signed one")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "go-api SAML SP"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// serviceProvider builds the SP for a tenant. The IdP metadata is only loaded when
+// withIdP is set, so SP metadata can be served before the IdP is reachable.
+func (s *Service) serviceProvider(ctx context.Context, tc TenantConfig, withIdP bool) (*gosaml.ServiceProvider, error) {
+	base := s.baseURL.JoinPath("saml", tc.Tenant)
+	sp := &gosaml.ServiceProvider{
+		EntityID:          base.JoinPath("metadata").String(),
+		Key:               s.key,
+		Certificate:       s.cert,
+		HTTPClient:        s.client,
+		MetadataURL:       *base.JoinPath("metadata"),
+		AcsURL:            *base.JoinPath("acs"),
+		AllowIDPInitiated: tc.AllowIDPInitiated,
+		AuthnNameIDFormat: gosaml.UnspecifiedNameIDFormat,
+	}
+	if !withIdP {
+		return sp, nil
+	}
+
+	descriptor, err := s.idpMetadata(ctx, tc)
+	if err != nil {
+		return nil, err
+	}
+	sp.IDPMetadata = descriptor
+	return sp, nil
+}
+
+func (s *Service) idpMetadata(ctx context.Context, tc TenantConfig) (*gosaml.EntityDescriptor, error) {
+	s.mu.Lock()
+	cached, ok := s.metadata[tc.Tenant]
+	s.mu.Unlock()
+	if ok && cached.updatedAt.Equal(tc.UpdatedAt) && (tc.IdPMetadataURL == "" || time.Since(cached.fetchedAt) < metadataRefresh) {
+		return cached.descriptor, nil
+	}
+
+	descriptor, err := s.loadMetadata(ctx, tc)
+	if err != nil {
+		if ok && cached.updatedAt.Equal(tc.UpdatedAt) {
+			// Keep signing users in with the last good metadata if the IdP is unreachable
+			logger.Warn("failed to refresh IdP metadata", zap.String("tenant", tc.Tenant), zap.Error(err))
+			return cached.descriptor, nil
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.metadata[tc.Tenant] = cachedMetadata{descriptor: descriptor, updatedAt: tc.UpdatedAt, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return descriptor, nil
+}
+
+func (s *Service) loadMetadata(ctx context.Context, tc TenantConfig) (*gosaml.EntityDescriptor, error) {
+	if tc.IdPMetadataXML != "" {
+		return samlsp.ParseMetadata([]byte(tc.IdPMetadataXML))
+	}
+	if tc.IdPMetadataURL == "" {
+		return nil, fmt.Errorf("tenant %s has no IdP metadata", tc.Tenant)
+	}
+	u, err := url.Parse(tc.IdPMetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	return samlsp.FetchMetadata(ctx, s.client, *u)
+}
+
+// attribute returns the values of the first attribute matching name
+func attribute(assertion *gosaml.Assertion, name string) []string {
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			values := make([]string, 0, len(attr.Values))
+			for _, v := range attr.Values {
+				values = append(values, v.Value)
+			}
+			return values
+		}
+	}
+	return nil
+}
+
+// mapRoles turns the values of the roles attribute into the local roles the
+// tenant's mapping gives them, dropping values it doesn't map
+func mapRoles(tc TenantConfig, values []string) []string {
+	var roles []string
+	for _, v := range values {
+		for _, role := range tc.RoleMapping[v] {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
+
+// provision maps a validated assertion onto a local user
+func (s *Service) provision(ctx context.Context, tc TenantConfig, assertion *gosaml.Assertion) (users.User, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return users.User{}, fmt.Errorf("assertion has no NameID")
+	}
+	tc = tc.withDefaults()
+
+	u := users.User{
+		Tenant:     tc.Tenant,
+		Provider:   "saml:" + tc.Tenant,
+		ExternalID: assertion.Subject.NameID.Value,
+		Roles:      mapRoles(tc, attribute(assertion, tc.Attributes.Roles)),
+	}
+	if values := attribute(assertion, tc.Attributes.Email); len(values) > 0 {
+		u.Email = values[0]
+	} else {
+		u.Email = u.ExternalID
+	}
+	if values := attribute(assertion, tc.Attributes.Name); len(values) > 0 {
+		u.Name = values[0]
+	}
+	if len(u.Roles) == 0 {
+		u.Roles = tc.DefaultRoles
+	}
+
+	return users.Provision(ctx, s.users, u)
+}
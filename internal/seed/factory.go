@@ -0,0 +1,102 @@
+package seed
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"go-api/internal/users"
+)
+
+// Factory generates realistic fake records for load testing. Every record is
+// derived from the seed and its position alone, so generating more records keeps
+// the ones generated before, and re-runs upsert them instead of adding new ones.
+type Factory struct {
+	seed uint64
+	now  time.Time
+}
+
+// NewFactory creates a factory; factories with the same seed generate the same
+// records
+func NewFactory(seed uint64) *Factory {
+	// Dates are spread over the year before a fixed day, so they don't change between runs
+	return &Factory{seed: seed, now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// rand returns the generator of one record
+func (f *Factory) rand(kind, tenant string, n int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%d", kind, tenant, n)
+	return rand.New(rand.NewPCG(f.seed, h.Sum64()))
+}
+
+// Tenant returns the ID of the nth generated tenant
+func (f *Factory) Tenant(n int) string {
+	r := f.rand("tenant", "", n)
+	return fmt.Sprintf("%s-%s-%d", pick(r, companyWords), pick(r, companySuffixes), n+1)
+}
+
+// User returns the nth generated user of tenant, mostly plain users with some
+// admins, most of whom have logged in recently
+func (f *Factory) User(tenant string, n int) users.User {
+	r := f.rand("user", tenant, n)
+	first, last := pick(r, firstNames), pick(r, lastNames)
+	created := f.now.Add(-time.Duration(r.Int64N(int64(365 * 24 * time.Hour))))
+	u := users.User{
+		ID:        fmt.Sprintf("seed-%s-user-%d", tenant, n+1),
+		Tenant:    tenant,
+		Email:     fmt.Sprintf("%s.%s%d@%s.example.com", strings.ToLower(first), strings.ToLower(last), n+1, tenant),
+		Name:      first + " " + last,
+		Roles:     []string{"user"},
+		Timezone:  pick(r, timezones),
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+	if r.IntN(20) == 0 {
+		u.Roles = []string{"admin"}
+	}
+	if r.IntN(10) < 8 {
+		login := created.Add(time.Duration(r.Int64N(int64(f.now.Sub(created)) + 1)))
+		u.LastLoginAt = &login
+	}
+	return u
+}
+
+// APIKey returns the nth generated API key of tenant
+func (f *Factory) APIKey(tenant string, n int) APIKey {
+	r := f.rand("apikey", tenant, n)
+	token := make([]byte, 32)
+	for i := range token {
+		token[i] = byte(r.UintN(256))
+	}
+	return APIKey{
+		ID:     fmt.Sprintf("seed-%s-key-%d", tenant, n+1),
+		Name:   fmt.Sprintf("%s %s", pick(r, keyPurposes), tenant),
+		Tenant: tenant,
+		Plan:   pick(r, plans),
+		Token:  "gak_" + base64.RawURLEncoding.EncodeToString(token),
+	}
+}
+
+func pick(r *rand.Rand, values []string) string {
+	return values[r.IntN(len(values))]
+}
+
+var (
+	firstNames = []string{"Amara", "Ben", "Chen", "Diego", "Elif", "Fatima", "Gabriel", "Hana", "Ivan", "Julia",
+		"Kwame", "Lena", "Mateo", "Nadia", "Omar", "Priya", "Quentin", "Rosa", "Sven", "Tariq", "Uma", "Victor",
+		"Wen", "Yusuf", "Zoe"}
+	lastNames = []string{"Adeyemi", "Bauer", "Castillo", "Dubois", "Eriksson", "Fischer", "Garcia", "Hoang",
+		"Ivanova", "Jansen", "Kim", "Larsen", "Moreau", "Nakamura", "Okafor", "Patel", "Rossi", "Silva",
+		"Tanaka", "Novak", "Weber", "Yilmaz", "Zhang"}
+	timezones = []string{"America/New_York", "America/Chicago", "America/Los_Angeles", "America/Sao_Paulo",
+		"Europe/London", "Europe/Berlin", "Europe/Istanbul", "Africa/Lagos", "Asia/Dhaka", "Asia/Kolkata",
+		"Asia/Singapore", "Asia/Tokyo", "Australia/Sydney", ""}
+	companyWords    = []string{"acme", "globex", "initech", "umbrella", "stark", "wayne", "hooli", "vandelay", "soylent", "tyrell"}
+	companySuffixes = []string{"labs", "corp", "group", "systems", "works", "co"}
+	keyPurposes     = []string{"CI", "Backend", "Reporting", "Integration", "Mobile app", "Data export"}
+	plans           = []string{"free", "free", "pro", "pro", "enterprise"}
+)
@@ -0,0 +1,232 @@
+// Package seed loads fixture data into the database for development, tests and
+// load testing. A seed set lists records to create and how many fake ones to
+// generate; seeding upserts by stable IDs, so running a set again updates its
+// records rather than duplicating them.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go-api/internal/apikey"
+	"go-api/internal/users"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+//go:embed sets/*.json
+var sets embed.FS
+
+// Set is a named collection of fixtures, like the data of the development
+// environment
+type Set struct {
+	Name     string       `json:"-"`
+	Wipeable bool         `json:"wipeable"` // Whether --wipe may empty the database first; only for throwaway databases
+	Users    []users.User `json:"users"`
+	APIKeys  []APIKey     `json:"apiKeys"`
+	Generate Volume       `json:"generate"`
+}
+
+// APIKey is a seeded API key. The token is given, rather than generated, so
+// developers and test suites can use it.
+type APIKey struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Tenant string `json:"tenant,omitempty"`
+	Plan   string `json:"plan,omitempty"`
+	Token  string `json:"token"`
+}
+
+// Volume is how many fake records the factory generates
+type Volume struct {
+	Tenants        int    `json:"tenants"`
+	UsersPerTenant int    `json:"usersPerTenant"`
+	KeysPerTenant  int    `json:"keysPerTenant"`
+	Seed           uint64 `json:"seed"` // Of the generator; the same seed generates the same records
+}
+
+// Load returns the embedded set called name, or the set in file when it isn't empty
+func Load(name, file string) (Set, error) {
+	var raw []byte
+	var err error
+	if file != "" {
+		raw, err = os.ReadFile(file)
+	} else {
+		raw, err = sets.ReadFile("sets/" + name + ".json")
+		if errors.Is(err, os.ErrNotExist) {
+			return Set{}, fmt.Errorf("no seed set %q, expected one of %s", name, strings.Join(Names(), ", "))
+		}
+	}
+	if err != nil {
+		return Set{}, err
+	}
+	set := Set{Name: name}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return Set{}, fmt.Errorf("seed set %s: %w", name, err)
+	}
+	return set, nil
+}
+
+// Names lists the embedded sets
+func Names() []string {
+	entries, _ := sets.ReadDir("sets")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	return names
+}
+
+// Stats counts what seeding wrote
+type Stats struct {
+	Users   int `json:"users"`
+	APIKeys int `json:"apiKeys"` // Created; existing keys are left alone
+}
+
+// Seeder writes sets to the stores
+type Seeder struct {
+	users   users.Store
+	apiKeys apikey.Store
+}
+
+// NewSeeder creates a seeder writing to the given stores
+func NewSeeder(userStore users.Store, apiKeys apikey.Store) *Seeder {
+	return &Seeder{users: userStore, apiKeys: apiKeys}
+}
+
+// Run upserts the records of set, then the generated ones
+func (s *Seeder) Run(ctx context.Context, set Set) (Stats, error) {
+	var stats Stats
+	now := time.Now().UTC()
+	for _, u := range set.Users {
+		if u.CreatedAt.IsZero() {
+			u.CreatedAt = now
+		}
+		u.UpdatedAt = now
+		if err := s.users.Save(ctx, u); err != nil {
+			return stats, fmt.Errorf("user %s: %w", u.ID, err)
+		}
+		stats.Users++
+	}
+	for _, k := range set.APIKeys {
+		created, err := s.apiKey(ctx, k, now)
+		if err != nil {
+			return stats, fmt.Errorf("api key %s: %w", k.ID, err)
+		}
+		if created {
+			stats.APIKeys++
+		}
+	}
+
+	v := set.Generate
+	if v.Tenants <= 0 || (v.UsersPerTenant <= 0 && v.KeysPerTenant <= 0) {
+		return stats, nil
+	}
+	f := NewFactory(v.Seed)
+	for t := 0; t < v.Tenants; t++ {
+		tenant := f.Tenant(t)
+		for i := 0; i < v.UsersPerTenant; i++ {
+			if err := s.users.Save(ctx, f.User(tenant, i)); err != nil {
+				return stats, fmt.Errorf("generated user %d of %s: %w", i, tenant, err)
+			}
+			if stats.Users++; stats.Users%1000 == 0 {
+				logger.Info("seeding users", zap.Int("users", stats.Users))
+			}
+		}
+		for i := 0; i < v.KeysPerTenant; i++ {
+			created, err := s.apiKey(ctx, f.APIKey(tenant, i), now)
+			if err != nil {
+				return stats, fmt.Errorf("generated api key %d of %s: %w", i, tenant, err)
+			}
+			if created {
+				stats.APIKeys++
+			}
+		}
+	}
+	return stats, nil
+}
+
+// apiKey creates a key unless its token is already stored. Keys can't be updated,
+// so a key whose token changed in the set has to be revoked or wiped first.
+func (s *Seeder) apiKey(ctx context.Context, k APIKey, now time.Time) (bool, error) {
+	if k.ID == "" || len(k.Token) < 10 {
+		return false, fmt.Errorf("id and a token of at least 10 characters are required")
+	}
+	hash := apikey.HashToken(k.Token)
+	if _, err := s.apiKeys.FindByHash(ctx, hash); err == nil {
+		return false, nil
+	} else if !errors.Is(err, apperrors.ErrNotFound) {
+		return false, err
+	}
+	err := s.apiKeys.Create(ctx, apikey.Key{ID: k.ID, Name: k.Name, Prefix: k.Token[:10], Tenant: k.Tenant, Plan: k.Plan,
+		Hash: hash, CreatedAt: now})
+	return err == nil, err
+}
+
+// Wipe deletes the rows of every table of the shared database, except for the
+// record of applied migrations, so the schema stays in place. Tenants' own schemas
+// and databases are left alone.
+func Wipe(ctx context.Context, db *sql.DB) ([]string, error) {
+	listTables := `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' AND table_name <> 'schema_migrations'
+		ORDER BY table_name`
+	if database.Dialect(db) == database.SQLite {
+		listTables = `
+			SELECT name FROM sqlite_master
+			WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name <> 'schema_migrations'
+			ORDER BY name`
+	}
+	rows, err := db.QueryContext(ctx, listTables)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(tables) == 0 {
+		return nil, err
+	}
+
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = `"` + strings.ReplaceAll(table, `"`, `""`) + `"`
+	}
+	if database.Dialect(db) != database.SQLite {
+		_, err := db.ExecContext(ctx, `TRUNCATE `+strings.Join(quoted, ", ")+` CASCADE`)
+		return tables, err
+	}
+
+	// SQLite has no TRUNCATE; foreign keys are checked once every table is empty
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return nil, err
+	}
+	for _, table := range quoted {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+			return nil, err
+		}
+	}
+	return tables, tx.Commit()
+}
@@ -0,0 +1,299 @@
+// Package settings declares the settings tenants and their users may change at
+// runtime. Modules declare each setting with its type, default and rules; a key
+// may be a template with * segments, like notifications.*.email, declaring every
+// key of that shape at once. Handlers read the value in effect for the caller
+// with Get, which is the user's override, else the tenant's, else the default.
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+)
+
+var (
+	// ErrUnknown is returned for keys no definition declares
+	ErrUnknown = errors.New("settings: unknown setting")
+	// ErrInvalid is returned for values not of a setting's type or rules
+	ErrInvalid = errors.New("settings: invalid value")
+)
+
+// ValueError is a value breaking a rule of its setting
+type ValueError struct {
+	Key     string
+	Rule    string // Like type, min or oneof
+	Param   string // Of the rule, like the 10 of min
+	Message string
+}
+
+func (e *ValueError) Error() string { return ErrInvalid.Error() + ": " + e.Key + " " + e.Message }
+
+func (e *ValueError) Unwrap() error { return ErrInvalid }
+
+// FieldErrors describes the problem as one of the value of a request
+func (e *ValueError) FieldErrors() []apperrors.FieldError {
+	return []apperrors.FieldError{{Pointer: "/value", Field: "value", Rule: e.Rule, Param: e.Param, Message: "value " + e.Message}}
+}
+
+func init() {
+	apperrors.Register(ErrUnknown, apperrors.CodeNotFound)
+	apperrors.Register(ErrInvalid, apperrors.CodeValidation)
+}
+
+// Type is the kind of value of a setting, and the Go type Get returns it as
+type Type string
+
+const (
+	String   Type = "string"   // string
+	Int      Type = "int"      // int
+	Float    Type = "float"    // float64
+	Bool     Type = "bool"     // bool
+	Duration Type = "duration" // time.Duration, written like 1h30m
+	List     Type = "list"     // []string
+)
+
+// Scopes of a setting, of who may override it
+const (
+	ScopeTenant = "tenant" // Only the tenant, for all its users
+	ScopeUser   = "user"   // Each user too, over the tenant's value
+)
+
+// Definition declares a setting
+type Definition struct {
+	Key         string `json:"key"` // Dotted lowercase, like uploads.max_files; segments of templates may be *
+	Type        Type   `json:"type"`
+	Default     any    `json:"default"`
+	Description string `json:"description,omitempty"`
+	Scope       string `json:"scope,omitempty"` // tenant or user; tenant when empty
+	// Min and Max bound numbers, the length of strings and the items of lists
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	OneOf   []string `json:"oneOf,omitempty"`   // Values strings and list items may take
+	Pattern string   `json:"pattern,omitempty"` // Regular expression strings have to match
+}
+
+// Declarer is implemented by modules having settings
+type Declarer interface {
+	Settings() []Definition
+}
+
+// Host is implemented by the module keeping the overrides. Load hands it the
+// definitions every module declares.
+type Host interface {
+	Declare(defs []Definition)
+}
+
+// keyPattern is what keys and templates look like
+var keyPattern = regexp.MustCompile(`^([a-z0-9_]+|\*)(\.([a-z0-9_]+|\*))*$`)
+
+// Template reports whether the definition declares keys of a shape rather than one
+func (d Definition) Template() bool {
+	return slices.Contains(strings.Split(d.Key, "."), "*")
+}
+
+// Matches reports whether the definition declares key, a * segment of its
+// key matching any one segment. Templates are no keys themselves.
+func (d Definition) Matches(key string) bool {
+	pattern, segments := strings.Split(d.Key, "."), strings.Split(key, ".")
+	if len(pattern) != len(segments) || !keyPattern.MatchString(key) {
+		return false
+	}
+	for i, p := range pattern {
+		if segments[i] == "*" || p != "*" && p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Check validates the definition and returns it with its scope set and its
+// default converted to its type
+func (d Definition) Check() (Definition, error) {
+	if !keyPattern.MatchString(d.Key) {
+		return d, fmt.Errorf("settings: key %q is not dotted lowercase segments", d.Key)
+	}
+	switch d.Type {
+	case String, Int, Float, Bool, Duration, List:
+	default:
+		return d, fmt.Errorf("settings: %s has unknown type %q", d.Key, d.Type)
+	}
+	switch d.Scope {
+	case "":
+		d.Scope = ScopeTenant
+	case ScopeTenant, ScopeUser:
+	default:
+		return d, fmt.Errorf("settings: %s has unknown scope %q, want %s or %s", d.Key, d.Scope, ScopeTenant, ScopeUser)
+	}
+	if d.Pattern != "" {
+		if _, err := regexp.Compile(d.Pattern); err != nil {
+			return d, fmt.Errorf("settings: %s pattern: %w", d.Key, err)
+		}
+	}
+	value, err := d.Convert(d.Default)
+	if err != nil {
+		return d, fmt.Errorf("settings: %s default: %w", d.Key, err)
+	}
+	d.Default = value
+	return d, nil
+}
+
+// Convert returns a value as the setting's type, failing with a *ValueError
+// unless it passes its rules. The value may be of the Go type already, decoded
+// from JSON or JSON itself, as a number for int.
+func (d Definition) Convert(v any) (any, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, &ValueError{Key: d.Key, Rule: "json", Message: "must be JSON"}
+		}
+	}
+	value, err := d.convert(v)
+	if err != nil {
+		return nil, err
+	}
+	return value, d.check(value)
+}
+
+func (d Definition) convert(v any) (any, error) {
+	invalid := &ValueError{Key: d.Key, Rule: "type", Param: string(d.Type), Message: "must be of type " + string(d.Type)}
+	switch d.Type {
+	case String:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case Int:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case int64:
+			return int(n), nil
+		case float64:
+			if n == float64(int(n)) {
+				return int(n), nil
+			}
+		}
+	case Float:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		}
+	case Bool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case Duration:
+		switch t := v.(type) {
+		case time.Duration:
+			return t, nil
+		case string:
+			if parsed, err := time.ParseDuration(t); err == nil {
+				return parsed, nil
+			}
+		}
+	case List:
+		switch l := v.(type) {
+		case []string:
+			return slices.Clone(l), nil
+		case []any:
+			list := make([]string, 0, len(l))
+			for _, item := range l {
+				s, ok := item.(string)
+				if !ok {
+					return nil, invalid
+				}
+				list = append(list, s)
+			}
+			return list, nil
+		case nil:
+			return []string{}, nil
+		}
+	}
+	return nil, invalid
+}
+
+// check applies the rules of the definition to a converted value
+func (d Definition) check(v any) error {
+	var size float64
+	var values []string
+	switch t := v.(type) {
+	case string:
+		size, values = float64(len([]rune(t))), []string{t}
+		if d.Pattern != "" && !regexp.MustCompile(d.Pattern).MatchString(t) {
+			return &ValueError{Key: d.Key, Rule: "pattern", Param: d.Pattern, Message: "must match " + d.Pattern}
+		}
+	case int:
+		size = float64(t)
+	case float64:
+		size = t
+	case []string:
+		size, values = float64(len(t)), t
+	default:
+		return nil
+	}
+	if d.Min != nil && size < *d.Min {
+		bound := strconv.FormatFloat(*d.Min, 'f', -1, 64)
+		return &ValueError{Key: d.Key, Rule: "min", Param: bound, Message: "must be at least " + bound}
+	}
+	if d.Max != nil && size > *d.Max {
+		bound := strconv.FormatFloat(*d.Max, 'f', -1, 64)
+		return &ValueError{Key: d.Key, Rule: "max", Param: bound, Message: "must be at most " + bound}
+	}
+	if len(d.OneOf) > 0 {
+		for _, s := range values {
+			if !slices.Contains(d.OneOf, s) {
+				return &ValueError{Key: d.Key, Rule: "oneof", Param: strings.Join(d.OneOf, " "),
+					Message: "must be one of " + strings.Join(d.OneOf, ", ")}
+			}
+		}
+	}
+	return nil
+}
+
+// Resolver returns the value of a setting in effect for the subject in ctx
+type Resolver interface {
+	Resolve(ctx context.Context, key string) (any, error)
+}
+
+var (
+	mu       sync.RWMutex
+	resolver Resolver
+)
+
+// Use makes Get read settings through r, as the module keeping the overrides
+// does once built
+func Use(r Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+	resolver = r
+}
+
+// Get returns the value of a setting in effect for the subject in ctx, as the
+// Go type of its Type
+func Get[T any](ctx context.Context, key string) (T, error) {
+	var zero T
+	mu.RLock()
+	r := resolver
+	mu.RUnlock()
+	if r == nil {
+		return zero, fmt.Errorf("%w %s: no settings module loaded", ErrUnknown, key)
+	}
+	v, err := r.Resolve(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	t, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("settings: %s is a %T, not %T", key, v, zero)
+	}
+	return t, nil
+}
@@ -0,0 +1,26 @@
+package slo
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes SLO compliance to admins
+type Handler struct {
+	tracker *Tracker
+}
+
+// NewHandler creates an SLO handler
+func NewHandler(tracker *Tracker) *Handler {
+	return &Handler{tracker: tracker}
+}
+
+// RegisterRoutes mounts the SLO endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/slo", h.status)
+}
+
+func (h *Handler) status(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.tracker.Status()})
+}
@@ -0,0 +1,41 @@
+package slo
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "slo_requests_total",
+		Help: "Requests counted against an objective, by outcome: good, slow or failed.",
+	}, []string{"objective", "outcome"})
+
+	ratioDesc    = prometheus.NewDesc("slo_success_ratio", "Fraction of good requests over the objective's window.", []string{"objective", "indicator"}, nil)
+	targetDesc   = prometheus.NewDesc("slo_target", "Target success ratio of an objective.", []string{"objective", "indicator"}, nil)
+	budgetDesc   = prometheus.NewDesc("slo_error_budget_remaining", "Fraction of the error budget left over the objective's window.", []string{"objective", "indicator"}, nil)
+	burnRateDesc = prometheus.NewDesc("slo_burn_rate", "Rate the error budget is being spent at over a trailing window, 1 spends it exactly.", []string{"objective", "indicator", "window"}, nil)
+)
+
+// Describe implements prometheus.Collector
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ratioDesc
+	ch <- targetDesc
+	ch <- budgetDesc
+	ch <- burnRateDesc
+}
+
+// Collect implements prometheus.Collector, computing compliance at scrape time
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range t.Status() {
+		name := s.Objective.Name
+		for _, ind := range s.Indicators {
+			ch <- prometheus.MustNewConstMetric(ratioDesc, prometheus.GaugeValue, ind.Ratio, name, ind.Name)
+			ch <- prometheus.MustNewConstMetric(targetDesc, prometheus.GaugeValue, ind.Target, name, ind.Name)
+			ch <- prometheus.MustNewConstMetric(budgetDesc, prometheus.GaugeValue, ind.BudgetRemaining, name, ind.Name)
+			for window, rate := range ind.BurnRates {
+				ch <- prometheus.MustNewConstMetric(burnRateDesc, prometheus.GaugeValue, rate, name, ind.Name, window)
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Package slo tracks service level objectives declared per route group. Requests are
+// counted against every objective whose prefix they match, in one-minute buckets
+// covering the objective's window, from which success ratios, remaining error budget
+// and burn rates are derived.
+package slo
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds the declared objectives
+type Config struct {
+	Objectives []Objective `yaml:"objectives"`
+}
+
+// Objective sets availability and latency targets for the routes under Prefix.
+// Availability is the fraction of requests that must not fail with a server error;
+// LatencyTarget the fraction that must complete within Latency. A zero target
+// disables that indicator.
+type Objective struct {
+	Name          string        `json:"name"`
+	Prefix        string        `json:"prefix"`
+	Availability  float64       `json:"availability,omitempty"`
+	Latency       time.Duration `json:"latency,omitempty"`
+	LatencyTarget float64       `json:"latencyTarget,omitempty"`
+	Window        time.Duration `json:"window"` // Period compliance is measured over
+}
+
+// UnmarshalJSON accepts durations written like "300ms" or "24h"
+func (o *Objective) UnmarshalJSON(b []byte) error {
+	type objective Objective
+	var raw struct {
+		objective
+		Latency string `json:"latency"`
+		Window  string `json:"window"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*o = Objective(raw.objective)
+	var err error
+	if raw.Latency != "" {
+		if o.Latency, err = time.ParseDuration(raw.Latency); err != nil {
+			return err
+		}
+	}
+	if raw.Window != "" {
+		if o.Window, err = time.ParseDuration(raw.Window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes durations in the form UnmarshalJSON accepts
+func (o Objective) MarshalJSON() ([]byte, error) {
+	type objective Objective
+	raw := struct {
+		objective
+		Latency string `json:"latency,omitempty"`
+		Window  string `json:"window"`
+	}{objective: objective(o), Window: o.Window.String()}
+	if o.Latency > 0 {
+		raw.Latency = o.Latency.String()
+	}
+	return json.Marshal(raw)
+}
+
+func (o Objective) validate() error {
+	switch {
+	case o.Name == "":
+		return errors.New("name is required")
+	case o.Window < time.Minute:
+		return errors.New("window must be at least 1m")
+	case o.Availability < 0 || o.Availability >= 1, o.LatencyTarget < 0 || o.LatencyTarget >= 1:
+		return errors.New("targets must be at least 0 and below 1")
+	case o.LatencyTarget > 0 && o.Latency <= 0:
+		return errors.New("latency is required with a latency target")
+	case o.Availability == 0 && o.LatencyTarget == 0:
+		return errors.New("at least one target is required")
+	}
+	return nil
+}
+
+// Indicators measured for an objective
+const (
+	Availability = "availability"
+	Latency      = "latency"
+)
+
+// BurnWindows are the trailing windows burn rates are reported over. A fast burn over
+// both the short and long window is the usual page-worthy signal.
+var BurnWindows = []time.Duration{5 * time.Minute, time.Hour}
+
+type bucket struct {
+	minute        int64
+	total, failed int
+	slow          int
+}
+
+type counts struct {
+	total, failed, slow int
+}
+
+// tracker keeps the buckets of one objective
+type tracker struct {
+	objective Objective
+	buckets   []bucket
+}
+
+func (t *tracker) add(now time.Time, failed, slow bool) {
+	minute := now.Unix() / 60
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.total++
+	if failed {
+		b.failed++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+// counts sums the buckets within d of now
+func (t *tracker) counts(now time.Time, d time.Duration) counts {
+	oldest := now.Unix()/60 - int64(d/time.Minute) + 1
+	var c counts
+	for _, b := range t.buckets {
+		if b.minute >= oldest {
+			c.total += b.total
+			c.failed += b.failed
+			c.slow += b.slow
+		}
+	}
+	return c
+}
+
+// Tracker records requests against the configured objectives
+type Tracker struct {
+	mu       sync.Mutex
+	trackers []*tracker
+}
+
+// New creates a tracker for the objectives in cfg
+func New(cfg Config) (*Tracker, error) {
+	t := &Tracker{}
+	for _, o := range cfg.Objectives {
+		if err := o.validate(); err != nil {
+			return nil, errors.New("slo " + o.Name + ": " + err.Error())
+		}
+		t.trackers = append(t.trackers, &tracker{objective: o, buckets: make([]bucket, int(o.Window/time.Minute))})
+	}
+	return t, nil
+}
+
+// Middleware counts each request against the objectives covering its route. Server
+// errors count against availability, and requests slower than the objective's
+// latency against latency. Requests the client abandoned are left out.
+func (t *Tracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if apperrors.ClientDisconnected(c.Request.Context()) {
+			return
+		}
+		latency := time.Since(start)
+		failed := c.Writer.Status() >= http.StatusInternalServerError
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+
+		now := time.Now()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for _, tr := range t.trackers {
+			if !strings.HasPrefix(path, tr.objective.Prefix) {
+				continue
+			}
+			slow := tr.objective.Latency > 0 && latency > tr.objective.Latency
+			tr.add(now, failed, slow)
+			requestsTotal.WithLabelValues(tr.objective.Name, outcome(failed, slow)).Inc()
+		}
+	}
+}
+
+func outcome(failed, slow bool) string {
+	switch {
+	case failed:
+		return "failed"
+	case slow:
+		return "slow"
+	}
+	return "good"
+}
+
+// Indicator reports one indicator of an objective over its window
+type Indicator struct {
+	Name            string             `json:"name"`
+	Target          float64            `json:"target"`
+	Ratio           float64            `json:"ratio"` // Fraction of good requests, 1 without traffic
+	Good            int                `json:"good"`
+	Total           int                `json:"total"`
+	BudgetRemaining float64            `json:"budgetRemaining"` // Fraction of the error budget left, negative once exhausted
+	BurnRates       map[string]float64 `json:"burnRates"`       // By trailing window
+	Compliant       bool               `json:"compliant"`
+}
+
+// Status reports an objective's compliance
+type Status struct {
+	Objective  Objective   `json:"objective"`
+	Indicators []Indicator `json:"indicators"`
+	Compliant  bool        `json:"compliant"`
+}
+
+// Status reports the compliance of every objective
+func (t *Tracker) Status() []Status {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]Status, 0, len(t.trackers))
+	for _, tr := range t.trackers {
+		s := Status{Objective: tr.objective, Compliant: true}
+		for _, ind := range tr.indicators(now) {
+			s.Indicators = append(s.Indicators, ind)
+			s.Compliant = s.Compliant && ind.Compliant
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+func (tr *tracker) indicators(now time.Time) []Indicator {
+	o := tr.objective
+	period := tr.counts(now, o.Window)
+	burn := make([]counts, len(BurnWindows))
+	for i, d := range BurnWindows {
+		burn[i] = tr.counts(now, min(d, o.Window))
+	}
+
+	var list []Indicator
+	add := func(name string, target float64, bad func(counts) int) {
+		ind := Indicator{
+			Name:      name,
+			Target:    target,
+			Total:     period.total,
+			Good:      period.total - bad(period),
+			BurnRates: make(map[string]float64, len(BurnWindows)),
+		}
+		errRatio := ratio(bad(period), period.total)
+		ind.Ratio = 1 - errRatio
+		ind.BudgetRemaining = 1 - errRatio/(1-target)
+		ind.Compliant = ind.Ratio >= target
+		for i, d := range BurnWindows {
+			ind.BurnRates[windowLabel(d)] = ratio(bad(burn[i]), burn[i].total) / (1 - target)
+		}
+		list = append(list, ind)
+	}
+	if o.Availability > 0 {
+		add(Availability, o.Availability, func(c counts) int { return c.failed })
+	}
+	if o.LatencyTarget > 0 {
+		add(Latency, o.LatencyTarget, func(c counts) int { return c.slow })
+	}
+	return list
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func windowLabel(d time.Duration) string {
+	s := d.String()
+	s = strings.TrimSuffix(s, "0s")
+	return strings.TrimSuffix(s, "0m")
+}
@@ -0,0 +1,144 @@
+package static
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds static file serving configuration
+type Config struct {
+	Enabled     bool     `yaml:"enabled"`
+	Dir         string   `yaml:"dir"`         // On-disk build directory, empty serves the embedded build
+	Index       string   `yaml:"index"`       // SPA entry point served for unknown non-API routes
+	APIPrefixes []string `yaml:"apiPrefixes"` // Paths that never fall back to the SPA
+}
+
+// immutableAsset matches fingerprinted build output such as app.3f9a1c2b.js
+var immutableAsset = regexp.MustCompile(`[.-][0-9a-f]{8,}\.[a-z0-9]+$`)
+
+// encodings lists precompressed variants in order of preference
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Server serves a frontend build with SPA history-mode fallback
+type Server struct {
+	cfg Config
+	fs  fs.FS
+}
+
+// New creates a static server reading from cfg.Dir, or from embedded when no directory is set
+func New(cfg Config, embedded fs.FS) *Server {
+	if cfg.Index == "" {
+		cfg.Index = "index.html"
+	}
+	files := embedded
+	if cfg.Dir != "" {
+		files = os.DirFS(cfg.Dir)
+	}
+	return &Server{cfg: cfg, fs: files}
+}
+
+// Handler is meant to be mounted with NoRoute so API routes always take precedence
+func (s *Server) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if (method != http.MethodGet && method != http.MethodHead) || s.isAPIPath(c.Request.URL.Path) {
+			c.Error(apperrors.NewNotFoundError("Route not found"))
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+c.Request.URL.Path), "/")
+		if name == "" {
+			name = s.cfg.Index
+		}
+
+		if !s.exists(name) {
+			// Paths with an extension are missing assets, everything else is a client-side route
+			if path.Ext(name) != "" {
+				c.Error(apperrors.NewNotFoundError("File not found"))
+				return
+			}
+			name = s.cfg.Index
+		}
+
+		s.serve(c, name)
+	}
+}
+
+func (s *Server) serve(c *gin.Context, name string) {
+	w := c.Writer
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	switch {
+	case name == s.cfg.Index:
+		w.Header().Set("Cache-Control", "no-cache")
+	case immutableAsset.MatchString(name):
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	served := name
+	accept := c.GetHeader("Accept-Encoding")
+	for _, enc := range encodings {
+		if strings.Contains(accept, enc.name) && s.exists(name+enc.ext) {
+			w.Header().Set("Content-Encoding", enc.name)
+			served = name + enc.ext
+			break
+		}
+	}
+
+	f, err := s.fs.Open(served)
+	if err != nil {
+		c.Error(apperrors.NewNotFoundError("File not found"))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		c.Error(apperrors.NewInternalServerError("Static file is not seekable"))
+		return
+	}
+
+	http.ServeContent(w, c.Request, name, info.ModTime(), rs)
+}
+
+func (s *Server) exists(name string) bool {
+	info, err := fs.Stat(s.fs, name)
+	return err == nil && !info.IsDir()
+}
+
+func (s *Server) isAPIPath(p string) bool {
+	for _, prefix := range s.cfg.APIPrefixes {
+		if p == prefix || strings.HasPrefix(p, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
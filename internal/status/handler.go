@@ -0,0 +1,40 @@
+package status
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the public status page
+type Handler struct {
+	monitor *Monitor
+}
+
+// NewHandler creates a handler serving the report of monitor
+func NewHandler(monitor *Monitor) *Handler {
+	return &Handler{monitor: monitor}
+}
+
+// RegisterRoutes mounts the status page, which needs no authentication
+func (h *Handler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/status", h.page)
+}
+
+// page answers JSON, or the HTML page to browsers asking for it. Both may be
+// cached until the next check.
+func (h *Handler) page(c *gin.Context) {
+	report, err := h.monitor.Report(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.monitor.cfg.Interval.Seconds())))
+	c.Header("Vary", "Accept")
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		c.HTML(http.StatusOK, "pages/status", report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
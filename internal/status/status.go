@@ -0,0 +1,291 @@
+// Package status publishes the availability of the service for customers to check
+// themselves. A monitor runs the health checks periodically, grouped into the
+// components customers know; the checks are counted per day into uptime, and each
+// run of failed checks of a component is an incident. The public status page
+// serves both as JSON or as a minimal HTML page.
+package status
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config holds status page configuration
+type Config struct {
+	Enabled    bool          `yaml:"enabled"`
+	Interval   time.Duration `yaml:"interval"` // Between checks
+	Timeout    time.Duration `yaml:"timeout"`  // Of each check
+	Days       int           `yaml:"days"`     // Of history kept and shown
+	Components []Component   `yaml:"components"`
+}
+
+// Component is a part of the service shown on the status page, up while every
+// health check it covers passes
+type Component struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Checks are health check names, like images.storage, or prefixes ending in a
+	// dot, like images.; every check when empty
+	Checks []string `json:"checks,omitempty"`
+}
+
+func (c Component) covers(check string) bool {
+	if len(c.Checks) == 0 {
+		return true
+	}
+	for _, name := range c.Checks {
+		if name == check || (strings.HasSuffix(name, ".") && strings.HasPrefix(check, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses of components and of the service
+const (
+	StatusOperational = "operational"
+	StatusOutage      = "outage"
+	StatusUnknown     = "unknown" // Not checked yet
+)
+
+// Report is what the status page shows
+type Report struct {
+	Status     string            `json:"status"` // operational while every component is
+	CheckedAt  *time.Time        `json:"checkedAt,omitempty"`
+	Components []ComponentReport `json:"components"`
+	Incidents  []Incident        `json:"incidents"` // Latest first
+}
+
+// ComponentReport is the current status and uptime history of a component
+type ComponentReport struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Status      string      `json:"status"`
+	Uptime      *float64    `json:"uptime"`  // Percentage over the days shown, null without checks
+	History     []DayUptime `json:"history"` // Oldest first
+}
+
+// DayUptime is the uptime of a component on a day
+type DayUptime struct {
+	Date   string   `json:"date"`   // In UTC, like 2006-01-02
+	Uptime *float64 `json:"uptime"` // Percentage, null without checks
+}
+
+// Level grades the uptime of the day for the status page: none without checks,
+// then up, degraded below 99.9% and down below 95%
+func (d DayUptime) Level() string {
+	switch {
+	case d.Uptime == nil:
+		return "none"
+	case *d.Uptime < 95:
+		return "down"
+	case *d.Uptime < 99.9:
+		return "degraded"
+	}
+	return "up"
+}
+
+// maxIncidents bounds the incidents shown
+const maxIncidents = 20
+
+// Monitor runs the health checks and reports the status of the components
+type Monitor struct {
+	cfg    Config
+	store  Store
+	checks []module.HealthCheck
+
+	mu        sync.Mutex
+	current   map[string]bool // Whether each component was up at the last check
+	checkedAt time.Time
+	report    *Report // Until the next check
+}
+
+// NewMonitor creates a monitor running checks, which records them in store. Without
+// components, every check is covered by one named API.
+func NewMonitor(cfg Config, store Store, checks []module.HealthCheck) (*Monitor, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.Days <= 0 {
+		cfg.Days = 90
+	}
+	if len(cfg.Components) == 0 {
+		cfg.Components = []Component{{Name: "API"}}
+	}
+	seen := map[string]bool{}
+	for _, c := range cfg.Components {
+		if c.Name == "" {
+			return nil, fmt.Errorf("status: component without a name")
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("status: component %q declared twice", c.Name)
+		}
+		seen[c.Name] = true
+		covered := false
+		for _, hc := range checks {
+			covered = covered || c.covers(hc.Name)
+		}
+		if !covered {
+			logger.Warn("status component covers no health check, it is always up", zap.String("component", c.Name))
+		}
+	}
+	return &Monitor{cfg: cfg, store: store, checks: checks, current: map[string]bool{}}, nil
+}
+
+// Start checks each interval until ctx is cancelled, pruning the history older than
+// the days shown once a day
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+
+		var pruned time.Time
+		for {
+			now := time.Now().UTC()
+			m.check(ctx, now)
+			if today := day(now); !today.Equal(pruned) {
+				if err := m.store.Prune(ctx, today.AddDate(0, 0, -m.cfg.Days)); err != nil {
+					logger.Error("failed to prune status history", zap.Error(err))
+				} else {
+					pruned = today
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// check runs every health check at once and records whether each component is up
+func (m *Monitor) check(ctx context.Context, now time.Time) {
+	failed := make([]bool, len(m.checks))
+	var wg sync.WaitGroup
+	for i, hc := range m.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+			defer cancel()
+			failed[i] = hc.Check(checkCtx) != nil
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return // Checks failing on shutdown aren't outages
+	}
+
+	current := make(map[string]bool, len(m.cfg.Components))
+	for _, c := range m.cfg.Components {
+		up := true
+		for i, hc := range m.checks {
+			if failed[i] && c.covers(hc.Name) {
+				up = false
+			}
+		}
+		current[c.Name] = up
+		if err := m.store.Record(ctx, c.Name, now, up); err != nil {
+			logger.Error("failed to record status check", zap.String("component", c.Name), zap.Error(err))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current, m.checkedAt, m.report = current, now, nil
+}
+
+// Report returns the status of the components and the recent incidents, built
+// once per check
+func (m *Monitor) Report(ctx context.Context) (*Report, error) {
+	m.mu.Lock()
+	report, current, checkedAt := m.report, m.current, m.checkedAt
+	m.mu.Unlock()
+	if report != nil {
+		return report, nil
+	}
+
+	now := time.Now().UTC()
+	first := day(now).AddDate(0, 0, 1-m.cfg.Days)
+	days, err := m.store.Days(ctx, first)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := m.store.Incidents(ctx, first, maxIncidents)
+	if err != nil {
+		return nil, err
+	}
+	for i := range incidents {
+		if inc := &incidents[i]; inc.ResolvedAt != nil {
+			inc.Duration = inc.ResolvedAt.Sub(inc.StartedAt).Round(time.Second).String()
+		}
+	}
+	byDay := map[string]map[string]Day{}
+	for _, d := range days {
+		if byDay[d.Component] == nil {
+			byDay[d.Component] = map[string]Day{}
+		}
+		byDay[d.Component][d.Date.Format(time.DateOnly)] = d
+	}
+
+	report = &Report{Status: StatusOperational, Components: []ComponentReport{}, Incidents: incidents}
+	if checkedAt.IsZero() {
+		report.Status = StatusUnknown
+	} else {
+		report.CheckedAt = &checkedAt
+	}
+	for _, c := range m.cfg.Components {
+		cr := ComponentReport{Name: c.Name, Description: c.Description, Status: StatusUnknown,
+			History: make([]DayUptime, 0, m.cfg.Days)}
+		if up, ok := current[c.Name]; ok {
+			cr.Status = StatusOperational
+			if !up {
+				cr.Status, report.Status = StatusOutage, StatusOutage
+			}
+		}
+		var checks, failures int
+		for date := first; !date.After(now); date = date.AddDate(0, 0, 1) {
+			key := date.Format(time.DateOnly)
+			d := byDay[c.Name][key]
+			checks, failures = checks+d.Checks, failures+d.Failures
+			cr.History = append(cr.History, DayUptime{Date: key, Uptime: uptime(d.Checks, d.Failures)})
+		}
+		cr.Uptime = uptime(checks, failures)
+		report.Components = append(report.Components, cr)
+	}
+
+	m.mu.Lock()
+	if m.checkedAt.Equal(checkedAt) {
+		m.report = report
+	}
+	m.mu.Unlock()
+	return report, nil
+}
+
+// uptime is the percentage of passed checks, rounded to three decimals
+func uptime(checks, failures int) *float64 {
+	if checks == 0 {
+		return nil
+	}
+	p := math.Round(float64(checks-failures)/float64(checks)*100000) / 1000
+	return &p
+}
+
+// day truncates t to the start of its day in UTC
+func day(t time.Time) time.Time {
+	y, mo, d := t.UTC().Date()
+	return time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,251 @@
+package status
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Day counts the checks of a component on a day
+type Day struct {
+	Component string
+	Date      time.Time // Start of the day in UTC
+	Checks    int
+	Failures  int
+}
+
+// Incident is a run of failed checks of a component
+type Incident struct {
+	ID         string     `json:"id"`
+	Component  string     `json:"component"`
+	StartedAt  time.Time  `json:"startedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"` // Ongoing when nil
+	Duration   string     `json:"duration,omitempty"`   // Once resolved, like 12m30s
+}
+
+// Store persists the checks of components
+type Store interface {
+	// Record counts a check of component on the day of at. A failed one opens an
+	// incident unless one is ongoing; a passed one resolves the ongoing incident.
+	Record(ctx context.Context, component string, at time.Time, up bool) error
+	// Days lists the days since the given one, of every component
+	Days(ctx context.Context, since time.Time) ([]Day, error)
+	// Incidents lists the latest incidents started since the given time, and the
+	// ongoing ones, latest first
+	Incidents(ctx context.Context, since time.Time, limit int) ([]Incident, error)
+	// Prune deletes the days and resolved incidents before the given time
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// MemoryStore keeps the checks in memory, used when no database is configured
+type MemoryStore struct {
+	mu        sync.Mutex
+	days      map[[2]string]*Day // By component and date
+	incidents []Incident
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{days: make(map[[2]string]*Day)}
+}
+
+func (s *MemoryStore) Record(ctx context.Context, component string, at time.Time, up bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	date := day(at)
+	key := [2]string{component, date.Format(time.DateOnly)}
+	d, ok := s.days[key]
+	if !ok {
+		d = &Day{Component: component, Date: date}
+		s.days[key] = d
+	}
+	d.Checks++
+	ongoing := -1
+	for i, inc := range s.incidents {
+		if inc.Component == component && inc.ResolvedAt == nil {
+			ongoing = i
+		}
+	}
+	switch {
+	case !up:
+		d.Failures++
+		if ongoing < 0 {
+			s.incidents = append(s.incidents, Incident{ID: uuid.New().String(), Component: component, StartedAt: at})
+		}
+	case ongoing >= 0:
+		resolved := at
+		s.incidents[ongoing].ResolvedAt = &resolved
+	}
+	return nil
+}
+
+func (s *MemoryStore) Days(ctx context.Context, since time.Time) ([]Day, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Day{}
+	for _, d := range s.days {
+		if !d.Date.Before(since) {
+			list = append(list, *d)
+		}
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) Incidents(ctx context.Context, since time.Time, limit int) ([]Incident, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Incident{}
+	for _, inc := range s.incidents {
+		if !inc.StartedAt.Before(since) || inc.ResolvedAt == nil {
+			list = append(list, inc)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, d := range s.days {
+		if d.Date.Before(before) {
+			delete(s.days, key)
+		}
+	}
+	kept := s.incidents[:0]
+	for _, inc := range s.incidents {
+		if inc.ResolvedAt == nil || !inc.ResolvedAt.Before(before) {
+			kept = append(kept, inc)
+		}
+	}
+	s.incidents = kept
+	return nil
+}
+
+// SQLStore persists the checks in the status_days and status_incidents tables.
+// Instances sharing the database each count their checks, and a partial unique
+// index keeps them from opening an incident each.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the status tables if they do not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS status_days (
+			component TEXT NOT NULL,
+			day       TIMESTAMP NOT NULL,
+			checks    INTEGER NOT NULL,
+			failures  INTEGER NOT NULL,
+			PRIMARY KEY (component, day)
+		);
+		CREATE TABLE IF NOT EXISTS status_incidents (
+			id          TEXT PRIMARY KEY,
+			component   TEXT NOT NULL,
+			started_at  TIMESTAMP NOT NULL,
+			resolved_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS status_incidents_started_at ON status_incidents (started_at);
+		CREATE UNIQUE INDEX IF NOT EXISTS status_incidents_ongoing ON status_incidents (component) WHERE resolved_at IS NULL`)
+	return err
+}
+
+func (s *SQLStore) Record(ctx context.Context, component string, at time.Time, up bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	failures := 0
+	if !up {
+		failures = 1
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO status_days (component, day, checks, failures) VALUES ($1, $2, 1, $3)
+		ON CONFLICT (component, day) DO UPDATE SET
+			checks = status_days.checks + 1,
+			failures = status_days.failures + excluded.failures`,
+		component, day(at), failures); err != nil {
+		return err
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE status_incidents SET resolved_at = $2 WHERE component = $1 AND resolved_at IS NULL`,
+			component, at)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO status_incidents (id, component, started_at) VALUES ($1, $2, $3)
+			ON CONFLICT (component) WHERE resolved_at IS NULL DO NOTHING`,
+			uuid.New().String(), component, at)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Days(ctx context.Context, since time.Time) ([]Day, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT component, day, checks, failures FROM status_days WHERE day >= $1`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Day{}
+	for rows.Next() {
+		var d Day
+		if err := rows.Scan(&d.Component, &d.Date, &d.Checks, &d.Failures); err != nil {
+			return nil, err
+		}
+		d.Date = d.Date.UTC()
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Incidents(ctx context.Context, since time.Time, limit int) ([]Incident, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, component, started_at, resolved_at FROM status_incidents
+		WHERE started_at >= $1 OR resolved_at IS NULL
+		ORDER BY started_at DESC LIMIT $2`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Incident{}
+	for rows.Next() {
+		var inc Incident
+		var resolved sql.NullTime
+		if err := rows.Scan(&inc.ID, &inc.Component, &inc.StartedAt, &resolved); err != nil {
+			return nil, err
+		}
+		if resolved.Valid {
+			inc.ResolvedAt = &resolved.Time
+		}
+		list = append(list, inc)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Prune(ctx context.Context, before time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM status_days WHERE day < $1`, before); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM status_incidents WHERE resolved_at < $1`, before)
+	return err
+}
@@ -0,0 +1,101 @@
+package subresource
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultLimit is the page size of listings without ?limit=, which is at most 200
+const DefaultLimit = 50
+
+// Cursor is the position of an item in a listing ordered by creation time, then
+// ID. It keeps its place while items are added, unlike an offset.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// String encodes the cursor for clients to pass back as is
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + " " + c.ID))
+}
+
+// After reports whether an item created at createdAt with id comes after the
+// cursor. Every item comes after the zero cursor.
+func (c Cursor) After(createdAt time.Time, id string) bool {
+	if !createdAt.Equal(c.CreatedAt) {
+		return createdAt.After(c.CreatedAt)
+	}
+	return id > c.ID
+}
+
+var errInvalidCursor = errors.New("subresource: invalid cursor")
+
+// ParseCursor decodes a cursor returned by String
+func ParseCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, err
+	}
+	at, id, ok := strings.Cut(string(raw), " ")
+	if !ok {
+		return Cursor{}, errInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return Cursor{}, err
+	}
+	return Cursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// Page selects the items of a listing after a cursor, oldest first
+type Page struct {
+	After Cursor
+	Limit int
+}
+
+// ParsePage reads the page of a listing from ?limit= and ?cursor=, the next
+// cursor of the previous page
+func ParsePage(c *gin.Context) (Page, error) {
+	query := struct {
+		Limit  int    `form:"limit" binding:"min=1,max=200"`
+		Cursor string `form:"cursor"`
+	}{Limit: DefaultLimit}
+	if err := bind.Query(c, &query); err != nil {
+		return Page{}, apperrors.NewValidationErrorFrom("Invalid query", err)
+	}
+	page := Page{Limit: query.Limit}
+	if query.Cursor != "" {
+		after, err := ParseCursor(query.Cursor)
+		if err != nil {
+			return Page{}, apperrors.NewValidationError("Invalid query", apperrors.FieldError{
+				Field: "cursor", Rule: "cursor", Message: "cursor must be the next cursor of a previous page",
+			})
+		}
+		page.After = after
+	}
+	return page, nil
+}
+
+// Fetch is the page stores are asked for: one item more than it holds, telling
+// whether there is a next page
+func (p Page) Fetch() Page {
+	return Page{After: p.After, Limit: p.Limit + 1}
+}
+
+// Next trims the items fetched for the page to its limit, returning the cursor of
+// the next page, or an empty one when there is none
+func Next[T any](p Page, items []T, cursor func(T) Cursor) ([]T, string) {
+	if len(items) <= p.Limit {
+		return items, ""
+	}
+	items = items[:p.Limit]
+	return items, cursor(items[len(items)-1]).String()
+}
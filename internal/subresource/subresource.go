@@ -0,0 +1,73 @@
+// Package subresource lets features like comments and attachments hang off the
+// resources of other modules. A module opts its resources in by declaring them as
+// parents, each with a hook resolving the owner and tenant of one for the
+// policies to decide on. Modules serving sub-resources are handed every parent
+// once the modules are loaded, and mount their routes under each, like
+// /documents/:id/comments.
+package subresource
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"go-api/pkg/authz"
+)
+
+// Parent is a type of resource sub-resources can hang off
+type Parent struct {
+	Type string // Resource type the policies see, like document
+	// Path is the collection the resources are at, like /documents, their own
+	// routes naming the ID of one :id
+	Path    string
+	Resolve Resolver
+}
+
+// Resolver returns the resource with an ID, with its owner and tenant, or a not
+// found error when it doesn't exist. It is the hook where a module hides
+// resources from those its own routes wouldn't show them to.
+type Resolver func(ctx context.Context, id string) (authz.Resource, error)
+
+// Declarer is implemented by modules whose resources can have sub-resources
+type Declarer interface {
+	Parents() []Parent
+}
+
+// Host is implemented by modules serving sub-resources, handed the parents of
+// every module once loaded, before their routes are mounted
+type Host interface {
+	Attach(parents []Parent)
+}
+
+// Select returns the parents of types, or every parent when types is empty
+func Select(parents []Parent, types []string) []Parent {
+	if len(types) == 0 {
+		return parents
+	}
+	var selected []Parent
+	for _, p := range parents {
+		if slices.Contains(types, p.Type) {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// Authorize resolves the parent resource with an ID, once the subject of ctx may
+// perform action on it
+func (p Parent) Authorize(ctx context.Context, id, action string) (authz.Resource, error) {
+	r, err := p.Resolve(ctx, id)
+	if err != nil {
+		return r, err
+	}
+	return r, authz.Authorize(ctx, action, r)
+}
+
+// Title is the type capitalized, for naming the operations on its sub-resources
+// like listDocumentComments
+func (p Parent) Title() string {
+	if p.Type == "" {
+		return ""
+	}
+	return strings.ToUpper(p.Type[:1]) + p.Type[1:]
+}
@@ -0,0 +1,161 @@
+// Package suggest is the index behind search-as-you-type. Modules declare sources
+// of suggestions, like the tags of a tenant; the index splits the text of their
+// entries into words and keeps the leading n-grams of each word (edge n-grams),
+// so that a prefix finds its entries with one lookup rather than a scan.
+package suggest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MaxGram is the longest prefix of a word that is indexed. Longer query terms are
+// looked up by their first MaxGram characters, then checked against the words.
+const MaxGram = 20
+
+// Entry is something to suggest
+type Entry struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Owner  string `json:"-"`
+	Tenant string `json:"-"`
+}
+
+// Source lists the entries of a tenant, read when the tenant's index is built
+type Source struct {
+	Type    string
+	Entries func(ctx context.Context, tenant string) ([]Entry, error)
+}
+
+// Declarer is implemented by modules whose resources are suggested
+type Declarer interface {
+	Suggestions() []Source
+}
+
+// Host is implemented by modules serving suggestions. Load hands them the sources
+// every module declares.
+type Host interface {
+	Index(sources []Source)
+}
+
+// Words splits text into the lowercase words it is indexed and looked up by:
+// runs of letters and digits
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Normalize returns a query the way it is looked up, its words separated by a space
+func Normalize(query string) string {
+	return strings.Join(Words(query), " ")
+}
+
+// Index finds entries by the prefixes of their words. It isn't changed once
+// built, so it is safe for concurrent lookups.
+type Index struct {
+	entries []Entry
+	words   [][]string       // Of each entry
+	grams   map[string][]int // Entries having a word starting with the gram, in order
+}
+
+// NewIndex indexes entries
+func NewIndex(entries []Entry) *Index {
+	ix := &Index{entries: entries, words: make([][]string, len(entries)), grams: make(map[string][]int)}
+	for i, e := range entries {
+		ix.words[i] = Words(e.Text)
+		for _, word := range ix.words[i] {
+			runes := []rune(word)
+			for n := 1; n <= len(runes) && n <= MaxGram; n++ {
+				gram := string(runes[:n])
+				if list := ix.grams[gram]; len(list) == 0 || list[len(list)-1] != i {
+					ix.grams[gram] = append(list, i)
+				}
+			}
+		}
+	}
+	return ix
+}
+
+// Len returns the number of entries indexed
+func (ix *Index) Len() int {
+	return len(ix.entries)
+}
+
+// Lookup returns at most limit entries of which every word of query starts a word,
+// that keep accepts. Entries starting with the whole query come first, then those
+// whose first word starts with the first term; shorter texts come first within both.
+func (ix *Index) Lookup(query string, limit int, keep func(Entry) bool) []Entry {
+	terms := Words(query)
+	if len(terms) == 0 {
+		return []Entry{}
+	}
+	// The longest term has the fewest entries to check
+	longest := terms[0]
+	for _, t := range terms[1:] {
+		if len(t) > len(longest) {
+			longest = t
+		}
+	}
+	if runes := []rune(longest); len(runes) > MaxGram {
+		longest = string(runes[:MaxGram])
+	}
+	type match struct {
+		entry int
+		rank  int
+	}
+	normalized := strings.Join(terms, " ")
+	var matches []match
+	for _, i := range ix.grams[longest] {
+		if !ix.matches(i, terms) {
+			continue
+		}
+		rank := 2
+		if strings.HasPrefix(strings.Join(ix.words[i], " "), normalized) {
+			rank = 0
+		} else if strings.HasPrefix(ix.words[i][0], terms[0]) {
+			rank = 1
+		}
+		matches = append(matches, match{i, rank})
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		ea, eb := ix.entries[matches[a].entry], ix.entries[matches[b].entry]
+		if matches[a].rank != matches[b].rank {
+			return matches[a].rank < matches[b].rank
+		}
+		if len(ea.Text) != len(eb.Text) {
+			return len(ea.Text) < len(eb.Text)
+		}
+		return ea.Text < eb.Text
+	})
+	list := []Entry{}
+	for _, m := range matches {
+		if len(list) == limit {
+			break
+		}
+		if e := ix.entries[m.entry]; keep(e) {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// matches reports whether every term starts a word of entry i
+func (ix *Index) matches(i int, terms []string) bool {
+	for _, t := range terms {
+		found := false
+		for _, word := range ix.words[i] {
+			if strings.HasPrefix(word, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package tags
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// maxFilterTags bounds the tags a filter names, as each is a condition of the query
+const maxFilterTags = 20
+
+// Filter selects resources by their tags. It is written as terms separated by
+// commas, all of which have to hold: a tag, tags separated by | of which any will
+// do, or a tag prefixed with - the resource mustn't have. urgent|high,-archived
+// selects resources tagged urgent or high, and not archived.
+type Filter struct {
+	All  [][]string // Groups of tags the resource has one of each
+	None []string
+}
+
+// ParseFilter parses a filter expression, which needs at least a tag to require
+func ParseFilter(expr string) (Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return Filter{}, filterError("must require at least one tag")
+	}
+	var f Filter
+	count := 0
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		if excluded, ok := strings.CutPrefix(term, "-"); ok {
+			name, err := normalize(excluded)
+			if err != nil {
+				return Filter{}, filterError(strconv.Quote(excluded) + " is not a valid tag name")
+			}
+			f.None = append(f.None, name)
+			count++
+			continue
+		}
+		var group []string
+		for _, alt := range strings.Split(term, "|") {
+			name, err := normalize(alt)
+			if err != nil {
+				return Filter{}, filterError(strconv.Quote(strings.TrimSpace(alt)) + " is not a valid tag name")
+			}
+			group = append(group, name)
+			count++
+		}
+		f.All = append(f.All, group)
+	}
+	if len(f.All) == 0 {
+		return Filter{}, filterError("must require at least one tag")
+	}
+	if count > maxFilterTags {
+		return Filter{}, filterError("must name at most " + strconv.Itoa(maxFilterTags) + " tags")
+	}
+	return f, nil
+}
+
+func filterError(message string) error {
+	return apperrors.NewValidationError("Invalid tag filter", apperrors.FieldError{
+		Field: "tags", Rule: "filter", Message: message,
+	})
+}
+
+// Match reports whether a resource with tags is selected by the filter
+func (f Filter) Match(tags []string) bool {
+	for _, group := range f.All {
+		if !slices.ContainsFunc(group, func(name string) bool { return slices.Contains(tags, name) }) {
+			return false
+		}
+	}
+	return !slices.ContainsFunc(f.None, func(name string) bool { return slices.Contains(tags, name) })
+}
@@ -0,0 +1,364 @@
+package tags
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/subresource"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retrysafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes mounts the management of the tenant's tags, the search of resources by
+// tags, and the tagging endpoints under each parent taking tags
+func (m *tagsModule) Routes(api *apiversion.Group) {
+	tags := []string{"tags"}
+	api.GET("/tags", apiversion.Operation{
+		ID:       "listTags",
+		Summary:  "List the tags of the tenant",
+		Tags:     tags,
+		Response: []Tag{},
+	}, m.list)
+	api.POST("/tags", apiversion.Operation{
+		ID:          "createTag",
+		Summary:     "Create a tag",
+		Description: "Names are lowercased, and made of letters, digits and . _ : -, like priority:high.",
+		Tags:        tags,
+		Request:     createRequest{},
+		Response:    Tag{},
+	}, m.create)
+	api.PATCH("/tags/:name", apiversion.Operation{
+		ID:       "updateTag",
+		Summary:  "Change the color or description of a tag",
+		Tags:     tags,
+		Request:  updateRequest{},
+		Response: Tag{},
+	}, m.update)
+	api.DELETE("/tags/:name", apiversion.Operation{
+		ID:          "deleteTag",
+		Summary:     "Delete a tag",
+		Description: "Detaches it from every resource.",
+		Tags:        tags,
+	}, m.delete)
+	api.GET("/tagged/:type", apiversion.Operation{
+		ID:      "findTagged",
+		Summary: "Find resources by their tags",
+		Description: "Lists the resources of a type selected by the ?tags= filter, by ID, a page at a time. " +
+			"The filter is terms separated by commas that all have to hold: a tag, tags separated by | of which " +
+			"any will do, or a tag prefixed with - the resource mustn't have. Only the resources the caller may " +
+			"read are listed, so a page may hold fewer than the limit.",
+		Tags:     tags,
+		Response: TaggedPage{},
+	}, m.find)
+	for _, p := range m.ordered {
+		m.parentRoutes(api, p)
+	}
+}
+
+func (m *tagsModule) parentRoutes(api *apiversion.Group, p subresource.Parent) {
+	tags := []string{"tags"}
+	path := strings.TrimSuffix(p.Path, "/") + "/:id/tags"
+	api.GET(path, apiversion.Operation{
+		ID:       "list" + p.Title() + "Tags",
+		Summary:  "List the tags of a " + p.Type,
+		Tags:     tags,
+		Response: Tagged{},
+	}, m.tagsOf(p))
+	api.PUT(path+"/:tag", apiversion.Operation{
+		ID:          "tag" + p.Title(),
+		Summary:     "Tag a " + p.Type,
+		Description: "The tag has to exist in the tenant. Tagging it again changes nothing.",
+		Tags:        tags,
+		Idempotency: retrysafe.Idempotent,
+		Response:    Tagged{},
+	}, m.attach(p))
+	api.DELETE(path+"/:tag", apiversion.Operation{
+		ID:      "untag" + p.Title(),
+		Summary: "Remove a tag from a " + p.Type,
+		Tags:    tags,
+	}, m.detach(p))
+}
+
+type createRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Color       string `json:"color" binding:"omitempty,hexcolor"`
+	Description string `json:"description" binding:"omitempty,max=500"`
+}
+
+type updateRequest struct {
+	Color       *string `json:"color" binding:"omitempty,hexcolor"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+}
+
+// subject returns the signed-in subject, whose tenant the tags are of
+func subject(c *gin.Context) (authz.Subject, error) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		return sub, apperrors.NewUnauthorizedError("Authentication required")
+	}
+	return sub, nil
+}
+
+// tag returns the tag of the :name parameter once the caller may perform action
+// on it, which the default policy leaves to its creator
+func (m *tagsModule) tag(c *gin.Context, action string) (Tag, error) {
+	sub, err := subject(c)
+	if err != nil {
+		return Tag{}, err
+	}
+	ctx := c.Request.Context()
+	t, err := m.store.Get(ctx, sub.Tenant, strings.ToLower(c.Param("name")))
+	if err != nil {
+		return Tag{}, err
+	}
+	return t, authz.Authorize(ctx, action, authz.Resource{Type: "tag", ID: t.Name, Owner: t.CreatedBy, Tenant: t.Tenant})
+}
+
+func (m *tagsModule) list(c *gin.Context) {
+	sub, err := subject(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	list, err := m.store.List(c.Request.Context(), sub.Tenant)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (m *tagsModule) create(c *gin.Context) {
+	sub, err := subject(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var req createRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid tag", err))
+		return
+	}
+	name, err := normalize(req.Name)
+	if err != nil {
+		c.Error(apperrors.NewValidationError("Invalid tag", apperrors.FieldError{
+			Pointer: "/name", Field: "name", Rule: "name",
+			Message: "must be at most 64 letters, digits and . _ : -, starting with a letter or digit",
+		}))
+		return
+	}
+	ctx := c.Request.Context()
+	t := Tag{Name: name, Tenant: sub.Tenant, Color: strings.ToLower(req.Color), Description: req.Description,
+		CreatedBy: sub.ID, CreatedAt: time.Now().UTC()}
+	if err := authz.Authorize(ctx, "create", authz.Resource{Type: "tag", ID: t.Name, Owner: t.CreatedBy, Tenant: t.Tenant}); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := m.store.Create(ctx, t); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+t.Name)
+	c.JSON(http.StatusCreated, t)
+}
+
+func (m *tagsModule) update(c *gin.Context) {
+	t, err := m.tag(c, "update")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var req updateRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid tag", err))
+		return
+	}
+	if req.Color != nil {
+		t.Color = strings.ToLower(*req.Color)
+	}
+	if req.Description != nil {
+		t.Description = *req.Description
+	}
+	if err := m.store.Update(c.Request.Context(), t); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (m *tagsModule) delete(c *gin.Context) {
+	t, err := m.tag(c, "delete")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ctx := c.Request.Context()
+	detached, err := m.store.Delete(ctx, t.Tenant, t.Name)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	for _, r := range detached {
+		m.record(ctx, EventDetached, Change{Tag: t.Name, ResourceType: r.Type, ResourceID: r.ID, Tenant: r.Tenant})
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// find lists the resources of the type a filter selects, dropping those the
+// caller may not read
+func (m *tagsModule) find(c *gin.Context) {
+	sub, err := subject(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	p, ok := m.parents[c.Param("type")]
+	if !ok {
+		c.Error(apperrors.NewNotFoundError("Resources of this type can't be tagged"))
+		return
+	}
+	filter, err := ParseFilter(c.Query("tags"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	page, err := subresource.ParsePage(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ctx := c.Request.Context()
+	ids, err := m.store.Find(ctx, sub.Tenant, p.Type, filter, page.Fetch())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ids, next := subresource.Next(page, ids, func(id string) subresource.Cursor { return subresource.Cursor{ID: id} })
+	readable := ids[:0]
+	for _, id := range ids {
+		if _, err := p.Authorize(ctx, id, "read"); err != nil {
+			if status := apperrors.From(err).StatusCode; status != http.StatusNotFound && status != http.StatusForbidden {
+				c.Error(err)
+				return
+			}
+			continue
+		}
+		readable = append(readable, id)
+	}
+	tags, err := m.store.TagsOf(ctx, sub.Tenant, p.Type, readable)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	list := make([]Tagged, 0, len(readable))
+	for _, id := range readable {
+		list = append(list, Tagged{ResourceType: p.Type, ResourceID: id, Tags: tags[id]})
+	}
+	c.JSON(http.StatusOK, TaggedPage{Data: list, Next: next})
+}
+
+// tagged returns the tags of a resource
+func (m *tagsModule) tagged(c *gin.Context, r authz.Resource) (Tagged, error) {
+	tags, err := m.store.TagsOf(c.Request.Context(), r.Tenant, r.Type, []string{r.ID})
+	if err != nil {
+		return Tagged{}, err
+	}
+	return Tagged{ResourceType: r.Type, ResourceID: r.ID, Tags: tags[r.ID]}, nil
+}
+
+func (m *tagsModule) tagsOf(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := p.Authorize(c.Request.Context(), c.Param("id"), "read")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		tagged, err := m.tagged(c, r)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, tagged)
+	}
+}
+
+func (m *tagsModule) attach(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, err := subject(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "tag")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		name := strings.ToLower(c.Param("tag"))
+		tagged, err := m.tagged(c, r)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if slices.Contains(tagged.Tags, name) {
+			c.JSON(http.StatusOK, tagged)
+			return
+		}
+		if len(tagged.Tags) >= m.cfg.MaxPerResource {
+			c.Error(apperrors.NewConflictError("Resources have at most " + strconv.Itoa(m.cfg.MaxPerResource) + " tags"))
+			return
+		}
+		added, err := m.store.Attach(ctx, Resource{Tenant: r.Tenant, Type: r.Type, ID: r.ID}, name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if added {
+			m.record(ctx, EventAttached, Change{Tag: name, ResourceType: r.Type, ResourceID: r.ID,
+				ResourceOwner: r.Owner, Tenant: r.Tenant, By: sub.ID})
+			if tagged, err = m.tagged(c, r); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+		c.JSON(http.StatusOK, tagged)
+	}
+}
+
+func (m *tagsModule) detach(p subresource.Parent) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, err := subject(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		ctx := c.Request.Context()
+		r, err := p.Authorize(ctx, c.Param("id"), "tag")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		name := strings.ToLower(c.Param("tag"))
+		removed, err := m.store.Detach(ctx, Resource{Tenant: r.Tenant, Type: r.Type, ID: r.ID}, name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if !removed {
+			c.Error(apperrors.NewNotFoundError("Resource is not tagged with " + name))
+			return
+		}
+		m.record(ctx, EventDetached, Change{Tag: name, ResourceType: r.Type, ResourceID: r.ID,
+			ResourceOwner: r.Owner, Tenant: r.Tenant, By: sub.ID})
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,421 @@
+package tags
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-api/internal/module"
+	"go-api/internal/subresource"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+)
+
+// Resource is a tagged resource of a tenant
+type Resource struct {
+	Tenant string
+	Type   string
+	ID     string
+}
+
+// Store persists the tags of tenants and the resources they are attached to
+type Store interface {
+	// Create adds a tag, failing with a conflict when the tenant has it
+	Create(ctx context.Context, t Tag) error
+	Get(ctx context.Context, tenant, name string) (Tag, error)
+	Update(ctx context.Context, t Tag) error
+	// Delete removes a tag and detaches it, returning the resources it was on
+	Delete(ctx context.Context, tenant, name string) ([]Resource, error)
+	// List returns the tags of a tenant by name
+	List(ctx context.Context, tenant string) ([]Tag, error)
+	// Attach tags a resource, reporting whether it wasn't tagged with it already
+	Attach(ctx context.Context, r Resource, name string) (bool, error)
+	// Detach untags a resource, reporting whether it was tagged with it
+	Detach(ctx context.Context, r Resource, name string) (bool, error)
+	// TagsOf returns the tags of the resources of a type with ids, by name
+	TagsOf(ctx context.Context, tenant, resourceType string, ids []string) (map[string][]string, error)
+	// Find returns the IDs of the resources of a type the filter selects, in order,
+	// after the ID of the page's cursor
+	Find(ctx context.Context, tenant, resourceType string, f Filter, page subresource.Page) ([]string, error)
+}
+
+var (
+	errTagNotFound = apperrors.NewNotFoundError("Tag not found")
+	errTagExists   = apperrors.NewConflictError("Tag already exists")
+)
+
+// MemoryStore keeps tags in memory, used when no database is configured
+type MemoryStore struct {
+	mu       sync.RWMutex
+	tags     map[string]map[string]Tag    // By tenant, then name
+	taggings map[Resource]map[string]bool // Tag names by resource
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tags: make(map[string]map[string]Tag), taggings: make(map[Resource]map[string]bool)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, t Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tags[t.Tenant][t.Name]; ok {
+		return errTagExists
+	}
+	if s.tags[t.Tenant] == nil {
+		s.tags[t.Tenant] = make(map[string]Tag)
+	}
+	s.tags[t.Tenant][t.Name] = t
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, tenant, name string) (Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tags[tenant][name]
+	if !ok {
+		return Tag{}, errTagNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, t Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tags[t.Tenant][t.Name]; !ok {
+		return errTagNotFound
+	}
+	s.tags[t.Tenant][t.Name] = t
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, tenant, name string) ([]Resource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tags[tenant][name]; !ok {
+		return nil, errTagNotFound
+	}
+	delete(s.tags[tenant], name)
+	var detached []Resource
+	for r, names := range s.taggings {
+		if r.Tenant == tenant && names[name] {
+			delete(names, name)
+			detached = append(detached, r)
+		}
+	}
+	return detached, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, tenant string) ([]Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Tag{}
+	for _, t := range s.tags[tenant] {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *MemoryStore) Attach(ctx context.Context, r Resource, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tags[r.Tenant][name]; !ok {
+		return false, errTagNotFound
+	}
+	if s.taggings[r][name] {
+		return false, nil
+	}
+	if s.taggings[r] == nil {
+		s.taggings[r] = make(map[string]bool)
+	}
+	s.taggings[r][name] = true
+	return true, nil
+}
+
+func (s *MemoryStore) Detach(ctx context.Context, r Resource, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.taggings[r][name] {
+		return false, nil
+	}
+	delete(s.taggings[r], name)
+	return true, nil
+}
+
+func (s *MemoryStore) TagsOf(ctx context.Context, tenant, resourceType string, ids []string) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tags := make(map[string][]string, len(ids))
+	for _, id := range ids {
+		list := []string{}
+		for name := range s.taggings[Resource{Tenant: tenant, Type: resourceType, ID: id}] {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		tags[id] = list
+	}
+	return tags, nil
+}
+
+func (s *MemoryStore) Find(ctx context.Context, tenant, resourceType string, f Filter, page subresource.Page) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := []string{}
+	for r, names := range s.taggings {
+		if r.Tenant != tenant || r.Type != resourceType || r.ID <= page.After.ID {
+			continue
+		}
+		tags := make([]string, 0, len(names))
+		for name := range names {
+			tags = append(tags, name)
+		}
+		if f.Match(tags) {
+			ids = append(ids, r.ID)
+		}
+	}
+	slices.Sort(ids)
+	if len(ids) > page.Limit {
+		ids = ids[:page.Limit]
+	}
+	return ids, nil
+}
+
+// migrations create the tags and taggings tables
+var migrations = []module.Migration{{
+	Name: "create_tags",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS tags (
+			tenant      TEXT NOT NULL,
+			name        TEXT NOT NULL,
+			color       TEXT NOT NULL,
+			description TEXT NOT NULL,
+			created_by  TEXT NOT NULL,
+			created_at  TIMESTAMP NOT NULL,
+			PRIMARY KEY (tenant, name)
+		);
+		CREATE TABLE IF NOT EXISTS taggings (
+			tenant        TEXT NOT NULL,
+			resource_type TEXT NOT NULL,
+			resource_id   TEXT NOT NULL,
+			tag           TEXT NOT NULL,
+			PRIMARY KEY (tenant, resource_type, resource_id, tag)
+		);
+		CREATE INDEX IF NOT EXISTS taggings_tag_idx ON taggings (tenant, tag, resource_type, resource_id)`,
+}}
+
+// SQLStore persists tags in the tags and taggings tables
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Create(ctx context.Context, t Tag) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO tags (tenant, name, color, description, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, name) DO NOTHING`,
+		t.Tenant, t.Name, t.Color, t.Description, t.CreatedBy, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTagExists
+	}
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, tenant, name string) (Tag, error) {
+	var t Tag
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT tenant, name, color, description, created_by, created_at FROM tags WHERE tenant = $1 AND name = $2`,
+		tenant, name).Scan(&t.Tenant, &t.Name, &t.Color, &t.Description, &t.CreatedBy, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tag{}, errTagNotFound
+	}
+	return t, err
+}
+
+func (s *SQLStore) Update(ctx context.Context, t Tag) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE tags SET color = $3, description = $4 WHERE tenant = $1 AND name = $2`,
+		t.Tenant, t.Name, t.Color, t.Description)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTagNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, tenant, name string) ([]Resource, error) {
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE tenant = $1 AND name = $2`, tenant, name)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errTagNotFound
+	}
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM taggings WHERE tenant = $1 AND tag = $2 RETURNING resource_type, resource_id`, tenant, name)
+	if err != nil {
+		return nil, err
+	}
+	var detached []Resource
+	for rows.Next() {
+		r := Resource{Tenant: tenant}
+		if err := rows.Scan(&r.Type, &r.ID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		detached = append(detached, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return detached, tx.Commit()
+}
+
+func (s *SQLStore) List(ctx context.Context, tenant string) ([]Tag, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT tenant, name, color, description, created_by, created_at FROM tags WHERE tenant = $1 ORDER BY name`, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Tenant, &t.Name, &t.Color, &t.Description, &t.CreatedBy, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Attach(ctx context.Context, r Resource, name string) (bool, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO taggings (tenant, resource_type, resource_id, tag)
+		SELECT tenant, $2, $3, name FROM tags WHERE tenant = $1 AND name = $4
+		ON CONFLICT (tenant, resource_type, resource_id, tag) DO NOTHING`,
+		r.Tenant, r.Type, r.ID, name)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, nil
+	}
+	// Tagged already, or no such tag
+	if _, err := s.Get(ctx, r.Tenant, name); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func (s *SQLStore) Detach(ctx context.Context, r Resource, name string) (bool, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		DELETE FROM taggings WHERE tenant = $1 AND resource_type = $2 AND resource_id = $3 AND tag = $4`,
+		r.Tenant, r.Type, r.ID, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *SQLStore) TagsOf(ctx context.Context, tenant, resourceType string, ids []string) (map[string][]string, error) {
+	tags := make(map[string][]string, len(ids))
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	args := []any{tenant, resourceType}
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		tags[id] = []string{}
+		args = append(args, id)
+		placeholders[i] = "$" + strconv.Itoa(len(args))
+	}
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT resource_id, tag FROM taggings
+		WHERE tenant = $1 AND resource_type = $2 AND resource_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY resource_id, tag`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], name)
+	}
+	return tags, rows.Err()
+}
+
+// Find selects the resources with a tag of each group and none of the excluded,
+// with a condition on taggings per group
+func (s *SQLStore) Find(ctx context.Context, tenant, resourceType string, f Filter, page subresource.Page) ([]string, error) {
+	args := []any{tenant, resourceType, page.After.ID}
+	in := func(names []string) string {
+		placeholders := make([]string, len(names))
+		for i, name := range names {
+			args = append(args, name)
+			placeholders[i] = "$" + strconv.Itoa(len(args))
+		}
+		return `EXISTS (SELECT 1 FROM taggings x WHERE x.tenant = r.tenant AND x.resource_type = r.resource_type
+			AND x.resource_id = r.resource_id AND x.tag IN (` + strings.Join(placeholders, ", ") + `))`
+	}
+	var conditions []string
+	for _, group := range f.All {
+		conditions = append(conditions, in(group))
+	}
+	if len(f.None) > 0 {
+		conditions = append(conditions, "NOT "+in(f.None))
+	}
+	args = append(args, page.Limit)
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT DISTINCT r.resource_id FROM taggings r
+		WHERE r.tenant = $1 AND r.resource_type = $2 AND r.resource_id > $3 AND `+strings.Join(conditions, " AND ")+`
+		ORDER BY r.resource_id
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
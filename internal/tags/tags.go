@@ -0,0 +1,177 @@
+// Package tags is the feature module labeling the resources of other modules
+// with tags. Each tenant has its own tags, created once and then attached to any
+// resource opted in as a subresource parent, through routes like
+// /documents/:id/tags/:tag. Resources are found by their tags with a filter like
+// urgent|high,-archived. Tagging needs the tag action on the resource, which the
+// default policy leaves to its owner; attaching and detaching tags is recorded as
+// events, for clients to follow on the realtime topic.
+package tags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/realtime"
+	"go-api/internal/subresource"
+	"go-api/internal/suggest"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config holds tagging configuration
+type Config struct {
+	Resources      []string `yaml:"resources"`      // Types of the parents taking tags; every declared parent when empty
+	MaxPerResource int      `yaml:"maxPerResource"` // Tags a resource has at most
+	Store          string   `yaml:"store"`          // memory or sql; the database by default
+}
+
+// Tag is a label of a tenant
+type Tag struct {
+	Name        string    `json:"name"` // Lowercase, like urgent or priority:high
+	Tenant      string    `json:"tenant,omitempty"`
+	Color       string    `json:"color,omitempty"` // Hex, like #d73a4a
+	Description string    `json:"description,omitempty"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Tagged is a resource and its tags
+type Tagged struct {
+	ResourceType string   `json:"resourceType"`
+	ResourceID   string   `json:"resourceId"`
+	Tags         []string `json:"tags"`
+}
+
+// TaggedPage is a page of the resources a filter selects, by ID
+type TaggedPage struct {
+	Data []Tagged `json:"data"`
+	Next string   `json:"next,omitempty"` // Cursor of the next page, passed as ?cursor=
+}
+
+// namePattern is what tag names look like once lowercased
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,63}$`)
+
+var errInvalidName = errors.New("tags: invalid name")
+
+// normalize returns a tag name lowercased, failing when it isn't a valid name
+func normalize(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !namePattern.MatchString(name) {
+		return "", errInvalidName
+	}
+	return name, nil
+}
+
+// Events recorded on the stream of a resource's tags, tags-{type}/{id}
+const (
+	EventAttached = "tag.attached"
+	EventDetached = "tag.detached"
+)
+
+// Change is the data of the tag events
+type Change struct {
+	Tag           string `json:"tag"`
+	ResourceType  string `json:"resourceType"`
+	ResourceID    string `json:"resourceId"`
+	ResourceOwner string `json:"resourceOwner,omitempty"`
+	Tenant        string `json:"tenant,omitempty"`
+	By            string `json:"by,omitempty"` // Who tagged or untagged it; empty when the tag was deleted
+}
+
+type tagsModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	events  eventstore.Store
+	parents map[string]subresource.Parent // By type
+	ordered []subresource.Parent
+}
+
+// New returns the factory of the tags module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if cfg.MaxPerResource <= 0 {
+			cfg.MaxPerResource = 50
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("tags: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			return nil, fmt.Errorf("tags: store %s is not supported, want %s or %s", backend, module.BackendMemory, module.BackendSQL)
+		}
+		return &tagsModule{cfg: cfg, backend: backend, store: store, events: deps.Events}, nil
+	}
+}
+
+func (m *tagsModule) Name() string { return "tags" }
+
+func (m *tagsModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+// Attach keeps the parents configured to take tags
+func (m *tagsModule) Attach(parents []subresource.Parent) {
+	m.ordered = subresource.Select(parents, m.cfg.Resources)
+	m.parents = make(map[string]subresource.Parent, len(m.ordered))
+	for _, p := range m.ordered {
+		m.parents[p.Type] = p
+	}
+}
+
+// EventSchemas declares the schemas of the tag events
+func (m *tagsModule) EventSchemas() []eventschema.Schema {
+	schema := eventschema.From(Change{})
+	return []eventschema.Schema{
+		{Event: EventAttached, Version: 1, Description: "A resource was tagged.", Schema: schema},
+		{Event: EventDetached, Version: 1, Description: "A tag was removed from a resource, or deleted altogether.", Schema: schema},
+	}
+}
+
+// Topics lets clients follow the tagging of the resources they may read
+func (m *tagsModule) Topics() []realtime.Topic {
+	return []realtime.Topic{{Name: "tags", Events: []string{EventAttached, EventDetached},
+		Resource: "tag", TypeField: "resourceType", IDField: "resourceId", Owner: "resourceOwner", Tenant: "tenant",
+		Actors: []string{"by"}}}
+}
+
+// Suggestions lets the tags of a tenant be suggested by name while they are typed
+func (m *tagsModule) Suggestions() []suggest.Source {
+	return []suggest.Source{{Type: "tag", Entries: func(ctx context.Context, tenant string) ([]suggest.Entry, error) {
+		list, err := m.store.List(ctx, tenant)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]suggest.Entry, 0, len(list))
+		for _, t := range list {
+			entries = append(entries, suggest.Entry{Type: "tag", ID: t.Name, Text: t.Name, Owner: t.CreatedBy, Tenant: t.Tenant})
+		}
+		return entries, nil
+	}}}
+}
+
+// record records an event of a resource's tags. The change is stored already, so
+// a failure is only logged.
+func (m *tagsModule) record(ctx context.Context, event string, change Change) {
+	stream := "tags-" + url.PathEscape(change.ResourceType) + "/" + url.PathEscape(change.ResourceID)
+	if _, err := m.events.Append(ctx, stream, eventstore.AnyVersion, eventstore.NewEvent{Type: event, Data: change}); err != nil {
+		logger.Error("failed to record tag event", zap.String("event", event), zap.String("tag", change.Tag), zap.Error(err))
+	}
+}
@@ -0,0 +1,187 @@
+package tenancy
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-api/pkg/bind"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes the admin endpoints to provision, migrate and delete tenants
+type Handler struct {
+	provisioner *Provisioner
+}
+
+// NewHandler creates a tenant handler
+func NewHandler(provisioner *Provisioner) *Handler {
+	return &Handler{provisioner: provisioner}
+}
+
+// RegisterRoutes mounts the tenant endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/tenants", h.list)
+	rg.POST("/tenants", h.create)
+	rg.POST("/tenants/migrate", h.migrateAll)
+	rg.GET("/tenants/:id", h.get)
+	rg.POST("/tenants/:id/migrate", h.migrate)
+	rg.DELETE("/tenants/:id", routing.Query("drop"), h.delete)
+}
+
+// redact clears the DSN, which is write-only as it carries credentials
+func redact(t Tenant) Tenant {
+	t.DSN = ""
+	return t
+}
+
+func (h *Handler) list(c *gin.Context) {
+	list, err := h.provisioner.router.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	for i := range list {
+		list[i] = redact(list[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Handler) get(c *gin.Context) {
+	t, err := h.provisioner.router.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, redact(t))
+}
+
+type createRequest struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Isolation string `json:"isolation"`
+	Driver    string `json:"driver"`
+	DSN       string `json:"dsn"` // With database isolation, of an existing database; one is created next to the shared database without it
+}
+
+// create records a tenant and provisions its schema or database as an operation,
+// since creating a database and migrating it outlives the request. Shared tenants
+// have nothing to provision and are created right away.
+func (h *Handler) create(c *gin.Context) {
+	var req createRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid tenant", err))
+		return
+	}
+	now := time.Now().UTC()
+	t := Tenant{ID: req.ID, Name: req.Name, Isolation: req.Isolation, Driver: req.Driver, DSN: req.DSN,
+		Status: StatusProvisioning, CreatedAt: now, UpdatedAt: now}
+	if err := validate(t); err != nil {
+		c.Error(err)
+		return
+	}
+	if t.Isolation == IsolationSchema && database.Dialect(h.provisioner.router.shared) != database.Postgres {
+		c.Error(apperrors.NewValidationError("Schema isolation needs a Postgres database", apperrors.FieldError{
+			Field: "isolation", Rule: "oneof", Param: "shared database", Message: "isolation must be shared or database with SQLite",
+		}))
+		return
+	}
+	if t.Isolation == IsolationSchema {
+		t.Schema = storageName(h.provisioner.router.cfg.SchemaPrefix, t.ID)
+	}
+
+	ctx := c.Request.Context()
+	store := h.provisioner.router.store
+	if _, err := store.Get(ctx, t.ID); err == nil {
+		c.Error(apperrors.NewConflictError("Tenant already exists"))
+		return
+	} else if !errors.Is(err, errTenantNotFound) {
+		c.Error(err)
+		return
+	}
+
+	if !t.Isolated() {
+		t.Status = StatusActive
+	}
+	if err := store.Put(ctx, t); err != nil {
+		c.Error(err)
+		return
+	}
+	// Requests of an isolated tenant get 409 until it is active, rather than the
+	// shared database
+	h.provisioner.router.forget(t.ID)
+	if !t.Isolated() {
+		c.JSON(http.StatusCreated, redact(t))
+		return
+	}
+
+	op, err := h.provisioner.operations.Start(ctx, ProvisionOperation, tenantPayload{Tenant: t.ID})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.provisioner.operations.Accepted(c, op)
+}
+
+// migrate applies pending module migrations to one isolated tenant
+func (h *Handler) migrate(c *gin.Context) {
+	ctx := c.Request.Context()
+	t, err := h.provisioner.router.store.Get(ctx, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !t.Isolated() {
+		c.Error(apperrors.NewValidationError("Shared tenants are migrated with the shared database"))
+		return
+	}
+	if t.Status == StatusProvisioning {
+		c.Error(apperrors.NewConflictError("Tenant is still being provisioned"))
+		return
+	}
+	op, err := h.provisioner.operations.Start(ctx, MigrateOperation, tenantPayload{Tenant: t.ID})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.provisioner.operations.Accepted(c, op)
+}
+
+// migrateAll applies pending module migrations to every isolated tenant, like after
+// a deployment that added some
+func (h *Handler) migrateAll(c *gin.Context) {
+	op, err := h.provisioner.operations.Start(c.Request.Context(), MigrateOperation, tenantPayload{})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	h.provisioner.operations.Accepted(c, op)
+}
+
+// delete removes a tenant, whose users fall back to the shared database. Its
+// schema, or the database provisioning created, is only dropped with ?drop=true.
+func (h *Handler) delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	store := h.provisioner.router.store
+	t, err := store.Get(ctx, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if c.Query("drop") == "true" {
+		if err := h.provisioner.Drop(ctx, t); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := store.Delete(ctx, t.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	h.provisioner.router.Evict(t.ID)
+	c.Status(http.StatusNoContent)
+}
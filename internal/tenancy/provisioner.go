@@ -0,0 +1,230 @@
+package tenancy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go-api/internal/operations"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Operation types
+const (
+	ProvisionOperation = "tenants.provision"
+	MigrateOperation   = "tenants.migrate"
+)
+
+// Migrator applies the module migrations to a database, implemented by module.Set
+type Migrator interface {
+	Migrate(ctx context.Context, db *sql.DB) error
+}
+
+// Provisioner creates the schemas and databases of isolated tenants and keeps
+// their module migrations up to date
+type Provisioner struct {
+	router     *Router
+	migrator   Migrator
+	operations *operations.Manager
+}
+
+// NewProvisioner creates a provisioner and registers its operations, so it must be
+// created before the job queue starts
+func NewProvisioner(router *Router, migrator Migrator, ops *operations.Manager) *Provisioner {
+	p := &Provisioner{router: router, migrator: migrator, operations: ops}
+	ops.Register(ProvisionOperation, p.runProvision)
+	ops.Register(MigrateOperation, p.runMigrate)
+	return p
+}
+
+type tenantPayload struct {
+	Tenant string `json:"tenant,omitempty"` // Empty to migrate every isolated tenant
+}
+
+// MigrateResult is the outcome of migrating one tenant
+type MigrateResult struct {
+	Tenant string `json:"tenant"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Provision creates the storage of a tenant and applies the module migrations to
+// it. The tenant ends up active, or failed with the error recorded.
+func (p *Provisioner) Provision(ctx context.Context, id string) (Tenant, error) {
+	t, err := p.router.store.Get(ctx, id)
+	if err != nil {
+		return Tenant{}, err
+	}
+	if err := p.create(ctx, &t); err != nil {
+		return p.finish(ctx, t, err)
+	}
+	return p.finish(ctx, t, p.migrate(ctx, t))
+}
+
+// create makes the schema of a tenant, or its database when no DSN was given
+func (p *Provisioner) create(ctx context.Context, t *Tenant) error {
+	shared := p.router.shared
+	switch {
+	case t.Isolation == IsolationSchema:
+		if database.Dialect(shared) != database.Postgres {
+			return apperrors.NewValidationError("Schema isolation needs a Postgres database")
+		}
+		_, err := shared.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS `+quote(t.Schema))
+		return err
+	case t.Isolation == IsolationDatabase && t.DSN == "":
+		dialect := database.Dialect(shared)
+		name := storageName(p.router.cfg.SchemaPrefix, t.ID)
+		dsn, err := siblingDSN(dialect, p.router.dbCfg.DSN, name)
+		if err != nil {
+			return apperrors.NewValidationError("Database isolation needs a dsn: " + err.Error())
+		}
+		if dialect == database.Postgres {
+			var exists int
+			if err := shared.QueryRowContext(ctx, `SELECT COUNT(*) FROM pg_database WHERE datname = $1`, name).Scan(&exists); err != nil {
+				return err
+			}
+			// CREATE DATABASE has no IF NOT EXISTS, and retries find it there
+			if exists == 0 {
+				if _, err := shared.ExecContext(ctx, `CREATE DATABASE `+quote(name)); err != nil {
+					return err
+				}
+			}
+		}
+		// SQLite creates the file when the pool first connects
+		t.Driver, t.DSN, t.Managed = p.router.dbCfg.Driver, dsn, true
+		t.UpdatedAt = time.Now().UTC()
+		return p.router.store.Put(ctx, *t)
+	}
+	return nil
+}
+
+// migrate applies the module migrations to the database of an isolated tenant
+func (p *Provisioner) migrate(ctx context.Context, t Tenant) error {
+	db, err := p.router.open(t)
+	if err != nil {
+		return err
+	}
+	return p.migrator.Migrate(ctx, db)
+}
+
+// finish records the outcome of provisioning or migrating a tenant
+func (p *Provisioner) finish(ctx context.Context, t Tenant, err error) (Tenant, error) {
+	now := time.Now().UTC()
+	if err != nil {
+		t.Status, t.Error = StatusFailed, err.Error()
+	} else {
+		t.Status, t.Error, t.MigratedAt = StatusActive, "", &now
+	}
+	t.UpdatedAt = now
+	if putErr := p.router.store.Put(ctx, t); putErr != nil && err == nil {
+		err = putErr
+	}
+	p.router.forget(t.ID)
+	return t, err
+}
+
+// Migrate applies the module migrations to an isolated tenant
+func (p *Provisioner) Migrate(ctx context.Context, id string) (Tenant, error) {
+	t, err := p.router.store.Get(ctx, id)
+	if err != nil {
+		return Tenant{}, err
+	}
+	if !t.Isolated() {
+		return Tenant{}, apperrors.NewValidationError("Shared tenants are migrated with the shared database")
+	}
+	return p.finish(ctx, t, p.migrate(ctx, t))
+}
+
+// MigrateAll migrates every isolated tenant that finished provisioning, carrying
+// on past failures. progress, which may be nil, is called with the percentage done
+// after each tenant.
+func (p *Provisioner) MigrateAll(ctx context.Context, progress func(percent int)) ([]MigrateResult, error) {
+	tenants, err := p.router.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Tenant
+	for _, t := range tenants {
+		if t.Isolated() && t.Status != StatusProvisioning {
+			pending = append(pending, t)
+		}
+	}
+
+	results := make([]MigrateResult, 0, len(pending))
+	for i, t := range pending {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result := MigrateResult{Tenant: t.ID}
+		if _, err := p.finish(ctx, t, p.migrate(ctx, t)); err != nil {
+			result.Error = err.Error()
+			logger.Error("failed to migrate tenant", zap.String("tenant", t.ID), zap.Error(err))
+		}
+		results = append(results, result)
+		if progress != nil {
+			progress((i + 1) * 100 / len(pending))
+		}
+	}
+	return results, nil
+}
+
+// Drop deletes the schema of a tenant, or its database when provisioning created
+// it. Databases given by DSN are left alone.
+func (p *Provisioner) Drop(ctx context.Context, t Tenant) error {
+	// The pool holds connections to the database being dropped
+	p.router.Evict(t.ID)
+	switch {
+	case t.Isolation == IsolationSchema:
+		_, err := p.router.shared.ExecContext(ctx, `DROP SCHEMA IF EXISTS `+quote(t.Schema)+` CASCADE`)
+		return err
+	case t.Isolation == IsolationDatabase && t.Managed:
+		if database.Dialect(p.router.shared) == database.SQLite {
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				if err := os.Remove(t.DSN + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+			return nil
+		}
+		_, err := p.router.shared.ExecContext(ctx, `DROP DATABASE IF EXISTS `+quote(storageName(p.router.cfg.SchemaPrefix, t.ID)))
+		return err
+	}
+	return nil
+}
+
+func (p *Provisioner) runProvision(ctx context.Context, task *operations.Task) (any, error) {
+	var payload tenantPayload
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+	t, err := p.Provision(ctx, payload.Tenant)
+	if err != nil {
+		return nil, fmt.Errorf("provisioning tenant %s: %w", payload.Tenant, err)
+	}
+	return redact(t), nil
+}
+
+func (p *Provisioner) runMigrate(ctx context.Context, task *operations.Task) (any, error) {
+	var payload tenantPayload
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Tenant != "" {
+		t, err := p.Migrate(ctx, payload.Tenant)
+		if err != nil {
+			return nil, fmt.Errorf("migrating tenant %s: %w", payload.Tenant, err)
+		}
+		return redact(t), nil
+	}
+	results, err := p.MigrateAll(ctx, func(percent int) { task.Progress(ctx, percent) })
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"data": results}, nil
+}
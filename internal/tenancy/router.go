@@ -0,0 +1,257 @@
+package tenancy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Router resolves tenants to their database, keeping a connection pool per
+// isolated tenant
+type Router struct {
+	cfg    Config
+	shared *sql.DB
+	dbCfg  database.Config // Of the shared database, which tenant pools start from
+	store  Store
+
+	mu      sync.Mutex
+	tenants map[string]cachedTenant
+	pools   map[string]*sql.DB
+}
+
+type cachedTenant struct {
+	tenant  Tenant
+	found   bool
+	fetched time.Time
+}
+
+// NewRouter creates a router over the shared database, opened with dbCfg
+func NewRouter(cfg Config, shared *sql.DB, dbCfg database.Config, store Store) *Router {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = 30 * time.Second
+	}
+	if cfg.SchemaPrefix == "" {
+		cfg.SchemaPrefix = "tenant_"
+	}
+	return &Router{cfg: cfg, shared: shared, dbCfg: dbCfg, store: store,
+		tenants: make(map[string]cachedTenant), pools: make(map[string]*sql.DB)}
+}
+
+// DB returns the database of a tenant: the shared one for tenants without a record
+// or provisioned as shared, and its own once an isolated tenant is active
+func (r *Router) DB(ctx context.Context, id string) (*sql.DB, error) {
+	if id == "" {
+		return r.shared, nil
+	}
+	t, found, err := r.tenant(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !found || !t.Isolated() {
+		return r.shared, nil
+	}
+	switch t.Status {
+	case StatusActive:
+	case StatusProvisioning:
+		return nil, apperrors.NewConflictError("Tenant is still being provisioned")
+	default:
+		return nil, apperrors.NewInternalServerError("Tenant database is unavailable")
+	}
+	return r.open(t)
+}
+
+// tenant returns the cached record of a tenant, including that it has none
+func (r *Router) tenant(ctx context.Context, id string) (Tenant, bool, error) {
+	r.mu.Lock()
+	c, ok := r.tenants[id]
+	r.mu.Unlock()
+	if ok && time.Since(c.fetched) < r.cfg.CacheTTL {
+		return c.tenant, c.found, nil
+	}
+
+	t, err := r.store.Get(ctx, id)
+	if err != nil && !errors.Is(err, errTenantNotFound) {
+		return Tenant{}, false, err
+	}
+	c = cachedTenant{tenant: t, found: err == nil, fetched: time.Now()}
+	r.mu.Lock()
+	r.tenants[id] = c
+	r.mu.Unlock()
+	return c.tenant, c.found, nil
+}
+
+// open returns the pool of an isolated tenant, opening it on first use
+func (r *Router) open(t Tenant) (*sql.DB, error) {
+	r.mu.Lock()
+	db, ok := r.pools[t.ID]
+	r.mu.Unlock()
+	if ok {
+		return db, nil
+	}
+
+	cfg, err := r.config(t)
+	if err != nil {
+		return nil, err
+	}
+	// Opened outside the lock, as it pings the database
+	db, err = database.Open(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", t.ID, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.pools[t.ID]; ok {
+		db.Close()
+		return existing, nil
+	}
+	r.pools[t.ID] = db
+	return db, nil
+}
+
+// config is the connection configuration of an isolated tenant's pool
+func (r *Router) config(t Tenant) (database.Config, error) {
+	cfg := r.dbCfg
+	if r.cfg.MaxOpenConns > 0 {
+		cfg.MaxOpenConns = r.cfg.MaxOpenConns
+	}
+	if r.cfg.MaxIdleConns > 0 {
+		cfg.MaxIdleConns = r.cfg.MaxIdleConns
+	}
+	switch t.Isolation {
+	case IsolationSchema:
+		if database.Dialect(r.shared) != database.Postgres {
+			return database.Config{}, fmt.Errorf("tenant %s: schema isolation needs Postgres", t.ID)
+		}
+		cfg.DSN = withSearchPath(cfg.DSN, t.Schema)
+	case IsolationDatabase:
+		if t.Driver != "" {
+			cfg.Driver = t.Driver
+		}
+		cfg.DSN = t.DSN
+	}
+	return cfg, nil
+}
+
+// Evict forgets the cached record and closes the pool of a tenant, after it was
+// changed or deleted. Queries still running on the pool fail.
+func (r *Router) Evict(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tenants, id)
+	if db, ok := r.pools[id]; ok {
+		db.Close()
+		delete(r.pools, id)
+	}
+}
+
+// forget drops the cached record of a tenant, keeping its pool
+func (r *Router) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tenants, id)
+}
+
+// Close closes the pools of every tenant
+func (r *Router) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, db := range r.pools {
+		db.Close()
+		delete(r.pools, id)
+	}
+}
+
+// route routes the database of ctx to that of its tenant
+func (r *Router) route(ctx context.Context) (context.Context, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	db, err := r.DB(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return database.WithDB(ctx, db), nil
+}
+
+// Middleware routes the stores of requests to the database of their tenant, so it
+// must come after tenant.Middleware and everything that sets the subject, signed
+// links included. Shared requests use the shared database.
+func (r *Router) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, err := r.route(c.Request.Context())
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// Inject keeps the tenant of a request with the jobs it enqueues, implementing
+// queue.ContextCarrier
+func (r *Router) Inject(ctx context.Context) map[string]string {
+	return tenant.Carrier{}.Inject(ctx)
+}
+
+// Extract scopes a job to the tenant that enqueued it and routes it to its database
+func (r *Router) Extract(ctx context.Context, values map[string]string) (context.Context, error) {
+	ctx, err := tenant.Carrier{}.Extract(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+	return r.route(ctx)
+}
+
+// withSearchPath has the connections of a Postgres DSN, in URL or keyword/value
+// form, resolve unqualified names in schema only
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return strings.TrimSpace(dsn) + " search_path=" + schema
+}
+
+var dbnameParam = regexp.MustCompile(`(^|\s)dbname=\S+`)
+
+// siblingDSN is the DSN of database name on the server of dsn: another database
+// of the Postgres server, or another file in the SQLite database's directory
+func siblingDSN(dialect, dsn, name string) (string, error) {
+	if dialect == database.SQLite {
+		path := strings.TrimPrefix(dsn, "file:")
+		if i := strings.IndexByte(path, '?'); i >= 0 {
+			path = path[:i]
+		}
+		if path == "" || path == ":memory:" {
+			return "", fmt.Errorf("an in-memory SQLite database has no directory to create tenant databases in")
+		}
+		return filepath.Join(filepath.Dir(path), name+".db"), nil
+	}
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		u.Path = "/" + name
+		return u.String(), nil
+	}
+	if dbnameParam.MatchString(dsn) {
+		return dbnameParam.ReplaceAllString(dsn, "${1}dbname="+name), nil
+	}
+	return strings.TrimSpace(dsn) + " dbname=" + name, nil
+}
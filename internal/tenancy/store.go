@@ -0,0 +1,178 @@
+package tenancy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"go-api/pkg/crypto"
+	apperrors "go-api/pkg/errors"
+)
+
+// Store persists tenants
+type Store interface {
+	Get(ctx context.Context, id string) (Tenant, error)
+	List(ctx context.Context) ([]Tenant, error)
+	Put(ctx context.Context, t Tenant) error
+	Delete(ctx context.Context, id string) error
+}
+
+var errTenantNotFound = apperrors.NewNotFoundError("Tenant not found")
+
+// MemoryStore keeps tenants in memory, used in tests; isolation needs a database
+type MemoryStore struct {
+	mu      sync.RWMutex
+	tenants map[string]Tenant
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tenants: make(map[string]Tenant)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return Tenant{}, errTenantNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, t Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants[t.ID] = t
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[id]; !ok {
+		return errTenantNotFound
+	}
+	delete(s.tenants, id)
+	return nil
+}
+
+// SQLStore persists tenants as JSON in the tenants table of the shared database.
+// With an envelope, DSNs are encrypted before the record is written, as they
+// carry credentials.
+type SQLStore struct {
+	db       *sql.DB
+	envelope *crypto.Envelope
+}
+
+// NewSQLStore creates a store backed by db, envelope may be nil
+func NewSQLStore(db *sql.DB, envelope *crypto.Envelope) *SQLStore {
+	return &SQLStore{db: db, envelope: envelope}
+}
+
+// EnsureSchema creates the tenants table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS tenants (
+			id         TEXT PRIMARY KEY,
+			data       TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Tenant, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM tenants WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tenant{}, errTenantNotFound
+	}
+	if err != nil {
+		return Tenant{}, err
+	}
+	return s.decode(ctx, id, data)
+}
+
+// record is where the fields of a tenant are stored
+func record(id string) crypto.Record {
+	return crypto.Record{Table: "tenants", ID: id}
+}
+
+func (s *SQLStore) decode(ctx context.Context, id, data string) (Tenant, error) {
+	var t Tenant
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return Tenant{}, err
+	}
+	if s.envelope != nil {
+		if err := s.envelope.DecryptFields(ctx, &t, record(id)); err != nil {
+			return Tenant{}, err
+		}
+	}
+	return t, nil
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Tenant, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, data FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Tenant{}
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		t, err := s.decode(ctx, id, data)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) Put(ctx context.Context, t Tenant) error {
+	if s.envelope != nil {
+		if err := s.envelope.EncryptFields(ctx, &t, record(t.ID)); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO tenants (id, data, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+		t.ID, string(data), t.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM tenants WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTenantNotFound
+	}
+	return nil
+}
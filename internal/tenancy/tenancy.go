@@ -0,0 +1,99 @@
+// Package tenancy isolates the data of tenants in a schema or a database of their
+// own. The router resolves the tenant of each request, and of the jobs it
+// enqueues, to its database and routes the module stores to it with
+// database.WithDB; tenants without a record, or provisioned as shared, keep using
+// the shared database. Identity and configuration, like users, API keys and the
+// tenants themselves, always live in the shared database, and so do the records of
+// background sweeps no tenant started, like retention and report schedules, which
+// only cover the shared database.
+package tenancy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// Isolation levels
+const (
+	IsolationShared   = "shared"   // Rows in the shared database
+	IsolationSchema   = "schema"   // A schema of the shared Postgres database
+	IsolationDatabase = "database" // A database of its own
+)
+
+// Provisioning statuses
+const (
+	StatusProvisioning = "provisioning"
+	StatusActive       = "active"
+	StatusFailed       = "failed"
+)
+
+// Config holds tenant isolation configuration
+type Config struct {
+	CacheTTL       time.Duration `yaml:"cacheTTL"`       // How long tenant records are cached by the router
+	MaxOpenConns   int           `yaml:"maxOpenConns"`   // Of each tenant's connection pool
+	MaxIdleConns   int           `yaml:"maxIdleConns"`   // Of each tenant's connection pool
+	MigrateOnStart bool          `yaml:"migrateOnStart"` // Apply module migrations to every isolated tenant at startup
+	SchemaPrefix   string        `yaml:"schemaPrefix"`   // Of the schemas and managed databases of tenants
+}
+
+// Tenant is a tenant's isolation and where its data lives
+type Tenant struct {
+	ID         string     `json:"id"` // The tenant claim of its users' tokens
+	Name       string     `json:"name,omitempty"`
+	Isolation  string     `json:"isolation"`
+	Schema     string     `json:"schema,omitempty"` // With schema isolation
+	Driver     string     `json:"driver,omitempty"` // With database isolation, defaults to the shared database's
+	DSN        string     `json:"dsn,omitempty" encrypt:"true"`
+	Managed    bool       `json:"managed"` // The database was created by provisioning, and is dropped with the tenant
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"` // Of the last failed provisioning or migration
+	MigratedAt *time.Time `json:"migratedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// Isolated reports whether the tenant's data lives outside the shared tables
+func (t Tenant) Isolated() bool {
+	return t.Isolation == IsolationSchema || t.Isolation == IsolationDatabase
+}
+
+// validID is what tenant IDs may look like, as they become part of schema and
+// database names
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,47}$`)
+
+// storageName is the schema or managed database name of a tenant
+func storageName(prefix, tenant string) string {
+	return prefix + strings.ReplaceAll(tenant, "-", "_")
+}
+
+// quote quotes an identifier interpolated into a statement
+func quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+// validate checks a tenant to be provisioned
+func validate(t Tenant) error {
+	var fields []apperrors.FieldError
+	if !validID.MatchString(t.ID) {
+		fields = append(fields, apperrors.FieldError{Field: "id", Rule: "pattern", Param: validID.String(),
+			Message: "id must be 1 to 48 lowercase letters, digits, dashes or underscores"})
+	}
+	switch t.Isolation {
+	case IsolationShared, IsolationSchema, IsolationDatabase:
+	default:
+		fields = append(fields, apperrors.FieldError{Field: "isolation", Rule: "oneof", Param: "shared schema database",
+			Message: fmt.Sprintf("isolation must be %s, %s or %s", IsolationShared, IsolationSchema, IsolationDatabase)})
+	}
+	if t.DSN != "" && t.Isolation != IsolationDatabase {
+		fields = append(fields, apperrors.FieldError{Field: "dsn", Rule: "excluded_unless", Param: "isolation database",
+			Message: "dsn is only used with database isolation"})
+	}
+	if len(fields) > 0 {
+		return apperrors.NewValidationError("Invalid tenant", fields...)
+	}
+	return nil
+}
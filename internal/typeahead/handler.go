@@ -0,0 +1,124 @@
+package typeahead
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go-api/internal/apiversion"
+	"go-api/internal/suggest"
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLimit bounds ?limit=, as a dropdown shows a handful of suggestions
+const maxLimit = 25
+
+// Suggestions are the entries suggested for a prefix
+type Suggestions struct {
+	Data []suggest.Entry `json:"data"`
+}
+
+// Routes mounts the suggestion endpoint
+func (m *typeaheadModule) Routes(api *apiversion.Group) {
+	api.GET("/suggestions", apiversion.Operation{
+		ID:      "suggest",
+		Summary: "Suggest resources while their name is typed",
+		Description: "Suggests the resources whose words start with those of ?q=, which needs at least " + strconv.Itoa(m.cfg.MinLength) +
+			" characters: shorter prefixes get no suggestions. ?types= is a comma-separated list of the types to suggest, " +
+			"every type by default. New resources are suggested within " + (m.cfg.IndexTTL + m.cfg.CacheTTL).String() + ", and each user has a rate " +
+			"of " + strconv.FormatFloat(m.cfg.RequestsPerSecond, 'f', -1, 64) + " requests per second, in bursts of " + strconv.Itoa(m.cfg.Burst) + ".",
+		Tags:     []string{"suggestions"},
+		Response: Suggestions{},
+	}, m.suggest)
+}
+
+type suggestQuery struct {
+	Q     string `form:"q" binding:"required,max=100"`
+	Types string `form:"types"`
+	Limit int    `form:"limit" binding:"min=1,max=25"`
+}
+
+func (m *typeaheadModule) suggest(c *gin.Context) {
+	ctx := c.Request.Context()
+	sub, ok := authz.SubjectFromContext(ctx)
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return
+	}
+	if !m.allow(sub.Tenant, sub.ID) {
+		lookups.WithLabelValues("limited").Inc()
+		c.Header("Retry-After", "1")
+		c.Error(apperrors.NewTooManyRequestsError("Too many suggestion requests, slow down"))
+		return
+	}
+	query := suggestQuery{Limit: m.cfg.Limit}
+	if err := bind.Query(c, &query); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid query", err))
+		return
+	}
+	var types []string
+	for _, t := range strings.Split(query.Types, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !slices.ContainsFunc(m.sources, func(src suggest.Source) bool { return src.Type == t }) {
+			c.Error(apperrors.NewValidationError("Invalid query", apperrors.FieldError{
+				Field: "types", Rule: "oneof", Message: strconv.Quote(t) + " is not a type of suggestions",
+			}))
+			return
+		}
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	types = slices.Compact(types)
+
+	prefix := suggest.Normalize(query.Q)
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(m.cfg.CacheTTL.Seconds())))
+	if utf8.RuneCountInString(prefix) < m.cfg.MinLength {
+		c.JSON(http.StatusOK, Suggestions{Data: []suggest.Entry{}})
+		return
+	}
+
+	// Suggestions depend on what the user may read, so they are cached per user;
+	// the cache scopes keys by tenant already
+	key := "typeahead:" + sub.ID + ":" + strings.Join(types, ",") + ":" + strconv.Itoa(query.Limit) + ":" + prefix
+	if raw, ok, err := m.cache.Get(ctx, key); err == nil && ok {
+		var cached Suggestions
+		if json.Unmarshal(raw, &cached) == nil {
+			lookups.WithLabelValues("cached").Inc()
+			c.JSON(http.StatusOK, cached)
+			return
+		}
+	}
+	index, err := m.index(ctx, sub.Tenant)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var lookupErr error
+	list := index.Lookup(prefix, query.Limit, func(e suggest.Entry) bool {
+		if lookupErr != nil || (len(types) > 0 && !slices.Contains(types, e.Type)) {
+			return false
+		}
+		allowed, err := authz.Can(ctx, "read", authz.Resource{Type: e.Type, ID: e.ID, Owner: e.Owner, Tenant: e.Tenant})
+		lookupErr = err
+		return allowed
+	})
+	if lookupErr != nil {
+		c.Error(lookupErr)
+		return
+	}
+	lookups.WithLabelValues("indexed").Inc()
+	result := Suggestions{Data: list}
+	if raw, err := json.Marshal(result); err == nil {
+		m.cache.Set(ctx, key, raw, m.cfg.CacheTTL)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,173 @@
+// Package typeahead is the feature module suggesting resources while their name is
+// typed. Each tenant has an index of the suggestions modules declare, built from
+// the sources on the first request and rebuilt once it is older than IndexTTL.
+// Typing sends a request per keystroke, often the same prefixes again after a
+// backspace, so suggestions are cached per user and limited per user by their own
+// rate, tighter in bursts than the limits of the rest of the API.
+package typeahead
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/internal/suggest"
+	"go-api/pkg/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+// Config holds typeahead configuration
+type Config struct {
+	Sources           []string      `yaml:"sources"`           // Types suggested; every declared source when empty
+	MinLength         int           `yaml:"minLength"`         // Characters typed before anything is suggested
+	Limit             int           `yaml:"limit"`             // Suggestions without ?limit=, which is at most 25
+	IndexTTL          time.Duration `yaml:"indexTTL"`          // How long the index of a tenant serves before it's rebuilt
+	CacheTTL          time.Duration `yaml:"cacheTTL"`          // Of the suggestions for a prefix
+	RequestsPerSecond float64       `yaml:"requestsPerSecond"` // Per user
+	Burst             int           `yaml:"burst"`
+}
+
+var lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "typeahead_lookups_total",
+	Help: "Suggestion requests, by result: cached, indexed or limited.",
+}, []string{"result"})
+
+// tenantIndex is the index of a tenant's suggestions
+type tenantIndex struct {
+	mu      sync.Mutex // Held while the index is built
+	index   *suggest.Index
+	builtAt time.Time
+}
+
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type typeaheadModule struct {
+	module.Base
+	cfg     Config
+	cache   cache.Cache
+	sources []suggest.Source
+
+	mu       sync.Mutex
+	indexes  map[string]*tenantIndex // By tenant
+	limiters map[string]*userLimiter // By tenant and user
+}
+
+// New returns the factory of the typeahead module
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if cfg.MinLength <= 0 {
+			cfg.MinLength = 2
+		}
+		if cfg.Limit <= 0 || cfg.Limit > maxLimit {
+			cfg.Limit = 10
+		}
+		if cfg.IndexTTL <= 0 {
+			cfg.IndexTTL = time.Minute
+		}
+		if cfg.CacheTTL <= 0 {
+			cfg.CacheTTL = 30 * time.Second
+		}
+		if cfg.RequestsPerSecond <= 0 {
+			cfg.RequestsPerSecond = 5
+		}
+		if cfg.Burst <= 0 {
+			cfg.Burst = 10
+		}
+		return &typeaheadModule{cfg: cfg, cache: deps.Cache, indexes: make(map[string]*tenantIndex),
+			limiters: make(map[string]*userLimiter)}, nil
+	}
+}
+
+func (m *typeaheadModule) Name() string { return "typeahead" }
+
+// Index keeps the sources configured to be suggested
+func (m *typeaheadModule) Index(sources []suggest.Source) {
+	m.sources = nil
+	for _, src := range sources {
+		if len(m.cfg.Sources) == 0 || slices.Contains(m.cfg.Sources, src.Type) {
+			m.sources = append(m.sources, src)
+		}
+	}
+}
+
+// Run drops the indexes of tenants and the limiters of users that weren't used
+// lately, until ctx is cancelled
+func (m *typeaheadModule) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.IndexTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		for tenant, ti := range m.indexes {
+			// Indexes being built are fresh
+			if ti.mu.TryLock() {
+				stale := time.Since(ti.builtAt) > m.cfg.IndexTTL
+				ti.mu.Unlock()
+				if stale {
+					delete(m.indexes, tenant)
+				}
+			}
+		}
+		for key, l := range m.limiters {
+			if time.Since(l.lastSeen) > time.Minute {
+				delete(m.limiters, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// allow reports whether a user may look up suggestions now
+func (m *typeaheadModule) allow(tenant, user string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := tenant + "/" + user
+	l, ok := m.limiters[key]
+	if !ok {
+		l = &userLimiter{limiter: rate.NewLimiter(rate.Limit(m.cfg.RequestsPerSecond), m.cfg.Burst)}
+		m.limiters[key] = l
+	}
+	l.lastSeen = time.Now()
+	return l.limiter.Allow()
+}
+
+// index returns the index of a tenant, building it from the sources when there
+// is none or it is stale. Requests of the tenant wait for the one building it.
+func (m *typeaheadModule) index(ctx context.Context, tenant string) (*suggest.Index, error) {
+	m.mu.Lock()
+	ti, ok := m.indexes[tenant]
+	if !ok {
+		ti = &tenantIndex{}
+		m.indexes[tenant] = ti
+	}
+	m.mu.Unlock()
+
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if ti.index != nil && time.Since(ti.builtAt) < m.cfg.IndexTTL {
+		return ti.index, nil
+	}
+	var entries []suggest.Entry
+	for _, src := range m.sources {
+		list, err := src.Entries(ctx, tenant)
+		if err != nil {
+			return nil, fmt.Errorf("typeahead: entries of %s: %w", src.Type, err)
+		}
+		entries = append(entries, list...)
+	}
+	ti.index, ti.builtAt = suggest.NewIndex(entries), time.Now()
+	return ti.index, nil
+}
@@ -0,0 +1,207 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go-api/internal/realtime"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+	"go-api/pkg/queue"
+
+	"go.uber.org/zap"
+)
+
+// Events recorded on an upload's stream, uploads-{id}
+const (
+	EventCompleted   = "upload.completed"
+	EventQuarantined = "upload.quarantined"
+)
+
+// Completed is the data of an EventCompleted event
+type Completed struct {
+	UploadID string            `json:"uploadId"`
+	OwnerID  string            `json:"ownerId"`
+	Tenant   string            `json:"tenant,omitempty"`
+	Key      string            `json:"key"`
+	Length   int64             `json:"length"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Quarantined is the data of an EventQuarantined event
+type Quarantined struct {
+	UploadID  string `json:"uploadId"`
+	OwnerID   string `json:"ownerId"`
+	Tenant    string `json:"tenant,omitempty"`
+	Signature string `json:"signature"`
+	Key       string `json:"key"` // Where the file was moved for review
+}
+
+// EventSchemas declares the schemas of the events recorded on upload streams
+func (m *uploadsModule) EventSchemas() []eventschema.Schema {
+	return []eventschema.Schema{
+		{Event: EventCompleted, Version: 1, Description: "An upload was assembled and stored.",
+			Schema: eventschema.From(Completed{})},
+		{Event: EventQuarantined, Version: 1, Description: "Malware was found in an upload, which was moved for review.",
+			Schema: eventschema.From(Quarantined{})},
+	}
+}
+
+// Topics lets clients follow the events of the uploads they may read
+func (m *uploadsModule) Topics() []realtime.Topic {
+	return []realtime.Topic{{Name: "uploads", Events: []string{EventCompleted, EventQuarantined},
+		Resource: "upload", IDField: "uploadId", Owner: "ownerId", Tenant: "tenant"}}
+}
+
+// complete assembles a finished upload from its chunks, scans it when ClamAV is
+// configured and runs the completion hooks. Every step can be repeated, so a retry
+// after a failure picks up where it stopped.
+func (m *uploadsModule) complete(ctx context.Context, job *queue.Job) error {
+	var payload completeJob
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	u, err := m.store.Get(ctx, payload.UploadID)
+	if errors.Is(err, errUploadNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.Status != StatusProcessing {
+		return nil
+	}
+
+	if u, err = m.assemble(ctx, u); err != nil {
+		return err
+	}
+	if m.scanner != nil {
+		content, _, err := m.storage.Open(ctx, u.Key())
+		if err != nil {
+			return err
+		}
+		result, err := m.scanner.Scan(ctx, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+		if result.Infected {
+			return m.quarantine(ctx, u, result.Signature)
+		}
+	}
+
+	hooksMu.RLock()
+	registered := append([]namedHook(nil), hooks...)
+	hooksMu.RUnlock()
+	for _, h := range registered {
+		if err := h.fn(ctx, u, m.storage); err != nil {
+			return fmt.Errorf("uploads: completion hook %s: %w", h.name, err)
+		}
+	}
+
+	u.Status, u.Error, u.UpdatedAt = StatusComplete, "", time.Now().UTC()
+	if err := m.store.Save(ctx, u); err != nil {
+		return err
+	}
+	_, err = m.events.Append(ctx, "uploads-"+u.ID, eventstore.AnyVersion, eventstore.NewEvent{
+		Type: EventCompleted,
+		Data: Completed{UploadID: u.ID, OwnerID: u.OwnerID, Tenant: u.Tenant, Key: u.Key(), Length: u.Length, Metadata: u.Metadata},
+	})
+	return err
+}
+
+// assemble concatenates the chunks into the upload's file and deletes them. The
+// record forgets the chunks before they are deleted, so a crash in between leaves
+// orphans at worst, never a file missing pieces.
+func (m *uploadsModule) assemble(ctx context.Context, u Upload) (Upload, error) {
+	if len(u.Parts) == 0 && u.Length > 0 {
+		// Assembled by an earlier attempt
+		return u, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for _, key := range u.Parts {
+			part, _, err := m.storage.Open(ctx, key)
+			if err == nil {
+				_, err = io.Copy(pw, part)
+				part.Close()
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	obj, err := m.storage.Put(ctx, u.Key(), pr, contentType(u))
+	pr.Close()
+	if err != nil {
+		return u, err
+	}
+	if obj.Size != u.Length {
+		return u, fmt.Errorf("uploads: %s assembled to %d bytes instead of %d", u.ID, obj.Size, u.Length)
+	}
+
+	parts := u.Parts
+	u.Parts, u.UpdatedAt = nil, time.Now().UTC()
+	if err := m.store.Save(ctx, u); err != nil {
+		return u, err
+	}
+	for _, key := range parts {
+		if err := m.storage.Delete(ctx, key); err != nil {
+			logger.Error("failed to delete upload chunk", zap.String("key", key), zap.Error(err))
+		}
+	}
+	return u, nil
+}
+
+// quarantine moves an infected file out of the upload's keys and records an audit
+// event
+func (m *uploadsModule) quarantine(ctx context.Context, u Upload, signature string) error {
+	src, dst := u.Key(), "quarantine/"+u.Key()
+	content, obj, err := m.storage.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	_, err = m.storage.Put(ctx, dst, content, obj.ContentType)
+	content.Close()
+	if err != nil {
+		return err
+	}
+
+	u.Status, u.UpdatedAt = StatusQuarantined, time.Now().UTC()
+	u.Error = "Malware found: " + signature
+	if err := m.store.Save(ctx, u); err != nil {
+		return err
+	}
+	if err := m.storage.Delete(ctx, src); err != nil {
+		return err
+	}
+
+	logger.Warn("malware found in upload",
+		zap.String("upload", u.ID),
+		zap.String("owner", u.OwnerID),
+		zap.String("signature", signature),
+		zap.String("quarantine", dst),
+	)
+	_, err = m.events.Append(ctx, "uploads-"+u.ID, eventstore.AnyVersion, eventstore.NewEvent{
+		Type:     EventQuarantined,
+		Data:     Quarantined{UploadID: u.ID, OwnerID: u.OwnerID, Tenant: u.Tenant, Signature: signature, Key: dst},
+		Metadata: map[string]string{"source": "clamav"},
+	})
+	return err
+}
+
+// contentType is the type the client gave in the metadata, under tus-js-client's
+// filetype key
+func contentType(u Upload) string {
+	if t := u.Metadata["filetype"]; t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
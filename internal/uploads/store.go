@@ -0,0 +1,274 @@
+package uploads
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Store persists upload records; the chunks and files are in storage
+type Store interface {
+	Save(ctx context.Context, u Upload) error
+	Get(ctx context.Context, id string) (Upload, error)
+	// Advance saves u only if the stored offset is still from, so that of concurrent
+	// chunks for the same offset one wins and the others get errOffsetConflict
+	Advance(ctx context.Context, u Upload, from int64) error
+	Delete(ctx context.Context, id string) error
+	// Expired returns up to limit unfinished uploads last written before cutoff
+	Expired(ctx context.Context, cutoff time.Time, limit int) ([]Upload, error)
+	CountExpired(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+var (
+	errUploadNotFound = apperrors.NewNotFoundError("Upload not found")
+	errOffsetConflict = apperrors.NewConflictError("Upload-Offset does not match the upload's offset")
+)
+
+// MemoryStore keeps uploads in memory, used when no database is configured
+type MemoryStore struct {
+	mu      sync.Mutex
+	uploads map[string]Upload
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{uploads: make(map[string]Upload)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, u Upload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[u.ID] = u
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return Upload{}, errUploadNotFound
+	}
+	return u, nil
+}
+
+func (s *MemoryStore) Advance(ctx context.Context, u Upload, from int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.uploads[u.ID]
+	if !ok {
+		return errUploadNotFound
+	}
+	if current.Offset != from {
+		return errOffsetConflict
+	}
+	s.uploads[u.ID] = u
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, id)
+	return nil
+}
+
+func (s *MemoryStore) Expired(ctx context.Context, cutoff time.Time, limit int) ([]Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Upload
+	for _, u := range s.uploads {
+		if len(list) < limit && u.Status == StatusUploading && u.UpdatedAt.Before(cutoff) {
+			list = append(list, u)
+		}
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) CountExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, u := range s.uploads {
+		if u.Status == StatusUploading && u.UpdatedAt.Before(cutoff) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// migrations create the uploads table, with the record as JSON in data. The offset
+// has a column of its own for Advance's compare-and-set.
+var migrations = []module.Migration{{
+	Name: "create_uploads",
+	SQL: `
+		CREATE TABLE IF NOT EXISTS uploads (
+			id            TEXT PRIMARY KEY,
+			owner_id      TEXT NOT NULL,
+			status        TEXT NOT NULL,
+			upload_offset BIGINT NOT NULL,
+			data          TEXT NOT NULL,
+			updated_at    TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS uploads_status_updated_at ON uploads (status, updated_at)`,
+}}
+
+// SQLStore persists uploads in the uploads table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// conn is the database of the tenant ctx was routed to, see database.WithDB
+func (s *SQLStore) conn(ctx context.Context) *sql.DB {
+	return database.From(ctx, s.db)
+}
+
+func (s *SQLStore) Save(ctx context.Context, u Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO uploads (id, owner_id, status, upload_offset, data, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			upload_offset = EXCLUDED.upload_offset,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at`,
+		u.ID, u.OwnerID, u.Status, u.Offset, string(data), u.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Upload, error) {
+	var data string
+	err := s.conn(ctx).QueryRowContext(ctx, `SELECT data FROM uploads WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Upload{}, errUploadNotFound
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+	var u Upload
+	return u, json.Unmarshal([]byte(data), &u)
+}
+
+func (s *SQLStore) Advance(ctx context.Context, u Upload, from int64) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	res, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE uploads SET status = $3, upload_offset = $4, data = $5, updated_at = $6
+		WHERE id = $1 AND upload_offset = $2`,
+		u.ID, from, u.Status, u.Offset, string(data), u.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errOffsetConflict
+	}
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM uploads WHERE id = $1`, id)
+	return err
+}
+
+func (s *SQLStore) Expired(ctx context.Context, cutoff time.Time, limit int) ([]Upload, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT data FROM uploads WHERE status = $1 AND updated_at < $2 ORDER BY updated_at LIMIT $3`,
+		StatusUploading, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Upload
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var u Upload
+		if err := json.Unmarshal([]byte(data), &u); err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) CountExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	var n int64
+	err := s.conn(ctx).QueryRowContext(ctx, `SELECT COUNT(*) FROM uploads WHERE status = $1 AND updated_at < $2`, StatusUploading, cutoff).Scan(&n)
+	return n, err
+}
+
+// MongoStore persists uploads in the uploads collection
+type MongoStore struct {
+	uploads mongodb.Collection[Upload]
+}
+
+// NewMongoStore creates a store backed by c, creating its indexes
+func NewMongoStore(ctx context.Context, c *mongodb.Client) (*MongoStore, error) {
+	uploads := mongodb.NewCollection[Upload](c, "uploads", "id", errUploadNotFound)
+	if err := uploads.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return &MongoStore{uploads: uploads}, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, u Upload) error {
+	return s.uploads.Save(ctx, u.ID, u)
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (Upload, error) {
+	return s.uploads.Get(ctx, id)
+}
+
+func (s *MongoStore) Advance(ctx context.Context, u Upload, from int64) error {
+	res, err := s.uploads.Mongo().ReplaceOne(ctx, bson.D{{Key: "id", Value: u.ID}, {Key: "offset", Value: from}}, u)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errOffsetConflict
+	}
+	return nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	_, err := s.uploads.DeleteMany(ctx, bson.D{{Key: "id", Value: id}})
+	return err
+}
+
+func (s *MongoStore) Expired(ctx context.Context, cutoff time.Time, limit int) ([]Upload, error) {
+	return s.uploads.Find(ctx, expiredFilter(cutoff),
+		options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}}).SetLimit(int64(limit)))
+}
+
+func (s *MongoStore) CountExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	return s.uploads.Count(ctx, expiredFilter(cutoff))
+}
+
+func expiredFilter(cutoff time.Time) bson.D {
+	return bson.D{{Key: "status", Value: StatusUploading}, {Key: "updatedAt", Value: bson.D{{Key: "$lt", Value: cutoff}}}}
+}
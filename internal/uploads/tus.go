@@ -0,0 +1,432 @@
+package uploads
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/apiversion"
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/retrysafe"
+	"go-api/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// The tus protocol version implemented, and its extensions
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,expiration,checksum,termination"
+	chunkType     = "application/offset+octet-stream"
+)
+
+// checksums are the Upload-Checksum algorithms supported
+var checksums = map[string]func() hash.Hash{"md5": md5.New, "sha1": sha1.New, "sha256": sha256.New}
+
+// statusChecksumMismatch is tus's status for chunks that don't match Upload-Checksum
+const statusChecksumMismatch = 460
+
+// Routes mounts the tus endpoints and the download of finished uploads, which all
+// need the signed-in owner
+func (m *uploadsModule) Routes(api *apiversion.Group) {
+	tags := []string{"uploads"}
+	api.Handle(http.MethodOptions, "/uploads", apiversion.Operation{
+		ID:          "uploadCapabilities",
+		Summary:     "Describe the resumable upload server",
+		Description: "Answers with the tus version, extensions, maximum size and checksum algorithms supported.",
+		Tags:        tags,
+	}, m.tus, m.options)
+	api.POST("/uploads", apiversion.Operation{
+		ID:          "createUpload",
+		Summary:     "Start a resumable upload",
+		Description: "tus creation: takes Upload-Length and optionally Upload-Metadata, and answers 201 with the upload's Location. A body of type application/offset+octet-stream is taken as the first chunk.",
+		Tags:        tags,
+	}, m.tus, m.create)
+	api.Handle(http.MethodHead, "/uploads/:id", apiversion.Operation{
+		ID:          "getUploadOffset",
+		Summary:     "Get how much of an upload was received",
+		Description: "Answers with Upload-Offset, the byte to resume from, and Upload-Length.",
+		Tags:        tags,
+	}, m.tus, m.head)
+	api.PATCH("/uploads/:id", apiversion.Operation{
+		ID:          "appendUploadChunk",
+		Summary:     "Upload a chunk",
+		Description: "Appends the body, of type application/offset+octet-stream, at Upload-Offset. An optional Upload-Checksum of md5, sha1 or sha256 is verified, answering 460 on mismatch. A chunk cut off is discarded whole, so resume from the offset reported by HEAD.",
+		Tags:        tags,
+		Idempotency: retrysafe.Idempotent, // A chunk sent again no longer matches Upload-Offset
+	}, m.tus, m.patch)
+	api.GET("/uploads/:id/file", apiversion.Operation{
+		ID:          "downloadUpload",
+		Summary:     "Download a finished upload",
+		Description: "Supports Range and If-Range, answering 206 with the requested bytes, so downloads can be resumed. Not a tus endpoint: Tus-Resumable isn't needed.",
+		Tags:        tags,
+	}, m.download)
+	api.Handle(http.MethodHead, "/uploads/:id/file", apiversion.Operation{
+		ID:      "getUploadFileInfo",
+		Summary: "Get the size and ETag of a finished upload",
+		Tags:    tags,
+	}, m.download)
+	api.DELETE("/uploads/:id", apiversion.Operation{
+		ID:      "deleteUpload",
+		Summary: "Cancel or delete an upload",
+		Tags:    tags,
+	}, m.tus, m.delete)
+}
+
+// tus sets Tus-Resumable on responses and rejects requests for other versions of
+// the protocol, except the OPTIONS discovering them
+func (m *uploadsModule) tus(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.Error(statusError(http.StatusPreconditionFailed, "Tus-Resumable must be "+tusVersion))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (m *uploadsModule) options(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if m.cfg.MaxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(m.cfg.MaxSize, 10))
+	}
+	c.Header("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+	c.Status(http.StatusNoContent)
+}
+
+func (m *uploadsModule) create(c *gin.Context) {
+	sub, ok := subject(c)
+	if !ok {
+		return
+	}
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.Error(apperrors.NewValidationError("Upload-Defer-Length is not supported, send Upload-Length"))
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.Error(apperrors.NewValidationError("Upload-Length must be the size of the file in bytes"))
+		return
+	}
+	if m.cfg.MaxSize > 0 && length > m.cfg.MaxSize {
+		c.Error(statusError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Uploads can be at most %d bytes", m.cfg.MaxSize)))
+		return
+	}
+	metadata, err := parseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	now := time.Now().UTC()
+	u := Upload{
+		ID:        uuid.New().String(),
+		OwnerID:   sub.ID,
+		Tenant:    sub.Tenant,
+		Length:    length,
+		Metadata:  metadata,
+		Status:    StatusUploading,
+		ExpiresAt: now.Add(m.cfg.Expiry),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if length == 0 {
+		// Nothing to wait for
+		u.Status = StatusProcessing
+	}
+	ctx := c.Request.Context()
+	if err := m.store.Save(ctx, u); err != nil {
+		c.Error(err)
+		return
+	}
+	if u.Status == StatusProcessing {
+		m.enqueueCompletion(c, u)
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+u.ID)
+
+	if isChunk(c) {
+		u, err = m.append(c, u, 0)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	m.offsetHeaders(c, u)
+	c.Status(http.StatusCreated)
+}
+
+func (m *uploadsModule) head(c *gin.Context) {
+	u, ok := m.owned(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if len(u.Metadata) > 0 {
+		c.Header("Upload-Metadata", formatMetadata(u.Metadata))
+	}
+	m.offsetHeaders(c, u)
+	c.Status(http.StatusOK)
+}
+
+func (m *uploadsModule) patch(c *gin.Context) {
+	u, ok := m.owned(c)
+	if !ok {
+		return
+	}
+	if !isChunk(c) {
+		c.Error(statusError(http.StatusUnsupportedMediaType, "Content-Type must be "+chunkType))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.Error(apperrors.NewValidationError("Upload-Offset must be the offset the chunk starts at"))
+		return
+	}
+	if u, err = m.append(c, u, offset); err != nil {
+		c.Error(err)
+		return
+	}
+	m.offsetHeaders(c, u)
+	c.Status(http.StatusNoContent)
+}
+
+func (m *uploadsModule) download(c *gin.Context) {
+	u, ok := m.owned(c)
+	if !ok {
+		return
+	}
+	switch u.Status {
+	case StatusQuarantined:
+		c.Error(apperrors.NewForbiddenError("Upload was quarantined because malware was found in it"))
+		return
+	case StatusUploading, StatusProcessing:
+		c.Error(apperrors.NewConflictError("Upload is not complete yet"))
+		return
+	}
+	if name := u.Metadata["filename"]; name != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	if err := storage.Serve(c.Writer, c.Request, m.storage, u.Key()); err != nil {
+		c.Error(err)
+	}
+}
+
+func (m *uploadsModule) delete(c *gin.Context) {
+	u, ok := m.owned(c)
+	if !ok {
+		return
+	}
+	if err := m.remove(c.Request.Context(), u); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// append stores the request body as the chunk at offset. The chunk goes to storage
+// as an object of its own and only counts once the record's offset moved past it,
+// so a chunk that is cut off or loses a race to the same offset leaves no trace.
+func (m *uploadsModule) append(c *gin.Context, u Upload, offset int64) (Upload, error) {
+	switch {
+	case u.Status != StatusUploading && offset == u.Offset:
+		// A retried last chunk; it was already received
+		return u, nil
+	case u.Status != StatusUploading:
+		return u, apperrors.NewConflictError("Upload is already complete")
+	case time.Now().After(u.ExpiresAt):
+		return u, apperrors.NewGoneError("Upload has expired")
+	case offset != u.Offset:
+		return u, errOffsetConflict
+	}
+	sum, err := parseChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		return u, err
+	}
+
+	ctx := c.Request.Context()
+	remaining := u.Length - u.Offset
+	counter := &countingReader{r: io.LimitReader(c.Request.Body, remaining+1)}
+	var body io.Reader = counter
+	if sum != nil {
+		body = io.TeeReader(counter, sum.hash)
+	}
+	key := fmt.Sprintf("uploads/%s/parts/%020d-%s", u.ID, offset, uuid.New().String()[:8])
+	if _, err := m.storage.Put(ctx, key, body, chunkType); err != nil {
+		return u, err
+	}
+
+	switch {
+	case counter.n > remaining:
+		err = statusError(http.StatusRequestEntityTooLarge, "Chunk goes past Upload-Length")
+	case sum != nil && !sum.matches():
+		err = statusError(statusChecksumMismatch, "Chunk does not match Upload-Checksum")
+	case counter.n == 0:
+		return u, m.storage.Delete(ctx, key)
+	}
+	if err == nil {
+		next := u
+		now := time.Now().UTC()
+		next.Offset += counter.n
+		next.Parts = append(append([]string(nil), u.Parts...), key)
+		next.UpdatedAt, next.ExpiresAt = now, now.Add(m.cfg.Expiry)
+		if next.Offset == next.Length {
+			next.Status = StatusProcessing
+		}
+		if err = m.store.Advance(ctx, next, offset); err == nil {
+			if next.Status == StatusProcessing {
+				m.enqueueCompletion(c, next)
+			}
+			return next, nil
+		}
+	}
+	if delErr := m.storage.Delete(ctx, key); delErr != nil {
+		logger.Error("failed to delete rejected upload chunk", zap.String("key", key), zap.Error(delErr))
+	}
+	return u, err
+}
+
+func (m *uploadsModule) enqueueCompletion(c *gin.Context, u Upload) {
+	if _, err := m.queue.Enqueue(c.Request.Context(), "default", jobComplete, completeJob{UploadID: u.ID}); err != nil {
+		logger.Error("failed to enqueue upload completion", zap.String("upload", u.ID), zap.Error(err))
+	}
+}
+
+// offsetHeaders tells the client where to resume and, while it can, until when
+func (m *uploadsModule) offsetHeaders(c *gin.Context, u Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	if u.Status == StatusUploading {
+		c.Header("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	}
+}
+
+// owned loads the upload of the request, which only its owner may touch
+func (m *uploadsModule) owned(c *gin.Context) (Upload, bool) {
+	sub, ok := subject(c)
+	if !ok {
+		return Upload{}, false
+	}
+	u, err := m.store.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && u.OwnerID != sub.ID {
+		// Not telling others the upload exists
+		err = errUploadNotFound
+	}
+	if err != nil {
+		c.Error(err)
+		return Upload{}, false
+	}
+	return u, true
+}
+
+func subject(c *gin.Context) (authz.Subject, bool) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return authz.Subject{}, false
+	}
+	return sub, true
+}
+
+func isChunk(c *gin.Context) bool {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	return mediaType == chunkType
+}
+
+// statusError is a validation error answered with one of the statuses tus
+// prescribes
+func statusError(status int, message string) *apperrors.AppError {
+	appErr := apperrors.NewValidationError(message)
+	appErr.StatusCode = status
+	return appErr
+}
+
+// parseMetadata decodes Upload-Metadata: comma separated keys, each followed by a
+// space and its base64 value unless it has none
+func parseMetadata(header string) (map[string]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if key == "" || err != nil {
+			return nil, apperrors.NewValidationError("Upload-Metadata must be comma separated keys with base64 values")
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k
+		if v := metadata[k]; v != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(v))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// checksum is a chunk's expected digest along with the hash computing its actual one
+type checksum struct {
+	hash     hash.Hash
+	expected []byte
+}
+
+func (s *checksum) matches() bool {
+	return bytes.Equal(s.hash.Sum(nil), s.expected)
+}
+
+// parseChecksum decodes Upload-Checksum, an algorithm and a base64 digest. It
+// returns nil when the header is missing.
+func parseChecksum(header string) (*checksum, error) {
+	if header == "" {
+		return nil, nil
+	}
+	algorithm, encoded, _ := strings.Cut(header, " ")
+	newHash, ok := checksums[algorithm]
+	if !ok {
+		return nil, apperrors.NewValidationError("Upload-Checksum algorithm must be md5, sha1 or sha256")
+	}
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, apperrors.NewValidationError("Upload-Checksum digest must be base64")
+	}
+	return &checksum{hash: newHash(), expected: expected}, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
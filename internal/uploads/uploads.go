@@ -0,0 +1,194 @@
+// Package uploads is the feature module for large files, uploaded with the tus
+// resumable upload protocol (https://tus.io/protocols/resumable-upload). Chunks are
+// kept in storage as they arrive; once the last one is in, a job assembles the
+// file, scans it when ClamAV is configured and runs the completion hooks.
+package uploads
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-api/internal/module"
+	"go-api/pkg/clamav"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/mongodb"
+	"go-api/pkg/queue"
+	"go-api/pkg/retention"
+	"go-api/pkg/storage"
+)
+
+// Config holds resumable upload configuration
+type Config struct {
+	MaxSize int64         `yaml:"maxSize"` // Largest Upload-Length accepted
+	Expiry  time.Duration `yaml:"expiry"`  // Unfinished uploads expire this long after their last chunk
+	Store   string        `yaml:"store"`   // memory, sql or mongodb; the database by default
+}
+
+// Upload statuses
+const (
+	StatusUploading   = "uploading"
+	StatusProcessing  = "processing" // Being assembled, scanned and handed to the hooks
+	StatusComplete    = "complete"
+	StatusQuarantined = "quarantined" // Malware was found; the file is kept for review only
+)
+
+// Upload is a file being or having been uploaded
+type Upload struct {
+	ID        string            `json:"id" index:",unique"`
+	OwnerID   string            `json:"ownerId"`
+	Tenant    string            `json:"tenant,omitempty"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"` // Bytes received so far
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Status    string            `json:"status" index:"status_updated_at"`
+	Parts     []string          `json:"parts,omitempty"` // Storage keys of the chunks, in order
+	Error     string            `json:"error,omitempty"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt" index:"status_updated_at"`
+}
+
+// Key is where the assembled file of a complete upload is stored
+func (u Upload) Key() string {
+	return "uploads/" + u.ID + "/file"
+}
+
+// CompletionHook processes a finished upload, whose file is at u.Key() in files.
+// Hooks run in registration order; when one fails, the completion is retried with
+// every hook, so they have to be idempotent.
+type CompletionHook func(ctx context.Context, u Upload, files storage.Storage) error
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []namedHook
+)
+
+type namedHook struct {
+	name string
+	fn   CompletionHook
+}
+
+// OnComplete registers a hook run for every finished upload, typically from the
+// init function of the package that processes them
+func OnComplete(name string, fn CompletionHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, namedHook{name: name, fn: fn})
+}
+
+// jobComplete assembles, scans and hands a finished upload to the hooks
+const jobComplete = "uploads.complete"
+
+type completeJob struct {
+	UploadID string `json:"uploadId"`
+}
+
+type uploadsModule struct {
+	module.Base
+	cfg     Config
+	backend string
+	store   Store
+	mongo   *mongodb.Client // Set when the records are kept in MongoDB
+	storage storage.Storage
+	queue   *queue.Manager
+	scanner *clamav.Client
+	events  eventstore.Store
+}
+
+// New returns the factory of the uploads module, which needs the shared storage
+func New(cfg Config) module.Factory {
+	return func(deps module.Deps) (module.Module, error) {
+		if deps.Storage == nil {
+			return nil, fmt.Errorf("uploads: no storage configured")
+		}
+		if cfg.Expiry <= 0 {
+			cfg.Expiry = 24 * time.Hour
+		}
+		backend, err := deps.Backend(cfg.Store)
+		if err != nil {
+			return nil, fmt.Errorf("uploads: %w", err)
+		}
+		var store Store = NewMemoryStore()
+		var mongo *mongodb.Client
+		switch backend {
+		case module.BackendSQL:
+			store = NewSQLStore(deps.DB)
+		case module.BackendMongo:
+			mongo = deps.Mongo
+			if store, err = NewMongoStore(context.Background(), deps.Mongo); err != nil {
+				return nil, fmt.Errorf("uploads: %w", err)
+			}
+		}
+		return &uploadsModule{cfg: cfg, backend: backend, store: store, mongo: mongo, storage: deps.Storage, queue: deps.Queue, scanner: deps.Antivirus, events: deps.Events}, nil
+	}
+}
+
+func (m *uploadsModule) Name() string { return "uploads" }
+
+func (m *uploadsModule) Migrations() []module.Migration {
+	if m.backend != module.BackendSQL {
+		return nil
+	}
+	return migrations
+}
+
+func (m *uploadsModule) HealthChecks() []module.HealthCheck {
+	if m.mongo == nil {
+		return nil
+	}
+	return []module.HealthCheck{{Name: "mongodb", Check: m.mongo.Ping}}
+}
+
+func (m *uploadsModule) Jobs() map[string]queue.HandlerFunc {
+	return map[string]queue.HandlerFunc{jobComplete: m.complete}
+}
+
+// RetentionPolicies removes unfinished uploads, chunks included, once they expired
+func (m *uploadsModule) RetentionPolicies() []retention.Policy {
+	return []retention.Policy{{
+		Name:        "uploads_unfinished",
+		Description: "Expired unfinished resumable uploads",
+		MaxAge:      m.cfg.Expiry,
+		Target:      expiredUploads{m},
+	}}
+}
+
+// expiredUploads is the retention target of unfinished uploads
+type expiredUploads struct {
+	m *uploadsModule
+}
+
+func (t expiredUploads) Count(ctx context.Context, cutoff time.Time) (int64, error) {
+	return t.m.store.CountExpired(ctx, cutoff)
+}
+
+func (t expiredUploads) Purge(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	expired, err := t.m.store.Expired(ctx, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	for _, u := range expired {
+		if err := t.m.remove(ctx, u); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// remove deletes an upload's record and stored objects
+func (m *uploadsModule) remove(ctx context.Context, u Upload) error {
+	objects, err := m.storage.List(ctx, "uploads/"+u.ID+"/")
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := m.storage.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return m.store.Delete(ctx, u.ID)
+}
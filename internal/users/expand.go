@@ -0,0 +1,29 @@
+package users
+
+import (
+	"context"
+
+	"go-api/pkg/render"
+)
+
+// Expander embeds the user referenced by a userId member when ?expand=user is requested.
+// link is the URL template of a user, e.g. /admin/users/{id}.
+func Expander(store Store, link string) render.Expander {
+	return render.Expander{
+		Name: "user",
+		Key:  "userId",
+		Type: "users",
+		Link: link,
+		Load: func(ctx context.Context, ids []string) (map[string]any, error) {
+			list, err := store.GetMany(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			related := make(map[string]any, len(list))
+			for _, u := range list {
+				related[u.ID] = u
+			}
+			return related, nil
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package users
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/pkg/latency"
+	"go-api/pkg/patch"
+	"go-api/pkg/render"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for inspecting and editing users
+type Handler struct {
+	store Store
+}
+
+// NewHandler creates a user handler
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// fields are the members clients may select with ?fields=
+var fields = render.Fields("id", "tenant", "email", "name", "roles", "timezone", "provider", "externalId", "createdAt", "updatedAt", "lastLoginAt")
+
+// RegisterRoutes mounts the user endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	resource := render.Describe(render.Resource{Type: "users", Link: rg.BasePath() + "/users/{id}"})
+	rg.GET("/users", latency.Budget(500*time.Millisecond), routing.Query("tenant", "fields"), fields, resource, h.list)
+	rg.GET("/users/:id", latency.Budget(200*time.Millisecond), routing.Query("fields"), fields, resource, h.get)
+	rg.PATCH("/users/:id", h.update)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	list, err := h.store.List(c.Request.Context(), c.Query("tenant"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	render.JSON(c, http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Handler) get(c *gin.Context) {
+	u, err := h.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	render.JSON(c, http.StatusOK, u)
+}
+
+// update applies a merge patch or JSON patch. Identity provider links and timestamps
+// are maintained by sign-in and can't be edited.
+func (h *Handler) update(c *gin.Context) {
+	u, err := h.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	changed, err := patch.Apply(c, &u, patch.ReadOnly("/id", "/provider", "/externalId", "/createdAt", "/updatedAt", "/lastLoginAt"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if len(changed) > 0 {
+		u.UpdatedAt = time.Now().UTC()
+		if err := h.store.Save(c.Request.Context(), u); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, u)
+}
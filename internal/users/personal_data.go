@@ -0,0 +1,49 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PersonalData exposes user accounts to data exports and erasure
+type PersonalData struct {
+	store Store
+}
+
+// NewPersonalData creates the personal data provider for user accounts
+func NewPersonalData(store Store) PersonalData {
+	return PersonalData{store: store}
+}
+
+func (p PersonalData) Name() string { return "account" }
+
+func (p PersonalData) ExportPersonalData(ctx context.Context, userID string) (any, error) {
+	u, err := p.store.Get(ctx, userID)
+	if errors.Is(err, errUserNotFound) {
+		return nil, nil
+	}
+	return u, err
+}
+
+// ErasePersonalData anonymizes the account instead of deleting it, so records in
+// other modules still reference an existing user. The external identity link is
+// dropped, so signing in again creates a new account.
+func (p PersonalData) ErasePersonalData(ctx context.Context, userID string) error {
+	u, err := p.store.Get(ctx, userID)
+	if errors.Is(err, errUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	u.Email = "erased+" + u.ID + "@invalid"
+	u.Name = ""
+	u.Roles = nil
+	u.Provider = ""
+	u.ExternalID = ""
+	u.LastLoginAt = nil
+	u.UpdatedAt = time.Now().UTC()
+	return p.store.Save(ctx, u)
+}
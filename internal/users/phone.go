@@ -0,0 +1,307 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// PhoneConfig holds phone number verification configuration
+type PhoneConfig struct {
+	CodeLength  int           `yaml:"codeLength"`  // Digits of the codes sent
+	CodeTTL     time.Duration `yaml:"codeTTL"`     // How long a code can be entered
+	MaxAttempts int           `yaml:"maxAttempts"` // Wrong codes allowed before a new one must be sent
+	ResendAfter time.Duration `yaml:"resendAfter"` // Minimum time between codes sent to a user
+	MaxSends    int           `yaml:"maxSends"`    // Codes sent to a user per SendWindow
+	SendWindow  time.Duration `yaml:"sendWindow"`
+
+	TwilioAccountSID string `yaml:"twilioAccountSID"` // Verification is disabled without one
+	TwilioAuthToken  string `yaml:"twilioAuthToken"`
+	TwilioFrom       string `yaml:"twilioFrom"` // Sending number, or messaging service SID
+}
+
+// PhoneNumber is a number a user proved they receive text messages at
+type PhoneNumber struct {
+	Number     string    `json:"number"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// Verification is the state of a user's pending phone number verification
+type Verification struct {
+	Number       string    `json:"number"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	ResendAt     time.Time `json:"resendAt"` // When another code can be requested
+	AttemptsLeft int       `json:"attemptsLeft"`
+}
+
+// Challenge is the code last sent to a user, and the sends counted against their
+// limit. Codes are stored hashed; Code is empty once one has been verified.
+type Challenge struct {
+	UserID      string
+	Number      string
+	Code        string
+	Attempts    int
+	SentAt      time.Time
+	ExpiresAt   time.Time
+	Sends       int
+	WindowStart time.Time
+}
+
+// PhoneStore persists verified numbers and pending challenges
+type PhoneStore interface {
+	Numbers(ctx context.Context, userID string) ([]PhoneNumber, error)
+	// SaveNumber adds a verified number, or refreshes when it was verified
+	SaveNumber(ctx context.Context, userID string, n PhoneNumber) error
+	DeleteNumber(ctx context.Context, userID, number string) error
+	// DeleteAll removes the user's numbers and challenge
+	DeleteAll(ctx context.Context, userID string) error
+	Challenge(ctx context.Context, userID string) (Challenge, error)
+	SaveChallenge(ctx context.Context, c Challenge) error
+	// CountAttempt records an attempt to enter the current code, returning the
+	// attempts made so far including this one
+	CountAttempt(ctx context.Context, userID string) (int, error)
+}
+
+var (
+	errChallengeNotFound = apperrors.NewNotFoundError("No phone number verification pending")
+	errNumberNotFound    = apperrors.NewNotFoundError("Phone number not found")
+)
+
+// PhoneVerifier proves users receive text messages at a number, by sending a code
+// they have to enter before it expires. Codes are limited per user, both in how
+// often they are sent and in how many wrong ones are tried.
+type PhoneVerifier struct {
+	cfg    PhoneConfig
+	store  PhoneStore
+	sender SMSSender
+}
+
+// NewPhoneVerifier creates a verifier sending codes with sender. Verification is
+// disabled when sender is nil, but numbers verified before can still be listed.
+func NewPhoneVerifier(cfg PhoneConfig, store PhoneStore, sender SMSSender) *PhoneVerifier {
+	if cfg.CodeLength <= 0 {
+		cfg.CodeLength = 6
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = 10 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.MaxSends <= 0 {
+		cfg.MaxSends = 5
+	}
+	if cfg.SendWindow <= 0 {
+		cfg.SendWindow = time.Hour
+	}
+	return &PhoneVerifier{cfg: cfg, store: store, sender: sender}
+}
+
+// NewTwilioSender returns the Twilio sender configured in cfg, or nil when none is
+func NewTwilioSender(cfg PhoneConfig) SMSSender {
+	if cfg.TwilioAccountSID == "" {
+		return nil
+	}
+	return NewTwilio(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioFrom)
+}
+
+// Enabled reports whether codes can be sent
+func (v *PhoneVerifier) Enabled() bool {
+	return v.sender != nil
+}
+
+// Numbers returns the user's verified numbers
+func (v *PhoneVerifier) Numbers(ctx context.Context, userID string) ([]PhoneNumber, error) {
+	return v.store.Numbers(ctx, userID)
+}
+
+// Pending returns the user's verification waiting for a code, if any
+func (v *PhoneVerifier) Pending(ctx context.Context, userID string) (*Verification, error) {
+	c, err := v.store.Challenge(ctx, userID)
+	if errors.Is(err, errChallengeNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Code == "" || time.Now().After(c.ExpiresAt) {
+		return nil, nil
+	}
+	verification := v.state(c)
+	return &verification, nil
+}
+
+// Start sends a code to number. Rate limited requests fail with a too many requests
+// error, and the returned state tells when another code can be sent.
+func (v *PhoneVerifier) Start(ctx context.Context, userID, number string) (Verification, error) {
+	if !v.Enabled() {
+		return Verification{}, apperrors.NewNotFoundError("Phone number verification is not available")
+	}
+
+	numbers, err := v.store.Numbers(ctx, userID)
+	if err != nil {
+		return Verification{}, err
+	}
+	for _, n := range numbers {
+		if n.Number == number {
+			return Verification{}, apperrors.NewConflictError("Phone number is already verified")
+		}
+	}
+
+	now := time.Now().UTC()
+	c, err := v.store.Challenge(ctx, userID)
+	if errors.Is(err, errChallengeNotFound) {
+		c = Challenge{UserID: userID}
+	} else if err != nil {
+		return Verification{}, err
+	}
+	if now.Sub(c.WindowStart) >= v.cfg.SendWindow {
+		c.Sends = 0
+		c.WindowStart = now
+	}
+	if state := v.state(c); now.Before(state.ResendAt) {
+		if c.Sends >= v.cfg.MaxSends {
+			return state, apperrors.NewTooManyRequestsError("Too many verification codes requested, try again later")
+		}
+		return state, apperrors.NewTooManyRequestsError("A verification code was sent recently, try again later")
+	}
+
+	code, err := v.code()
+	if err != nil {
+		return Verification{}, err
+	}
+	c.Number = number
+	c.Code = hashCode(userID, number, code)
+	c.Attempts = 0
+	c.SentAt = now
+	c.ExpiresAt = now.Add(v.cfg.CodeTTL)
+	c.Sends++
+	// The send is counted before it's made, so failing deliveries can't be retried
+	// past the limit
+	if err := v.store.SaveChallenge(ctx, c); err != nil {
+		return Verification{}, err
+	}
+
+	body := code + " is your verification code. It expires in " + v.cfg.CodeTTL.String() + "."
+	if err := v.sender.SendSMS(ctx, number, body); err != nil {
+		var appErr *apperrors.AppError
+		if !errors.As(err, &appErr) {
+			appErr = apperrors.Wrap(err, apperrors.CodeInternal)
+			appErr.Message = "Failed to send the verification code"
+		}
+		return Verification{}, appErr
+	}
+	return v.state(c), nil
+}
+
+// Confirm checks a code the user entered for number and, if it's the one sent,
+// stores the number as verified
+func (v *PhoneVerifier) Confirm(ctx context.Context, userID, number, code string) (PhoneNumber, error) {
+	c, err := v.store.Challenge(ctx, userID)
+	if err != nil {
+		return PhoneNumber{}, err
+	}
+	if c.Code == "" || c.Number != number {
+		return PhoneNumber{}, errChallengeNotFound
+	}
+	now := time.Now().UTC()
+	if now.After(c.ExpiresAt) {
+		return PhoneNumber{}, apperrors.NewGoneError("The verification code has expired, request a new one")
+	}
+
+	attempts, err := v.store.CountAttempt(ctx, userID)
+	if err != nil {
+		return PhoneNumber{}, err
+	}
+	if attempts > v.cfg.MaxAttempts {
+		return PhoneNumber{}, apperrors.NewTooManyRequestsError("Too many wrong codes, request a new one")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashCode(userID, number, code)), []byte(c.Code)) != 1 {
+		return PhoneNumber{}, apperrors.NewValidationError("Invalid verification code", apperrors.FieldError{
+			Pointer: "/code",
+			Field:   "code",
+			Rule:    "code",
+			Message: "code is not the one sent to " + number,
+		})
+	}
+
+	c.Code = ""
+	if err := v.store.SaveChallenge(ctx, c); err != nil {
+		return PhoneNumber{}, err
+	}
+	n := PhoneNumber{Number: number, VerifiedAt: now}
+	if err := v.store.SaveNumber(ctx, userID, n); err != nil {
+		return PhoneNumber{}, err
+	}
+	return n, nil
+}
+
+// Remove deletes one of the user's verified numbers
+func (v *PhoneVerifier) Remove(ctx context.Context, userID, number string) error {
+	return v.store.DeleteNumber(ctx, userID, number)
+}
+
+func (v *PhoneVerifier) state(c Challenge) Verification {
+	resendAt := c.SentAt.Add(v.cfg.ResendAfter)
+	if c.Sends >= v.cfg.MaxSends {
+		resendAt = c.WindowStart.Add(v.cfg.SendWindow)
+	}
+	return Verification{
+		Number:       c.Number,
+		ExpiresAt:    c.ExpiresAt,
+		ResendAt:     resendAt,
+		AttemptsLeft: max(v.cfg.MaxAttempts-c.Attempts, 0),
+	}
+}
+
+// code returns random digits
+func (v *PhoneVerifier) code() (string, error) {
+	var b strings.Builder
+	for range v.cfg.CodeLength {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(byte('0' + d.Int64()))
+	}
+	return b.String(), nil
+}
+
+// hashCode binds a code to the user and number it was sent for, so a stored hash
+// is useless for verifying anything else
+func hashCode(userID, number, code string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + number + "\x00" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// PhonePersonalData exposes verified phone numbers to data exports and erasure
+type PhonePersonalData struct {
+	store PhoneStore
+}
+
+// NewPhonePersonalData creates the personal data provider for phone numbers
+func NewPhonePersonalData(store PhoneStore) PhonePersonalData {
+	return PhonePersonalData{store: store}
+}
+
+func (p PhonePersonalData) Name() string { return "phone-numbers" }
+
+func (p PhonePersonalData) ExportPersonalData(ctx context.Context, userID string) (any, error) {
+	numbers, err := p.store.Numbers(ctx, userID)
+	if err != nil || len(numbers) == 0 {
+		return nil, err
+	}
+	return numbers, nil
+}
+
+func (p PhonePersonalData) ErasePersonalData(ctx context.Context, userID string) error {
+	return p.store.DeleteAll(ctx, userID)
+}
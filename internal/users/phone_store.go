@@ -0,0 +1,207 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// MemoryPhoneStore keeps phone numbers in memory, used when no database is configured
+type MemoryPhoneStore struct {
+	mu         sync.Mutex
+	numbers    map[string]map[string]PhoneNumber
+	challenges map[string]Challenge
+}
+
+// NewMemoryPhoneStore creates an empty in-memory store
+func NewMemoryPhoneStore() *MemoryPhoneStore {
+	return &MemoryPhoneStore{numbers: make(map[string]map[string]PhoneNumber), challenges: make(map[string]Challenge)}
+}
+
+func (s *MemoryPhoneStore) Numbers(ctx context.Context, userID string) ([]PhoneNumber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]PhoneNumber, 0, len(s.numbers[userID]))
+	for _, n := range s.numbers[userID] {
+		list = append(list, n)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].VerifiedAt.Before(list[j].VerifiedAt) })
+	return list, nil
+}
+
+func (s *MemoryPhoneStore) SaveNumber(ctx context.Context, userID string, n PhoneNumber) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.numbers[userID] == nil {
+		s.numbers[userID] = make(map[string]PhoneNumber)
+	}
+	s.numbers[userID][n.Number] = n
+	return nil
+}
+
+func (s *MemoryPhoneStore) DeleteNumber(ctx context.Context, userID, number string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.numbers[userID][number]; !ok {
+		return errNumberNotFound
+	}
+	delete(s.numbers[userID], number)
+	return nil
+}
+
+func (s *MemoryPhoneStore) DeleteAll(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.numbers, userID)
+	delete(s.challenges, userID)
+	return nil
+}
+
+func (s *MemoryPhoneStore) Challenge(ctx context.Context, userID string) (Challenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[userID]
+	if !ok {
+		return Challenge{}, errChallengeNotFound
+	}
+	return c, nil
+}
+
+func (s *MemoryPhoneStore) SaveChallenge(ctx context.Context, c Challenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[c.UserID] = c
+	return nil
+}
+
+func (s *MemoryPhoneStore) CountAttempt(ctx context.Context, userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[userID]
+	if !ok {
+		return 0, errChallengeNotFound
+	}
+	c.Attempts++
+	s.challenges[userID] = c
+	return c.Attempts, nil
+}
+
+// SQLPhoneStore persists verified numbers in the user_phone_numbers table and
+// challenges in phone_verifications
+type SQLPhoneStore struct {
+	db *sql.DB
+}
+
+// NewSQLPhoneStore creates a store backed by db
+func NewSQLPhoneStore(db *sql.DB) *SQLPhoneStore {
+	return &SQLPhoneStore{db: db}
+}
+
+// EnsureSchema creates the phone number tables if they do not exist
+func (s *SQLPhoneStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS user_phone_numbers (
+			user_id     TEXT NOT NULL,
+			number      TEXT NOT NULL,
+			verified_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, number)
+		);
+		CREATE TABLE IF NOT EXISTS phone_verifications (
+			user_id      TEXT PRIMARY KEY,
+			number       TEXT NOT NULL,
+			code         TEXT NOT NULL,
+			attempts     INTEGER NOT NULL DEFAULT 0,
+			sent_at      TIMESTAMP NOT NULL,
+			expires_at   TIMESTAMP NOT NULL,
+			sends        INTEGER NOT NULL DEFAULT 0,
+			window_start TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+func (s *SQLPhoneStore) Numbers(ctx context.Context, userID string) ([]PhoneNumber, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT number, verified_at FROM user_phone_numbers WHERE user_id = $1 ORDER BY verified_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []PhoneNumber{}
+	for rows.Next() {
+		var n PhoneNumber
+		if err := rows.Scan(&n.Number, &n.VerifiedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLPhoneStore) SaveNumber(ctx context.Context, userID string, n PhoneNumber) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_phone_numbers (user_id, number, verified_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, number) DO UPDATE SET verified_at = EXCLUDED.verified_at`,
+		userID, n.Number, n.VerifiedAt)
+	return err
+}
+
+func (s *SQLPhoneStore) DeleteNumber(ctx context.Context, userID, number string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM user_phone_numbers WHERE user_id = $1 AND number = $2`, userID, number)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNumberNotFound
+	}
+	return nil
+}
+
+func (s *SQLPhoneStore) DeleteAll(ctx context.Context, userID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM user_phone_numbers WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM phone_verifications WHERE user_id = $1`, userID)
+	return err
+}
+
+func (s *SQLPhoneStore) Challenge(ctx context.Context, userID string) (Challenge, error) {
+	c := Challenge{UserID: userID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT number, code, attempts, sent_at, expires_at, sends, window_start
+		FROM phone_verifications WHERE user_id = $1`, userID).
+		Scan(&c.Number, &c.Code, &c.Attempts, &c.SentAt, &c.ExpiresAt, &c.Sends, &c.WindowStart)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Challenge{}, errChallengeNotFound
+	}
+	return c, err
+}
+
+func (s *SQLPhoneStore) SaveChallenge(ctx context.Context, c Challenge) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO phone_verifications (user_id, number, code, attempts, sent_at, expires_at, sends, window_start)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET
+			number = EXCLUDED.number,
+			code = EXCLUDED.code,
+			attempts = EXCLUDED.attempts,
+			sent_at = EXCLUDED.sent_at,
+			expires_at = EXCLUDED.expires_at,
+			sends = EXCLUDED.sends,
+			window_start = EXCLUDED.window_start`,
+		c.UserID, c.Number, c.Code, c.Attempts, c.SentAt, c.ExpiresAt, c.Sends, c.WindowStart)
+	return err
+}
+
+// CountAttempt increments in the database, so concurrent guesses on several
+// instances all count
+func (s *SQLPhoneStore) CountAttempt(ctx context.Context, userID string) (int, error) {
+	var attempts int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE phone_verifications SET attempts = attempts + 1 WHERE user_id = $1 RETURNING attempts`, userID).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errChallengeNotFound
+	}
+	return attempts, err
+}
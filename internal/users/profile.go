@@ -0,0 +1,139 @@
+package users
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/pkg/authz"
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Profile is the signed-in user's own account, with the state of their phone numbers
+type Profile struct {
+	User
+	PhoneNumbers      []PhoneNumber `json:"phoneNumbers"`
+	PhoneVerification *Verification `json:"phoneVerification,omitempty"` // Pending verification
+}
+
+// ProfileHandler exposes the self-service profile of signed-in users
+type ProfileHandler struct {
+	store  Store
+	phones *PhoneVerifier
+}
+
+// NewProfileHandler creates a profile handler
+func NewProfileHandler(store Store, phones *PhoneVerifier) *ProfileHandler {
+	return &ProfileHandler{store: store, phones: phones}
+}
+
+// RegisterRoutes mounts the /me endpoints on a router group of signed-in users.
+// Phone numbers can only be added while an SMS provider is configured.
+func (h *ProfileHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/me", h.get)
+	if h.phones.Enabled() {
+		rg.POST("/me/phone-numbers", h.startVerification)
+		rg.POST("/me/phone-numbers/verify", h.confirmVerification)
+	}
+	rg.DELETE("/me/phone-numbers/:number", h.removeNumber)
+}
+
+func currentUser(c *gin.Context) (string, bool) {
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok || sub.ID == "" {
+		c.Error(apperrors.NewUnauthorizedError("Authentication required"))
+		return "", false
+	}
+	return sub.ID, true
+}
+
+func (h *ProfileHandler) get(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	u, err := h.store.Get(ctx, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	numbers, err := h.phones.Numbers(ctx, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	pending, err := h.phones.Pending(ctx, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, Profile{User: u, PhoneNumbers: numbers, PhoneVerification: pending})
+}
+
+type startVerificationRequest struct {
+	Number string `json:"number" binding:"required,phone"`
+}
+
+func (h *ProfileHandler) startVerification(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	var req startVerificationRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid phone number", err))
+		return
+	}
+
+	verification, err := h.phones.Start(c.Request.Context(), userID, req.Number)
+	if errors.Is(err, apperrors.ErrTooManyRequests) {
+		wait := time.Until(verification.ResendAt).Seconds()
+		c.Header("Retry-After", strconv.Itoa(int(max(wait, 1))))
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusAccepted, verification)
+}
+
+type confirmVerificationRequest struct {
+	Number string `json:"number" binding:"required,phone"`
+	Code   string `json:"code" binding:"required,numeric"`
+}
+
+func (h *ProfileHandler) confirmVerification(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	var req confirmVerificationRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid verification", err))
+		return
+	}
+
+	number, err := h.phones.Confirm(c.Request.Context(), userID, req.Number, req.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, number)
+}
+
+func (h *ProfileHandler) removeNumber(c *gin.Context) {
+	userID, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if err := h.phones.Remove(c.Request.Context(), userID, c.Param("number")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
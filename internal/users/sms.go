@@ -0,0 +1,88 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// twilioAPIURL is the base of the Twilio REST API
+const twilioAPIURL = "https://api.twilio.com/2010-04-01"
+
+// SMSSender delivers text messages to phone numbers in E.164 format
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// Twilio sends text messages through the Twilio Messages API
+type Twilio struct {
+	accountSID string
+	authToken  string
+	from       string
+	url        string
+	client     *http.Client
+}
+
+// NewTwilio creates a sender for a Twilio account. from is the sending phone number,
+// or the SID of a messaging service, which starts with MG.
+func NewTwilio(accountSID, authToken, from string) *Twilio {
+	return &Twilio{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		url:        twilioAPIURL + "/Accounts/" + url.PathEscape(accountSID) + "/Messages.json",
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// twilioError is the body of failed Twilio API calls
+type twilioError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// twilioInvalidNumbers are the error codes of numbers that can't receive messages:
+// invalid numbers, landlines and unreachable destinations
+var twilioInvalidNumbers = map[int]bool{21211: true, 21408: true, 21610: true, 21612: true, 21614: true}
+
+func (t *Twilio) SendSMS(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(t.from, "MG") {
+		form.Set("MessagingServiceSid", t.from)
+	} else {
+		form.Set("From", t.from)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.accountSID, t.authToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	var e twilioError
+	json.NewDecoder(resp.Body).Decode(&e)
+	if twilioInvalidNumbers[e.Code] {
+		return apperrors.NewValidationError("The phone number can't receive text messages", apperrors.FieldError{
+			Pointer: "/number",
+			Field:   "number",
+			Rule:    "phone",
+			Message: e.Message,
+		})
+	}
+	return fmt.Errorf("twilio: unexpected status %d: %d %s", resp.StatusCode, e.Code, e.Message)
+}
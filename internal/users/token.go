@@ -0,0 +1,53 @@
+package users
+
+import (
+	"time"
+
+	"go-api/pkg/jwks"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Config holds user session configuration
+type Config struct {
+	TokenTTL time.Duration `yaml:"tokenTTL"` // Lifetime of access tokens issued after sign-in
+	Phone    PhoneConfig   `yaml:"phone"`
+}
+
+// TokenIssuer issues access tokens for signed-in users. The claims are the ones
+// authz.SubjectFromJWT reads.
+type TokenIssuer struct {
+	keys *jwks.Manager
+	ttl  time.Duration
+}
+
+// NewTokenIssuer creates a token issuer signing with keys
+func NewTokenIssuer(keys *jwks.Manager, cfg Config) *TokenIssuer {
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = time.Hour
+	}
+	return &TokenIssuer{keys: keys, ttl: cfg.TokenTTL}
+}
+
+// TTL returns the lifetime of issued tokens
+func (t *TokenIssuer) TTL() time.Duration {
+	return t.ttl
+}
+
+// Issue signs an access token for u
+func (t *TokenIssuer) Issue(u User) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"jti":   uuid.New().String(),
+		"sub":   u.ID,
+		"email": u.Email,
+		"roles": u.Roles,
+		"iat":   now.Unix(),
+		"exp":   now.Add(t.ttl).Unix(),
+	}
+	if u.Tenant != "" {
+		claims["tenant"] = u.Tenant
+	}
+	return t.keys.Sign(claims)
+}
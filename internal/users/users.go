@@ -0,0 +1,269 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// User is a local account. Accounts signed in through an external identity provider
+// are linked to it by Provider and ExternalID.
+type User struct {
+	ID          string     `json:"id"`
+	Tenant      string     `json:"tenant,omitempty"`
+	Email       string     `json:"email"`
+	Name        string     `json:"name,omitempty"`
+	Roles       []string   `json:"roles"`
+	Timezone    string     `json:"timezone,omitempty" binding:"omitempty,timezone"` // IANA zone for dates shown to the user
+	Provider    string     `json:"provider,omitempty"`
+	ExternalID  string     `json:"externalId,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// Store persists users
+type Store interface {
+	Get(ctx context.Context, id string) (User, error)
+	// GetMany returns the users that exist among ids, in no particular order
+	GetMany(ctx context.Context, ids []string) ([]User, error)
+	// List returns the users of a tenant, or every user when tenant is empty
+	List(ctx context.Context, tenant string) ([]User, error)
+	FindByExternalID(ctx context.Context, provider, externalID string) (User, error)
+	// Save inserts or updates a user by ID
+	Save(ctx context.Context, u User) error
+}
+
+var errUserNotFound = apperrors.NewNotFoundError("User not found")
+
+// Provision links an external identity to a local user, creating the user on first
+// sign-in and refreshing its attributes from the identity provider on later ones
+func Provision(ctx context.Context, store Store, u User) (User, error) {
+	now := time.Now().UTC()
+
+	existing, err := store.FindByExternalID(ctx, u.Provider, u.ExternalID)
+	switch {
+	case err == nil:
+		existing.Tenant = u.Tenant
+		existing.Email = u.Email
+		existing.Name = u.Name
+		existing.Roles = u.Roles
+		u = existing
+	case errors.Is(err, errUserNotFound):
+		u.ID = uuid.New().String()
+		u.CreatedAt = now
+	default:
+		return User{}, err
+	}
+
+	u.UpdatedAt = now
+	u.LastLoginAt = &now
+	if err := store.Save(ctx, u); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// MemoryStore keeps users in memory, used when no database is configured
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[string]User)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, errUserNotFound
+	}
+	return u, nil
+}
+
+func (s *MemoryStore) GetMany(ctx context.Context, ids []string) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]User, 0, len(ids))
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			list = append(list, u)
+		}
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, tenant string) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		if tenant == "" || u.Tenant == tenant {
+			list = append(list, u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) FindByExternalID(ctx context.Context, provider, externalID string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.users {
+		if u.Provider == provider && u.ExternalID == externalID {
+			return u, nil
+		}
+	}
+	return User{}, errUserNotFound
+}
+
+func (s *MemoryStore) Save(ctx context.Context, u User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.ID] = u
+	return nil
+}
+
+// SQLStore persists users in the users table. Roles are stored space-separated.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the users table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS users (
+			id            TEXT PRIMARY KEY,
+			tenant        TEXT NOT NULL DEFAULT '',
+			email         TEXT NOT NULL,
+			name          TEXT NOT NULL DEFAULT '',
+			roles         TEXT NOT NULL DEFAULT '',
+			provider      TEXT NOT NULL DEFAULT '',
+			external_id   TEXT NOT NULL DEFAULT '',
+			created_at    TIMESTAMP NOT NULL,
+			updated_at    TIMESTAMP NOT NULL,
+			last_login_at TIMESTAMP NULL,
+			timezone      TEXT NOT NULL DEFAULT ''
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS users_external_id ON users (provider, external_id) WHERE provider <> ''`)
+	if err != nil || database.Dialect(s.db) == database.SQLite {
+		return err
+	}
+	// Tables created before users had time zones lack the column. SQLite has no
+	// ADD COLUMN IF NOT EXISTS, but its tables never predate it.
+	_, err = s.db.ExecContext(ctx, `ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+const selectUsers = `SELECT id, tenant, email, name, roles, timezone, provider, external_id, created_at, updated_at, last_login_at FROM users`
+
+func (s *SQLStore) Get(ctx context.Context, id string) (User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx, selectUsers+` WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errUserNotFound
+	}
+	return u, err
+}
+
+func (s *SQLStore) GetMany(ctx context.Context, ids []string) ([]User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	return s.query(ctx, selectUsers+` WHERE id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+}
+
+func (s *SQLStore) List(ctx context.Context, tenant string) ([]User, error) {
+	if tenant != "" {
+		return s.query(ctx, selectUsers+` WHERE tenant = $1 ORDER BY created_at DESC`, tenant)
+	}
+	return s.query(ctx, selectUsers+` ORDER BY created_at DESC`)
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLStore) FindByExternalID(ctx context.Context, provider, externalID string) (User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx, selectUsers+` WHERE provider = $1 AND external_id = $2`, provider, externalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errUserNotFound
+	}
+	return u, err
+}
+
+func (s *SQLStore) Save(ctx context.Context, u User) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO users (id, tenant, email, name, roles, timezone, provider, external_id, created_at, updated_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE SET
+			tenant = EXCLUDED.tenant,
+			email = EXCLUDED.email,
+			name = EXCLUDED.name,
+			roles = EXCLUDED.roles,
+			timezone = EXCLUDED.timezone,
+			provider = EXCLUDED.provider,
+			external_id = EXCLUDED.external_id,
+			updated_at = EXCLUDED.updated_at,
+			last_login_at = EXCLUDED.last_login_at`,
+		u.ID, u.Tenant, u.Email, u.Name, strings.Join(u.Roles, " "), u.Timezone, u.Provider, u.ExternalID,
+		u.CreatedAt, u.UpdatedAt, u.LastLoginAt)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (User, error) {
+	var u User
+	var roles string
+	var lastLoginAt sql.NullTime
+	if err := row.Scan(&u.ID, &u.Tenant, &u.Email, &u.Name, &roles, &u.Timezone, &u.Provider, &u.ExternalID, &u.CreatedAt, &u.UpdatedAt, &lastLoginAt); err != nil {
+		return User{}, err
+	}
+	u.Roles = strings.Fields(roles)
+	if lastLoginAt.Valid {
+		u.LastLoginAt = &lastLoginAt.Time
+	}
+	return u, nil
+}
@@ -0,0 +1,42 @@
+package view
+
+import (
+	"net/http"
+	"regexp"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+var templateName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// PreviewHandler renders email templates in the browser for admins
+type PreviewHandler struct{}
+
+// NewPreviewHandler creates an email preview handler, the engine's HTMLRender must be a *Renderer
+func NewPreviewHandler() *PreviewHandler {
+	return &PreviewHandler{}
+}
+
+// RegisterRoutes mounts the preview endpoints on an admin router group
+func (h *PreviewHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/previews/emails/:name", h.email)
+}
+
+// email renders emails/:name in the email layout using query parameters as template data,
+// e.g. /admin/previews/emails/welcome?Name=Ada
+func (h *PreviewHandler) email(c *gin.Context) {
+	name := c.Param("name")
+	if !templateName.MatchString(name) {
+		c.Error(apperrors.NewValidationError("Invalid template name"))
+		return
+	}
+
+	data := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		data[key] = values[0]
+	}
+
+	c.HTML(http.StatusOK, "email:emails/"+name, data)
+}
@@ -0,0 +1,125 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+// Config holds view layer configuration
+type Config struct {
+	Dir           string `yaml:"dir"`           // On-disk template directory, empty uses the embedded templates
+	Reload        bool   `yaml:"reload"`        // Re-parse templates on every render, for development
+	DefaultLayout string `yaml:"defaultLayout"` // Layout used when the template name has no "layout:" prefix
+}
+
+// Renderer renders pages inside layouts, with every partial available to both.
+//
+// Templates are addressed by their path without extension, optionally prefixed
+// with a layout name: "pages/home" renders in the default layout, "email:emails/welcome"
+// renders in layouts/email. Pages fill the layout by defining "content" and "title".
+type Renderer struct {
+	cfg Config
+	fs  fs.FS
+
+	mu    sync.RWMutex
+	cache map[string]*template.Template
+}
+
+// Funcs are available to every template
+var Funcs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"list":  func(items ...any) []any { return items },
+}
+
+// New creates a renderer reading from cfg.Dir, or from embedded when no directory is set.
+// embedded is expected to be rooted at the templates directory.
+func New(cfg Config, embedded fs.FS) *Renderer {
+	if cfg.DefaultLayout == "" {
+		cfg.DefaultLayout = "base"
+	}
+	files := embedded
+	if cfg.Dir != "" {
+		files = os.DirFS(cfg.Dir)
+	}
+	return &Renderer{cfg: cfg, fs: files, cache: make(map[string]*template.Template)}
+}
+
+// Instance implements gin's render.HTMLRender so handlers can use c.HTML
+func (r *Renderer) Instance(name string, data any) render.Render {
+	tmpl, err := r.Template(name)
+	if err != nil {
+		return errorRender{err}
+	}
+	return render.HTML{Template: tmpl, Data: data}
+}
+
+// Template returns the parsed template set for name, ready to execute
+func (r *Renderer) Template(name string) (*template.Template, error) {
+	if !r.cfg.Reload {
+		r.mu.RLock()
+		tmpl, ok := r.cache[name]
+		r.mu.RUnlock()
+		if ok {
+			return tmpl, nil
+		}
+	}
+
+	tmpl, err := r.parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.cfg.Reload {
+		r.mu.Lock()
+		r.cache[name] = tmpl
+		r.mu.Unlock()
+	}
+	return tmpl, nil
+}
+
+func (r *Renderer) parse(name string) (*template.Template, error) {
+	layout, page := r.cfg.DefaultLayout, name
+	if i := strings.Index(name, ":"); i >= 0 {
+		layout, page = name[:i], name[i+1:]
+	}
+
+	if _, err := fs.Stat(r.fs, page+".html"); err != nil {
+		return nil, apperrors.NewNotFoundError(fmt.Sprintf("View %q not found", page))
+	}
+
+	partials, err := fs.Glob(r.fs, "partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	files := append([]string{path.Join("layouts", layout+".html")}, partials...)
+	files = append(files, page+".html")
+
+	tmpl, err := template.New(layout+".html").Funcs(Funcs).ParseFS(r.fs, files...)
+	if err != nil {
+		return nil, fmt.Errorf("view %q: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// errorRender surfaces template lookup failures through gin's error handling
+type errorRender struct {
+	err error
+}
+
+func (e errorRender) Render(w http.ResponseWriter) error {
+	return e.err
+}
+
+func (e errorRender) WriteContentType(w http.ResponseWriter) {}
@@ -0,0 +1,239 @@
+// Package analytics ships request events to a columnar store, like ClickHouse, so
+// traffic can be analysed without loading the main database. Requests are sampled
+// and buffered in memory, and a background loop writes them in batches. When the
+// store falls behind and the buffer fills up, events are dropped rather than
+// slowing requests down. Statistics by route, status code and consumer are served
+// to admins from the store, or from a ring of recent events kept in memory.
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"go-api/pkg/authz"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Sinks
+const (
+	SinkClickHouse = "clickhouse"
+)
+
+// Config holds the analytics pipeline configuration
+type Config struct {
+	Sink          string           `yaml:"sink"` // clickhouse, or empty to record nothing
+	ClickHouse    ClickHouseConfig `yaml:"clickhouse"`
+	SampleRatio   float64          `yaml:"sampleRatio"`   // Fraction of requests sent to the sink, from 0 to 1
+	BufferSize    int              `yaml:"bufferSize"`    // Events held while waiting to be written
+	BatchSize     int              `yaml:"batchSize"`     // Events per write
+	FlushInterval time.Duration    `yaml:"flushInterval"` // Longest an event waits in a partial batch
+	MaxRetries    int              `yaml:"maxRetries"`    // Of a failed write, before its batch is dropped
+	ExcludePaths  []string         `yaml:"excludePaths"`  // Path prefixes not recorded, like /health
+	RingSize      int              `yaml:"ringSize"`      // Recent events kept in memory for the admin statistics
+}
+
+// Event is one request as recorded for analytics
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"` // Pattern of the matched route, like /api/v1/users/:id
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	Bytes     int64     `json:"bytes"` // Of the response body
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	Subject   string    `json:"subject"` // Authenticated user, empty for anonymous requests
+	Tenant    string    `json:"tenant"`
+	Weight    float64   `json:"weight"` // Requests the event stands for, 1 / SampleRatio once sampled
+}
+
+// Sink writes batches of events to a store
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Pipeline buffers sampled events and writes them to a sink in batches
+type Pipeline struct {
+	cfg    Config
+	sink   Sink
+	events chan Event
+}
+
+// New creates the pipeline for cfg's sink. It returns nil when no sink is
+// configured, which records nothing.
+func New(cfg Config) (*Pipeline, error) {
+	var sink Sink
+	switch cfg.Sink {
+	case "":
+		return nil, nil
+	case SinkClickHouse:
+		ch, err := NewClickHouse(cfg.ClickHouse)
+		if err != nil {
+			return nil, err
+		}
+		sink = ch
+	default:
+		return nil, fmt.Errorf("unknown analytics sink %q", cfg.Sink)
+	}
+	return NewPipeline(cfg, sink), nil
+}
+
+// NewPipeline creates a pipeline writing to sink, for stores New doesn't know
+func NewPipeline(cfg Config, sink Sink) *Pipeline {
+	if cfg.SampleRatio <= 0 || cfg.SampleRatio > 1 {
+		cfg.SampleRatio = 1
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	return &Pipeline{cfg: cfg, sink: sink, events: make(chan Event, cfg.BufferSize)}
+}
+
+// Querier returns the sink when it can compute statistics, and nil otherwise
+func (p *Pipeline) Querier() Querier {
+	q, _ := p.sink.(Querier)
+	return q
+}
+
+// Recorder receives the event of every request
+type Recorder interface {
+	Record(e Event)
+}
+
+// Record queues a sample of the events, unless the buffer is full, in which case
+// they are dropped. It never blocks.
+func (p *Pipeline) Record(e Event) {
+	if p.cfg.SampleRatio < 1 && rand.Float64() >= p.cfg.SampleRatio {
+		return
+	}
+	e.Weight = 1 / p.cfg.SampleRatio
+	select {
+	case p.events <- e:
+	default:
+		eventsTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Middleware hands the event of every request passing through it to the
+// recorders, except for paths under one of the exclude prefixes
+func Middleware(exclude []string, recorders ...Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if excluded(c.Request.URL.Path, exclude) || apperrors.ClientDisconnected(c.Request.Context()) {
+			return
+		}
+		e := Event{
+			Time:      start.UTC(),
+			RequestID: c.GetString("requestId"),
+			Method:    c.Request.Method,
+			Route:     c.FullPath(),
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			Bytes:     int64(max(c.Writer.Size(), 0)),
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Weight:    1,
+		}
+		if sub, ok := authz.SubjectFromContext(c.Request.Context()); ok {
+			e.Subject, e.Tenant = sub.ID, sub.Tenant
+		}
+		for _, r := range recorders {
+			r.Record(e)
+		}
+	}
+}
+
+func excluded(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run writes batches until ctx is cancelled, then writes what is still buffered
+// and closes the sink
+func (p *Pipeline) Run(ctx context.Context) {
+	defer p.sink.Close()
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, p.cfg.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			for {
+				select {
+				case e := <-p.events:
+					if batch = append(batch, e); len(batch) == p.cfg.BatchSize {
+						batch = p.write(flushCtx, batch)
+					}
+				default:
+					p.write(flushCtx, batch)
+					return
+				}
+			}
+		case e := <-p.events:
+			if batch = append(batch, e); len(batch) == p.cfg.BatchSize {
+				batch = p.write(ctx, batch)
+			}
+		case <-ticker.C:
+			batch = p.write(ctx, batch)
+		}
+	}
+}
+
+// write sends a batch, retrying failures with backoff, and returns the emptied
+// batch for reuse. Events keep queuing meanwhile, up to the buffer size.
+func (p *Pipeline) write(ctx context.Context, batch []Event) []Event {
+	if len(batch) == 0 {
+		return batch
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := p.sink.Write(ctx, batch)
+		if err == nil {
+			eventsTotal.WithLabelValues("written").Add(float64(len(batch)))
+			return batch[:0]
+		}
+		if ctx.Err() != nil {
+			// Shutting down: Run writes the batch once more before returning
+			return batch
+		}
+		if attempt >= p.cfg.MaxRetries {
+			logger.Warn("failed to write analytics events", zap.Int("events", len(batch)), zap.Error(err))
+			eventsTotal.WithLabelValues("failed").Add(float64(len(batch)))
+			return batch[:0]
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
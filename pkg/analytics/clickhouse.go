@@ -0,0 +1,273 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClickHouseConfig holds the ClickHouse HTTP interface connection
+type ClickHouseConfig struct {
+	URL       string        `yaml:"url"` // Of the HTTP interface, like http://localhost:8123
+	Database  string        `yaml:"database"`
+	Table     string        `yaml:"table"`
+	Username  string        `yaml:"username"`
+	Password  string        `yaml:"password"`
+	Retention time.Duration `yaml:"retention"` // TTL of the events table; zero keeps events forever
+	Timeout   time.Duration `yaml:"timeout"`   // Of one request
+}
+
+// identifier is what database and table names may look like, as they're
+// interpolated into statements
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ClickHouse writes events over the HTTP interface in the JSONEachRow format,
+// creating the events table when missing
+type ClickHouse struct {
+	cfg    ClickHouseConfig
+	table  string
+	client *http.Client
+}
+
+// NewClickHouse creates the sink and its table
+func NewClickHouse(cfg ClickHouseConfig) (*ClickHouse, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("clickhouse: no URL configured")
+	}
+	if cfg.Database == "" {
+		cfg.Database = "default"
+	}
+	if cfg.Table == "" {
+		cfg.Table = "request_events"
+	}
+	if !identifier.MatchString(cfg.Database) || !identifier.MatchString(cfg.Table) {
+		return nil, fmt.Errorf("clickhouse: invalid table %s.%s", cfg.Database, cfg.Table)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	ch := &ClickHouse{cfg: cfg, table: cfg.Database + "." + cfg.Table, client: &http.Client{Timeout: cfg.Timeout}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	if err := ch.exec(ctx, ch.createTable(), nil); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// createTable orders rows by route then time, which suits per-route queries over a
+// period, and partitions them by month so old data is dropped a partition at a time
+func (ch *ClickHouse) createTable() string {
+	stmt := `CREATE TABLE IF NOT EXISTS ` + ch.table + ` (
+		time       DateTime64(3, 'UTC'),
+		request_id String,
+		method     LowCardinality(String),
+		route      LowCardinality(String),
+		path       String,
+		status     UInt16,
+		latency_ms Float64,
+		bytes      UInt64,
+		client_ip  String,
+		user_agent String,
+		subject    String,
+		tenant     LowCardinality(String),
+		weight     Float64
+	) ENGINE = MergeTree
+	PARTITION BY toYYYYMM(time)
+	ORDER BY (route, time)`
+	if ch.cfg.Retention > 0 {
+		stmt += fmt.Sprintf("\n\tTTL toDateTime(time) + INTERVAL %d SECOND", int64(ch.cfg.Retention.Seconds()))
+	}
+	return stmt
+}
+
+func (ch *ClickHouse) Write(ctx context.Context, events []Event) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return ch.exec(ctx, "INSERT INTO "+ch.table+" FORMAT JSONEachRow", &body)
+}
+
+func (ch *ClickHouse) Close() error {
+	ch.client.CloseIdleConnections()
+	return nil
+}
+
+// exec runs a statement, passed in the query string so body can carry the data
+func (ch *ClickHouse) exec(ctx context.Context, query string, body io.Reader) error {
+	resp, err := ch.do(ctx, url.Values{"query": {query}}, body)
+	if err != nil {
+		return err
+	}
+	return resp.Close()
+}
+
+// selectRows runs a SELECT with q's window and limit bound to the since, until and
+// limit parameters, decoding the rows into dest
+func (ch *ClickHouse) selectRows(ctx context.Context, query string, q Query, dest any) error {
+	params := url.Values{
+		"param_since": {q.Since.UTC().Format(clickHouseTime)},
+		"param_until": {q.Until.UTC().Format(clickHouseTime)},
+		"param_limit": {strconv.Itoa(q.Limit)},
+		"output_format_json_quote_64bit_integers": {"0"},
+	}
+	resp, err := ch.do(ctx, params, strings.NewReader(query+" FORMAT JSON"))
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	var result struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp).Decode(&result); err != nil {
+		return fmt.Errorf("clickhouse: decoding result: %w", err)
+	}
+	return json.Unmarshal(result.Data, dest)
+}
+
+// clickHouseTime is how DateTime64(3) query parameters are written
+const clickHouseTime = "2006-01-02 15:04:05.000"
+
+func (ch *ClickHouse) do(ctx context.Context, params url.Values, body io.Reader) (io.ReadCloser, error) {
+	// Times are sent as RFC 3339
+	params.Set("date_time_input_format", "best_effort")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(ch.cfg.URL, "/")+"/?"+params.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if ch.cfg.Username != "" {
+		req.Header.Set("X-ClickHouse-User", ch.cfg.Username)
+		req.Header.Set("X-ClickHouse-Key", ch.cfg.Password)
+	}
+	resp, err := ch.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("clickhouse returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
+
+// window is the condition selecting the events of a query
+const window = `time >= {since:DateTime64(3)} AND time < {until:DateTime64(3)}`
+
+func (ch *ClickHouse) Overview(ctx context.Context, q Query) (Overview, error) {
+	var totals []struct {
+		Requests int64     `json:"requests"`
+		Errors   int64     `json:"errors"`
+		Latency  []float64 `json:"latency"`
+	}
+	if err := ch.selectRows(ctx, `
+		SELECT toInt64(round(sum(weight))) AS requests,
+			toInt64(round(sumIf(weight, status >= 500))) AS errors,
+			quantiles(0.5, 0.95, 0.99)(latency_ms) AS latency
+		FROM `+ch.table+` WHERE `+window, q, &totals); err != nil {
+		return Overview{}, err
+	}
+	var statuses []struct {
+		Status   int   `json:"status"`
+		Requests int64 `json:"requests"`
+	}
+	if err := ch.selectRows(ctx, `
+		SELECT status, toInt64(round(sum(weight))) AS requests
+		FROM `+ch.table+` WHERE `+window+` GROUP BY status`, q, &statuses); err != nil {
+		return Overview{}, err
+	}
+
+	o := Overview{Since: q.Since, Until: q.Until, Statuses: make(map[string]int64, len(statuses))}
+	if len(totals) > 0 {
+		o.Requests, o.Errors, o.Latency = totals[0].Requests, totals[0].Errors, latencyOf(totals[0].Latency)
+		o.ErrorRate = rate(o.Errors, o.Requests)
+	}
+	for _, s := range statuses {
+		o.Statuses[strconv.Itoa(s.Status)] = s.Requests
+	}
+	return o, nil
+}
+
+// routeOrder maps route orderings to the ORDER BY expression of Routes
+var routeOrder = map[string]string{
+	SortRequests: "requests DESC",
+	SortErrors:   "errors DESC, requests DESC",
+	SortLatency:  "latency[2] DESC, requests DESC",
+}
+
+func (ch *ClickHouse) Routes(ctx context.Context, q Query, sortBy string) ([]RouteStats, error) {
+	order, ok := routeOrder[sortBy]
+	if !ok {
+		order = routeOrder[SortRequests]
+	}
+	var rows []struct {
+		Method   string    `json:"method"`
+		Route    string    `json:"route_name"`
+		Requests int64     `json:"requests"`
+		Errors   int64     `json:"errors"`
+		Latency  []float64 `json:"latency"`
+	}
+	if err := ch.selectRows(ctx, `
+		SELECT method, if(route = '', '(unmatched)', route) AS route_name,
+			toInt64(round(sum(weight))) AS requests,
+			toInt64(round(sumIf(weight, status >= 500))) AS errors,
+			quantiles(0.5, 0.95, 0.99)(latency_ms) AS latency
+		FROM `+ch.table+` WHERE `+window+`
+		GROUP BY method, route_name
+		ORDER BY `+order+` LIMIT {limit:UInt32}`, q, &rows); err != nil {
+		return nil, err
+	}
+	routes := make([]RouteStats, 0, len(rows))
+	for _, r := range rows {
+		routes = append(routes, RouteStats{Method: r.Method, Route: r.Route, Requests: r.Requests, Errors: r.Errors,
+			ErrorRate: rate(r.Errors, r.Requests), Latency: latencyOf(r.Latency)})
+	}
+	return routes, nil
+}
+
+func (ch *ClickHouse) Consumers(ctx context.Context, q Query) ([]ConsumerStats, error) {
+	var consumers []ConsumerStats
+	if err := ch.selectRows(ctx, `
+		SELECT subject, tenant,
+			toInt64(round(sum(weight))) AS requests,
+			toInt64(round(sumIf(weight, status >= 500))) AS errors
+		FROM `+ch.table+` WHERE `+window+` AND subject != ''
+		GROUP BY subject, tenant
+		ORDER BY requests DESC, subject LIMIT {limit:UInt32}`, q, &consumers); err != nil {
+		return nil, err
+	}
+	for i := range consumers {
+		consumers[i].ErrorRate = rate(consumers[i].Errors, consumers[i].Requests)
+	}
+	if consumers == nil {
+		consumers = []ConsumerStats{}
+	}
+	return consumers, nil
+}
+
+func latencyOf(quantiles []float64) Latency {
+	if len(quantiles) != 3 {
+		return Latency{}
+	}
+	return Latency{P50: quantiles[0], P95: quantiles[1], P99: quantiles[2]}
+}
+
+func rate(errors, requests int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(errors) / float64(requests)
+}
@@ -0,0 +1,132 @@
+package analytics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sources of the statistics
+const (
+	SourceMemory = "memory" // The ring of recent events
+	SourceSink   = "sink"   // The analytics sink, when it can be queried
+)
+
+// Handler exposes traffic statistics to admins
+type Handler struct {
+	memory *Ring
+	sink   Querier
+}
+
+// NewHandler creates an analytics handler. Either may be nil; statistics come from
+// the sink when there is one, as it reaches further back, unless ?source=memory.
+func NewHandler(memory *Ring, sink Querier) *Handler {
+	return &Handler{memory: memory, sink: sink}
+}
+
+// RegisterRoutes mounts the analytics endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/analytics", routing.Query("window", "source"), h.overview)
+	rg.GET("/analytics/routes", routing.Query("window", "source", "limit", "sort"), h.routes)
+	rg.GET("/analytics/consumers", routing.Query("window", "source", "limit"), h.consumers)
+}
+
+// overview returns the traffic, status codes and latency of the last ?window=
+// (default 1h)
+func (h *Handler) overview(c *gin.Context) {
+	querier, q, err := h.query(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	o, err := querier.Overview(c.Request.Context(), q)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// routes returns the busiest routes, or those with the most server errors or the
+// slowest p95 with ?sort=errors or ?sort=latency
+func (h *Handler) routes(c *gin.Context) {
+	querier, q, err := h.query(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	sortBy := c.DefaultQuery("sort", SortRequests)
+	if sortBy != SortRequests && sortBy != SortErrors && sortBy != SortLatency {
+		c.Error(apperrors.NewValidationError("Invalid sort", apperrors.FieldError{
+			Field: "sort", Rule: "oneof", Param: "requests errors latency", Message: "sort must be requests, errors or latency",
+		}))
+		return
+	}
+	routes, err := querier.Routes(c.Request.Context(), q, sortBy)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": routes, "since": q.Since, "until": q.Until})
+}
+
+// consumers returns the authenticated users making the most requests
+func (h *Handler) consumers(c *gin.Context) {
+	querier, q, err := h.query(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	consumers, err := querier.Consumers(c.Request.Context(), q)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": consumers, "since": q.Since, "until": q.Until})
+}
+
+// query reads the source, window and limit parameters shared by the endpoints
+func (h *Handler) query(c *gin.Context) (Querier, Query, error) {
+	var fields []apperrors.FieldError
+
+	var querier Querier
+	switch source := c.Query("source"); {
+	case source == "" && h.sink != nil, source == SourceSink && h.sink != nil:
+		querier = h.sink
+	case source == "" && h.memory != nil, source == SourceMemory && h.memory != nil:
+		querier = h.memory
+	default:
+		fields = append(fields, apperrors.FieldError{Field: "source", Rule: "oneof", Param: h.sources(),
+			Message: "source must be one of the enabled sources: " + h.sources()})
+	}
+
+	window, err := time.ParseDuration(c.DefaultQuery("window", "1h"))
+	if err != nil || window <= 0 {
+		fields = append(fields, apperrors.FieldError{Field: "window", Rule: "duration", Message: "window must be a positive duration, like 15m or 24h"})
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		fields = append(fields, apperrors.FieldError{Field: "limit", Rule: "max", Param: "100", Message: "limit must be between 1 and 100"})
+	}
+	if len(fields) > 0 {
+		return nil, Query{}, apperrors.NewValidationError("Invalid analytics query", fields...)
+	}
+
+	until := time.Now().UTC()
+	return querier, Query{Since: until.Add(-window), Until: until, Limit: limit}, nil
+}
+
+func (h *Handler) sources() string {
+	switch {
+	case h.memory != nil && h.sink != nil:
+		return SourceMemory + " " + SourceSink
+	case h.sink != nil:
+		return SourceSink
+	}
+	return SourceMemory
+}
@@ -0,0 +1,11 @@
+package analytics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var eventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "analytics_events_total",
+	Help: "Sampled request events by outcome: written, dropped from a full buffer, or failed to write.",
+}, []string{"outcome"})
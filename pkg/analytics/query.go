@@ -0,0 +1,134 @@
+package analytics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// Query selects the events of a window, and how many groups to return
+type Query struct {
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// Route orderings
+const (
+	SortRequests = "requests"
+	SortErrors   = "errors"
+	SortLatency  = "latency" // By p95
+)
+
+// Querier computes traffic statistics over a window of events
+type Querier interface {
+	Overview(ctx context.Context, q Query) (Overview, error)
+	Routes(ctx context.Context, q Query, sortBy string) ([]RouteStats, error)
+	Consumers(ctx context.Context, q Query) ([]ConsumerStats, error)
+}
+
+// Latency holds latency percentiles in milliseconds
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// Overview summarises all traffic of a window. Counts are weighted by sampling,
+// so they estimate the requests served rather than the events kept.
+type Overview struct {
+	Since     time.Time        `json:"since"`
+	Until     time.Time        `json:"until"`
+	Oldest    *time.Time       `json:"oldest,omitempty"` // Of the events found; later than since when the buffer doesn't reach back that far
+	Requests  int64            `json:"requests"`
+	Errors    int64            `json:"errors"` // Server errors
+	ErrorRate float64          `json:"errorRate"`
+	Statuses  map[string]int64 `json:"statuses"` // Requests by status code
+	Latency   Latency          `json:"latency"`
+}
+
+// RouteStats is the traffic of one route
+type RouteStats struct {
+	Method    string  `json:"method"`
+	Route     string  `json:"route"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"errorRate"`
+	Latency   Latency `json:"latency"`
+}
+
+// ConsumerStats is the traffic of one authenticated user
+type ConsumerStats struct {
+	Subject   string  `json:"subject"`
+	Tenant    string  `json:"tenant,omitempty"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"errorRate"`
+}
+
+// weight is how many requests e stands for, 1 when recorded unsampled
+func (e Event) weight() float64 {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// totals accumulates the weighted counts and latencies of a group of events
+type totals struct {
+	requests, errors float64
+	latencies        []float64
+}
+
+func (t *totals) add(e Event) {
+	w := e.weight()
+	t.requests += w
+	if e.Status >= 500 {
+		t.errors += w
+	}
+	t.latencies = append(t.latencies, e.LatencyMS)
+}
+
+func (t *totals) counts() (requests, errors int64, rate float64) {
+	if t.requests > 0 {
+		rate = t.errors / t.requests
+	}
+	return int64(math.Round(t.requests)), int64(math.Round(t.errors)), rate
+}
+
+func (t *totals) latency() Latency {
+	sort.Float64s(t.latencies)
+	return Latency{P50: percentile(t.latencies, 0.5), P95: percentile(t.latencies, 0.95), P99: percentile(t.latencies, 0.99)}
+}
+
+// percentile is the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// sortRoutes orders routes by sortBy, falling back to requests, and keeps limit
+func sortRoutes(routes []RouteStats, sortBy string, limit int) []RouteStats {
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		switch sortBy {
+		case SortErrors:
+			if a.Errors != b.Errors {
+				return a.Errors > b.Errors
+			}
+		case SortLatency:
+			if a.Latency.P95 != b.Latency.P95 {
+				return a.Latency.P95 > b.Latency.P95
+			}
+		}
+		return a.Requests > b.Requests
+	})
+	if limit > 0 && len(routes) > limit {
+		routes = routes[:limit]
+	}
+	return routes
+}
@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Ring keeps the most recent events in memory, so statistics are available without
+// a sink. It sees every request, unsampled; windows reach back only as far as its
+// size allows.
+type Ring struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewRing creates a ring keeping size events
+func NewRing(size int) *Ring {
+	if size < 1 {
+		size = 1
+	}
+	return &Ring{events: make([]Event, size)}
+}
+
+func (r *Ring) Record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// window returns the events of q, oldest first
+func (r *Ring) window(q Query) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	start, n := 0, r.next
+	if r.full {
+		start, n = r.next, len(r.events)
+	}
+	var out []Event
+	for i := 0; i < n; i++ {
+		e := r.events[(start+i)%len(r.events)]
+		if !e.Time.Before(q.Since) && e.Time.Before(q.Until) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (r *Ring) Overview(ctx context.Context, q Query) (Overview, error) {
+	events := r.window(q)
+	o := Overview{Since: q.Since, Until: q.Until, Statuses: make(map[string]int64)}
+	var all totals
+	statuses := make(map[int]float64)
+	for _, e := range events {
+		all.add(e)
+		statuses[e.Status] += e.weight()
+	}
+	if len(events) > 0 {
+		o.Oldest = &events[0].Time
+	}
+	o.Requests, o.Errors, o.ErrorRate = all.counts()
+	o.Latency = all.latency()
+	for status, n := range statuses {
+		o.Statuses[strconv.Itoa(status)] = int64(math.Round(n))
+	}
+	return o, nil
+}
+
+func (r *Ring) Routes(ctx context.Context, q Query, sortBy string) ([]RouteStats, error) {
+	type key struct{ method, route string }
+	groups := make(map[key]*totals)
+	for _, e := range r.window(q) {
+		k := key{e.Method, e.Route}
+		if k.route == "" {
+			// No route matched, like for 404s; grouped so unknown paths can't flood the list
+			k.route = "(unmatched)"
+		}
+		if groups[k] == nil {
+			groups[k] = &totals{}
+		}
+		groups[k].add(e)
+	}
+	routes := make([]RouteStats, 0, len(groups))
+	for k, t := range groups {
+		s := RouteStats{Method: k.method, Route: k.route, Latency: t.latency()}
+		s.Requests, s.Errors, s.ErrorRate = t.counts()
+		routes = append(routes, s)
+	}
+	return sortRoutes(routes, sortBy, q.Limit), nil
+}
+
+func (r *Ring) Consumers(ctx context.Context, q Query) ([]ConsumerStats, error) {
+	type key struct{ subject, tenant string }
+	groups := make(map[key]*totals)
+	for _, e := range r.window(q) {
+		if e.Subject == "" {
+			continue
+		}
+		k := key{e.Subject, e.Tenant}
+		if groups[k] == nil {
+			groups[k] = &totals{}
+		}
+		groups[k].add(e)
+	}
+	consumers := make([]ConsumerStats, 0, len(groups))
+	for k, t := range groups {
+		s := ConsumerStats{Subject: k.subject, Tenant: k.tenant}
+		s.Requests, s.Errors, s.ErrorRate = t.counts()
+		consumers = append(consumers, s)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		if consumers[i].Requests != consumers[j].Requests {
+			return consumers[i].Requests > consumers[j].Requests
+		}
+		return consumers[i].Subject < consumers[j].Subject
+	})
+	if q.Limit > 0 && len(consumers) > q.Limit {
+		consumers = consumers[:q.Limit]
+	}
+	return consumers, nil
+}
@@ -0,0 +1,458 @@
+// Package archive moves rows past a policy's age out of the database into object
+// storage, keeping hot tables small while the records stay retrievable. Each
+// batch of rows becomes one gzipped CSV file, which warehouses load as readily as
+// Parquet, and a manifest row in archive_files. Writing the manifest and deleting
+// the rows share a transaction, so a row is never gone from the table without a
+// file listing it; a failed commit at worst leaves an unlisted file behind.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/database"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+	"go-api/pkg/storage"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Policy declares which rows of a table are archived
+type Policy struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Table       string `json:"table"`
+	KeyColumn   string `json:"keyColumn,omitempty"` // Defaults to id
+	TimeColumn  string `json:"timeColumn"`
+	Where       string `json:"where,omitempty"` // Extra condition, such as "status = 'completed'"
+	// Age past which rows are archived. Policies from the configuration get theirs
+	// from Config.MaxAges.
+	MaxAge time.Duration `json:"-"`
+}
+
+// Declarer is implemented by stores that archive the data they own
+type Declarer interface {
+	ArchivePolicies() []Policy
+}
+
+// Config holds archival configuration
+type Config struct {
+	Enabled   bool                     `yaml:"enabled"`
+	Interval  time.Duration            `yaml:"interval"`
+	BatchSize int                      `yaml:"batchSize"` // Rows per file
+	Prefix    string                   `yaml:"prefix"`    // Of the files in storage
+	Policies  []Policy                 `yaml:"policies"`  // For tables of no module
+	MaxAges   map[string]time.Duration `yaml:"maxAges"`   // Overrides of policy max ages by name
+}
+
+// Run is the outcome of archiving one policy
+type Run struct {
+	Policy     string    `json:"policy"`
+	Cutoff     time.Time `json:"cutoff"`
+	Archived   int64     `json:"archived"`
+	Files      int       `json:"files"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// PolicyStatus describes a registered policy and its last run
+type PolicyStatus struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Table       string        `json:"table"`
+	MaxAge      time.Duration `json:"maxAge"`
+	LastRun     *Run          `json:"lastRun,omitempty"`
+}
+
+// File is an archive file listed in the manifest
+type File struct {
+	Key       string    `json:"key"`
+	Policy    string    `json:"policy"`
+	Rows      int64     `json:"rows"`
+	Oldest    time.Time `json:"oldest"` // Time column of the oldest row in the file
+	Newest    time.Time `json:"newest"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// validName is what table and column names look like, as they are interpolated
+// into statements
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+var errPolicyNotFound = apperrors.NewNotFoundError("Archive policy not found")
+
+// Archiver runs registered policies on a schedule
+type Archiver struct {
+	cfg   Config
+	db    *sql.DB
+	files storage.Storage
+
+	mu       sync.Mutex
+	policies map[string]Policy
+	lastRun  map[string]Run
+	running  map[string]bool
+}
+
+// NewArchiver creates an archiver of the tables of db into files, registering the
+// policies of the configuration
+func NewArchiver(cfg Config, db *sql.DB, files storage.Storage) (*Archiver, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10000
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "archive/"
+	}
+	a := &Archiver{
+		cfg:      cfg,
+		db:       db,
+		files:    files,
+		policies: make(map[string]Policy),
+		lastRun:  make(map[string]Run),
+		running:  make(map[string]bool),
+	}
+	for _, p := range cfg.Policies {
+		if err := a.Register(p); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// EnsureSchema creates the manifest of archive files
+func (a *Archiver) EnsureSchema(ctx context.Context) error {
+	_, err := a.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS archive_files (
+			object     TEXT PRIMARY KEY,
+			policy     TEXT NOT NULL,
+			row_count  INTEGER NOT NULL,
+			oldest     TIMESTAMP NOT NULL,
+			newest     TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return err
+	}
+	_, err = a.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS archive_files_policy_newest ON archive_files (policy, newest)`)
+	return err
+}
+
+// Register adds a policy, applying any configured max age override
+func (a *Archiver) Register(p Policy) error {
+	if age, ok := a.cfg.MaxAges[p.Name]; ok {
+		p.MaxAge = age
+	}
+	if p.KeyColumn == "" {
+		p.KeyColumn = "id"
+	}
+	if p.Name == "" || strings.Contains(p.Name, "/") {
+		return fmt.Errorf("archive policy %q: invalid name", p.Name)
+	}
+	for _, name := range []string{p.Table, p.KeyColumn, p.TimeColumn} {
+		if !validName.MatchString(name) {
+			return fmt.Errorf("archive policy %s: invalid table or column name %q", p.Name, name)
+		}
+	}
+	if p.MaxAge <= 0 {
+		return fmt.Errorf("archive policy %s: no max age", p.Name)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.policies[p.Name]; ok {
+		return fmt.Errorf("archive policy %s registered twice", p.Name)
+	}
+	a.policies[p.Name] = p
+	return nil
+}
+
+// RegisterFrom registers the policies of every value that implements Declarer
+func (a *Archiver) RegisterFrom(values ...any) error {
+	for _, v := range values {
+		if d, ok := v.(Declarer); ok {
+			for _, p := range d.ArchivePolicies() {
+				if err := a.Register(p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Start archives every policy each interval until ctx is cancelled, unless disabled
+func (a *Archiver) Start(ctx context.Context) {
+	if !a.cfg.Enabled {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(a.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			a.RunAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunAll archives every policy in name order
+func (a *Archiver) RunAll(ctx context.Context) []Run {
+	a.mu.Lock()
+	names := make([]string, 0, len(a.policies))
+	for name := range a.policies {
+		names = append(names, name)
+	}
+	a.mu.Unlock()
+	sort.Strings(names)
+
+	runs := make([]Run, 0, len(names))
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		run, _ := a.Run(ctx, name)
+		if run.Policy == "" {
+			continue // Already running from an admin request
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Run archives the rows of one policy past its max age, a file per batch
+func (a *Archiver) Run(ctx context.Context, name string) (Run, error) {
+	a.mu.Lock()
+	policy, ok := a.policies[name]
+	if !ok {
+		a.mu.Unlock()
+		return Run{}, errPolicyNotFound
+	}
+	if a.running[name] {
+		a.mu.Unlock()
+		return Run{}, apperrors.NewConflictError("Archive policy is already running")
+	}
+	a.running[name] = true
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.running, name)
+		a.mu.Unlock()
+	}()
+
+	run := Run{Policy: name, Cutoff: time.Now().UTC().Add(-policy.MaxAge), StartedAt: time.Now().UTC()}
+	var err error
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int64
+		if n, err = a.archiveBatch(ctx, policy, run.Cutoff); err != nil {
+			err = fmt.Errorf("file %d: %w", run.Files+1, err)
+			break
+		}
+		if n == 0 {
+			break
+		}
+		run.Files++
+		run.Archived += n
+		rowsArchived.WithLabelValues(name).Add(float64(n))
+		if n < int64(a.cfg.BatchSize) {
+			break
+		}
+	}
+	run.FinishedAt = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+		logger.Error("archival failed", zap.String("policy", name), zap.Int64("archived", run.Archived), zap.Error(err))
+	} else {
+		logger.Info("archival finished",
+			zap.String("policy", name),
+			zap.Int64("archived", run.Archived),
+			zap.Int("files", run.Files),
+			zap.Duration("took", run.FinishedAt.Sub(run.StartedAt)))
+	}
+
+	a.mu.Lock()
+	a.lastRun[name] = run
+	a.mu.Unlock()
+	return run, err
+}
+
+// archiveBatch writes the oldest rows past cutoff to a file and deletes them,
+// returning how many it archived. On Postgres the rows are locked, skipping those
+// another instance is archiving; SQLite's write lock serializes batches anyway.
+func (a *Archiver) archiveBatch(ctx context.Context, p Policy, cutoff time.Time) (int64, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cond := p.TimeColumn + " < $1"
+	if p.Where != "" {
+		cond += " AND (" + p.Where + ")"
+	}
+	query := fmt.Sprintf(`SELECT * FROM %s WHERE %s ORDER BY %s LIMIT $2`, p.Table, cond, p.TimeColumn)
+	if database.Dialect(a.db) == database.Postgres {
+		query += ` FOR UPDATE SKIP LOCKED`
+	}
+	rows, err := tx.QueryContext(ctx, query, cutoff, a.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	buf, keys, oldest, newest, err := writeCSV(rows, p)
+	rows.Close()
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%s/%s-%s.csv.gz", a.cfg.Prefix, p.Name, now.Format("2006/01/02"),
+		now.Format("20060102T150405Z"), uuid.New().String()[:8])
+	if _, err := a.files.Put(ctx, key, buf, "application/gzip"); err != nil {
+		return 0, fmt.Errorf("storing %s: %w", key, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			a.files.Delete(context.WithoutCancel(ctx), key)
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO archive_files (object, policy, row_count, oldest, newest, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, key, p.Name, len(keys), oldest, newest, now); err != nil {
+		return 0, err
+	}
+	placeholders := make([]string, len(keys))
+	args := make([]any, len(keys))
+	for i, k := range keys {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = k
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s IN (%s)`,
+		p.Table, p.KeyColumn, strings.Join(placeholders, ", ")), args...); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	committed = true
+	return int64(len(keys)), nil
+}
+
+// null stands for NULL in archive files, as in Postgres' text format
+const null = `\N`
+
+// writeCSV writes rows as gzipped CSV with a header, returning the keys of the
+// rows and the range of their time column
+func writeCSV(rows *sql.Rows, p Policy) (*bytes.Buffer, []string, time.Time, time.Time, error) {
+	var oldest, newest time.Time
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, oldest, newest, err
+	}
+	keyIndex, timeIndex := indexOf(columns, p.KeyColumn), indexOf(columns, p.TimeColumn)
+	if keyIndex < 0 || timeIndex < 0 {
+		return nil, nil, oldest, newest, fmt.Errorf("table %s has no column %s or %s", p.Table, p.KeyColumn, p.TimeColumn)
+	}
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	w := csv.NewWriter(gz)
+	w.Write(columns)
+	var keys []string
+	values := make([]sql.NullString, len(columns))
+	var at time.Time
+	dest := make([]any, len(columns))
+	for i := range dest {
+		dest[i] = &values[i]
+	}
+	dest[timeIndex] = &at
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, oldest, newest, err
+		}
+		for i, v := range values {
+			record[i] = null
+			if v.Valid {
+				record[i] = v.String
+			}
+		}
+		at = at.UTC()
+		record[timeIndex] = at.Format(time.RFC3339Nano)
+		if err := w.Write(record); err != nil {
+			return nil, nil, oldest, newest, err
+		}
+		if len(keys) == 0 {
+			oldest = at
+		}
+		newest = at
+		keys = append(keys, values[keyIndex].String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, oldest, newest, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, nil, oldest, newest, err
+	}
+	return buf, keys, oldest, newest, gz.Close()
+}
+
+func indexOf(columns []string, name string) int {
+	for i, c := range columns {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Policies returns the registered policies and their last runs
+func (a *Archiver) Policies() []PolicyStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	list := make([]PolicyStatus, 0, len(a.policies))
+	for name, p := range a.policies {
+		status := PolicyStatus{Name: name, Description: p.Description, Table: p.Table, MaxAge: p.MaxAge}
+		if run, ok := a.lastRun[name]; ok {
+			status.LastRun = &run
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (a *Archiver) policy(name string) (Policy, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.policies[name]
+	if !ok {
+		return Policy{}, errPolicyNotFound
+	}
+	return p, nil
+}
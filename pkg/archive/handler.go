@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for running archive policies and reading
+// archived records back
+type Handler struct {
+	archiver *Archiver
+}
+
+// NewHandler creates an archive handler
+func NewHandler(archiver *Archiver) *Handler {
+	return &Handler{archiver: archiver}
+}
+
+// RegisterRoutes mounts the archive endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/archives", h.list)
+	rg.POST("/archives/:name/run", h.run)
+	rg.GET("/archives/:name/files", h.files)
+	rg.GET("/archives/:name/records", routing.Query("key", "from", "to", "limit"), h.records)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.archiver.Policies()})
+}
+
+// run archives one policy synchronously
+func (h *Handler) run(c *gin.Context) {
+	run, err := h.archiver.Run(c.Request.Context(), c.Param("name"))
+	if err != nil && run.Policy == "" {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+func (h *Handler) files(c *gin.Context) {
+	files, err := h.archiver.Files(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": files})
+}
+
+// records reads archived records, by ?key= and within ?from= and ?to=
+func (h *Handler) records(c *gin.Context) {
+	query := struct {
+		Key   string    `form:"key"`
+		From  time.Time `form:"from"`
+		To    time.Time `form:"to"`
+		Limit int       `form:"limit" binding:"min=1,max=1000"`
+	}{Limit: 100}
+	if err := bind.Query(c, &query); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid query", err))
+		return
+	}
+	records, err := h.archiver.Records(c.Request.Context(), c.Param("name"),
+		Query{Key: query.Key, From: query.From, To: query.To, Limit: query.Limit})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": records})
+}
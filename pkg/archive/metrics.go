@@ -0,0 +1,18 @@
+package archive
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rowsArchived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "archive_rows_archived_total",
+		Help: "Rows moved to archive files in object storage.",
+	}, []string{"policy"})
+
+	archiveLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "archive_lookups_total",
+		Help: "Reads of archived records.",
+	}, []string{"policy"})
+)
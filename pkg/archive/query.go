@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Query filters the archived records of a policy
+type Query struct {
+	Key   string    // Of one record; any when empty
+	From  time.Time // Time column at or after; any when zero
+	To    time.Time // Time column before; any when zero
+	Limit int
+}
+
+// Record is an archived row by column. Values are text, like the database
+// encodes them, with nil for NULLs.
+type Record map[string]*string
+
+// Files lists the archive files of a policy, newest rows first
+func (a *Archiver) Files(ctx context.Context, name string) ([]File, error) {
+	if _, err := a.policy(name); err != nil {
+		return nil, err
+	}
+	return a.manifest(ctx, name, time.Time{}, time.Time{})
+}
+
+func (a *Archiver) manifest(ctx context.Context, name string, from, to time.Time) ([]File, error) {
+	query := `SELECT object, policy, row_count, oldest, newest, created_at FROM archive_files WHERE policy = $1`
+	args := []any{name}
+	if !from.IsZero() {
+		args = append(args, from.UTC())
+		query += fmt.Sprintf(` AND newest >= $%d`, len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to.UTC())
+		query += fmt.Sprintf(` AND oldest < $%d`, len(args))
+	}
+	rows, err := a.db.QueryContext(ctx, query+` ORDER BY newest DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var f File
+		if err := rows.Scan(&f.Key, &f.Policy, &f.Rows, &f.Oldest, &f.Newest, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// Records reads the archived records of a policy matching q, newest files first.
+// Only files whose time range overlaps q are opened, so a lookup by key alone reads
+// every file of the policy; narrow it with a time range where possible.
+func (a *Archiver) Records(ctx context.Context, name string, q Query) ([]Record, error) {
+	p, err := a.policy(name)
+	if err != nil {
+		return nil, err
+	}
+	files, err := a.manifest(ctx, name, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		found, err := a.read(ctx, p, f, q, q.Limit-len(records))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Key, err)
+		}
+		records = append(records, found...)
+		if len(records) >= q.Limit {
+			break
+		}
+	}
+	archiveLookups.WithLabelValues(name).Inc()
+	return records, nil
+}
+
+// read returns up to limit records of a file matching q
+func (a *Archiver) read(ctx context.Context, p Policy, f File, q Query, limit int) ([]Record, error) {
+	r, _, err := a.files.Open(ctx, f.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(gz)
+	columns, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	keyIndex, timeIndex := indexOf(columns, p.KeyColumn), indexOf(columns, p.TimeColumn)
+	if keyIndex < 0 || timeIndex < 0 {
+		return nil, fmt.Errorf("no column %s or %s", p.KeyColumn, p.TimeColumn)
+	}
+
+	var records []Record
+	for len(records) < limit {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if q.Key != "" && row[keyIndex] != q.Key {
+			continue
+		}
+		if !q.From.IsZero() || !q.To.IsZero() {
+			at, err := time.Parse(time.RFC3339Nano, row[timeIndex])
+			if err != nil {
+				return nil, err
+			}
+			if (!q.From.IsZero() && at.Before(q.From)) || (!q.To.IsZero() && !at.Before(q.To)) {
+				continue
+			}
+		}
+		record := make(Record, len(columns))
+		for i, c := range columns {
+			if row[i] != null {
+				v := row[i]
+				record[c] = &v
+			} else {
+				record[c] = nil
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
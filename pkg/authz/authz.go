@@ -0,0 +1,185 @@
+package authz
+
+import (
+	"context"
+	_ "embed"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+	"go.uber.org/zap"
+)
+
+//go:embed model.conf
+var defaultModel string
+
+//go:embed policy.csv
+var defaultPolicy string
+
+// Config holds policy engine configuration
+type Config struct {
+	ModelPath      string        `yaml:"modelPath"`      // Casbin model file, empty uses the built-in model
+	PolicyPath     string        `yaml:"policyPath"`     // Casbin policy CSV, empty uses the built-in policy
+	ReloadInterval time.Duration `yaml:"reloadInterval"` // How often the policy file is checked for changes
+}
+
+// Subject is who is asking for access
+type Subject struct {
+	ID     string
+	Roles  []string
+	Tenant string
+}
+
+// Resource is what access is asked for; Owner and Tenant are optional attributes
+// evaluated by policy conditions
+type Resource struct {
+	Type   string
+	ID     string
+	Owner  string
+	Tenant string
+}
+
+var (
+	mu       sync.RWMutex
+	enforcer *casbin.Enforcer
+)
+
+// Init loads the model and policies. When a policy file is configured it is
+// re-read whenever it changes until ctx is cancelled.
+func Init(ctx context.Context, cfg Config) error {
+	e, err := newEnforcer(cfg)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	enforcer = e
+	mu.Unlock()
+
+	if cfg.PolicyPath != "" && cfg.ReloadInterval > 0 {
+		go watch(ctx, cfg)
+	}
+	return nil
+}
+
+func newEnforcer(cfg Config) (*casbin.Enforcer, error) {
+	var m model.Model
+	var err error
+	if cfg.ModelPath != "" {
+		m, err = model.NewModelFromFile(cfg.ModelPath)
+	} else {
+		m, err = model.NewModelFromString(defaultModel)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e *casbin.Enforcer
+	if cfg.PolicyPath != "" {
+		e, err = casbin.NewEnforcer(m, fileadapter.NewAdapter(cfg.PolicyPath))
+	} else {
+		e, err = casbin.NewEnforcer(m, stringadapter.NewAdapter(defaultPolicy))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.AddFunction("hasRole", func(args ...any) (any, error) {
+		sub, _ := args[0].(Subject)
+		role, _ := args[1].(string)
+		return role == "*" || slices.Contains(sub.Roles, role), nil
+	})
+	return e, nil
+}
+
+// watch reloads the policy file when its modification time changes. A broken file
+// is logged and the previous policies stay in effect.
+func watch(ctx context.Context, cfg Config) {
+	ticker := time.NewTicker(cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	var lastMod time.Time
+	if info, err := os.Stat(cfg.PolicyPath); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(cfg.PolicyPath)
+		if err != nil || !info.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		e, err := newEnforcer(cfg)
+		if err != nil {
+			logger.Error("failed to reload authorization policies", zap.String("path", cfg.PolicyPath), zap.Error(err))
+			continue
+		}
+
+		mu.Lock()
+		enforcer = e
+		mu.Unlock()
+		logger.Info("reloaded authorization policies", zap.String("path", cfg.PolicyPath))
+	}
+}
+
+type subjectKey struct{}
+
+// WithSubject returns a context carrying the subject for later Authorize calls
+func WithSubject(ctx context.Context, sub Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, sub)
+}
+
+// SubjectFromContext returns the subject stored by WithSubject
+func SubjectFromContext(ctx context.Context) (Subject, bool) {
+	sub, ok := ctx.Value(subjectKey{}).(Subject)
+	return sub, ok
+}
+
+// Can reports whether the subject in ctx may perform action on resource
+func Can(ctx context.Context, action string, resource Resource) (bool, error) {
+	sub, ok := SubjectFromContext(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	mu.RLock()
+	e := enforcer
+	mu.RUnlock()
+	if e == nil {
+		return false, apperrors.NewInternalServerError("Authorization is not initialized")
+	}
+
+	return e.Enforce(sub, resource, action)
+}
+
+// Authorize returns an AppError unless the subject in ctx may perform action on
+// resource, so services can simply return its result
+func Authorize(ctx context.Context, action string, resource Resource) error {
+	if _, ok := SubjectFromContext(ctx); !ok {
+		return apperrors.NewUnauthorizedError("Authentication required")
+	}
+
+	allowed, err := Can(ctx, action, resource)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return apperrors.NewForbiddenError("You are not allowed to " + action + " this " + resource.Type)
+	}
+	return nil
+}
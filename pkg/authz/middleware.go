@@ -0,0 +1,65 @@
+package authz
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SubjectFromJWT puts the subject of a token validated by the JWT middleware into the
+// request context
+func SubjectFromJWT() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := c.Request.Context().Value("user").(*jwt.Token)
+		if !ok {
+			c.Next()
+			return
+		}
+		if sub, ok := SubjectOfToken(token); ok {
+			c.Request = c.Request.WithContext(WithSubject(c.Request.Context(), sub))
+		}
+		c.Next()
+	}
+}
+
+// SubjectOfToken returns the subject of a validated token, read from its sub,
+// roles and tenant claims
+func SubjectOfToken(token *jwt.Token) (Subject, bool) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return Subject{}, false
+	}
+	sub := Subject{}
+	sub.ID, _ = claims["sub"].(string)
+	sub.Tenant, _ = claims["tenant"].(string)
+	if roles, ok := claims["roles"].([]any); ok {
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				sub.Roles = append(sub.Roles, s)
+			}
+		}
+	}
+	return sub, true
+}
+
+// Require enforces a type-level policy before the handler runs, using the route
+// parameter idParam (if any) as the resource ID. Checks that need the loaded
+// resource's owner or tenant belong in the service, through Authorize.
+func Require(action, resourceType, idParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resource := Resource{Type: resourceType}
+		if idParam != "" {
+			resource.ID = c.Param(idParam)
+		}
+		if sub, ok := SubjectFromContext(c.Request.Context()); ok {
+			// Without the loaded resource, assume it lives in the caller's tenant
+			resource.Tenant = sub.Tenant
+		}
+
+		if err := Authorize(c.Request.Context(), action, resource); err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,238 @@
+// Package bind decodes request bodies. In strict mode JSON fields that don't exist on
+// the target struct are rejected by name, so a typo like "emial" fails loudly instead
+// of leaving the field empty.
+package bind
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Config holds binding configuration
+type Config struct {
+	Strict      bool     `yaml:"strict"`      // Reject unknown JSON fields
+	TimeLayouts []string `yaml:"timeLayouts"` // Tried for time query parameters, DefaultTimeLayouts if empty
+}
+
+var strict atomic.Bool
+
+// Configure sets the binding mode, call it once at startup
+func Configure(cfg Config) {
+	strict.Store(cfg.Strict)
+
+	layouts := cfg.TimeLayouts
+	if len(layouts) == 0 {
+		layouts = DefaultTimeLayouts
+	}
+	layoutsMu.Lock()
+	timeLayouts = layouts
+	layoutsMu.Unlock()
+}
+
+// Validation errors name fields by their json tags, or form tags for query
+// parameters, so error details match the request rather than the Go struct
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" {
+				name, _, _ = strings.Cut(f.Tag.Get("form"), ",")
+			}
+			switch name {
+			case "-":
+				return ""
+			case "":
+				return f.Name
+			}
+			return name
+		})
+	}
+}
+
+const allowUnknownKey = "bind.allowUnknown"
+
+// AllowUnknownFields opts a route out of strict mode, for endpoints that accept
+// payloads produced by third parties or older clients
+func AllowUnknownFields() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(allowUnknownKey, true)
+		c.Next()
+	}
+}
+
+// UnknownFieldsError lists the JSON fields that don't match the target
+type UnknownFieldsError struct {
+	Fields   []string // Paths like items[0].name
+	Pointers []string // The same fields as JSON Pointers, like /items/0/name
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return "unknown fields: " + strings.Join(e.Fields, ", ")
+}
+
+// FieldErrors describes each unknown field for the validation error details
+func (e *UnknownFieldsError) FieldErrors() []apperrors.FieldError {
+	list := make([]apperrors.FieldError, len(e.Fields))
+	for i, field := range e.Fields {
+		name := field[strings.LastIndexAny(field, ".]")+1:]
+		list[i] = apperrors.FieldError{Pointer: e.Pointers[i], Field: name, Rule: "unknown", Message: name + " is not a known field"}
+	}
+	return list
+}
+
+// JSON decodes the request body into obj and validates it like c.ShouldBindJSON,
+// rejecting unknown fields first in strict mode
+func JSON(c *gin.Context, obj any) error {
+	if !strict.Load() || c.GetBool(allowUnknownKey) || c.Request.Body == nil {
+		return c.ShouldBindJSON(obj)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var raw any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err == nil {
+		var unknown []field
+		collectUnknown(raw, reflect.TypeOf(obj), field{}, &unknown)
+		if len(unknown) > 0 {
+			sort.Slice(unknown, func(i, j int) bool { return unknown[i].path < unknown[j].path })
+			err := &UnknownFieldsError{}
+			for _, f := range unknown {
+				err.Fields = append(err.Fields, f.path)
+				err.Pointers = append(err.Pointers, f.pointer)
+			}
+			return err
+		}
+	}
+	// Syntax errors are left to the regular binding so the message stays the same
+	return binding.JSON.BindBody(body, obj)
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// field locates a value in the request body
+type field struct {
+	path    string
+	pointer string
+}
+
+func (f field) key(key string) field {
+	if f.path != "" {
+		return field{f.path + "." + key, f.pointer + apperrors.Pointer(key)}
+	}
+	return field{key, apperrors.Pointer(key)}
+}
+
+func (f field) index(i int) field {
+	return field{fmt.Sprintf("%s[%d]", f.path, i), f.pointer + "/" + strconv.Itoa(i)}
+}
+
+// collectUnknown walks the decoded JSON alongside the Go type, recording the path of
+// every object key encoding/json would drop
+func collectUnknown(raw any, t reflect.Type, path field, unknown *[]field) {
+	for t.Kind() == reflect.Pointer {
+		if t.Implements(unmarshalerType) {
+			return
+		}
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for key, value := range obj {
+			ft, ok := lookup(fields, key)
+			if !ok {
+				*unknown = append(*unknown, path.key(key))
+				continue
+			}
+			collectUnknown(value, ft, path.key(key), unknown)
+		}
+	case reflect.Map:
+		if obj, ok := raw.(map[string]any); ok {
+			for key, value := range obj {
+				collectUnknown(value, t.Elem(), path.key(key), unknown)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := raw.([]any); ok {
+			for i, value := range list {
+				collectUnknown(value, t.Elem(), path.index(i), unknown)
+			}
+		}
+	}
+}
+
+// lookup matches a key the way encoding/json does: exact name first, then case-insensitively
+func lookup(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// jsonFields returns the JSON names of a struct's fields, flattening embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, t := range jsonFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = t
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
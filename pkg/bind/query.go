@@ -0,0 +1,285 @@
+package bind
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// DefaultTimeLayouts are tried in order for time query parameters without a
+// time_format tag, unless configured otherwise
+var DefaultTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+var (
+	layoutsMu   sync.RWMutex
+	timeLayouts = DefaultTimeLayouts
+)
+
+// ValueError is a query parameter that couldn't be parsed
+type ValueError struct {
+	Param    string
+	Value    string
+	Type     string // The field's type, like integer or time
+	Expected string // What the value should have looked like, like "an integer"
+}
+
+// ValueErrors lists every malformed query parameter of a request
+type ValueErrors []ValueError
+
+func (e ValueErrors) Error() string {
+	list := make([]string, len(e))
+	for i, v := range e {
+		list[i] = fmt.Sprintf("%s: %q is not %s", v.Param, v.Value, v.Expected)
+	}
+	return "invalid query parameters: " + strings.Join(list, "; ")
+}
+
+// FieldErrors describes each malformed parameter for the validation error details
+func (e ValueErrors) FieldErrors() []apperrors.FieldError {
+	list := make([]apperrors.FieldError, len(e))
+	for i, v := range e {
+		list[i] = apperrors.FieldError{
+			Field:   v.Param,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be %s", v.Param, v.Expected),
+			Param:   v.Type,
+		}
+	}
+	return list
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Query decodes the query string into the fields of obj tagged form:"name", then
+// validates it like c.ShouldBindQuery. Beyond what gin binds it handles:
+//
+//   - slices from repeated parameters, comma-separated values or both, as in
+//     ?id=1,2&id=3; a nocomma option, form:"q,nocomma", keeps commas in values
+//   - times in any of the configured layouts, or the one of a time_format tag, which
+//     may also be unix or unixmilli
+//   - durations like 1h30m
+//   - any encoding.TextUnmarshaler, such as big.Rat or a decimal type
+//
+// Every malformed value is reported at once as ValueErrors, and fields without a
+// parameter keep their values, so defaults can be set before calling Query.
+func Query(c *gin.Context, obj any) error {
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind: Query needs a pointer to a struct, got %T", obj)
+	}
+	var errs ValueErrors
+	decodeQuery(c.Request.URL.Query(), rv.Elem(), &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return queryError{err}
+	}
+	return nil
+}
+
+// queryError is a validation error of query parameters, which have no place in the
+// request body for a pointer to locate
+type queryError struct {
+	error
+}
+
+func (e queryError) Unwrap() error {
+	return e.error
+}
+
+func (e queryError) FieldErrors() []apperrors.FieldError {
+	list := apperrors.FieldErrors(e.error)
+	for i := range list {
+		list[i].Pointer = ""
+	}
+	return list
+}
+
+func decodeQuery(query map[string][]string, rv reflect.Value, errs *ValueErrors) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			decodeQuery(query, rv.Field(i), errs)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		values, ok := query[name]
+		if !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		if field.Kind() == reflect.Slice && !implementsText(field.Type()) {
+			if !strings.Contains(opts, "nocomma") {
+				values = splitComma(values)
+			}
+			list := reflect.MakeSlice(field.Type(), len(values), len(values))
+			for j, v := range values {
+				if err := decodeValue(list.Index(j), v, f.Tag); err != nil {
+					*errs = append(*errs, ValueError{Param: name, Value: v, Type: err.typ, Expected: err.expected})
+				}
+			}
+			field.Set(list)
+			continue
+		}
+		if err := decodeValue(field, values[0], f.Tag); err != nil {
+			*errs = append(*errs, ValueError{Param: name, Value: values[0], Type: err.typ, Expected: err.expected})
+		}
+	}
+}
+
+func splitComma(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func implementsText(t reflect.Type) bool {
+	return t.Implements(textUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// mismatch describes the value a field expected
+type mismatch struct {
+	typ      string
+	expected string
+}
+
+// decodeValue parses s into v, describing the expected value when s doesn't fit
+func decodeValue(v reflect.Value, s string, tag reflect.StructTag) *mismatch {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(v.Elem(), s, tag)
+	}
+
+	switch {
+	case v.Type() == timeType:
+		t, err := parseTime(s, tag.Get("time_format"))
+		if err != nil {
+			return &mismatch{"time", "a time like " + timeExample(tag.Get("time_format"))}
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return &mismatch{"duration", "a duration like 1h30m"}
+		}
+		v.SetInt(int64(d))
+		return nil
+	case reflect.PointerTo(v.Type()).Implements(textUnmarshalerType):
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			if v.Type().PkgPath() == "math/big" {
+				return &mismatch{"number", "a number"}
+			}
+			name := strings.ToLower(v.Type().Name())
+			return &mismatch{name, "a valid " + name}
+		}
+		return nil
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err != nil {
+			return &mismatch{"boolean", "true or false"}
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, v.Type().Bits()); err != nil {
+			return &mismatch{"integer", "an integer"}
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, v.Type().Bits()); err != nil {
+			return &mismatch{"integer", "a positive integer"}
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		if n, err = strconv.ParseFloat(s, v.Type().Bits()); err != nil {
+			return &mismatch{"number", "a number"}
+		}
+		v.SetFloat(n)
+	default:
+		panic("bind: unsupported query field type " + v.Type().String())
+	}
+	return nil
+}
+
+func parseTime(s, format string) (time.Time, error) {
+	switch format {
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if format == "unix" {
+			return time.Unix(n, 0).UTC(), nil
+		}
+		return time.UnixMilli(n).UTC(), nil
+	case "":
+		layoutsMu.RLock()
+		layouts := timeLayouts
+		layoutsMu.RUnlock()
+		var err error
+		for _, layout := range layouts {
+			var t time.Time
+			if t, err = time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, err
+	}
+	return time.Parse(format, s)
+}
+
+func timeExample(format string) string {
+	switch format {
+	case "unix":
+		return "1700000000"
+	case "unixmilli":
+		return "1700000000000"
+	case "":
+		layoutsMu.RLock()
+		defer layoutsMu.RUnlock()
+		return strings.Join(timeLayouts, " or ")
+	}
+	return format
+}
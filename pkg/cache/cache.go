@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is a byte-oriented key/value cache with per-entry TTLs
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Adder is implemented by caches able to set a key only when it isn't held,
+// atomically even between the instances sharing the cache
+type Adder interface {
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+// addMu serializes Add on caches that aren't Adders
+var addMu sync.Mutex
+
+// Add sets key unless the cache holds it already, reporting whether it did. On
+// caches that aren't Adders it is atomic within this instance only.
+func Add(ctx context.Context, c Cache, key string, value []byte, ttl time.Duration) (bool, error) {
+	if a, ok := c.(Adder); ok {
+		return a.Add(ctx, key, value, ttl)
+	}
+	addMu.Lock()
+	defer addMu.Unlock()
+	if _, ok, err := c.Get(ctx, key); err != nil || ok {
+		return false, err
+	}
+	return true, c.Set(ctx, key, value, ttl)
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryCache is a process-local Cache, used when Redis is not configured
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	sets    int
+}
+
+// sweepEvery controls how often Set sweeps expired entries
+const sweepEvery = 1000
+
+// NewMemoryCache creates an empty in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	e, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok || (!e.expiresAt.IsZero() && time.Now().After(e.expiresAt)) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, value, ttl)
+	return nil
+}
+
+func (m *MemoryCache) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok && (e.expiresAt.IsZero() || time.Now().Before(e.expiresAt)) {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+// set stores an entry, sweeping expired ones every sweepEvery sets. m.mu is held.
+func (m *MemoryCache) set(key string, value []byte, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	m.entries[key] = memoryEntry{value: value, expiresAt: expiresAt}
+
+	m.sets++
+	if m.sets%sweepEvery == 0 {
+		now := time.Now()
+		for k, e := range m.entries {
+			if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+				delete(m.entries, k)
+			}
+		}
+	}
+}
+
+func (m *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Invalidation is a purge request broadcast to every instance
+type Invalidation struct {
+	Keys   []string `json:"keys,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Origin string   `json:"origin,omitempty"` // Publishing instance, lets it ignore its own messages
+}
+
+// Invalidator broadcasts invalidations between instances
+type Invalidator interface {
+	Publish(ctx context.Context, inv Invalidation) error
+	Subscribe(ctx context.Context, handle func(Invalidation))
+}
+
+// NoopInvalidator is used for single-instance deployments without Redis
+type NoopInvalidator struct{}
+
+func (NoopInvalidator) Publish(ctx context.Context, inv Invalidation) error { return nil }
+
+func (NoopInvalidator) Subscribe(ctx context.Context, handle func(Invalidation)) {}
+
+// RedisInvalidator broadcasts invalidations over a Redis pub/sub channel
+type RedisInvalidator struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewRedisInvalidator creates an invalidator publishing on channel
+func NewRedisInvalidator(client *redis.Client, channel string) *RedisInvalidator {
+	return &RedisInvalidator{client: client, channel: channel}
+}
+
+func (r *RedisInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, payload).Err()
+}
+
+// Subscribe calls handle for each invalidation until ctx is cancelled.
+// Malformed messages are ignored.
+func (r *RedisInvalidator) Subscribe(ctx context.Context, handle func(Invalidation)) {
+	sub := r.client.Subscribe(ctx, r.channel)
+	go func() {
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var inv Invalidation
+				if err := json.Unmarshal([]byte(msg.Payload), &inv); err == nil {
+					handle(inv)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var repositoryRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_repository_requests_total",
+	Help: "Reads of cached repositories by result: hit, negative_hit, miss or error.",
+}, []string{"repository", "result"})
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Repository stores entities of type T by ID, the shape of the module stores
+type Repository[T any] interface {
+	Get(ctx context.Context, id string) (T, error)
+	Save(ctx context.Context, v T) error
+	Delete(ctx context.Context, id string) error
+}
+
+// RepositoryConfig holds how a repository's entities are cached
+type RepositoryConfig struct {
+	TTL         time.Duration `yaml:"ttl"`         // Of cached entities; caching is off when zero
+	NegativeTTL time.Duration `yaml:"negativeTTL"` // Of IDs found missing; they aren't cached when zero
+}
+
+// CachedRepository reads entities through a cache in front of a repository, as
+// JSON. Writes go to the repository, then drop the cached entry; the TTL bounds
+// how stale an entry read back while a write is in flight can be. Cache failures
+// fall back to the repository, so the cache never makes reads fail.
+type CachedRepository[T any] struct {
+	repo     Repository[T]
+	cache    Cache
+	name     string
+	id       func(T) string
+	notFound error
+	cfg      RepositoryConfig
+}
+
+// notFoundValue marks a cached miss; entities always encode to something longer
+var notFoundValue = []byte{}
+
+// NewCachedRepository caches repo in c under keys starting with name. id returns
+// the ID of an entity and notFound is the error repo returns for missing ones,
+// which negative hits return too. Pass a tenant-scoped cache, like the one
+// modules get, so tenants don't read each other's entries.
+func NewCachedRepository[T any](repo Repository[T], c Cache, name string, id func(T) string, notFound error, cfg RepositoryConfig) *CachedRepository[T] {
+	return &CachedRepository[T]{repo: repo, cache: c, name: name, id: id, notFound: notFound, cfg: cfg}
+}
+
+func (r *CachedRepository[T]) key(id string) string {
+	return "repo:" + r.name + ":" + id
+}
+
+// Get returns the cached entity, or reads it from the repository and caches it
+func (r *CachedRepository[T]) Get(ctx context.Context, id string) (T, error) {
+	if r.cfg.TTL <= 0 {
+		return r.repo.Get(ctx, id)
+	}
+	key := r.key(id)
+	raw, ok, err := r.cache.Get(ctx, key)
+	switch {
+	case err != nil:
+		repositoryRequests.WithLabelValues(r.name, "error").Inc()
+	case ok && len(raw) == 0:
+		repositoryRequests.WithLabelValues(r.name, "negative_hit").Inc()
+		var zero T
+		return zero, r.notFound
+	case ok:
+		var v T
+		if json.Unmarshal(raw, &v) == nil {
+			repositoryRequests.WithLabelValues(r.name, "hit").Inc()
+			return v, nil
+		}
+		// Left by an older shape of T; read again below
+		repositoryRequests.WithLabelValues(r.name, "error").Inc()
+	default:
+		repositoryRequests.WithLabelValues(r.name, "miss").Inc()
+	}
+
+	v, err := r.repo.Get(ctx, id)
+	if errors.Is(err, r.notFound) && r.cfg.NegativeTTL > 0 {
+		r.cache.Set(ctx, key, notFoundValue, r.cfg.NegativeTTL)
+	}
+	if err != nil {
+		return v, err
+	}
+	if raw, err := json.Marshal(v); err == nil {
+		r.cache.Set(ctx, key, raw, r.cfg.TTL)
+	}
+	return v, nil
+}
+
+// Save writes v to the repository and drops its cached entry, or the cached miss
+// when v is new
+func (r *CachedRepository[T]) Save(ctx context.Context, v T) error {
+	if err := r.repo.Save(ctx, v); err != nil {
+		return err
+	}
+	return r.Invalidate(ctx, r.id(v))
+}
+
+// Delete removes the entity from the repository and drops its cached entry
+func (r *CachedRepository[T]) Delete(ctx context.Context, id string) error {
+	if err := r.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.Invalidate(ctx, id)
+}
+
+// Invalidate drops the cached entry of id, also for writes made around the
+// decorator. Unlike failed reads, failures are returned: they leave a stale entry
+// behind for up to the TTL.
+func (r *CachedRepository[T]) Invalidate(ctx context.Context, id string) error {
+	if r.cfg.TTL <= 0 {
+		return nil
+	}
+	return r.cache.Delete(ctx, r.key(id))
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go-api/pkg/tenant"
+)
+
+// TenantCache namespaces the keys of the cache it wraps by the tenant of each
+// call's context, so tenants can't read or overwrite each other's entries. Calls
+// from a context without a tenant scope fail with tenant.ErrNoScope.
+type TenantCache struct {
+	cache Cache
+}
+
+// NewTenantCache scopes c by tenant
+func NewTenantCache(c Cache) *TenantCache {
+	return &TenantCache{cache: c}
+}
+
+func (t *TenantCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	scoped, err := tenant.Key(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	return t.cache.Get(ctx, scoped)
+}
+
+func (t *TenantCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	scoped, err := tenant.Key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return t.cache.Set(ctx, scoped, value, ttl)
+}
+
+func (t *TenantCache) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	scoped, err := tenant.Key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return Add(ctx, t.cache, scoped, value, ttl)
+}
+
+func (t *TenantCache) Delete(ctx context.Context, keys ...string) error {
+	scoped := make([]string, len(keys))
+	for i, key := range keys {
+		var err error
+		if scoped[i], err = tenant.Key(ctx, key); err != nil {
+			return err
+		}
+	}
+	return t.cache.Delete(ctx, scoped...)
+}
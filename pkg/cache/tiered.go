@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TieredCache serves hot keys from a local cache in front of a shared remote cache.
+// Writes go to the remote cache first and are broadcast so other instances drop
+// their now stale local copies.
+type TieredCache struct {
+	local       Cache
+	remote      Cache
+	invalidator Invalidator
+	localTTL    time.Duration
+	origin      string
+}
+
+// NewTieredCache creates a two-tier cache. Local entries live for at most localTTL,
+// which bounds staleness if an invalidation message is lost.
+func NewTieredCache(ctx context.Context, local, remote Cache, invalidator Invalidator, localTTL time.Duration) *TieredCache {
+	t := &TieredCache{
+		local:       local,
+		remote:      remote,
+		invalidator: invalidator,
+		localTTL:    localTTL,
+		origin:      uuid.New().String(),
+	}
+	invalidator.Subscribe(ctx, func(inv Invalidation) {
+		if inv.Origin != t.origin {
+			t.local.Delete(context.Background(), inv.Keys...)
+		}
+	})
+	return t
+}
+
+func (t *TieredCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if value, ok, _ := t.local.Get(ctx, key); ok {
+		return value, true, nil
+	}
+
+	value, ok, err := t.remote.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	t.local.Set(ctx, key, value, t.localTTL)
+	return value, true, nil
+}
+
+func (t *TieredCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := t.remote.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+
+	localTTL := t.localTTL
+	if ttl > 0 && ttl < localTTL {
+		localTTL = ttl
+	}
+	t.local.Set(ctx, key, value, localTTL)
+
+	return t.invalidator.Publish(ctx, Invalidation{Keys: []string{key}, Origin: t.origin})
+}
+
+// Add sets key in the remote cache unless it is held there, which decides
+// between instances, and drops the local copies of the key once it does
+func (t *TieredCache) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	added, err := Add(ctx, t.remote, key, value, ttl)
+	if err != nil || !added {
+		return added, err
+	}
+	t.local.Delete(ctx, key)
+	return true, t.invalidator.Publish(ctx, Invalidation{Keys: []string{key}, Origin: t.origin})
+}
+
+func (t *TieredCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	t.local.Delete(ctx, keys...)
+	if err := t.remote.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	return t.invalidator.Publish(ctx, Invalidation{Keys: keys, Origin: t.origin})
+}
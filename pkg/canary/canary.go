@@ -0,0 +1,227 @@
+// Package canary splits traffic between a stable and a candidate implementation so
+// rewritten endpoints can be rolled out gradually. A request goes to the candidate
+// when it is forced by header, its tenant is enrolled, or its client hashes into the
+// rollout percentage. Hashing the client keeps assignment sticky across requests.
+// Candidates are either in-process handlers, see Route, or another service that a
+// share of matching paths is proxied to, see Handler.
+package canary
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/authz"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Variants a request can be assigned
+const (
+	Stable    = "stable"
+	Candidate = "candidate"
+)
+
+// VariantHeader tells clients which variant served them
+const VariantHeader = "X-Canary-Variant"
+
+// Config holds the rollouts
+type Config struct {
+	Rollouts []Rollout `yaml:"rollouts"`
+}
+
+// Rollout sends a share of traffic to a candidate
+type Rollout struct {
+	Name    string   `json:"name"`
+	Percent float64  `json:"percent"`           // Share of clients sent to the candidate, 0 to 100
+	Header  string   `json:"header,omitempty"`  // Request header forcing a variant by name
+	Tenants []string `json:"tenants,omitempty"` // Tenants always sent to the candidate
+	// Upstream and Paths make the candidate another service: matching requests
+	// assigned to it are proxied there. Paths are prefixes when ending in "/*".
+	Upstream string   `json:"upstream,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+}
+
+var (
+	mu       sync.RWMutex
+	rollouts = map[string]Rollout{}
+
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "canary_requests_total",
+		Help: "Requests served by each variant of a rollout, by status class.",
+	}, []string{"rollout", "variant", "class"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "canary_request_duration_seconds",
+		Help:    "Time taken by each variant of a rollout.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"rollout", "variant"})
+)
+
+// Configure sets the rollouts that Route looks up by name
+func Configure(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	rollouts = make(map[string]Rollout, len(cfg.Rollouts))
+	for _, r := range cfg.Rollouts {
+		rollouts[r.Name] = r
+	}
+}
+
+// Assign picks the variant for a request. key identifies the client and should be
+// as stable as possible; tenant may be empty.
+func (r Rollout) Assign(req *http.Request, key, tenant string) string {
+	if r.Header != "" {
+		switch v := strings.ToLower(req.Header.Get(r.Header)); v {
+		case Stable, Candidate:
+			return v
+		}
+	}
+	if tenant != "" && slices.Contains(r.Tenants, tenant) {
+		return Candidate
+	}
+	if r.Percent <= 0 {
+		return Stable
+	}
+	if r.Percent >= 100 {
+		return Candidate
+	}
+	// The rollout name is mixed in so clients aren't the first canaries everywhere
+	sum := sha256.Sum256([]byte(r.Name + "\x00" + key))
+	if float64(binary.BigEndian.Uint64(sum[:8])%10000) < r.Percent*100 {
+		return Candidate
+	}
+	return Stable
+}
+
+// Route serves a request with stable or candidate as the rollout named name
+// assigns it. Unknown rollouts always serve stable.
+func Route(name string, stable, candidate gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mu.RLock()
+		rollout, ok := rollouts[name]
+		mu.RUnlock()
+
+		variant := Stable
+		if ok {
+			sub, _ := authz.SubjectFromContext(c.Request.Context())
+			key := sub.ID
+			if key == "" {
+				key = clientKey(c.Request, c.ClientIP())
+			}
+			variant = rollout.Assign(c.Request, key, sub.Tenant)
+		}
+
+		c.Header(VariantHeader, variant)
+		start := time.Now()
+		if variant == Candidate {
+			candidate(c)
+		} else {
+			stable(c)
+		}
+		observe(name, variant, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// Handler proxies the candidate share of rollouts with an Upstream to that upstream
+// and serves everything else with next
+func Handler(cfg Config, next http.Handler) (http.Handler, error) {
+	type upstream struct {
+		rollout Rollout
+		proxy   *httputil.ReverseProxy
+	}
+	var upstreams []upstream
+	for _, r := range cfg.Rollouts {
+		if r.Upstream == "" {
+			continue
+		}
+		target, err := url.Parse(r.Upstream)
+		if err != nil || target.Host == "" {
+			return nil, fmt.Errorf("rollout %s: invalid upstream %q", r.Name, r.Upstream)
+		}
+		upstreams = append(upstreams, upstream{rollout: r, proxy: httputil.NewSingleHostReverseProxy(target)})
+	}
+	if len(upstreams) == 0 {
+		return next, nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, u := range upstreams {
+			if !matchPath(u.rollout.Paths, req.URL.Path) {
+				continue
+			}
+			host, _, _ := net.SplitHostPort(req.RemoteAddr)
+			variant := u.rollout.Assign(req, clientKey(req, host), "")
+			w.Header().Set(VariantHeader, variant)
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+			if variant == Candidate {
+				u.proxy.ServeHTTP(rec, req)
+			} else {
+				next.ServeHTTP(rec, req)
+			}
+			observe(u.rollout.Name, variant, rec.status, time.Since(start))
+			return
+		}
+		next.ServeHTTP(w, req)
+	}), nil
+}
+
+// clientKey identifies a client without an authenticated subject by its
+// credentials, falling back to its IP
+func clientKey(req *http.Request, ip string) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		return "auth:" + auth
+	}
+	if apiKey := req.Header.Get("X-API-Key"); apiKey != "" {
+		return "key:" + apiKey
+	}
+	return "ip:" + ip
+}
+
+func matchPath(patterns []string, p string) bool {
+	p = path.Clean("/" + p)
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+		} else if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func observe(rollout, variant string, status int, elapsed time.Duration) {
+	requestsTotal.WithLabelValues(rollout, variant, strconv.Itoa(status/100)+"xx").Inc()
+	requestDuration.WithLabelValues(rollout, variant).Observe(elapsed.Seconds())
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
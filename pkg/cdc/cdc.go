@@ -0,0 +1,305 @@
+// Package cdc consumes the changes Postgres logical replication decodes from its
+// write-ahead log, so derived data like caches and search indexes stays fresh when
+// rows are written around the API, by scripts, migrations or other services.
+//
+// Changes of the subscribed tables are published under a publication and read
+// from a logical replication slot with the built-in pgoutput plugin. They are
+// peeked in batches and the slot only advanced past a batch once every handler
+// succeeded, so changes are delivered at least once, in commit order; handlers
+// must be idempotent. One instance at a time consumes, holding an advisory lock.
+// The database needs wal_level=logical and a user allowed to replicate.
+package cdc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Operations of a change
+const (
+	OpInsert   = "insert"
+	OpUpdate   = "update"
+	OpDelete   = "delete"
+	OpTruncate = "truncate" // Of the whole table, without rows
+)
+
+// Change is a row change. Values are in Postgres' text format; NULLs and
+// unchanged TOASTed values are left out.
+type Change struct {
+	Schema      string
+	Table       string
+	Op          string
+	Row         map[string]string // The new row, or with deletes the old one's key
+	Old         map[string]string // The old key of updates that changed it, or the old row with REPLICA IDENTITY FULL
+	KeyColumns  []string          // Of the replica identity, usually the primary key
+	LSN         string
+	CommittedAt time.Time
+}
+
+// Key joins the values of the key columns of the changed row, like its ID
+func (c Change) Key() string {
+	row := c.Row
+	if len(c.Old) > 0 {
+		row = c.Old
+	}
+	values := make([]string, len(c.KeyColumns))
+	for i, col := range c.KeyColumns {
+		values[i] = row[col]
+	}
+	return strings.Join(values, ",")
+}
+
+// Subscription handles the changes of one table
+type Subscription struct {
+	Table  string // Optionally qualified by its schema, as in public.users
+	Handle func(ctx context.Context, c Change) error
+}
+
+// Declarer is implemented by modules keeping data derived from their tables
+type Declarer interface {
+	ChangeSubscriptions() []Subscription
+}
+
+// Config holds change data capture configuration
+type Config struct {
+	Enabled      bool          `yaml:"enabled"`
+	Slot         string        `yaml:"slot"`         // Of logical replication, created when missing
+	Publication  string        `yaml:"publication"`  // Kept to the subscribed tables
+	PollInterval time.Duration `yaml:"pollInterval"` // Between reads once caught up, and retries after failures
+	BatchSize    int           `yaml:"batchSize"`    // Changes read at once, rounded up to whole transactions
+	Tables       []string      `yaml:"tables"`       // Whose changes purge the response cache by surrogate key
+}
+
+// validName is what slot and publication names look like, as they are
+// interpolated into statements
+var validName = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// Consumer reads changes from a replication slot and hands them to the
+// subscriptions of their tables
+type Consumer struct {
+	cfg Config
+	db  *sql.DB
+
+	mu            sync.Mutex
+	subscriptions map[string][]Subscription // By table, as subscribed
+}
+
+// NewConsumer creates a consumer of the changes of db, which must be Postgres
+func NewConsumer(cfg Config, db *sql.DB) (*Consumer, error) {
+	if cfg.Slot == "" {
+		cfg.Slot = "go_api_cdc"
+	}
+	if cfg.Publication == "" {
+		cfg.Publication = "go_api_cdc"
+	}
+	if !validName.MatchString(cfg.Slot) || !validName.MatchString(cfg.Publication) {
+		return nil, fmt.Errorf("cdc: slot and publication names must be lowercase identifiers")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	return &Consumer{cfg: cfg, db: db, subscriptions: make(map[string][]Subscription)}, nil
+}
+
+// Register adds a subscription. Subscriptions have to be registered before Start,
+// which publishes their tables.
+func (c *Consumer) Register(s Subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[s.Table] = append(c.subscriptions[s.Table], s)
+}
+
+// RegisterFrom registers the subscriptions of every value that implements Declarer
+func (c *Consumer) RegisterFrom(values ...any) {
+	for _, v := range values {
+		if d, ok := v.(Declarer); ok {
+			for _, s := range d.ChangeSubscriptions() {
+				c.Register(s)
+			}
+		}
+	}
+}
+
+// Start consumes changes until ctx is cancelled, unless disabled or nothing is
+// subscribed
+func (c *Consumer) Start(ctx context.Context) {
+	if !c.cfg.Enabled || len(c.tables()) == 0 {
+		return
+	}
+	go func() {
+		for ctx.Err() == nil {
+			if err := c.consume(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("change data capture failed", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.cfg.PollInterval):
+			}
+		}
+	}()
+}
+
+// tables lists the subscribed tables, in order
+func (c *Consumer) tables() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tables := make([]string, 0, len(c.subscriptions))
+	for table := range c.subscriptions {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// consume takes the consumer lock and reads batches until ctx is cancelled or a
+// batch fails. It returns nil right away while another instance consumes.
+func (c *Consumer) consume(ctx context.Context) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, "cdc:"+c.cfg.Slot).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock(hashtext($1))`, "cdc:"+c.cfg.Slot)
+
+	if err := c.setUp(ctx, conn); err != nil {
+		return fmt.Errorf("setting up replication: %w", err)
+	}
+	decoder := newDecoder()
+	for ctx.Err() == nil {
+		n, err := c.batch(ctx, conn, decoder)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.cfg.PollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// setUp creates the slot when missing and keeps the publication to the
+// subscribed tables
+func (c *Consumer) setUp(ctx context.Context, conn *sql.Conn) error {
+	quoted := make([]string, 0)
+	for _, table := range c.tables() {
+		parts := strings.Split(table, ".")
+		for i, p := range parts {
+			parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+		}
+		quoted = append(quoted, strings.Join(parts, "."))
+	}
+	tables := strings.Join(quoted, ", ")
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)`, c.cfg.Publication).Scan(&exists); err != nil {
+		return err
+	}
+	stmt := `CREATE PUBLICATION ` + c.cfg.Publication + ` FOR TABLE ` + tables
+	if exists {
+		stmt = `ALTER PUBLICATION ` + c.cfg.Publication + ` SET TABLE ` + tables
+	}
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+
+	if err := conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)`, c.cfg.Slot).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_create_logical_replication_slot($1, 'pgoutput')`, c.cfg.Slot); err != nil {
+			return err
+		}
+		logger.Info("created replication slot", zap.String("slot", c.cfg.Slot))
+	}
+	return nil
+}
+
+// batch hands the next changes to their subscriptions, then advances the slot
+// past them. It returns how many messages it read, which include the beginning
+// and end of transactions that changed no subscribed table.
+func (c *Consumer) batch(ctx context.Context, conn *sql.Conn, d *decoder) (int, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT lsn::text, data FROM pg_logical_slot_peek_binary_changes($1, NULL, $2,
+			'proto_version', '1', 'publication_names', $3)`, c.cfg.Slot, c.cfg.BatchSize, c.cfg.Publication)
+	if err != nil {
+		return 0, err
+	}
+	var changes []Change
+	var last string // LSN of the end of the last transaction read
+	n := 0
+	for rows.Next() {
+		n++
+		var lsn string
+		var data []byte
+		if err := rows.Scan(&lsn, &data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		decoded, commit, err := d.decode(lsn, data)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("decoding change at %s: %w", lsn, err)
+		}
+		changes = append(changes, decoded...)
+		if commit {
+			last = lsn
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, change := range changes {
+		if err := c.dispatch(ctx, change); err != nil {
+			return 0, err
+		}
+	}
+	if last != "" {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_replication_slot_advance($1, $2::pg_lsn)`, c.cfg.Slot, last); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// dispatch hands a change to the subscriptions of its table
+func (c *Consumer) dispatch(ctx context.Context, change Change) error {
+	c.mu.Lock()
+	subs := append(append([]Subscription(nil), c.subscriptions[change.Table]...), c.subscriptions[change.Schema+"."+change.Table]...)
+	c.mu.Unlock()
+	for _, s := range subs {
+		if err := s.Handle(ctx, change); err != nil {
+			changesHandled.WithLabelValues(change.Table, "error").Inc()
+			return fmt.Errorf("%s change of %s at %s: %w", change.Op, change.Table, change.LSN, err)
+		}
+	}
+	changesHandled.WithLabelValues(change.Table, "success").Inc()
+	if !change.CommittedAt.IsZero() {
+		lag.Set(time.Since(change.CommittedAt).Seconds())
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package cdc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	changesHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cdc_changes_total",
+		Help: "Row changes handed to subscriptions, by table and result: success or error.",
+	}, []string{"table", "result"})
+	lag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "cdc_lag_seconds",
+		Help: "Time between the commit of the last change handled and its handling.",
+	})
+)
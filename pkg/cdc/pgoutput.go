@@ -0,0 +1,189 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// relation is a table as pgoutput describes it before its first change
+type relation struct {
+	schema, table string
+	columns       []string
+	key           []string
+}
+
+// decoder decodes the messages of version 1 of the pgoutput protocol. Relations
+// are described again in every read of the slot, but kept across reads anyway.
+type decoder struct {
+	relations   map[uint32]relation
+	committedAt time.Time // Of the transaction being read
+}
+
+func newDecoder() *decoder {
+	return &decoder{relations: make(map[uint32]relation)}
+}
+
+var errShortMessage = errors.New("message too short")
+
+// pgEpoch is where pgoutput's timestamps count microseconds from
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// decode decodes one message at lsn, returning the changes it holds and whether
+// it ends a transaction
+func (d *decoder) decode(lsn string, data []byte) ([]Change, bool, error) {
+	if len(data) == 0 {
+		return nil, false, errShortMessage
+	}
+	r := &reader{buf: data[1:]}
+	switch data[0] {
+	case 'B': // Begin: final LSN, commit time, xid
+		r.uint64()
+		d.committedAt = pgEpoch.Add(time.Duration(int64(r.uint64())) * time.Microsecond)
+		return nil, false, r.err
+	case 'C':
+		return nil, true, nil
+	case 'R':
+		id := r.uint32()
+		rel := relation{schema: r.string(), table: r.string()}
+		r.byte() // Replica identity setting
+		n := int(r.uint16())
+		for i := 0; i < n && r.err == nil; i++ {
+			flags := r.byte()
+			name := r.string()
+			r.uint32() // Type
+			r.uint32() // Modifier
+			rel.columns = append(rel.columns, name)
+			if flags&1 != 0 {
+				rel.key = append(rel.key, name)
+			}
+		}
+		if r.err == nil {
+			d.relations[id] = rel
+		}
+		return nil, false, r.err
+	case 'I', 'U', 'D':
+		rel, ok := d.relations[r.uint32()]
+		if !ok {
+			return nil, false, fmt.Errorf("change of an undescribed relation")
+		}
+		c := Change{Schema: rel.schema, Table: rel.table, KeyColumns: rel.key, LSN: lsn, CommittedAt: d.committedAt}
+		switch data[0] {
+		case 'I':
+			c.Op = OpInsert
+			r.byte() // N
+			c.Row = r.tuple(rel)
+		case 'U':
+			c.Op = OpUpdate
+			if kind := r.byte(); kind == 'K' || kind == 'O' {
+				c.Old = r.tuple(rel)
+				r.byte() // N
+			}
+			c.Row = r.tuple(rel)
+		case 'D':
+			c.Op = OpDelete
+			r.byte() // K or O
+			c.Row = r.tuple(rel)
+		}
+		return []Change{c}, false, r.err
+	case 'T':
+		n := int(r.uint32())
+		r.byte() // Options
+		var changes []Change
+		for i := 0; i < n && r.err == nil; i++ {
+			rel, ok := d.relations[r.uint32()]
+			if !ok {
+				return nil, false, fmt.Errorf("truncate of an undescribed relation")
+			}
+			changes = append(changes, Change{Schema: rel.schema, Table: rel.table, Op: OpTruncate, KeyColumns: rel.key,
+				LSN: lsn, CommittedAt: d.committedAt})
+		}
+		return changes, false, r.err
+	}
+	// Types, origins and logical messages carry no row changes
+	return nil, false, nil
+}
+
+// reader reads the fields of a message, keeping the first error
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = errShortMessage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// string reads a null-terminated string
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, b := range r.buf {
+		if b == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = errShortMessage
+	return ""
+}
+
+// tuple reads the values of a row by column name, leaving out NULLs and
+// unchanged TOASTed values
+func (r *reader) tuple(rel relation) map[string]string {
+	n := int(r.uint16())
+	row := make(map[string]string, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		switch r.byte() {
+		case 't':
+			value := r.next(int(r.uint32()))
+			if i < len(rel.columns) {
+				row[rel.columns[i]] = string(value)
+			}
+		case 'n', 'u':
+		default:
+			r.err = fmt.Errorf("unknown tuple value kind")
+		}
+	}
+	return row
+}
@@ -0,0 +1,143 @@
+// Package clamav scans files for malware with a clamd daemon, streaming them over
+// its INSTREAM command so clamd needs no access to the files.
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize is how much of a file is sent to clamd per INSTREAM chunk
+const chunkSize = 64 << 10
+
+// Config holds the clamd connection
+type Config struct {
+	Address string        `yaml:"address"` // host:port, tcp://host:port or unix:///path/to/clamd.sock
+	Timeout time.Duration `yaml:"timeout"` // Of one scan, including sending the file
+}
+
+// Result is the verdict of a scan
+type Result struct {
+	Infected  bool
+	Signature string // Name of the malware found, like Eicar-Test-Signature
+}
+
+// Client talks to clamd. It opens a connection per command, as clamd closes them
+// after each one.
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// New creates a client for cfg's daemon. It returns nil when no address is
+// configured, which leaves files unscanned.
+func New(cfg Config) *Client {
+	if cfg.Address == "" {
+		return nil
+	}
+	c := &Client{network: "tcp", address: cfg.Address, timeout: cfg.Timeout}
+	if path, ok := strings.CutPrefix(cfg.Address, "unix://"); ok {
+		c.network, c.address = "unix", path
+	} else if addr, ok := strings.CutPrefix(cfg.Address, "tcp://"); ok {
+		c.address = addr
+	}
+	if c.timeout <= 0 {
+		c.timeout = time.Minute
+	}
+	return c
+}
+
+// Ping checks that clamd is up
+func (c *Client) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamav: unexpected reply to PING: %q", reply)
+	}
+	return nil
+}
+
+// Scan streams r to clamd. Files larger than clamd's StreamMaxLength fail with an
+// error rather than passing as clean.
+func (c *Client) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	reply, err := c.command(ctx, "zINSTREAM\x00", func(w io.Writer) error {
+		buf := make([]byte, 4+chunkSize)
+		for {
+			n, err := io.ReadFull(r, buf[4:])
+			if n > 0 {
+				binary.BigEndian.PutUint32(buf, uint32(n))
+				if _, werr := w.Write(buf[:4+n]); werr != nil {
+					return werr
+				}
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		// A zero length chunk ends the stream
+		_, err := w.Write([]byte{0, 0, 0, 0})
+		return err
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Replies look like "stream: OK" or "stream: Eicar-Test-Signature FOUND"
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("clamav: scan failed: %s", strings.TrimSuffix(verdict, " ERROR"))
+}
+
+// command sends a null-terminated command and its payload, then reads the
+// null-terminated reply
+func (c *Client) command(ctx context.Context, cmd string, payload func(io.Writer) error) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", fmt.Errorf("clamav: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	w := bufio.NewWriterSize(conn, 4+chunkSize)
+	if _, err := w.WriteString(cmd); err != nil {
+		return "", fmt.Errorf("clamav: %w", err)
+	}
+	if payload != nil {
+		if err := payload(w); err != nil {
+			return "", fmt.Errorf("clamav: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("clamav: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return "", fmt.Errorf("clamav: reading reply: %w", err)
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
@@ -0,0 +1,311 @@
+// Code generated by clientgen from the OpenAPI document. DO NOT EDIT.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Avoid unused imports when the document has no such fields or parameters
+var (
+	_ = time.Time{}
+	_ = url.PathEscape
+)
+
+// basePath is the path the API version is served under
+const basePath = "/api/v1"
+
+// Client calls the API at a base URL like https://api.example.com
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+}
+
+// Option customises a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithHeader adds a header to every request, such as Authorization
+func WithHeader(name, value string) Option {
+	return func(c *Client) { c.header.Add(name, value) }
+}
+
+// New creates a client for the API at baseURL
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: http.DefaultClient, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is an error response from the API
+type Error struct {
+	StatusCode int             `json:"-"`
+	Code       string          `json:"code"`
+	Message    string          `json:"message"`
+	Details    json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("api: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+basePath+path, reader)
+	if err != nil {
+		return err
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		json.Unmarshal(raw, apiErr)
+		return apiErr
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+type Delivery struct {
+	Body    string     `json:"body,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	SentAt  *time.Time `json:"sentAt,omitempty"`
+	Subject string     `json:"subject,omitempty"`
+	To      []string   `json:"to"`
+}
+
+type Document struct {
+	CompletedAt *time.Time                 `json:"completedAt,omitempty"`
+	CreatedAt   time.Time                  `json:"createdAt"`
+	Data        map[string]json.RawMessage `json:"data,omitempty"`
+	DownloadURL string                     `json:"downloadUrl,omitempty"`
+	Email       Delivery                   `json:"email,omitempty"`
+	Error       string                     `json:"error,omitempty"`
+	Filename    string                     `json:"filename"`
+	ID          string                     `json:"id"`
+	OwnerID     string                     `json:"ownerId"`
+	Size        int64                      `json:"size,omitempty"`
+	Status      string                     `json:"status"`
+	Template    string                     `json:"template"`
+	Tenant      string                     `json:"tenant,omitempty"`
+}
+
+type Image struct {
+	CreatedAt time.Time          `json:"createdAt"`
+	Error     string             `json:"error,omitempty"`
+	Format    string             `json:"format"`
+	Height    int                `json:"height"`
+	ID        string             `json:"id"`
+	OwnerID   string             `json:"ownerId"`
+	Scan      string             `json:"scan,omitempty"`
+	Size      int64              `json:"size"`
+	Status    string             `json:"status"`
+	Tenant    string             `json:"tenant,omitempty"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+	Variants  map[string]Variant `json:"variants"`
+	Width     int                `json:"width"`
+}
+
+type Variant struct {
+	Height int   `json:"height"`
+	Size   int64 `json:"size"`
+	Width  int   `json:"width"`
+}
+
+type CreateRequest struct {
+	Data     map[string]json.RawMessage `json:"data"`
+	Email    EmailRequest               `json:"email,omitempty"`
+	Filename string                     `json:"filename"`
+	Template string                     `json:"template"`
+}
+
+type EmailRequest struct {
+	Body    string   `json:"body"`
+	Subject string   `json:"subject"`
+	To      []string `json:"to"`
+}
+
+// CreateDocument generate a PDF from a template
+//
+// POST /documents
+func (c *Client) CreateDocument(ctx context.Context, body *CreateRequest) (*Document, error) {
+	out := new(Document)
+	if err := c.do(ctx, "POST", "/documents", body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetDocument get a document's status and download link
+//
+// GET /documents/{id}
+func (c *Client) GetDocument(ctx context.Context, id string) (*Document, error) {
+	out := new(Document)
+	if err := c.do(ctx, "GET", "/documents/"+url.PathEscape(id), nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DownloadDocument download a generated PDF
+//
+// GET /documents/{id}/file
+func (c *Client) DownloadDocument(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "GET", "/documents/"+url.PathEscape(id)+"/file", nil, &out)
+	return out, err
+}
+
+// UploadImage upload an image
+//
+// POST /images
+func (c *Client) UploadImage(ctx context.Context) (*Image, error) {
+	out := new(Image)
+	if err := c.do(ctx, "POST", "/images", nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteImage delete an image and its variants
+//
+// DELETE /images/{id}
+func (c *Client) DeleteImage(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "DELETE", "/images/"+url.PathEscape(id), nil, &out)
+	return out, err
+}
+
+// GetImage get an image's details and variants
+//
+// GET /images/{id}
+func (c *Client) GetImage(ctx context.Context, id string) (*Image, error) {
+	out := new(Image)
+	if err := c.do(ctx, "GET", "/images/"+url.PathEscape(id), nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ResizeImage download an image resized
+//
+// GET /images/{id}/resize
+func (c *Client) ResizeImage(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "GET", "/images/"+url.PathEscape(id)+"/resize", nil, &out)
+	return out, err
+}
+
+// GetImageVariant download an image variant
+//
+// GET /images/{id}/variants/{variant}
+func (c *Client) GetImageVariant(ctx context.Context, id string, variant string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "GET", "/images/"+url.PathEscape(id)+"/variants/"+url.PathEscape(variant), nil, &out)
+	return out, err
+}
+
+// UploadCapabilities describe the resumable upload server
+//
+// OPTIONS /uploads
+func (c *Client) UploadCapabilities(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "OPTIONS", "/uploads", nil, &out)
+	return out, err
+}
+
+// CreateUpload start a resumable upload
+//
+// POST /uploads
+func (c *Client) CreateUpload(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "POST", "/uploads", nil, &out)
+	return out, err
+}
+
+// DeleteUpload cancel or delete an upload
+//
+// DELETE /uploads/{id}
+func (c *Client) DeleteUpload(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "DELETE", "/uploads/"+url.PathEscape(id), nil, &out)
+	return out, err
+}
+
+// GetUploadOffset get how much of an upload was received
+//
+// HEAD /uploads/{id}
+func (c *Client) GetUploadOffset(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "HEAD", "/uploads/"+url.PathEscape(id), nil, &out)
+	return out, err
+}
+
+// AppendUploadChunk upload a chunk
+//
+// PATCH /uploads/{id}
+func (c *Client) AppendUploadChunk(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "PATCH", "/uploads/"+url.PathEscape(id), nil, &out)
+	return out, err
+}
+
+// DownloadUpload download a finished upload
+//
+// GET /uploads/{id}/file
+func (c *Client) DownloadUpload(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "GET", "/uploads/"+url.PathEscape(id)+"/file", nil, &out)
+	return out, err
+}
+
+// GetUploadFileInfo get the size and ETag of a finished upload
+//
+// HEAD /uploads/{id}/file
+func (c *Client) GetUploadFileInfo(ctx context.Context, id string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "HEAD", "/uploads/"+url.PathEscape(id)+"/file", nil, &out)
+	return out, err
+}
@@ -0,0 +1,7 @@
+// Package client is a typed Go client for the public API, generated from the v1
+// OpenAPI document. Refresh it with "make client" after changing routes.
+//
+//	c := client.New("https://api.example.com", client.WithHeader("Authorization", "Bearer "+token))
+package client
+
+//go:generate go run ../../cmd/clientgen -spec openapi.json -package client -o client.gen.go
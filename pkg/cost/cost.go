@@ -0,0 +1,242 @@
+// Package cost throttles clients by what their requests cost rather than by their
+// number. Routes declare a cost, the default one otherwise, and handlers doing work
+// that depends on the request, like decoding a large image, charge more once they
+// know it. Each API key spends from a budget per window set by its plan, so a
+// handful of heavy calls can't use up a tenant's plan; requests without a known
+// key spend from a budget of their client IP.
+package cost
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Config holds route costs and the budgets they are spent from
+type Config struct {
+	Enabled      bool             `yaml:"enabled"`
+	Window       time.Duration    `yaml:"window"`       // Budgets are per window, aligned to the clock
+	Budget       int64            `yaml:"budget"`       // Of API keys whose plan has none, and of client IPs
+	Plans        map[string]int64 `yaml:"plans"`        // Budgets by plan
+	Default      int64            `yaml:"default"`      // Cost of routes declaring none
+	Routes       map[string]int64 `yaml:"routes"`       // By "METHOD /route/:param", overriding the route's own
+	ExcludePaths []string         `yaml:"excludePaths"` // Path prefixes that cost nothing
+}
+
+// Headers telling clients about their budget
+const (
+	CostHeader      = "X-Cost"           // Charged for the request
+	BudgetHeader    = "X-Cost-Budget"    // Per window
+	RemainingHeader = "X-Cost-Remaining" // Left in the window
+	ResetHeader     = "X-Cost-Reset"     // Seconds until the next window
+)
+
+// Subject is who a request spends the budget of
+type Subject struct {
+	ID   string // Of the API key
+	Plan string
+}
+
+// Identify returns the subject of an API key token
+type Identify func(ctx context.Context, token string) (Subject, error)
+
+// Counter counts what subjects spent in a window, shared by instances
+type Counter interface {
+	// Add adds n to the count of key, which expires after ttl, and returns the total
+	Add(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+const accountKey = "costAccount"
+
+var (
+	mu       sync.RWMutex
+	cfg      = Config{Window: time.Minute, Default: 1}
+	declared = map[string]int64{}
+)
+
+// Configure sets the budgets and the costs set in configuration
+func Configure(c Config) {
+	if c.Window <= 0 {
+		c.Window = time.Minute
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+}
+
+// Declare sets the cost of the route of method at the full path, like
+// POST /api/v1/documents
+func Declare(method, path string, cost int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	declared[method+" "+path] = cost
+}
+
+// Of returns the cost of a route: its configured override, the cost it declared,
+// or the default
+func Of(method, path string) int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cost, ok := cfg.Routes[method+" "+path]; ok {
+		return cost
+	}
+	if cost, ok := declared[method+" "+path]; ok {
+		return cost
+	}
+	return cfg.Default
+}
+
+// account is the budget a request spends from
+type account struct {
+	counter Counter
+	key     string // Of the counter of the subject in the window
+	budget  int64
+	reset   time.Time
+	charged int64
+}
+
+// charge spends n from the budget, refusing it when the budget can't cover it.
+// The counter failing lets the request through, as limiting is best effort.
+func (a *account) charge(c *gin.Context, n int64) error {
+	ctx := c.Request.Context()
+	total, err := a.counter.Add(ctx, a.key, n, time.Until(a.reset)+time.Second)
+	if err != nil {
+		logger.Warn("failed to count request cost", zap.Error(err))
+		return nil
+	}
+	h := c.Writer.Header()
+	h.Set(BudgetHeader, strconv.FormatInt(a.budget, 10))
+	h.Set(ResetHeader, strconv.Itoa(int(time.Until(a.reset).Seconds())+1))
+	if total > a.budget {
+		if _, err := a.counter.Add(ctx, a.key, -n, time.Until(a.reset)+time.Second); err != nil {
+			logger.Warn("failed to refund refused request cost", zap.Error(err))
+		}
+		throttled.Inc()
+		h.Set(RemainingHeader, strconv.FormatInt(max(a.budget-total+n, 0), 10))
+		h.Set("Retry-After", h.Get(ResetHeader))
+		return &apperrors.AppError{
+			Code:       apperrors.CodeTooManyRequests,
+			Message:    "Request costs more than is left of the budget until the window resets",
+			StatusCode: http.StatusTooManyRequests,
+			Details:    map[string]any{"cost": n, "budget": a.budget},
+		}
+	}
+	a.charged += n
+	spent.Add(float64(n))
+	h.Set(CostHeader, strconv.FormatInt(a.charged, 10))
+	h.Set(RemainingHeader, strconv.FormatInt(a.budget-total, 10))
+	return nil
+}
+
+// Charge spends n more from the budget of the request, for work whose cost depends
+// on the request. Handlers call it before doing the work and return its error,
+// which is 429 once the budget is spent. Without a budget, like when limiting is
+// off, it charges nothing.
+func Charge(c *gin.Context, n int64) error {
+	a, ok := c.Get(accountKey)
+	if !ok || n <= 0 {
+		return nil
+	}
+	return a.(*account).charge(c, n)
+}
+
+// Middleware charges each request the cost of its route. API key tokens are
+// identified once per window; unknown ones spend the budget of the client IP.
+// It belongs after ErrorHandler, which renders its refusals.
+func Middleware(counter Counter, identify Identify) gin.HandlerFunc {
+	subjects := &subjectCache{identify: identify, entries: make(map[string]subjectEntry)}
+	return func(c *gin.Context) {
+		mu.RLock()
+		conf := cfg
+		mu.RUnlock()
+		if !conf.Enabled || c.FullPath() == "" || excluded(conf.ExcludePaths, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		now := time.Now()
+		start := now.Truncate(conf.Window)
+		a := &account{counter: counter, budget: conf.Budget, reset: start.Add(conf.Window)}
+		sub, ok := subjects.get(c.Request.Context(), c.GetHeader("X-API-Key"), conf.Window)
+		if ok {
+			if budget, planned := conf.Plans[sub.Plan]; planned {
+				a.budget = budget
+			}
+			a.key = "cost:key:" + sub.ID
+		} else {
+			a.key = "cost:ip:" + c.ClientIP()
+		}
+		a.key += ":" + strconv.FormatInt(start.Unix(), 10)
+		c.Set(accountKey, a)
+
+		if err := a.charge(c, Of(c.Request.Method, c.FullPath())); err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func excluded(prefixes []string, path string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSubjects bounds the identified tokens kept, beyond which expired ones go
+const maxSubjects = 10000
+
+type subjectEntry struct {
+	subject Subject
+	ok      bool
+	expires time.Time
+}
+
+// subjectCache remembers who tokens belong to, and which belong to nobody
+type subjectCache struct {
+	identify Identify
+
+	mu      sync.Mutex
+	entries map[string]subjectEntry
+}
+
+func (s *subjectCache) get(ctx context.Context, token string, ttl time.Duration) (Subject, bool) {
+	if token == "" || s.identify == nil {
+		return Subject{}, false
+	}
+	now := time.Now()
+	s.mu.Lock()
+	e, cached := s.entries[token]
+	s.mu.Unlock()
+	if cached && now.Before(e.expires) {
+		return e.subject, e.ok
+	}
+
+	sub, err := s.identify(ctx, token)
+	e = subjectEntry{subject: sub, ok: err == nil && sub.ID != "", expires: now.Add(ttl)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) >= maxSubjects {
+		for token, old := range s.entries {
+			if now.After(old.expires) {
+				delete(s.entries, token)
+			}
+		}
+	}
+	if len(s.entries) < maxSubjects {
+		s.entries[token] = e
+	}
+	return e.subject, e.ok
+}
@@ -0,0 +1,73 @@
+package cost
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MemoryCounter counts in process, used when Redis isn't configured. Each
+// instance then has its own budgets.
+type MemoryCounter struct {
+	mu      sync.Mutex
+	entries map[string]memoryCount
+	adds    int
+}
+
+type memoryCount struct {
+	n       int64
+	expires time.Time
+}
+
+// sweepEvery controls how often Add sweeps expired counts
+const sweepEvery = 1000
+
+// NewMemoryCounter creates an empty in-process counter
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{entries: make(map[string]memoryCount)}
+}
+
+func (m *MemoryCounter) Add(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.adds++; m.adds%sweepEvery == 0 {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	e := m.entries[key]
+	if now.After(e.expires) {
+		e = memoryCount{expires: now.Add(ttl)}
+	}
+	e.n += n
+	m.entries[key] = e
+	return e.n, nil
+}
+
+// RedisCounter counts in Redis, so instances share budgets
+type RedisCounter struct {
+	client *redis.Client
+}
+
+// NewRedisCounter creates a counter backed by client
+func NewRedisCounter(client *redis.Client) *RedisCounter {
+	return &RedisCounter{client: client}
+}
+
+func (r *RedisCounter) Add(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		incr = p.IncrBy(ctx, key, n)
+		p.ExpireNX(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
@@ -0,0 +1,17 @@
+package cost
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	spent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "request_cost_spent_total",
+		Help: "Cost charged to the budgets of the requests served.",
+	})
+	throttled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "request_cost_throttled_total",
+		Help: "Requests and charges refused because they cost more than was left of the budget.",
+	})
+)
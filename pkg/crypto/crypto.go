@@ -0,0 +1,45 @@
+// Package crypto provides envelope encryption for sensitive columns. Values are
+// encrypted with AES-256-GCM under a data key that is wrapped by a master key held in
+// the local keyring or in Vault, and struct fields tagged `encrypt:"true"` can be
+// encrypted and decrypted in place by stores, bound to the table, field and row
+// they are stored in.
+package crypto
+
+import "errors"
+
+// Config selects the master key source. Vault is used when VaultAddr is set,
+// otherwise the local keyring; with neither, New returns a nil envelope and values
+// are stored as plaintext.
+type Config struct {
+	Keys       map[string]string `yaml:"keys"`       // Key ID -> base64 32-byte master key
+	PrimaryKey string            `yaml:"primaryKey"` // Key new data keys are wrapped with
+
+	VaultAddr       string `yaml:"vaultAddr"`
+	VaultToken      string `yaml:"vaultToken"`
+	VaultTransitKey string `yaml:"vaultTransitKey"`
+}
+
+// New creates the envelope described by cfg, or nil when encryption isn't configured
+func New(cfg Config) (*Envelope, error) {
+	if cfg.VaultAddr != "" {
+		if cfg.VaultTransitKey == "" {
+			return nil, errors.New("crypto: a Vault transit key is required")
+		}
+		return NewEnvelope(NewVaultTransit(cfg.VaultAddr, cfg.VaultToken, cfg.VaultTransitKey)), nil
+	}
+	if len(cfg.Keys) == 0 {
+		return nil, nil
+	}
+
+	primary := cfg.PrimaryKey
+	if primary == "" && len(cfg.Keys) == 1 {
+		for id := range cfg.Keys {
+			primary = id
+		}
+	}
+	ring, err := NewKeyring(primary, cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvelope(ring), nil
+}
@@ -0,0 +1,207 @@
+package crypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// prefix marks encrypted values so plaintext written before encryption was enabled
+// can still be read. Values of v1 only authenticate the key ID, not where they are
+// stored; they are still read, and rotated to v2.
+const (
+	prefix   = "enc:v2:"
+	prefixV1 = "enc:v1:"
+)
+
+// KeyWrapper protects data keys with a master key held by a KMS, Vault or the local
+// keyring. KeyID identifies the master key (version) new data keys are wrapped with.
+type KeyWrapper interface {
+	KeyID() string
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// ErrMalformed is returned for values that carry the encryption prefix but can't be parsed
+var ErrMalformed = errors.New("crypto: malformed encrypted value")
+
+// Envelope encrypts values with AES-256-GCM under a data key that is itself wrapped
+// by the master key. One data key is reused per master key so a KMS round trip isn't
+// needed for every value; unwrapped data keys are cached for decryption.
+type Envelope struct {
+	wrapper KeyWrapper
+
+	mu        sync.Mutex
+	current   *dataKey
+	unwrapped map[string]cipher.AEAD // sha256(keyID|wrapped) -> cipher
+}
+
+type dataKey struct {
+	keyID   string
+	wrapped []byte
+	aead    cipher.AEAD
+}
+
+// NewEnvelope creates an envelope using wrapper for data keys
+func NewEnvelope(wrapper KeyWrapper) *Envelope {
+	return &Envelope{wrapper: wrapper, unwrapped: make(map[string]cipher.AEAD)}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// dataKey returns the data key for the current master key, creating a new one after
+// the master key is rotated
+func (e *Envelope) dataKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keyID := e.wrapper.KeyID()
+	if e.current != nil && e.current.keyID == keyID {
+		return e.current, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := e.wrapper.Wrap(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	e.current = &dataKey{keyID: keyID, wrapped: wrapped, aead: aead}
+	e.unwrapped[cacheKey(keyID, wrapped)] = aead
+	return e.current, nil
+}
+
+func cacheKey(keyID string, wrapped []byte) string {
+	sum := sha256.Sum256(append([]byte(keyID+"|"), wrapped...))
+	return string(sum[:])
+}
+
+// additionalData is what GCM authenticates besides the ciphertext: the key ID and,
+// from v2, where the value is stored
+func additionalData(version, keyID, binding string) []byte {
+	if version == prefixV1 {
+		return []byte(keyID)
+	}
+	return []byte(keyID + "\x00" + binding)
+}
+
+// Encrypt returns the encrypted form of plaintext, safe to store in a TEXT column.
+// The value only decrypts with the same binding, which names where it is stored,
+// like the table, column and row, so it can't be copied over another one.
+func (e *Envelope) Encrypt(ctx context.Context, plaintext, binding string) (string, error) {
+	dk, err := e.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, dk.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := dk.aead.Seal(nonce, nonce, []byte(plaintext), additionalData(prefix, dk.keyID, binding))
+
+	enc := base64.RawStdEncoding
+	return prefix + dk.keyID + ":" + enc.EncodeToString(dk.wrapped) + ":" + enc.EncodeToString(sealed), nil
+}
+
+// IsEncrypted reports whether a stored value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix) || strings.HasPrefix(value, prefixV1)
+}
+
+type parsed struct {
+	version string
+	keyID   string
+	wrapped []byte
+	sealed  []byte
+}
+
+func parse(value string) (parsed, error) {
+	version := prefix
+	if strings.HasPrefix(value, prefixV1) {
+		version = prefixV1
+	}
+	parts := strings.Split(strings.TrimPrefix(value, version), ":")
+	if len(parts) != 3 {
+		return parsed{}, ErrMalformed
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return parsed{}, ErrMalformed
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return parsed{}, ErrMalformed
+	}
+	return parsed{version: version, keyID: parts[0], wrapped: wrapped, sealed: sealed}, nil
+}
+
+// Decrypt returns the plaintext of a value encrypted with binding. Values that were
+// never encrypted are returned unchanged, so columns can be migrated gradually.
+func (e *Envelope) Decrypt(ctx context.Context, value, binding string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	p, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	ck := cacheKey(p.keyID, p.wrapped)
+	e.mu.Lock()
+	aead, ok := e.unwrapped[ck]
+	e.mu.Unlock()
+
+	if !ok {
+		key, err := e.wrapper.Unwrap(ctx, p.keyID, p.wrapped)
+		if err != nil {
+			return "", fmt.Errorf("unwrap data key: %w", err)
+		}
+		if aead, err = newAEAD(key); err != nil {
+			return "", err
+		}
+		e.mu.Lock()
+		e.unwrapped[ck] = aead
+		e.mu.Unlock()
+	}
+
+	if len(p.sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	nonce, ciphertext := p.sealed[:aead.NonceSize()], p.sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(p.version, p.keyID, binding))
+	if err != nil {
+		return "", fmt.Errorf("crypto: decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether a value is plaintext, wrapped by an older master
+// key or of v1, not bound to where it is stored
+func (e *Envelope) NeedsRotation(value string) bool {
+	if !IsEncrypted(value) {
+		return value != ""
+	}
+	p, err := parse(value)
+	return err == nil && (p.keyID != e.wrapper.KeyID() || p.version != prefix)
+}
@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Record is where the fields of a struct are stored, the table and the key of the
+// row. Each field is encrypted bound to it and its own name, so a value copied
+// to another field, row or table fails to decrypt.
+type Record struct {
+	Table string
+	ID    string
+}
+
+// binding names a field of the record
+func (r Record) binding(field string) string {
+	return r.Table + "\x00" + field + "\x00" + r.ID
+}
+
+// EncryptFields encrypts, in place, every string field of the struct v points to that
+// is tagged `encrypt:"true"`. Nested structs and pointers to structs are walked too.
+// Stores call it just before writing a record.
+func (e *Envelope) EncryptFields(ctx context.Context, v any, rec Record) error {
+	return e.walk(v, func(field, s string) (string, error) {
+		if s == "" || IsEncrypted(s) {
+			return s, nil
+		}
+		return e.Encrypt(ctx, s, rec.binding(field))
+	})
+}
+
+// DecryptFields reverses EncryptFields after a record has been read
+func (e *Envelope) DecryptFields(ctx context.Context, v any, rec Record) error {
+	return e.walk(v, func(field, s string) (string, error) {
+		return e.Decrypt(ctx, s, rec.binding(field))
+	})
+}
+
+// ReencryptFields decrypts and re-encrypts tagged fields that are plaintext, wrapped
+// by an older master key or not bound to the record yet, reporting whether anything
+// changed and needs to be saved
+func (e *Envelope) ReencryptFields(ctx context.Context, v any, rec Record) (bool, error) {
+	changed := false
+	err := e.walk(v, func(field, s string) (string, error) {
+		if !e.NeedsRotation(s) {
+			return s, nil
+		}
+		plaintext, err := e.Decrypt(ctx, s, rec.binding(field))
+		if err != nil {
+			return "", err
+		}
+		changed = true
+		return e.Encrypt(ctx, plaintext, rec.binding(field))
+	})
+	return changed, err
+}
+
+func (e *Envelope) walk(v any, fn func(field, value string) (string, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("crypto: expected a pointer to a struct, got %T", v)
+	}
+	return walkStruct(rv.Elem(), "", fn)
+}
+
+// walkStruct calls fn with the tagged fields of rv, named by their path from the
+// walked struct, like Credentials.Password
+func walkStruct(rv reflect.Value, path string, fn func(field, value string) (string, error)) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := rv.Field(i)
+
+		if field.Tag.Get("encrypt") == "true" {
+			if fv.Kind() != reflect.String {
+				return fmt.Errorf("crypto: field %s.%s tagged encrypt must be a string", rt.Name(), field.Name)
+			}
+			out, err := fn(path+field.Name, fv.String())
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", rt.Name(), field.Name, err)
+			}
+			fv.SetString(out)
+			continue
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := walkStruct(fv, path+field.Name+".", fn); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Pointer && !fv.IsNil() && fv.Elem().Kind() == reflect.Struct:
+			if err := walkStruct(fv.Elem(), path+field.Name+".", fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
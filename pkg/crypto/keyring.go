@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// Keyring wraps data keys with local AES-256 master keys. Rotating means adding a new
+// key and making it primary; older keys stay in the ring to unwrap existing data.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a keyring from base64-encoded 32-byte master keys by ID
+func NewKeyring(primary string, keys map[string]string) (*Keyring, error) {
+	ring := &Keyring{primary: primary, keys: make(map[string][]byte, len(keys))}
+	for id, encoded := range keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %s must be 32 bytes, base64-encoded", id)
+		}
+		ring.keys[id] = key
+	}
+	if _, ok := ring.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary encryption key %q is not configured", primary)
+	}
+	return ring, nil
+}
+
+func (k *Keyring) KeyID() string { return k.primary }
+
+func (k *Keyring) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	aead, err := newAEAD(k.keys[k.primary])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(k.primary)), nil
+}
+
+func (k *Keyring) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", keyID)
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+type dbKey struct{}
+
+// WithDB returns a context routing the queries of stores that resolve their
+// database with From to db, like the database of the request's tenant
+func WithDB(ctx context.Context, db *sql.DB) context.Context {
+	return context.WithValue(ctx, dbKey{}, db)
+}
+
+// From returns the database ctx was routed to with WithDB, or fallback
+func From(ctx context.Context, fallback *sql.DB) *sql.DB {
+	if db, ok := ctx.Value(dbKey{}).(*sql.DB); ok {
+		return db
+	}
+	return fallback
+}
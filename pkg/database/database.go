@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" driver
+)
+
+// Dialects of the supported databases
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Config holds database connection configuration
+type Config struct {
+	Driver          string        `yaml:"driver"` // database/sql driver name, defaults to pgx; sqlite for SQLite
+	DSN             string        `yaml:"dsn"`    // For SQLite, the database file
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+	BusyTimeout     time.Duration `yaml:"busyTimeout"` // How long SQLite writers wait for the lock
+}
+
+// Open opens a connection pool and verifies it with a ping
+func Open(cfg Config) (*sql.DB, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = "pgx"
+	}
+
+	var db *sql.DB
+	if driver == SQLite {
+		db = openSQLite(cfg)
+	} else {
+		var err error
+		if db, err = sql.Open(driver, cfg.DSN); err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Dialect returns the SQL dialect of db, for the few statements that differ
+// between the databases
+func Dialect(db *sql.DB) string {
+	if isSQLite(db.Driver()) {
+		return SQLite
+	}
+	return Postgres
+}
+
+// AutoIncrement returns the definition of an integer primary key column the
+// database assigns in increasing order
+func AutoIncrement(db *sql.DB) string {
+	if Dialect(db) == SQLite {
+		return "INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+	return "BIGSERIAL PRIMARY KEY"
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// openSQLite opens an SQLite database for concurrent use by the service. Every
+// connection runs in WAL mode, so readers don't block the writer, waits out the
+// busy timeout for the write lock and enforces foreign keys. Transactions take
+// the write lock when they begin, as upgrading a read lock mid-transaction fails
+// without waiting.
+func openSQLite(cfg Config) *sql.DB {
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = 5 * time.Second
+	}
+	params := url.Values{
+		"_pragma": {
+			fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()),
+			"journal_mode(WAL)",
+			"synchronous(NORMAL)",
+			"foreign_keys(1)",
+		},
+		"_time_format": {"sqlite"},
+		"_txlock":      {"immediate"},
+	}
+	dsn := cfg.DSN
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + params.Encode()
+	} else {
+		dsn += "?" + params.Encode()
+	}
+
+	db := sql.OpenDB(sqliteConnector{dsn: dsn, driver: &sqlite.Driver{}})
+	if cfg.DSN == ":memory:" {
+		// Every connection would open a database of its own
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	return db
+}
+
+func isSQLite(d driver.Driver) bool {
+	_, ok := d.(*sqlite.Driver)
+	return ok
+}
+
+type sqliteConnector struct {
+	dsn    string
+	driver *sqlite.Driver
+}
+
+func (c sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{sqliteDriverConn: conn.(sqliteDriverConn)}, nil
+}
+
+func (c sqliteConnector) Driver() driver.Driver { return c.driver }
+
+// sqliteDriverConn is what the driver's connections implement
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// sqliteConn adapts the driver's connections to how the stores use Postgres.
+// SQLite keeps times as text, which only compares in order in one time zone, so
+// times are stored in UTC. Read-only transactions are enforced with query_only.
+type sqliteConn struct {
+	sqliteDriverConn
+	readOnly bool // Still query_only after a read-only transaction
+}
+
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := v.(time.Time); ok {
+		v = t.UTC()
+	}
+	nv.Value = v
+	return nil
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if !opts.ReadOnly {
+		return c.sqliteDriverConn.BeginTx(ctx, opts)
+	}
+	if _, err := c.ExecContext(ctx, "PRAGMA query_only = 1", nil); err != nil {
+		return nil, err
+	}
+	c.readOnly = true
+	tx, err := c.sqliteDriverConn.BeginTx(ctx, opts)
+	if err != nil {
+		c.writable()
+		return nil, err
+	}
+	return readOnlyTx{tx, c}, nil
+}
+
+// writable lifts query_only once a read-only transaction ends, before the
+// connection goes back to the pool
+func (c *sqliteConn) writable() error {
+	if _, err := c.ExecContext(context.Background(), "PRAGMA query_only = 0", nil); err != nil {
+		return err
+	}
+	c.readOnly = false
+	return nil
+}
+
+// IsValid has the pool discard connections that couldn't be made writable again
+func (c *sqliteConn) IsValid() bool {
+	return !c.readOnly && c.sqliteDriverConn.IsValid()
+}
+
+type readOnlyTx struct {
+	driver.Tx
+	conn *sqliteConn
+}
+
+func (t readOnlyTx) Commit() error {
+	err := t.Tx.Commit()
+	if resetErr := t.conn.writable(); err == nil {
+		err = resetErr
+	}
+	return err
+}
+
+func (t readOnlyTx) Rollback() error {
+	err := t.Tx.Rollback()
+	if resetErr := t.conn.writable(); err == nil {
+		err = resetErr
+	}
+	return err
+}
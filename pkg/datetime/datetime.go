@@ -0,0 +1,176 @@
+// Package datetime keeps times in UTC everywhere except where people see them. API
+// timestamps are RFC 3339 and stored as UTC; each request carries the time zone of
+// its user, from a header, their profile or their tenant, for turning calendar
+// days into UTC ranges.
+package datetime
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Time is a timestamp that is always UTC. It decodes RFC 3339 with any offset and
+// encodes RFC 3339 in UTC, so clients never see server-local times.
+type Time struct {
+	time.Time
+}
+
+// Now returns the current time in UTC
+func Now() Time {
+	return Time{time.Now().UTC()}
+}
+
+// UTC wraps t, converted to UTC
+func UTC(t time.Time) Time {
+	return Time{t.UTC()}
+}
+
+// Parse reads an RFC 3339 timestamp, with or without fractional seconds, as UTC
+func Parse(s string) (Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return Time{}, fmt.Errorf("datetime: %q is not an RFC 3339 timestamp like 2024-05-01T12:00:00Z", s)
+	}
+	return UTC(t), nil
+}
+
+func (t Time) String() string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + t.String() + `"`), nil
+}
+
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*t = Time{}
+		return nil
+	}
+	parsed, err := Parse(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func (t Time) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Time) UnmarshalText(data []byte) error {
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Value stores the time as UTC, whatever the column's or session's time zone
+func (t Time) Value() (driver.Value, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return t.UTC(), nil
+}
+
+func (t *Time) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*t = Time{}
+	case time.Time:
+		*t = UTC(v)
+	case string:
+		return t.UnmarshalText([]byte(v))
+	case []byte:
+		return t.UnmarshalText(v)
+	default:
+		return fmt.Errorf("datetime: can't scan %T", src)
+	}
+	return nil
+}
+
+type locationKey struct{}
+
+// WithLocation returns a context carrying the user's time zone
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// Location returns the user's time zone, UTC when none was resolved
+func Location(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// Day is a calendar day in a time zone as the UTC instants it spans: From is its
+// first instant and To the first instant of the next day, so queries should use
+// at >= From AND at < To. Days are 23 or 25 hours long across DST changes.
+type Day struct {
+	Date     string // Like 2024-05-01
+	From, To time.Time
+}
+
+// DayOf returns the day t falls on in loc
+func DayOf(t time.Time, loc *time.Location) Day {
+	local := t.In(loc)
+	return day(local.Year(), local.Month(), local.Day(), loc)
+}
+
+// ParseDate reads a date like 2024-05-01 as the day in loc
+func ParseDate(s string, loc *time.Location) (Day, error) {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return Day{}, fmt.Errorf("datetime: %q is not a date like 2024-05-01", s)
+	}
+	return day(d.Year(), d.Month(), d.Day(), loc), nil
+}
+
+// Today returns the current day in the request's time zone
+func Today(ctx context.Context) Day {
+	return DayOf(time.Now(), Location(ctx))
+}
+
+// Days returns the days from the one containing from to the one containing to,
+// inclusive, in loc, for reports bucketed by day
+func Days(from, to time.Time, loc *time.Location) []Day {
+	var list []Day
+	for d := DayOf(from, loc); !d.From.After(to); d = DayOf(d.To, loc) {
+		list = append(list, d)
+	}
+	return list
+}
+
+// Range returns the UTC span of the days from the first date to the last, both
+// like 2024-05-01 and inclusive, in loc
+func Range(first, last string, loc *time.Location) (from, to time.Time, err error) {
+	start, err := ParseDate(first, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := ParseDate(last, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if end.To.Before(start.To) {
+		return time.Time{}, time.Time{}, fmt.Errorf("datetime: %s is before %s", last, first)
+	}
+	return start.From, end.To, nil
+}
+
+func day(year int, month time.Month, d int, loc *time.Location) Day {
+	// time.Date normalises midnights that DST skips to the first existing instant
+	start := time.Date(year, month, d, 0, 0, 0, 0, loc)
+	next := time.Date(year, month, d+1, 0, 0, 0, 0, loc)
+	return Day{Date: start.Format(time.DateOnly), From: start.UTC(), To: next.UTC()}
+}
@@ -0,0 +1,132 @@
+package datetime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-api/pkg/authz"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Config holds time zone resolution configuration
+type Config struct {
+	Header   string            `yaml:"header"`   // Request header naming a zone, like Time-Zone: Europe/Berlin
+	Default  string            `yaml:"default"`  // Zone of requests nothing else resolves
+	Tenants  map[string]string `yaml:"tenants"`  // Zones of tenants, for users without their own
+	CacheTTL time.Duration     `yaml:"cacheTTL"` // How long looked up profile zones are cached
+}
+
+// ProfileLookup returns the time zone a user set in their profile, empty if none
+type ProfileLookup func(ctx context.Context, userID string) (string, error)
+
+// Resolver works out the time zone of requests
+type Resolver struct {
+	cfg      Config
+	fallback *time.Location
+	tenants  map[string]*time.Location
+	profile  ProfileLookup
+
+	mu    sync.Mutex
+	cache map[string]cachedZone
+	swept time.Time
+}
+
+type cachedZone struct {
+	loc     *time.Location
+	expires time.Time
+}
+
+// NewResolver checks the configured zones. profile may be nil.
+func NewResolver(cfg Config, profile ProfileLookup) (*Resolver, error) {
+	r := &Resolver{cfg: cfg, fallback: time.UTC, profile: profile, cache: make(map[string]cachedZone), tenants: make(map[string]*time.Location)}
+	if cfg.Default != "" {
+		loc, err := time.LoadLocation(cfg.Default)
+		if err != nil {
+			return nil, err
+		}
+		r.fallback = loc
+	}
+	for tenant, zone := range cfg.Tenants {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, err
+		}
+		r.tenants[tenant] = loc
+	}
+	return r, nil
+}
+
+// Middleware puts the request's time zone in its context for Location: the header's
+// if it names a valid zone, then the user's profile zone, then their tenant's, then
+// the default. It has to run after the authentication middleware.
+func (r *Resolver) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loc := r.resolve(c)
+		c.Request = c.Request.WithContext(WithLocation(c.Request.Context(), loc))
+		c.Next()
+	}
+}
+
+func (r *Resolver) resolve(c *gin.Context) *time.Location {
+	if r.cfg.Header != "" {
+		if zone := c.GetHeader(r.cfg.Header); zone != "" && zone != "Local" {
+			if loc, err := time.LoadLocation(zone); err == nil {
+				return loc
+			}
+		}
+	}
+
+	sub, ok := authz.SubjectFromContext(c.Request.Context())
+	if !ok {
+		return r.fallback
+	}
+	if sub.ID != "" && r.profile != nil {
+		if loc := r.profileZone(c.Request.Context(), sub.ID); loc != nil {
+			return loc
+		}
+	}
+	if loc, ok := r.tenants[sub.Tenant]; ok {
+		return loc
+	}
+	return r.fallback
+}
+
+func (r *Resolver) profileZone(ctx context.Context, userID string) *time.Location {
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[userID]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.loc
+	}
+
+	var loc *time.Location
+	zone, err := r.profile(ctx, userID)
+	if err != nil {
+		logger.Debug("failed to look up profile time zone", zap.String("user", userID), zap.Error(err))
+		return nil
+	}
+	if zone != "" {
+		if loc, err = time.LoadLocation(zone); err != nil {
+			logger.Warn("invalid profile time zone", zap.String("user", userID), zap.String("zone", zone))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache[userID] = cachedZone{loc, now.Add(r.cfg.CacheTTL)}
+	// Drop expired entries now and then so departed users don't accumulate
+	if now.Sub(r.swept) > 10*r.cfg.CacheTTL {
+		for id, z := range r.cache {
+			if now.After(z.expires) {
+				delete(r.cache, id)
+			}
+		}
+		r.swept = now
+	}
+	return loc
+}
@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Consul registers with the local Consul agent, which health checks the instance
+// over HTTP and drops it once it has been critical for a while
+type Consul struct {
+	addr      string
+	token     string
+	healthURL string
+	interval  time.Duration
+	client    *http.Client
+}
+
+// NewConsul creates a Consul registry client
+func NewConsul(cfg Config) *Consul {
+	return &Consul{
+		addr:      strings.TrimRight(cfg.Address, "/"),
+		token:     cfg.Token,
+		healthURL: cfg.HealthURL,
+		interval:  cfg.Interval,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *Consul) Register(ctx context.Context, inst Instance) error {
+	healthURL := c.healthURL
+	if healthURL == "" {
+		healthURL = "http://" + inst.HostPort() + "/health"
+	}
+	body := map[string]any{
+		"ID":      inst.ID,
+		"Name":    inst.Name,
+		"Address": inst.Address,
+		"Port":    inst.Port,
+		"Tags":    inst.Tags,
+		"Check": map[string]any{
+			"HTTP":                           healthURL,
+			"Interval":                       c.interval.String(),
+			"Timeout":                        "5s",
+			"DeregisterCriticalServiceAfter": "10m",
+		},
+	}
+	return c.call(ctx, http.MethodPut, "/v1/agent/service/register", body, nil)
+}
+
+func (c *Consul) Deregister(ctx context.Context, inst Instance) error {
+	return c.call(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(inst.ID), nil, nil)
+}
+
+func (c *Consul) Resolve(ctx context.Context, name string) ([]Instance, error) {
+	var entries []struct {
+		Node struct {
+			Address string `json:"Address"`
+		} `json:"Node"`
+		Service struct {
+			ID      string   `json:"ID"`
+			Service string   `json:"Service"`
+			Address string   `json:"Address"`
+			Port    int      `json:"Port"`
+			Tags    []string `json:"Tags"`
+		} `json:"Service"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(name)+"?passing=true", nil, &entries); err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0, len(entries))
+	for _, e := range entries {
+		// Services registered without an address are reached at their node
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		instances = append(instances, Instance{ID: e.Service.ID, Name: e.Service.Service, Address: addr, Port: e.Service.Port, Tags: e.Service.Tags})
+	}
+	return instances, nil
+}
+
+func (c *Consul) call(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul %s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,141 @@
+// Package discovery registers the service with Consul or etcd while it runs and
+// resolves other services by name for outbound requests. Installed as the default
+// transport, it sends requests for http://<name>.service/ to a healthy instance of
+// that service.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config selects the registry and describes how this instance registers in it
+type Config struct {
+	Backend string `yaml:"backend"` // consul or etcd, empty disables registration
+	Address string `yaml:"address"` // Registry HTTP address
+	Token   string `yaml:"token"`   // Consul ACL token
+
+	Service   Instance      `yaml:"service"`
+	HealthURL string        `yaml:"healthUrl"` // Checked by Consul; defaults to /health on the service address
+	Interval  time.Duration `yaml:"interval"`  // Consul check interval
+	TTL       time.Duration `yaml:"ttl"`       // etcd lease TTL, renewed at a third of it
+	Prefix    string        `yaml:"prefix"`    // etcd key prefix, services live under <prefix><name>/<id>
+
+	Suffix   string        `yaml:"suffix"`   // Host suffix marking service names, like .service
+	CacheTTL time.Duration `yaml:"cacheTtl"` // How long resolved instances are reused
+}
+
+// Instance is one registered instance of a service
+type Instance struct {
+	ID      string   `json:"id" yaml:"id"`
+	Name    string   `json:"name" yaml:"name"`
+	Address string   `json:"address" yaml:"address"`
+	Port    int      `json:"port" yaml:"port"`
+	Tags    []string `json:"tags,omitempty" yaml:"tags"`
+}
+
+// HostPort returns the address to dial the instance at
+func (i Instance) HostPort() string {
+	return net.JoinHostPort(i.Address, strconv.Itoa(i.Port))
+}
+
+// Registry registers instances and looks up healthy ones by service name
+type Registry interface {
+	Register(ctx context.Context, inst Instance) error
+	Deregister(ctx context.Context, inst Instance) error
+	Resolve(ctx context.Context, name string) ([]Instance, error)
+}
+
+// New returns the registry for cfg.Backend, or nil when discovery is disabled
+func New(cfg Config) (Registry, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "consul":
+		return NewConsul(cfg), nil
+	case "etcd":
+		return NewEtcd(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown discovery backend %q", cfg.Backend)
+	}
+}
+
+// Transport resolves requests to hosts ending in suffix through registry and sends
+// them with base, spreading them round robin over the healthy instances. Other
+// requests go to base unchanged.
+func Transport(registry Registry, suffix string, cacheTTL time.Duration, base http.RoundTripper) http.RoundTripper {
+	return &transport{registry: registry, suffix: suffix, cacheTTL: cacheTTL, base: base, cache: make(map[string]*resolved)}
+}
+
+type transport struct {
+	registry Registry
+	suffix   string
+	cacheTTL time.Duration
+	base     http.RoundTripper
+
+	mu    sync.Mutex
+	cache map[string]*resolved
+}
+
+type resolved struct {
+	instances []Instance
+	expires   time.Time
+	next      atomic.Uint64
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name, ok := strings.CutSuffix(req.URL.Hostname(), t.suffix)
+	if !ok || name == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	r, err := t.resolve(req.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+	inst := r.instances[r.next.Add(1)%uint64(len(r.instances))]
+
+	// RoundTrippers mustn't modify the request, so the target is set on a copy. The
+	// Host header keeps the service name for virtual hosting upstream.
+	out := req.Clone(req.Context())
+	out.URL.Host = inst.HostPort()
+	if out.Host == "" {
+		out.Host = req.URL.Host
+	}
+	return t.base.RoundTrip(out)
+}
+
+func (t *transport) resolve(ctx context.Context, name string) (*resolved, error) {
+	t.mu.Lock()
+	r, ok := t.cache[name]
+	t.mu.Unlock()
+	if ok && time.Now().Before(r.expires) {
+		return r, nil
+	}
+
+	instances, err := t.registry.Resolve(ctx, name)
+	if err != nil {
+		// A registry outage shouldn't take down calls to instances that were healthy
+		// a moment ago
+		if ok {
+			return r, nil
+		}
+		return nil, fmt.Errorf("resolve service %s: %w", name, err)
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("resolve service %s: no healthy instances", name)
+	}
+
+	r = &resolved{instances: instances, expires: time.Now().Add(t.cacheTTL)}
+	t.mu.Lock()
+	t.cache[name] = r
+	t.mu.Unlock()
+	return r, nil
+}
@@ -0,0 +1,185 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Etcd stores instances as JSON under <prefix><name>/<id>, using the v3 JSON
+// gateway. Keys are attached to a lease that is kept alive while the instance runs,
+// so a crashed instance disappears once the lease expires.
+type Etcd struct {
+	addr   string
+	prefix string
+	ttl    time.Duration
+	client *http.Client
+
+	mu    sync.Mutex
+	lease string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewEtcd creates an etcd registry client
+func NewEtcd(cfg Config) *Etcd {
+	return &Etcd{
+		addr:   strings.TrimRight(cfg.Address, "/"),
+		prefix: cfg.Prefix,
+		ttl:    cfg.TTL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *Etcd) Register(ctx context.Context, inst Instance) error {
+	if err := e.put(ctx, inst); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.stop, e.done = make(chan struct{}), make(chan struct{})
+	go e.keepAlive(inst, e.stop, e.done)
+	e.mu.Unlock()
+	return nil
+}
+
+// put grants a lease and writes the instance under it
+func (e *Etcd) put(ctx context.Context, inst Instance) error {
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	if err := e.call(ctx, "/v3/lease/grant", map[string]any{"TTL": int64(e.ttl.Seconds())}, &grant); err != nil {
+		return err
+	}
+	value, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"key": encode(e.key(inst)), "value": base64.StdEncoding.EncodeToString(value), "lease": grant.ID}
+	if err := e.call(ctx, "/v3/kv/put", body, nil); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.lease = grant.ID
+	e.mu.Unlock()
+	return nil
+}
+
+// keepAlive renews the lease at a third of its TTL, registering again if the lease
+// was lost, for example after etcd was unreachable for longer than the TTL
+func (e *Etcd) keepAlive(inst Instance, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+		e.mu.Lock()
+		lease := e.lease
+		e.mu.Unlock()
+		var resp struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		err := e.call(ctx, "/v3/lease/keepalive", map[string]any{"ID": lease}, &resp)
+		if err == nil && (resp.Result.TTL == "" || resp.Result.TTL == "0") {
+			err = e.put(ctx, inst)
+		}
+		cancel()
+		if err != nil {
+			logger.Warn("failed to renew etcd registration", zap.Error(err))
+		}
+	}
+}
+
+func (e *Etcd) Deregister(ctx context.Context, inst Instance) error {
+	e.mu.Lock()
+	stop, done, lease := e.stop, e.done, e.lease
+	e.stop = nil
+	e.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	// Revoking the lease deletes the key with it
+	return e.call(ctx, "/v3/lease/revoke", map[string]any{"ID": lease}, nil)
+}
+
+func (e *Etcd) Resolve(ctx context.Context, name string) ([]Instance, error) {
+	prefix := e.prefix + name + "/"
+	var resp struct {
+		Kvs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	// The range end is the prefix with its last byte incremented, selecting every key
+	// that starts with it
+	end := []byte(prefix)
+	end[len(end)-1]++
+	if err := e.call(ctx, "/v3/kv/range", map[string]any{"key": encode(prefix), "range_end": base64.StdEncoding.EncodeToString(end)}, &resp); err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		raw, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		var inst Instance
+		if err := json.Unmarshal(raw, &inst); err != nil {
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+func (e *Etcd) key(inst Instance) string {
+	return e.prefix + inst.Name + "/" + inst.ID
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func (e *Etcd) call(ctx context.Context, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.addr+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd %s: %s", path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
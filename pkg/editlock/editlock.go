@@ -0,0 +1,292 @@
+// Package editlock keeps advisory editing locks on resources, so client UIs can
+// tell users someone else is editing a document before their changes conflict.
+// A lock is held by a user until they release it or stop renewing it; the token
+// it's acquired with proves who holds it. Acquiring, releasing and expiring locks
+// are recorded as events, for every instance to tell its clients.
+package editlock
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Config holds editing lock configuration
+type Config struct {
+	Enabled       bool          `yaml:"enabled"`
+	DefaultTTL    time.Duration `yaml:"defaultTTL"`    // How long a lock lives without renewal, unless asked otherwise
+	MaxTTL        time.Duration `yaml:"maxTTL"`        // Longest a lock can be asked to live
+	SweepInterval time.Duration `yaml:"sweepInterval"` // How often expired locks are removed
+	Resources     []string      `yaml:"resources"`     // Resource types that can be locked
+}
+
+// Events recorded on the stream of a lock, locks-{tenant}/{type}/{id}
+const (
+	EventAcquired = "lock.acquired"
+	EventReleased = "lock.released"
+	EventExpired  = "lock.expired"
+)
+
+// Change is the data of the lock events
+type Change struct {
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+	Tenant       string `json:"tenant,omitempty"`
+	Holder       string `json:"holder"`
+	ReleasedBy   string `json:"releasedBy,omitempty"` // Of locks force-released by someone else than their holder
+}
+
+// Resource is what a lock is on
+type Resource struct {
+	Type   string
+	ID     string
+	Tenant string
+}
+
+// Lock is an advisory lock on a resource
+type Lock struct {
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Holder       string    `json:"holder"`          // User ID
+	Token        string    `json:"token,omitempty"` // Only shown to the holder
+	AcquiredAt   time.Time `json:"acquiredAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// Resource returns what the lock is on
+func (l Lock) Resource() Resource {
+	return Resource{Type: l.ResourceType, ID: l.ResourceID, Tenant: l.Tenant}
+}
+
+// key identifies the lock of a resource in stores
+func (r Resource) key() string {
+	return url.PathEscape(r.Tenant) + "/" + url.PathEscape(r.Type) + "/" + url.PathEscape(r.ID)
+}
+
+// Store holds the locks, shared by instances
+type Store interface {
+	// Get returns the live lock of a resource
+	Get(ctx context.Context, r Resource) (Lock, bool, error)
+	// Put stores l if the live lock of its resource has the token prev, or if there
+	// is none when prev is empty, reporting whether it did
+	Put(ctx context.Context, prev string, l Lock) (bool, error)
+	// Delete removes the live lock of a resource if it has token, any when token is
+	// empty, returning the lock removed
+	Delete(ctx context.Context, r Resource, token string) (Lock, bool, error)
+	// Expire removes the locks expired at now, returning them
+	Expire(ctx context.Context, now time.Time) ([]Lock, error)
+}
+
+var errNotLocked = apperrors.NewNotFoundError("Resource is not locked")
+
+// heldError is the conflict of a resource locked by someone else
+func heldError(l Lock) error {
+	return &apperrors.AppError{
+		Code:       apperrors.CodeConflict,
+		Message:    "Resource is locked by another user",
+		StatusCode: http.StatusConflict,
+		Details:    map[string]any{"holder": l.Holder, "expiresAt": l.ExpiresAt},
+	}
+}
+
+// Manager acquires and releases locks, recording what happens to them as events
+type Manager struct {
+	cfg    Config
+	store  Store
+	events eventstore.Store
+}
+
+// NewManager creates a manager keeping locks in store and recording events in events
+func NewManager(cfg Config, store Store, events eventstore.Store) *Manager {
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = 2 * time.Minute
+	}
+	if cfg.MaxTTL < cfg.DefaultTTL {
+		cfg.MaxTTL = cfg.DefaultTTL
+	}
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = 15 * time.Second
+	}
+	return &Manager{cfg: cfg, store: store, events: events}
+}
+
+// Lockable reports whether resources of a type can be locked
+func (m *Manager) Lockable(resourceType string) bool {
+	return slices.Contains(m.cfg.Resources, resourceType)
+}
+
+// MaxTTL is the longest a lock can be asked to live
+func (m *Manager) MaxTTL() time.Duration {
+	return m.cfg.MaxTTL
+}
+
+func (m *Manager) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return m.cfg.DefaultTTL
+	}
+	return min(ttl, m.cfg.MaxTTL)
+}
+
+// Acquire locks a resource for holder for ttl, the default when 0, reporting
+// whether the lock is new. Acquiring a lock the holder already has renews it with
+// the same token; one held by someone else is a conflict.
+func (m *Manager) Acquire(ctx context.Context, r Resource, holder string, ttl time.Duration) (Lock, bool, error) {
+	now := time.Now().UTC()
+	current, locked, err := m.store.Get(ctx, r)
+	if err != nil {
+		return Lock{}, false, err
+	}
+	if locked && current.Holder != holder {
+		conflicts.Inc()
+		return Lock{}, false, heldError(current)
+	}
+	l := Lock{ResourceType: r.Type, ResourceID: r.ID, Tenant: r.Tenant, Holder: holder,
+		Token: uuid.NewString(), AcquiredAt: now, ExpiresAt: now.Add(m.ttl(ttl))}
+	prev := ""
+	if locked {
+		prev, l.Token, l.AcquiredAt = current.Token, current.Token, current.AcquiredAt
+	}
+	stored, err := m.store.Put(ctx, prev, l)
+	if err != nil {
+		return Lock{}, false, err
+	}
+	if !stored {
+		// Someone else acquired it meanwhile
+		conflicts.Inc()
+		if current, locked, err = m.store.Get(ctx, r); err == nil && locked {
+			return Lock{}, false, heldError(current)
+		}
+		return Lock{}, false, apperrors.NewConflictError("Resource is being locked by another user")
+	}
+	if locked {
+		return l, false, nil
+	}
+	acquired.Inc()
+	m.record(ctx, EventAcquired, l, "")
+	return l, true, nil
+}
+
+// Renew extends the lock held with token for ttl, the default when 0
+func (m *Manager) Renew(ctx context.Context, r Resource, token string, ttl time.Duration) (Lock, error) {
+	current, locked, err := m.store.Get(ctx, r)
+	if err != nil {
+		return Lock{}, err
+	}
+	if !locked {
+		return Lock{}, errNotLocked
+	}
+	if current.Token != token {
+		return Lock{}, heldError(current)
+	}
+	l := current
+	l.ExpiresAt = time.Now().UTC().Add(m.ttl(ttl))
+	stored, err := m.store.Put(ctx, token, l)
+	if err != nil {
+		return Lock{}, err
+	}
+	if !stored {
+		return Lock{}, errNotLocked // It expired or was force-released meanwhile
+	}
+	return l, nil
+}
+
+// Release removes the lock held with token. An empty token force-releases it
+// whoever holds it, which callers only allow to those permitted, recorded as
+// released by by.
+func (m *Manager) Release(ctx context.Context, r Resource, token, by string) error {
+	l, removed, err := m.store.Delete(ctx, r, token)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		current, locked, err := m.store.Get(ctx, r)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return heldError(current)
+		}
+		return errNotLocked
+	}
+	releasedBy := ""
+	if token == "" && by != l.Holder {
+		forceReleased.Inc()
+		releasedBy = by
+	}
+	m.record(ctx, EventReleased, l, releasedBy)
+	return nil
+}
+
+// Get returns the live lock of a resource
+func (m *Manager) Get(ctx context.Context, r Resource) (Lock, error) {
+	l, locked, err := m.store.Get(ctx, r)
+	if err != nil {
+		return Lock{}, err
+	}
+	if !locked {
+		return Lock{}, errNotLocked
+	}
+	return l, nil
+}
+
+// Start removes expired locks until ctx is cancelled, recording their expiry.
+// Every instance sweeps; the store hands each lock to one.
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.cfg.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.sweep(ctx)
+			}
+		}
+	}()
+}
+
+func (m *Manager) sweep(ctx context.Context) {
+	locks, err := m.store.Expire(ctx, time.Now())
+	if err != nil && ctx.Err() == nil {
+		logger.Error("failed to expire editing locks", zap.Error(err))
+	}
+	for _, l := range locks {
+		expired.Inc()
+		m.record(ctx, EventExpired, l, "")
+	}
+}
+
+// record records an event of a lock. The lock took effect already, so a failure
+// is only logged: clients then learn of it from the lock endpoints.
+func (m *Manager) record(ctx context.Context, event string, l Lock, releasedBy string) {
+	_, err := m.events.Append(ctx, "locks-"+l.Resource().key(), eventstore.AnyVersion, eventstore.NewEvent{
+		Type: event,
+		Data: Change{ResourceType: l.ResourceType, ResourceID: l.ResourceID, Tenant: l.Tenant,
+			Holder: l.Holder, ReleasedBy: releasedBy},
+	})
+	if err != nil {
+		logger.Error("failed to record editing lock event", zap.String("event", event), zap.Error(err))
+	}
+}
+
+// EventSchemas declares the schemas of the lock events
+func (m *Manager) EventSchemas() []eventschema.Schema {
+	schema := eventschema.From(Change{})
+	return []eventschema.Schema{
+		{Event: EventAcquired, Version: 1, Description: "A user locked a resource for editing.", Schema: schema},
+		{Event: EventReleased, Version: 1, Description: "A lock was released, by its holder or forcibly.", Schema: schema},
+		{Event: EventExpired, Version: 1, Description: "A lock expired without being renewed.", Schema: schema},
+	}
+}
@@ -0,0 +1,25 @@
+package editlock
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	acquired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "edit_locks_acquired_total",
+		Help: "Editing locks acquired on resources that weren't locked.",
+	})
+	conflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "edit_lock_conflicts_total",
+		Help: "Attempts to lock a resource locked by another user.",
+	})
+	forceReleased = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "edit_locks_force_released_total",
+		Help: "Editing locks released by someone else than their holder.",
+	})
+	expired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "edit_locks_expired_total",
+		Help: "Editing locks that expired without being renewed or released.",
+	})
+)
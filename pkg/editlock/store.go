@@ -0,0 +1,209 @@
+package editlock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MemoryStore keeps locks in process, used when Redis isn't configured. Each
+// instance then has its own locks.
+type MemoryStore struct {
+	mu    sync.Mutex
+	locks map[string]Lock // By resource key
+}
+
+// NewMemoryStore creates an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{locks: make(map[string]Lock)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, r Resource) (Lock, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.live(r.key(), time.Now())
+	return l, ok, nil
+}
+
+func (m *MemoryStore) Put(ctx context.Context, prev string, l Lock) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := l.Resource().key()
+	current, ok := m.live(key, time.Now())
+	if (ok && current.Token != prev) || (!ok && prev != "") {
+		return false, nil
+	}
+	m.locks[key] = l
+	return true, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, r Resource, token string) (Lock, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.live(r.key(), time.Now())
+	if !ok || (token != "" && current.Token != token) {
+		return Lock{}, false, nil
+	}
+	delete(m.locks, r.key())
+	return current, true, nil
+}
+
+func (m *MemoryStore) Expire(ctx context.Context, now time.Time) ([]Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []Lock
+	for key, l := range m.locks {
+		if !l.ExpiresAt.After(now) {
+			delete(m.locks, key)
+			list = append(list, l)
+		}
+	}
+	return list, nil
+}
+
+// live returns the lock of key unless it expired
+func (m *MemoryStore) live(key string, now time.Time) (Lock, bool) {
+	l, ok := m.locks[key]
+	if !ok || !l.ExpiresAt.After(now) {
+		return Lock{}, false
+	}
+	return l, true
+}
+
+// RedisStore keeps each lock under its own key, changed in transactions watching
+// it, and their expiry times in a sorted set Expire sweeps. Keys outlive their
+// lock for a while so the sweep still finds what expired.
+type RedisStore struct {
+	client *redis.Client
+	grace  time.Duration
+}
+
+// NewRedisStore creates a store backed by client, keeping expired locks for grace
+// for the sweep to report them
+func NewRedisStore(client *redis.Client, grace time.Duration) *RedisStore {
+	return &RedisStore{client: client, grace: grace}
+}
+
+// expiriesKey is the sorted set of lock keys scored by their expiry
+const expiriesKey = "editlock:expiries"
+
+func lockKey(key string) string { return "editlock:lock:" + key }
+
+// read returns the lock stored under key, live or not
+func read(ctx context.Context, c redis.Cmdable, key string) (Lock, bool, error) {
+	raw, err := c.Get(ctx, lockKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Lock{}, false, nil
+	}
+	if err != nil {
+		return Lock{}, false, err
+	}
+	var l Lock
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return Lock{}, false, err
+	}
+	return l, true, nil
+}
+
+func (r *RedisStore) Get(ctx context.Context, res Resource) (Lock, bool, error) {
+	l, ok, err := read(ctx, r.client, res.key())
+	if err != nil || !ok || !l.ExpiresAt.After(time.Now()) {
+		return Lock{}, false, err
+	}
+	return l, true, nil
+}
+
+func (r *RedisStore) Put(ctx context.Context, prev string, l Lock) (bool, error) {
+	key := l.Resource().key()
+	raw, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+	stored := false
+	err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, ok, err := read(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		live := ok && current.ExpiresAt.After(time.Now())
+		if (live && current.Token != prev) || (!live && prev != "") {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, lockKey(key), raw, time.Until(l.ExpiresAt)+r.grace)
+			p.ZAdd(ctx, expiriesKey, redis.Z{Score: float64(l.ExpiresAt.UnixMilli()), Member: key})
+			return nil
+		})
+		stored = err == nil
+		return err
+	}, lockKey(key))
+	if errors.Is(err, redis.TxFailedErr) {
+		return false, nil // Changed meanwhile
+	}
+	return stored, err
+}
+
+func (r *RedisStore) Delete(ctx context.Context, res Resource, token string) (Lock, bool, error) {
+	return r.remove(ctx, res.key(), func(l Lock) bool {
+		return l.ExpiresAt.After(time.Now()) && (token == "" || l.Token == token)
+	})
+}
+
+// remove deletes the lock of key when it satisfies ok, in a transaction so a lock
+// is only removed, and reported, once
+func (r *RedisStore) remove(ctx context.Context, key string, ok func(Lock) bool) (Lock, bool, error) {
+	var removed Lock
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		l, found, err := read(ctx, tx, key)
+		if err != nil || !found || !ok(l) {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Del(ctx, lockKey(key))
+			p.ZRem(ctx, expiriesKey, key)
+			return nil
+		})
+		if err == nil {
+			removed = l
+		}
+		return err
+	}, lockKey(key))
+	if errors.Is(err, redis.TxFailedErr) {
+		return Lock{}, false, nil
+	}
+	return removed, err == nil && removed.Token != "", err
+}
+
+func (r *RedisStore) Expire(ctx context.Context, now time.Time) ([]Lock, error) {
+	keys, err := r.client.ZRangeByScore(ctx, expiriesKey, &redis.ZRangeBy{
+		Min: "-inf", Max: score(now),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var list []Lock
+	for _, key := range keys {
+		l, removed, err := r.remove(ctx, key, func(l Lock) bool { return !l.ExpiresAt.After(now) })
+		if err != nil {
+			return list, err
+		}
+		if removed {
+			list = append(list, l)
+			continue
+		}
+		// Gone past its grace, or renewed with a later score
+		if _, found, err := read(ctx, r.client, key); err == nil && !found {
+			r.client.ZRem(ctx, expiriesKey, key)
+		}
+	}
+	return list, nil
+}
+
+func score(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
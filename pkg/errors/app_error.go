@@ -9,32 +9,53 @@ type AppError struct {
 	Message    string `json:"message"`
 	StatusCode int    `json:"-"`
 	Details    any    `json:"details,omitempty"`
+	Cause      error  `json:"-"` // Logged with the error but never sent to clients
 }
 
+// Error includes the cause chain, so logging an AppError shows what went wrong
+// underneath. Responses only render Message.
 func (e *AppError) Error() string {
-	return e.Message
+	if e.Cause == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Cause.Error()
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches AppErrors with the same code, so errors.Is(err, ErrNotFound) holds for
+// any not found error
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
 }
 
 func NewNotFoundError(message string) *AppError {
 	return &AppError{
-		Code:       "NOT_FOUND",
+		Code:       CodeNotFound,
 		Message:    message,
 		StatusCode: http.StatusNotFound,
 	}
 }
 
-func NewValidationError(message string, details any) *AppError {
-	return &AppError{
-		Code:       "VALIDATION_ERROR",
+// NewValidationError returns a 400 whose details list what is wrong with the request
+func NewValidationError(message string, details ...FieldError) *AppError {
+	appErr := &AppError{
+		Code:       CodeValidation,
 		Message:    message,
 		StatusCode: http.StatusBadRequest,
-		Details:    details,
 	}
+	if len(details) > 0 {
+		appErr.Details = details
+	}
+	return appErr
 }
 
 func NewUnauthorizedError(message string) *AppError {
 	return &AppError{
-		Code:       "UNAUTHORIZED",
+		Code:       CodeUnauthorized,
 		Message:    message,
 		StatusCode: http.StatusUnauthorized,
 	}
@@ -42,16 +63,48 @@ func NewUnauthorizedError(message string) *AppError {
 
 func NewForbiddenError(message string) *AppError {
 	return &AppError{
-		Code:       "FORBIDDEN",
+		Code:       CodeForbidden,
 		Message:    message,
 		StatusCode: http.StatusForbidden,
 	}
 }
 
+func NewConflictError(message string) *AppError {
+	return &AppError{
+		Code:       CodeConflict,
+		Message:    message,
+		StatusCode: http.StatusConflict,
+	}
+}
+
+func NewGoneError(message string) *AppError {
+	return &AppError{
+		Code:       CodeGone,
+		Message:    message,
+		StatusCode: http.StatusGone,
+	}
+}
+
 func NewInternalServerError(message string) *AppError {
 	return &AppError{
-		Code:       "INTERNAL_SERVER_ERROR",
+		Code:       CodeInternal,
 		Message:    message,
 		StatusCode: http.StatusInternalServerError,
 	}
 }
+
+func NewTooManyRequestsError(message string) *AppError {
+	return &AppError{
+		Code:       CodeTooManyRequests,
+		Message:    message,
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
+func NewTimeoutError(message string) *AppError {
+	return &AppError{
+		Code:       CodeTimeout,
+		Message:    message,
+		StatusCode: http.StatusGatewayTimeout,
+	}
+}
@@ -0,0 +1,17 @@
+package errors
+
+import (
+	"context"
+	"errors"
+)
+
+// StatusClientClosedRequest is recorded for requests the client abandoned before a
+// response was written. It is never sent: the connection is already gone.
+const StatusClientClosedRequest = 499
+
+// ClientDisconnected reports whether the client went away while ctx, a request
+// context, was being served. Server-side deadlines are not disconnects and still
+// surface as errors.
+func ClientDisconnected(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
@@ -0,0 +1,99 @@
+package errors
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the language of messages when a request accepts none of the
+// registered ones
+const DefaultLanguage = "en"
+
+var (
+	messagesMu sync.RWMutex
+	messages   = make(map[string]map[string]string) // By rule, then language
+)
+
+// RegisterMessages sets the messages of a validation rule by language tag, like "en"
+// or "de". Messages are templates where {field} and {param} stand for the field
+// name and the rule's parameter.
+func RegisterMessages(rule string, byLanguage map[string]string) {
+	messagesMu.Lock()
+	defer messagesMu.Unlock()
+	if messages[rule] == nil {
+		messages[rule] = make(map[string]string)
+	}
+	for lang, message := range byLanguage {
+		messages[rule][strings.ToLower(lang)] = message
+	}
+}
+
+// message returns the registered message of a rule in lang
+func message(rule, lang, field, param string) (string, bool) {
+	messagesMu.RLock()
+	defer messagesMu.RUnlock()
+	tmpl, ok := messages[rule][lang]
+	if !ok {
+		return "", false
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(tmpl), true
+}
+
+// Localize returns the error with the messages of its field errors in the most
+// preferred language of an Accept-Language header that has them. Field errors
+// without a message in any accepted language keep theirs.
+func (e *AppError) Localize(acceptLanguage string) *AppError {
+	details, ok := e.Details.([]FieldError)
+	if !ok || acceptLanguage == "" {
+		return e
+	}
+	langs := languages(acceptLanguage)
+
+	localized := make([]FieldError, len(details))
+	for i, d := range details {
+		localized[i] = d
+		for _, lang := range langs {
+			if msg, ok := message(d.Rule, lang, d.Field, d.Param); ok {
+				localized[i].Message = msg
+				break
+			}
+		}
+	}
+	out := *e
+	out.Details = localized
+	return &out
+}
+
+// languages returns the tags of an Accept-Language header by preference. A regional
+// tag like de-AT is followed by its base language.
+func languages(header string) []string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if lang = strings.ToLower(lang); lang != "" && lang != "*" && q > 0 {
+			tags = append(tags, tag{lang, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	var out []string
+	for _, t := range tags {
+		out = append(out, t.lang)
+		if base, _, ok := strings.Cut(t.lang, "-"); ok {
+			out = append(out, base)
+		}
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+package errors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is one entry in the details of a validation error. Pointer locates the
+// offending value in the request body as an RFC 6901 JSON Pointer, like
+// /items/0/name, so clients can map it to an input; errors about other parts of the
+// request, such as query parameters, have an empty pointer.
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`            // The failed rule, like required or max
+	Message string `json:"message"`         // Readable description of the problem
+	Param   string `json:"param,omitempty"` // The rule's parameter, like the 10 of max=10
+}
+
+// FieldErrorer is implemented by errors that can describe themselves as field errors
+type FieldErrorer interface {
+	FieldErrors() []FieldError
+}
+
+// NewValidationErrorFrom returns a validation error whose details describe err, as
+// returned by binding, decoding or validating a request. err is kept as the cause.
+func NewValidationErrorFrom(message string, err error) *AppError {
+	appErr := NewValidationError(message, FieldErrors(err)...)
+	appErr.Cause = err
+	return appErr
+}
+
+// FieldErrors describes err as field errors: one per failed validation rule, or a
+// single entry for decoding errors
+func FieldErrors(err error) []FieldError {
+	if err == nil {
+		return nil
+	}
+
+	var fe FieldErrorer
+	if errors.As(err, &fe) {
+		return fe.FieldErrors()
+	}
+
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		list := make([]FieldError, 0, len(ve))
+		for _, e := range ve {
+			list = append(list, FieldError{
+				Pointer: namespacePointer(e.Namespace()),
+				Field:   e.Field(),
+				Rule:    e.Tag(),
+				Message: RuleMessage(e.Field(), e.Tag(), e.Param(), e.Kind()),
+				Param:   e.Param(),
+			})
+		}
+		return list
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		field := typeErr.Field
+		if i := strings.LastIndexByte(field, '.'); i >= 0 {
+			field = field[i+1:]
+		}
+		return []FieldError{{
+			Pointer: dottedPointer(typeErr.Field),
+			Field:   field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be %s", nonEmpty(field, "value"), article(jsonType(typeErr.Type))),
+			Param:   jsonType(typeErr.Type),
+		}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return []FieldError{{Rule: "syntax", Message: "Request body is not valid JSON"}}
+	}
+	if errors.Is(err, io.EOF) {
+		return []FieldError{{Rule: "required", Message: "Request body is required"}}
+	}
+	return []FieldError{{Rule: "invalid", Message: err.Error()}}
+}
+
+// RuleMessage describes a failed validation rule for field, with the rule's
+// registered message in DefaultLanguage if it has one. kind is the validated value's
+// kind, which tells lengths from amounts.
+func RuleMessage(field, rule, param string, kind reflect.Kind) string {
+	if msg, ok := message(rule, DefaultLanguage, field, param); ok {
+		return msg
+	}
+	sized := kind == reflect.String || kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map
+	unit := ""
+	if sized {
+		unit = " items"
+		if kind == reflect.String {
+			unit = " characters"
+		}
+	}
+	switch rule {
+	case "required", "required_if", "required_unless", "required_with", "required_without":
+		return field + " is required"
+	case "min", "gte":
+		return field + " must be at least " + param + unit
+	case "max", "lte":
+		return field + " must be at most " + param + unit
+	case "gt":
+		return field + " must be more than " + param + unit
+	case "lt":
+		return field + " must be less than " + param + unit
+	case "len":
+		return field + " must be exactly " + param + unit
+	case "oneof":
+		return field + " must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "email":
+		return field + " must be a valid email address"
+	case "url", "uri", "http_url":
+		return field + " must be a valid URL"
+	case "uuid", "uuid4":
+		return field + " must be a valid UUID"
+	case "eqfield":
+		return field + " must match " + param
+	case "unique":
+		return field + " must not contain duplicates"
+	}
+	return field + " failed the " + rule + " rule"
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Pointer builds a JSON Pointer from reference tokens, escaping ~ and / in them
+func Pointer(tokens ...string) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(t))
+	}
+	return b.String()
+}
+
+// namespacePointer converts a validator namespace like Request.items[0].name, named
+// by json tags, to /items/0/name. The first element is the root struct's type.
+func namespacePointer(ns string) string {
+	_, rest, ok := strings.Cut(ns, ".")
+	if !ok {
+		return ""
+	}
+	var tokens []string
+	for _, part := range strings.Split(rest, ".") {
+		name, index, _ := strings.Cut(part, "[")
+		tokens = append(tokens, name)
+		for index != "" {
+			var key string
+			key, index, _ = strings.Cut(index, "]")
+			tokens = append(tokens, key)
+			index = strings.TrimPrefix(index, "[")
+		}
+	}
+	return Pointer(tokens...)
+}
+
+// dottedPointer converts the a.b.0 paths of encoding/json errors to /a/b/0
+func dottedPointer(path string) string {
+	if path == "" {
+		return ""
+	}
+	return Pointer(strings.Split(path, ".")...)
+}
+
+// jsonType names the JSON type a Go type decodes from
+func jsonType(t reflect.Type) string {
+	if t == nil {
+		return "value"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return t.String()
+}
+
+func article(noun string) string {
+	if strings.ContainsAny(noun[:1], "aeiou") {
+		return "an " + noun
+	}
+	return "a " + noun
+}
+
+func nonEmpty(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package errors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Codes of the errors the API returns
+const (
+	CodeNotFound        = "NOT_FOUND"
+	CodeValidation      = "VALIDATION_ERROR"
+	CodeUnauthorized    = "UNAUTHORIZED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeConflict        = "CONFLICT"
+	CodeGone            = "GONE"
+	CodeInternal        = "INTERNAL_SERVER_ERROR"
+	CodeTooManyRequests = "TOO_MANY_REQUESTS"
+	CodeTimeout         = "TIMEOUT"
+)
+
+// Sentinels for errors.Is, which matches any AppError with the same code
+var (
+	ErrNotFound        = &AppError{Code: CodeNotFound}
+	ErrValidation      = &AppError{Code: CodeValidation}
+	ErrUnauthorized    = &AppError{Code: CodeUnauthorized}
+	ErrForbidden       = &AppError{Code: CodeForbidden}
+	ErrConflict        = &AppError{Code: CodeConflict}
+	ErrGone            = &AppError{Code: CodeGone}
+	ErrInternal        = &AppError{Code: CodeInternal}
+	ErrTooManyRequests = &AppError{Code: CodeTooManyRequests}
+	ErrTimeout         = &AppError{Code: CodeTimeout}
+)
+
+// defaults are the status and message Wrap gives each code
+var defaults = map[string]struct {
+	status  int
+	message string
+}{
+	CodeNotFound:        {http.StatusNotFound, "Not found"},
+	CodeValidation:      {http.StatusBadRequest, "Invalid request"},
+	CodeUnauthorized:    {http.StatusUnauthorized, "Authentication required"},
+	CodeForbidden:       {http.StatusForbidden, "Forbidden"},
+	CodeConflict:        {http.StatusConflict, "Conflict"},
+	CodeGone:            {http.StatusGone, "Gone"},
+	CodeInternal:        {http.StatusInternalServerError, "Internal server error"},
+	CodeTooManyRequests: {http.StatusTooManyRequests, "Too many requests"},
+	CodeTimeout:         {http.StatusGatewayTimeout, "Request timed out"},
+}
+
+var (
+	mu        sync.RWMutex
+	sentinels = []mapping{
+		{sql.ErrNoRows, CodeNotFound},
+		{context.DeadlineExceeded, CodeTimeout},
+	}
+)
+
+type mapping struct {
+	err  error
+	code string
+}
+
+// Wrap returns an AppError with the code's status and a generic message, keeping err
+// as its cause. It returns nil for a nil err. Unknown codes are server errors.
+func Wrap(err error, code string) *AppError {
+	if err == nil {
+		return nil
+	}
+	d, ok := defaults[code]
+	if !ok {
+		d = defaults[CodeInternal]
+	}
+	return &AppError{Code: code, Message: d.message, StatusCode: d.status, Cause: err}
+}
+
+// Register maps a domain error to a code, so From turns errors matching it with
+// errors.Is into that AppError. Later registrations take precedence.
+func Register(sentinel error, code string) {
+	mu.Lock()
+	defer mu.Unlock()
+	sentinels = append(sentinels, mapping{sentinel, code})
+}
+
+// From returns the AppError err is or wraps, one for the first registered sentinel
+// it matches, or an internal server error caused by it. It returns nil for a nil err.
+func From(err error) *AppError {
+	if err == nil {
+		return nil
+	}
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := len(sentinels) - 1; i >= 0; i-- {
+		if errors.Is(err, sentinels[i].err) {
+			return Wrap(err, sentinels[i].code)
+		}
+	}
+	return Wrap(err, CodeInternal)
+}
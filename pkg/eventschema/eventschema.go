@@ -0,0 +1,318 @@
+// Package eventschema keeps versioned JSON Schemas of the domain events, so
+// subscribers know the shape of what they consume. Events are validated against
+// the latest version of their schema as they are appended, stamped with that
+// version, and a new version is refused when it would break subscribers of the
+// previous one.
+package eventschema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"sync"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Schema is a version of the JSON Schema of an event type's data
+type Schema struct {
+	Event       string          `json:"event"`   // Event type, like upload.completed
+	Version     int             `json:"version"` // From 1
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+// Declarer is implemented by modules that publish events
+type Declarer interface {
+	EventSchemas() []Schema
+}
+
+// Validation modes
+const (
+	Reject = "reject" // Events not matching their schema aren't appended
+	Warn   = "warn"   // They are appended and logged
+	Off    = "off"
+)
+
+// Compatibility modes
+const (
+	Backward = "backward" // Each version must accept what subscribers of the previous one read
+	None     = "none"
+)
+
+// VersionMetadata is the metadata key of the schema version events are stamped with
+const VersionMetadata = "schemaVersion"
+
+// Config holds event schema configuration
+type Config struct {
+	Validation     string   `yaml:"validation"`     // reject, warn or off
+	Compatibility  string   `yaml:"compatibility"`  // backward or none
+	RequireSchemas bool     `yaml:"requireSchemas"` // Validation fails for events without a schema
+	Schemas        []Schema `yaml:"schemas"`        // Registered along with those modules declare
+}
+
+// Summary describes the schemas of an event type
+type Summary struct {
+	Event       string `json:"event"`
+	Description string `json:"description,omitempty"` // Of the latest version
+	Latest      int    `json:"latest"`
+	Versions    []int  `json:"versions"`
+}
+
+type entry struct {
+	Schema
+	root *schema
+}
+
+var errSchemaNotFound = apperrors.NewNotFoundError("Event schema not found")
+
+// Registry holds the schemas of every event type
+type Registry struct {
+	cfg Config
+
+	mu      sync.RWMutex
+	schemas map[string][]*entry // By event type, oldest version first
+}
+
+// NewRegistry creates a registry holding the configured schemas
+func NewRegistry(cfg Config) (*Registry, error) {
+	if cfg.Validation == "" {
+		cfg.Validation = Reject
+	}
+	if cfg.Compatibility == "" {
+		cfg.Compatibility = Backward
+	}
+	switch cfg.Validation {
+	case Reject, Warn, Off:
+	default:
+		return nil, fmt.Errorf("event schemas: unknown validation mode %q", cfg.Validation)
+	}
+	switch cfg.Compatibility {
+	case Backward, None:
+	default:
+		return nil, fmt.Errorf("event schemas: unknown compatibility mode %q", cfg.Compatibility)
+	}
+	r := &Registry{cfg: cfg, schemas: make(map[string][]*entry)}
+	if err := r.Register(cfg.Schemas...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds schema versions. None is added when one is invalid, already
+// registered or, under backward compatibility, breaks the version before it.
+func (r *Registry) Register(schemas ...Schema) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	updated := make(map[string][]*entry)
+	for _, s := range schemas {
+		if s.Event == "" {
+			return fmt.Errorf("event schema without an event type")
+		}
+		if s.Version < 1 {
+			return fmt.Errorf("event schema %s: version %d, versions start at 1", s.Event, s.Version)
+		}
+		root, err := parse(s.Schema)
+		if err != nil {
+			return fmt.Errorf("event schema %s version %d: %w", s.Event, s.Version, err)
+		}
+		list, ok := updated[s.Event]
+		if !ok {
+			list = append([]*entry(nil), r.schemas[s.Event]...)
+		}
+		for _, e := range list {
+			if e.Version == s.Version {
+				return fmt.Errorf("event schema %s version %d registered twice", s.Event, s.Version)
+			}
+		}
+		updated[s.Event] = append(list, &entry{Schema: s, root: root})
+	}
+	for event, list := range updated {
+		sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+		if r.cfg.Compatibility != Backward {
+			continue
+		}
+		for i := 1; i < len(list); i++ {
+			if changes := incompatible(list[i-1].root, list[i].root); len(changes) > 0 {
+				return fmt.Errorf("event schema %s version %d breaks version %d: %v",
+					event, list[i].Version, list[i-1].Version, changes)
+			}
+		}
+	}
+	maps.Copy(r.schemas, updated)
+	return nil
+}
+
+// RegisterFrom registers the schemas of every value that implements Declarer
+func (r *Registry) RegisterFrom(values ...any) error {
+	for _, v := range values {
+		if d, ok := v.(Declarer); ok {
+			if err := r.Register(d.EventSchemas()...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List summarizes the schemas of every event type, by type
+func (r *Registry) List() []Summary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Summary, 0, len(r.schemas))
+	for event, versions := range r.schemas {
+		latest := versions[len(versions)-1]
+		s := Summary{Event: event, Description: latest.Description, Latest: latest.Version}
+		for _, e := range versions {
+			s.Versions = append(s.Versions, e.Version)
+		}
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Event < list[j].Event })
+	return list
+}
+
+// Versions returns every version of the schema of event, oldest first
+func (r *Registry) Versions(event string) ([]Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions, ok := r.schemas[event]
+	if !ok {
+		return nil, errSchemaNotFound
+	}
+	list := make([]Schema, len(versions))
+	for i, e := range versions {
+		list[i] = e.Schema
+	}
+	return list, nil
+}
+
+// Get returns a version of the schema of event, the latest when version is 0
+func (r *Registry) Get(event string, version int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.schemas[event]
+	if len(versions) > 0 && version == 0 {
+		return versions[len(versions)-1].Schema, nil
+	}
+	for _, e := range versions {
+		if e.Version == version {
+			return e.Schema, nil
+		}
+	}
+	return Schema{}, errSchemaNotFound
+}
+
+// Check returns the changes of candidate that would break subscribers of the
+// version before it, the latest when its version is 0, and the version it was
+// checked against; 0 when there is none
+func (r *Registry) Check(candidate Schema) (int, []string, error) {
+	root, err := parse(candidate.Schema)
+	if err != nil {
+		return 0, nil, apperrors.NewValidationError("Invalid event schema", apperrors.FieldError{
+			Pointer: "/schema", Field: "schema", Rule: "jsonschema", Message: err.Error(),
+		})
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var previous *entry
+	for _, e := range r.schemas[candidate.Event] {
+		if candidate.Version == 0 || e.Version < candidate.Version {
+			previous = e
+		}
+	}
+	if previous == nil {
+		return 0, []string{}, nil
+	}
+	return previous.Version, incompatible(previous.root, root), nil
+}
+
+// Validate checks the data of an event against the latest version of its schema,
+// returning that version; 0 when the event has no schema. Under warn validation,
+// mismatches are only logged.
+func (r *Registry) Validate(event string, data json.RawMessage) (int, error) {
+	r.mu.RLock()
+	versions := r.schemas[event]
+	r.mu.RUnlock()
+	if r.cfg.Validation == Off {
+		if len(versions) == 0 {
+			return 0, nil
+		}
+		return versions[len(versions)-1].Version, nil
+	}
+	if len(versions) == 0 {
+		if !r.cfg.RequireSchemas {
+			return 0, nil
+		}
+		violationsTotal.WithLabelValues(event).Inc()
+		err := apperrors.NewValidationError(fmt.Sprintf("Event %s has no schema", event))
+		if r.cfg.Validation == Warn {
+			logger.Warn("event has no schema", zap.String("event", event))
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	latest := versions[len(versions)-1]
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, err
+	}
+	var details []apperrors.FieldError
+	validate(latest.root, v, "", &details)
+	if len(details) == 0 {
+		return latest.Version, nil
+	}
+	violationsTotal.WithLabelValues(event).Inc()
+	if r.cfg.Validation == Warn {
+		logger.Warn("event doesn't match its schema",
+			zap.String("event", event),
+			zap.Int("version", latest.Version),
+			zap.Any("violations", details),
+		)
+		return latest.Version, nil
+	}
+	return 0, apperrors.NewValidationError(
+		fmt.Sprintf("Event %s doesn't match version %d of its schema", event, latest.Version), details...)
+}
+
+// Store wraps store so appended events are validated and stamped with the version
+// of their schema
+func (r *Registry) Store(store eventstore.Store) eventstore.Store {
+	return &validatingStore{Store: store, registry: r}
+}
+
+type validatingStore struct {
+	eventstore.Store
+	registry *Registry
+}
+
+func (s *validatingStore) Append(ctx context.Context, streamID string, expectedVersion int64, events ...eventstore.NewEvent) ([]eventstore.Event, error) {
+	stamped := make([]eventstore.NewEvent, len(events))
+	for i, e := range events {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			return nil, err
+		}
+		version, err := s.registry.Validate(e.Type, data)
+		if err != nil {
+			return nil, err
+		}
+		if version > 0 {
+			metadata := make(map[string]string, len(e.Metadata)+1)
+			maps.Copy(metadata, e.Metadata)
+			metadata[VersionMetadata] = strconv.Itoa(version)
+			e.Metadata = metadata
+		}
+		stamped[i] = e
+	}
+	return s.Store.Append(ctx, streamID, expectedVersion, stamped...)
+}
@@ -0,0 +1,92 @@
+package eventschema
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"go-api/pkg/bind"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the schemas of the events for subscribers to discover them
+type Handler struct {
+	registry *Registry
+}
+
+// NewHandler creates a handler serving the schemas of registry
+func NewHandler(registry *Registry) *Handler {
+	return &Handler{registry: registry}
+}
+
+// RegisterRoutes mounts the schema discovery endpoints
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/event-schemas", h.list)
+	rg.GET("/event-schemas/:event", h.versions)
+	rg.GET("/event-schemas/:event/:version", h.get)
+}
+
+// RegisterAdminRoutes mounts the compatibility check on an admin router group
+func (h *Handler) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.POST("/event-schemas/check", h.check)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.registry.List()})
+}
+
+func (h *Handler) versions(c *gin.Context) {
+	list, err := h.registry.Versions(c.Param("event"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// get serves the JSON Schema itself, version being a number or latest
+func (h *Handler) get(c *gin.Context) {
+	version := 0
+	if v := c.Param("version"); v != "latest" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.Error(apperrors.NewValidationError("Invalid schema version", apperrors.FieldError{
+				Pointer: "/version", Field: "version", Rule: "min", Param: "1",
+				Message: "must be a version number or latest",
+			}))
+			return
+		}
+		version = n
+	}
+	s, err := h.registry.Get(c.Param("event"), version)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("X-Schema-Version", strconv.Itoa(s.Version))
+	c.Data(http.StatusOK, "application/schema+json", s.Schema)
+}
+
+type checkRequest struct {
+	Event   string          `json:"event" binding:"required"`
+	Version int             `json:"version" binding:"min=0"` // The latest when 0
+	Schema  json.RawMessage `json:"schema" binding:"required"`
+}
+
+// check reports whether a schema could be registered as a new version without
+// breaking subscribers, before it's deployed
+func (h *Handler) check(c *gin.Context) {
+	var req checkRequest
+	if err := bind.JSON(c, &req); err != nil {
+		c.Error(apperrors.NewValidationErrorFrom("Invalid event schema", err))
+		return
+	}
+	against, changes, err := h.registry.Check(Schema{Event: req.Event, Version: req.Version, Schema: req.Schema})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"compatible": len(changes) == 0, "against": against, "breaking": changes})
+}
@@ -0,0 +1,358 @@
+package eventschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// schema is the subset of JSON Schema that events are validated with: type,
+// properties, required, additionalProperties, items and enum. Other keywords are
+// kept for readers but not enforced.
+type schema struct {
+	Type                 types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *additional        `json:"additionalProperties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+}
+
+// types is the type keyword, one type name or a list of them
+type types []string
+
+func (t types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *types) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*t = types{one}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("type must be a type name or a list of them")
+	}
+	*t = list
+	return nil
+}
+
+// additional is the additionalProperties keyword, false or the schema of the
+// properties not listed
+type additional struct {
+	forbidden bool
+	schema    *schema
+}
+
+func (a additional) MarshalJSON() ([]byte, error) {
+	if a.schema != nil {
+		return json.Marshal(a.schema)
+	}
+	return json.Marshal(!a.forbidden)
+}
+
+func (a *additional) UnmarshalJSON(b []byte) error {
+	var allowed bool
+	if json.Unmarshal(b, &allowed) == nil {
+		a.forbidden = !allowed
+		return nil
+	}
+	return json.Unmarshal(b, &a.schema)
+}
+
+var typeNames = []string{"array", "boolean", "integer", "null", "number", "object", "string"}
+
+// parse decodes a JSON Schema, checking its type names
+func parse(raw json.RawMessage) (*schema, error) {
+	var s schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+	if err := s.check(""); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *schema) check(path string) error {
+	for _, t := range s.Type {
+		if !slices.Contains(typeNames, t) {
+			return fmt.Errorf("%s: unknown type %q", pointer(path), t)
+		}
+	}
+	for name, p := range s.Properties {
+		if p == nil {
+			return fmt.Errorf("%s: property without a schema", pointer(path+"/"+name))
+		}
+		if err := p.check(path + "/" + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.check(path + "/items"); err != nil {
+			return err
+		}
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.schema != nil {
+		return s.AdditionalProperties.schema.check(path + "/*")
+	}
+	return nil
+}
+
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// typeOf returns the JSON type of a decoded value
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+// accepts reports whether a value of type t matches one of the types; integers
+// are numbers
+func (t types) accepts(name string) bool {
+	return len(t) == 0 || slices.Contains(t, name) || (name == "integer" && slices.Contains(t, "number"))
+}
+
+// validate appends the violations of s by v, found at path, to details
+func validate(s *schema, v any, path string, details *[]apperrors.FieldError) {
+	field := path[strings.LastIndex(path, "/")+1:]
+	if !s.Type.accepts(typeOf(v)) {
+		*details = append(*details, apperrors.FieldError{Pointer: pointer(path), Field: field, Rule: "type",
+			Param: strings.Join(s.Type, ","), Message: fmt.Sprintf("must be of type %s", strings.Join(s.Type, " or "))})
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		values := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			values[i] = fmt.Sprint(e)
+		}
+		*details = append(*details, apperrors.FieldError{Pointer: pointer(path), Field: field, Rule: "enum",
+			Param: strings.Join(values, " "), Message: "must be one of " + strings.Join(values, ", ")})
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*details = append(*details, apperrors.FieldError{Pointer: path + "/" + name, Field: name,
+					Rule: "required", Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				validate(p, v[name], path+"/"+name, details)
+				continue
+			}
+			switch a := s.AdditionalProperties; {
+			case a == nil:
+			case a.forbidden:
+				*details = append(*details, apperrors.FieldError{Pointer: path + "/" + name, Field: name,
+					Rule: "additionalProperties", Message: "isn't allowed"})
+			case a.schema != nil:
+				validate(a.schema, v[name], path+"/"+name, details)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				validate(s.Items, item, fmt.Sprintf("%s/%d", path, i), details)
+			}
+		}
+	}
+}
+
+// incompatible returns the changes from old to new that would break subscribers
+// reading events of old: properties removed or no longer required, types
+// widened, enum values added, and properties added where old forbade them
+func incompatible(old, new *schema) []string {
+	var changes []string
+	breaking(old, new, "", &changes)
+	sort.Strings(changes)
+	return changes
+}
+
+func breaking(old, new *schema, path string, changes *[]string) {
+	at := pointer(path)
+	if len(old.Type) > 0 {
+		if len(new.Type) == 0 {
+			*changes = append(*changes, at+": type is no longer constrained")
+		}
+		for _, t := range new.Type {
+			if !old.Type.accepts(t) {
+				*changes = append(*changes, fmt.Sprintf("%s: may now be %s", at, t))
+			}
+		}
+	}
+	if len(old.Enum) > 0 {
+		if len(new.Enum) == 0 {
+			*changes = append(*changes, at+": values are no longer enumerated")
+		}
+		for _, e := range new.Enum {
+			if !slices.ContainsFunc(old.Enum, func(o any) bool { return reflect.DeepEqual(o, e) }) {
+				*changes = append(*changes, fmt.Sprintf("%s: may now be %v", at, e))
+			}
+		}
+	}
+	for name, op := range old.Properties {
+		np, ok := new.Properties[name]
+		if !ok {
+			*changes = append(*changes, path+"/"+name+": removed")
+			continue
+		}
+		breaking(op, np, path+"/"+name, changes)
+	}
+	for _, name := range old.Required {
+		if _, declared := old.Properties[name]; declared && new.Properties[name] == nil {
+			continue // Reported as removed
+		}
+		if !slices.Contains(new.Required, name) {
+			*changes = append(*changes, path+"/"+name+": no longer required")
+		}
+	}
+	if old.AdditionalProperties != nil && old.AdditionalProperties.forbidden {
+		for name := range new.Properties {
+			if _, ok := old.Properties[name]; !ok {
+				*changes = append(*changes, path+"/"+name+": added where additional properties were forbidden")
+			}
+		}
+	}
+	if old.AdditionalProperties != nil && old.AdditionalProperties.schema != nil &&
+		new.AdditionalProperties != nil && new.AdditionalProperties.schema != nil {
+		breaking(old.AdditionalProperties.schema, new.AdditionalProperties.schema, path+"/*", changes)
+	}
+	if old.Items != nil && new.Items != nil {
+		breaking(old.Items, new.Items, path+"/items", changes)
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// From generates the schema of the JSON encoding of v's type, so modules declare
+// the schema of an event from its data type. Fields without omitempty are
+// required, and pointers, slices and maps may be null.
+func From(v any) json.RawMessage {
+	raw, err := json.Marshal(schemaOf(reflect.TypeOf(v)))
+	if err != nil {
+		panic(err) // Generated schemas always encode
+	}
+	return raw
+}
+
+func schemaOf(t reflect.Type) *schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	var s *schema
+	switch {
+	case t == timeType:
+		s = &schema{Type: types{"string"}, Format: "date-time"}
+	case t == rawMessageType || t.Kind() == reflect.Interface:
+		return &schema{}
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		// Custom encodings can't be inferred from the Go type
+		return &schema{}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			s = &schema{Type: types{"boolean"}}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s = &schema{Type: types{"integer"}}
+		case reflect.Float32, reflect.Float64:
+			s = &schema{Type: types{"number"}}
+		case reflect.String:
+			s = &schema{Type: types{"string"}}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				s = &schema{Type: types{"string"}, Format: "byte"}
+			} else {
+				s = &schema{Type: types{"array"}, Items: schemaOf(t.Elem())}
+			}
+			nullable = nullable || t.Kind() == reflect.Slice
+		case reflect.Map:
+			s = &schema{Type: types{"object"}, AdditionalProperties: &additional{schema: schemaOf(t.Elem())}}
+			nullable = true
+		case reflect.Struct:
+			s = structSchema(t)
+		default:
+			return &schema{}
+		}
+	}
+	if nullable {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+func structSchema(t reflect.Type) *schema {
+	s := &schema{Type: types{"object"}, Properties: make(map[string]*schema)}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := structSchema(f.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
@@ -0,0 +1,11 @@
+package eventschema
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var violationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "event_schema_violations_total",
+	Help: "Appended events that didn't match their schema or had none when one is required, by event type.",
+}, []string{"event"})
@@ -0,0 +1,90 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Aggregate rebuilds its state by applying the events of its stream in order
+type Aggregate interface {
+	Apply(e Event) error
+}
+
+// Snapshotter is implemented by aggregates whose state can be snapshotted, so loading
+// them only replays the events recorded after the latest snapshot
+type Snapshotter interface {
+	Aggregate
+	SnapshotState() (any, error)
+	RestoreSnapshot(data json.RawMessage) error
+}
+
+// Repository loads and saves aggregates, taking a snapshot every SnapshotEvery events
+type Repository struct {
+	Store         Store
+	SnapshotEvery int64 // 0 disables snapshots
+}
+
+// Load applies the stream to agg and returns the stream version, 0 for a new stream
+func (r Repository) Load(ctx context.Context, streamID string, agg Aggregate) (int64, error) {
+	var version int64
+
+	if s, ok := agg.(Snapshotter); ok && r.SnapshotEvery > 0 {
+		snap, found, err := r.Store.LoadSnapshot(ctx, streamID)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			if err := s.RestoreSnapshot(snap.Data); err != nil {
+				return 0, err
+			}
+			version = snap.Version
+		}
+	}
+
+	events, err := r.Store.Load(ctx, streamID, version)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range events {
+		if err := agg.Apply(e); err != nil {
+			return 0, err
+		}
+		version = e.Version
+	}
+	return version, nil
+}
+
+// Save appends events produced from an aggregate loaded at expectedVersion, applies them
+// to agg and snapshots it when a snapshot boundary is crossed. Returns the new version.
+func (r Repository) Save(ctx context.Context, streamID string, expectedVersion int64, agg Aggregate, events ...NewEvent) (int64, error) {
+	appended, err := r.Store.Append(ctx, streamID, expectedVersion, events...)
+	if err != nil {
+		return expectedVersion, err
+	}
+
+	version := expectedVersion
+	for _, e := range appended {
+		if err := agg.Apply(e); err != nil {
+			return e.Version, err
+		}
+		version = e.Version
+	}
+
+	s, ok := agg.(Snapshotter)
+	if !ok || r.SnapshotEvery <= 0 || version/r.SnapshotEvery == expectedVersion/r.SnapshotEvery {
+		return version, nil
+	}
+
+	state, err := s.SnapshotState()
+	if err != nil {
+		return version, err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return version, err
+	}
+	// A failed snapshot only slows down future loads, the events are already stored
+	_ = r.Store.SaveSnapshot(ctx, Snapshot{StreamID: streamID, Version: version, Data: data, CreatedAt: time.Now().UTC()})
+	return version, nil
+}
@@ -0,0 +1,173 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// AnyVersion skips the optimistic concurrency check on Append
+const AnyVersion int64 = -1
+
+// ErrConcurrency is returned when a stream was appended to since it was loaded
+var ErrConcurrency = apperrors.NewConflictError("Stream was modified concurrently")
+
+// Event is a recorded fact about a stream. Version is the position within the stream,
+// starting at 1; Position is the global order across all streams.
+type Event struct {
+	ID         string            `json:"id"`
+	StreamID   string            `json:"streamId"`
+	Version    int64             `json:"version"`
+	Position   int64             `json:"position"`
+	Type       string            `json:"type"`
+	Data       json.RawMessage   `json:"data"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	RecordedAt time.Time         `json:"recordedAt"`
+}
+
+// Decode unmarshals the event data into v
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// NewEvent is an event to append
+type NewEvent struct {
+	Type     string
+	Data     any
+	Metadata map[string]string
+}
+
+// Snapshot is the serialized state of an aggregate at a stream version
+type Snapshot struct {
+	StreamID  string          `json:"streamId"`
+	Version   int64           `json:"version"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Store is an append-only event log with per-stream optimistic concurrency
+type Store interface {
+	// Append adds events to a stream if its current version equals expectedVersion,
+	// use 0 for a new stream or AnyVersion to skip the check
+	Append(ctx context.Context, streamID string, expectedVersion int64, events ...NewEvent) ([]Event, error)
+	// Load returns the events of a stream with a version greater than afterVersion
+	Load(ctx context.Context, streamID string, afterVersion int64) ([]Event, error)
+	// ReadAll returns up to limit events of all streams after a global position
+	ReadAll(ctx context.Context, afterPosition int64, limit int) ([]Event, error)
+	// LastPosition returns the global position of the newest event, 0 when empty
+	LastPosition(ctx context.Context) (int64, error)
+	SaveSnapshot(ctx context.Context, s Snapshot) error
+	LoadSnapshot(ctx context.Context, streamID string) (Snapshot, bool, error)
+}
+
+// Build assigns IDs, versions after version and timestamps to new events of a stream
+func Build(streamID string, version int64, events []NewEvent) ([]Event, error) {
+	now := time.Now().UTC()
+	built := make([]Event, len(events))
+	for i, e := range events {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", e.Type, err)
+		}
+		built[i] = Event{
+			ID:         uuid.New().String(),
+			StreamID:   streamID,
+			Version:    version + int64(i) + 1,
+			Type:       e.Type,
+			Data:       data,
+			Metadata:   e.Metadata,
+			RecordedAt: now,
+		}
+	}
+	return built, nil
+}
+
+// MemoryStore is an in-process Store for development and modules that don't need durability
+type MemoryStore struct {
+	mu        sync.RWMutex
+	all       []Event
+	streams   map[string][]int // stream ID -> indexes into all
+	snapshots map[string]Snapshot
+}
+
+// NewMemoryStore creates an empty in-memory event store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		streams:   make(map[string][]int),
+		snapshots: make(map[string]Snapshot),
+	}
+}
+
+func (s *MemoryStore) Append(ctx context.Context, streamID string, expectedVersion int64, events ...NewEvent) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := int64(len(s.streams[streamID]))
+	if expectedVersion != AnyVersion && expectedVersion != current {
+		return nil, ErrConcurrency
+	}
+
+	built, err := Build(streamID, current, events)
+	if err != nil {
+		return nil, err
+	}
+	for i := range built {
+		built[i].Position = int64(len(s.all)) + 1
+		s.streams[streamID] = append(s.streams[streamID], len(s.all))
+		s.all = append(s.all, built[i])
+	}
+	return built, nil
+}
+
+func (s *MemoryStore) Load(ctx context.Context, streamID string, afterVersion int64) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []Event
+	for _, idx := range s.streams[streamID] {
+		if e := s.all[idx]; e.Version > afterVersion {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) ReadAll(ctx context.Context, afterPosition int64, limit int) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if afterPosition >= int64(len(s.all)) {
+		return nil, nil
+	}
+	end := int64(len(s.all))
+	if limit > 0 && afterPosition+int64(limit) < end {
+		end = afterPosition + int64(limit)
+	}
+	return append([]Event(nil), s.all[afterPosition:end]...), nil
+}
+
+func (s *MemoryStore) LastPosition(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.all)), nil
+}
+
+func (s *MemoryStore) SaveSnapshot(ctx context.Context, snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[snap.StreamID] = snap
+	return nil
+}
+
+func (s *MemoryStore) LoadSnapshot(ctx context.Context, streamID string) (Snapshot, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap, ok := s.snapshots[streamID]
+	return snap, ok, nil
+}
@@ -0,0 +1,197 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-api/pkg/database"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLStore keeps events in an append-only events table. The unique (stream_id, version)
+// constraint enforces optimistic concurrency even between instances. Appends on
+// Postgres take a transaction-scoped advisory lock before drawing positions, so
+// positions commit in order and ReadAll never passes one still to be committed;
+// SQLite has one writer anyway.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates an event store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the events and snapshots tables if they do not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS events (
+			position    %s,
+			id          TEXT NOT NULL UNIQUE,
+			stream_id   TEXT NOT NULL,
+			version     BIGINT NOT NULL,
+			type        TEXT NOT NULL,
+			data        TEXT NOT NULL,
+			metadata    TEXT NOT NULL DEFAULT '{}',
+			recorded_at TIMESTAMP NOT NULL,
+			UNIQUE (stream_id, version)
+		);
+		CREATE TABLE IF NOT EXISTS event_snapshots (
+			stream_id  TEXT PRIMARY KEY,
+			version    BIGINT NOT NULL,
+			data       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)`, database.AutoIncrement(s.db)))
+	return err
+}
+
+func (s *SQLStore) Append(ctx context.Context, streamID string, expectedVersion int64, events ...NewEvent) ([]Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := LockAppends(ctx, s.db, tx, "eventstore:events"); err != nil {
+		return nil, err
+	}
+
+	var current int64
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM events WHERE stream_id = $1`, streamID,
+	).Scan(&current); err != nil {
+		return nil, err
+	}
+	if expectedVersion != AnyVersion && expectedVersion != current {
+		return nil, ErrConcurrency
+	}
+
+	built, err := Build(streamID, current, events)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, e := range built {
+		metadata, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO events (id, stream_id, version, type, data, metadata, recorded_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING position`,
+			e.ID, e.StreamID, e.Version, e.Type, string(e.Data), string(metadata), e.RecordedAt,
+		).Scan(&built[i].Position)
+		if isUniqueViolation(err) {
+			// Another writer appended the same version between our read and insert
+			return nil, ErrConcurrency
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return built, tx.Commit()
+}
+
+const selectEvents = `SELECT position, id, stream_id, version, type, data, metadata, recorded_at FROM events`
+
+func (s *SQLStore) Load(ctx context.Context, streamID string, afterVersion int64) ([]Event, error) {
+	return s.query(ctx, selectEvents+` WHERE stream_id = $1 AND version > $2 ORDER BY version`, streamID, afterVersion)
+}
+
+func (s *SQLStore) ReadAll(ctx context.Context, afterPosition int64, limit int) ([]Event, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	return s.query(ctx, selectEvents+` WHERE position > $1 ORDER BY position LIMIT $2`, afterPosition, limit)
+}
+
+func (s *SQLStore) LastPosition(ctx context.Context) (int64, error) {
+	var position int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(position), 0) FROM events`).Scan(&position)
+	return position, err
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var data, metadata string
+		if err := rows.Scan(&e.Position, &e.ID, &e.StreamID, &e.Version, &e.Type, &data, &metadata, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		e.Data = json.RawMessage(data)
+		if err := json.Unmarshal([]byte(metadata), &e.Metadata); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLStore) SaveSnapshot(ctx context.Context, snap Snapshot) error {
+	if snap.CreatedAt.IsZero() {
+		snap.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_snapshots (stream_id, version, data, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (stream_id) DO UPDATE SET
+			version = EXCLUDED.version,
+			data = EXCLUDED.data,
+			created_at = EXCLUDED.created_at`,
+		snap.StreamID, snap.Version, string(snap.Data), snap.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) LoadSnapshot(ctx context.Context, streamID string) (Snapshot, bool, error) {
+	snap := Snapshot{StreamID: streamID}
+	var data string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT version, data, created_at FROM event_snapshots WHERE stream_id = $1`, streamID,
+	).Scan(&snap.Version, &data, &snap.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Snapshot{}, false, nil
+	}
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	snap.Data = json.RawMessage(data)
+	return snap, true, nil
+}
+
+// LockAppends serializes the transactions appending to a table read by position
+// on Postgres, holding an advisory lock named name until tx ends. A BIGSERIAL
+// draws positions when rows are inserted, not when they commit, so without it a
+// reader past position n could miss n-1 committed after.
+func LockAppends(ctx context.Context, db *sql.DB, tx *sql.Tx, name string) error {
+	if database.Dialect(db) != database.Postgres {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, name)
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
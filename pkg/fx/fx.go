@@ -0,0 +1,189 @@
+// Package fx converts money between currencies at exchange rates. Rates come in
+// snapshots, the rates a provider published at one time, each with an ID derived
+// from its content, and every conversion is stamped with the snapshot it used,
+// so an amount converted today can be explained, and converted again the same
+// way, long after the rates moved on.
+package fx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/money"
+)
+
+var (
+	// ErrNoRate is returned for currencies a snapshot has no rate of
+	ErrNoRate = errors.New("fx: no exchange rate")
+	// ErrNoRates is returned before any snapshot was fetched
+	ErrNoRates = errors.New("fx: no exchange rates fetched yet")
+	// ErrSnapshotNotFound is returned for the IDs of unknown snapshots
+	ErrSnapshotNotFound = errors.New("fx: rate snapshot not found")
+)
+
+func init() {
+	apperrors.Register(ErrNoRate, apperrors.CodeValidation)
+	apperrors.Register(ErrSnapshotNotFound, apperrors.CodeNotFound)
+}
+
+// precision is the decimal places rates are kept with, enough for the cross
+// rates of currencies of very different values
+const precision = 15
+
+// Snapshot is the rates of a provider at one time
+type Snapshot struct {
+	ID     string `json:"id"`
+	Source string `json:"source"` // The provider, like ecb
+	Base   string `json:"base"`
+	// Rates are the units of each currency one unit of Base buys, as decimals
+	Rates     map[string]string `json:"rates"`
+	AsOf      time.Time         `json:"asOf"`      // When the provider published them
+	FetchedAt time.Time         `json:"fetchedAt"` // When they were fetched first
+}
+
+// NewSnapshot checks rates are positive decimals and returns their snapshot.
+// Fetching the same rates again yields the same ID.
+func NewSnapshot(source, base string, asOf time.Time, rates map[string]string) (Snapshot, error) {
+	s := Snapshot{Source: source, Base: strings.ToUpper(base), Rates: make(map[string]string, len(rates)),
+		AsOf: asOf.UTC(), FetchedAt: time.Now().UTC()}
+	for code, rate := range rates {
+		r, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+		if !ok || r.Sign() <= 0 {
+			return Snapshot{}, fmt.Errorf("fx: %s rate of %s is %q, want a positive decimal", source, code, rate)
+		}
+		s.Rates[strings.ToUpper(code)] = decimal(r)
+	}
+	delete(s.Rates, s.Base)
+
+	codes := make([]string, 0, len(s.Rates))
+	for code := range s.Rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", s.Source, s.Base, s.AsOf.Format(time.RFC3339))
+	for _, code := range codes {
+		fmt.Fprintf(h, "%s=%s\n", code, s.Rates[code])
+	}
+	s.ID = hex.EncodeToString(h.Sum(nil))[:16]
+	return s, nil
+}
+
+// decimal writes r with at most precision places, without trailing zeros
+func decimal(r *big.Rat) string {
+	s := r.FloatString(precision)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// rate returns the units of a currency one unit of the base buys
+func (s Snapshot) rate(code string) (*big.Rat, error) {
+	if code == s.Base {
+		return big.NewRat(1, 1), nil
+	}
+	if rate, ok := s.Rates[code]; ok {
+		if r, ok := new(big.Rat).SetString(rate); ok {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w for %s in snapshot %s", ErrNoRate, code, s.ID)
+}
+
+// Rate returns the units of to one unit of from buys, crossed through the base
+func (s Snapshot) Rate(from, to string) (string, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return "1", nil
+	}
+	f, err := s.rate(from)
+	if err != nil {
+		return "", err
+	}
+	t, err := s.rate(to)
+	if err != nil {
+		return "", err
+	}
+	return decimal(new(big.Rat).Quo(t, f)), nil
+}
+
+// Rebase returns the rates against another base, as the same snapshot
+func (s Snapshot) Rebase(base string) (Snapshot, error) {
+	base = strings.ToUpper(base)
+	if base == s.Base || base == "" {
+		return s, nil
+	}
+	if _, err := s.rate(base); err != nil {
+		return Snapshot{}, err
+	}
+	rebased := s
+	rebased.Base, rebased.Rates = base, make(map[string]string, len(s.Rates))
+	for _, code := range append([]string{s.Base}, keys(s.Rates)...) {
+		if code == base {
+			continue
+		}
+		rate, err := s.Rate(base, code)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		rebased.Rates[code] = rate
+	}
+	return rebased, nil
+}
+
+func keys(m map[string]string) []string {
+	list := make([]string, 0, len(m))
+	for k := range m {
+		list = append(list, k)
+	}
+	return list
+}
+
+// Conversion is an amount converted, stamped with the rate and snapshot used
+type Conversion struct {
+	From     money.Money `json:"from"`
+	To       money.Money `json:"to"`
+	Rate     string      `json:"rate"`     // Units of To's currency one unit of From's bought
+	Snapshot string      `json:"snapshot"` // ID of the snapshot of the rate
+	AsOf     time.Time   `json:"asOf"`     // Of the snapshot
+}
+
+// Convert exchanges an amount to a currency at the snapshot's rate, rounding
+// half to even to the currency's minor units
+func (s Snapshot) Convert(m money.Money, to string) (Conversion, error) {
+	rate, err := s.Rate(m.Currency().Code, to)
+	if err != nil {
+		return Conversion{}, err
+	}
+	converted, err := m.Convert(to, rate, money.HalfEven)
+	if err != nil {
+		return Conversion{}, err
+	}
+	return Conversion{From: m, To: converted, Rate: rate, Snapshot: s.ID, AsOf: s.AsOf}, nil
+}
+
+// Converter serves the latest rates, and those of past snapshots for checking
+// earlier conversions
+type Converter interface {
+	// Latest returns the newest snapshot, failing with ErrNoRates before the first
+	Latest(ctx context.Context) (Snapshot, error)
+	// Snapshot returns a snapshot by ID, failing with ErrSnapshotNotFound
+	Snapshot(ctx context.Context, id string) (Snapshot, error)
+	// Convert converts an amount at the latest rates
+	Convert(ctx context.Context, m money.Money, to string) (Conversion, error)
+}
+
+// Consumer is implemented by modules handling money in several currencies. The
+// modules are handed the converter of the rates module once loaded.
+type Consumer interface {
+	UseRates(c Converter)
+}
@@ -0,0 +1,136 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Source fetches the current rates of a provider
+type Source interface {
+	Fetch(ctx context.Context) (Snapshot, error)
+}
+
+// ECB fetches the euro reference rates of the European Central Bank, published
+// once a working day around 16:00 CET, for about 30 currencies
+type ECB struct {
+	URL    string // https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml by default
+	Client *http.Client
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Cube struct {
+			Time  string `xml:"time,attr"` // Like 2026-10-13
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+func (e *ECB) Fetch(ctx context.Context) (Snapshot, error) {
+	endpoint := e.URL
+	if endpoint == "" {
+		endpoint = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+	}
+	resp, err := get(ctx, e.Client, endpoint)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer resp.Body.Close()
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return Snapshot{}, fmt.Errorf("fx: ecb: %w", err)
+	}
+	day := envelope.Cube.Cube
+	asOf, err := time.Parse(time.DateOnly, day.Time)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("fx: ecb: date %q: %w", day.Time, err)
+	}
+	rates := make(map[string]string, len(day.Rates))
+	for _, r := range day.Rates {
+		rates[r.Currency] = r.Rate
+	}
+	if len(rates) == 0 {
+		return Snapshot{}, fmt.Errorf("fx: ecb: no rates on %s", day.Time)
+	}
+	return NewSnapshot("ecb", "EUR", asOf, rates)
+}
+
+// OpenExchangeRates fetches the latest rates of Open Exchange Rates, against
+// USD unless the plan allows another base
+type OpenExchangeRates struct {
+	AppID  string
+	Base   string
+	URL    string // https://openexchangerates.org/api/latest.json by default
+	Client *http.Client
+}
+
+func (o *OpenExchangeRates) Fetch(ctx context.Context) (Snapshot, error) {
+	endpoint := o.URL
+	if endpoint == "" {
+		endpoint = "https://openexchangerates.org/api/latest.json"
+	}
+	params := url.Values{"app_id": {o.AppID}}
+	if o.Base != "" {
+		params.Set("base", o.Base)
+	}
+	resp, err := get(ctx, o.Client, endpoint+"?"+params.Encode())
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Timestamp int64                  `json:"timestamp"`
+		Base      string                 `json:"base"`
+		Rates     map[string]json.Number `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Snapshot{}, fmt.Errorf("fx: openexchangerates: %w", err)
+	}
+	rates := make(map[string]string, len(body.Rates))
+	for code, r := range body.Rates {
+		rates[code] = r.String()
+	}
+	return NewSnapshot("openexchangerates", body.Base, time.Unix(body.Timestamp, 0), rates)
+}
+
+// Static serves fixed rates, for development and tests. They are as of when
+// the source was created.
+type Static struct {
+	snapshot Snapshot
+	err      error
+}
+
+// NewStatic creates a source always fetching rates against base
+func NewStatic(base string, rates map[string]string) *Static {
+	s, err := NewSnapshot("static", base, time.Now(), rates)
+	return &Static{snapshot: s, err: err}
+}
+
+func (s *Static) Fetch(ctx context.Context) (Snapshot, error) {
+	return s.snapshot, s.err
+}
+
+func get(ctx context.Context, client *http.Client, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fx: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fx: %s: unexpected status %d", strings.SplitN(endpoint, "?", 2)[0], resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,163 @@
+package geo
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// ErrInvalidAddress is wrapped by AddressError
+var ErrInvalidAddress = errors.New("geo: invalid address")
+
+func init() {
+	apperrors.Register(ErrInvalidAddress, apperrors.CodeValidation)
+}
+
+// Address is a postal address. Stored and compared normalized, see
+// NormalizeAddress, so the same address typed twice is stored once.
+type Address struct {
+	Street     string `json:"street"`               // Street and house number, like 221B Baker Street
+	Unit       string `json:"unit,omitempty"`       // Apartment, suite or floor
+	City       string `json:"city"`                 // City, town or village
+	Region     string `json:"region,omitempty"`     // State, province or county
+	PostalCode string `json:"postalCode,omitempty"` // Uppercase, like NW1 6XE
+	Country    string `json:"country"`              // ISO 3166-1 alpha-2 code, like GB
+}
+
+// NormalizeAddress trims the fields of an address and collapses their runs of
+// spaces, and uppercases the country and postal code
+func NormalizeAddress(a Address) Address {
+	clean := func(s string) string { return strings.Join(strings.Fields(s), " ") }
+	return Address{
+		Street:     clean(a.Street),
+		Unit:       clean(a.Unit),
+		City:       clean(a.City),
+		Region:     clean(a.Region),
+		PostalCode: strings.ToUpper(clean(a.PostalCode)),
+		Country:    strings.ToUpper(clean(a.Country)),
+	}
+}
+
+// String returns the address on one line, the way it is looked up by geocoders
+func (a Address) String() string {
+	var parts []string
+	for _, s := range []string{a.Street, a.Unit, a.City, a.Region, strings.TrimSpace(a.PostalCode + " " + a.Country)} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Key returns the address normalized and lowercased on one line, for finding
+// the same address stored before or cached
+func (a Address) Key() string {
+	return strings.ToLower(NormalizeAddress(a).String())
+}
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// postalCodes are the formats of the postal codes of countries, normalized. The
+// postal codes of other countries are only checked for being short.
+var postalCodes = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"BR": regexp.MustCompile(`^\d{5}-?\d{3}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"IN": regexp.MustCompile(`^\d{6}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"NO": regexp.MustCompile(`^\d{4}$`),
+	"PL": regexp.MustCompile(`^\d{2}-\d{3}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"SE": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+}
+
+// AddressError lists what is wrong with an address
+type AddressError struct {
+	Fields []apperrors.FieldError
+}
+
+func (e *AddressError) Error() string {
+	list := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		list[i] = f.Message
+	}
+	return ErrInvalidAddress.Error() + ": " + strings.Join(list, "; ")
+}
+
+func (e *AddressError) Unwrap() error { return ErrInvalidAddress }
+
+// FieldErrors describes each problem for the validation error details
+func (e *AddressError) FieldErrors() []apperrors.FieldError { return e.Fields }
+
+// Validate checks a normalized address has a street, city and country, and a
+// postal code of the country's format, returning an *AddressError otherwise
+func (a Address) Validate() error {
+	var fields []apperrors.FieldError
+	problem := func(field, rule, message string) {
+		fields = append(fields, apperrors.FieldError{Pointer: "/" + field, Field: field, Rule: rule, Message: message})
+	}
+	for _, f := range []struct{ name, value string }{{"street", a.Street}, {"city", a.City}, {"country", a.Country}} {
+		if f.value == "" {
+			problem(f.name, "required", f.name+" is required")
+		}
+	}
+	for _, f := range []struct{ name, value string }{{"street", a.Street}, {"unit", a.Unit}, {"city", a.City}, {"region", a.Region}} {
+		if len(f.value) > 200 {
+			problem(f.name, "max", f.name+" must be at most 200 characters")
+		}
+	}
+	if a.Country != "" && !countryPattern.MatchString(a.Country) {
+		problem("country", "iso3166_1_alpha2", "country must be a two-letter ISO 3166-1 code, like GB")
+	}
+	pattern, known := postalCodes[a.Country]
+	switch {
+	case known && a.PostalCode == "":
+		problem("postalCode", "required", "postalCode is required in "+a.Country)
+	case known && !pattern.MatchString(a.PostalCode):
+		problem("postalCode", "postcode", "postalCode is not a postal code of "+a.Country)
+	case len(a.PostalCode) > 12:
+		problem("postalCode", "max", "postalCode must be at most 12 characters")
+	}
+	if len(fields) > 0 {
+		return &AddressError{Fields: fields}
+	}
+	return nil
+}
+
+// Value stores the address normalized, as JSON in a text column
+func (a Address) Value() (driver.Value, error) {
+	raw, err := json.Marshal(NormalizeAddress(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func (a *Address) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = Address{}
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case []byte:
+		return json.Unmarshal(v, a)
+	}
+	return fmt.Errorf("geo: can't scan %T into an address", src)
+}
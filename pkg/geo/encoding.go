@@ -0,0 +1,210 @@
+package geo
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// geoJSON is a GeoJSON geometry, whose positions are [lng, lat]
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// MarshalJSON writes the point as a GeoJSON Point
+func (p Point) MarshalJSON() ([]byte, error) {
+	coordinates, err := json.Marshal([2]float64{p.Lng, p.Lat})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(geoJSON{"Point", coordinates})
+}
+
+func (p *Point) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var v geoJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var position []float64
+	if v.Type != "Point" || json.Unmarshal(v.Coordinates, &position) != nil || len(position) < 2 {
+		return fmt.Errorf("%w: want a GeoJSON Point, coordinates [lng, lat]", ErrInvalidPoint)
+	}
+	parsed := Point{Lat: position[1], Lng: position[0]}
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// MarshalJSON writes the polygon as a GeoJSON Polygon
+func (pg Polygon) MarshalJSON() ([]byte, error) {
+	rings := make([][][2]float64, len(pg))
+	for i, ring := range pg {
+		rings[i] = make([][2]float64, len(ring))
+		for j, p := range ring {
+			rings[i][j] = [2]float64{p.Lng, p.Lat}
+		}
+	}
+	coordinates, err := json.Marshal(rings)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(geoJSON{"Polygon", coordinates})
+}
+
+func (pg *Polygon) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var v geoJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var rings [][][]float64
+	if v.Type != "Polygon" || json.Unmarshal(v.Coordinates, &rings) != nil {
+		return fmt.Errorf("%w: want a GeoJSON Polygon, coordinates [[[lng, lat], ...]]", ErrInvalidPolygon)
+	}
+	parsed := make(Polygon, len(rings))
+	for i, ring := range rings {
+		parsed[i] = make([]Point, len(ring))
+		for j, position := range ring {
+			if len(position) < 2 {
+				return fmt.Errorf("%w: ring %d has a position without a latitude", ErrInvalidPolygon, i)
+			}
+			parsed[i][j] = Point{Lat: position[1], Lng: position[0]}
+		}
+	}
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+	*pg = parsed
+	return nil
+}
+
+// WKT returns the point as well-known text, POINT(lng lat)
+func (p Point) WKT() string {
+	return "POINT(" + position(p) + ")"
+}
+
+// WKT returns the polygon as well-known text, POLYGON((lng lat, ...), ...)
+func (pg Polygon) WKT() string {
+	rings := make([]string, len(pg))
+	for i, ring := range pg {
+		positions := make([]string, len(ring))
+		for j, p := range ring {
+			positions[j] = position(p)
+		}
+		rings[i] = "(" + strings.Join(positions, ", ") + ")"
+	}
+	return "POLYGON(" + strings.Join(rings, ", ") + ")"
+}
+
+func position(p Point) string {
+	return strconv.FormatFloat(p.Lng, 'f', -1, 64) + " " + strconv.FormatFloat(p.Lat, 'f', -1, 64)
+}
+
+// Value stores the point as extended WKT, SRID=4326;POINT(lng lat), which a text
+// column keeps as is and a PostGIS geometry or geography column reads
+func (p Point) Value() (driver.Value, error) {
+	return "SRID=" + strconv.Itoa(SRID) + ";" + p.WKT(), nil
+}
+
+// Scan reads WKT, with or without an SRID, like that of ST_AsText or
+// ST_AsEWKT. PostGIS columns have to be selected through either, as they are
+// returned as binary otherwise.
+func (p *Point) Scan(src any) error {
+	body, err := scanWKT(src, "POINT")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPoint, err)
+	}
+	parsed, err := parsePosition(body)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// Value stores the polygon as extended WKT, like Point's. A nil polygon is NULL.
+func (pg Polygon) Value() (driver.Value, error) {
+	if pg == nil {
+		return nil, nil
+	}
+	return "SRID=" + strconv.Itoa(SRID) + ";" + pg.WKT(), nil
+}
+
+// Scan reads WKT like Point's, NULL as a nil polygon
+func (pg *Polygon) Scan(src any) error {
+	if src == nil {
+		*pg = nil
+		return nil
+	}
+	body, err := scanWKT(src, "POLYGON")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPolygon, err)
+	}
+	var parsed Polygon
+	for _, ring := range strings.Split(body, "),") {
+		ring = strings.Trim(strings.TrimSpace(ring), "()")
+		var points []Point
+		for _, pos := range strings.Split(ring, ",") {
+			p, err := parsePosition(pos)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidPolygon, err)
+			}
+			points = append(points, p)
+		}
+		parsed = append(parsed, points)
+	}
+	*pg = parsed
+	return nil
+}
+
+// scanWKT returns what is between the parentheses following the keyword of the
+// WKT of a geometry
+func scanWKT(src any, keyword string) (string, error) {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return "", fmt.Errorf("can't scan %T", src)
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToUpper(s), "SRID=") {
+		_, s, _ = strings.Cut(s, ";")
+	}
+	body, ok := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(s)), keyword)
+	body = strings.TrimSpace(body)
+	if !ok || !strings.HasPrefix(body, "(") || !strings.HasSuffix(body, ")") {
+		return "", fmt.Errorf("%q is not the WKT of a %s", s, strings.ToLower(keyword))
+	}
+	return body[1 : len(body)-1], nil
+}
+
+// parsePosition reads the "lng lat" of WKT
+func parsePosition(s string) (Point, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return Point{}, fmt.Errorf("%w: %q is not a position, want lng lat", ErrInvalidPoint, s)
+	}
+	lng, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("%w: %q is not a position, want lng lat", ErrInvalidPoint, s)
+	}
+	lat, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("%w: %q is not a position, want lng lat", ErrInvalidPoint, s)
+	}
+	p := Point{Lat: lat, Lng: lng}
+	return p, p.Validate()
+}
@@ -0,0 +1,114 @@
+// Package geo handles locations on the earth: points and polygons in WGS 84
+// longitude and latitude, the coordinates of GPS and of PostGIS's SRID 4326. They
+// are read and written as GeoJSON, stored as WKT text, which PostGIS columns take
+// too, and measured on a sphere, close enough to the earth for finding what is
+// nearby. Postal addresses are normalized for storing and checked for the format
+// of their country, and geocoders of Google or Nominatim locate them, with
+// caching and the rate the provider allows.
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// EarthRadius is the mean radius of the earth in meters
+const EarthRadius = 6371008.8
+
+// SRID is the spatial reference of the coordinates, for PostGIS
+const SRID = 4326
+
+var (
+	ErrInvalidPoint   = errors.New("geo: invalid point")
+	ErrInvalidPolygon = errors.New("geo: invalid polygon")
+)
+
+// Handlers returning these errors respond with a validation error
+func init() {
+	for _, err := range []error{ErrInvalidPoint, ErrInvalidPolygon} {
+		apperrors.Register(err, apperrors.CodeValidation)
+	}
+}
+
+// Point is a location in degrees
+type Point struct {
+	Lat float64 // -90 to 90, north positive
+	Lng float64 // -180 to 180, east positive
+}
+
+// Validate reports whether the coordinates are on the earth
+func (p Point) Validate() error {
+	if math.IsNaN(p.Lat) || math.IsNaN(p.Lng) || p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 {
+		return fmt.Errorf("%w: %g,%g is not a latitude and longitude", ErrInvalidPoint, p.Lat, p.Lng)
+	}
+	return nil
+}
+
+// String returns the point as lat,lng, the way ParsePoint reads it
+func (p Point) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lng, 'f', -1, 64)
+}
+
+// ParsePoint reads a point written lat,lng, like 52.37,4.89, the order maps and
+// query strings use
+func ParsePoint(s string) (Point, error) {
+	lat, lng, ok := strings.Cut(s, ",")
+	if !ok {
+		return Point{}, fmt.Errorf("%w %q, want lat,lng", ErrInvalidPoint, s)
+	}
+	var p Point
+	var err error
+	if p.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+		return Point{}, fmt.Errorf("%w %q, want lat,lng", ErrInvalidPoint, s)
+	}
+	if p.Lng, err = strconv.ParseFloat(strings.TrimSpace(lng), 64); err != nil {
+		return Point{}, fmt.Errorf("%w %q, want lat,lng", ErrInvalidPoint, s)
+	}
+	return p, p.Validate()
+}
+
+// Distance returns the great-circle distance between two points in meters, by the
+// haversine formula
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat, dLng := lat2-lat1, radians(b.Lng-a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+
+// Box is a range of latitudes and longitudes
+type Box struct {
+	MinLat, MinLng float64
+	MaxLat, MaxLng float64
+}
+
+// Contains reports whether a point is in the box, edges included
+func (b Box) Contains(p Point) bool {
+	return p.Lat >= b.MinLat && p.Lat <= b.MaxLat && p.Lng >= b.MinLng && p.Lng <= b.MaxLng
+}
+
+// Around returns a box holding every point within radius meters of center, for
+// narrowing a search down with plain comparisons before measuring distances. It
+// takes every longitude when the circle reaches a pole or crosses the 180th
+// meridian, the box being larger than the circle rather than split in two.
+func Around(center Point, radius float64) Box {
+	dLat := radius / EarthRadius * 180 / math.Pi
+	b := Box{MinLat: center.Lat - dLat, MaxLat: center.Lat + dLat, MinLng: -180, MaxLng: 180}
+	if b.MinLat <= -90 || b.MaxLat >= 90 {
+		b.MinLat, b.MaxLat = math.Max(b.MinLat, -90), math.Min(b.MaxLat, 90)
+		return b
+	}
+	// The widest circle of latitude the circle reaches
+	dLng := math.Asin(math.Min(1, math.Sin(radius/EarthRadius)/math.Cos(radians(center.Lat)))) * 180 / math.Pi
+	if center.Lng-dLng >= -180 && center.Lng+dLng <= 180 {
+		b.MinLng, b.MaxLng = center.Lng-dLng, center.Lng+dLng
+	}
+	return b
+}
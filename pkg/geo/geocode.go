@@ -0,0 +1,201 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/pkg/cache"
+	apperrors "go-api/pkg/errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when a lookup would have to wait longer for the
+// provider's rate than its context allows
+var ErrRateLimited = errors.New("geo: geocoding rate exceeded")
+
+func init() {
+	apperrors.Register(ErrRateLimited, apperrors.CodeTooManyRequests)
+}
+
+// How precisely a match locates what was looked up
+const (
+	PrecisionExact  = "exact"  // The building
+	PrecisionStreet = "street" // A point on the street, interpolated between known numbers
+	PrecisionArea   = "area"   // The center of a postal code, city or region
+)
+
+// Match is a place a geocoder found
+type Match struct {
+	Address   Address `json:"address"` // Normalized; fields the provider doesn't know are empty
+	Formatted string  `json:"formatted"`
+	Point     Point   `json:"point"`
+	Precision string  `json:"precision"`
+	PlaceID   string  `json:"placeId,omitempty"` // The provider's, for linking to its maps
+}
+
+// Geocoder finds places by address and addresses by place. Matches come best
+// first; no match is an empty list, not an error.
+type Geocoder interface {
+	Geocode(ctx context.Context, query string) ([]Match, error)
+	Reverse(ctx context.Context, p Point) ([]Match, error)
+}
+
+// GeocoderConfig selects the geocoding provider and how much it is used
+type GeocoderConfig struct {
+	Provider  string `yaml:"provider"` // google or nominatim; geocoding is off without one
+	APIKey    string `yaml:"apiKey"`   // Google's
+	URL       string `yaml:"url"`      // Of a self-hosted Nominatim; the public one by default
+	UserAgent string `yaml:"userAgent"`
+	// Timeout bounds a lookup, including the wait for the rate
+	Timeout           time.Duration `yaml:"timeout"`
+	RequestsPerSecond float64       `yaml:"requestsPerSecond"` // To the provider, by every caller together
+	Burst             int           `yaml:"burst"`
+	CacheTTL          time.Duration `yaml:"cacheTTL"` // Of the matches of a lookup; not cached when 0
+}
+
+var lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "geocoder_lookups_total",
+	Help: "Geocoding lookups, by provider and result: cached, found, none, limited or error.",
+}, []string{"provider", "result"})
+
+// NewGeocoder creates the configured provider's geocoder, caching its matches in
+// c, which may be nil, and keeping to its rate. It returns nil when no provider is
+// configured.
+func NewGeocoder(cfg GeocoderConfig, c cache.Cache) (Geocoder, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "go-api"
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	var provider Geocoder
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "google":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("geo: the google geocoder needs an API key")
+		}
+		provider = &Google{Key: cfg.APIKey, URL: cfg.URL, Client: client}
+	case "nominatim":
+		// The public instance allows a request per second
+		if cfg.RequestsPerSecond <= 0 && cfg.URL == "" {
+			cfg.RequestsPerSecond = 1
+		}
+		provider = &Nominatim{URL: cfg.URL, UserAgent: cfg.UserAgent, Client: client}
+	default:
+		return nil, fmt.Errorf("geo: unknown geocoder %q, want google or nominatim", cfg.Provider)
+	}
+	if cfg.RequestsPerSecond <= 0 {
+		cfg.RequestsPerSecond = 10
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	return &geocoder{cfg: cfg, provider: provider, cache: c, limiter: rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), cfg.Burst)}, nil
+}
+
+// geocoder caches the matches of a provider and keeps to its rate
+type geocoder struct {
+	cfg      GeocoderConfig
+	provider Geocoder
+	cache    cache.Cache
+	limiter  *rate.Limiter
+}
+
+func (g *geocoder) Geocode(ctx context.Context, query string) ([]Match, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" {
+		return []Match{}, nil
+	}
+	return g.lookup(ctx, "geocode:"+g.cfg.Provider+":"+strings.ToLower(query), func(ctx context.Context) ([]Match, error) {
+		return g.provider.Geocode(ctx, query)
+	})
+}
+
+func (g *geocoder) Reverse(ctx context.Context, p Point) ([]Match, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	// Rounded to about a meter, so that nearly the same point hits the cache
+	key := "geocode:" + g.cfg.Provider + ":reverse:" + strconv.FormatFloat(p.Lat, 'f', 5, 64) + "," +
+		strconv.FormatFloat(p.Lng, 'f', 5, 64)
+	return g.lookup(ctx, key, func(ctx context.Context) ([]Match, error) {
+		return g.provider.Reverse(ctx, p)
+	})
+}
+
+// lookup returns the cached matches under key, or those of find once the rate
+// allows
+func (g *geocoder) lookup(ctx context.Context, key string, find func(context.Context) ([]Match, error)) ([]Match, error) {
+	if g.cache != nil && g.cfg.CacheTTL > 0 {
+		if raw, ok, err := g.cache.Get(ctx, key); err == nil && ok {
+			var cached []Match
+			if json.Unmarshal(raw, &cached) == nil {
+				lookups.WithLabelValues(g.cfg.Provider, "cached").Inc()
+				return cached, nil
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.Timeout)
+	defer cancel()
+	if err := g.limiter.Wait(ctx); err != nil {
+		lookups.WithLabelValues(g.cfg.Provider, "limited").Inc()
+		return nil, ErrRateLimited
+	}
+	matches, err := find(ctx)
+	if errors.Is(err, ErrRateLimited) {
+		lookups.WithLabelValues(g.cfg.Provider, "limited").Inc()
+		return nil, err
+	}
+	if err != nil {
+		lookups.WithLabelValues(g.cfg.Provider, "error").Inc()
+		return nil, fmt.Errorf("geo: %s geocoder: %w", g.cfg.Provider, err)
+	}
+	if len(matches) == 0 {
+		lookups.WithLabelValues(g.cfg.Provider, "none").Inc()
+		matches = []Match{}
+	} else {
+		lookups.WithLabelValues(g.cfg.Provider, "found").Inc()
+	}
+	if g.cache != nil && g.cfg.CacheTTL > 0 {
+		if raw, err := json.Marshal(matches); err == nil {
+			g.cache.Set(ctx, key, raw, g.cfg.CacheTTL)
+		}
+	}
+	return matches, nil
+}
+
+// getJSON decodes the response of a GET request to a provider into v
+func getJSON(ctx context.Context, client *http.Client, url, userAgent string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
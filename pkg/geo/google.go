@@ -0,0 +1,121 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// Google geocodes with the Google Maps Geocoding API
+type Google struct {
+	Key    string
+	URL    string // Of the API, https://maps.googleapis.com/maps/api/geocode/json by default
+	Client *http.Client
+}
+
+// googleResponse is the response of the Geocoding API
+type googleResponse struct {
+	Status       string `json:"status"` // OK, ZERO_RESULTS, OVER_QUERY_LIMIT, REQUEST_DENIED, ...
+	ErrorMessage string `json:"error_message"`
+	Results      []struct {
+		FormattedAddress  string `json:"formatted_address"`
+		PlaceID           string `json:"place_id"`
+		AddressComponents []struct {
+			LongName  string   `json:"long_name"`
+			ShortName string   `json:"short_name"`
+			Types     []string `json:"types"`
+		} `json:"address_components"`
+		Geometry struct {
+			Location struct {
+				Lat float64 `json:"lat"`
+				Lng float64 `json:"lng"`
+			} `json:"location"`
+			LocationType string `json:"location_type"` // ROOFTOP, RANGE_INTERPOLATED, GEOMETRIC_CENTER or APPROXIMATE
+		} `json:"geometry"`
+	} `json:"results"`
+}
+
+func (g *Google) Geocode(ctx context.Context, query string) ([]Match, error) {
+	return g.get(ctx, url.Values{"address": {query}})
+}
+
+func (g *Google) Reverse(ctx context.Context, p Point) ([]Match, error) {
+	return g.get(ctx, url.Values{"latlng": {p.String()}})
+}
+
+func (g *Google) get(ctx context.Context, params url.Values) ([]Match, error) {
+	endpoint := g.URL
+	if endpoint == "" {
+		endpoint = "https://maps.googleapis.com/maps/api/geocode/json"
+	}
+	params.Set("key", g.Key)
+	var resp googleResponse
+	if err := getJSON(ctx, g.Client, endpoint+"?"+params.Encode(), "", &resp); err != nil {
+		return nil, err
+	}
+	switch resp.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return nil, nil
+	case "OVER_QUERY_LIMIT":
+		return nil, ErrRateLimited
+	default:
+		return nil, errors.New(resp.Status + ": " + resp.ErrorMessage)
+	}
+
+	matches := make([]Match, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		var number, route string
+		var a Address
+		for _, c := range r.AddressComponents {
+			switch {
+			case slices.Contains(c.Types, "street_number"):
+				number = c.LongName
+			case slices.Contains(c.Types, "route"):
+				route = c.LongName
+			case slices.Contains(c.Types, "subpremise"):
+				a.Unit = c.LongName
+			case slices.Contains(c.Types, "locality"), slices.Contains(c.Types, "postal_town") && a.City == "":
+				a.City = c.LongName
+			case slices.Contains(c.Types, "administrative_area_level_1"):
+				a.Region = c.ShortName
+			case slices.Contains(c.Types, "postal_code"):
+				a.PostalCode = c.LongName
+			case slices.Contains(c.Types, "country"):
+				a.Country = c.ShortName
+			}
+		}
+		a.Street = street(a.Country, route, number)
+		precision := PrecisionArea
+		switch r.Geometry.LocationType {
+		case "ROOFTOP":
+			precision = PrecisionExact
+		case "RANGE_INTERPOLATED":
+			precision = PrecisionStreet
+		}
+		p := Point{Lat: r.Geometry.Location.Lat, Lng: r.Geometry.Location.Lng}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("result %q: %w", r.FormattedAddress, err)
+		}
+		matches = append(matches, Match{Address: NormalizeAddress(a), Formatted: r.FormattedAddress, Point: p,
+			Precision: precision, PlaceID: r.PlaceID})
+	}
+	return matches, nil
+}
+
+// numberFirst are the countries writing the house number before the street name
+var numberFirst = []string{"AU", "CA", "FR", "GB", "IE", "IN", "NZ", "US", "ZA"}
+
+// street joins a street name and house number the way the country writes them
+func street(country, route, number string) string {
+	switch {
+	case route == "" || number == "":
+		return route
+	case slices.Contains(numberFirst, country):
+		return number + " " + route
+	}
+	return route + " " + number
+}
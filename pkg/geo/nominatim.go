@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Nominatim geocodes with OpenStreetMap's Nominatim. The public instance asks
+// for a User-Agent naming the application and at most a request per second.
+type Nominatim struct {
+	URL       string // Of the instance, https://nominatim.openstreetmap.org by default
+	UserAgent string
+	Client    *http.Client
+}
+
+// nominatimPlace is a result of the search and reverse endpoints, in jsonv2
+type nominatimPlace struct {
+	PlaceID     int64  `json:"place_id"`
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+	PlaceRank   int    `json:"place_rank"` // 30 for buildings, 26 and up for streets
+	Address     struct {
+		HouseNumber string `json:"house_number"`
+		Road        string `json:"road"`
+		Pedestrian  string `json:"pedestrian"`
+		City        string `json:"city"`
+		Town        string `json:"town"`
+		Village     string `json:"village"`
+		Hamlet      string `json:"hamlet"`
+		State       string `json:"state"`
+		Postcode    string `json:"postcode"`
+		CountryCode string `json:"country_code"`
+	} `json:"address"`
+	Error string `json:"error"` // Of reverse, when nothing is there
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, query string) ([]Match, error) {
+	var places []nominatimPlace
+	params := url.Values{"q": {query}, "format": {"jsonv2"}, "addressdetails": {"1"}, "limit": {"5"}}
+	if err := getJSON(ctx, n.Client, n.endpoint("/search")+"?"+params.Encode(), n.UserAgent, &places); err != nil {
+		return nil, err
+	}
+	return n.matches(places)
+}
+
+func (n *Nominatim) Reverse(ctx context.Context, p Point) ([]Match, error) {
+	var place nominatimPlace
+	params := url.Values{
+		"lat": {strconv.FormatFloat(p.Lat, 'f', -1, 64)}, "lon": {strconv.FormatFloat(p.Lng, 'f', -1, 64)},
+		"format": {"jsonv2"}, "addressdetails": {"1"},
+	}
+	if err := getJSON(ctx, n.Client, n.endpoint("/reverse")+"?"+params.Encode(), n.UserAgent, &place); err != nil {
+		return nil, err
+	}
+	if place.Error != "" {
+		return nil, nil
+	}
+	return n.matches([]nominatimPlace{place})
+}
+
+func (n *Nominatim) endpoint(path string) string {
+	base := n.URL
+	if base == "" {
+		base = "https://nominatim.openstreetmap.org"
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+func (n *Nominatim) matches(places []nominatimPlace) ([]Match, error) {
+	matches := make([]Match, 0, len(places))
+	for _, pl := range places {
+		lat, err := strconv.ParseFloat(pl.Lat, 64)
+		if err != nil {
+			return nil, fmt.Errorf("result %q: latitude %q: %w", pl.DisplayName, pl.Lat, err)
+		}
+		lng, err := strconv.ParseFloat(pl.Lon, 64)
+		if err != nil {
+			return nil, fmt.Errorf("result %q: longitude %q: %w", pl.DisplayName, pl.Lon, err)
+		}
+		ad := pl.Address
+		a := Address{Region: ad.State, PostalCode: ad.Postcode, Country: ad.CountryCode}
+		for _, city := range []string{ad.City, ad.Town, ad.Village, ad.Hamlet} {
+			if city != "" {
+				a.City = city
+				break
+			}
+		}
+		road := ad.Road
+		if road == "" {
+			road = ad.Pedestrian
+		}
+		a.Street = street(strings.ToUpper(a.Country), road, ad.HouseNumber)
+		precision := PrecisionArea
+		switch {
+		case pl.PlaceRank >= 30:
+			precision = PrecisionExact
+		case pl.PlaceRank >= 26:
+			precision = PrecisionStreet
+		}
+		matches = append(matches, Match{Address: NormalizeAddress(a), Formatted: pl.DisplayName, Point: Point{Lat: lat, Lng: lng},
+			Precision: precision, PlaceID: strconv.FormatInt(pl.PlaceID, 10)})
+	}
+	return matches, nil
+}
@@ -0,0 +1,71 @@
+package geo
+
+import "fmt"
+
+// Polygon is an area bounded by rings of points: the first its outline, any
+// others holes in it. Rings are closed, their last point the same as the first.
+// Edges are straight lines of latitude and longitude, which covers areas like
+// neighborhoods and delivery zones well, not those spanning the 180th meridian.
+type Polygon [][]Point
+
+// Validate reports whether each ring is closed, with at least three corners, on
+// the earth
+func (pg Polygon) Validate() error {
+	if len(pg) == 0 {
+		return fmt.Errorf("%w: it has no outline", ErrInvalidPolygon)
+	}
+	for i, ring := range pg {
+		if len(ring) < 4 {
+			return fmt.Errorf("%w: ring %d has fewer than 3 corners", ErrInvalidPolygon, i)
+		}
+		if ring[0] != ring[len(ring)-1] {
+			return fmt.Errorf("%w: ring %d isn't closed, it ends where it doesn't start", ErrInvalidPolygon, i)
+		}
+		for _, p := range ring {
+			if err := p.Validate(); err != nil {
+				return fmt.Errorf("%w: ring %d: %w", ErrInvalidPolygon, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Contains reports whether a point is inside the outline and outside the holes
+func (pg Polygon) Contains(p Point) bool {
+	if len(pg) == 0 || !inRing(pg[0], p) {
+		return false
+	}
+	for _, hole := range pg[1:] {
+		if inRing(hole, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Bounds returns the box the outline fits in
+func (pg Polygon) Bounds() Box {
+	if len(pg) == 0 || len(pg[0]) == 0 {
+		return Box{}
+	}
+	first := pg[0][0]
+	b := Box{MinLat: first.Lat, MaxLat: first.Lat, MinLng: first.Lng, MaxLng: first.Lng}
+	for _, p := range pg[0][1:] {
+		b.MinLat, b.MaxLat = min(b.MinLat, p.Lat), max(b.MaxLat, p.Lat)
+		b.MinLng, b.MaxLng = min(b.MinLng, p.Lng), max(b.MaxLng, p.Lng)
+	}
+	return b
+}
+
+// inRing casts a ray from p along its latitude, which crosses the edges of a ring
+// an odd number of times when p is inside it
+func inRing(ring []Point, p Point) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) && p.Lng < a.Lng+(p.Lat-a.Lat)*(b.Lng-a.Lng)/(b.Lat-a.Lat) {
+			inside = !inside
+		}
+	}
+	return inside
+}
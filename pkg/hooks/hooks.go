@@ -0,0 +1,131 @@
+// Package hooks lets code outside this repository extend the service lifecycle
+// without forking it. A module registers hooks from an init function and is linked
+// in with a blank import in cmd/go-api:
+//
+//	func init() {
+//		hooks.OnStartup("billing", billing.Connect)
+//		hooks.PreRequest("billing", billing.Meter)
+//	}
+//
+// Hooks of each kind run in registration order, shutdown hooks in reverse.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type hook[F any] struct {
+	name string
+	fn   F
+}
+
+var (
+	mu           sync.RWMutex
+	startup      []hook[func(context.Context) error]
+	shutdown     []hook[func(context.Context) error]
+	preRequest   []hook[gin.HandlerFunc]
+	postResponse []hook[gin.HandlerFunc]
+	onError      []hook[func(*gin.Context, error)]
+)
+
+// OnStartup runs fn before the server starts listening. An error stops startup.
+func OnStartup(name string, fn func(ctx context.Context) error) {
+	register(&startup, name, fn)
+}
+
+// OnShutdown runs fn after the server has stopped serving
+func OnShutdown(name string, fn func(ctx context.Context) error) {
+	register(&shutdown, name, fn)
+}
+
+// PreRequest runs fn before the route handler. It mustn't call c.Next; aborting the
+// context, for example with c.AbortWithStatus, skips the handler and the remaining
+// pre-request hooks.
+func PreRequest(name string, fn gin.HandlerFunc) {
+	register(&preRequest, name, fn)
+}
+
+// PostResponse runs fn after the handler has returned. Errors attached with c.Error
+// are still to be rendered by ErrorHandler at that point.
+func PostResponse(name string, fn gin.HandlerFunc) {
+	register(&postResponse, name, fn)
+}
+
+// OnError runs fn for requests that ended with an error attached by c.Error, before
+// post-response hooks
+func OnError(name string, fn func(c *gin.Context, err error)) {
+	register(&onError, name, fn)
+}
+
+func register[F any](hooks *[]hook[F], name string, fn F) {
+	mu.Lock()
+	defer mu.Unlock()
+	*hooks = append(*hooks, hook[F]{name: name, fn: fn})
+}
+
+// Startup runs the startup hooks, stopping at the first error
+func Startup(ctx context.Context) error {
+	mu.RLock()
+	list := slices.Clone(startup)
+	mu.RUnlock()
+	for _, h := range list {
+		if err := h.fn(ctx); err != nil {
+			return fmt.Errorf("startup hook %s: %w", h.name, err)
+		}
+	}
+	return nil
+}
+
+// Shutdown runs every shutdown hook, most recently registered first, logging
+// failures so one hook can't keep the others from cleaning up
+func Shutdown(ctx context.Context) {
+	mu.RLock()
+	list := slices.Clone(shutdown)
+	mu.RUnlock()
+	for _, h := range slices.Backward(list) {
+		if err := h.fn(ctx); err != nil {
+			logger.Warn("shutdown hook failed", zap.String("hook", h.name), zap.Error(err))
+		}
+	}
+}
+
+// Middleware runs the request hooks around the rest of the chain. It belongs after
+// ErrorHandler and authentication, so hooks see the subject and errors they attach
+// are rendered.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mu.RLock()
+		pre, post, errs := preRequest, postResponse, onError
+		mu.RUnlock()
+		if len(pre)+len(post)+len(errs) == 0 {
+			c.Next()
+			return
+		}
+
+		for _, h := range pre {
+			if h.fn(c); c.IsAborted() {
+				break
+			}
+		}
+		if !c.IsAborted() {
+			c.Next()
+		}
+
+		if err := c.Errors.Last(); err != nil {
+			for _, h := range errs {
+				h.fn(c, err.Err)
+			}
+		}
+		for _, h := range post {
+			h.fn(c)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package id
+
+import (
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Param decodes the named URI parameter. IDs that don't decode are reported as not
+// found, the same as a key that doesn't exist, so probing reveals nothing.
+func Param(c *gin.Context, name string) (ID, error) {
+	var i ID
+	if err := i.UnmarshalParam(c.Param(name)); err != nil {
+		return 0, apperrors.NewNotFoundError("resource not found")
+	}
+	return i, nil
+}
+
+// Query decodes the named query parameter, ok is false when it is absent
+func Query(c *gin.Context, name string) (ID, bool, error) {
+	value, present := c.GetQuery(name)
+	if !present || value == "" {
+		return 0, false, nil
+	}
+	var i ID
+	if err := i.UnmarshalParam(value); err != nil {
+		return 0, true, apperrors.NewValidationError("invalid " + name)
+	}
+	return i, true, nil
+}
@@ -0,0 +1,185 @@
+// Package id encodes integer primary keys as short opaque strings for external APIs,
+// so sequential keys can't be enumerated or used to estimate table sizes. Internal
+// code keeps working with the integers; the ID type converts at the JSON, URL and
+// database boundaries.
+package id
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+
+	"github.com/sqids/sqids-go"
+)
+
+// Config holds codec configuration. Changing the alphabet, secret or minimum length
+// changes every public ID, so they must stay fixed once IDs have been handed out.
+type Config struct {
+	Alphabet  string `yaml:"alphabet"`  // Characters IDs are made of, empty uses the sqids default
+	MinLength int    `yaml:"minLength"` // IDs are padded to at least this length
+	Secret    string `yaml:"secret"`    // Shuffles the alphabet so IDs differ from other sqids deployments
+}
+
+const defaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ErrInvalid is returned for strings that aren't IDs issued by the codec
+var ErrInvalid = errors.New("invalid id")
+
+// Codec converts between integer keys and public IDs
+type Codec struct {
+	sqids *sqids.Sqids
+}
+
+// NewCodec creates a codec from cfg
+func NewCodec(cfg Config) (*Codec, error) {
+	alphabet := cfg.Alphabet
+	if alphabet == "" {
+		alphabet = defaultAlphabet
+	}
+	if cfg.Secret != "" {
+		alphabet = shuffle(alphabet, cfg.Secret)
+	}
+	if cfg.MinLength < 0 || cfg.MinLength > 255 {
+		return nil, fmt.Errorf("id min length must be between 0 and 255")
+	}
+
+	s, err := sqids.New(sqids.Options{Alphabet: alphabet, MinLength: uint8(cfg.MinLength)})
+	if err != nil {
+		return nil, err
+	}
+	return &Codec{sqids: s}, nil
+}
+
+// shuffle permutes the alphabet deterministically from the secret
+func shuffle(alphabet, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	r := rand.New(rand.NewPCG(binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16])))
+	chars := []rune(alphabet)
+	r.Shuffle(len(chars), func(i, j int) { chars[i], chars[j] = chars[j], chars[i] })
+	return string(chars)
+}
+
+// Encode returns the public ID for a key; keys are never negative
+func (c *Codec) Encode(n int64) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("id: can't encode negative key %d", n)
+	}
+	return c.sqids.Encode([]uint64{uint64(n)})
+}
+
+// Decode returns the key for a public ID. Only the canonical encoding is accepted so
+// each key has exactly one public ID.
+func (c *Codec) Decode(s string) (int64, error) {
+	numbers := c.sqids.Decode(s)
+	if len(numbers) != 1 || numbers[0] > uint64(1<<63-1) {
+		return 0, ErrInvalid
+	}
+	if canonical, err := c.sqids.Encode(numbers); err != nil || canonical != s {
+		return 0, ErrInvalid
+	}
+	return int64(numbers[0]), nil
+}
+
+var (
+	mu      sync.RWMutex
+	current *Codec
+)
+
+func init() {
+	c, err := NewCodec(Config{})
+	if err != nil {
+		panic(err)
+	}
+	current = c
+}
+
+// Init replaces the codec used by the ID type, call it once at startup
+func Init(cfg Config) error {
+	c, err := NewCodec(cfg)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = c
+	mu.Unlock()
+	return nil
+}
+
+func codec() *Codec {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Encode returns the public ID for a key using the configured codec
+func Encode(n int64) (string, error) {
+	return codec().Encode(n)
+}
+
+// Decode returns the key for a public ID using the configured codec
+func Decode(s string) (int64, error) {
+	return codec().Decode(s)
+}
+
+// ID is an integer primary key that is written as a public ID in JSON, query
+// strings and URI parameters, and as the integer in the database
+type ID int64
+
+// String returns the public ID
+func (i ID) String() string {
+	s, err := Encode(int64(i))
+	if err != nil {
+		return strconv.FormatInt(int64(i), 10)
+	}
+	return s
+}
+
+func (i ID) MarshalText() ([]byte, error) {
+	s, err := Encode(int64(i))
+	return []byte(s), err
+}
+
+func (i *ID) UnmarshalText(text []byte) error {
+	n, err := Decode(string(text))
+	if err != nil {
+		return err
+	}
+	*i = ID(n)
+	return nil
+}
+
+// UnmarshalParam lets gin bind IDs from URIs, query strings and forms
+func (i *ID) UnmarshalParam(param string) error {
+	return i.UnmarshalText([]byte(param))
+}
+
+func (i ID) Value() (driver.Value, error) {
+	return int64(i), nil
+}
+
+func (i *ID) Scan(src any) error {
+	switch v := src.(type) {
+	case int64:
+		*i = ID(v)
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return err
+		}
+		*i = ID(n)
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*i = ID(n)
+	default:
+		return fmt.Errorf("id: can't scan %T", src)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package jwks
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the public key set and admin key management endpoints
+type Handler struct {
+	manager *Manager
+}
+
+// NewHandler creates a key handler
+func NewHandler(manager *Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// RegisterRoutes mounts /.well-known/jwks.json on a public router
+func (h *Handler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/.well-known/jwks.json", h.jwks)
+}
+
+// RegisterAdminRoutes mounts key listing and manual rotation on an admin router group
+func (h *Handler) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/signing-keys", h.list)
+	rg.POST("/signing-keys/rotate", h.rotate)
+}
+
+func (h *Handler) jwks(c *gin.Context) {
+	// Let verifiers cache the set for as long as a new key waits before it signs
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.manager.cfg.RefreshInterval.Seconds())))
+	c.JSON(http.StatusOK, h.manager.JWKS())
+}
+
+type keyInfo struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	CreatedAt time.Time `json:"createdAt"`
+	Signing   bool      `json:"signing"`
+}
+
+func (h *Handler) list(c *gin.Context) {
+	signing := h.manager.SigningKeyID()
+	keys := h.manager.Keys()
+	list := make([]keyInfo, len(keys))
+	for i, k := range keys {
+		list[i] = keyInfo{ID: k.ID, Algorithm: k.Algorithm, CreatedAt: k.CreatedAt, Signing: k.ID == signing}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (h *Handler) rotate(c *gin.Context) {
+	k, err := h.manager.Rotate(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, keyInfo{ID: k.ID, Algorithm: k.Algorithm, CreatedAt: k.CreatedAt})
+}
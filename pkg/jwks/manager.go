@@ -0,0 +1,243 @@
+package jwks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// Config holds signing key configuration
+type Config struct {
+	Algorithm        string        `yaml:"algorithm"`        // RS256 or EdDSA
+	Issuer           string        `yaml:"issuer"`           // iss claim set on signed tokens and required on verified ones
+	RotationInterval time.Duration `yaml:"rotationInterval"` // How long a key signs new tokens
+	RetentionPeriod  time.Duration `yaml:"retentionPeriod"`  // How long a retired key still verifies, longer than any token lifetime
+	RefreshInterval  time.Duration `yaml:"refreshInterval"`  // How often keys are reloaded and rotation is checked
+}
+
+// Manager signs tokens with the newest key and verifies them with any key that
+// hasn't expired, selected by the token's kid header. A new key is published in the
+// JWKS for one refresh interval before it signs anything, so other instances and
+// downstream services have picked it up by the time tokens carry its kid.
+type Manager struct {
+	store Store
+	cfg   Config
+
+	mu   sync.RWMutex
+	keys []Key // newest first
+}
+
+// NewManager loads the keys from store, creating the first one if necessary
+func NewManager(ctx context.Context, store Store, cfg Config) (*Manager, error) {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = RS256
+	}
+	if cfg.RotationInterval <= 0 {
+		cfg.RotationInterval = 30 * 24 * time.Hour
+	}
+	if cfg.RetentionPeriod <= 0 {
+		cfg.RetentionPeriod = 24 * time.Hour
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Minute
+	}
+	if cfg.Algorithm != RS256 && cfg.Algorithm != EdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+
+	m := &Manager{store: store, cfg: cfg}
+	if err := m.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Run reloads keys and rotates them on schedule until ctx is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.refresh(ctx); err != nil {
+				logger.Error("failed to refresh signing keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (m *Manager) refresh(ctx context.Context) error {
+	keys, err := m.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 || time.Since(keys[0].CreatedAt) >= m.cfg.RotationInterval {
+		k, err := GenerateKey(m.cfg.Algorithm)
+		if err != nil {
+			return err
+		}
+		if err := m.store.Add(ctx, k); err != nil {
+			return err
+		}
+		logger.Info("generated signing key", zap.String("kid", k.ID), zap.String("alg", k.Algorithm))
+		keys = append([]Key{k}, keys...)
+	}
+
+	// A key stops signing once a newer key takes over, then verifies for the retention period
+	cutoff := time.Now().Add(-m.cfg.RotationInterval - m.cfg.RetentionPeriod)
+	if err := m.store.DeleteBefore(ctx, cutoff); err != nil {
+		return err
+	}
+	live := keys[:0]
+	for _, k := range keys {
+		if !k.CreatedAt.Before(cutoff) {
+			live = append(live, k)
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = live
+	m.mu.Unlock()
+	return nil
+}
+
+// Rotate creates a new key immediately. It signs tokens after the usual publication delay.
+func (m *Manager) Rotate(ctx context.Context) (Key, error) {
+	k, err := GenerateKey(m.cfg.Algorithm)
+	if err != nil {
+		return Key{}, err
+	}
+	if err := m.store.Add(ctx, k); err != nil {
+		return Key{}, err
+	}
+	return k, m.refresh(ctx)
+}
+
+// Keys returns the keys currently published, newest first
+func (m *Manager) Keys() []Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Key(nil), m.keys...)
+}
+
+// signingKey returns the newest key that has been published long enough, falling back
+// to the oldest key when every key is new (such as on first start)
+func (m *Manager) signingKey() (Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 {
+		return Key{}, fmt.Errorf("no signing keys available")
+	}
+	for _, k := range m.keys {
+		if time.Since(k.CreatedAt) >= m.cfg.RefreshInterval {
+			return k, nil
+		}
+	}
+	return m.keys[len(m.keys)-1], nil
+}
+
+// SigningKeyID returns the kid new tokens are signed with
+func (m *Manager) SigningKeyID() string {
+	k, err := m.signingKey()
+	if err != nil {
+		return ""
+	}
+	return k.ID
+}
+
+// AccessTokenType is the typ header of OAuth access tokens (RFC 9068), telling them
+// apart from the session tokens of users
+const AccessTokenType = "at+jwt"
+
+// Sign signs claims with the current key, setting the issuer when configured
+func (m *Manager) Sign(claims jwt.MapClaims) (string, error) {
+	return m.sign(claims, "")
+}
+
+// SignAccessToken signs the claims of an OAuth access token, typed AccessTokenType
+func (m *Manager) SignAccessToken(claims jwt.MapClaims) (string, error) {
+	return m.sign(claims, AccessTokenType)
+}
+
+// IsAccessToken reports whether a token is an OAuth access token rather than a
+// session token. Those issued before they were typed are told by their client_id.
+func IsAccessToken(token *jwt.Token) bool {
+	if typ, _ := token.Header["typ"].(string); typ == AccessTokenType {
+		return true
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	_, ok = claims["client_id"]
+	return ok
+}
+
+func (m *Manager) sign(claims jwt.MapClaims, typ string) (string, error) {
+	k, err := m.signingKey()
+	if err != nil {
+		return "", err
+	}
+	if m.cfg.Issuer != "" {
+		claims["iss"] = m.cfg.Issuer
+	}
+
+	token := jwt.NewWithClaims(k.SigningMethod(), claims)
+	token.Header["kid"] = k.ID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(k.PrivateKey)
+}
+
+// Keyfunc resolves the verification key from a token's kid header, for jwt.Parse
+func (m *Manager) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k.ID == kid {
+			if token.Method.Alg() != k.Algorithm {
+				return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+			}
+			return k.PublicKey(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// Parse verifies a signed token and its standard claims
+func (m *Manager) Parse(tokenString string) (*jwt.Token, error) {
+	opts := []jwt.ParserOption{jwt.WithValidMethods([]string{RS256, EdDSA}), jwt.WithExpirationRequired()}
+	if m.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.cfg.Issuer))
+	}
+	return jwt.Parse(tokenString, m.Keyfunc, opts...)
+}
+
+// Set is a JSON Web Key Set
+type Set struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of every published key
+func (m *Manager) JWKS() Set {
+	keys := m.Keys()
+	set := Set{Keys: make([]JWK, len(keys))}
+	for i, k := range keys {
+		set.Keys[i] = k.JWK()
+	}
+	return set
+}
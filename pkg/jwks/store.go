@@ -0,0 +1,119 @@
+package jwks
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store persists signing keys so every instance signs and verifies with the same set
+type Store interface {
+	// List returns all keys, newest first
+	List(ctx context.Context) ([]Key, error)
+	Add(ctx context.Context, k Key) error
+	// DeleteBefore removes keys created before t
+	DeleteBefore(ctx context.Context, t time.Time) error
+}
+
+// MemoryStore keeps keys in memory. Keys are lost on restart, which invalidates every
+// token issued before it, so it's only suitable for single instances and development.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// NewMemoryStore creates an empty in-memory key store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Key(nil), s.keys...), nil
+}
+
+func (s *MemoryStore) Add(ctx context.Context, k Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, k)
+	sort.Slice(s.keys, func(i, j int) bool { return s.keys[i].CreatedAt.After(s.keys[j].CreatedAt) })
+	return nil
+}
+
+func (s *MemoryStore) DeleteBefore(ctx context.Context, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.keys[:0]
+	for _, k := range s.keys {
+		if !k.CreatedAt.Before(t) {
+			kept = append(kept, k)
+		}
+	}
+	s.keys = kept
+	return nil
+}
+
+// SQLStore persists keys in the signing_keys table. Private keys are stored as
+// PKCS #8 PEM, so access to the table must be restricted like any other secret.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a key store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the signing_keys table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS signing_keys (
+			id          TEXT PRIMARY KEY,
+			algorithm   TEXT NOT NULL,
+			private_key TEXT NOT NULL,
+			created_at  TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, algorithm, private_key, created_at FROM signing_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []Key
+	for rows.Next() {
+		var k Key
+		var pem string
+		if err := rows.Scan(&k.ID, &k.Algorithm, &pem, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		if k.PrivateKey, err = decodePrivateKey(pem); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLStore) Add(ctx context.Context, k Key) error {
+	pem, err := encodePrivateKey(k.PrivateKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO signing_keys (id, algorithm, private_key, created_at)
+		VALUES ($1, $2, $3, $4)`,
+		k.ID, k.Algorithm, pem, k.CreatedAt)
+	return err
+}
+
+func (s *SQLStore) DeleteBefore(ctx context.Context, t time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM signing_keys WHERE created_at < $1`, t)
+	return err
+}
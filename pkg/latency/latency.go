@@ -0,0 +1,75 @@
+// Package latency lets routes declare how long they should take. Requests that take
+// longer are flagged by the request logger and counted, so regressions show up
+// without an external APM.
+package latency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Config holds the budgets applied on top of the ones routes declare
+type Config struct {
+	Default time.Duration            `yaml:"default"` // Budget of routes declaring none, 0 leaves them unbudgeted
+	Routes  map[string]time.Duration `yaml:"routes"`  // By "METHOD /route/:param", overriding the route's own
+}
+
+const budgetKey = "latencyBudget"
+
+var (
+	mu  sync.RWMutex
+	cfg Config
+
+	budgetExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_latency_budget_exceeded_total",
+		Help: "Requests that took longer than their route's latency budget.",
+	}, []string{"method", "route"})
+)
+
+// Configure sets the default budget and per-route overrides
+func Configure(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+}
+
+// Budget declares the latency budget of a route
+func Budget(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(budgetKey, d)
+		c.Next()
+	}
+}
+
+// Of returns the budget of the request's route: its configured override, the
+// budget it declared, or the default
+func Of(c *gin.Context) (time.Duration, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if d, ok := cfg.Routes[c.Request.Method+" "+c.FullPath()]; ok {
+		return d, d > 0
+	}
+	if d, ok := c.Get(budgetKey); ok {
+		return d.(time.Duration), true
+	}
+	return cfg.Default, cfg.Default > 0
+}
+
+// Check reports whether a request that took elapsed exceeded its budget, counting
+// it if so
+func Check(c *gin.Context, elapsed time.Duration) (budget time.Duration, exceeded bool) {
+	budget, ok := Of(c)
+	if !ok || elapsed <= budget {
+		return budget, false
+	}
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	budgetExceeded.WithLabelValues(c.Request.Method, route).Inc()
+	return budget, true
+}
@@ -0,0 +1,134 @@
+// Package limits sizes the Go runtime to the container it runs in. GOMAXPROCS follows
+// the cgroup CPU quota instead of the host's core count, and the soft memory limit is
+// set below the cgroup memory limit so the GC works harder before the pod is OOM
+// killed. Explicit GOMAXPROCS and GOMEMLIMIT environment variables always win.
+package limits
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go-api/pkg/logger"
+
+	"go.uber.org/automaxprocs/maxprocs"
+	"go.uber.org/zap"
+)
+
+// Config holds runtime tuning configuration
+type Config struct {
+	MaxProcs         bool    `yaml:"maxProcs"`         // Derive GOMAXPROCS from the CPU quota
+	MemoryLimitRatio float64 `yaml:"memoryLimitRatio"` // Fraction of the memory limit used as GOMEMLIMIT, 0 disables
+}
+
+// cgroupRoot is where cgroup hierarchies are mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// unlimited is the largest limit cgroup v1 reports, meaning no limit
+const unlimited = 1 << 62
+
+// Apply tunes the runtime and logs the outcome
+func Apply(cfg Config) {
+	if cfg.MaxProcs {
+		before := runtime.GOMAXPROCS(0)
+		if _, err := maxprocs.Set(maxprocs.Logger(func(string, ...any) {})); err != nil {
+			logger.Warn("failed to set GOMAXPROCS from CPU quota", zap.Error(err))
+		} else {
+			logger.Info("runtime GOMAXPROCS", zap.Int("gomaxprocs", runtime.GOMAXPROCS(0)), zap.Int("before", before), zap.Int("cpus", runtime.NumCPU()))
+		}
+	}
+
+	if cfg.MemoryLimitRatio <= 0 {
+		return
+	}
+	if v := os.Getenv("GOMEMLIMIT"); v != "" {
+		logger.Info("runtime memory limit set by GOMEMLIMIT", zap.String("gomemlimit", v))
+		return
+	}
+	limit, err := memoryLimit()
+	switch {
+	case err != nil:
+		logger.Warn("failed to read cgroup memory limit", zap.Error(err))
+	case limit == 0:
+		logger.Info("no cgroup memory limit, leaving GOMEMLIMIT unset")
+	default:
+		soft := int64(float64(limit) * cfg.MemoryLimitRatio)
+		debug.SetMemoryLimit(soft)
+		logger.Info("runtime memory limit", zap.Int64("gomemlimit", soft), zap.Int64("cgroupLimit", limit), zap.Float64("ratio", cfg.MemoryLimitRatio))
+	}
+}
+
+// memoryLimit returns the cgroup memory limit in bytes, 0 when there is none
+func memoryLimit() (int64, error) {
+	v2, v1, err := cgroupPaths()
+	if err != nil {
+		return 0, err
+	}
+
+	// cgroup v2, under the process's own group first, then the namespace root
+	for _, path := range []string{filepath.Join(cgroupRoot, v2, "memory.max"), filepath.Join(cgroupRoot, "memory.max")} {
+		if limit, err := readLimit(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+			return limit, err
+		}
+	}
+	// cgroup v1
+	for _, path := range []string{filepath.Join(cgroupRoot, "memory", v1, "memory.limit_in_bytes"), filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes")} {
+		if limit, err := readLimit(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+			return limit, err
+		}
+	}
+	return 0, nil
+}
+
+// cgroupPaths returns the process's unified (v2) and v1 memory cgroup
+func cgroupPaths() (v2, v1 string, err error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			v2 = parts[2]
+		case strings.Contains(","+parts[1]+",", ",memory,"):
+			v1 = parts[2]
+		}
+	}
+	return v2, v1, scanner.Err()
+}
+
+func readLimit(path string) (int64, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(raw))
+	if value == "max" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if limit >= unlimited {
+		return 0, nil
+	}
+	return limit, nil
+}
@@ -14,6 +14,7 @@ import (
 var (
 	globalLogger  *zap.Logger
 	sugaredLogger *zap.SugaredLogger
+	atomicLevel   = zap.NewAtomicLevel()
 )
 
 // Config holds logger configuration
@@ -33,11 +34,12 @@ type Config struct {
 
 // Init initializes the global logger
 func Init(config Config) error {
-	// Set up log level
+	// Set up log level, kept atomic so it can be changed at runtime
 	var level zapcore.Level
 	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
 		return err
 	}
+	atomicLevel.SetLevel(level)
 
 	// Set up encoder config
 	encoderConfig := zapcore.EncoderConfig{
@@ -68,7 +70,7 @@ func Init(config Config) error {
 		cores = append(cores, zapcore.NewCore(
 			consoleEncoder,
 			zapcore.Lock(os.Stdout),
-			level,
+			atomicLevel,
 		))
 	}
 
@@ -90,7 +92,7 @@ func Init(config Config) error {
 		cores = append(cores, zapcore.NewCore(
 			fileEncoder,
 			fileWriter,
-			level,
+			atomicLevel,
 		))
 	}
 
@@ -122,6 +124,21 @@ func Sync() error {
 	return globalLogger.Sync()
 }
 
+// Level returns the current log level
+func Level() zapcore.Level {
+	return atomicLevel.Level()
+}
+
+// SetLevel changes the log level of the global logger at runtime
+func SetLevel(level string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	atomicLevel.SetLevel(l)
+	return nil
+}
+
 // Logger returns the global zap.Logger instance
 func Logger() *zap.Logger {
 	return globalLogger
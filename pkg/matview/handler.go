@@ -0,0 +1,42 @@
+package matview
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for inspecting and refreshing materialized views
+type Handler struct {
+	refresher *Refresher
+}
+
+// NewHandler creates a materialized view handler
+func NewHandler(refresher *Refresher) *Handler {
+	return &Handler{refresher: refresher}
+}
+
+// RegisterRoutes mounts the materialized view endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/matviews", h.list)
+	rg.POST("/matviews/:name/refresh", h.refresh)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	list, err := h.refresher.Views(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// refresh refreshes one view synchronously, whether or not it is due
+func (h *Handler) refresh(c *gin.Context) {
+	refresh, err := h.refresher.Refresh(c.Request.Context(), c.Param("name"), true)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, refresh)
+}
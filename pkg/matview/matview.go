@@ -0,0 +1,370 @@
+// Package matview refreshes the Postgres materialized views behind expensive
+// aggregate endpoints. A view is refreshed on a cron schedule, after the events it
+// is derived from, or both. Refreshes take an advisory lock named after the view,
+// so across instances one refresh of a view runs at a time, and the time of the
+// last one is kept in the database, shared by every instance, for staleness.
+package matview
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/cron"
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+	"go-api/pkg/projection"
+
+	"go.uber.org/zap"
+)
+
+// View declares a materialized view, which a migration creates, and when it is
+// refreshed
+type View struct {
+	Name        string
+	Description string
+	Schedule    string   // Cron expression of scheduled refreshes; none when empty
+	Events      []string // Types of the events after which the view is refreshed
+	// Least time between refreshes triggered by events, which arrive in bursts
+	MinInterval time.Duration
+	// Refreshes with CONCURRENTLY, so the view stays readable during the refresh;
+	// it needs a unique index on the view
+	Concurrently bool
+}
+
+// Declarer is implemented by modules that own materialized views
+type Declarer interface {
+	MaterializedViews() []View
+}
+
+// Config holds materialized view refresh configuration
+type Config struct {
+	Enabled      bool              `yaml:"enabled"`
+	PollInterval time.Duration     `yaml:"pollInterval"` // How often schedules and stale views are checked
+	Timeout      time.Duration     `yaml:"timeout"`      // Of one refresh
+	Schedules    map[string]string `yaml:"schedules"`    // Overrides of view schedules by name
+}
+
+// Refresh is a successful refresh of a view, by any instance
+type Refresh struct {
+	StartedAt  time.Time `json:"startedAt"` // What the view is as of
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// Status describes a registered view
+type Status struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Schedule    string     `json:"schedule,omitempty"`
+	Events      []string   `json:"events,omitempty"`
+	LastEventAt *time.Time `json:"lastEventAt,omitempty"` // Of the latest of its events seen
+	NextRunAt   *time.Time `json:"nextRunAt,omitempty"`   // Of the schedule
+	LastRefresh *Refresh   `json:"lastRefresh,omitempty"`
+}
+
+type view struct {
+	View
+	schedule  *cron.Schedule
+	lastEvent time.Time // Recording time of the latest of its events seen, zero before any
+}
+
+var errViewNotFound = apperrors.NewNotFoundError("Materialized view not found")
+
+// Refresher refreshes registered views on their schedules and after their events
+type Refresher struct {
+	cfg Config
+	db  *sql.DB
+
+	mu    sync.Mutex
+	views map[string]*view
+}
+
+// NewRefresher creates a refresher of the views of db, which must be Postgres
+func NewRefresher(cfg Config, db *sql.DB) *Refresher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Minute
+	}
+	return &Refresher{cfg: cfg, db: db, views: make(map[string]*view)}
+}
+
+// EnsureSchema creates the table of the last refreshes
+func (r *Refresher) EnsureSchema(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS matview_refreshes (
+			name        TEXT PRIMARY KEY,
+			started_at  TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+// Register adds a view, applying any configured schedule override
+func (r *Refresher) Register(v View) error {
+	if s, ok := r.cfg.Schedules[v.Name]; ok {
+		v.Schedule = s
+	}
+	entry := &view{View: v}
+	if v.Schedule != "" {
+		schedule, err := cron.Parse(v.Schedule)
+		if err != nil {
+			return fmt.Errorf("materialized view %s: %w", v.Name, err)
+		}
+		entry.schedule = schedule
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.views[v.Name]; ok {
+		return fmt.Errorf("materialized view %s registered twice", v.Name)
+	}
+	r.views[v.Name] = entry
+	return nil
+}
+
+// RegisterFrom registers the views of every value that implements Declarer
+func (r *Refresher) RegisterFrom(values ...any) error {
+	for _, v := range values {
+		if d, ok := v.(Declarer); ok {
+			for _, view := range d.MaterializedViews() {
+				if err := r.Register(view); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Projection marks views stale on their events. It has to be registered with the
+// projection runner, which delivers every event to it once.
+func (r *Refresher) Projection() projection.Projection {
+	return projection.Funcs{
+		ProjectionName: "matviews",
+		HandleFunc: func(ctx context.Context, e eventstore.Event) error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			for _, v := range r.views {
+				if slices.Contains(v.Events, e.Type) && e.RecordedAt.After(v.lastEvent) {
+					v.lastEvent = e.RecordedAt
+				}
+			}
+			return nil
+		},
+		// A rebuild replays every event, which would only mark the views stale again
+		ResetFunc: func(ctx context.Context) error {
+			now := time.Now().UTC()
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			for _, v := range r.views {
+				if len(v.Events) > 0 {
+					v.lastEvent = now
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Start refreshes the views that are due every poll interval until ctx is
+// cancelled, unless disabled
+func (r *Refresher) Start(ctx context.Context) {
+	if !r.cfg.Enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(r.cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			r.refreshDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// refreshDue refreshes, in name order, the views whose schedule fired or that
+// got stale at least MinInterval after their last refresh, and updates the
+// staleness of all
+func (r *Refresher) refreshDue(ctx context.Context) {
+	last, err := r.lastRefreshes(ctx)
+	if err != nil {
+		logger.Error("failed to read materialized view refreshes", zap.Error(err))
+		return
+	}
+	now := time.Now().UTC()
+	for _, name := range r.names() {
+		if ctx.Err() != nil {
+			return
+		}
+		refresh, refreshed := last[name]
+		if refreshed {
+			staleness.WithLabelValues(name).Set(now.Sub(refresh.StartedAt).Seconds())
+		}
+		if !r.due(name, refresh, refreshed, now) {
+			continue
+		}
+		if _, err := r.Refresh(ctx, name, false); err != nil && !errors.Is(err, apperrors.ErrConflict) {
+			logger.Error("materialized view refresh failed", zap.String("view", name), zap.Error(err))
+		}
+	}
+}
+
+// due reports whether a view needs a refresh given its last one
+func (r *Refresher) due(name string, last Refresh, refreshed bool, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := r.views[name]
+	if !refreshed {
+		// Created by its migration, the view has data as of then, but not of events since
+		return v.schedule != nil || !v.lastEvent.IsZero()
+	}
+	if v.schedule != nil && !v.schedule.Next(last.StartedAt).After(now) {
+		return true
+	}
+	// Events recorded before the last refresh started are in the view already
+	return !v.lastEvent.IsZero() && !v.lastEvent.Before(last.StartedAt) && !now.Before(last.StartedAt.Add(v.MinInterval))
+}
+
+// Refresh refreshes a view now, unless another instance refreshed it meanwhile;
+// force refreshes it regardless. It fails with a conflict while the view is being
+// refreshed elsewhere.
+func (r *Refresher) Refresh(ctx context.Context, name string, force bool) (Refresh, error) {
+	r.mu.Lock()
+	v, ok := r.views[name]
+	r.mu.Unlock()
+	if !ok {
+		return Refresh{}, errViewNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	// Advisory locks belong to the session, so lock and unlock on one connection
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return Refresh{}, err
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, "matview:"+name).Scan(&locked); err != nil {
+		return Refresh{}, err
+	}
+	if !locked {
+		return Refresh{}, apperrors.NewConflictError("Materialized view is already being refreshed")
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock(hashtext($1))`, "matview:"+name)
+
+	// Another instance may have refreshed the view between the check and the lock
+	if !force {
+		last, err := r.lastRefreshes(ctx)
+		if err != nil {
+			return Refresh{}, err
+		}
+		refresh, refreshed := last[name]
+		if !r.due(name, refresh, refreshed, time.Now().UTC()) {
+			return refresh, nil
+		}
+	}
+
+	refresh := Refresh{StartedAt: time.Now().UTC()}
+	stmt := `REFRESH MATERIALIZED VIEW `
+	if v.Concurrently {
+		stmt += `CONCURRENTLY `
+	}
+	_, err = conn.ExecContext(ctx, stmt+`"`+strings.ReplaceAll(name, `"`, `""`)+`"`)
+	refresh.FinishedAt = time.Now().UTC()
+	took := refresh.FinishedAt.Sub(refresh.StartedAt)
+	refreshDuration.WithLabelValues(name).Observe(took.Seconds())
+	if err != nil {
+		// The schedule or the stale events retry it on the next poll
+		refreshes.WithLabelValues(name, "error").Inc()
+		return Refresh{}, err
+	}
+	refreshes.WithLabelValues(name, "success").Inc()
+
+	staleness.WithLabelValues(name).Set(0)
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO matview_refreshes (name, started_at, finished_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET started_at = excluded.started_at, finished_at = excluded.finished_at`,
+		name, refresh.StartedAt, refresh.FinishedAt); err != nil {
+		return refresh, err
+	}
+	logger.Info("materialized view refreshed", zap.String("view", name), zap.Duration("took", took))
+	return refresh, nil
+}
+
+// lastRefreshes reads the last successful refresh of every view
+func (r *Refresher) lastRefreshes(ctx context.Context) (map[string]Refresh, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT name, started_at, finished_at FROM matview_refreshes`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	last := make(map[string]Refresh)
+	for rows.Next() {
+		var name string
+		var refresh Refresh
+		if err := rows.Scan(&name, &refresh.StartedAt, &refresh.FinishedAt); err != nil {
+			return nil, err
+		}
+		refresh.StartedAt, refresh.FinishedAt = refresh.StartedAt.UTC(), refresh.FinishedAt.UTC()
+		last[name] = refresh
+	}
+	return last, rows.Err()
+}
+
+func (r *Refresher) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.views))
+	for name := range r.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Views returns the status of every registered view
+func (r *Refresher) Views(ctx context.Context) ([]Status, error) {
+	last, err := r.lastRefreshes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Status, 0, len(r.views))
+	for name, v := range r.views {
+		status := Status{Name: name, Description: v.Description, Schedule: v.Schedule, Events: v.Events}
+		if !v.lastEvent.IsZero() {
+			at := v.lastEvent
+			status.LastEventAt = &at
+		}
+		refresh, ok := last[name]
+		if ok {
+			status.LastRefresh = &refresh
+		}
+		if v.schedule != nil {
+			from := time.Now().UTC()
+			if ok {
+				from = refresh.StartedAt
+			}
+			next := v.schedule.Next(from)
+			status.NextRunAt = &next
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
@@ -0,0 +1,22 @@
+package matview
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "matview_refreshes_total",
+		Help: "Materialized view refreshes by result: success or error.",
+	}, []string{"view", "result"})
+	refreshDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "matview_refresh_duration_seconds",
+		Help:    "How long materialized view refreshes took.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"view"})
+	staleness = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "matview_staleness_seconds",
+		Help: "Age of the data of materialized views: time since their last successful refresh started.",
+	}, []string{"view"})
+)
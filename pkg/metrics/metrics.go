@@ -0,0 +1,116 @@
+// Package metrics exports the application's instrumentation to the configured
+// backend. Code keeps instrumenting through the Prometheus client and the default
+// registry; with the Prometheus backend it is scraped from /metrics, and the other
+// backends periodically gather the registry and push it to a StatsD/DogStatsD agent
+// or an OTLP collector.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// Backends
+const (
+	BackendPrometheus = "prometheus" // Scraped from /metrics
+	BackendStatsD     = "statsd"     // DogStatsD over UDP, tags included
+	BackendOTLP       = "otlp"       // OTLP/HTTP with JSON encoding
+)
+
+// Config holds metrics export configuration
+type Config struct {
+	Backend      string            `yaml:"backend"`
+	Interval     time.Duration     `yaml:"interval"`     // How often pushing backends export
+	Prefix       string            `yaml:"prefix"`       // Prepended to metric names sent to StatsD
+	Tags         map[string]string `yaml:"tags"`         // Added to every exported series
+	StatsDAddr   string            `yaml:"statsdAddr"`   // host:port of the agent
+	OTLPEndpoint string            `yaml:"otlpEndpoint"` // Collector URL, usually ending in /v1/metrics
+	ServiceName  string            `yaml:"serviceName"`  // service.name resource attribute for OTLP
+}
+
+// Exporter sends gathered metric families to a backend
+type Exporter interface {
+	Export(ctx context.Context, families []*dto.MetricFamily) error
+	Close() error
+}
+
+// Pusher periodically exports a registry with an Exporter
+type Pusher struct {
+	gatherer prometheus.Gatherer
+	exporter Exporter
+	interval time.Duration
+}
+
+// New creates the pusher for cfg. The Prometheus backend needs none and returns nil.
+func New(cfg Config, gatherer prometheus.Gatherer) (*Pusher, error) {
+	var exporter Exporter
+	switch cfg.Backend {
+	case "", BackendPrometheus:
+		return nil, nil
+	case BackendStatsD:
+		e, err := NewStatsD(cfg.StatsDAddr, cfg.Prefix, cfg.Tags)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case BackendOTLP:
+		exporter = NewOTLP(cfg.OTLPEndpoint, cfg.ServiceName, cfg.Tags)
+	default:
+		return nil, fmt.Errorf("unknown metrics backend %q", cfg.Backend)
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &Pusher{gatherer: gatherer, exporter: exporter, interval: interval}, nil
+}
+
+// Run exports on every interval until ctx is cancelled, then exports once more so
+// the last interval isn't lost
+func (p *Pusher) Run(ctx context.Context) {
+	defer p.exporter.Close()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			p.push(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			p.push(ctx)
+		}
+	}
+}
+
+func (p *Pusher) push(ctx context.Context) {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		logger.Warn("failed to gather metrics", zap.Error(err))
+	}
+	if err := p.exporter.Export(ctx, families); err != nil {
+		logger.Warn("failed to export metrics", zap.Error(err))
+	}
+}
+
+// labels returns a metric's labels merged over the global tags
+func labels(m *dto.Metric, tags map[string]string) map[string]string {
+	out := make(map[string]string, len(tags)+len(m.GetLabel()))
+	for k, v := range tags {
+		out[k] = v
+	}
+	for _, l := range m.GetLabel() {
+		out[l.GetName()] = l.GetValue()
+	}
+	return out
+}
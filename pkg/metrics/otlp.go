@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// OTLP pushes metrics to an OpenTelemetry collector over OTLP/HTTP using the JSON
+// encoding. Prometheus counters and histograms are cumulative, so they're sent with
+// cumulative temporality from the time the exporter was created.
+type OTLP struct {
+	endpoint string
+	resource []otlpAttribute
+	start    time.Time
+	client   *http.Client
+}
+
+// NewOTLP creates an exporter posting to the collector at endpoint
+func NewOTLP(endpoint, serviceName string, tags map[string]string) *OTLP {
+	if serviceName == "" {
+		serviceName = "go-api"
+	}
+	resource := attributes(tags)
+	resource = append(resource, otlpAttribute{Key: "service.name", Value: otlpValue{StringValue: serviceName}})
+	return &OTLP{endpoint: endpoint, resource: resource, start: time.Now(), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// The types below mirror the subset of ExportMetricsServiceRequest that is sent
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          *float64        `json:"asDouble,omitempty"`
+	Count             string          `json:"count,omitempty"`
+	Sum               *float64        `json:"sum,omitempty"`
+	BucketCounts      []string        `json:"bucketCounts,omitempty"`
+	ExplicitBounds    []float64       `json:"explicitBounds,omitempty"`
+}
+
+type otlpData struct {
+	DataPoints             []otlpPoint `json:"dataPoints"`
+	AggregationTemporality int         `json:"aggregationTemporality,omitempty"`
+	IsMonotonic            bool        `json:"isMonotonic,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Gauge       *otlpData `json:"gauge,omitempty"`
+	Sum         *otlpData `json:"sum,omitempty"`
+	Histogram   *otlpData `json:"histogram,omitempty"`
+}
+
+const temporalityCumulative = 2
+
+func (o *OTLP) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := strconv.FormatInt(o.start.UnixNano(), 10)
+
+	var list []otlpMetric
+	for _, f := range families {
+		metric := otlpMetric{Name: f.GetName(), Description: f.GetHelp()}
+		data := &otlpData{}
+		for _, m := range f.GetMetric() {
+			p := otlpPoint{Attributes: attributes(labels(m, nil)), StartTimeUnixNano: start, TimeUnixNano: now}
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				p.AsDouble = ptr(m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				p.AsDouble = ptr(m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				p.AsDouble = ptr(m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				p.Count = strconv.FormatUint(h.GetSampleCount(), 10)
+				p.Sum = ptr(h.GetSampleSum())
+				// Prometheus buckets are cumulative, OTLP ones hold their own count
+				var prev uint64
+				for _, b := range h.GetBucket() {
+					p.ExplicitBounds = append(p.ExplicitBounds, b.GetUpperBound())
+					p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-prev, 10))
+					prev = b.GetCumulativeCount()
+				}
+				p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(h.GetSampleCount()-prev, 10))
+			default:
+				continue
+			}
+			data.DataPoints = append(data.DataPoints, p)
+		}
+		if len(data.DataPoints) == 0 {
+			continue
+		}
+		switch f.GetType() {
+		case dto.MetricType_COUNTER:
+			data.AggregationTemporality, data.IsMonotonic = temporalityCumulative, true
+			metric.Sum = data
+		case dto.MetricType_HISTOGRAM:
+			data.AggregationTemporality = temporalityCumulative
+			metric.Histogram = data
+		default:
+			metric.Gauge = data
+		}
+		list = append(list, metric)
+	}
+
+	body := map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource":     map[string]any{"attributes": o.resource},
+			"scopeMetrics": []any{map[string]any{"scope": map[string]string{"name": "go-api"}, "metrics": list}},
+		}},
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (o *OTLP) Close() error { return nil }
+
+func attributes(labels map[string]string) []otlpAttribute {
+	list := make([]otlpAttribute, 0, len(labels))
+	for k, v := range labels {
+		list = append(list, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+func ptr(v float64) *float64 { return &v }
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// maxPacketSize keeps datagrams under a typical MTU
+const maxPacketSize = 1432
+
+// StatsD sends metrics to a DogStatsD-compatible agent. Counters and histogram
+// counts and sums are sent as the increase since the previous export, gauges as
+// their current value.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	tags   map[string]string
+
+	last map[string]float64 // Previous cumulative value by series
+}
+
+// NewStatsD creates an exporter sending to the agent at addr
+func NewStatsD(addr, prefix string, tags map[string]string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsD{conn: conn, prefix: prefix, tags: tags, last: make(map[string]float64)}, nil
+}
+
+func (s *StatsD) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	var batch bytes.Buffer
+	var firstErr error
+	send := func(line string) {
+		if batch.Len() > 0 && batch.Len()+1+len(line) > maxPacketSize {
+			if _, err := s.conn.Write(batch.Bytes()); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			batch.Reset()
+		}
+		if batch.Len() > 0 {
+			batch.WriteByte('\n')
+		}
+		batch.WriteString(line)
+	}
+
+	for _, f := range families {
+		name := s.prefix + f.GetName()
+		for _, m := range f.GetMetric() {
+			tags := formatTags(labels(m, s.tags))
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				if d, ok := s.delta(name+tags, m.GetCounter().GetValue()); ok {
+					send(line(name, d, "c", tags))
+				}
+			case dto.MetricType_GAUGE:
+				send(line(name, m.GetGauge().GetValue(), "g", tags))
+			case dto.MetricType_UNTYPED:
+				send(line(name, m.GetUntyped().GetValue(), "g", tags))
+			case dto.MetricType_HISTOGRAM:
+				s.cumulative(send, name, tags, float64(m.GetHistogram().GetSampleCount()), m.GetHistogram().GetSampleSum())
+			case dto.MetricType_SUMMARY:
+				s.cumulative(send, name, tags, float64(m.GetSummary().GetSampleCount()), m.GetSummary().GetSampleSum())
+			}
+		}
+	}
+	if batch.Len() > 0 {
+		if _, err := s.conn.Write(batch.Bytes()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *StatsD) cumulative(send func(string), name, tags string, count, sum float64) {
+	if d, ok := s.delta(name+".count"+tags, count); ok {
+		send(line(name+".count", d, "c", tags))
+	}
+	if d, ok := s.delta(name+".sum"+tags, sum); ok {
+		send(line(name+".sum", d, "c", tags))
+	}
+}
+
+// delta returns the increase of a cumulative value since the last export, treating a
+// decrease as a restart of the series. Unchanged series aren't sent.
+func (s *StatsD) delta(key string, value float64) (float64, bool) {
+	prev, seen := s.last[key]
+	s.last[key] = value
+	if seen && value >= prev {
+		value -= prev
+	}
+	return value, value != 0
+}
+
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+func line(name string, value float64, kind, tags string) string {
+	return name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind + tags
+}
+
+// formatTags renders labels as a DogStatsD tag suffix in a stable order
+func formatTags(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+":"+strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(v))
+	}
+	sort.Strings(pairs)
+	return "|#" + strings.Join(pairs, ",")
+}
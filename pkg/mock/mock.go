@@ -0,0 +1,336 @@
+// Package mock serves example responses generated from an OpenAPI document, so
+// clients can be built against an API before its handlers exist. Responses can be
+// delayed and failed at random to exercise loading and error states.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config holds mock server configuration
+type Config struct {
+	Spec        string        `yaml:"spec"`        // OpenAPI document to serve, such as pkg/client/openapi.json
+	Latency     time.Duration `yaml:"latency"`     // Added to every response
+	Jitter      time.Duration `yaml:"jitter"`      // Up to this much more is added at random
+	ErrorRate   float64       `yaml:"errorRate"`   // Share of requests answered with ErrorStatus, 0 to 1
+	ErrorStatus int           `yaml:"errorStatus"` // Status of injected errors
+}
+
+// StatusHeader lets a request pick one of the operation's documented responses or
+// any error status, such as X-Mock-Status: 404
+const StatusHeader = "X-Mock-Status"
+
+type document struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema  *schema `json:"schema"`
+			Example any     `json:"example"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Properties           map[string]*schema `json:"properties"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Enum                 []any              `json:"enum"`
+	Example              any                `json:"example"`
+	Default              any                `json:"default"`
+}
+
+// route is an operation's path template split into segments, "" matching any
+// parameter value
+type route struct {
+	segments []string
+	methods  map[string]operation
+}
+
+// Server answers requests for the operations of a document
+type Server struct {
+	cfg      Config
+	basePath string
+	routes   []route
+	schemas  map[string]*schema
+}
+
+// New loads the document named by the configuration
+func New(cfg Config) (*Server, error) {
+	raw, err := os.ReadFile(cfg.Spec)
+	if err != nil {
+		return nil, err
+	}
+	var doc document
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", cfg.Spec, err)
+	}
+	if cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+		return nil, fmt.Errorf("error rate %v is not between 0 and 1", cfg.ErrorRate)
+	}
+	if cfg.ErrorStatus == 0 {
+		cfg.ErrorStatus = http.StatusInternalServerError
+	}
+
+	s := &Server{cfg: cfg, schemas: doc.Components.Schemas}
+	if len(doc.Servers) > 0 {
+		s.basePath = strings.TrimRight(serverPath(doc.Servers[0].URL), "/")
+	}
+	for path, methods := range doc.Paths {
+		r := route{methods: make(map[string]operation, len(methods))}
+		for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+			if strings.HasPrefix(segment, "{") {
+				segment = ""
+			}
+			r.segments = append(r.segments, segment)
+		}
+		for method, op := range methods {
+			r.methods[strings.ToUpper(method)] = op
+		}
+		s.routes = append(s.routes, r)
+	}
+	// Literal segments win over parameters, so /users/me is preferred to /users/{id}
+	sort.Slice(s.routes, func(i, j int) bool {
+		return literals(s.routes[i].segments) > literals(s.routes[j].segments)
+	})
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if d := s.delay(); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	op, ok := s.match(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No mocked operation for "+r.Method+" "+r.URL.Path)
+		return
+	}
+
+	status := ""
+	if want := r.Header.Get(StatusHeader); want != "" {
+		if _, ok := op.Responses[want]; !ok {
+			// Undocumented error statuses get the API's error body
+			if code, err := strconv.Atoi(want); err == nil && code >= 400 && code <= 599 {
+				writeError(w, code, "Mocked error")
+			} else {
+				writeError(w, http.StatusBadRequest, "The operation documents no "+want+" response")
+			}
+			return
+		}
+		status = want
+	} else if s.cfg.ErrorRate > 0 && rand.Float64() < s.cfg.ErrorRate {
+		writeError(w, s.cfg.ErrorStatus, "Injected mock error")
+		return
+	} else {
+		status = success(op)
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		code = http.StatusOK
+	}
+	content, ok := op.Responses[status].Content["application/json"]
+	if !ok || (content.Schema == nil && content.Example == nil) {
+		w.WriteHeader(code)
+		return
+	}
+	body := content.Example
+	if body == nil {
+		body = s.example(content.Schema, "", 0)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Debug("failed to write mock response", zap.Error(err))
+	}
+}
+
+func (s *Server) delay() time.Duration {
+	d := s.cfg.Latency
+	if s.cfg.Jitter > 0 {
+		d += rand.N(s.cfg.Jitter)
+	}
+	return d
+}
+
+func (s *Server) match(r *http.Request) (operation, bool) {
+	path, ok := strings.CutPrefix(r.URL.Path, s.basePath)
+	if !ok {
+		return operation{}, false
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, rt := range s.routes {
+		if len(rt.segments) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, segment := range rt.segments {
+			if segment != "" && segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		op, ok := rt.methods[r.Method]
+		if !ok && r.Method == http.MethodHead {
+			op, ok = rt.methods[http.MethodGet]
+		}
+		if ok {
+			return op, true
+		}
+	}
+	return operation{}, false
+}
+
+// maxDepth stops examples of recursive schemas, such as a tree of comments
+const maxDepth = 6
+
+// example builds a value for s, using the document's examples, defaults and enums
+// where it has them and a placeholder of the right type otherwise
+func (s *Server) example(sc *schema, name string, depth int) any {
+	if sc == nil || depth > maxDepth {
+		return nil
+	}
+	if sc.Ref != "" {
+		return s.example(s.schemas[sc.Ref[strings.LastIndexByte(sc.Ref, '/')+1:]], name, depth+1)
+	}
+	switch {
+	case sc.Example != nil:
+		return sc.Example
+	case sc.Default != nil:
+		return sc.Default
+	case len(sc.Enum) > 0:
+		return sc.Enum[0]
+	}
+
+	switch sc.Type {
+	case "string":
+		return exampleString(sc.Format, name)
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	case "array":
+		if item := s.example(sc.Items, name, depth+1); item != nil {
+			return []any{item}
+		}
+		return []any{}
+	case "object":
+		out := make(map[string]any, len(sc.Properties))
+		for prop, ps := range sc.Properties {
+			out[prop] = s.example(ps, prop, depth+1)
+		}
+		if len(sc.Properties) == 0 && sc.AdditionalProperties != nil {
+			out["key"] = s.example(sc.AdditionalProperties, "", depth+1)
+		}
+		return out
+	}
+	return nil
+}
+
+func exampleString(format, name string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T12:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "byte":
+		return "ZXhhbXBsZQ=="
+	case "uuid":
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	}
+	switch lower := strings.ToLower(name); {
+	case lower == "id" || strings.HasSuffix(lower, "_id") || strings.HasSuffix(name, "Id"):
+		return "abc123"
+	case strings.Contains(lower, "email"):
+		return "user@example.com"
+	case strings.Contains(lower, "url"):
+		return "https://example.com"
+	case name != "":
+		return name
+	}
+	return "string"
+}
+
+// success returns the operation's first documented 2xx response
+func success(op operation) string {
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	if len(codes) == 0 {
+		return "default"
+	}
+	return codes[0]
+}
+
+func literals(segments []string) int {
+	n := 0
+	for _, segment := range segments {
+		if segment != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// serverPath returns the path of a server URL, which may be relative
+func serverPath(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+		if j := strings.IndexByte(url, '/'); j >= 0 {
+			return url[j:]
+		}
+		return ""
+	}
+	return url
+}
+
+// writeError answers in the API's error format
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"code":    strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		"message": message,
+	})
+}
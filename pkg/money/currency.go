@@ -0,0 +1,82 @@
+package money
+
+import "strings"
+
+// Currency is an ISO 4217 currency
+type Currency struct {
+	Code   string // Like EUR
+	Digits int    // Minor unit digits, 2 for cents
+	Symbol string // Like €, the code itself when there is no common symbol
+}
+
+// currencies are the ISO 4217 currencies in use, with the minor units they settle in
+var currencies = map[string]Currency{
+	"AED": {"AED", 2, "د.إ"},
+	"ARS": {"ARS", 2, "$"},
+	"AUD": {"AUD", 2, "A$"},
+	"BGN": {"BGN", 2, "лв"},
+	"BHD": {"BHD", 3, "BHD"},
+	"BRL": {"BRL", 2, "R$"},
+	"CAD": {"CAD", 2, "CA$"},
+	"CHF": {"CHF", 2, "CHF"},
+	"CLP": {"CLP", 0, "$"},
+	"CNY": {"CNY", 2, "¥"},
+	"COP": {"COP", 2, "$"},
+	"CZK": {"CZK", 2, "Kč"},
+	"DKK": {"DKK", 2, "kr"},
+	"EGP": {"EGP", 2, "E£"},
+	"EUR": {"EUR", 2, "€"},
+	"GBP": {"GBP", 2, "£"},
+	"HKD": {"HKD", 2, "HK$"},
+	"HUF": {"HUF", 2, "Ft"},
+	"IDR": {"IDR", 2, "Rp"},
+	"ILS": {"ILS", 2, "₪"},
+	"INR": {"INR", 2, "₹"},
+	"ISK": {"ISK", 0, "kr"},
+	"JOD": {"JOD", 3, "JOD"},
+	"JPY": {"JPY", 0, "¥"},
+	"KRW": {"KRW", 0, "₩"},
+	"KWD": {"KWD", 3, "KWD"},
+	"MAD": {"MAD", 2, "MAD"},
+	"MXN": {"MXN", 2, "MX$"},
+	"MYR": {"MYR", 2, "RM"},
+	"NGN": {"NGN", 2, "₦"},
+	"NOK": {"NOK", 2, "kr"},
+	"NZD": {"NZD", 2, "NZ$"},
+	"OMR": {"OMR", 3, "OMR"},
+	"PHP": {"PHP", 2, "₱"},
+	"PKR": {"PKR", 2, "Rs"},
+	"PLN": {"PLN", 2, "zł"},
+	"RON": {"RON", 2, "lei"},
+	"RSD": {"RSD", 2, "RSD"},
+	"SAR": {"SAR", 2, "SAR"},
+	"SEK": {"SEK", 2, "kr"},
+	"SGD": {"SGD", 2, "S$"},
+	"THB": {"THB", 2, "฿"},
+	"TND": {"TND", 3, "TND"},
+	"TRY": {"TRY", 2, "₺"},
+	"TWD": {"TWD", 2, "NT$"},
+	"UAH": {"UAH", 2, "₴"},
+	"UGX": {"UGX", 0, "USh"},
+	"USD": {"USD", 2, "$"},
+	"VND": {"VND", 0, "₫"},
+	"XAF": {"XAF", 0, "FCFA"},
+	"XOF": {"XOF", 0, "CFA"},
+	"ZAR": {"ZAR", 2, "R"},
+}
+
+// Lookup returns the currency with an ISO 4217 code, in any case
+func Lookup(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(code)]
+	return c, ok
+}
+
+// RegisterCurrency adds or replaces a currency, for codes missing from the built-in
+// table. Call it at startup, before amounts are parsed.
+func RegisterCurrency(c Currency) {
+	c.Code = strings.ToUpper(c.Code)
+	if c.Symbol == "" {
+		c.Symbol = c.Code
+	}
+	currencies[c.Code] = c
+}
@@ -0,0 +1,90 @@
+package money
+
+import "strings"
+
+// Locale describes how a language and region write amounts
+type Locale struct {
+	Decimal      string // Decimal separator
+	Group        string // Thousands separator
+	SymbolAfter  bool   // 12,34 € rather than €12.34
+	SymbolSpaced bool   // A space between the symbol and the number
+}
+
+var locales = map[string]Locale{
+	"en":    {".", ",", false, false},
+	"pt-br": {",", ".", false, true},
+	"es-mx": {".", ",", false, false},
+	"nl":    {",", ".", false, true},
+	"de":    {",", ".", true, true},
+	"de-ch": {".", "’", false, true},
+	"fr":    {",", " ", true, true},
+	"fr-ch": {",", " ", true, true},
+	"es":    {",", ".", true, true},
+	"it":    {",", ".", true, true},
+	"pt":    {",", " ", true, true},
+	"pl":    {",", " ", true, true},
+	"cs":    {",", " ", true, true},
+	"sv":    {",", " ", true, true},
+	"da":    {",", ".", true, true},
+	"nb":    {",", " ", true, true},
+	"fi":    {",", " ", true, true},
+	"ru":    {",", " ", true, true},
+	"tr":    {",", ".", false, false},
+}
+
+// RegisterLocale adds or replaces the formatting of a language tag like de or pt-BR
+func RegisterLocale(tag string, l Locale) {
+	locales[strings.ToLower(tag)] = l
+}
+
+// Format writes the amount the way a locale does, like $1,234.56 for en-US or
+// 1.234,56 € for de-DE. Tags fall back to their language, then to English.
+func (m Money) Format(tag string) string {
+	l := locale(tag)
+	amount := m.Abs().Amount()
+	whole, frac, _ := strings.Cut(amount, ".")
+
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(l.Decimal)
+		b.WriteString(frac)
+	}
+	number := b.String()
+
+	symbol := m.currency.Symbol
+	if symbol == "" {
+		symbol = m.currency.Code
+	}
+	space := ""
+	// Codes used as symbols are always set apart, as in CHF 12.00
+	if l.SymbolSpaced || symbol == m.currency.Code {
+		space = " "
+	}
+	out := symbol + space + number
+	if l.SymbolAfter {
+		out = number + space + symbol
+	}
+	if m.minor < 0 {
+		out = "-" + out
+	}
+	return out
+}
+
+func locale(tag string) Locale {
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	if l, ok := locales[tag]; ok {
+		return l
+	}
+	if lang, _, ok := strings.Cut(tag, "-"); ok {
+		if l, ok := locales[lang]; ok {
+			return l
+		}
+	}
+	return locales["en"]
+}
@@ -0,0 +1,381 @@
+// Package money handles amounts of money as whole minor units of a currency, like
+// cents, so sums never pick up the rounding errors of float64. Arithmetic that can
+// produce fractions of a minor unit takes an explicit rounding mode.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("money: unknown currency")
+	ErrCurrencyMismatch = errors.New("money: currencies don't match")
+	ErrInvalidAmount    = errors.New("money: invalid amount")
+	ErrOverflow         = errors.New("money: amount out of range")
+)
+
+// Handlers returning these errors respond with a validation error
+func init() {
+	for _, err := range []error{ErrUnknownCurrency, ErrCurrencyMismatch, ErrInvalidAmount, ErrOverflow} {
+		apperrors.Register(err, apperrors.CodeValidation)
+	}
+}
+
+// Rounding decides what happens to fractions of a minor unit
+type Rounding int
+
+const (
+	HalfEven Rounding = iota // To the nearest unit, ties to even: banker's rounding
+	HalfUp                   // To the nearest unit, ties away from zero
+	Down                     // Towards zero, truncating
+	Up                       // Away from zero
+	Floor                    // Towards negative infinity
+	Ceil                     // Towards positive infinity
+)
+
+// Money is an amount in a currency. The zero value has no currency and can only be
+// compared; use Zero for an empty amount to add to.
+type Money struct {
+	minor    int64
+	currency Currency
+}
+
+// New returns minor units, like cents, of the currency with an ISO 4217 code
+func New(minor int64, code string) (Money, error) {
+	c, ok := Lookup(code)
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, code)
+	}
+	return Money{minor, c}, nil
+}
+
+// Zero returns no money in a currency
+func Zero(code string) (Money, error) {
+	return New(0, code)
+}
+
+// Parse reads a decimal amount like 12.34 or -0.5 in a currency. More decimals than
+// the currency has minor units are rejected rather than rounded.
+func Parse(amount, code string) (Money, error) {
+	c, ok := Lookup(code)
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, code)
+	}
+	r, ok := parseDecimal(amount)
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, amount)
+	}
+	r.Mul(r, scale(c.Digits))
+	if !r.IsInt() {
+		return Money{}, fmt.Errorf("%w: %s has more than %d decimals", ErrInvalidAmount, amount, c.Digits)
+	}
+	if !r.Num().IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{r.Num().Int64(), c}, nil
+}
+
+// MustParse is Parse for constants, panicking on errors
+func MustParse(amount, code string) Money {
+	m, err := Parse(amount, code)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Minor returns the amount in minor units, like cents
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+// Currency returns the amount's currency
+func (m Money) Currency() Currency {
+	return m.currency
+}
+
+func (m Money) IsZero() bool     { return m.minor == 0 }
+func (m Money) IsNegative() bool { return m.minor < 0 }
+func (m Money) IsPositive() bool { return m.minor > 0 }
+
+// Neg returns the amount with the opposite sign
+func (m Money) Neg() Money {
+	return Money{-m.minor, m.currency}
+}
+
+// Abs returns the amount without its sign
+func (m Money) Abs() Money {
+	if m.minor < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Add returns the sum of amounts in the same currency
+func (m Money) Add(o Money) (Money, error) {
+	if m.currency != o.currency {
+		return Money{}, m.mismatch(o)
+	}
+	sum := m.minor + o.minor
+	if (sum > m.minor) != (o.minor > 0) {
+		return Money{}, ErrOverflow
+	}
+	return Money{sum, m.currency}, nil
+}
+
+// Sub returns the difference of amounts in the same currency
+func (m Money) Sub(o Money) (Money, error) {
+	if o.minor == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(o.Neg())
+}
+
+// Cmp compares amounts in the same currency, returning -1, 0 or 1
+func (m Money) Cmp(o Money) (int, error) {
+	if m.currency != o.currency {
+		return 0, m.mismatch(o)
+	}
+	switch {
+	case m.minor < o.minor:
+		return -1, nil
+	case m.minor > o.minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Mul multiplies the amount by a decimal factor like 1.19 or 0.075, rounding the
+// result to whole minor units
+func (m Money) Mul(factor string, mode Rounding) (Money, error) {
+	f, ok := parseDecimal(factor)
+	if !ok {
+		return Money{}, fmt.Errorf("%w factor %q", ErrInvalidAmount, factor)
+	}
+	return m.mulRat(f, mode)
+}
+
+// Div divides the amount by n, rounding the result to whole minor units. Use
+// Allocate instead to split an amount without losing units.
+func (m Money) Div(n int64, mode Rounding) (Money, error) {
+	if n == 0 {
+		return Money{}, fmt.Errorf("%w: division by zero", ErrInvalidAmount)
+	}
+	return m.mulRat(big.NewRat(1, n), mode)
+}
+
+// Convert exchanges the amount to another currency at a decimal rate, the units
+// of the target currency one unit of this one buys
+func (m Money) Convert(code, rate string, mode Rounding) (Money, error) {
+	c, ok := Lookup(code)
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, code)
+	}
+	r, ok := parseDecimal(rate)
+	if !ok || r.Sign() <= 0 {
+		return Money{}, fmt.Errorf("%w rate %q", ErrInvalidAmount, rate)
+	}
+	// Rescale from this currency's minor units to the target's
+	r.Mul(r, scale(c.Digits))
+	r.Quo(r, scale(m.currency.Digits))
+	out, err := m.mulRat(r, mode)
+	out.currency = c
+	return out, err
+}
+
+// Allocate splits the amount in proportion to weights, like 1, 1, 1 for thirds.
+// Units that don't divide evenly go to the first shares, so the parts always add up
+// to the amount.
+func (m Money) Allocate(weights ...int64) ([]Money, error) {
+	var total int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("%w: negative weight %d", ErrInvalidAmount, w)
+		}
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: weights add up to zero", ErrInvalidAmount)
+	}
+
+	parts := make([]Money, len(weights))
+	remainder := m.minor
+	for i, w := range weights {
+		share := new(big.Int).Mul(big.NewInt(m.minor), big.NewInt(w))
+		share.Quo(share, big.NewInt(total))
+		parts[i] = Money{share.Int64(), m.currency}
+		remainder -= parts[i].minor
+	}
+	unit := int64(1)
+	if remainder < 0 {
+		unit = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(parts) {
+		if weights[i] == 0 {
+			continue
+		}
+		parts[i].minor += unit
+		remainder -= unit
+	}
+	return parts, nil
+}
+
+func (m Money) mulRat(f *big.Rat, mode Rounding) (Money, error) {
+	r := new(big.Rat).Mul(new(big.Rat).SetInt64(m.minor), f)
+	n := round(r, mode)
+	if !n.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{n.Int64(), m.currency}, nil
+}
+
+func (m Money) mismatch(o Money) error {
+	return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency.Code, o.currency.Code)
+}
+
+// Amount returns the decimal amount without the currency, like 12.34
+func (m Money) Amount() string {
+	digits := m.currency.Digits
+	s := new(big.Int).Abs(big.NewInt(m.minor)).String()
+	if digits > 0 {
+		if len(s) <= digits {
+			s = strings.Repeat("0", digits-len(s)+1) + s
+		}
+		s = s[:len(s)-digits] + "." + s[len(s)-digits:]
+	}
+	if m.minor < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// String returns the amount and currency code, like 12.34 EUR
+func (m Money) String() string {
+	if m.currency.Code == "" {
+		return m.Amount()
+	}
+	return m.Amount() + " " + m.currency.Code
+}
+
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as {"amount": "12.34", "currency": "EUR"}. The
+// amount is a string so clients don't parse it into a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{m.Amount(), m.currency.Code})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	parsed, err := Parse(v.Amount, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount in a text column as "12.34 EUR". Store Minor and the
+// currency code in separate columns instead where amounts are summed in SQL.
+func (m Money) Value() (driver.Value, error) {
+	if m.currency.Code == "" {
+		return nil, nil
+	}
+	return m.String(), nil
+}
+
+func (m *Money) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("money: can't scan %T", src)
+	}
+	amount, code, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return fmt.Errorf("%w %q, want an amount and currency", ErrInvalidAmount, s)
+	}
+	parsed, err := Parse(amount, code)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// parseDecimal reads a plain decimal like -12.340, without exponents or separators
+func parseDecimal(s string) (*big.Rat, bool) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" {
+		return nil, false
+	}
+	for _, part := range []string{whole, frac} {
+		if strings.Trim(part, "0123456789") != "" {
+			return nil, false
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	return r, ok
+}
+
+func scale(digits int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil))
+}
+
+// round rounds r to an integer
+func round(r *big.Rat, mode Rounding) *big.Int {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+	negative := r.Sign() < 0
+	away := false
+	switch mode {
+	case Down:
+	case Up:
+		away = true
+	case Floor:
+		away = negative
+	case Ceil:
+		away = !negative
+	case HalfUp, HalfEven:
+		// Compare twice the remainder with the denominator to find which half it's in
+		half := new(big.Int).Abs(rem)
+		half.Lsh(half, 1)
+		switch half.Cmp(r.Denom()) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == HalfUp || q.Bit(0) == 1
+		}
+	}
+	if away {
+		if negative {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
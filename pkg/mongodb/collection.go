@@ -0,0 +1,96 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Collection stores records of type T, identified by their key field, like id.
+// Records missing from it are reported with the notFound error, like the SQL
+// stores do.
+type Collection[T any] struct {
+	coll     *mongo.Collection
+	key      string
+	notFound error
+}
+
+// NewCollection returns the collection name of c's database
+func NewCollection[T any](c *Client, name, key string, notFound error) Collection[T] {
+	return Collection[T]{coll: c.db.Collection(name), key: key, notFound: notFound}
+}
+
+// EnsureIndexes creates the indexes declared on T
+func (c Collection[T]) EnsureIndexes(ctx context.Context) error {
+	var model T
+	return EnsureIndexes(ctx, c.coll, model)
+}
+
+// Mongo returns the underlying collection, for updates the helpers don't cover
+func (c Collection[T]) Mongo() *mongo.Collection {
+	return c.coll
+}
+
+// Get returns the record with the key
+func (c Collection[T]) Get(ctx context.Context, key string) (T, error) {
+	return c.FindOne(ctx, bson.D{{Key: c.key, Value: key}})
+}
+
+// FindOne returns the first record matching filter
+func (c Collection[T]) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	var v T
+	err := c.coll.FindOne(ctx, filter, opts...).Decode(&v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return v, c.notFound
+	}
+	return v, err
+}
+
+// Find returns the records matching filter, never nil
+func (c Collection[T]) Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error) {
+	cursor, err := c.coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	list := []T{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Save inserts or replaces the record with the key
+func (c Collection[T]) Save(ctx context.Context, key string, v T) error {
+	_, err := c.coll.ReplaceOne(ctx, bson.D{{Key: c.key, Value: key}}, v, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Delete removes the record with the key, returning the notFound error when
+// there is none
+func (c Collection[T]) Delete(ctx context.Context, key string) error {
+	res, err := c.coll.DeleteOne(ctx, bson.D{{Key: c.key, Value: key}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return c.notFound
+	}
+	return nil
+}
+
+// DeleteMany removes the records matching filter, returning how many there were
+func (c Collection[T]) DeleteMany(ctx context.Context, filter any) (int64, error) {
+	res, err := c.coll.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// Count returns how many records match filter
+func (c Collection[T]) Count(ctx context.Context, filter any) (int64, error) {
+	return c.coll.CountDocuments(ctx, filter)
+}
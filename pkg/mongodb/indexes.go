@@ -0,0 +1,155 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EnsureIndexes creates the indexes declared by the index tags of model's fields.
+// A tag names the index, followed by options:
+//
+//	ID        string    `json:"id" index:",unique"`
+//	OwnerID   string    `json:"ownerId" index:"owner_created"`
+//	CreatedAt time.Time `json:"createdAt" index:"owner_created,desc"`
+//
+// Without a name the field is indexed on its own. Fields sharing a name make up a
+// compound index, in field order. The options are desc for a descending key,
+// unique and sparse, which apply to the whole index, and ttl=<duration>, which
+// removes documents that long after the time in the field. Created indexes are
+// left alone, so changing one needs it dropped first.
+func EnsureIndexes(ctx context.Context, coll *mongo.Collection, model any) error {
+	indexes, err := parseIndexes(reflect.TypeOf(model))
+	if err != nil || len(indexes) == 0 {
+		return err
+	}
+	existing, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return fmt.Errorf("mongodb: indexes of %s: %w", coll.Name(), err)
+	}
+	created := make(map[string]bool, len(existing))
+	for _, spec := range existing {
+		created[spec.Name] = true
+	}
+	var missing []mongo.IndexModel
+	for _, idx := range indexes {
+		if !created[idx.name] {
+			missing = append(missing, idx.model())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if _, err := coll.Indexes().CreateMany(ctx, missing); err != nil {
+		return fmt.Errorf("mongodb: indexes of %s: %w", coll.Name(), err)
+	}
+	return nil
+}
+
+type index struct {
+	name    string
+	keys    bson.D
+	unique  bool
+	sparse  bool
+	expires *time.Duration
+}
+
+// parseIndexes reads the index tags of struct type t
+func parseIndexes(t reflect.Type) ([]*index, error) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("mongodb: indexes need a struct, got %v", t)
+	}
+
+	var indexes []*index
+	byName := make(map[string]*index)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("index")
+		if !ok {
+			continue
+		}
+		key := fieldName(f)
+		if key == "" {
+			return nil, fmt.Errorf("mongodb: %s.%s is indexed but not stored", t.Name(), f.Name)
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "" {
+			name = key
+		}
+		idx, ok := byName[name]
+		if !ok {
+			idx = &index{name: name}
+			byName[name] = idx
+			indexes = append(indexes, idx)
+		}
+
+		order := 1
+		for _, opt := range opts[1:] {
+			switch {
+			case opt == "desc":
+				order = -1
+			case opt == "unique":
+				idx.unique = true
+			case opt == "sparse":
+				idx.sparse = true
+			case strings.HasPrefix(opt, "ttl="):
+				d, err := time.ParseDuration(strings.TrimPrefix(opt, "ttl="))
+				if err != nil {
+					return nil, fmt.Errorf("mongodb: %s.%s: invalid ttl: %w", t.Name(), f.Name, err)
+				}
+				idx.expires = &d
+			default:
+				return nil, fmt.Errorf("mongodb: %s.%s: unknown index option %q", t.Name(), f.Name, opt)
+			}
+		}
+		idx.keys = append(idx.keys, bson.E{Key: key, Value: order})
+	}
+
+	for _, idx := range indexes {
+		if idx.expires != nil && len(idx.keys) > 1 {
+			return nil, fmt.Errorf("mongodb: %s: ttl index %s has more than one field", t.Name(), idx.name)
+		}
+	}
+	return indexes, nil
+}
+
+func (idx *index) model() mongo.IndexModel {
+	opts := options.Index().SetName(idx.name)
+	if idx.unique {
+		opts.SetUnique(true)
+	}
+	if idx.sparse {
+		opts.SetSparse(true)
+	}
+	if idx.expires != nil {
+		opts.SetExpireAfterSeconds(int32(idx.expires.Seconds()))
+	}
+	return mongo.IndexModel{Keys: idx.keys, Options: opts}
+}
+
+// fieldName is the key a field is stored under: its bson name, falling back to its
+// json name as the client is configured to, then to the lowercased field name
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"bson", "json"} {
+		if tag, ok := f.Tag.Lookup(key); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+	}
+	return strings.ToLower(f.Name)
+}
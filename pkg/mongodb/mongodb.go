@@ -0,0 +1,115 @@
+// Package mongodb keeps records in MongoDB for modules whose data is document
+// shaped. Records are stored with their JSON field names, so the structs the API
+// returns are the documents, and their index tags declare the collection indexes.
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+// Config holds the MongoDB connection
+type Config struct {
+	URI            string        `yaml:"uri"` // mongodb:// or mongodb+srv:// connection string
+	Database       string        `yaml:"database"`
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+	MaxPoolSize    uint64        `yaml:"maxPoolSize"` // Connections per server
+}
+
+// Client is a connection pool to one database
+type Client struct {
+	client       *mongo.Client
+	db           *mongo.Database
+	transactions bool
+}
+
+// Connect opens a connection pool and verifies it with a ping. It returns nil
+// when no URI is configured.
+func Connect(cfg Config) (*Client, error) {
+	if cfg.URI == "" {
+		return nil, nil
+	}
+	if cfg.Database == "" {
+		return nil, errors.New("mongodb: no database configured")
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = 10 * time.Second
+	}
+	opts := options.Client().ApplyURI(cfg.URI).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.ConnectTimeout).
+		SetBSONOptions(&options.BSONOptions{UseJSONStructTags: true, DefaultDocumentM: true, NilMapAsEmpty: true})
+	if cfg.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(cfg.MaxPoolSize)
+	}
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+	c := &Client{client: client, db: client.Database(cfg.Database)}
+	if err := c.Ping(ctx); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	if c.transactions, err = supportsTransactions(ctx, client); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return c, nil
+}
+
+// supportsTransactions reports whether the deployment is a replica set or sharded
+// cluster; standalone servers have no transactions
+func supportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// Ping checks that the primary is reachable, for health checks
+func (c *Client) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx, readpref.Primary())
+}
+
+// Close closes the connections once operations in progress are done
+func (c *Client) Close(ctx context.Context) error {
+	return c.client.Disconnect(ctx)
+}
+
+// Database returns the configured database
+func (c *Client) Database() *mongo.Database {
+	return c.db
+}
+
+// Transaction runs fn in a transaction when the deployment supports them, and
+// as separate operations on a standalone server. Operations in fn have to use
+// the context it is given to be part of the transaction. fn may be run again
+// when the transaction hits a transient error.
+func (c *Client) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !c.transactions {
+		return fn(ctx)
+	}
+	session, err := c.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
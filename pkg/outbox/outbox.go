@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"go-api/pkg/database"
+	"go-api/pkg/eventstore"
+)
+
+// Outbox records domain events in the same transaction as the state change that
+// caused them, so consumers such as projections never miss or see phantom events.
+// Events are read back in commit order through ReadAll, like the event store:
+// on Postgres, Add holds an advisory lock until tx ends, so transactions adding
+// events commit one after another and positions become visible in order.
+type Outbox struct {
+	db *sql.DB
+}
+
+// New creates an outbox stored in the outbox_events table
+func New(db *sql.DB) *Outbox {
+	return &Outbox{db: db}
+}
+
+// EnsureSchema creates the outbox_events table if it does not exist
+func (o *Outbox) EnsureSchema(ctx context.Context) error {
+	_, err := o.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS outbox_events (
+			position    %s,
+			id          TEXT NOT NULL UNIQUE,
+			aggregate   TEXT NOT NULL,
+			type        TEXT NOT NULL,
+			data        TEXT NOT NULL,
+			metadata    TEXT NOT NULL DEFAULT '{}',
+			recorded_at TIMESTAMP NOT NULL
+		)`, database.AutoIncrement(o.db)))
+	return err
+}
+
+// Add writes events for an aggregate inside tx. Call it late in tx, as other
+// transactions adding events wait for tx to end.
+func (o *Outbox) Add(ctx context.Context, tx *sql.Tx, aggregateID string, events ...eventstore.NewEvent) error {
+	built, err := eventstore.Build(aggregateID, 0, events)
+	if err != nil {
+		return err
+	}
+	if err := eventstore.LockAppends(ctx, o.db, tx, "outbox:events"); err != nil {
+		return err
+	}
+	for _, e := range built {
+		metadata, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO outbox_events (id, aggregate, type, data, metadata, recorded_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			e.ID, e.StreamID, e.Type, string(e.Data), string(metadata), e.RecordedAt,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadAll returns up to limit events recorded after a position
+func (o *Outbox) ReadAll(ctx context.Context, afterPosition int64, limit int) ([]eventstore.Event, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	rows, err := o.db.QueryContext(ctx, `
+		SELECT position, id, aggregate, type, data, metadata, recorded_at
+		FROM outbox_events WHERE position > $1 ORDER BY position LIMIT $2`,
+		afterPosition, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []eventstore.Event
+	for rows.Next() {
+		var e eventstore.Event
+		var data, metadata string
+		if err := rows.Scan(&e.Position, &e.ID, &e.StreamID, &e.Type, &data, &metadata, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		e.Data = json.RawMessage(data)
+		if err := json.Unmarshal([]byte(metadata), &e.Metadata); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// LastPosition returns the position of the newest event, 0 when empty
+func (o *Outbox) LastPosition(ctx context.Context) (int64, error) {
+	var position int64
+	err := o.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(position), 0) FROM outbox_events`).Scan(&position)
+	return position, err
+}
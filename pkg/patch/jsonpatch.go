@@ -0,0 +1,251 @@
+package patch
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// Operation is one step of an RFC 6902 JSON Patch
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+func applyOperations(doc any, ops []Operation) (any, error) {
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case "add":
+			doc, err = add(doc, op.Path, op.Value)
+		case "remove":
+			doc, _, err = remove(doc, op.Path)
+		case "replace":
+			if op.Path == "" {
+				doc = op.Value
+				break
+			}
+			if doc, _, err = remove(doc, op.Path); err == nil {
+				doc, err = add(doc, op.Path, op.Value)
+			}
+		case "move":
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				err = fmt.Errorf("can't move %s into itself", op.From)
+				break
+			}
+			var value any
+			if doc, value, err = remove(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, value)
+			}
+		case "copy":
+			var value any
+			if value, err = get(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, deepCopy(value))
+			}
+		case "test":
+			var value any
+			if value, err = get(doc, op.Path); err == nil && !equal(value, op.Value) {
+				return nil, apperrors.NewConflictError(fmt.Sprintf("test failed at %s", op.Path))
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, apperrors.NewValidationError("Invalid JSON patch", apperrors.FieldError{
+				Pointer: apperrors.Pointer(strconv.Itoa(i)),
+				Field:   "op",
+				Rule:    "operation",
+				Message: err.Error(),
+			})
+		}
+	}
+	return doc, nil
+}
+
+// equal compares JSON values, treating numbers decoded differently as equal
+func equal(a, b any) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = normalize(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = normalize(e)
+		}
+		return l
+	case fmt.Stringer: // json.Number
+		if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+			return f
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// split parses an RFC 6901 JSON pointer into unescaped tokens
+func split(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func index(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (!allowEnd && i == length) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func get(doc any, pointer string) (any, error) {
+	tokens, err := split(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			doc = v
+		case []any:
+			i, err := index(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+	}
+	return doc, nil
+}
+
+// update replaces the parent container of pointer with the result of fn, which gets
+// the container and the last token
+func update(doc any, pointer string, fn func(parent any, token string) (any, error)) (any, error) {
+	tokens, err := split(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return fn(nil, "")
+	}
+	return updateAt(doc, tokens, fn)
+}
+
+func updateAt(node any, tokens []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("path member %q does not exist", tokens[0])
+		}
+		updated, err := updateAt(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = updated
+		return n, nil
+	case []any:
+		i, err := index(tokens[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateAt(n[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("path member %q does not exist", tokens[0])
+	}
+}
+
+func add(doc any, pointer string, value any) (any, error) {
+	return update(doc, pointer, func(parent any, token string) (any, error) {
+		if parent == nil && token == "" {
+			return value, nil
+		}
+		switch p := parent.(type) {
+		case map[string]any:
+			p[token] = value
+			return p, nil
+		case []any:
+			i, err := index(token, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("can't add to %s", pointer)
+		}
+	})
+}
+
+func remove(doc any, pointer string) (any, any, error) {
+	var removed any
+	doc, err := update(doc, pointer, func(parent any, token string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			v, ok := p[token]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			removed = v
+			delete(p, token)
+			return p, nil
+		case []any:
+			i, err := index(token, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = p[i]
+			return append(p[:i], p[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+	})
+	return doc, removed, err
+}
@@ -0,0 +1,244 @@
+// Package patch applies partial updates to domain structs, as JSON Merge Patch
+// (RFC 7396) or JSON Patch (RFC 6902). The struct is round-tripped through its JSON
+// form, the fields that changed are checked against field-level hooks and the result
+// is validated like a bound request body.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Media types of the supported patch documents
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// FieldHook is called with the JSON pointer (e.g. "/roles") of every field a patch
+// changes; returning an error rejects the whole patch
+type FieldHook func(path string) error
+
+type options struct {
+	hooks []FieldHook
+}
+
+// Option customizes how a patch is applied
+type Option func(*options)
+
+// Authorize adds a field-level check, e.g. one that calls authz.Authorize per field
+func Authorize(hook FieldHook) Option {
+	return func(o *options) { o.hooks = append(o.hooks, hook) }
+}
+
+// ReadOnly rejects changes to the given JSON pointers and anything below them
+func ReadOnly(paths ...string) Option {
+	return Authorize(func(path string) error {
+		for _, p := range paths {
+			if path == p || strings.HasPrefix(path, p+"/") {
+				return apperrors.NewForbiddenError(fmt.Sprintf("field %s can't be modified", p))
+			}
+		}
+		return nil
+	})
+}
+
+// Apply patches target, a pointer to a struct, with the request body. The patch
+// format is chosen by Content-Type; plain application/json is treated as a merge
+// patch. It returns the JSON pointers of the changed fields.
+func Apply(c *gin.Context, target any, opts ...Option) ([]string, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	switch mediaType {
+	case MergePatchType, binding.MIMEJSON, "":
+		return MergePatch(target, body, opts...)
+	case JSONPatchType:
+		return JSONPatch(target, body, opts...)
+	default:
+		return nil, &apperrors.AppError{
+			Code:       "UNSUPPORTED_MEDIA_TYPE",
+			Message:    "PATCH accepts " + MergePatchType + " or " + JSONPatchType,
+			StatusCode: 415,
+		}
+	}
+}
+
+// MergePatch applies an RFC 7396 merge patch to target
+func MergePatch(target any, patch []byte, opts ...Option) ([]string, error) {
+	var p any
+	if err := decode(patch, &p); err != nil {
+		return nil, apperrors.NewValidationErrorFrom("Invalid merge patch", err)
+	}
+	return apply(target, func(doc any) (any, error) { return merge(doc, p), nil }, opts)
+}
+
+// JSONPatch applies an RFC 6902 patch to target
+func JSONPatch(target any, patch []byte, opts ...Option) ([]string, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, apperrors.NewValidationErrorFrom("Invalid JSON patch", err)
+	}
+	return apply(target, func(doc any) (any, error) { return applyOperations(doc, ops) }, opts)
+}
+
+func decode(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func apply(target any, fn func(doc any) (any, error), opts []Option) ([]string, error) {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("patch: expected a pointer to a struct, got %T", target)
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	original, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := decode(original, &doc); err != nil {
+		return nil, err
+	}
+	before := deepCopy(doc)
+
+	after, err := fn(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := diff(before, after, "")
+	sort.Strings(changed)
+	for _, path := range changed {
+		for _, hook := range o.hooks {
+			if err := hook(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	patched, err := json.Marshal(after)
+	if err != nil {
+		return nil, err
+	}
+	// Decode into a zero value so removed fields are cleared, then carry over what
+	// the JSON form doesn't include
+	result := reflect.New(rv.Elem().Type())
+	if err := json.Unmarshal(patched, result.Interface()); err != nil {
+		return nil, apperrors.NewValidationErrorFrom("Patched document is invalid", err)
+	}
+	keepHidden(result.Elem(), rv.Elem())
+	if err := binding.Validator.ValidateStruct(result.Interface()); err != nil {
+		return nil, apperrors.NewValidationErrorFrom("Patched document is invalid", err)
+	}
+
+	rv.Elem().Set(result.Elem())
+	return changed, nil
+}
+
+// keepHidden copies fields that don't take part in JSON, like password hashes tagged
+// json:"-" and unexported state, from the original
+func keepHidden(dst, src reflect.Value) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Tag.Get("json") == "-" {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// merge implements RFC 7396: objects are merged recursively, null removes a member
+// and any other value replaces the target
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = merge(t[key], value)
+	}
+	return t
+}
+
+// diff returns the JSON pointers where a and b differ. Objects are compared member
+// by member, anything else as a whole.
+func diff(a, b any, path string) []string {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if !aok || !bok {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		if path == "" {
+			return []string{"/"}
+		}
+		return []string{path}
+	}
+
+	var changed []string
+	for key, av := range am {
+		bv, ok := bm[key]
+		if !ok {
+			changed = append(changed, path+"/"+escape(key))
+			continue
+		}
+		changed = append(changed, diff(av, bv, path+"/"+escape(key))...)
+	}
+	for key := range bm {
+		if _, ok := am[key]; !ok {
+			changed = append(changed, path+"/"+escape(key))
+		}
+	}
+	return changed
+}
+
+func deepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = deepCopy(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
@@ -0,0 +1,468 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	fontSize   = 10.0 // Points
+	lineHeight = 5.0  // Millimetres
+	cellPad    = 1.5
+)
+
+var headingSizes = map[atom.Atom]float64{atom.H1: 18, atom.H2: 14, atom.H3: 12}
+
+// layout walks the HTML tree, writing it to the PDF
+type layout struct {
+	pdf    *fpdf.Fpdf
+	family string
+	text   func(string) string // Translates UTF-8 for the font in use
+
+	bold, italic, underline int // Nesting depths of the inline styles
+	size                    float64
+	align                   string // Of the current block: L, C or R
+	lists                   []int  // Item counters of nested lists, -1 for bullets
+}
+
+func (l *layout) render(source string) error {
+	root, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return err
+	}
+	if title := find(root, atom.Title); title != nil {
+		l.pdf.SetTitle(textOf(title), true)
+	}
+	l.pdf.SetCreator("go-api", true)
+	l.pdf.AliasNbPages("")
+	l.pdf.SetFooterFunc(func() {
+		l.pdf.SetY(-12)
+		l.pdf.SetFont(l.family, "", 8)
+		l.pdf.SetTextColor(128, 128, 128)
+		l.pdf.CellFormat(0, 5, l.text("Page "+strconv.Itoa(l.pdf.PageNo())+" of {nb}"), "", 0, "C", false, 0, "")
+		l.pdf.SetTextColor(0, 0, 0)
+	})
+	l.pdf.SetMargins(18, 18, 18)
+	l.pdf.SetAutoPageBreak(true, 18)
+	l.pdf.AddPage()
+	l.size, l.align = fontSize, "L"
+	l.font()
+
+	body := find(root, atom.Body)
+	if body == nil {
+		body = root
+	}
+	l.children(body)
+	return l.pdf.Error()
+}
+
+func (l *layout) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		l.node(c)
+	}
+}
+
+func (l *layout) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		l.write(collapse(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		l.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Title:
+	case atom.B, atom.Strong, atom.Th:
+		l.bold++
+		l.font()
+		l.children(n)
+		l.bold--
+		l.font()
+	case atom.I, atom.Em:
+		l.italic++
+		l.font()
+		l.children(n)
+		l.italic--
+		l.font()
+	case atom.U:
+		l.underline++
+		l.font()
+		l.children(n)
+		l.underline--
+		l.font()
+	case atom.Br:
+		l.pdf.Ln(lineHeight)
+	case atom.Hr:
+		l.breakLine()
+		left, _, right, _ := l.pdf.GetMargins()
+		width, _ := l.pdf.GetPageSize()
+		y := l.pdf.GetY() + lineHeight/2
+		l.pdf.SetDrawColor(180, 180, 180)
+		l.pdf.Line(left, y, width-right, y)
+		l.pdf.SetDrawColor(0, 0, 0)
+		l.pdf.Ln(lineHeight)
+	case atom.H1, atom.H2, atom.H3:
+		l.block(n, func() {
+			size := l.size
+			l.size = headingSizes[n.DataAtom]
+			l.bold++
+			l.font()
+			l.children(n)
+			l.bold--
+			l.size = size
+		}, 2)
+	case atom.P, atom.Div:
+		l.block(n, func() { l.children(n) }, 1.5)
+	case atom.Ul, atom.Ol:
+		counter := -1
+		if n.DataAtom == atom.Ol {
+			counter = 0
+		}
+		l.lists = append(l.lists, counter)
+		l.block(n, func() { l.children(n) }, 1)
+		l.lists = l.lists[:len(l.lists)-1]
+	case atom.Li:
+		l.item(n)
+	case atom.Table:
+		l.breakLine()
+		l.table(n)
+		l.pdf.Ln(2)
+	default:
+		l.children(n)
+	}
+}
+
+// block starts content on a line of its own, with space after it
+func (l *layout) block(n *html.Node, content func(), spaceAfter float64) {
+	l.breakLine()
+	align := l.align
+	if a := alignOf(n); a != "" {
+		l.align = a
+	}
+	content()
+	l.align = align
+	l.font()
+	l.breakLine()
+	l.pdf.Ln(spaceAfter)
+}
+
+func (l *layout) item(n *html.Node) {
+	l.breakLine()
+	depth := len(l.lists)
+	marker := "-"
+	if depth > 0 {
+		if l.lists[depth-1] >= 0 {
+			l.lists[depth-1]++
+			marker = strconv.Itoa(l.lists[depth-1]) + "."
+		}
+	}
+	left, _, _, _ := l.pdf.GetMargins()
+	indent := float64(depth) * 6
+	l.pdf.SetX(left + indent - 5)
+	l.pdf.CellFormat(5, l.height(), l.text(marker), "", 0, "L", false, 0, "")
+	l.pdf.SetLeftMargin(left + indent)
+	l.children(n)
+	l.pdf.SetLeftMargin(left)
+	l.breakLine()
+}
+
+// write adds inline text, flowing it across lines. Centered and right aligned
+// blocks are written line by line, as fpdf's Write only flows left.
+func (l *layout) write(s string) {
+	if s == "" {
+		return
+	}
+	if l.pdf.GetX() <= l.leftMargin()+0.01 {
+		s = strings.TrimLeft(s, " ")
+	}
+	if l.align == "L" {
+		l.pdf.Write(l.height(), l.text(s))
+		return
+	}
+	_, _, right, _ := l.pdf.GetMargins()
+	width, _ := l.pdf.GetPageSize()
+	l.pdf.WriteAligned(width-right-l.pdf.GetX(), l.height(), l.text(s), l.align)
+}
+
+// breakLine moves to the start of a new line unless already there
+func (l *layout) breakLine() {
+	if l.pdf.GetX() > l.leftMargin()+0.01 {
+		l.pdf.Ln(l.height())
+	}
+}
+
+func (l *layout) leftMargin() float64 {
+	left, _, _, _ := l.pdf.GetMargins()
+	return left
+}
+
+func (l *layout) height() float64 {
+	return lineHeight * l.size / fontSize
+}
+
+func (l *layout) font() {
+	style := ""
+	if l.bold > 0 {
+		style += "B"
+	}
+	if l.italic > 0 {
+		style += "I"
+	}
+	if l.underline > 0 {
+		style += "U"
+	}
+	l.pdf.SetFont(l.family, style, l.size)
+}
+
+// table lays out rows of cells with wrapped text, bordered unless border="0".
+// Column widths come from the first row's width attributes, splitting what's left
+// evenly; header rows repeat on every page the table continues on.
+func (l *layout) table(n *html.Node) {
+	var rows []*html.Node
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Tr {
+			rows = append(rows, c)
+			return false
+		}
+		return true
+	})
+	if len(rows) == 0 {
+		return
+	}
+
+	left, _, right, bottom := l.pdf.GetMargins()
+	pageWidth, pageHeight := l.pdf.GetPageSize()
+	widths := columnWidths(cells(rows[0]), pageWidth-left-right)
+	var header []*html.Node
+	for _, row := range rows {
+		if allHeaders(row) {
+			header = append(header, row)
+		} else {
+			break
+		}
+	}
+
+	borders := attr(n, "border") != "0"
+	for i, row := range rows {
+		height := l.rowHeight(row, widths)
+		if l.pdf.GetY()+height > pageHeight-bottom {
+			l.pdf.AddPage()
+			if i >= len(header) {
+				for _, h := range header {
+					l.row(h, widths, l.rowHeight(h, widths), borders)
+				}
+			}
+		}
+		l.row(row, widths, height, borders)
+	}
+}
+
+func (l *layout) row(row *html.Node, widths []float64, height float64, borders bool) {
+	x, y := l.leftMargin(), l.pdf.GetY()
+	for i, cell := range cells(row) {
+		if i >= len(widths) {
+			break
+		}
+		bold := cell.DataAtom == atom.Th || hasBold(cell)
+		if bold {
+			l.bold++
+			l.pdf.SetFillColor(240, 240, 240)
+		}
+		l.font()
+		l.pdf.SetDrawColor(200, 200, 200)
+		style := "D"
+		if bold {
+			style = "FD"
+		}
+		if borders {
+			l.pdf.Rect(x, y, widths[i], height, style)
+		}
+		l.pdf.SetXY(x+cellPad, y+cellPad)
+		align := alignOf(cell)
+		if align == "" {
+			align = "L"
+		}
+		l.pdf.MultiCell(widths[i]-2*cellPad, l.height(), l.text(textOf(cell)), "", align, false)
+		if bold {
+			l.bold--
+		}
+		x += widths[i]
+	}
+	l.pdf.SetDrawColor(0, 0, 0)
+	l.font()
+	l.pdf.SetXY(l.leftMargin(), y+height)
+}
+
+func (l *layout) rowHeight(row *html.Node, widths []float64) float64 {
+	lines := 1
+	for i, cell := range cells(row) {
+		if i >= len(widths) {
+			break
+		}
+		if cell.DataAtom == atom.Th || hasBold(cell) {
+			l.bold++
+		}
+		l.font()
+		if n := l.lines(textOf(cell), widths[i]-2*cellPad); n > lines {
+			lines = n
+		}
+		if cell.DataAtom == atom.Th || hasBold(cell) {
+			l.bold--
+		}
+	}
+	l.font()
+	return float64(lines)*l.height() + 2*cellPad
+}
+
+// lines counts the lines s wraps to in width, the way MultiCell breaks them
+func (l *layout) lines(s string, width float64) int {
+	if l.family == "body" {
+		return len(l.pdf.SplitText(s, width))
+	}
+	// SplitText indexes widths by rune, which the single-byte core fonts don't have
+	return len(l.pdf.SplitLines([]byte(l.text(s)), width))
+}
+
+func columnWidths(first []*html.Node, total float64) []float64 {
+	widths := make([]float64, len(first))
+	remaining, unset := total, 0
+	for i, cell := range first {
+		if pct, ok := strings.CutSuffix(attr(cell, "width"), "%"); ok {
+			if v, err := strconv.ParseFloat(pct, 64); err == nil && v > 0 {
+				widths[i] = total * v / 100
+				remaining -= widths[i]
+				continue
+			}
+		}
+		unset++
+	}
+	for i := range widths {
+		if widths[i] == 0 {
+			widths[i] = max(remaining, 0) / float64(unset)
+		}
+	}
+	return widths
+}
+
+func cells(row *html.Node) []*html.Node {
+	var list []*html.Node
+	for c := row.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+func allHeaders(row *html.Node) bool {
+	cs := cells(row)
+	for _, c := range cs {
+		if c.DataAtom != atom.Th {
+			return false
+		}
+	}
+	return len(cs) > 0
+}
+
+// hasBold reports whether a cell's content is all in <b> or <strong>
+func hasBold(cell *html.Node) bool {
+	var found bool
+	for c := cell.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.ElementNode && (c.DataAtom == atom.B || c.DataAtom == atom.Strong):
+			found = true
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) == "":
+		default:
+			return false
+		}
+	}
+	return found
+}
+
+func alignOf(n *html.Node) string {
+	switch strings.ToLower(attr(n, "align")) {
+	case "center":
+		return "C"
+	case "right":
+		return "R"
+	case "left":
+		return "L"
+	}
+	return ""
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// textOf returns the text of a node, with <br> as line breaks
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) bool {
+		switch {
+		case c.Type == html.TextNode:
+			b.WriteString(collapse(c.Data))
+		case c.Type == html.ElementNode && c.DataAtom == atom.Br:
+			b.WriteString("\n")
+		}
+		return true
+	})
+	lines := strings.Split(b.String(), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapse turns runs of whitespace into single spaces, as browsers do
+func collapse(s string) string {
+	if strings.TrimSpace(s) == "" {
+		if s == "" {
+			return ""
+		}
+		return " "
+	}
+	fields := strings.Fields(s)
+	out := strings.Join(fields, " ")
+	if strings.IndexAny(s[:1], " \t\r\n") == 0 {
+		out = " " + out
+	}
+	if strings.IndexAny(s[len(s)-1:], " \t\r\n") == 0 {
+		out += " "
+	}
+	return out
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found == nil && c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+// walk visits n and its descendants depth first, skipping the children of nodes
+// visit returns false for
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, visit)
+	}
+}
@@ -0,0 +1,135 @@
+// Package pdf renders documents like invoices and reports from HTML templates. The
+// templates are html/template sources whose output is laid out with fpdf; only a
+// subset of HTML is understood, which keeps rendering fast and free of a browser:
+//
+//	<title>                  the document title, also in its metadata
+//	<h1> <h2> <h3> <p> <div> blocks, with align="left|center|right"
+//	<b> <strong> <i> <em> <u> <br> <span>
+//	<ul> <ol> <li>           lists
+//	<table> <tr> <th> <td>   tables, with width="30%" on the first row's cells, align on any
+//	                         and border="0" on the table to leave out the cell borders
+//	<hr>                     a rule
+//
+// Other tags are rendered as their text.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/pkg/money"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Config holds rendering configuration
+type Config struct {
+	// TrueType fonts for text beyond Windows-1252. Without them the built-in
+	// Helvetica is used, which covers Western European languages.
+	FontFile     string `yaml:"fontFile"`
+	BoldFontFile string `yaml:"boldFontFile"`
+	PageSize     string `yaml:"pageSize"` // A4 (default), Letter or Legal
+}
+
+// Renderer turns HTML into PDF
+type Renderer struct {
+	cfg  Config
+	font []byte // Regular and bold TrueType fonts, when configured
+	bold []byte
+}
+
+// NewRenderer creates a renderer, loading the configured fonts
+func NewRenderer(cfg Config) (*Renderer, error) {
+	if cfg.PageSize == "" {
+		cfg.PageSize = "A4"
+	}
+	if cfg.BoldFontFile == "" {
+		cfg.BoldFontFile = cfg.FontFile
+	}
+	r := &Renderer{cfg: cfg}
+	if cfg.FontFile != "" {
+		var err error
+		if r.font, err = os.ReadFile(cfg.FontFile); err != nil {
+			return nil, fmt.Errorf("pdf: %w", err)
+		}
+		if r.bold, err = os.ReadFile(cfg.BoldFontFile); err != nil {
+			return nil, fmt.Errorf("pdf: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// Funcs are available to every template
+var Funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// money formats a decimal amount, a string or number, in a currency: {{money .total "EUR"}}
+	"money": func(amount any, currency string) string {
+		s := fmt.Sprint(amount)
+		if f, ok := amount.(float64); ok {
+			s = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		m, err := money.Parse(s, currency)
+		if err != nil {
+			return s + " " + currency
+		}
+		return m.Format("en")
+	},
+	// date formats an RFC 3339 timestamp or a time with a Go layout: {{date .IssuedAt "2 Jan 2006"}}
+	"date": func(value any, layout string) string {
+		switch v := value.(type) {
+		case time.Time:
+			return v.Format(layout)
+		case string:
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t.Format(layout)
+			}
+			if t, err := time.Parse(time.DateOnly, v); err == nil {
+				return t.Format(layout)
+			}
+			return v
+		}
+		return fmt.Sprint(value)
+	},
+	"now": func() time.Time { return time.Now().UTC() },
+}
+
+// Parse compiles a template source with Funcs
+func Parse(name, source string) (*template.Template, error) {
+	return template.New(name).Funcs(Funcs).Option("missingkey=zero").Parse(source)
+}
+
+// Execute runs tmpl with data and renders the HTML it produces to w
+func (r *Renderer) Execute(w io.Writer, tmpl *template.Template, data any) error {
+	var html bytes.Buffer
+	if err := tmpl.Execute(&html, data); err != nil {
+		return err
+	}
+	return r.Render(w, html.String())
+}
+
+// Render lays out an HTML document as PDF
+func (r *Renderer) Render(w io.Writer, html string) error {
+	doc := fpdf.New("P", "mm", r.cfg.PageSize, "")
+	l := &layout{pdf: doc, family: "Helvetica", text: doc.UnicodeTranslatorFromDescriptor("")}
+	if r.font != nil {
+		for _, style := range []string{"", "I"} {
+			doc.AddUTF8FontFromBytes("body", style, r.font)
+			doc.AddUTF8FontFromBytes("body", "B"+style, r.bold)
+		}
+		l.family, l.text = "body", func(s string) string { return s }
+	}
+	if err := doc.Error(); err != nil {
+		return err
+	}
+	if err := l.render(html); err != nil {
+		return err
+	}
+	return doc.Output(w)
+}
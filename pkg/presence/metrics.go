@@ -0,0 +1,17 @@
+package presence
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	joins = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "presence_joins_total",
+		Help: "Users joining a room they weren't present in.",
+	})
+	leaves = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "presence_leaves_total",
+		Help: "Users leaving a room, by whether they left or their heartbeats expired.",
+	}, []string{"reason"})
+)
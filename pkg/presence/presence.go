@@ -0,0 +1,232 @@
+// Package presence tracks who is online in rooms, like the document a team is
+// editing. Each connection of a user to a room holds an entry it refreshes with
+// heartbeats, and the entries of connections that stop, like those of a crashed
+// instance, expire. A user joins a room with their first entry and leaves it with
+// their last, which is recorded as an event so every instance can tell its clients.
+package presence
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go-api/pkg/eventschema"
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config holds presence configuration
+type Config struct {
+	Enabled       bool          `yaml:"enabled"`
+	TTL           time.Duration `yaml:"ttl"`           // How long an entry lives without a heartbeat
+	SweepInterval time.Duration `yaml:"sweepInterval"` // How often expired entries are removed
+}
+
+// Events recorded on the stream of a room, presence-{tenant}/{room}
+const (
+	EventJoined = "presence.joined"
+	EventLeft   = "presence.left"
+)
+
+// Change is the data of EventJoined and EventLeft events
+type Change struct {
+	Room   string `json:"room"`
+	Tenant string `json:"tenant,omitempty"`
+	UserID string `json:"userId"`
+}
+
+// Room is a room of a tenant; rooms of different tenants never share members
+type Room struct {
+	Tenant string
+	Name   string
+}
+
+// key identifies the room in stores
+func (r Room) key() string {
+	return url.PathEscape(r.Tenant) + "/" + url.PathEscape(r.Name)
+}
+
+func parseRoom(key string) (Room, bool) {
+	tenant, name, ok := strings.Cut(key, "/")
+	if !ok {
+		return Room{}, false
+	}
+	tenant, err := url.PathUnescape(tenant)
+	if err != nil {
+		return Room{}, false
+	}
+	name, err = url.PathUnescape(name)
+	if err != nil {
+		return Room{}, false
+	}
+	return Room{Tenant: tenant, Name: name}, true
+}
+
+// Entry is the presence of a connection in a room
+type Entry struct {
+	Room    Room
+	UserID  string
+	Conn    string // ID of the connection
+	Expires time.Time
+}
+
+// Member is a user present in a room
+type Member struct {
+	UserID      string    `json:"userId"`
+	Connections int       `json:"connections"`
+	LastSeen    time.Time `json:"lastSeen"` // Of the latest heartbeat
+}
+
+// Store holds the entries, shared by instances
+type Store interface {
+	// Join adds or refreshes an entry until its expiry, reporting whether it's the
+	// only live entry of its user in the room
+	Join(ctx context.Context, e Entry) (bool, error)
+	// Leave removes an entry, reporting whether it was the last live one of its user
+	// in the room
+	Leave(ctx context.Context, e Entry) (bool, error)
+	// Entries returns the live entries of a room
+	Entries(ctx context.Context, room Room) ([]Entry, error)
+	// Expire removes the entries expired at now, returning those that were the last
+	// of their user in their room
+	Expire(ctx context.Context, now time.Time) ([]Entry, error)
+}
+
+// Tracker tracks presence in a store, recording joins and leaves as events
+type Tracker struct {
+	cfg    Config
+	store  Store
+	events eventstore.Store
+}
+
+// NewTracker creates a tracker keeping entries in store and recording events in events
+func NewTracker(cfg Config, store Store, events eventstore.Store) *Tracker {
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = cfg.TTL / 4
+	}
+	return &Tracker{cfg: cfg, store: store, events: events}
+}
+
+// HeartbeatInterval is how often connections refresh their entries, leaving
+// room for a missed heartbeat before they expire
+func (t *Tracker) HeartbeatInterval() time.Duration {
+	return t.cfg.TTL / 3
+}
+
+// Join adds a connection of a user to a room, or refreshes it as a heartbeat
+func (t *Tracker) Join(ctx context.Context, room Room, userID, conn string) error {
+	first, err := t.store.Join(ctx, Entry{Room: room, UserID: userID, Conn: conn, Expires: time.Now().Add(t.cfg.TTL)})
+	if err != nil || !first {
+		return err
+	}
+	joins.Inc()
+	return t.record(ctx, EventJoined, room, userID)
+}
+
+// Leave removes a connection of a user from a room
+func (t *Tracker) Leave(ctx context.Context, room Room, userID, conn string) error {
+	last, err := t.store.Leave(ctx, Entry{Room: room, UserID: userID, Conn: conn})
+	if err != nil || !last {
+		return err
+	}
+	leaves.WithLabelValues("left").Inc()
+	return t.record(ctx, EventLeft, room, userID)
+}
+
+// Members returns the users present in a room, the most recently seen first
+func (t *Tracker) Members(ctx context.Context, room Room) ([]Member, error) {
+	entries, err := t.store.Entries(ctx, room)
+	if err != nil {
+		return nil, err
+	}
+	byUser := make(map[string]int) // Index in members
+	members := []Member{}
+	for _, e := range entries {
+		seen := e.Expires.Add(-t.cfg.TTL)
+		i, ok := byUser[e.UserID]
+		if !ok {
+			i = len(members)
+			members = append(members, Member{UserID: e.UserID})
+			byUser[e.UserID] = i
+		}
+		m := &members[i]
+		m.Connections++
+		if seen.After(m.LastSeen) {
+			m.LastSeen = seen
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].LastSeen.After(members[j].LastSeen) })
+	return members, nil
+}
+
+// Present reports whether a user is present in a room
+func (t *Tracker) Present(ctx context.Context, room Room, userID string) (Member, bool, error) {
+	members, err := t.Members(ctx, room)
+	if err != nil {
+		return Member{}, false, err
+	}
+	for _, m := range members {
+		if m.UserID == userID {
+			return m, true, nil
+		}
+	}
+	return Member{}, false, nil
+}
+
+// Start removes expired entries until ctx is cancelled, recording the users who
+// left with them. Every instance sweeps; the store hands each entry to one.
+func (t *Tracker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(t.cfg.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.sweep(ctx)
+			}
+		}
+	}()
+}
+
+func (t *Tracker) sweep(ctx context.Context) {
+	expired, err := t.store.Expire(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("failed to expire presence entries", zap.Error(err))
+		}
+		return
+	}
+	for _, e := range expired {
+		leaves.WithLabelValues("expired").Inc()
+		if err := t.record(ctx, EventLeft, e.Room, e.UserID); err != nil {
+			logger.Error("failed to record presence leave", zap.String("room", e.Room.Name), zap.Error(err))
+		}
+	}
+}
+
+func (t *Tracker) record(ctx context.Context, event string, room Room, userID string) error {
+	_, err := t.events.Append(ctx, "presence-"+room.key(), eventstore.AnyVersion, eventstore.NewEvent{
+		Type: event,
+		Data: Change{Room: room.Name, Tenant: room.Tenant, UserID: userID},
+	})
+	return err
+}
+
+// EventSchemas declares the schemas of the join and leave events
+func (t *Tracker) EventSchemas() []eventschema.Schema {
+	return []eventschema.Schema{
+		{Event: EventJoined, Version: 1, Description: "A user joined a room they weren't present in.",
+			Schema: eventschema.From(Change{})},
+		{Event: EventLeft, Version: 1, Description: "A user left a room, or their last heartbeat in it expired.",
+			Schema: eventschema.From(Change{})},
+	}
+}
@@ -0,0 +1,213 @@
+package presence
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MemoryStore keeps entries in process, used when Redis isn't configured. Each
+// instance then only knows the presence of its own connections.
+type MemoryStore struct {
+	mu    sync.Mutex
+	rooms map[string]map[string]Entry // Entries by connection, by room key
+}
+
+// NewMemoryStore creates an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rooms: make(map[string]map[string]Entry)}
+}
+
+func (m *MemoryStore) Join(ctx context.Context, e Entry) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.rooms[e.Room.key()]
+	if entries == nil {
+		entries = make(map[string]Entry)
+		m.rooms[e.Room.key()] = entries
+	}
+	_, refreshed := entries[e.Conn]
+	entries[e.Conn] = e
+	return !refreshed && m.live(entries, e.UserID, time.Now()) == 1, nil
+}
+
+func (m *MemoryStore) Leave(ctx context.Context, e Entry) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.remove(e.Room.key(), e.Conn, time.Now()), nil
+}
+
+func (m *MemoryStore) Entries(ctx context.Context, room Room) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var list []Entry
+	for _, e := range m.rooms[room.key()] {
+		if e.Expires.After(now) {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+func (m *MemoryStore) Expire(ctx context.Context, now time.Time) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var last []Entry
+	for key, entries := range m.rooms {
+		for conn, e := range entries {
+			if !e.Expires.After(now) && m.remove(key, conn, now) {
+				last = append(last, e)
+			}
+		}
+	}
+	return last, nil
+}
+
+// remove removes an entry, reporting whether it was the last live one of its user
+func (m *MemoryStore) remove(key, conn string, now time.Time) bool {
+	entries := m.rooms[key]
+	e, ok := entries[conn]
+	if !ok {
+		return false
+	}
+	delete(entries, conn)
+	if len(entries) == 0 {
+		delete(m.rooms, key)
+	}
+	return m.live(entries, e.UserID, now) == 0
+}
+
+func (m *MemoryStore) live(entries map[string]Entry, userID string, now time.Time) int {
+	n := 0
+	for _, e := range entries {
+		if e.UserID == userID && e.Expires.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// RedisStore keeps the entries of each room in a sorted set scored by expiry, so
+// instances share presence. Members are the connection ID and the user ID.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration // Of the room keys, past the last heartbeat
+}
+
+// NewRedisStore creates a store backed by client whose rooms are forgotten once
+// no entry has been refreshed for ttl
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+// roomsKey is the set of the rooms with entries, which Expire sweeps
+const roomsKey = "presence:rooms"
+
+func roomKey(key string) string { return "presence:room:" + key }
+
+func member(e Entry) string { return e.Conn + "|" + e.UserID }
+
+func score(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) }
+
+func (r *RedisStore) Join(ctx context.Context, e Entry) (bool, error) {
+	key := roomKey(e.Room.key())
+	var added *redis.IntCmd
+	var live *redis.StringSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		added = p.ZAdd(ctx, key, redis.Z{Score: float64(e.Expires.UnixMilli()), Member: member(e)})
+		p.Expire(ctx, key, 2*r.ttl)
+		p.SAdd(ctx, roomsKey, e.Room.key())
+		live = p.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + score(time.Now()), Max: "+inf"})
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return added.Val() == 1 && count(live.Val(), e.UserID) == 1, nil
+}
+
+func (r *RedisStore) Leave(ctx context.Context, e Entry) (bool, error) {
+	return r.remove(ctx, e.Room.key(), member(e), time.Now())
+}
+
+// remove removes a member, reporting whether it was the last live one of its user.
+// Removing and reading in one transaction hands each member to a single caller.
+func (r *RedisStore) remove(ctx context.Context, room, m string, now time.Time) (bool, error) {
+	key := roomKey(room)
+	var removed *redis.IntCmd
+	var live *redis.StringSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		removed = p.ZRem(ctx, key, m)
+		live = p.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + score(now), Max: "+inf"})
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	_, userID, _ := strings.Cut(m, "|")
+	return removed.Val() == 1 && count(live.Val(), userID) == 0, nil
+}
+
+func (r *RedisStore) Entries(ctx context.Context, room Room) ([]Entry, error) {
+	members, err := r.client.ZRangeByScoreWithScores(ctx, roomKey(room.key()), &redis.ZRangeBy{
+		Min: "(" + score(time.Now()), Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Entry, 0, len(members))
+	for _, z := range members {
+		conn, userID, _ := strings.Cut(z.Member.(string), "|")
+		list = append(list, Entry{Room: room, UserID: userID, Conn: conn, Expires: time.UnixMilli(int64(z.Score))})
+	}
+	return list, nil
+}
+
+func (r *RedisStore) Expire(ctx context.Context, now time.Time) ([]Entry, error) {
+	rooms, err := r.client.SMembers(ctx, roomsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var last []Entry
+	for _, key := range rooms {
+		room, ok := parseRoom(key)
+		if !ok {
+			continue
+		}
+		expired, err := r.client.ZRangeByScore(ctx, roomKey(key), &redis.ZRangeBy{Min: "-inf", Max: score(now)}).Result()
+		if err != nil {
+			return last, err
+		}
+		for _, m := range expired {
+			wasLast, err := r.remove(ctx, key, m, now)
+			if err != nil {
+				return last, err
+			}
+			if wasLast {
+				conn, userID, _ := strings.Cut(m, "|")
+				last = append(last, Entry{Room: room, UserID: userID, Conn: conn})
+			}
+		}
+		// Rooms joined meanwhile are added back by their next heartbeat
+		if n, err := r.client.ZCard(ctx, roomKey(key)).Result(); err == nil && n == 0 {
+			r.client.SRem(ctx, roomsKey, key)
+		}
+	}
+	return last, nil
+}
+
+// count counts the members of a user
+func count(members []string, userID string) int {
+	n := 0
+	for _, m := range members {
+		if _, u, _ := strings.Cut(m, "|"); u == userID {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,189 @@
+// Package profiling continuously captures CPU and heap profiles and pushes them to a
+// Pyroscope-compatible ingest endpoint. Requests are labelled with their route so
+// profiles can be broken down per endpoint. Capture is sampled and skipped while the
+// server is under heavy load, when the profiler's own overhead would hurt most.
+// Parca has no push API, so RegisterRoutes exposes pprof endpoints for it to scrape.
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Config holds continuous profiling configuration
+type Config struct {
+	ServerAddress string            `yaml:"serverAddress"` // Pyroscope base URL, profiling is off when empty
+	AppName       string            `yaml:"appName"`
+	Tags          map[string]string `yaml:"tags"`        // Added to every profile
+	Interval      time.Duration     `yaml:"interval"`    // How often a capture cycle starts
+	CPUDuration   time.Duration     `yaml:"cpuDuration"` // CPU sampled per cycle, at most Interval
+	SampleRatio   float64           `yaml:"sampleRatio"` // Fraction of cycles captured
+	Heap          bool              `yaml:"heap"`        // Also push a heap profile each cycle
+	MaxLoad       int64             `yaml:"maxLoad"`     // Skip cycles while load is at or above this, 0 never skips
+	PprofRoutes   bool              `yaml:"pprofRoutes"` // Serve /admin/debug/pprof for scraping
+}
+
+// Profiler pushes profiles on an interval
+type Profiler struct {
+	cfg    Config
+	load   func() int64
+	client *http.Client
+}
+
+// New creates a profiler, or returns nil when no server is configured. load reports
+// the current load, such as requests in flight, and may be nil.
+func New(cfg Config, load func() int64) *Profiler {
+	if cfg.ServerAddress == "" {
+		return nil
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = "go-api"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.CPUDuration <= 0 || cfg.CPUDuration > cfg.Interval {
+		cfg.CPUDuration = cfg.Interval
+	}
+	if cfg.SampleRatio <= 0 || cfg.SampleRatio > 1 {
+		cfg.SampleRatio = 1
+	}
+	cfg.ServerAddress = strings.TrimRight(cfg.ServerAddress, "/")
+	return &Profiler{cfg: cfg, load: load, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Run captures and pushes profiles until ctx is cancelled
+func (p *Profiler) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if reason := p.skip(); reason != "" {
+			logger.Debug("skipping profile capture", zap.String("reason", reason))
+		} else if err := p.capture(ctx); err != nil && ctx.Err() == nil {
+			logger.Warn("failed to push profiles", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// skip reports why this cycle shouldn't be captured, if it shouldn't
+func (p *Profiler) skip() string {
+	if rand.Float64() >= p.cfg.SampleRatio {
+		return "sampled out"
+	}
+	if p.cfg.MaxLoad > 0 && p.load != nil && p.load() >= p.cfg.MaxLoad {
+		return "high load"
+	}
+	return ""
+}
+
+func (p *Profiler) capture(ctx context.Context) error {
+	var cpu bytes.Buffer
+	from := time.Now()
+	if err := pprof.StartCPUProfile(&cpu); err != nil {
+		// Someone else, like a /debug/pprof request, is profiling already
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(p.cfg.CPUDuration):
+	}
+	pprof.StopCPUProfile()
+	until := time.Now()
+
+	if err := p.push(ctx, "cpu", &cpu, from, until); err != nil {
+		return err
+	}
+	if !p.cfg.Heap {
+		return nil
+	}
+	var heap bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&heap, 0); err != nil {
+		return err
+	}
+	return p.push(ctx, "memory", &heap, until, until)
+}
+
+// push uploads a pprof profile to the ingest endpoint
+func (p *Profiler) push(ctx context.Context, kind string, profile *bytes.Buffer, from, until time.Time) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("profile", "profile.pprof")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(profile.Bytes()); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"name":    {p.appName(kind)},
+		"from":    {strconv.FormatInt(from.Unix(), 10)},
+		"until":   {strconv.FormatInt(until.Unix(), 10)},
+		"format":  {"pprof"},
+		"spyName": {"gospy"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.ServerAddress+"/ingest?"+query.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s profile rejected with status %d", kind, resp.StatusCode)
+	}
+	return nil
+}
+
+// appName renders the application name with its tags, like "go-api.cpu{env=prod}"
+func (p *Profiler) appName(kind string) string {
+	tags := make([]string, 0, len(p.cfg.Tags))
+	for k, v := range p.cfg.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	return p.cfg.AppName + "." + kind + "{" + strings.Join(tags, ",") + "}"
+}
+
+// Labels tags the goroutine serving a request with its route, so CPU samples taken
+// while it runs are attributed to the endpoint
+func Labels() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		pprof.Do(c.Request.Context(), pprof.Labels("route", route, "method", c.Request.Method), func(ctx context.Context) {
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package projection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CheckpointStore persists the last processed source position of each projection
+type CheckpointStore interface {
+	Load(ctx context.Context, name string) (int64, error)
+	Save(ctx context.Context, name string, position int64) error
+}
+
+// MemoryCheckpoints keeps checkpoints in memory, for read models that are themselves
+// in memory and get rebuilt on every start anyway
+type MemoryCheckpoints struct {
+	mu        sync.RWMutex
+	positions map[string]int64
+}
+
+// NewMemoryCheckpoints creates an empty in-memory checkpoint store
+func NewMemoryCheckpoints() *MemoryCheckpoints {
+	return &MemoryCheckpoints{positions: make(map[string]int64)}
+}
+
+func (m *MemoryCheckpoints) Load(ctx context.Context, name string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.positions[name], nil
+}
+
+func (m *MemoryCheckpoints) Save(ctx context.Context, name string, position int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.positions[name] = position
+	return nil
+}
+
+// SQLCheckpoints persists checkpoints in the projection_checkpoints table. Storing
+// the checkpoint in the same database as the read tables lets projections update both
+// in one transaction if they need exactly-once effects.
+type SQLCheckpoints struct {
+	db *sql.DB
+}
+
+// NewSQLCheckpoints creates a checkpoint store backed by db
+func NewSQLCheckpoints(db *sql.DB) *SQLCheckpoints {
+	return &SQLCheckpoints{db: db}
+}
+
+// EnsureSchema creates the projection_checkpoints table if it does not exist
+func (s *SQLCheckpoints) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS projection_checkpoints (
+			name       TEXT PRIMARY KEY,
+			position   BIGINT NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+func (s *SQLCheckpoints) Load(ctx context.Context, name string) (int64, error) {
+	var position int64
+	err := s.db.QueryRowContext(ctx, `SELECT position FROM projection_checkpoints WHERE name = $1`, name).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+func (s *SQLCheckpoints) Save(ctx context.Context, name string, position int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO projection_checkpoints (name, position, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position, updated_at = EXCLUDED.updated_at`,
+		name, position, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,23 @@
+package projection
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	projectionPosition = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "projection_position",
+		Help: "Last source position processed by a projection.",
+	}, []string{"projection"})
+
+	projectionLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "projection_lag_events",
+		Help: "Events in the source not yet processed by a projection.",
+	}, []string{"projection"})
+
+	projectionErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "projection_errors_total",
+		Help: "Failed projection catch-up attempts.",
+	}, []string{"projection"})
+)
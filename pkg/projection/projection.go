@@ -0,0 +1,236 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-api/pkg/eventstore"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Source is an ordered log of domain events, such as the event store or the outbox
+type Source interface {
+	ReadAll(ctx context.Context, afterPosition int64, limit int) ([]eventstore.Event, error)
+	LastPosition(ctx context.Context) (int64, error)
+}
+
+// Projection builds a read model, such as a denormalized table or cache entries,
+// from domain events. Handle must be idempotent: after a crash the events since
+// the last checkpoint are delivered again.
+type Projection interface {
+	Name() string
+	Handle(ctx context.Context, e eventstore.Event) error
+	// Reset clears the read model before it is rebuilt from the first event
+	Reset(ctx context.Context) error
+}
+
+// Funcs adapts plain functions to a Projection
+type Funcs struct {
+	ProjectionName string
+	HandleFunc     func(ctx context.Context, e eventstore.Event) error
+	ResetFunc      func(ctx context.Context) error
+}
+
+func (f Funcs) Name() string { return f.ProjectionName }
+
+func (f Funcs) Handle(ctx context.Context, e eventstore.Event) error { return f.HandleFunc(ctx, e) }
+
+func (f Funcs) Reset(ctx context.Context) error {
+	if f.ResetFunc == nil {
+		return nil
+	}
+	return f.ResetFunc(ctx)
+}
+
+// Status reports how far a projection has processed its source
+type Status struct {
+	Name       string    `json:"name"`
+	Position   int64     `json:"position"`
+	Head       int64     `json:"head"`
+	Lag        int64     `json:"lag"`
+	LastError  string    `json:"lastError,omitempty"`
+	Rebuilding bool      `json:"rebuilding"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Config holds projection runner configuration
+type Config struct {
+	PollInterval time.Duration `yaml:"pollInterval"`
+	BatchSize    int           `yaml:"batchSize"`
+}
+
+type state struct {
+	projection Projection
+	status     Status
+	mu         sync.Mutex // held while the projection processes events
+}
+
+// Runner feeds events from a source to projections, persisting a checkpoint per
+// projection after every batch so processing resumes where it stopped
+type Runner struct {
+	cfg         Config
+	source      Source
+	checkpoints CheckpointStore
+
+	mu     sync.RWMutex
+	states map[string]*state
+}
+
+// NewRunner creates a runner reading from source
+func NewRunner(cfg Config, source Source, checkpoints CheckpointStore) *Runner {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	return &Runner{cfg: cfg, source: source, checkpoints: checkpoints, states: make(map[string]*state)}
+}
+
+// Register adds a projection, must be called before Run
+func (r *Runner) Register(p Projection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states[p.Name()] = &state{projection: p, status: Status{Name: p.Name()}}
+}
+
+// Run catches every projection up until ctx is cancelled
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		head, err := r.source.LastPosition(ctx)
+		if err != nil {
+			logger.Warn("failed to read projection source head", zap.Error(err))
+		}
+
+		for _, st := range r.list() {
+			if err := r.catchUp(ctx, st, head); err != nil {
+				logger.Warn("projection failed", zap.String("projection", st.projection.Name()), zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Rebuild resets the named projection and replays the whole source into it
+func (r *Runner) Rebuild(ctx context.Context, name string) error {
+	r.mu.RLock()
+	st, ok := r.states[name]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("projection %q is not registered", name)
+	}
+
+	st.mu.Lock()
+	st.status.Rebuilding = true
+	err := st.projection.Reset(ctx)
+	if err == nil {
+		err = r.checkpoints.Save(ctx, name, 0)
+	}
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	head, err := r.source.LastPosition(ctx)
+	if err != nil {
+		return err
+	}
+	return r.catchUp(ctx, st, head)
+}
+
+// Statuses returns the progress of every projection sorted by name
+func (r *Runner) Statuses() []Status {
+	statuses := []Status{}
+	for _, st := range r.list() {
+		st.mu.Lock()
+		statuses = append(statuses, st.status)
+		st.mu.Unlock()
+	}
+	return statuses
+}
+
+func (r *Runner) list() []*state {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*state, 0, len(r.states))
+	for _, st := range r.states {
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].projection.Name() < list[j].projection.Name() })
+	return list
+}
+
+func (r *Runner) catchUp(ctx context.Context, st *state, head int64) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	name := st.projection.Name()
+	position, err := r.checkpoints.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	setStatus := func(err error) {
+		if head < position {
+			head = position
+		}
+		st.status.Position = position
+		st.status.Head = head
+		st.status.Lag = head - position
+		st.status.UpdatedAt = time.Now().UTC()
+		st.status.LastError = ""
+		if err != nil {
+			st.status.LastError = err.Error()
+			projectionErrors.WithLabelValues(name).Inc()
+		} else if st.status.Lag == 0 {
+			st.status.Rebuilding = false
+		}
+		projectionPosition.WithLabelValues(name).Set(float64(position))
+		projectionLag.WithLabelValues(name).Set(float64(st.status.Lag))
+	}
+
+	for {
+		events, err := r.source.ReadAll(ctx, position, r.cfg.BatchSize)
+		if err != nil {
+			setStatus(err)
+			return err
+		}
+		if len(events) == 0 {
+			setStatus(nil)
+			return nil
+		}
+
+		for _, e := range events {
+			if err := st.projection.Handle(ctx, e); err != nil {
+				err = fmt.Errorf("event %d (%s): %w", e.Position, e.Type, err)
+				// Keep the progress made so far in this batch
+				if saveErr := r.checkpoints.Save(ctx, name, position); saveErr != nil {
+					err = fmt.Errorf("%w; saving checkpoint: %v", err, saveErr)
+				}
+				setStatus(err)
+				return err
+			}
+			position = e.Position
+		}
+
+		if err := r.checkpoints.Save(ctx, name, position); err != nil {
+			setStatus(err)
+			return err
+		}
+		setStatus(nil)
+	}
+}
@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	jobsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "queue_jobs_enqueued_total",
+		Help: "Jobs added to a queue.",
+	}, []string{"queue", "type"})
+
+	jobsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "queue_jobs_processed_total",
+		Help: "Job attempts by outcome: completed, retried or dead.",
+	}, []string{"queue", "type", "outcome"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "queue_job_duration_seconds",
+		Help:    "Time spent running a job attempt.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"queue", "type"})
+
+	queueDepthDesc  = prometheus.NewDesc("queue_jobs", "Jobs currently held by a queue, by status.", []string{"queue", "status"}, nil)
+	queuePausedDesc = prometheus.NewDesc("queue_paused", "Whether a queue is paused.", []string{"queue"}, nil)
+)
+
+// Describe implements prometheus.Collector
+func (m *Manager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queuePausedDesc
+}
+
+// Collect implements prometheus.Collector, reporting live queue depths at scrape time
+func (m *Manager) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range m.Stats() {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(s.Pending), s.Name, string(StatusPending))
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(s.Active), s.Name, string(StatusActive))
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(s.Completed), s.Name, string(StatusCompleted))
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(s.Dead), s.Name, string(StatusDead))
+
+		paused := 0.0
+		if s.Paused {
+			paused = 1
+		}
+		ch <- prometheus.MustNewConstMetric(queuePausedDesc, prometheus.GaugeValue, paused, s.Name)
+	}
+}
@@ -0,0 +1,511 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusActive    Status = "active"
+	StatusCompleted Status = "completed"
+	StatusDead      Status = "dead" // Exhausted its attempts, waiting for a manual retry
+)
+
+// JobError records one failed attempt
+type JobError struct {
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// Job is a unit of background work
+type Job struct {
+	ID          string            `json:"id"`
+	Queue       string            `json:"queue"`
+	Type        string            `json:"type"`
+	Payload     json.RawMessage   `json:"payload"`
+	Status      Status            `json:"status"`
+	Attempts    int               `json:"attempts"`
+	MaxAttempts int               `json:"maxAttempts"`
+	Errors      []JobError        `json:"errors,omitempty"`
+	RunAt       time.Time         `json:"runAt"`
+	Context     map[string]string `json:"context,omitempty"` // Values of the enqueuing request, see ContextCarrier
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// Decode unmarshals the job payload into v
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// HandlerFunc processes a job, returning an error schedules a retry
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// Config holds job queue configuration
+type Config struct {
+	Queues             map[string]int `yaml:"queues"` // Queue name to worker count
+	MaxAttempts        int            `yaml:"maxAttempts"`
+	RetryBackoff       time.Duration  `yaml:"retryBackoff"` // Base delay, doubled after every failed attempt
+	CompletedRetention time.Duration  `yaml:"completedRetention"`
+	PollInterval       time.Duration  `yaml:"pollInterval"`
+}
+
+// Stats summarises a queue
+type Stats struct {
+	Name      string `json:"name"`
+	Pending   int    `json:"pending"`
+	Active    int    `json:"active"`
+	Completed int    `json:"completed"`
+	Dead      int    `json:"dead"`
+	Paused    bool   `json:"paused"`
+	Workers   int    `json:"workers"`
+}
+
+type queueState struct {
+	workers int
+	paused  bool
+	notify  chan struct{}
+}
+
+// ContextCarrier carries request-scoped values, like the tenant, from Enqueue to the
+// job's handler, across retries
+type ContextCarrier interface {
+	// Inject returns the values of ctx to keep with a job
+	Inject(ctx context.Context) map[string]string
+	// Extract restores them into the context the handler is run with
+	Extract(ctx context.Context, values map[string]string) (context.Context, error)
+}
+
+// EnqueueOption customises a job at enqueue time
+type EnqueueOption func(*Job)
+
+// WithMaxAttempts overrides the configured attempt limit for a job
+func WithMaxAttempts(n int) EnqueueOption {
+	return func(j *Job) { j.MaxAttempts = n }
+}
+
+// WithDelay schedules the job to run no earlier than d from now
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(j *Job) { j.RunAt = j.RunAt.Add(d) }
+}
+
+// Manager runs in-memory job queues with retries, dead-lettering and pause/resume
+type Manager struct {
+	cfg Config
+
+	mu       sync.Mutex
+	queues   map[string]*queueState
+	jobs     map[string]*Job
+	handlers map[string]HandlerFunc
+	carrier  ContextCarrier
+
+	wg sync.WaitGroup
+}
+
+// New creates a manager for the configured queues
+func New(cfg Config) *Manager {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+
+	m := &Manager{
+		cfg:      cfg,
+		queues:   make(map[string]*queueState),
+		jobs:     make(map[string]*Job),
+		handlers: make(map[string]HandlerFunc),
+	}
+	for name, workers := range cfg.Queues {
+		if workers < 1 {
+			workers = 1
+		}
+		m.queues[name] = &queueState{workers: workers, notify: make(chan struct{}, 1)}
+	}
+	return m
+}
+
+// Register sets the handler for a job type, must be called before Start
+func (m *Manager) Register(jobType string, h HandlerFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[jobType] = h
+}
+
+// SetCarrier installs the carrier of request values into jobs, must be called
+// before Start
+func (m *Manager) SetCarrier(c ContextCarrier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.carrier = c
+}
+
+// Enqueue adds a job to a queue
+func (m *Manager) Enqueue(ctx context.Context, queue, jobType string, payload any, opts ...EnqueueOption) (*Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          uuid.New().String(),
+		Queue:       queue,
+		Type:        jobType,
+		Payload:     raw,
+		Status:      StatusPending,
+		MaxAttempts: m.cfg.MaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	m.mu.Lock()
+	if m.carrier != nil {
+		job.Context = m.carrier.Inject(ctx)
+	}
+	q, ok := m.queues[queue]
+	if ok {
+		m.jobs[job.ID] = job
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("queue %q is not configured", queue)
+	}
+	jobsEnqueued.WithLabelValues(queue, jobType).Inc()
+	q.wake()
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Start launches the workers of every queue until ctx is cancelled
+func (m *Manager) Start(ctx context.Context) {
+	for name, q := range m.queues {
+		for i := 0; i < q.workers; i++ {
+			m.wg.Add(1)
+			go m.work(ctx, name, q)
+		}
+	}
+
+	m.wg.Add(1)
+	go m.prune(ctx)
+}
+
+// Wait blocks until all workers have stopped after their context was cancelled
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Manager) work(ctx context.Context, name string, q *queueState) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			job, handler := m.claim(name)
+			if job == nil {
+				break
+			}
+			m.run(ctx, job, handler)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim marks the oldest ready job of a queue as active
+func (m *Manager) claim(name string) (*Job, HandlerFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.queues[name].paused {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var next *Job
+	for _, job := range m.jobs {
+		if job.Queue != name || job.Status != StatusPending || job.RunAt.After(now) {
+			continue
+		}
+		if next == nil || job.RunAt.Before(next.RunAt) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Status = StatusActive
+	next.Attempts++
+	next.UpdatedAt = now.UTC()
+	return next, m.handlers[next.Type]
+}
+
+func (m *Manager) run(ctx context.Context, job *Job, handler HandlerFunc) {
+	start := time.Now()
+
+	m.mu.Lock()
+	snapshot := *job
+	carrier := m.carrier
+	m.mu.Unlock()
+
+	var err error
+	if carrier != nil && len(snapshot.Context) > 0 {
+		ctx, err = carrier.Extract(ctx, snapshot.Context)
+	}
+	switch {
+	case err != nil:
+	case handler == nil:
+		err = fmt.Errorf("no handler registered for job type %q", job.Type)
+	default:
+		err = safeRun(ctx, handler, &snapshot)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.UpdatedAt = now
+	jobDuration.WithLabelValues(job.Queue, job.Type).Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		job.Status = StatusCompleted
+		jobsProcessed.WithLabelValues(job.Queue, job.Type, string(StatusCompleted)).Inc()
+		return
+	}
+
+	job.Errors = append(job.Errors, JobError{Attempt: job.Attempts, Error: err.Error(), At: now})
+	if job.Attempts >= job.MaxAttempts {
+		job.Status = StatusDead
+		jobsProcessed.WithLabelValues(job.Queue, job.Type, string(StatusDead)).Inc()
+		return
+	}
+
+	job.Status = StatusPending
+	job.RunAt = now.Add(m.cfg.RetryBackoff * time.Duration(1<<(job.Attempts-1)))
+	jobsProcessed.WithLabelValues(job.Queue, job.Type, "retried").Inc()
+}
+
+// safeRun turns handler panics into job failures instead of crashing the worker
+func safeRun(ctx context.Context, handler HandlerFunc, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// prune drops completed jobs once they are older than the retention period
+func (m *Manager) prune(ctx context.Context) {
+	defer m.wg.Done()
+	if m.cfg.CompletedRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-m.cfg.CompletedRetention)
+			m.mu.Lock()
+			for id, job := range m.jobs {
+				if job.Status == StatusCompleted && job.UpdatedAt.Before(cutoff) {
+					delete(m.jobs, id)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (q *queueState) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+var errJobNotFound = apperrors.NewNotFoundError("Job not found")
+
+func errQueueNotFound(name string) error {
+	return apperrors.NewNotFoundError(fmt.Sprintf("Queue %q not found", name))
+}
+
+// Stats returns a summary of every queue sorted by name
+func (m *Manager) Stats() []Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byName := make(map[string]*Stats, len(m.queues))
+	for name, q := range m.queues {
+		byName[name] = &Stats{Name: name, Paused: q.paused, Workers: q.workers}
+	}
+	for _, job := range m.jobs {
+		s := byName[job.Queue]
+		switch job.Status {
+		case StatusPending:
+			s.Pending++
+		case StatusActive:
+			s.Active++
+		case StatusCompleted:
+			s.Completed++
+		case StatusDead:
+			s.Dead++
+		}
+	}
+
+	stats := make([]Stats, 0, len(byName))
+	for _, s := range byName {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Job returns a copy of a job including its error history
+func (m *Manager) Job(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, errJobNotFound
+	}
+	return *job, nil
+}
+
+// Jobs lists the jobs of a queue, optionally filtered by status, newest first
+func (m *Manager) Jobs(queue string, status Status, limit int) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.queues[queue]; !ok {
+		return nil, errQueueNotFound(queue)
+	}
+
+	var list []Job
+	for _, job := range m.jobs {
+		if job.Queue == queue && (status == "" || job.Status == status) {
+			list = append(list, *job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// Retry moves a dead job back to pending with a fresh set of attempts
+func (m *Manager) Retry(id string) error {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return errJobNotFound
+	}
+	if job.Status != StatusDead {
+		m.mu.Unlock()
+		return apperrors.NewValidationError("Only dead jobs can be retried", apperrors.FieldError{
+			Field:   "status",
+			Rule:    "eq",
+			Message: "status is " + string(job.Status),
+			Param:   string(StatusDead),
+		})
+	}
+	m.requeue(job)
+	q := m.queues[job.Queue]
+	m.mu.Unlock()
+
+	q.wake()
+	return nil
+}
+
+// RetryDead requeues every dead job of a queue and returns how many were requeued
+func (m *Manager) RetryDead(queue string) (int, error) {
+	m.mu.Lock()
+	q, ok := m.queues[queue]
+	if !ok {
+		m.mu.Unlock()
+		return 0, errQueueNotFound(queue)
+	}
+
+	n := 0
+	for _, job := range m.jobs {
+		if job.Queue == queue && job.Status == StatusDead {
+			m.requeue(job)
+			n++
+		}
+	}
+	m.mu.Unlock()
+
+	q.wake()
+	return n, nil
+}
+
+func (m *Manager) requeue(job *Job) {
+	now := time.Now().UTC()
+	job.Status = StatusPending
+	job.MaxAttempts = job.Attempts + m.cfg.MaxAttempts
+	job.RunAt = now
+	job.UpdatedAt = now
+}
+
+// Pause stops workers from claiming new jobs from a queue, active jobs finish normally
+func (m *Manager) Pause(queue string) error {
+	return m.setPaused(queue, true)
+}
+
+// Resume lets workers claim jobs from a paused queue again
+func (m *Manager) Resume(queue string) error {
+	return m.setPaused(queue, false)
+}
+
+func (m *Manager) setPaused(queue string, paused bool) error {
+	m.mu.Lock()
+	q, ok := m.queues[queue]
+	if ok {
+		q.paused = paused
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return errQueueNotFound(queue)
+	}
+	if !paused {
+		q.wake()
+	}
+	return nil
+}
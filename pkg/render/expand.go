@@ -0,0 +1,179 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxExpandDepth bounds nested expansions like comments.author.org
+const maxExpandDepth = 3
+
+// Expander embeds related resources in place of their IDs when requested with
+// ?expand=. Load is called once per expansion level with every ID referenced by the
+// response, so a list of 100 items costs one query rather than 100.
+type Expander struct {
+	Name   string // Requested as ?expand=<Name>; the related resource is written to this member
+	Key    string // Member holding the related ID or list of IDs, e.g. "userId"
+	Type   string // Resource type in JSON:API relationships, e.g. "users"
+	Link   string // URL template of a related resource for HAL links, e.g. "/admin/users/{id}"
+	Load   func(ctx context.Context, ids []string) (map[string]any, error)
+	Nested []Expander // Expansions available on the loaded resources
+}
+
+const expandersKey = "render.expanders"
+
+// Expand declares the expansions a route supports
+func Expand(expanders ...Expander) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(expandersKey, expanders)
+		c.Next()
+	}
+}
+
+// expansion is a tree of requested expansions
+type expansion map[string]expansion
+
+// routeExpanders returns the expansions declared for the route
+func routeExpanders(c *gin.Context) []Expander {
+	if v, ok := c.Get(expandersKey); ok {
+		return v.([]Expander)
+	}
+	return nil
+}
+
+// requestedExpansions parses ?expand=author,comments.author against the declared
+// expanders, returning nil when nothing was requested
+func requestedExpansions(c *gin.Context, expanders []Expander) (expansion, error) {
+	raw := c.Query("expand")
+	if raw == "" {
+		return nil, nil
+	}
+
+	tree := expansion{}
+	var invalid []string
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		names := strings.Split(path, ".")
+		if len(names) > maxExpandDepth || !supported(expanders, names) {
+			invalid = append(invalid, path)
+			continue
+		}
+		node := tree
+		for _, name := range names {
+			if node[name] == nil {
+				node[name] = expansion{}
+			}
+			node = node[name]
+		}
+	}
+	if len(invalid) > 0 {
+		details := make([]apperrors.FieldError, len(invalid))
+		for i, path := range invalid {
+			details[i] = apperrors.FieldError{Field: "expand", Rule: "expandable", Message: path + " can't be expanded", Param: path}
+		}
+		return nil, apperrors.NewValidationError("relations can't be expanded", details...)
+	}
+	return tree, nil
+}
+
+func supported(expanders []Expander, names []string) bool {
+	for _, e := range expanders {
+		if e.Name == names[0] {
+			return len(names) == 1 || supported(e.Nested, names[1:])
+		}
+	}
+	return false
+}
+
+// expand embeds the requested relations into objs, one batched load per expander
+func expand(ctx context.Context, objs []map[string]any, tree expansion, expanders []Expander) error {
+	for _, e := range expanders {
+		sub, ok := tree[e.Name]
+		if !ok || len(objs) == 0 {
+			continue
+		}
+
+		seen := make(map[string]bool)
+		var ids []string
+		for _, obj := range objs {
+			for _, id := range referencedIDs(obj[e.Key]) {
+				if !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		loaded, err := e.Load(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("expand %s: %w", e.Name, err)
+		}
+		related := make(map[string]map[string]any, len(loaded))
+		var children []map[string]any
+		for id, v := range loaded {
+			doc, err := toDocument(v)
+			if err != nil {
+				return err
+			}
+			if obj, ok := doc.(map[string]any); ok {
+				related[id] = obj
+				children = append(children, obj)
+			}
+		}
+
+		if len(sub) > 0 {
+			if err := expand(ctx, children, sub, e.Nested); err != nil {
+				return err
+			}
+		}
+
+		for _, obj := range objs {
+			switch ref := obj[e.Key].(type) {
+			case string:
+				if r, ok := related[ref]; ok {
+					obj[e.Name] = r
+				} else {
+					obj[e.Name] = nil
+				}
+			case []any:
+				list := make([]any, 0, len(ref))
+				for _, id := range referencedIDs(ref) {
+					if r, ok := related[id]; ok {
+						list = append(list, r)
+					}
+				}
+				obj[e.Name] = list
+			}
+		}
+	}
+	return nil
+}
+
+func referencedIDs(v any) []string {
+	switch ref := v.(type) {
+	case string:
+		if ref != "" {
+			return []string{ref}
+		}
+	case []any:
+		var ids []string
+		for _, item := range ref {
+			if s, ok := item.(string); ok && s != "" {
+				ids = append(ids, s)
+			}
+		}
+		return ids
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package render
+
+import (
+	"strings"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+const allowedFieldsKey = "render.allowedFields"
+
+// Fields declares the members of a resource clients may select with ?fields=.
+// Dotted names such as "author.name" allow selecting inside nested objects.
+func Fields(allowed ...string) gin.HandlerFunc {
+	set := make(map[string]bool, len(allowed))
+	for _, f := range allowed {
+		set[f] = true
+	}
+	return func(c *gin.Context) {
+		c.Set(allowedFieldsKey, set)
+		c.Next()
+	}
+}
+
+// selection is a tree of requested members; a nil subtree selects the whole member
+type selection map[string]selection
+
+// requestedFields parses ?fields=id,name,author.name, returning nil when the client
+// didn't ask for a sparse fieldset
+func requestedFields(c *gin.Context) (selection, error) {
+	raw := c.Query("fields")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var allowed map[string]bool
+	if v, ok := c.Get(allowedFieldsKey); ok {
+		allowed = v.(map[string]bool)
+	}
+
+	sel := selection{}
+	var invalid []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if allowed != nil && !allowed[field] && !allowed[strings.SplitN(field, ".", 2)[0]] {
+			invalid = append(invalid, field)
+			continue
+		}
+		sel.add(strings.Split(field, "."))
+	}
+	if len(invalid) > 0 {
+		details := make([]apperrors.FieldError, len(invalid))
+		for i, field := range invalid {
+			details[i] = apperrors.FieldError{Field: "fields", Rule: "selectable", Message: field + " can't be selected", Param: field}
+		}
+		return nil, apperrors.NewValidationError("fields can't be selected", details...)
+	}
+	// The ID is always returned so clients can correlate resources
+	if _, ok := sel["id"]; !ok {
+		sel["id"] = nil
+	}
+	return sel, nil
+}
+
+func (s selection) add(path []string) {
+	sub, exists := s[path[0]]
+	if len(path) == 1 {
+		// Selecting the whole member wins over selecting parts of it
+		s[path[0]] = nil
+		return
+	}
+	if exists && sub == nil {
+		return
+	}
+	if sub == nil {
+		sub = selection{}
+		s[path[0]] = sub
+	}
+	sub.add(path[1:])
+}
+
+// project keeps only the selected members of each resource in doc
+func project(doc any, sel selection) any {
+	for _, obj := range resources(doc) {
+		projectObject(obj, sel)
+	}
+	return doc
+}
+
+func projectObject(obj map[string]any, sel selection) {
+	for key, value := range obj {
+		sub, ok := sel[key]
+		if !ok {
+			delete(obj, key)
+			continue
+		}
+		if sub == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			projectObject(v, sub)
+		case []any:
+			for _, item := range v {
+				if o, ok := item.(map[string]any); ok {
+					projectObject(o, sub)
+				}
+			}
+		}
+	}
+}
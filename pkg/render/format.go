@@ -0,0 +1,298 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Format is a representation of resources
+type Format string
+
+const (
+	Plain   Format = "json"
+	JSONAPI Format = "jsonapi" // https://jsonapi.org
+	HAL     Format = "hal"     // JSON Hypertext Application Language
+)
+
+// Media types of the hypermedia formats
+const (
+	JSONAPIType = "application/vnd.api+json"
+	HALType     = "application/hal+json"
+)
+
+// Resource describes what a route returns, which the hypermedia formats need to
+// type resources and link to them
+type Resource struct {
+	Type string // e.g. "users"
+	Link string // URL template of one resource, e.g. "/admin/users/{id}"; optional
+}
+
+const (
+	resourceKey = "render.resource"
+	formatKey   = "render.format"
+)
+
+// Describe declares the resource a route returns
+func Describe(res Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(resourceKey, res)
+		c.Next()
+	}
+}
+
+// DefaultFormat sets the format of a route group for clients that don't ask for one
+func DefaultFormat(f Format) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(formatKey, f)
+		c.Next()
+	}
+}
+
+// negotiate picks the format from Accept, then the route default. Hypermedia formats
+// are only used for routes that describe their resource.
+func negotiate(c *gin.Context) (Format, Resource) {
+	v, ok := c.Get(resourceKey)
+	if !ok {
+		return Plain, Resource{}
+	}
+	res := v.(Resource)
+
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accepted))
+		switch mediaType {
+		case JSONAPIType:
+			return JSONAPI, res
+		case HALType:
+			return HAL, res
+		}
+	}
+	if f, ok := c.Get(formatKey); ok {
+		return f.(Format), res
+	}
+	return Plain, res
+}
+
+func idOf(obj map[string]any) string {
+	switch id := obj["id"].(type) {
+	case string:
+		return id
+	case json.Number:
+		return id.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(id)
+	}
+}
+
+func (r Resource) link(id string) string {
+	if r.Link == "" || id == "" {
+		return ""
+	}
+	return strings.ReplaceAll(r.Link, "{id}", id)
+}
+
+// envelope splits a document into its resource data and the remaining top-level
+// members, reporting whether the data is a collection
+func envelope(doc any) (data any, meta map[string]any, collection bool) {
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		_, collection = doc.([]any)
+		return doc, nil, collection
+	}
+	inner, ok := obj["data"]
+	if !ok {
+		return obj, nil, false
+	}
+	meta = make(map[string]any)
+	for k, v := range obj {
+		if k != "data" {
+			meta[k] = v
+		}
+	}
+	_, collection = inner.([]any)
+	return inner, meta, collection
+}
+
+// toJSONAPI renders a document as a JSON:API top-level object. Expanded relations
+// become relationships with the related resources in "included".
+func toJSONAPI(doc any, res Resource, expanders []Expander, self string) map[string]any {
+	data, meta, collection := envelope(doc)
+	included := make(map[string]map[string]any)
+	var order []string
+
+	var out any
+	if collection {
+		list := []any{}
+		for _, item := range data.([]any) {
+			if obj, ok := item.(map[string]any); ok {
+				list = append(list, jsonAPIResource(obj, res, expanders, included, &order))
+			}
+		}
+		out = list
+	} else if obj, ok := data.(map[string]any); ok {
+		out = jsonAPIResource(obj, res, expanders, included, &order)
+	}
+
+	top := map[string]any{"data": out, "links": map[string]any{"self": self}}
+	if len(meta) > 0 {
+		top["meta"] = meta
+	}
+	if len(order) > 0 {
+		list := make([]any, 0, len(order))
+		for _, key := range order {
+			list = append(list, included[key])
+		}
+		top["included"] = list
+	}
+	return top
+}
+
+func jsonAPIResource(obj map[string]any, res Resource, expanders []Expander, included map[string]map[string]any, order *[]string) map[string]any {
+	id := idOf(obj)
+	attributes := make(map[string]any, len(obj))
+	for k, v := range obj {
+		if k != "id" {
+			attributes[k] = v
+		}
+	}
+
+	relationships := make(map[string]any)
+	for _, e := range expanders {
+		ref, ok := obj[e.Key]
+		if !ok {
+			continue
+		}
+		delete(attributes, e.Key)
+		delete(attributes, e.Name)
+
+		identifier := func(id string) map[string]any { return map[string]any{"type": e.Type, "id": id} }
+		switch ref.(type) {
+		case string:
+			relationships[e.Name] = map[string]any{"data": identifier(referencedIDs(ref)[0])}
+		case []any:
+			list := []any{}
+			for _, id := range referencedIDs(ref) {
+				list = append(list, identifier(id))
+			}
+			relationships[e.Name] = map[string]any{"data": list}
+		}
+
+		for _, child := range embedded(obj[e.Name]) {
+			key := e.Type + "/" + idOf(child)
+			if _, seen := included[key]; seen {
+				continue
+			}
+			included[key] = nil // Reserve the slot so cycles terminate
+			*order = append(*order, key)
+			included[key] = jsonAPIResource(child, Resource{Type: e.Type, Link: e.Link}, e.Nested, included, order)
+		}
+	}
+
+	out := map[string]any{"type": res.Type, "id": id, "attributes": attributes}
+	if len(relationships) > 0 {
+		out["relationships"] = relationships
+	}
+	if link := res.link(id); link != "" {
+		out["links"] = map[string]any{"self": link}
+	}
+	return out
+}
+
+// embedded returns the resource objects of an expanded member
+func embedded(v any) []map[string]any {
+	switch e := v.(type) {
+	case map[string]any:
+		return []map[string]any{e}
+	case []any:
+		var list []map[string]any
+		for _, item := range e {
+			if obj, ok := item.(map[string]any); ok {
+				list = append(list, obj)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// toHAL renders a document as HAL: links to related resources in _links and
+// expanded relations in _embedded. Collections are embedded under the resource type.
+func toHAL(doc any, res Resource, expanders []Expander, self string) map[string]any {
+	data, meta, collection := envelope(doc)
+	if !collection {
+		obj, _ := data.(map[string]any)
+		out := halResource(obj, res, expanders)
+		if _, ok := out["_links"].(map[string]any)["self"]; !ok {
+			out["_links"].(map[string]any)["self"] = map[string]any{"href": self}
+		}
+		return out
+	}
+
+	items := []any{}
+	for _, item := range data.([]any) {
+		if obj, ok := item.(map[string]any); ok {
+			items = append(items, halResource(obj, res, expanders))
+		}
+	}
+	out := make(map[string]any, len(meta)+2)
+	for k, v := range meta {
+		out[k] = v
+	}
+	out["_links"] = map[string]any{"self": map[string]any{"href": self}}
+	out["_embedded"] = map[string]any{res.Type: items}
+	return out
+}
+
+func halResource(obj map[string]any, res Resource, expanders []Expander) map[string]any {
+	out := make(map[string]any, len(obj)+2)
+	for k, v := range obj {
+		out[k] = v
+	}
+
+	links := make(map[string]any)
+	if link := res.link(idOf(obj)); link != "" {
+		links["self"] = map[string]any{"href": link}
+	}
+	embeddedResources := make(map[string]any)
+	for _, e := range expanders {
+		related := Resource{Type: e.Type, Link: e.Link}
+		if ref, ok := obj[e.Key]; ok && e.Link != "" {
+			var hrefs []any
+			for _, id := range referencedIDs(ref) {
+				hrefs = append(hrefs, map[string]any{"href": related.link(id)})
+			}
+			if _, single := ref.(string); single && len(hrefs) == 1 {
+				links[e.Name] = hrefs[0]
+			} else if hrefs != nil {
+				links[e.Name] = hrefs
+			}
+		}
+
+		value, ok := obj[e.Name]
+		if !ok {
+			continue
+		}
+		delete(out, e.Name)
+		switch v := value.(type) {
+		case map[string]any:
+			embeddedResources[e.Name] = halResource(v, related, e.Nested)
+		case []any:
+			list := []any{}
+			for _, child := range embedded(v) {
+				list = append(list, halResource(child, related, e.Nested))
+			}
+			embeddedResources[e.Name] = list
+		}
+	}
+
+	out["_links"] = links
+	if len(embeddedResources) > 0 {
+		out["_embedded"] = embeddedResources
+	}
+	return out
+}
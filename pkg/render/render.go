@@ -0,0 +1,104 @@
+// Package render writes JSON responses shaped by the request: ?expand= embeds related
+// resources, ?fields= selects a sparse fieldset so clients only receive the members
+// they use, and routes that describe their resource can be rendered as JSON:API or
+// HAL instead of plain JSON.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON writes v like c.JSON after applying the requested expansions and field
+// selection, in the negotiated format. Lists wrapped as {"data": [...]} are shaped
+// per item. Invalid requests are attached to the context as validation errors instead.
+// Nothing is serialized once the client has disconnected.
+func JSON(c *gin.Context, status int, v any) {
+	if apperrors.ClientDisconnected(c.Request.Context()) {
+		return
+	}
+	doc, err := shape(c, v)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(status, doc)
+}
+
+func shape(c *gin.Context, v any) (any, error) {
+	expanders := routeExpanders(c)
+	tree, err := requestedExpansions(c, expanders)
+	if err != nil {
+		return nil, err
+	}
+	selection, err := requestedFields(c)
+	if err != nil {
+		return nil, err
+	}
+	format, res := negotiate(c)
+	if tree == nil && selection == nil && format == Plain {
+		return v, nil
+	}
+
+	doc, err := toDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	if tree != nil {
+		if err := expand(c.Request.Context(), resources(doc), tree, expanders); err != nil {
+			return nil, err
+		}
+	}
+	if selection != nil {
+		doc = project(doc, selection)
+	}
+
+	switch format {
+	case JSONAPI:
+		c.Header("Content-Type", JSONAPIType)
+		return toJSONAPI(doc, res, expanders, c.Request.URL.RequestURI()), nil
+	case HAL:
+		c.Header("Content-Type", HALType)
+		return toHAL(doc, res, expanders, c.Request.URL.RequestURI()), nil
+	}
+	return doc, nil
+}
+
+// toDocument converts v to its generic JSON form
+func toDocument(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return doc, dec.Decode(&doc)
+}
+
+// resources returns the resource objects in a document: the items of a data list,
+// a data object, or the document itself
+func resources(doc any) []map[string]any {
+	if obj, ok := doc.(map[string]any); ok {
+		if data, ok := obj["data"]; ok {
+			doc = data
+		}
+	}
+	switch d := doc.(type) {
+	case map[string]any:
+		return []map[string]any{d}
+	case []any:
+		list := make([]map[string]any, 0, len(d))
+		for _, item := range d {
+			if obj, ok := item.(map[string]any); ok {
+				list = append(list, obj)
+			}
+		}
+		return list
+	}
+	return nil
+}
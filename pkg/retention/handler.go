@@ -0,0 +1,41 @@
+package retention
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-api/pkg/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes admin endpoints for inspecting and running retention policies
+type Handler struct {
+	purger *Purger
+}
+
+// NewHandler creates a retention handler
+func NewHandler(purger *Purger) *Handler {
+	return &Handler{purger: purger}
+}
+
+// RegisterRoutes mounts the retention endpoints on an admin router group
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/retention", h.list)
+	rg.POST("/retention/:name/run", routing.Query("dryRun"), h.run)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.purger.Policies()})
+}
+
+// run purges one policy synchronously; pass dryRun=true to only count expired records
+func (h *Handler) run(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+	run, err := h.purger.Run(c.Request.Context(), c.Param("name"), dryRun)
+	if err != nil && run.Policy == "" {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,11 @@
+package retention
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var recordsPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "retention_records_purged_total",
+	Help: "Records deleted or archived by retention policies.",
+}, []string{"policy"})
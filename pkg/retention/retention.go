@@ -0,0 +1,244 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Target holds records that expire. Implementations remove data in small batches so a
+// purge never holds long locks.
+type Target interface {
+	// Count returns how many records are older than cutoff
+	Count(ctx context.Context, cutoff time.Time) (int64, error)
+	// Purge deletes or archives up to limit records older than cutoff and returns how
+	// many it removed
+	Purge(ctx context.Context, cutoff time.Time, limit int) (int64, error)
+}
+
+// Policy declares how long a kind of data is kept
+type Policy struct {
+	Name        string
+	Description string
+	MaxAge      time.Duration
+	Target      Target
+}
+
+// Declarer is implemented by stores that declare retention for the data they own
+type Declarer interface {
+	RetentionPolicies() []Policy
+}
+
+// Config holds purge scheduler configuration
+type Config struct {
+	Enabled   bool                     `yaml:"enabled"`
+	Interval  time.Duration            `yaml:"interval"`
+	BatchSize int                      `yaml:"batchSize"`
+	DryRun    bool                     `yaml:"dryRun"`  // Only count expired records
+	MaxAges   map[string]time.Duration `yaml:"maxAges"` // Overrides of policy max ages by name
+}
+
+// Run is the outcome of purging one policy
+type Run struct {
+	Policy     string    `json:"policy"`
+	DryRun     bool      `json:"dryRun"`
+	Cutoff     time.Time `json:"cutoff"`
+	Removed    int64     `json:"removed"` // Records that would be removed on a dry run
+	Batches    int       `json:"batches"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// PolicyStatus describes a registered policy and its last run
+type PolicyStatus struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	MaxAge      time.Duration `json:"maxAge"`
+	LastRun     *Run          `json:"lastRun,omitempty"`
+}
+
+// Purger runs registered policies on a schedule
+type Purger struct {
+	cfg Config
+
+	mu       sync.Mutex
+	policies map[string]Policy
+	lastRun  map[string]Run
+	running  map[string]bool
+}
+
+// NewPurger creates a purger
+func NewPurger(cfg Config) *Purger {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	return &Purger{
+		cfg:      cfg,
+		policies: make(map[string]Policy),
+		lastRun:  make(map[string]Run),
+		running:  make(map[string]bool),
+	}
+}
+
+// Register adds a policy, applying any configured max age override
+func (p *Purger) Register(policy Policy) {
+	if age, ok := p.cfg.MaxAges[policy.Name]; ok {
+		policy.MaxAge = age
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies[policy.Name] = policy
+}
+
+// RegisterFrom registers the policies of every value that implements Declarer, so
+// stores without expiring data, such as in-memory ones, can be passed as well
+func (p *Purger) RegisterFrom(values ...any) {
+	for _, v := range values {
+		if d, ok := v.(Declarer); ok {
+			for _, policy := range d.RetentionPolicies() {
+				p.Register(policy)
+			}
+		}
+	}
+}
+
+// Start purges every policy each interval until ctx is cancelled, unless disabled
+func (p *Purger) Start(ctx context.Context) {
+	if !p.cfg.Enabled {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			p.RunAll(ctx, p.cfg.DryRun)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunAll purges every policy in name order
+func (p *Purger) RunAll(ctx context.Context, dryRun bool) []Run {
+	p.mu.Lock()
+	names := make([]string, 0, len(p.policies))
+	for name := range p.policies {
+		names = append(names, name)
+	}
+	p.mu.Unlock()
+	sort.Strings(names)
+
+	runs := make([]Run, 0, len(names))
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		run, _ := p.Run(ctx, name, dryRun)
+		if run.Policy == "" {
+			continue // Already running from an admin request
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Run purges one policy. On a dry run expired records are only counted.
+func (p *Purger) Run(ctx context.Context, name string, dryRun bool) (Run, error) {
+	p.mu.Lock()
+	policy, ok := p.policies[name]
+	if !ok {
+		p.mu.Unlock()
+		return Run{}, apperrors.NewNotFoundError("Retention policy not found")
+	}
+	if p.running[name] {
+		p.mu.Unlock()
+		return Run{}, apperrors.NewConflictError("Retention policy is already running")
+	}
+	p.running[name] = true
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, name)
+		p.mu.Unlock()
+	}()
+
+	run := Run{Policy: name, DryRun: dryRun, Cutoff: time.Now().UTC().Add(-policy.MaxAge), StartedAt: time.Now().UTC()}
+	err := p.purge(ctx, policy, &run)
+	run.FinishedAt = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+		logger.Error("retention purge failed", zap.String("policy", name), zap.Int64("removed", run.Removed), zap.Error(err))
+	} else {
+		logger.Info("retention purge finished",
+			zap.String("policy", name),
+			zap.Bool("dryRun", dryRun),
+			zap.Int64("removed", run.Removed),
+			zap.Duration("took", run.FinishedAt.Sub(run.StartedAt)))
+	}
+
+	p.mu.Lock()
+	p.lastRun[name] = run
+	p.mu.Unlock()
+	return run, err
+}
+
+func (p *Purger) purge(ctx context.Context, policy Policy, run *Run) error {
+	if run.DryRun {
+		n, err := policy.Target.Count(ctx, run.Cutoff)
+		run.Removed = n
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := policy.Target.Purge(ctx, run.Cutoff, p.cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("batch %d: %w", run.Batches+1, err)
+		}
+		run.Batches++
+		run.Removed += n
+		recordsPurged.WithLabelValues(policy.Name).Add(float64(n))
+
+		if n < int64(p.cfg.BatchSize) {
+			return nil
+		}
+		logger.Debug("retention purge progress", zap.String("policy", policy.Name), zap.Int64("removed", run.Removed))
+	}
+}
+
+// Policies returns the registered policies and their last runs
+func (p *Purger) Policies() []PolicyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := make([]PolicyStatus, 0, len(p.policies))
+	for name, policy := range p.policies {
+		status := PolicyStatus{Name: name, Description: policy.Description, MaxAge: policy.MaxAge}
+		if run, ok := p.lastRun[name]; ok {
+			status.LastRun = &run
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
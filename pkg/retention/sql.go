@@ -0,0 +1,85 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-api/pkg/database"
+)
+
+// SQLTable is a Target for rows of a table with a timestamp column. When ArchiveTable
+// is set, rows are moved there instead of deleted; it must have the same columns.
+type SQLTable struct {
+	DB           *sql.DB
+	Table        string
+	KeyColumn    string // Defaults to id
+	TimeColumn   string
+	Where        string // Extra condition, such as "status = 'completed'"
+	ArchiveTable string
+}
+
+func (t SQLTable) condition() string {
+	cond := t.TimeColumn + " < $1"
+	if t.Where != "" {
+		cond += " AND (" + t.Where + ")"
+	}
+	return cond
+}
+
+func (t SQLTable) Count(ctx context.Context, cutoff time.Time) (int64, error) {
+	var n int64
+	err := t.DB.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, t.Table, t.condition()), cutoff).Scan(&n)
+	return n, err
+}
+
+func (t SQLTable) Purge(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	key := t.KeyColumn
+	if key == "" {
+		key = "id"
+	}
+	if t.ArchiveTable != "" && database.Dialect(t.DB) == database.SQLite {
+		return t.archive(ctx, key, cutoff, limit)
+	}
+	batch := fmt.Sprintf(`SELECT %s FROM %s WHERE %s LIMIT $2`, key, t.Table, t.condition())
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s IN (%s)`, t.Table, key, batch)
+	if t.ArchiveTable != "" {
+		// Move the batch in one statement so a row is never in both tables or neither
+		query = fmt.Sprintf(`
+			WITH moved AS (DELETE FROM %s WHERE %s IN (%s) RETURNING *)
+			INSERT INTO %s SELECT * FROM moved`, t.Table, key, batch, t.ArchiveTable)
+	}
+
+	res, err := t.DB.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// archive moves a batch in a transaction, as SQLite can't delete in a WITH clause.
+// The transaction holds the write lock, so both statements see the same ordered batch.
+func (t SQLTable) archive(ctx context.Context, key string, cutoff time.Time, limit int) (int64, error) {
+	batch := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT $2`, key, t.Table, t.condition(), key)
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s WHERE %s IN (%s)`,
+		t.ArchiveTable, t.Table, key, batch), cutoff, limit); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s IN (%s)`, t.Table, key, batch), cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,180 @@
+// Package retrysafe classes routes by how safe it is for clients to retry them.
+// Error responses tell clients whether and when to retry, and routes that can't be
+// retried safely are listed at startup so they get Idempotency-Key support.
+package retrysafe
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Class is how safe retrying a route is
+type Class string
+
+const (
+	Safe       Class = "safe"       // No side effects, like GET
+	Idempotent Class = "idempotent" // Repeating it has the effect of doing it once, like PUT
+	Keyed      Class = "key"        // Retry-safe when sent again with the same Idempotency-Key
+	Unsafe     Class = "unsafe"     // Retrying may repeat its side effects
+)
+
+// Headers telling clients about retries
+const (
+	KeyHeader   = "Idempotency-Key"
+	ClassHeader = "X-Idempotency-Class"
+	SafeHeader  = "X-Retry-Safe" // true or false, on error responses
+)
+
+// Config holds route classes set in configuration and the hints of error responses
+type Config struct {
+	Routes     map[string]Class `yaml:"routes"`     // By "METHOD /route/:param", overriding the route's own
+	Audit      []string         `yaml:"audit"`      // Path prefixes of the routes checked at startup
+	RetryAfter time.Duration    `yaml:"retryAfter"` // Suggested on transient errors that don't set it
+}
+
+const classKey = "retrySafeClass"
+
+var (
+	mu       sync.RWMutex
+	cfg      Config
+	declared = map[string]Class{}
+)
+
+// Configure sets the classes set in configuration and the error hints
+func Configure(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+}
+
+// Declare sets the class of the route of method at the full path, like
+// POST /api/v1/documents
+func Declare(method, path string, class Class) {
+	mu.Lock()
+	defer mu.Unlock()
+	declared[method+" "+path] = class
+}
+
+// Of returns the class of a route: its configured override, the class it declared,
+// or the one its method implies
+func Of(method, path string) Class {
+	mu.RLock()
+	defer mu.RUnlock()
+	if class, ok := cfg.Routes[method+" "+path]; ok {
+		return class
+	}
+	if class, ok := declared[method+" "+path]; ok {
+		return class
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return Safe
+	case http.MethodPut, http.MethodDelete:
+		return Idempotent
+	}
+	return Unsafe
+}
+
+// ClassOf returns the class of the request's route, once Middleware has run
+func ClassOf(c *gin.Context) Class {
+	if class, ok := c.Get(classKey); ok {
+		return class.(Class)
+	}
+	return Of(c.Request.Method, c.FullPath())
+}
+
+// retrySafe reports whether the request can be sent again as it is
+func retrySafe(c *gin.Context, class Class) bool {
+	switch class {
+	case Safe, Idempotent:
+		return true
+	case Keyed:
+		return c.GetHeader(KeyHeader) != ""
+	}
+	return false
+}
+
+// Middleware tags requests with the class of their route and adds retry hints to
+// error responses: the class, whether the request can be retried as it is, and a
+// Retry-After on transient errors. Rate limited and unavailable requests weren't
+// served, so they can always be retried later; gateway errors only when retrying is
+// safe, as the outcome is unknown. It belongs after ErrorHandler, whose responses it
+// hints too.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class := Of(c.Request.Method, c.FullPath())
+		c.Set(classKey, class)
+		c.Writer = &hintWriter{ResponseWriter: c.Writer, c: c, class: class}
+		c.Next()
+	}
+}
+
+// hintWriter adds the retry hints once the status of an error response is set
+type hintWriter struct {
+	gin.ResponseWriter
+	c     *gin.Context
+	class Class
+}
+
+func (w *hintWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest && !w.Written() {
+		w.hint(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *hintWriter) hint(code int) {
+	h := w.Header()
+	safe := retrySafe(w.c, w.class)
+	h.Set(ClassHeader, string(w.class))
+	h.Set(SafeHeader, strconv.FormatBool(safe))
+	if h.Get("Retry-After") != "" {
+		return
+	}
+	switch code {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		if !safe {
+			return
+		}
+	default:
+		return
+	}
+	mu.RLock()
+	after := cfg.RetryAfter
+	mu.RUnlock()
+	if after > 0 {
+		h.Set("Retry-After", strconv.Itoa(int(max(after.Round(time.Second), time.Second)/time.Second)))
+	}
+}
+
+// Audit warns about the routes under the audited prefixes that are unsafe to
+// retry, returning them as "METHOD /path"
+func Audit(routes gin.RoutesInfo) []string {
+	mu.RLock()
+	prefixes := cfg.Audit
+	mu.RUnlock()
+	var unsafe []string
+	for _, rt := range routes {
+		audited := false
+		for _, prefix := range prefixes {
+			audited = audited || strings.HasPrefix(rt.Path, prefix)
+		}
+		if audited && Of(rt.Method, rt.Path) == Unsafe {
+			unsafe = append(unsafe, rt.Method+" "+rt.Path)
+		}
+	}
+	if len(unsafe) > 0 {
+		logger.Warn("routes are unsafe to retry, declare their idempotency class or support Idempotency-Key",
+			zap.Strings("routes", unsafe))
+	}
+	return unsafe
+}
@@ -0,0 +1,194 @@
+// Package rewrite applies config-driven rules to requests and responses: headers are
+// added, removed or rewritten and response status codes remapped for the routes a
+// rule matches. It wraps the whole router, so rules see every request, including
+// ones that match no route, and can enforce organisation-wide header standards.
+package rewrite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Config holds the rules, applied in order
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule applies header operations and status mapping to matching requests
+type Rule struct {
+	Name string `json:"name"`
+	// Paths match exactly, with path.Match wildcards, or as a prefix when ending in
+	// "/*". Every path matches when empty, and so do every method when Methods is.
+	Paths    []string    `json:"paths,omitempty"`
+	Methods  []string    `json:"methods,omitempty"`
+	Request  HeaderOps   `json:"request,omitempty"`
+	Response HeaderOps   `json:"response,omitempty"`
+	Status   map[int]int `json:"status,omitempty"` // Response status mapping, like {"502": 503}
+}
+
+// HeaderOps edits headers. Operations run in field order: remove, replace, set, add.
+type HeaderOps struct {
+	Remove  []string          `json:"remove,omitempty"`
+	Replace []Replacement     `json:"replace,omitempty"`
+	Set     map[string]string `json:"set,omitempty"`
+	Add     map[string]string `json:"add,omitempty"`
+}
+
+// Replacement rewrites a header's values with a regular expression
+type Replacement struct {
+	Header  string `json:"header"`
+	Pattern string `json:"pattern"`
+	With    string `json:"with"` // May reference groups as $1 or ${name}
+
+	re *regexp.Regexp
+}
+
+func (h HeaderOps) empty() bool {
+	return len(h.Remove) == 0 && len(h.Replace) == 0 && len(h.Set) == 0 && len(h.Add) == 0
+}
+
+func (h HeaderOps) apply(header http.Header) {
+	for _, name := range h.Remove {
+		header.Del(name)
+	}
+	for _, r := range h.Replace {
+		values := header.Values(r.Header)
+		for i, v := range values {
+			values[i] = r.re.ReplaceAllString(v, r.With)
+		}
+	}
+	for name, value := range h.Set {
+		header.Set(name, value)
+	}
+	for name, value := range h.Add {
+		header.Add(name, value)
+	}
+}
+
+func (r Rule) matches(req *http.Request) bool {
+	if len(r.Methods) > 0 && !slices.Contains(r.Methods, req.Method) {
+		return false
+	}
+	if len(r.Paths) == 0 {
+		return true
+	}
+	p := path.Clean("/" + req.URL.Path)
+	for _, pattern := range r.Paths {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+		} else if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler applies the rules in cfg around next. Invalid patterns are reported up
+// front rather than skipped silently.
+func Handler(cfg Config, next http.Handler) (http.Handler, error) {
+	if len(cfg.Rules) == 0 {
+		return next, nil
+	}
+	rules := slices.Clone(cfg.Rules)
+	for i := range rules {
+		r := &rules[i]
+		for _, pattern := range r.Paths {
+			if _, err := path.Match(pattern, "/"); err != nil {
+				return nil, fmt.Errorf("rewrite rule %s: path %q: %w", r.Name, pattern, err)
+			}
+		}
+		for _, ops := range []*HeaderOps{&r.Request, &r.Response} {
+			ops.Replace = slices.Clone(ops.Replace)
+			for j := range ops.Replace {
+				re, err := regexp.Compile(ops.Replace[j].Pattern)
+				if err != nil {
+					return nil, fmt.Errorf("rewrite rule %s: header %s: %w", r.Name, ops.Replace[j].Header, err)
+				}
+				ops.Replace[j].re = re
+			}
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var matched []*Rule
+		for i := range rules {
+			if rules[i].matches(req) {
+				matched = append(matched, &rules[i])
+			}
+		}
+		if len(matched) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		rewritten := false
+		for _, r := range matched {
+			if !r.Request.empty() {
+				if !rewritten {
+					req = req.Clone(req.Context())
+					rewritten = true
+				}
+				r.Request.apply(req.Header)
+			}
+		}
+		next.ServeHTTP(&responseWriter{ResponseWriter: w, rules: matched}, req)
+	}), nil
+}
+
+// responseWriter applies the response side of the rules when the header is written
+type responseWriter struct {
+	http.ResponseWriter
+	rules       []*Rule
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	for _, r := range w.rules {
+		if mapped, ok := r.Status[status]; ok {
+			status = mapped
+		}
+		r.Response.apply(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
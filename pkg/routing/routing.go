@@ -0,0 +1,137 @@
+// Package routing makes path matching and query parameter handling predictable:
+// request paths are canonicalized before routing and routes can declare the query
+// parameters they accept, so typos are reported instead of silently ignored.
+package routing
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Trailing slash handling
+const (
+	TrailingSlashRedirect = "redirect" // Redirect to the route without (or with) the slash when one exists
+	TrailingSlashStrip    = "strip"    // Serve /users/ as /users
+	TrailingSlashStrict   = "strict"   // /users/ and /users are different paths
+)
+
+// Unknown query parameter handling
+const (
+	UnknownQueryIgnore = "ignore"
+	UnknownQueryWarn   = "warn"   // Log and add a Warning header
+	UnknownQueryReject = "reject" // Answer 400
+)
+
+// Config holds routing configuration
+type Config struct {
+	TrailingSlash   string `yaml:"trailingSlash"`
+	CollapseSlashes bool   `yaml:"collapseSlashes"` // Serve /a//b as /a/b
+	CaseInsensitive bool   `yaml:"caseInsensitive"` // Redirect /Users to /users when only the latter exists
+	UnknownQuery    string `yaml:"unknownQuery"`
+}
+
+var (
+	mu           sync.RWMutex
+	unknownQuery = UnknownQueryWarn
+)
+
+// Configure applies the options gin implements itself and sets how undeclared query
+// parameters are treated
+func Configure(r *gin.Engine, cfg Config) {
+	r.RedirectTrailingSlash = cfg.TrailingSlash == "" || cfg.TrailingSlash == TrailingSlashRedirect
+	r.RedirectFixedPath = cfg.CaseInsensitive
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cfg.UnknownQuery != "" {
+		unknownQuery = cfg.UnknownQuery
+	}
+}
+
+// Canonicalize rewrites the request path before it is routed. It wraps the whole
+// router so the canonical path is also what path-based wrappers like API version
+// negotiation see.
+func Canonicalize(cfg Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := req.URL.Path
+		if cfg.CollapseSlashes && strings.Contains(path, "//") {
+			path = collapse(path)
+		}
+		if cfg.TrailingSlash == TrailingSlashStrip && len(path) > 1 {
+			path = strings.TrimRight(path, "/")
+			if path == "" {
+				path = "/"
+			}
+		}
+		if path != req.URL.Path {
+			req.URL.Path = path
+			req.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func collapse(path string) string {
+	var b strings.Builder
+	b.Grow(len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && i > 0 && path[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// Query declares the query parameters a route accepts. Others are ignored, logged
+// with a Warning header or rejected depending on the configured mode.
+func Query(params ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(params))
+	for _, p := range params {
+		allowed[p] = true
+	}
+
+	return func(c *gin.Context) {
+		mu.RLock()
+		mode := unknownQuery
+		mu.RUnlock()
+		if mode == UnknownQueryIgnore {
+			c.Next()
+			return
+		}
+
+		var unknown []string
+		for name := range c.Request.URL.Query() {
+			if !allowed[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) == 0 {
+			c.Next()
+			return
+		}
+		sort.Strings(unknown)
+
+		if mode == UnknownQueryReject {
+			details := make([]apperrors.FieldError, len(unknown))
+			for i, name := range unknown {
+				details[i] = apperrors.FieldError{Field: name, Rule: "unknown", Message: name + " is not a known query parameter"}
+			}
+			c.Error(apperrors.NewValidationError("unknown query parameters", details...))
+			c.Abort()
+			return
+		}
+
+		logger.Warn("unknown query parameters", zap.String("path", c.FullPath()), zap.Strings("parameters", unknown))
+		c.Header("Warning", `299 - "Unknown query parameters: `+strings.Join(unknown, ", ")+`"`)
+		c.Next()
+	}
+}
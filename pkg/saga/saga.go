@@ -0,0 +1,347 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+	"go-api/pkg/queue"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// JobType is the job queue type used to run saga steps
+const JobType = "saga.step"
+
+// Status is the lifecycle state of a saga instance
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompleted    Status = "completed"
+	StatusCompensating Status = "compensating"
+	StatusCompensated  Status = "compensated"
+	StatusFailed       Status = "failed" // A compensation itself failed, needs manual attention
+)
+
+// Finished reports whether the saga will make no further progress on its own
+func (s Status) Finished() bool {
+	return s == StatusCompleted || s == StatusCompensated || s == StatusFailed
+}
+
+// Step is one action of a saga and the compensation undoing it. Both run at least
+// once and may be retried after a crash, so they must be idempotent.
+type Step struct {
+	Name       string
+	Action     func(ctx context.Context, state *State) error
+	Compensate func(ctx context.Context, state *State) error // Optional
+}
+
+// Definition is a named sequence of steps
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// StepState records the outcome of a step
+type StepState struct {
+	Name        string     `json:"name"`
+	Completed   bool       `json:"completed"`
+	Compensated bool       `json:"compensated"`
+	Error       string     `json:"error,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Instance is a persisted run of a saga
+type Instance struct {
+	ID        string      `json:"id"`
+	Saga      string      `json:"saga"`
+	Status    Status      `json:"status"`
+	Current   int         `json:"current"` // Index of the next step to run or compensate
+	State     *State      `json:"state"`
+	Steps     []StepState `json:"steps"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// State is the data shared between steps, persisted with the instance so
+// compensations can use values produced by earlier actions
+type State struct {
+	mu     sync.Mutex
+	values map[string]json.RawMessage
+}
+
+// Get decodes the value stored under key into v, returning false if it is not set
+func (s *State) Get(key string, v any) (bool, error) {
+	s.mu.Lock()
+	raw, ok := s.values[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Set stores v under key
+func (s *State) Set(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]json.RawMessage)
+	}
+	s.values[key] = raw
+	return nil
+}
+
+func (s *State) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(s.values)
+}
+
+func (s *State) UnmarshalJSON(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Unmarshal(b, &s.values)
+}
+
+type stepJob struct {
+	InstanceID string `json:"instanceId"`
+}
+
+// Declarer is implemented by modules running sagas
+type Declarer interface {
+	Sagas() []Definition
+}
+
+// Orchestrator runs saga steps through the job queue, persisting progress after
+// every step so a restarted process resumes where the previous one stopped. The
+// job queue is in memory, so the store is what survives restarts: Resume
+// schedules anew the instances the store has unfinished.
+type Orchestrator struct {
+	store     Store
+	jobs      *queue.Manager
+	queueName string
+
+	mu   sync.RWMutex
+	defs map[string]Definition
+}
+
+// NewOrchestrator creates an orchestrator and registers its step handler on the job queue
+func NewOrchestrator(store Store, jobs *queue.Manager, queueName string) *Orchestrator {
+	o := &Orchestrator{
+		store:     store,
+		jobs:      jobs,
+		queueName: queueName,
+		defs:      make(map[string]Definition),
+	}
+	jobs.Register(JobType, o.handle)
+	return o
+}
+
+// Register makes a saga definition available to Start
+func (o *Orchestrator) Register(def Definition) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.defs[def.Name] = def
+}
+
+// RegisterFrom registers the definitions of every value implementing Declarer
+func (o *Orchestrator) RegisterFrom(values ...any) {
+	for _, v := range values {
+		if d, ok := v.(Declarer); ok {
+			for _, def := range d.Sagas() {
+				o.Register(def)
+			}
+		}
+	}
+}
+
+// Start persists a new instance of the named saga and schedules its first step
+func (o *Orchestrator) Start(ctx context.Context, name string, initial map[string]any) (*Instance, error) {
+	def, ok := o.definition(name)
+	if !ok {
+		return nil, fmt.Errorf("saga %q is not registered", name)
+	}
+
+	state := &State{}
+	for key, v := range initial {
+		if err := state.Set(key, v); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	inst := &Instance{
+		ID:        uuid.New().String(),
+		Saga:      name,
+		Status:    StatusRunning,
+		State:     state,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, step := range def.Steps {
+		inst.Steps = append(inst.Steps, StepState{Name: step.Name})
+	}
+
+	if err := o.store.Save(ctx, inst); err != nil {
+		return nil, err
+	}
+	return inst, o.schedule(ctx, inst.ID)
+}
+
+// Get returns a saga instance
+func (o *Orchestrator) Get(ctx context.Context, id string) (*Instance, error) {
+	return o.store.Get(ctx, id)
+}
+
+// Resume schedules every unfinished instance of a registered saga. Call it once
+// at startup, after registering the definitions; instances of sagas no longer
+// registered are left in the store, and logged.
+func (o *Orchestrator) Resume(ctx context.Context) error {
+	instances, err := o.store.ListUnfinished(ctx)
+	if err != nil {
+		return err
+	}
+	resumed := 0
+	for _, inst := range instances {
+		if _, ok := o.definition(inst.Saga); !ok {
+			logger.Warn("not resuming saga that is not registered", zap.String("saga", inst.Saga), zap.String("id", inst.ID))
+			continue
+		}
+		if err := o.schedule(ctx, inst.ID); err != nil {
+			return err
+		}
+		resumed++
+	}
+	if resumed > 0 {
+		logger.Info("resumed sagas", zap.Int("count", resumed))
+	}
+	return nil
+}
+
+func (o *Orchestrator) definition(name string) (Definition, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	def, ok := o.defs[name]
+	return def, ok
+}
+
+func (o *Orchestrator) schedule(ctx context.Context, id string) error {
+	_, err := o.jobs.Enqueue(ctx, o.queueName, JobType, stepJob{InstanceID: id})
+	return err
+}
+
+// handle runs a single step or compensation per job. Failed actions are retried by
+// the queue; once the job's attempts are exhausted the saga starts compensating.
+func (o *Orchestrator) handle(ctx context.Context, job *queue.Job) error {
+	var payload stepJob
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	inst, err := o.store.Get(ctx, payload.InstanceID)
+	if err != nil {
+		return err
+	}
+	if inst.Status.Finished() {
+		return nil
+	}
+	if inst.State == nil {
+		inst.State = &State{}
+	}
+
+	def, ok := o.definition(inst.Saga)
+	if !ok {
+		return fmt.Errorf("saga %q is not registered", inst.Saga)
+	}
+
+	lastAttempt := job.Attempts >= job.MaxAttempts
+	now := time.Now().UTC()
+
+	switch inst.Status {
+	case StatusRunning:
+		if inst.Current >= len(def.Steps) {
+			inst.Status = StatusCompleted
+			break
+		}
+
+		step := def.Steps[inst.Current]
+		if err := step.Action(ctx, inst.State); err != nil {
+			inst.Steps[inst.Current].Error = err.Error()
+			inst.Steps[inst.Current].UpdatedAt = &now
+			if !lastAttempt {
+				o.save(ctx, inst)
+				return err
+			}
+			logger.Warn("saga step failed, compensating",
+				zap.String("saga", inst.Saga), zap.String("id", inst.ID), zap.String("step", step.Name), zap.Error(err))
+			inst.Status = StatusCompensating
+			inst.Current--
+			break
+		}
+
+		inst.Steps[inst.Current].Completed = true
+		inst.Steps[inst.Current].Error = ""
+		inst.Steps[inst.Current].UpdatedAt = &now
+		inst.Current++
+		if inst.Current == len(def.Steps) {
+			inst.Status = StatusCompleted
+		}
+
+	case StatusCompensating:
+		if inst.Current < 0 {
+			inst.Status = StatusCompensated
+			break
+		}
+
+		step := def.Steps[inst.Current]
+		if step.Compensate != nil {
+			if err := step.Compensate(ctx, inst.State); err != nil {
+				inst.Steps[inst.Current].Error = err.Error()
+				inst.Steps[inst.Current].UpdatedAt = &now
+				if !lastAttempt {
+					o.save(ctx, inst)
+					return err
+				}
+				logger.Error("saga compensation failed",
+					zap.String("saga", inst.Saga), zap.String("id", inst.ID), zap.String("step", step.Name), zap.Error(err))
+				inst.Status = StatusFailed
+				break
+			}
+		}
+
+		inst.Steps[inst.Current].Compensated = true
+		inst.Steps[inst.Current].UpdatedAt = &now
+		inst.Current--
+		if inst.Current < 0 {
+			inst.Status = StatusCompensated
+		}
+	}
+
+	if err := o.store.Save(ctx, inst); err != nil {
+		return err
+	}
+	if inst.Status.Finished() {
+		return nil
+	}
+	return o.schedule(ctx, inst.ID)
+}
+
+// save persists intermediate error state; failures are logged since the job is retried anyway
+func (o *Orchestrator) save(ctx context.Context, inst *Instance) {
+	inst.UpdatedAt = time.Now().UTC()
+	if err := o.store.Save(ctx, inst); err != nil {
+		logger.Warn("failed to save saga state", zap.String("id", inst.ID), zap.Error(err))
+	}
+}
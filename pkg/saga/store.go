@@ -0,0 +1,169 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+	"go-api/pkg/retention"
+)
+
+// Store persists saga instances
+type Store interface {
+	Save(ctx context.Context, inst *Instance) error
+	Get(ctx context.Context, id string) (*Instance, error)
+	ListUnfinished(ctx context.Context) ([]*Instance, error)
+}
+
+var errInstanceNotFound = apperrors.NewNotFoundError("Saga instance not found")
+
+// MemoryStore keeps instances in memory. It does not survive restarts and is only
+// meant for development and single-process deployments without a database.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	instances map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{instances: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, inst *Instance) error {
+	raw, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instances[inst.ID] = raw
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Instance, error) {
+	s.mu.RLock()
+	raw, ok := s.instances[id]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, errInstanceNotFound
+	}
+	var inst Instance
+	return &inst, json.Unmarshal(raw, &inst)
+}
+
+func (s *MemoryStore) ListUnfinished(ctx context.Context) ([]*Instance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []*Instance
+	for _, raw := range s.instances {
+		var inst Instance
+		if err := json.Unmarshal(raw, &inst); err != nil {
+			return nil, err
+		}
+		if !inst.Status.Finished() {
+			list = append(list, &inst)
+		}
+	}
+	return list, nil
+}
+
+// SQLStore persists instances in the saga_instances table, with step state as JSON
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EnsureSchema creates the saga_instances table if it does not exist
+func (s *SQLStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS saga_instances (
+			id         TEXT PRIMARY KEY,
+			saga       TEXT NOT NULL,
+			status     TEXT NOT NULL,
+			data       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`)
+	return err
+}
+
+func (s *SQLStore) Save(ctx context.Context, inst *Instance) error {
+	inst.UpdatedAt = time.Now().UTC()
+	raw, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO saga_instances (id, saga, status, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at`,
+		inst.ID, inst.Saga, inst.Status, string(raw), inst.CreatedAt, inst.UpdatedAt)
+	return err
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (*Instance, error) {
+	var raw string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM saga_instances WHERE id = $1`, id).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInstanceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var inst Instance
+	return &inst, json.Unmarshal([]byte(raw), &inst)
+}
+
+func (s *SQLStore) ListUnfinished(ctx context.Context) ([]*Instance, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT data FROM saga_instances WHERE status IN ($1, $2)`,
+		StatusRunning, StatusCompensating)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Instance
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var inst Instance
+		if err := json.Unmarshal([]byte(raw), &inst); err != nil {
+			return nil, err
+		}
+		list = append(list, &inst)
+	}
+	return list, rows.Err()
+}
+
+// RetentionPolicies drops sagas that finished without needing attention
+func (s *SQLStore) RetentionPolicies() []retention.Policy {
+	return []retention.Policy{{
+		Name:        "saga_instances_finished",
+		Description: "Completed and compensated saga instances",
+		MaxAge:      30 * 24 * time.Hour,
+		Target: retention.SQLTable{
+			DB:         s.db,
+			Table:      "saga_instances",
+			TimeColumn: "updated_at",
+			Where:      "status IN ('" + string(StatusCompleted) + "', '" + string(StatusCompensated) + "')",
+		},
+	}}
+}
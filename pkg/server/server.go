@@ -0,0 +1,308 @@
+// Package server runs the HTTP listeners. Each listener binds a TCP address or a Unix
+// socket, serves all paths or only some, so admin and debug endpoints can be kept off
+// the public interface, and picks its own protocols: plain HTTP/1.1, cleartext
+// HTTP/2 (h2c) for deployments behind a proxy that speaks HTTP/2 to its upstreams,
+// TLS with HTTP/2, and an experimental HTTP/3 listener over QUIC on the same port.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+)
+
+// Config holds the listeners to serve
+type Config struct {
+	Listeners         []Listener    `yaml:"listeners"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"` // How long in-flight requests get to finish
+	// ReadinessPath answers 200 while serving and 503 once shutdown begins, on every
+	// listener and ahead of the handler so no middleware can get in its way
+	ReadinessPath string `yaml:"readinessPath"`
+	// DrainDelay keeps serving with readiness failing for this long after a shutdown
+	// signal, so load balancers stop routing here before the listeners close. It
+	// should exceed the readiness probe period times its failure threshold.
+	DrainDelay time.Duration `yaml:"drainDelay"`
+}
+
+// Networks a listener can bind
+const (
+	NetworkTCP  = "tcp"
+	NetworkUnix = "unix"
+	// NetworkSystemd takes a socket passed by systemd socket activation. Address is
+	// its FileDescriptorName, or empty for the first socket no other listener named.
+	NetworkSystemd = "systemd"
+)
+
+// Listener is one address the server accepts connections on
+type Listener struct {
+	Name       string `json:"name" yaml:"name"`
+	Network    string `json:"network,omitempty" yaml:"network"`       // tcp (default) or unix
+	Address    string `json:"address" yaml:"address"`                 // host:port, or the socket path
+	SocketMode string `json:"socketMode,omitempty" yaml:"socketMode"` // Octal permissions like "0660"
+	// Include limits the listener to these path prefixes, Exclude hides them from it.
+	// Excluded paths answer 404 as if they didn't exist.
+	Include []string `json:"include,omitempty" yaml:"include"`
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude"`
+
+	H2C         bool   `json:"h2c,omitempty" yaml:"h2c"`
+	TLSCertFile string `json:"tlsCertFile,omitempty" yaml:"tlsCertFile"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty" yaml:"tlsKeyFile"`
+	// HTTP3 also serves HTTP/3 over UDP on Address, advertised to TLS clients with an
+	// Alt-Svc header. It needs TLS and is experimental.
+	HTTP3 bool `json:"http3,omitempty" yaml:"http3"`
+}
+
+func (l Listener) validate() error {
+	switch {
+	case l.Address == "" && l.Network != NetworkSystemd:
+		return fmt.Errorf("listener %s: address is required", l.Name)
+	case l.Network != "" && l.Network != NetworkTCP && l.Network != NetworkUnix && l.Network != NetworkSystemd:
+		return fmt.Errorf("listener %s: unknown network %q", l.Name, l.Network)
+	case l.SocketMode != "" && l.Network != NetworkUnix:
+		return fmt.Errorf("listener %s: socket mode is for Unix sockets", l.Name)
+	case l.HTTP3 && l.Network != "" && l.Network != NetworkTCP:
+		return fmt.Errorf("listener %s: HTTP/3 needs a UDP port", l.Name)
+	case (l.TLSCertFile == "") != (l.TLSKeyFile == ""):
+		return fmt.Errorf("listener %s: TLS needs both a certificate and a key", l.Name)
+	case l.HTTP3 && l.TLSCertFile == "":
+		return fmt.Errorf("listener %s: HTTP/3 needs TLS", l.Name)
+	case l.H2C && l.TLSCertFile != "":
+		return fmt.Errorf("listener %s: h2c is for cleartext listeners", l.Name)
+	}
+	return nil
+}
+
+// Server serves a handler on the configured listeners
+type Server struct {
+	cfg     Config
+	handler http.Handler
+	ready   atomic.Bool
+}
+
+// New creates a server, rejecting invalid listener configuration
+func New(cfg Config, handler http.Handler) (*Server, error) {
+	if len(cfg.Listeners) == 0 {
+		return nil, errors.New("no listeners configured")
+	}
+	for _, l := range cfg.Listeners {
+		if err := l.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = 15 * time.Second
+	}
+	return &Server{cfg: cfg, handler: handler}, nil
+}
+
+// shutdowner is implemented by both HTTP servers
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Run serves until ctx is cancelled, then shuts every listener down gracefully. A
+// listener failing stops the others and its error is returned. Under systemd the
+// service manager is told once every listener is up and when shutdown begins, and
+// its watchdog is kept alive while serving. Shutdown is delayed by DrainDelay with
+// the readiness probe failing and keep-alives disabled, so clients move elsewhere.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	activated, err := activatedSockets()
+	if err != nil {
+		return err
+	}
+	activated.reserve(s.cfg.Listeners)
+
+	errs := make(chan error, 2*len(s.cfg.Listeners))
+	var servers []shutdowner
+	ready := true
+	for _, l := range s.cfg.Listeners {
+		started, err := s.start(l, activated, errs)
+		servers = append(servers, started...)
+		if err != nil {
+			errs <- err
+			ready = false
+			break
+		}
+	}
+
+	if ready {
+		s.ready.Store(true)
+		if err := notify("READY=1"); err != nil {
+			logger.Warn("failed to notify systemd of readiness", zap.Error(err))
+		}
+		if interval := watchdogInterval(); interval > 0 {
+			go keepAlive(ctx, interval)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	s.ready.Store(false)
+	if notifyErr := notify("STOPPING=1"); notifyErr != nil {
+		logger.Warn("failed to notify systemd of shutdown", zap.Error(notifyErr))
+	}
+	// A failed listener means the process is going down anyway, so only signalled
+	// shutdowns wait for load balancers to drain
+	if err == nil && s.cfg.DrainDelay > 0 {
+		logger.Info("draining before shutdown", zap.Duration("delay", s.cfg.DrainDelay))
+		for _, srv := range servers {
+			if srv, ok := srv.(*http.Server); ok {
+				srv.SetKeepAlivesEnabled(false)
+			}
+		}
+		time.Sleep(s.cfg.DrainDelay)
+	}
+
+	shutdownCtx, done := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer done()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			logger.Warn("listener did not shut down cleanly", zap.Error(shutdownErr))
+		}
+	}
+	return err
+}
+
+// start serves l in the background, reporting failures on errs
+func (s *Server) start(l Listener, activated *sockets, errs chan<- error) ([]shutdowner, error) {
+	ln, err := listen(l, activated)
+	if err != nil {
+		return nil, fmt.Errorf("listener %s: %w", l.Name, err)
+	}
+
+	routes := s.readiness(filter(l, s.handler))
+	handler := routes
+	var servers []shutdowner
+	if l.HTTP3 {
+		h3 := &http3.Server{Addr: l.Address, Handler: routes}
+		servers = append(servers, h3)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h3.SetQUICHeaders(w.Header())
+			routes.ServeHTTP(w, r)
+		})
+		go func() {
+			if err := h3.ListenAndServeTLS(l.TLSCertFile, l.TLSKeyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("listener %s (HTTP/3): %w", l.Name, err)
+			}
+		}()
+	}
+
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: s.cfg.ReadHeaderTimeout}
+	if l.H2C {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	servers = append(servers, srv)
+
+	logger.Info("listening", zap.String("listener", l.Name), zap.String("network", ln.Addr().Network()), zap.String("address", ln.Addr().String()),
+		zap.Bool("tls", l.TLSCertFile != ""), zap.Bool("h2c", l.H2C), zap.Bool("http3", l.HTTP3))
+	go func() {
+		var err error
+		if l.TLSCertFile != "" {
+			err = srv.ServeTLS(ln, l.TLSCertFile, l.TLSKeyFile)
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+	}()
+	return servers, nil
+}
+
+func listen(l Listener, activated *sockets) (net.Listener, error) {
+	switch l.Network {
+	case NetworkSystemd:
+		return activated.claim(l.Address)
+	case NetworkUnix:
+	default:
+		return net.Listen(NetworkTCP, l.Address)
+	}
+	// A socket left behind by an unclean exit would make the bind fail
+	if err := os.Remove(l.Address); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen(NetworkUnix, l.Address)
+	if err != nil {
+		return nil, err
+	}
+	if l.SocketMode != "" {
+		mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+		if err == nil {
+			err = os.Chmod(l.Address, os.FileMode(mode))
+		}
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// readiness answers the readiness probe ahead of handler
+func (s *Server) readiness(handler http.Handler) http.Handler {
+	if s.cfg.ReadinessPath == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != s.cfg.ReadinessPath {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !s.ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"draining"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ready"}`))
+	})
+}
+
+// filter restricts handler to the paths the listener serves. Paths are cleaned
+// first so /x/../admin or //admin can't slip past an exclusion.
+func filter(l Listener, handler http.Handler) http.Handler {
+	if len(l.Include) == 0 && len(l.Exclude) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.ToLower(path.Clean("/" + r.URL.Path))
+		if (len(l.Include) > 0 && !matches(p, l.Include)) || matches(p, l.Exclude) {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// matches reports whether p is one of the prefixes or below one
+func matches(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.ToLower(strings.TrimRight(prefix, "/"))
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
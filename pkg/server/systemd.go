@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// listenFDsStart is the first file descriptor systemd passes
+const listenFDsStart = 3
+
+// sockets holds the listeners passed by systemd socket activation, by name
+type sockets struct {
+	byName  map[string]net.Listener
+	ordered []string // Names in the order systemd passed them
+	claimed map[string]bool
+	named   map[string]bool // Names listeners ask for explicitly
+}
+
+// activatedSockets takes the sockets systemd passed to this process, if any. The
+// environment is cleared so child processes don't inherit them.
+func activatedSockets() (*sockets, error) {
+	s := &sockets{byName: make(map[string]net.Listener), claimed: make(map[string]bool), named: make(map[string]bool)}
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return s, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return s, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" && names[i] != "unknown" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		s.byName[name] = ln
+		s.ordered = append(s.ordered, name)
+	}
+	return s, nil
+}
+
+// reserve keeps the sockets listeners name from being handed to unnamed ones
+func (s *sockets) reserve(listeners []Listener) {
+	for _, l := range listeners {
+		if l.Network == NetworkSystemd && l.Address != "" {
+			s.named[l.Address] = true
+		}
+	}
+}
+
+// claim returns the socket named name, or the first unclaimed one no listener named
+// when name is empty
+func (s *sockets) claim(name string) (net.Listener, error) {
+	if name == "" {
+		for _, n := range s.ordered {
+			if !s.claimed[n] && !s.named[n] {
+				name = n
+				break
+			}
+		}
+	}
+	ln, ok := s.byName[name]
+	if !ok || s.claimed[name] {
+		return nil, fmt.Errorf("no systemd socket %q was passed", name)
+	}
+	s.claimed[name] = true
+	return ln, nil
+}
+
+// notify sends a state to the service manager over $NOTIFY_SOCKET. It does nothing
+// when the process isn't run by systemd with Type=notify.
+func notify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:] // Abstract socket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often systemd expects a keep-alive, 0 when its
+// watchdog isn't enabled for this process. Pings are sent at half the timeout.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// keepAlive pings the systemd watchdog until ctx is cancelled
+func keepAlive(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := notify("WATCHDOG=1"); err != nil {
+				logger.Warn("failed to ping systemd watchdog", zap.Error(err))
+			}
+		}
+	}
+}
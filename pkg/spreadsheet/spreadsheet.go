@@ -0,0 +1,112 @@
+// Package spreadsheet writes tables as CSV or as XLSX workbooks of one sheet. Cells
+// keep their types in XLSX: numbers, booleans and times are stored as such, so
+// they sort and sum in spreadsheet applications, formatted by their column.
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats a sheet can be written in
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ContentTypes maps formats to their media types
+var ContentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Column describes a column of a sheet
+type Column struct {
+	Header string
+	// Format is a number format like #,##0.00 or yyyy-mm-dd, applied in XLSX. Times
+	// default to yyyy-mm-dd hh:mm:ss; in CSV, columns formatted without hours (h)
+	// have their times written as dates.
+	Format string
+	Width  float64 // In characters; 0 sizes the column to its header
+}
+
+// Sheet is a table. Cells are nil, strings, integers, floats, booleans or
+// time.Time; anything else is written as its fmt.Sprint text.
+type Sheet struct {
+	Name    string
+	Columns []Column
+	Rows    [][]any
+}
+
+// Write writes s in format, csv or xlsx
+func Write(w io.Writer, format string, s Sheet) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, s)
+	case FormatXLSX:
+		return WriteXLSX(w, s)
+	}
+	return fmt.Errorf("spreadsheet: unknown format %q", format)
+}
+
+// WriteCSV writes s as CSV with a header row
+func WriteCSV(w io.Writer, s Sheet) error {
+	cw := csv.NewWriter(w)
+	record := make([]string, len(s.Columns))
+	for i, col := range s.Columns {
+		record[i] = col.Header
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for _, row := range s.Rows {
+		for i := range record {
+			record[i] = ""
+			if i < len(row) {
+				record[i] = csvValue(row[i], s.Columns[i])
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v any, col Column) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return defuse(v)
+	case []byte:
+		return defuse(string(v))
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case time.Time:
+		if col.Format != "" && !strings.ContainsAny(col.Format, "hH") {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+// defuse quotes text that spreadsheet applications would run as a formula, as
+// values can come from users
+func defuse(s string) string {
+	if s == "" || !strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	return "'" + s
+}
@@ -0,0 +1,127 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Cell style indexes: 0 is the default, 1 the header. Column formats follow.
+const styleHeader = 1
+
+// firstCustomFormat is the first ID of number formats other than Excel's built-in ones
+const firstCustomFormat = 164
+
+// builtinFormats are number formats Excel knows by ID
+var builtinFormats = map[string]int{
+	"0": 1, "0.00": 2, "#,##0": 3, "#,##0.00": 4, "0%": 9, "0.00%": 10,
+}
+
+// styles collects the number formats of a sheet's columns into cell styles
+type styles struct {
+	formats map[string]int // Custom format codes to their IDs
+	order   []string
+	xfs     []int // Number format ID of each cell style after the header's
+	number  []int // Style of number cells by column
+	time    []int // Style of time cells by column
+	anyTime int   // Style of time cells beyond the columns
+}
+
+func newStyles(columns []Column) *styles {
+	st := &styles{formats: make(map[string]int)}
+	byFormat := make(map[string]int)
+	style := func(format string) int {
+		if format == "" {
+			return 0
+		}
+		if s, ok := byFormat[format]; ok {
+			return s
+		}
+		id, ok := builtinFormats[format]
+		if !ok {
+			if id, ok = st.formats[format]; !ok {
+				id = firstCustomFormat + len(st.order)
+				st.formats[format] = id
+				st.order = append(st.order, format)
+			}
+		}
+		st.xfs = append(st.xfs, id)
+		byFormat[format] = styleHeader + len(st.xfs)
+		return byFormat[format]
+	}
+
+	st.anyTime = style(defaultTimeFormat)
+	st.number = make([]int, len(columns))
+	st.time = make([]int, len(columns))
+	for i, col := range columns {
+		st.number[i] = style(col.Format)
+		format := col.Format
+		if format == "" {
+			format = defaultTimeFormat
+		}
+		st.time[i] = style(format)
+	}
+	return st
+}
+
+func (st *styles) write(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(st.order) > 0 {
+		fmt.Fprintf(&b, `<numFmts count="%d">`, len(st.order))
+		for _, format := range st.order {
+			fmt.Fprintf(&b, `<numFmt numFmtId="%d" formatCode="%s"/>`, st.formats[format], escape(format))
+		}
+		b.WriteString(`</numFmts>`)
+	}
+	b.WriteString(`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`)
+	b.WriteString(`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`)
+	b.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	b.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	fmt.Fprintf(&b, `<cellXfs count="%d">`, 2+len(st.xfs))
+	b.WriteString(`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`)
+	b.WriteString(`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`)
+	for _, id := range st.xfs {
+		fmt.Fprintf(&b, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, id)
+	}
+	b.WriteString(`</cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (st *styles) numberStyle(column int) int {
+	if column < len(st.number) {
+		return st.number[column]
+	}
+	return 0
+}
+
+func (st *styles) timeStyle(column int) int {
+	if column < len(st.time) {
+		return st.time[column]
+	}
+	return st.anyTime
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const contentTypesXML = xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const rootRelsXML = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookXML = xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const workbookRelsXML = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
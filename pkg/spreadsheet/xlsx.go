@@ -0,0 +1,208 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxRows is the most rows a worksheet holds, the header included
+const maxRows = 1 << 20
+
+const defaultTimeFormat = "yyyy-mm-dd hh:mm:ss"
+
+// excelEpoch is day 0 of Excel's date serials, which counts the 1900 leap day
+// that wasn't
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// WriteXLSX writes s as an Office Open XML workbook, with the header row bold,
+// frozen and filterable
+func WriteXLSX(w io.Writer, s Sheet) error {
+	if len(s.Rows)+1 > maxRows {
+		return fmt.Errorf("spreadsheet: %d rows are more than a worksheet holds", len(s.Rows))
+	}
+	name := sheetName(s.Name)
+	styles := newStyles(s.Columns)
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content func(io.Writer) error
+	}{
+		{"[Content_Types].xml", static(contentTypesXML)},
+		{"_rels/.rels", static(rootRelsXML)},
+		{"xl/workbook.xml", static(fmt.Sprintf(workbookXML, escape(name)))},
+		{"xl/_rels/workbook.xml.rels", static(workbookRelsXML)},
+		{"xl/styles.xml", styles.write},
+		{"xl/worksheets/sheet1.xml", func(w io.Writer) error { return writeSheet(w, s, styles) }},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if err := f.content(fw); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func static(content string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	}
+}
+
+func writeSheet(w io.Writer, s Sheet, st *styles) error {
+	b := &errWriter{w: w}
+	b.WriteString(xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(s.Columns) > 0 {
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+		b.WriteString(`<cols>`)
+		for i, col := range s.Columns {
+			width := col.Width
+			if width <= 0 {
+				width = math.Max(10, float64(utf8.RuneCountInString(col.Header))+4)
+			}
+			fmt.Fprintf(b, `<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, strconv.FormatFloat(width, 'f', -1, 64))
+		}
+		b.WriteString(`</cols>`)
+	}
+
+	b.WriteString(`<sheetData>`)
+	if len(s.Columns) > 0 {
+		b.WriteString(`<row r="1">`)
+		for i, col := range s.Columns {
+			fmt.Fprintf(b, `<c r="%s1" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, columnName(i), styleHeader, escape(col.Header))
+		}
+		b.WriteString(`</row>`)
+	}
+	for r, row := range s.Rows {
+		fmt.Fprintf(b, `<row r="%d">`, r+2)
+		for i, v := range row {
+			ref := columnName(i) + strconv.Itoa(r+2)
+			writeCell(b, ref, v, st.numberStyle(i), st.timeStyle(i))
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+	if len(s.Columns) > 0 {
+		fmt.Fprintf(b, `<autoFilter ref="A1:%s%d"/>`, columnName(len(s.Columns)-1), len(s.Rows)+1)
+	}
+	b.WriteString(`</worksheet>`)
+	return b.err
+}
+
+func writeCell(b *errWriter, ref string, v any, numberStyle, timeStyle int) {
+	var number string
+	switch v := v.(type) {
+	case nil:
+		return
+	case bool:
+		value := "0"
+		if v {
+			value = "1"
+		}
+		fmt.Fprintf(b, `<c r="%s" t="b"><v>%s</v></c>`, ref, value)
+		return
+	case time.Time:
+		// Serials are wall clock times; the location is dropped, as Excel has none
+		wall := time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.UTC)
+		serial := float64(wall.Sub(excelEpoch)) / float64(24*time.Hour)
+		fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, timeStyle, strconv.FormatFloat(serial, 'f', -1, 64))
+		return
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		number = fmt.Sprint(v)
+	case float32:
+		number = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+		number = strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		writeText(b, ref, string(v))
+		return
+	default:
+		writeText(b, ref, fmt.Sprint(v))
+		return
+	}
+	fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, numberStyle, number)
+}
+
+func writeText(b *errWriter, ref, text string) {
+	fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(text))
+}
+
+// columnName returns the letters of the column at index i: A, B, ..., Z, AA, ...
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// sheetName makes a valid worksheet name: at most 31 characters, none of :\/?*[]
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		return "Sheet1"
+	}
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	return name
+}
+
+// escape escapes text for XML, dropping the control characters XML can't hold
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != utf8.RuneError && r != 0xFFFE && r != 0xFFFF):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// errWriter keeps the first write error, so a sheet can be written without checking
+// every call
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+func (e *errWriter) WriteString(s string) {
+	io.WriteString(e, s)
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Local stores objects as files under a directory: content in objects/ and the
+// metadata of each in a JSON file of the same key in meta/
+type Local struct {
+	dir string
+}
+
+// NewLocal creates the directory if needed
+func NewLocal(dir string) (*Local, error) {
+	if dir == "" {
+		return nil, errors.New("storage: the local backend needs a directory")
+	}
+	for _, sub := range []string{"objects", "meta", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) objectPath(key string) string {
+	return filepath.Join(l.dir, "objects", filepath.FromSlash(key))
+}
+
+func (l *Local) metaPath(key string) string {
+	return filepath.Join(l.dir, "meta", filepath.FromSlash(key)+".json")
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Join(l.dir, "tmp"), "put-*")
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), readerWithContext(ctx, r))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Object{}, err
+	}
+
+	obj := Object{Key: key, Size: size, ContentType: contentType, ETag: hex.EncodeToString(h.Sum(nil)), ModTime: time.Now().UTC()}
+	meta, err := json.Marshal(obj)
+	if err != nil {
+		return Object{}, err
+	}
+	for _, p := range []string{l.objectPath(key), l.metaPath(key)} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			return Object{}, err
+		}
+	}
+	if err := os.Rename(tmp.Name(), l.objectPath(key)); err != nil {
+		return Object{}, err
+	}
+	if err := os.WriteFile(l.metaPath(key), meta, 0o600); err != nil {
+		return Object{}, err
+	}
+	return obj, nil
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	obj, err := l.Stat(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	f, err := os.Open(l.objectPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return f, obj, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	data, err := os.ReadFile(l.metaPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	var obj Object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return Object{}, err
+	}
+	return obj, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	for _, p := range []string{l.metaPath(key), l.objectPath(key)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]Object, error) {
+	root := filepath.Join(l.dir, "meta")
+	var list []Object
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return err
+		}
+		rel, err := filepath.Rel(root, strings.TrimSuffix(p, ".json"))
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		obj, err := l.Stat(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		list = append(list, obj)
+		return ctx.Err()
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, err
+}
+
+// readerWithContext stops copying large objects once ctx is done
+func readerWithContext(ctx context.Context, r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return r.Read(p)
+	})
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps objects in memory, for development and single-instance deployments
+// whose files may be lost on restart
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	Object
+	data []byte
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]memoryObject)}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+	data, err := io.ReadAll(readerWithContext(ctx, r))
+	if err != nil {
+		return Object{}, err
+	}
+	sum := sha256.Sum256(data)
+	obj := Object{Key: key, Size: int64(len(data)), ContentType: contentType, ETag: hex.EncodeToString(sum[:]), ModTime: time.Now().UTC()}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memoryObject{obj, data}
+	return obj, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+func (m *Memory) Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return nil, Object{}, ErrNotFound
+	}
+	return nopCloser{bytes.NewReader(o.data)}, o.Object, nil
+}
+
+func (m *Memory) Stat(ctx context.Context, key string) (Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return Object{}, ErrNotFound
+	}
+	return o.Object, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context, prefix string) ([]Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var list []Object
+	for key, o := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			list = append(list, o.Object)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
@@ -0,0 +1,26 @@
+package storage
+
+import "net/http"
+
+// Serve writes the object under key as the response to r, streaming it from the
+// backend. http.ServeContent answers the conditional and range requests: Range gets
+// 206 Partial Content with the bytes asked for, or 416 when none are there, If-Range
+// falls back to the whole object once it changed, and If-None-Match and
+// If-Modified-Since get 304. The ETag is strong, as If-Range requires.
+func Serve(w http.ResponseWriter, r *http.Request, s Storage, key string) error {
+	content, obj, err := s.Open(r.Context(), key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	h := w.Header()
+	if obj.ContentType != "" {
+		h.Set("Content-Type", obj.ContentType)
+	}
+	if obj.ETag != "" {
+		h.Set("ETag", `"`+obj.ETag+`"`)
+	}
+	http.ServeContent(w, r, "", obj.ModTime, content)
+	return nil
+}
@@ -0,0 +1,75 @@
+// Package storage keeps files, like uploads and generated documents, behind one
+// interface, so features don't care whether they end up on local disk or elsewhere.
+// Objects are addressed by slash-separated keys like images/123/original.jpg.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+)
+
+// ErrNotFound is returned for keys without an object
+var ErrNotFound = errors.New("storage: object not found")
+
+func init() {
+	apperrors.Register(ErrNotFound, apperrors.CodeNotFound)
+}
+
+// Config selects the storage backend
+type Config struct {
+	Backend string `yaml:"backend"` // local (default) or memory
+	Dir     string `yaml:"dir"`     // Root directory of the local backend
+}
+
+// Object describes a stored object
+type Object struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	ETag        string    `json:"etag"` // Hex SHA-256 of the content
+	ModTime     time.Time `json:"modTime"`
+}
+
+// Storage stores objects by key
+type Storage interface {
+	// Put stores the content of r under key, replacing any object there. Readers
+	// only ever see the previous or the complete new content.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error)
+	// Open returns the content of an object, seekable for range requests
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error)
+	Stat(ctx context.Context, key string) (Object, error)
+	// Delete removes an object; deleting a missing one is not an error
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// New creates the configured backend
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal(cfg.Dir)
+	case "memory":
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("storage: unknown backend %q, want local or memory", cfg.Backend)
+}
+
+// checkKey rejects keys that could escape a backend's namespace
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package tenant
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var missingScope = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "tenant_scope_missing_total",
+	Help: "Keys that could not be built because the context stated no tenant scope.",
+})
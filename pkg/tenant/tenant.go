@@ -0,0 +1,102 @@
+// Package tenant carries the tenant a request or job acts for in its context, and
+// namespaces the keys tenants share a store for by it, like cache and rate limit
+// keys. A context states its scope explicitly, either a tenant or shared, the
+// scope of anonymous requests and of system work acting for no tenant. Keys are
+// never built from a context without a scope: that's a code path that forgot to
+// state whose data it handles, and guessing shared would leak one tenant's
+// entries to another.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"go-api/pkg/authz"
+	"go-api/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ErrNoScope is returned for keys built from a context without a tenant scope
+var ErrNoScope = errors.New("tenant: context has no tenant scope")
+
+type scopeKey struct{}
+
+type scope struct {
+	tenant string // Empty when shared
+}
+
+// With returns a context acting for tenant id, or shared when id is empty
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{tenant: id})
+}
+
+// Shared returns a context acting for no tenant, like for system jobs
+func Shared(ctx context.Context) context.Context {
+	return With(ctx, "")
+}
+
+// FromContext returns the tenant ctx acts for; ok is false for shared and
+// unscoped contexts
+func FromContext(ctx context.Context) (string, bool) {
+	s, ok := ctx.Value(scopeKey{}).(scope)
+	return s.tenant, ok && s.tenant != ""
+}
+
+// Scoped reports whether ctx states its scope, a tenant or shared
+func Scoped(ctx context.Context) bool {
+	_, ok := ctx.Value(scopeKey{}).(scope)
+	return ok
+}
+
+// Key namespaces key by the scope of ctx. It fails, and logs the key, when ctx
+// has no scope.
+func Key(ctx context.Context, key string) (string, error) {
+	s, ok := ctx.Value(scopeKey{}).(scope)
+	if !ok {
+		missingScope.Inc()
+		logger.Error("key built without a tenant scope", zap.String("key", key), zap.Stack("stack"))
+		return "", ErrNoScope
+	}
+	if s.tenant == "" {
+		return "shared/" + key, nil
+	}
+	// Escaped, so tenant IDs can't reach into each other's keys
+	return "tenant/" + url.QueryEscape(s.tenant) + "/" + key, nil
+}
+
+// Middleware scopes requests to the tenant of the subject, and to shared for
+// anonymous ones and subjects without a tenant. It must come after
+// authz.SubjectFromJWT and signedurl's Middleware, which set the subject.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var id string
+		if sub, ok := authz.SubjectFromContext(c.Request.Context()); ok {
+			id = sub.Tenant
+		}
+		c.Request = c.Request.WithContext(With(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// Carrier keeps the scope of a request with the jobs it enqueues, implementing
+// queue.ContextCarrier. Jobs enqueued from an unscoped context run unscoped.
+type Carrier struct{}
+
+func (Carrier) Inject(ctx context.Context) map[string]string {
+	s, ok := ctx.Value(scopeKey{}).(scope)
+	if !ok {
+		return nil
+	}
+	return map[string]string{"tenant": s.tenant}
+}
+
+func (Carrier) Extract(ctx context.Context, values map[string]string) (context.Context, error) {
+	id, ok := values["tenant"]
+	if !ok {
+		return ctx, nil
+	}
+	return With(ctx, id), nil
+}
@@ -0,0 +1,99 @@
+package validate
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// EnumSource loads the allowed values of an enum
+type EnumSource func(ctx context.Context) ([]string, error)
+
+// SQLEnum loads an enum from the first column of a query, like
+// SELECT code FROM currencies WHERE active
+func SQLEnum(db *sql.DB, query string) EnumSource {
+	return func(ctx context.Context) ([]string, error) {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var values []string
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, rows.Err()
+	}
+}
+
+type enumCache struct {
+	source EnumSource
+
+	mu       sync.Mutex
+	values   []string
+	loadedAt time.Time
+}
+
+var (
+	enumsMu sync.RWMutex
+	enums   = make(map[string]*enumCache)
+)
+
+// RegisterEnum makes the values of source usable as enum=name. Values are cached for
+// the configured TTL; when reloading fails the previous values stay in use.
+func RegisterEnum(name string, source EnumSource) {
+	enumsMu.Lock()
+	defer enumsMu.Unlock()
+	enums[name] = &enumCache{source: source}
+}
+
+// enum accepts the values of the enum named by its parameter
+var enum = Rule{
+	Tag: "enum",
+	Func: func(fl validator.FieldLevel) bool {
+		enumsMu.RLock()
+		e, ok := enums[fl.Param()]
+		enumsMu.RUnlock()
+		if !ok {
+			panic("validate: unknown enum " + fl.Param())
+		}
+		return slices.Contains(e.load(fl.Param()), fl.Field().String())
+	},
+	Messages: map[string]string{
+		"en": "{field} must be one of the allowed {param}",
+		"de": "{field} muss einer der erlaubten Werte für {param} sein",
+		"fr": "{field} doit être l'une des valeurs autorisées pour {param}",
+	},
+}
+
+func (e *enumCache) load(name string) []string {
+	mu.RLock()
+	ttl, timeout := cfg.EnumCacheTTL, cfg.EnumTimeout
+	mu.RUnlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.loadedAt.IsZero() && time.Since(e.loadedAt) < ttl {
+		return e.values
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	values, err := e.source(ctx)
+	if err != nil {
+		logger.Error("failed to load enum", zap.String("enum", name), zap.Error(err))
+		return e.values
+	}
+	e.values, e.loadedAt = values, time.Now()
+	return values
+}
@@ -0,0 +1,175 @@
+package validate
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords are among the most used passwords and the words they are built
+// from. Passwords made of them are guessed first.
+var commonPasswords = []string{
+	"password", "passwort", "123456", "qwerty", "azerty", "qwertz", "abc123", "letmein",
+	"welcome", "monkey", "dragon", "master", "login", "admin", "iloveyou", "sunshine",
+	"princess", "football", "baseball", "shadow", "superman", "trustno1", "hello",
+	"freedom", "whatever", "secret", "summer", "winter", "spring", "autumn", "michael",
+	"jordan", "charlie", "computer", "internet", "starwars", "pokemon", "cookie",
+	"asdfgh", "zxcvbn", "111111", "000000", "654321", "changeme", "default", "test",
+}
+
+// keyboardRows are walked by passwords like qwerty and asdf
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "qwertzuiop", "azertyuiop"}
+
+// PasswordScore rates how hard a password is to guess from 0, trivial, to 4, strong,
+// like zxcvbn. It estimates the guesses an attacker needs by discounting common
+// passwords, keyboard walks, repeats and sequences, and l33t substitutions.
+func PasswordScore(pw string) int {
+	if pw == "" {
+		return 0
+	}
+	bits := passwordBits(pw)
+	switch guesses := math.Pow(2, bits); {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	}
+	return 4
+}
+
+func passwordBits(pw string) float64 {
+	lower := strings.ToLower(pw)
+	dictionary := math.Log2(float64(len(commonPasswords)))
+	for _, common := range commonPasswords {
+		if lower == common || unleet(lower) == common {
+			return dictionary
+		}
+	}
+
+	// Common words and keyboard walks inside the password cost a dictionary lookup
+	// instead of a character each, with or without substitutions
+	bits := 0.0
+	normalized := lower
+	for _, s := range []func(string) string{strings.Clone, unleet} {
+		normalized = s(normalized)
+		for _, common := range commonPasswords {
+			if len(common) >= 4 && strings.Contains(normalized, common) {
+				normalized = strings.Replace(normalized, common, "\x00", 1)
+				bits += dictionary
+			}
+		}
+	}
+	for _, row := range keyboardRows {
+		for n := len(row); n >= 4; n-- {
+			for i := 0; i+n <= len(row); i++ {
+				if walk := row[i : i+n]; strings.Contains(normalized, walk) {
+					normalized = strings.Replace(normalized, walk, "\x00", 1)
+					bits += math.Log2(float64(len(keyboardRows) * len(row) * 2))
+				}
+			}
+		}
+	}
+
+	return bits + runBits([]rune(normalized)) + caseBits(pw)
+}
+
+// wordBits is what guessing a word of up to wordLength letters costs, from a
+// dictionary of some 20,000 words
+const (
+	wordBits   = 14.3
+	wordLength = 6
+)
+
+// runBits estimates the rest of the password run by run of letters, digits and
+// symbols, like an attacker trying words, years and short numbers before brute force
+func runBits(runes []rune) float64 {
+	bits := 0.0
+	for start := 0; start < len(runes); {
+		class := charClass(runes[start])
+		end := start + 1
+		for end < len(runes) && charClass(runes[end]) == class {
+			end++
+		}
+		run := runes[start:end]
+		start = end
+
+		// Repeats and sequences like aaaa or 4567 add little after their first character
+		n, patterned := 0, 0
+		for i, r := range run {
+			if i > 0 && (r == run[i-1] || r == run[i-1]+1 || r == run[i-1]-1) {
+				patterned++
+			} else {
+				n++
+			}
+		}
+		bits += float64(patterned)
+		switch class {
+		case classNone:
+		case classLetter:
+			bits += min(float64(n)*math.Log2(26), math.Ceil(float64(n)/wordLength)*wordBits)
+		case classDigit:
+			if len(run) == 4 && (run[0] == '1' && run[1] == '9' || run[0] == '2' && run[1] == '0') {
+				bits += math.Log2(200) // A year
+			} else {
+				bits += float64(n) * math.Log2(10)
+			}
+		case classSymbol:
+			bits += float64(n) * math.Log2(33)
+		default:
+			bits += float64(n) * math.Log2(100)
+		}
+	}
+	return bits
+}
+
+// caseBits is what guessing the capitalisation costs: a bit for a capital first
+// letter, which attackers try early, and one per capital anywhere else
+func caseBits(pw string) float64 {
+	bits := 0.0
+	for i, r := range []rune(pw) {
+		if unicode.IsUpper(r) {
+			bits++
+			if i > 0 {
+				bits++
+			}
+		}
+	}
+	return bits
+}
+
+const (
+	classNone = iota // Removed words and walks
+	classLetter
+	classDigit
+	classSymbol
+	classOther
+)
+
+func charClass(r rune) int {
+	switch {
+	case r == 0:
+		return classNone
+	case r >= 'a' && r <= 'z':
+		return classLetter
+	case r >= '0' && r <= '9':
+		return classDigit
+	case r < unicode.MaxASCII:
+		return classSymbol
+	}
+	return classOther
+}
+
+var leet = strings.NewReplacer("4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+// unleet undoes substitutions like p@ssw0rd, which attackers try early. Passwords
+// that are all digits are left alone, so 123456 is still recognised.
+func unleet(pw string) string {
+	if strings.IndexFunc(pw, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return pw
+	}
+	return leet.Replace(pw)
+}
@@ -0,0 +1,113 @@
+package validate
+
+import (
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// phone accepts numbers in E.164 format, like +14155552671
+var phone = Rule{
+	Tag: "phone",
+	Func: func(fl validator.FieldLevel) bool {
+		return e164.MatchString(fl.Field().String())
+	},
+	Messages: map[string]string{
+		"en": "{field} must be a phone number in international format, like +14155552671",
+		"de": "{field} muss eine Telefonnummer im internationalen Format sein, z. B. +4930123456",
+		"fr": "{field} doit être un numéro de téléphone au format international, par ex. +33123456789",
+	},
+}
+
+// ibanLengths are the IBAN lengths of the countries using them
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29,
+	"BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29,
+	"ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28,
+	"HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20,
+	"LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22, "MK": 19,
+	"MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29,
+	"RO": 24, "RS": 22, "SA": 24, "SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// iban accepts account numbers with a valid country length and checksum. Spaces, as
+// in printed IBANs, are ignored.
+var iban = Rule{
+	Tag: "iban",
+	Func: func(fl validator.FieldLevel) bool {
+		return ValidIBAN(fl.Field().String())
+	},
+	Messages: map[string]string{
+		"en": "{field} must be a valid IBAN",
+		"de": "{field} muss eine gültige IBAN sein",
+		"fr": "{field} doit être un IBAN valide",
+	},
+}
+
+// ValidIBAN checks an IBAN's length for its country and its ISO 7064 checksum
+func ValidIBAN(s string) bool {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	if len(s) < 5 || len(s) != ibanLengths[s[:2]] {
+		return false
+	}
+	// Move the country and check digits to the end and read letters as 10 to 35
+	var digits strings.Builder
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10))
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && n.Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// timezone accepts IANA time zone names like Europe/Berlin
+var timezone = Rule{
+	Tag: "timezone",
+	Func: func(fl validator.FieldLevel) bool {
+		name := fl.Field().String()
+		if name == "" || name == "Local" {
+			return false
+		}
+		_, err := time.LoadLocation(name)
+		return err == nil
+	},
+	Messages: map[string]string{
+		"en": "{field} must be an IANA time zone, like Europe/Berlin",
+		"de": "{field} muss eine IANA-Zeitzone sein, z. B. Europe/Berlin",
+		"fr": "{field} doit être un fuseau horaire IANA, par ex. Europe/Paris",
+	},
+}
+
+// password accepts passwords scoring at least its parameter, 3 by default, on the
+// 0 to 4 scale of PasswordScore
+var password = Rule{
+	Tag: "password",
+	Func: func(fl validator.FieldLevel) bool {
+		min := 3
+		if p := fl.Param(); p != "" {
+			var err error
+			if min, err = strconv.Atoi(p); err != nil {
+				panic("validate: password parameter must be a score from 0 to 4, got " + p)
+			}
+		}
+		return PasswordScore(fl.Field().String()) >= min
+	},
+	Messages: map[string]string{
+		"en": "{field} is too easy to guess, use a longer password or passphrase",
+		"de": "{field} ist zu leicht zu erraten, verwende ein längeres Passwort oder eine Passphrase",
+		"fr": "{field} est trop facile à deviner, utilisez un mot de passe ou une phrase de passe plus longue",
+	},
+}
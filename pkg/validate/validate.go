@@ -0,0 +1,63 @@
+// Package validate adds reusable rules to the binding validator, used in binding
+// tags like any built-in one:
+//
+//	Phone    string `json:"phone" binding:"required,phone"`
+//	Password string `json:"password" binding:"required,password=3"`
+//	Currency string `json:"currency" binding:"enum=currencies"`
+//
+// Each rule registers messages by language, which validation errors are translated
+// to from the request's Accept-Language.
+package validate
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apperrors "go-api/pkg/errors"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Config holds validation configuration
+type Config struct {
+	EnumCacheTTL time.Duration `yaml:"enumCacheTTL"` // How long database enums are cached
+	EnumTimeout  time.Duration `yaml:"enumTimeout"`  // Limit on loading a database enum
+}
+
+// Rule is a validation rule usable in binding tags
+type Rule struct {
+	Tag      string
+	Func     validator.Func
+	Messages map[string]string // By language, templates with {field} and {param}
+}
+
+var (
+	mu  sync.RWMutex
+	cfg = Config{EnumCacheTTL: time.Minute, EnumTimeout: 2 * time.Second}
+)
+
+// Init configures enums and registers the built-in rules, call it once at startup
+// before requests are bound
+func Init(c Config) error {
+	mu.Lock()
+	cfg = c
+	mu.Unlock()
+	return Register(phone, iban, timezone, password, enum)
+}
+
+// Register adds rules to the binding validator, replacing rules with the same tag
+func Register(rules ...Rule) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("binding validator %T doesn't support custom rules", binding.Validator.Engine())
+	}
+	for _, r := range rules {
+		if err := v.RegisterValidation(r.Tag, r.Func); err != nil {
+			return fmt.Errorf("register %s: %w", r.Tag, err)
+		}
+		apperrors.RegisterMessages(r.Tag, r.Messages)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package watchdog
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes mounts GET /debug/watchdog on a router group
+func (w *Watchdog) RegisterRoutes(rg gin.IRoutes) {
+	rg.GET("/debug/watchdog", func(c *gin.Context) {
+		c.JSON(http.StatusOK, w.Report())
+	})
+}
@@ -0,0 +1,175 @@
+// Package watchdog samples the runtime's goroutine count, heap and GC pauses and
+// warns when they cross thresholds, logging a goroutine dump so leaks introduced by
+// new handlers can be traced to the code holding them.
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"go-api/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config holds watchdog thresholds. A zero threshold is not checked.
+type Config struct {
+	Interval      time.Duration `yaml:"interval"`
+	History       int           `yaml:"history"` // Samples kept for /debug/watchdog
+	MaxGoroutines int           `yaml:"maxGoroutines"`
+	MaxHeapBytes  uint64        `yaml:"maxHeapBytes"`
+	MaxGCPause    time.Duration `yaml:"maxGCPause"`
+	GrowthSamples int           `yaml:"growthSamples"` // Warn when goroutines grew on this many samples in a row
+	DumpCooldown  time.Duration `yaml:"dumpCooldown"`  // Minimum time between goroutine dumps
+}
+
+// Sample is a snapshot of the runtime
+type Sample struct {
+	Time       time.Time     `json:"time"`
+	Goroutines int           `json:"goroutines"`
+	HeapAlloc  uint64        `json:"heapAlloc"`
+	HeapInuse  uint64        `json:"heapInuse"`
+	NumGC      uint32        `json:"numGC"`
+	MaxGCPause time.Duration `json:"maxGCPause"` // Longest pause since the previous sample
+	Breaches   []string      `json:"breaches,omitempty"`
+}
+
+// Watchdog samples the runtime on an interval
+type Watchdog struct {
+	cfg Config
+
+	mu       sync.RWMutex
+	samples  []Sample // Oldest first
+	growth   int      // Consecutive samples the goroutine count grew on
+	lastGC   uint32
+	lastDump time.Time
+}
+
+// New creates a watchdog, filling in defaults for unset intervals
+func New(cfg Config) *Watchdog {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.History <= 0 {
+		cfg.History = 60
+	}
+	return &Watchdog{cfg: cfg}
+}
+
+// Run samples until ctx is cancelled
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		w.sample()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watchdog) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := Sample{
+		Time:       time.Now().UTC(),
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  ms.HeapAlloc,
+		HeapInuse:  ms.HeapInuse,
+		NumGC:      ms.NumGC,
+	}
+
+	w.mu.Lock()
+	// PauseNs is a ring of the last 256 pauses, indexed by GC number
+	for gc := max(w.lastGC, ms.NumGC-min(ms.NumGC, 256)) + 1; gc <= ms.NumGC; gc++ {
+		s.MaxGCPause = max(s.MaxGCPause, time.Duration(ms.PauseNs[(gc+255)%256]))
+	}
+	w.lastGC = ms.NumGC
+
+	if n := len(w.samples); n > 0 && s.Goroutines > w.samples[n-1].Goroutines {
+		w.growth++
+	} else {
+		w.growth = 0
+	}
+
+	if w.cfg.MaxGoroutines > 0 && s.Goroutines >= w.cfg.MaxGoroutines {
+		s.Breaches = append(s.Breaches, "goroutines")
+	}
+	if w.cfg.GrowthSamples > 0 && w.growth >= w.cfg.GrowthSamples {
+		s.Breaches = append(s.Breaches, "goroutine_growth")
+	}
+	if w.cfg.MaxHeapBytes > 0 && s.HeapAlloc >= w.cfg.MaxHeapBytes {
+		s.Breaches = append(s.Breaches, "heap")
+	}
+	if w.cfg.MaxGCPause > 0 && s.MaxGCPause >= w.cfg.MaxGCPause {
+		s.Breaches = append(s.Breaches, "gc_pause")
+	}
+
+	w.samples = append(w.samples, s)
+	if len(w.samples) > w.cfg.History {
+		w.samples = w.samples[1:]
+	}
+	dump := len(s.Breaches) > 0 && time.Since(w.lastDump) >= w.cfg.DumpCooldown
+	if dump {
+		w.lastDump = time.Now()
+	}
+	w.mu.Unlock()
+
+	if len(s.Breaches) == 0 {
+		return
+	}
+	fields := []zap.Field{
+		zap.Strings("breaches", s.Breaches),
+		zap.Int("goroutines", s.Goroutines),
+		zap.Uint64("heapAlloc", s.HeapAlloc),
+		zap.Duration("maxGCPause", s.MaxGCPause),
+	}
+	if dump {
+		var buf bytes.Buffer
+		// Debug level 1 groups identical stacks, which keeps leaks readable
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err == nil {
+			fields = append(fields, zap.String("goroutineDump", buf.String()))
+		}
+	}
+	logger.Warn("watchdog threshold breached", fields...)
+}
+
+// Report is the watchdog's state as served at /debug/watchdog
+type Report struct {
+	Current    *Sample    `json:"current"`
+	Thresholds Thresholds `json:"thresholds"`
+	Samples    []Sample   `json:"samples"`
+}
+
+// Thresholds are the configured limits, zero when unchecked
+type Thresholds struct {
+	Goroutines    int           `json:"goroutines,omitempty"`
+	GrowthSamples int           `json:"growthSamples,omitempty"`
+	HeapBytes     uint64        `json:"heapBytes,omitempty"`
+	GCPause       time.Duration `json:"gcPause,omitempty"`
+}
+
+// Report returns the latest sample and the recent history
+func (w *Watchdog) Report() Report {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	r := Report{
+		Thresholds: Thresholds{
+			Goroutines:    w.cfg.MaxGoroutines,
+			GrowthSamples: w.cfg.GrowthSamples,
+			HeapBytes:     w.cfg.MaxHeapBytes,
+			GCPause:       w.cfg.MaxGCPause,
+		},
+		Samples: append([]Sample(nil), w.samples...),
+	}
+	if n := len(w.samples); n > 0 {
+		r.Current = &r.Samples[n-1]
+	}
+	return r
+}
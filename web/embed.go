@@ -0,0 +1,13 @@
+package web
+
+import "embed"
+
+// Dist holds the frontend build served in static mode when no directory is configured
+//
+//go:embed all:dist
+var Dist embed.FS
+
+// Templates holds the server-rendered layouts, partials, pages and emails
+//
+//go:embed templates
+var Templates embed.FS